@@ -83,6 +83,13 @@ type AzureAuthConfig struct {
 // than only azure clients except VM/VMSS and network resource ones use this method to fetch Token.
 // For tokens for VM/VMSS and network resource ones, please check GetMultiTenantServicePrincipalToken and GetNetworkResourceServicePrincipalToken.
 func GetServicePrincipalToken(config *AzureAuthConfig, env *azure.Environment) (*adal.ServicePrincipalToken, error) {
+	return cachedServicePrincipalToken(tokenCacheKey(config, config.TenantID, env.ServiceManagementEndpoint), func() (*adal.ServicePrincipalToken, error) {
+		return newServicePrincipalToken(config, env)
+	})
+}
+
+// newServicePrincipalToken creates a fresh service principal token based on the configuration.
+func newServicePrincipalToken(config *AzureAuthConfig, env *azure.Environment) (*adal.ServicePrincipalToken, error) {
 	var tenantID string
 	if strings.EqualFold(config.IdentitySystem, ADFSIdentitySystem) {
 		tenantID = ADFSIdentitySystem
@@ -186,6 +193,13 @@ func GetMultiTenantServicePrincipalToken(config *AzureAuthConfig, env *azure.Env
 //
 // Azure network resource (Load Balancer, Public IP, Route Table, Network Security Group and their sub level resources) clients use this multi-tenant token, in order to operate resources in AAD Tenant specified by NetworkResourceTenantID.
 func GetNetworkResourceServicePrincipalToken(config *AzureAuthConfig, env *azure.Environment) (*adal.ServicePrincipalToken, error) {
+	return cachedServicePrincipalToken(tokenCacheKey(config, config.NetworkResourceTenantID, env.ServiceManagementEndpoint), func() (*adal.ServicePrincipalToken, error) {
+		return newNetworkResourceServicePrincipalToken(config, env)
+	})
+}
+
+// newNetworkResourceServicePrincipalToken creates a fresh service principal token for the network resources tenant based on the configuration.
+func newNetworkResourceServicePrincipalToken(config *AzureAuthConfig, env *azure.Environment) (*adal.ServicePrincipalToken, error) {
 	err := config.checkConfigWhenNetworkResourceInDifferentTenant()
 	if err != nil {
 		return nil, fmt.Errorf("got error(%v) in getting network resources service principal token", err)
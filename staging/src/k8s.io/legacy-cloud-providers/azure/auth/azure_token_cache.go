@@ -0,0 +1,191 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// tokenRefreshMargin is how long before expiry a cached token is
+	// refreshed proactively, so request bursts never pay the AAD round-trip.
+	tokenRefreshMargin = 5 * time.Minute
+	// tokenRefreshJitterFactor randomizes the refresh margin so that
+	// processes started together don't hit AAD at the same moment.
+	tokenRefreshJitterFactor = 0.2
+	// tokenRefreshInterval is how often the cached tokens are inspected for
+	// upcoming expiry.
+	tokenRefreshInterval = time.Minute
+	// tokenRefreshRetries is how many times a transient AAD failure is
+	// retried before it is reported.
+	tokenRefreshRetries = 3
+)
+
+// terminalAADErrorCodes are AADSTS error codes that indicate bad credentials
+// rather than a transient AAD problem; retrying them only delays the failure.
+var terminalAADErrorCodes = []string{
+	"AADSTS7000215", // invalid client secret
+	"AADSTS700016",  // application not found in the tenant
+	"AADSTS90002",   // tenant not found
+	"AADSTS700027",  // invalid client certificate
+}
+
+var (
+	// tokenCache shares one service principal token per tenant, client,
+	// credential and resource, so each client configuration reuses the token
+	// and its refresh state instead of acquiring its own.
+	tokenCacheLock sync.Mutex
+	tokenCache     = map[string]*adal.ServicePrincipalToken{}
+
+	tokenRefreshLatency  = registerTokenRefreshLatency()
+	tokenRefreshFailures = registerTokenRefreshFailures()
+)
+
+// tokenCacheKey identifies a cached token. The whole auth configuration is
+// hashed into the key so that any credential change, such as a rotated
+// secret, gets a fresh token instead of a stale cached one.
+func tokenCacheKey(config *AzureAuthConfig, tenantID, resource string) string {
+	fingerprint := sha256.Sum256([]byte(fmt.Sprintf("%+v", *config)))
+	return strings.Join([]string{strings.ToLower(tenantID), fmt.Sprintf("%x", fingerprint), resource}, "|")
+}
+
+// cachedServicePrincipalToken returns the token cached under key, building it
+// with build on first use.
+func cachedServicePrincipalToken(key string, build func() (*adal.ServicePrincipalToken, error)) (*adal.ServicePrincipalToken, error) {
+	tokenCacheLock.Lock()
+	defer tokenCacheLock.Unlock()
+
+	if token, ok := tokenCache[key]; ok {
+		return token, nil
+	}
+
+	token, err := build()
+	if err != nil {
+		return nil, err
+	}
+	tokenCache[key] = token
+	return token, nil
+}
+
+// RefreshTokenWithRetry refreshes the token, retrying transient AAD failures
+// with backoff. Terminal AADSTS errors such as an invalid client secret are
+// returned immediately. Latency and failures are recorded as metrics.
+func RefreshTokenWithRetry(ctx context.Context, token *adal.ServicePrincipalToken) error {
+	var err error
+	delay := time.Second
+	for attempt := 0; attempt < tokenRefreshRetries; attempt++ {
+		start := time.Now()
+		err = token.RefreshWithContext(ctx)
+		tokenRefreshLatency.Observe(time.Since(start).Seconds())
+		if err == nil {
+			return nil
+		}
+
+		if !isRetriableAADError(err) {
+			tokenRefreshFailures.WithLabelValues("terminal").Inc()
+			return err
+		}
+		tokenRefreshFailures.WithLabelValues("retriable").Inc()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+
+	return err
+}
+
+// isRetriableAADError reports whether an AAD failure is worth retrying.
+// Credential problems are terminal; everything else (network errors, AAD
+// throttling) is treated as transient.
+func isRetriableAADError(err error) bool {
+	message := err.Error()
+	for _, code := range terminalAADErrorCodes {
+		if strings.Contains(message, code) {
+			return false
+		}
+	}
+	return true
+}
+
+// StartProactiveTokenRefresh refreshes the cached tokens ahead of their
+// expiry, with jitter, until stop is closed.
+func StartProactiveTokenRefresh(stop <-chan struct{}) {
+	go wait.Until(refreshCachedTokens, tokenRefreshInterval, stop)
+}
+
+// refreshCachedTokens refreshes every cached token that is about to expire.
+func refreshCachedTokens() {
+	tokenCacheLock.Lock()
+	tokens := make([]*adal.ServicePrincipalToken, 0, len(tokenCache))
+	for _, token := range tokenCache {
+		tokens = append(tokens, token)
+	}
+	tokenCacheLock.Unlock()
+
+	for _, token := range tokens {
+		if !token.Token().WillExpireIn(wait.Jitter(tokenRefreshMargin, tokenRefreshJitterFactor)) {
+			continue
+		}
+		if err := RefreshTokenWithRetry(context.Background(), token); err != nil {
+			klog.Errorf("refreshCachedTokens: proactive token refresh failed: %v", err)
+		}
+	}
+}
+
+// registerTokenRefreshLatency registers the token refresh latency metrics.
+func registerTokenRefreshLatency() metrics.ObserverMetric {
+	histogram := metrics.NewHistogram(
+		&metrics.HistogramOpts{
+			Name:           "cloudprovider_azure_token_refresh_duration_seconds",
+			Help:           "Latency of AAD token refreshes",
+			Buckets:        []float64{.1, .25, .5, 1, 2.5, 5, 10, 30},
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+	legacyregistry.MustRegister(histogram)
+	return histogram
+}
+
+// registerTokenRefreshFailures registers the token refresh failure metrics.
+func registerTokenRefreshFailures() *metrics.CounterVec {
+	counter := metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name:           "cloudprovider_azure_token_refresh_failures_total",
+			Help:           "Number of failed AAD token refreshes by error classification",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"classification"},
+	)
+	legacyregistry.MustRegister(counter)
+	return counter
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetServicePrincipalTokenIsCached(t *testing.T) {
+	env := &azure.PublicCloud
+	config := &AzureAuthConfig{
+		TenantID:        "TenantID",
+		AADClientID:     "AADClientID",
+		AADClientSecret: "AADClientSecret",
+	}
+
+	first, err := GetServicePrincipalToken(config, env)
+	assert.NoError(t, err)
+	second, err := GetServicePrincipalToken(config, env)
+	assert.NoError(t, err)
+	assert.True(t, first == second, "same configuration should share one token")
+
+	rotated := *config
+	rotated.AADClientSecret = "RotatedSecret"
+	third, err := GetServicePrincipalToken(&rotated, env)
+	assert.NoError(t, err)
+	assert.True(t, first != third, "rotated credentials should get a fresh token")
+}
+
+func TestIsRetriableAADError(t *testing.T) {
+	tests := []struct {
+		desc      string
+		err       error
+		retriable bool
+	}{
+		{
+			desc:      "network errors should be retriable",
+			err:       fmt.Errorf("dial tcp: i/o timeout"),
+			retriable: true,
+		},
+		{
+			desc:      "AAD throttling should be retriable",
+			err:       fmt.Errorf("adal: Refresh request failed. Status Code = '429'. AADSTS90033: transient error"),
+			retriable: true,
+		},
+		{
+			desc:      "invalid client secret should be terminal",
+			err:       fmt.Errorf("adal: Refresh request failed. AADSTS7000215: Invalid client secret is provided"),
+			retriable: false,
+		},
+		{
+			desc:      "unknown tenant should be terminal",
+			err:       fmt.Errorf("adal: Refresh request failed. AADSTS90002: Tenant not found"),
+			retriable: false,
+		},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.retriable, isRetriableAADError(test.err), test.desc)
+	}
+}
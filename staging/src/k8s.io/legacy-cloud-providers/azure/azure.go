@@ -23,6 +23,9 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -42,6 +45,7 @@ import (
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/component-base/version"
 	"k8s.io/klog/v2"
 	"k8s.io/legacy-cloud-providers/azure/auth"
 	azcache "k8s.io/legacy-cloud-providers/azure/cache"
@@ -50,6 +54,8 @@ import (
 	"k8s.io/legacy-cloud-providers/azure/clients/fileclient"
 	"k8s.io/legacy-cloud-providers/azure/clients/interfaceclient"
 	"k8s.io/legacy-cloud-providers/azure/clients/loadbalancerclient"
+	"k8s.io/legacy-cloud-providers/azure/clients/monitorclient"
+	"k8s.io/legacy-cloud-providers/azure/clients/networkwatcherclient"
 	"k8s.io/legacy-cloud-providers/azure/clients/publicipclient"
 	"k8s.io/legacy-cloud-providers/azure/clients/routeclient"
 	"k8s.io/legacy-cloud-providers/azure/clients/routetableclient"
@@ -80,12 +86,18 @@ const (
 	backoffExponentDefault = 1.5
 	backoffDurationDefault = 5 // in seconds
 	backoffJitterDefault   = 1.0
+	// lockCooldownDefaultInSeconds is the default cooldown for writes against a
+	// resource group with a detected management lock.
+	lockCooldownDefaultInSeconds = 300
 	// According to https://docs.microsoft.com/en-us/azure/azure-subscription-service-limits#load-balancer.
 	maximumLoadBalancerRuleCount = 250
 
 	vmTypeVMSS     = "vmss"
 	vmTypeStandard = "standard"
 
+	nodeNameResolutionMethodNodeName   = "nodename"
+	nodeNameResolutionMethodProviderID = "providerid"
+
 	loadBalancerSkuBasic    = "basic"
 	loadBalancerSkuStandard = "standard"
 
@@ -111,6 +123,21 @@ var (
 	defaultDisableOutboundSNAT = false
 )
 
+// MultipleStandardLoadBalancerConfiguration maps services and node pools to
+// a dedicated Standard Load Balancer in the multi-SLB mode.
+type MultipleStandardLoadBalancerConfiguration struct {
+	// Name is the name of the Standard Load Balancer. The internal variant
+	// of the load balancer gets the usual "-internal" suffix appended.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// ServiceNamespaces lists the namespaces whose services are placed on
+	// this load balancer. Services in namespaces not claimed by any
+	// configuration land on the default cluster load balancer.
+	ServiceNamespaces []string `json:"serviceNamespaces,omitempty" yaml:"serviceNamespaces,omitempty"`
+	// VMSetNames lists the agent pools whose nodes are added to the backend
+	// pools of this load balancer. All nodes join when the list is empty.
+	VMSetNames []string `json:"vmSetNames,omitempty" yaml:"vmSetNames,omitempty"`
+}
+
 // Config holds the configuration parsed from the --cloud-config flag
 // All fields are required unless otherwise specified
 // NOTE: Cloud config files should follow the same Kubernetes deprecation policy as
@@ -140,6 +167,11 @@ type Config struct {
 	RouteTableName string `json:"routeTableName,omitempty" yaml:"routeTableName,omitempty"`
 	// The name of the resource group that the RouteTable is deployed in
 	RouteTableResourceGroup string `json:"routeTableResourceGroup,omitempty" yaml:"routeTableResourceGroup,omitempty"`
+	// RetainRoutesOnDeallocation keeps the pod CIDR route of a node whose VM
+	// is deallocated (e.g. by stop/start pools), so restarting the VM does not
+	// wait on route reprogramming. The route is still deleted once the VM is
+	// gone.
+	RetainRoutesOnDeallocation bool `json:"retainRoutesOnDeallocation,omitempty" yaml:"retainRoutesOnDeallocation,omitempty"`
 	// (Optional) The name of the availability set that should be used as the load balancer backend
 	// If this is set, the Azure cloudprovider will only add nodes from that availability set to the load
 	// balancer backend pool. If this is not set, and multiple agent pools (availability sets) are used, then
@@ -149,6 +181,12 @@ type Config struct {
 	// The type of azure nodes. Candidate values are: vmss and standard.
 	// If not set, it will be default to standard.
 	VMType string `json:"vmType,omitempty" yaml:"vmType,omitempty"`
+	// NodeNameResolutionMethod determines how kubernetes node names are resolved to Azure VM names.
+	// Candidate values are: nodename and providerid. If not set, it will be default to nodename,
+	// which assumes the VM name equals the node name. providerid resolves the VM name from the
+	// node's providerID first and falls back to the node name, which is required for Windows nodes
+	// whose computer names are truncated or uppercased versions of the VM names.
+	NodeNameResolutionMethod string `json:"nodeNameResolutionMethod,omitempty" yaml:"nodeNameResolutionMethod,omitempty"`
 	// The name of the scale set that should be used as the load balancer backend.
 	// If this is set, the Azure cloudprovider will only add nodes from that scale set to the load
 	// balancer backend pool. If this is not set, and multiple agent pools (scale sets) are used, then
@@ -167,16 +205,269 @@ type Config struct {
 	CloudProviderBackoffJitter float64 `json:"cloudProviderBackoffJitter,omitempty" yaml:"cloudProviderBackoffJitter,omitempty"`
 	// Use instance metadata service where possible
 	UseInstanceMetadata bool `json:"useInstanceMetadata,omitempty" yaml:"useInstanceMetadata,omitempty"`
+	// PreferIMDSNodeAddresses sources the node addresses of the local
+	// instance from the instance metadata service, including secondary
+	// interfaces, instead of ARM NIC reads. Intended for the node-side
+	// external provider deployment where every node reports its own
+	// addresses; queries for other nodes still go through ARM. Implies
+	// useInstanceMetadata.
+	PreferIMDSNodeAddresses bool `json:"preferIMDSNodeAddresses,omitempty" yaml:"preferIMDSNodeAddresses,omitempty"`
+
+	// IPv6SingleStack indicates the cluster is provisioned IPv6-only. When set,
+	// node addresses are resolved from the NIC's IPv6 ipconfigs instead of
+	// assuming an IPv4 primary ipconfig exists, and IPv4 routes are rejected.
+	IPv6SingleStack bool `json:"ipv6SingleStack,omitempty" yaml:"ipv6SingleStack,omitempty"`
+
+	// PrimaryIPConfigSubnetName selects the "provider primary" ipconfig of a NIC
+	// by its subnet name instead of the Primary flag. It is meant for environments
+	// where another agent (e.g. a CNI-managed secondary pool) marks a different
+	// ipconfig as primary.
+	PrimaryIPConfigSubnetName string `json:"primaryIPConfigSubnetName,omitempty" yaml:"primaryIPConfigSubnetName,omitempty"`
+	// PrimaryIPConfigNamePattern selects the "provider primary" ipconfig of a NIC
+	// by a regular expression matched against the ipconfig name. The subnet match
+	// of primaryIPConfigSubnetName takes precedence when both are set.
+	PrimaryIPConfigNamePattern string `json:"primaryIPConfigNamePattern,omitempty" yaml:"primaryIPConfigNamePattern,omitempty"`
+
+	// TargetedNICUpdates serializes backend pool updates per NIC and applies only
+	// the primary ipconfig's backend pool change onto a freshly read copy of the
+	// NIC right before the update. ARM only supports full-NIC PUTs, so this keeps
+	// the payload from carrying stale CNI-allocated secondary ipconfigs on NICs
+	// with hundreds of secondary IPs, where the update races with the CNI IPAM.
+	TargetedNICUpdates bool `json:"targetedNICUpdates,omitempty" yaml:"targetedNICUpdates,omitempty"`
+	// SharedVNetCoordination namespaces this cluster's security rules and routes
+	// with a cluster name hash prefix when the VNet, security group or route
+	// table is shared with other clusters, and prevents this cluster from
+	// mutating rules and routes owned by other clusters.
+	SharedVNetCoordination bool `json:"sharedVNetCoordination,omitempty" yaml:"sharedVNetCoordination,omitempty"`
+	// PublicIPRecycleGracePeriodInSeconds makes the provider tag its public IPs
+	// as released instead of deleting them right away, and garbage collect them
+	// once the grace period has expired. Released IPs are recovered when the
+	// service claims them again within the grace period. Disabled when zero.
+	PublicIPRecycleGracePeriodInSeconds int `json:"publicIPRecycleGracePeriodInSeconds,omitempty" yaml:"publicIPRecycleGracePeriodInSeconds,omitempty"`
+	// AdditionalLoadBalancerResourceGroups is a comma separated list of extra
+	// resource groups that are enumerated when listing the cluster's load
+	// balancers, in addition to the load balancer and network resource groups.
+	AdditionalLoadBalancerResourceGroups string `json:"additionalLoadBalancerResourceGroups,omitempty" yaml:"additionalLoadBalancerResourceGroups,omitempty"`
+	// AutoDisableSubnetNetworkPolicies allows the provider to disable
+	// privateLinkServiceNetworkPolicies and privateEndpointNetworkPolicies on
+	// the subnet backing an internal load balancer frontend before Azure
+	// rejects private link services placed in it. When false the provider
+	// only reports the enabled policies with an event.
+	AutoDisableSubnetNetworkPolicies bool `json:"autoDisableSubnetNetworkPolicies,omitempty" yaml:"autoDisableSubnetNetworkPolicies,omitempty"`
+	// VerifyBackendPoolMembership makes the provider re-read the backend pool
+	// with a force refresh after ensuring the hosts in it, and retry nodes
+	// whose primary IP configurations did not make it into the pool. Partial
+	// joins otherwise only surface as intermittent traffic blackholes.
+	VerifyBackendPoolMembership bool `json:"verifyBackendPoolMembership,omitempty" yaml:"verifyBackendPoolMembership,omitempty"`
+	// WriteBudgetPerMinute caps the ARM write operations the provider issues
+	// per minute. Once the budget is used up, non-urgent writes such as tag
+	// updates are deferred to a later sync period while service creation and
+	// deletion writes still proceed. Zero disables the budget.
+	WriteBudgetPerMinute int `json:"writeBudgetPerMinute,omitempty" yaml:"writeBudgetPerMinute,omitempty"`
+	// DisableEmptyLoadBalancerCleanup disables deleting provider-owned load
+	// balancers that are left without any frontend IP configurations after the
+	// last service on them is removed. By default such load balancers are
+	// deleted because they serve no traffic and count against quota.
+	DisableEmptyLoadBalancerCleanup bool `json:"disableEmptyLoadBalancerCleanup,omitempty" yaml:"disableEmptyLoadBalancerCleanup,omitempty"`
+	// DriftDetectionIntervalInMinutes enables a periodic comparison of the
+	// load balancer rules and probes of LoadBalancer services against the
+	// desired state, repairing differences introduced out-of-band such as
+	// console-edited probes. Zero disables drift detection.
+	DriftDetectionIntervalInMinutes int `json:"driftDetectionIntervalInMinutes,omitempty" yaml:"driftDetectionIntervalInMinutes,omitempty"`
+	// DriftDetectionAuditOnly makes the drift detector only report drift
+	// through events and logs instead of repairing it.
+	DriftDetectionAuditOnly bool `json:"driftDetectionAuditOnly,omitempty" yaml:"driftDetectionAuditOnly,omitempty"`
+	// ARMOutageErrorThreshold is the number of ARM errors from instance
+	// existence checks within a one-minute window after which the provider
+	// assumes an ARM outage and reports existence as unknown instead of
+	// not-found, so the node lifecycle controller does not delete healthy
+	// nodes. Zero disables the outage breaker.
+	ARMOutageErrorThreshold int `json:"armOutageErrorThreshold,omitempty" yaml:"armOutageErrorThreshold,omitempty"`
+	// ARMOutageCooldownInMinutes is how long existence checks stay in the
+	// unknown state once the outage breaker has opened. Defaults to 5.
+	ARMOutageCooldownInMinutes int `json:"armOutageCooldownInMinutes,omitempty" yaml:"armOutageCooldownInMinutes,omitempty"`
+	// ForceCacheSafeReads is a comma-separated list of provider cache names
+	// (as reported by the cache introspection handler and metrics) whose
+	// unsafe reads are upgraded to default reads, or "*" for all caches.
+	// Unsafe reads may serve arbitrarily stale entries; forcing safe reads on
+	// a path trades extra ARM calls for fresher data.
+	ForceCacheSafeReads string `json:"forceCacheSafeReads,omitempty" yaml:"forceCacheSafeReads,omitempty"`
+	// VMPowerStateFallback is the power state reported for a VM whose
+	// InstanceView carries no power state and whose provisioning state does
+	// not show it as deleting. The default "stopped" keeps the historical
+	// assumption; "unknown" returns an error instead so that callers retry
+	// rather than treating a node hit by transient API degradation as shut
+	// down.
+	VMPowerStateFallback string `json:"vmPowerStateFallback,omitempty" yaml:"vmPowerStateFallback,omitempty"`
+	// UserAgentSuffix is an operator-provided string appended to the
+	// User-Agent of every ARM request, typically a cluster identifier, so
+	// that Azure-side throttling diagnostics can attribute the traffic to
+	// the cluster generating it.
+	UserAgentSuffix string `json:"userAgentSuffix,omitempty" yaml:"userAgentSuffix,omitempty"`
+	// ChangePollingIntervalInMinutes enables a periodic delta query over the
+	// load balancers, security groups and network interfaces of the cluster
+	// resource groups. Cache entries of resources whose etags moved since the
+	// previous poll are invalidated, shrinking the window where the provider
+	// reconciles against stale views after out-of-band edits. Zero disables
+	// the poller.
+	ChangePollingIntervalInMinutes int `json:"changePollingIntervalInMinutes,omitempty" yaml:"changePollingIntervalInMinutes,omitempty"`
+	// SharedRuleGCIntervalInMinutes enables periodic garbage collection of
+	// shared security rules: destinations whose owning LoadBalancer service
+	// no longer exists are removed, and shared rules left without any
+	// destination are deleted. Zero disables the collector.
+	SharedRuleGCIntervalInMinutes int `json:"sharedRuleGCIntervalInMinutes,omitempty" yaml:"sharedRuleGCIntervalInMinutes,omitempty"`
+	// ManagedExternalResourceGroups is an allow-list of external resource
+	// groups whose nodes are treated as managed by the provider. Nodes
+	// labeled with one of these resource groups join load balancer backend
+	// pools like nodes of the cluster resource group, so node pools
+	// provisioned out of band (e.g. by Terraform) can serve LoadBalancer
+	// services. Nodes in external resource groups not listed here keep being
+	// excluded.
+	ManagedExternalResourceGroups []string `json:"managedExternalResourceGroups,omitempty" yaml:"managedExternalResourceGroups,omitempty"`
+	// PublicIPResourceGroup is the resource group where provider-created
+	// public IPs are placed, for governance models separating network
+	// objects from compute. Existing public IPs in the cluster resource
+	// group keep being found and managed there during migration. Empty keeps
+	// creating public IPs in the cluster resource group.
+	PublicIPResourceGroup string `json:"publicIPResourceGroup,omitempty" yaml:"publicIPResourceGroup,omitempty"`
+	// EnableLoadBalancerMetricsCollection enables periodic collection of the
+	// Azure Monitor platform metrics (data path availability, health probe
+	// status, SNAT port usage) of the cluster load balancers, republished as
+	// Prometheus metrics labeled by the owning service. Disabled by default.
+	EnableLoadBalancerMetricsCollection bool `json:"enableLoadBalancerMetricsCollection,omitempty" yaml:"enableLoadBalancerMetricsCollection,omitempty"`
+	// EnableCacheWarmup warms the VM and load balancer caches with paced
+	// calls at controller startup and gates load balancer reconciles until
+	// the warm-up completes or times out, so a restart in a large cluster
+	// does not open with an ARM throttling storm.
+	EnableCacheWarmup bool `json:"enableCacheWarmup,omitempty" yaml:"enableCacheWarmup,omitempty"`
+	// EnableNSGFlowLogs enables flow logging on the cluster NSG through the
+	// regional network watcher, so that flow data for provider-managed rules
+	// is collected without manual setup. Requires
+	// NSGFlowLogStorageAccountID. Disabled by default.
+	EnableNSGFlowLogs bool `json:"enableNSGFlowLogs,omitempty" yaml:"enableNSGFlowLogs,omitempty"`
+	// NSGFlowLogStorageAccountID is the full resource ID of the storage
+	// account the flow logs are written to.
+	NSGFlowLogStorageAccountID string `json:"nsgFlowLogStorageAccountID,omitempty" yaml:"nsgFlowLogStorageAccountID,omitempty"`
+	// NSGFlowLogRetentionDays is the flow log retention in days. Defaults to
+	// 30 when not set.
+	NSGFlowLogRetentionDays int `json:"nsgFlowLogRetentionDays,omitempty" yaml:"nsgFlowLogRetentionDays,omitempty"`
+	// NSGFlowLogTrafficAnalyticsWorkspaceResourceID optionally attaches a Log
+	// Analytics workspace for traffic analytics.
+	NSGFlowLogTrafficAnalyticsWorkspaceResourceID string `json:"nsgFlowLogTrafficAnalyticsWorkspaceResourceID,omitempty" yaml:"nsgFlowLogTrafficAnalyticsWorkspaceResourceID,omitempty"`
+	// NSGFlowLogNetworkWatcherResourceGroup and NSGFlowLogNetworkWatcherName
+	// override the network watcher used to configure the flow logs. They
+	// default to the names Azure uses when auto-provisioning the regional
+	// watchers (NetworkWatcherRG/NetworkWatcher_<location>).
+	NSGFlowLogNetworkWatcherResourceGroup string `json:"nsgFlowLogNetworkWatcherResourceGroup,omitempty" yaml:"nsgFlowLogNetworkWatcherResourceGroup,omitempty"`
+	NSGFlowLogNetworkWatcherName          string `json:"nsgFlowLogNetworkWatcherName,omitempty" yaml:"nsgFlowLogNetworkWatcherName,omitempty"`
+
+	// DisableLoadBalancerManagement turns the service load balancer subsystem
+	// off entirely, for clusters where an external controller manages load
+	// balancers. Instances, zones and routes keep working, so no providerless
+	// build or code fork is needed.
+	DisableLoadBalancerManagement bool `json:"disableLoadBalancerManagement,omitempty" yaml:"disableLoadBalancerManagement,omitempty"`
+	// DisableRouteManagement turns the node route subsystem off entirely, for
+	// clusters using an overlay CNI that does not need provider routes.
+	DisableRouteManagement bool `json:"disableRouteManagement,omitempty" yaml:"disableRouteManagement,omitempty"`
+	// ReadOnly freezes all cloud-side changes for break-glass operations:
+	// every write path returns a "provider in read-only mode" error and
+	// records an event, while instances, zones and status reads keep working.
+	ReadOnly bool `json:"readOnly,omitempty" yaml:"readOnly,omitempty"`
+
+	// LoadBalancerClassName is the load balancer class this provider claims.
+	// Services without a class are always handled; services with a different
+	// class are ignored so an alternative load balancer controller can own
+	// them. Empty by default.
+	LoadBalancerClassName string `json:"loadBalancerClassName,omitempty" yaml:"loadBalancerClassName,omitempty"`
+
+	// LoadBalancerBackendPoolName overrides the base name of the load
+	// balancer backend address pools, which defaults to the cluster name
+	// (with an -IPv6 suffix for IPv6 services). Memberships found in the
+	// default-named pool are migrated to the configured pool without dropping
+	// traffic, which is needed when integrating pre-existing load balancers.
+	LoadBalancerBackendPoolName string `json:"loadBalancerBackendPoolName,omitempty" yaml:"loadBalancerBackendPoolName,omitempty"`
 
 	// Sku of Load Balancer and Public IP. Candidate values are: basic and standard.
 	// If not set, it will be default to basic.
 	LoadBalancerSku string `json:"loadBalancerSku,omitempty" yaml:"loadBalancerSku,omitempty"`
+	// LoadBalancerBackendPoolConfigurationType selects how the load balancer
+	// backend pools are populated. Candidate values are: nodeIPConfiguration
+	// (NIC references, the default), nodeIP (node IP addresses written in a
+	// single pool update instead of per-NIC updates) and podIP (membership
+	// left to an external controller).
+	LoadBalancerBackendPoolConfigurationType string `json:"loadBalancerBackendPoolConfigurationType,omitempty" yaml:"loadBalancerBackendPoolConfigurationType,omitempty"`
+	// MultipleStandardLoadBalancerConfigurations spreads the services and
+	// node pools of the cluster over several Standard Load Balancers instead
+	// of the single cluster load balancer, to work around the per-load-balancer
+	// rule limits. It requires "standard" LoadBalancerSku.
+	MultipleStandardLoadBalancerConfigurations []MultipleStandardLoadBalancerConfiguration `json:"multipleStandardLoadBalancerConfigurations,omitempty" yaml:"multipleStandardLoadBalancerConfigurations,omitempty"`
+	// DefaultServiceAnnotations is merged under the annotations of every
+	// LoadBalancer service before reconciliation, so cluster-wide defaults
+	// (internal load balancers, a default subnet, idle timeouts, ...) don't
+	// have to be repeated on each service or enforced by webhooks.
+	// Annotations set explicitly on a service always win. Only
+	// "service.beta.kubernetes.io/azure-" annotations may be defaulted.
+	DefaultServiceAnnotations map[string]string `json:"defaultServiceAnnotations,omitempty" yaml:"defaultServiceAnnotations,omitempty"`
 	// ExcludeMasterFromStandardLB excludes master nodes from standard load balancer.
 	// If not set, it will be default to true.
 	ExcludeMasterFromStandardLB *bool `json:"excludeMasterFromStandardLB,omitempty" yaml:"excludeMasterFromStandardLB,omitempty"`
+	// ExcludeMasterFromExternalLB, ExcludeMasterFromInternalLB and
+	// ExcludeMasterFromOutboundPool refine ExcludeMasterFromStandardLB per
+	// backend pool kind, for topologies that intentionally serve traffic from
+	// control-plane nodes (e.g. the API server behind an internal load
+	// balancer). Each knob inherits ExcludeMasterFromStandardLB when not set.
+	ExcludeMasterFromExternalLB   *bool `json:"excludeMasterFromExternalLB,omitempty" yaml:"excludeMasterFromExternalLB,omitempty"`
+	ExcludeMasterFromInternalLB   *bool `json:"excludeMasterFromInternalLB,omitempty" yaml:"excludeMasterFromInternalLB,omitempty"`
+	ExcludeMasterFromOutboundPool *bool `json:"excludeMasterFromOutboundPool,omitempty" yaml:"excludeMasterFromOutboundPool,omitempty"`
 	// DisableOutboundSNAT disables the outbound SNAT for public load balancer rules.
 	// It should only be set when loadBalancerSku is standard. If not set, it will be default to false.
 	DisableOutboundSNAT *bool `json:"disableOutboundSNAT,omitempty" yaml:"disableOutboundSNAT,omitempty"`
+	// ManagedOutboundIPCount is the number of provider-managed outbound
+	// public IPs attached to the external cluster load balancer through an
+	// outbound rule, so egress SNAT capacity can be scaled explicitly. It
+	// should only be set when loadBalancerSku is standard. When zero and no
+	// outbound public IP prefix is set, outbound rules are not managed.
+	ManagedOutboundIPCount int `json:"managedOutboundIPCount,omitempty" yaml:"managedOutboundIPCount,omitempty"`
+	// OutboundPublicIPPrefixID is the full resource ID of an existing public
+	// IP prefix to attach to the outbound rule, instead of counted managed
+	// outbound public IPs. Mutually exclusive with managedOutboundIPCount.
+	OutboundPublicIPPrefixID string `json:"outboundPublicIPPrefixID,omitempty" yaml:"outboundPublicIPPrefixID,omitempty"`
+	// OutboundAllocatedPorts is the number of SNAT ports allocated to each VM
+	// in the backend pool, a multiple of 8. Zero lets Azure scale the
+	// allocation with the pool size.
+	OutboundAllocatedPorts int `json:"outboundAllocatedPorts,omitempty" yaml:"outboundAllocatedPorts,omitempty"`
+	// OutboundIdleTimeoutInMinutes is the idle timeout of outbound flows,
+	// between 4 and 120 minutes. Zero keeps the Azure default.
+	OutboundIdleTimeoutInMinutes int `json:"outboundIdleTimeoutInMinutes,omitempty" yaml:"outboundIdleTimeoutInMinutes,omitempty"`
+	// OutboundType declares how egress traffic of the cluster nodes leaves
+	// the virtual network, one of loadBalancer (default), natGateway or
+	// userDefinedRouting. The latter two require the standard load balancer
+	// SKU and make the provider leave egress entirely to the external setup.
+	OutboundType string `json:"outboundType,omitempty" yaml:"outboundType,omitempty"`
+
+	// PublicIPAddressPoolName names a pool of pre-created public IPs (e.g.
+	// standard zone-redundant IPs or IPs allocated from an approved prefix)
+	// that new LoadBalancer services are assigned from before falling back
+	// to on-demand creation. Pool members carry the k8s-azure-pip-pool tag
+	// with this value and are returned to the pool instead of being deleted.
+	PublicIPAddressPoolName string `json:"publicIPAddressPoolName,omitempty" yaml:"publicIPAddressPoolName,omitempty"`
+
+	// PublicIPIPTags are the default Azure IP tags applied to public IPs
+	// created by the provider, as a comma separated list of <type>=<value>
+	// pairs (e.g. "RoutingPreference=Internet"). Services can override them
+	// with the ip tags annotation.
+	PublicIPIPTags string `json:"publicIPIPTags,omitempty" yaml:"publicIPIPTags,omitempty"`
+
+	// LoadBalancerHealthProbeInterval is the default interval in seconds
+	// between health probes of generated load balancer probes, between 5 and
+	// 2147483646. Zero keeps the Azure default of 5. Services can override
+	// it with the health probe interval annotation.
+	LoadBalancerHealthProbeInterval int32 `json:"loadBalancerHealthProbeInterval,omitempty" yaml:"loadBalancerHealthProbeInterval,omitempty"`
+	// LoadBalancerHealthProbeNumOfProbe is the default number of probe
+	// failures after which a backend leaves the rotation, between 1 and 20.
+	// Zero keeps the Azure default of 2. Services can override it with the
+	// health probe numOfProbe annotation.
+	LoadBalancerHealthProbeNumOfProbe int32 `json:"loadBalancerHealthProbeNumOfProbe,omitempty" yaml:"loadBalancerHealthProbeNumOfProbe,omitempty"`
 
 	// Maximum allowed LoadBalancer Rule Count is the limit enforced by Azure Load balancer
 	MaximumLoadBalancerRuleCount int `json:"maximumLoadBalancerRuleCount,omitempty" yaml:"maximumLoadBalancerRuleCount,omitempty"`
@@ -197,6 +488,13 @@ type Config struct {
 	//   "external": for external LoadBalancer
 	//   "all": for both internal and external LoadBalancer
 	PreConfiguredBackendPoolLoadBalancerTypes string `json:"preConfiguredBackendPoolLoadBalancerTypes,omitempty" yaml:"preConfiguredBackendPoolLoadBalancerTypes,omitempty"`
+	// EnablePerVMSSBackendPools creates one dedicated backend pool per scale
+	// set next to the cluster backend pool and joins every scale set model to
+	// its own pool, so per-pool membership updates never touch unrelated
+	// scale sets. Load balancing rules keep referencing the cluster pool
+	// because this network API version only supports a single pool per rule.
+	// It requires vmType vmss and loadBalancerSku standard.
+	EnablePerVMSSBackendPools bool `json:"enablePerVMSSBackendPools,omitempty" yaml:"enablePerVMSSBackendPools,omitempty"`
 
 	// AvailabilitySetNodesCacheTTLInSeconds sets the Cache TTL for availabilitySetNodesCache
 	// if not set, will use default value
@@ -211,11 +509,34 @@ type Config struct {
 	LoadBalancerCacheTTLInSeconds int `json:"loadBalancerCacheTTLInSeconds,omitempty" yaml:"loadBalancerCacheTTLInSeconds,omitempty"`
 	// NsgCacheTTLInSeconds sets the cache TTL for network security group
 	NsgCacheTTLInSeconds int `json:"nsgCacheTTLInSeconds,omitempty" yaml:"nsgCacheTTLInSeconds,omitempty"`
+	// ResourceGroupLockCooldownInSeconds sets how long writes against a resource
+	// group are skipped after a ReadOnly/CanNotDelete management lock has been
+	// detected on it. Read paths keep functioning during the cooldown.
+	// If not set, will use default value
+	ResourceGroupLockCooldownInSeconds int `json:"resourceGroupLockCooldownInSeconds,omitempty" yaml:"resourceGroupLockCooldownInSeconds,omitempty"`
 	// RouteTableCacheTTLInSeconds sets the cache TTL for route table
 	RouteTableCacheTTLInSeconds int `json:"routeTableCacheTTLInSeconds,omitempty" yaml:"routeTableCacheTTLInSeconds,omitempty"`
+	// RouteUpdateIntervalInSeconds sets the aggregation window of the delayed
+	// route updater: route additions and deletions arriving within the window
+	// are coalesced into a single route table update. Defaults to 30 seconds.
+	RouteUpdateIntervalInSeconds int `json:"routeUpdateIntervalInSeconds,omitempty" yaml:"routeUpdateIntervalInSeconds,omitempty"`
 
 	// DisableAvailabilitySetNodes disables VMAS nodes support when "VMType" is set to "vmss".
 	DisableAvailabilitySetNodes bool `json:"disableAvailabilitySetNodes,omitempty" yaml:"disableAvailabilitySetNodes,omitempty"`
+
+	// BackendPoolReadinessWindowInSeconds holds newly registered nodes out
+	// of the load balancer backend pools until they have been Ready for at
+	// least this long, reducing 502s while kube-proxy and the CNI are still
+	// being programmed. The "kubernetes.azure.com/load-balancer-pool-join-ready"
+	// node annotation overrides the window in both directions. 0 disables
+	// the readiness window.
+	BackendPoolReadinessWindowInSeconds int `json:"backendPoolReadinessWindowInSeconds,omitempty" yaml:"backendPoolReadinessWindowInSeconds,omitempty"`
+
+	// EnableVmssBatchInstanceUpdate applies backend pool changes to VMSS
+	// instances with the batch update API instead of one update call per
+	// instance. The backend pool is added to the scale set model first and
+	// the instances are then upgraded to the latest model in batches.
+	EnableVmssBatchInstanceUpdate bool `json:"enableVmssBatchInstanceUpdate,omitempty" yaml:"enableVmssBatchInstanceUpdate,omitempty"`
 }
 
 var _ cloudprovider.Interface = (*Cloud)(nil)
@@ -245,6 +566,8 @@ type Cloud struct {
 	VirtualMachineScaleSetsClient   vmssclient.Interface
 	VirtualMachineScaleSetVMsClient vmssvmclient.Interface
 	VirtualMachineSizesClient       vmsizeclient.Interface
+	MonitorClient                   monitorclient.Interface
+	NetworkWatcherClient            networkwatcherclient.Interface
 
 	ResourceRequestBackoff wait.Backoff
 	metadata               *InstanceMetadataService
@@ -252,18 +575,64 @@ type Cloud struct {
 
 	// ipv6DualStack allows overriding for unit testing.  It's normally initialized from featuregates
 	ipv6DualStackEnabled bool
-	// Lock for access to node caches, includes nodeZones, nodeResourceGroups, and unmanagedNodes.
+	// featureGates holds the evaluated feature gates injected by the
+	// consuming binary, see SetFeatureGates.
+	featureGates FeatureGates
+	// Lock for access to node caches, includes nodeZones, nodeResourceGroups, nodeVMNames and unmanagedNodes.
 	nodeCachesLock sync.RWMutex
 	// nodeZones is a mapping from Zone to a sets.String of Node's names in the Zone
 	// it is updated by the nodeInformer
 	nodeZones map[string]sets.String
 	// nodeResourceGroups holds nodes external resource groups
 	nodeResourceGroups map[string]string
+	// nodeVMNames holds a mapping from node names to Azure VM names extracted
+	// from the nodes' providerIDs. It is only used when nodeNameResolutionMethod
+	// is set to providerid.
+	nodeVMNames map[string]string
 	// unmanagedNodes holds a list of nodes not managed by Azure cloud provider.
 	unmanagedNodes sets.String
 	// nodeInformerSynced is for determining if the informer has synced.
 	nodeInformerSynced cache.InformerSynced
 
+	// primaryIPConfigNameRE is compiled from PrimaryIPConfigNamePattern at
+	// initialization time.
+	primaryIPConfigNameRE *regexp.Regexp
+
+	// nicUpdateLock serializes backend pool updates per NIC when
+	// TargetedNICUpdates is enabled.
+	nicUpdateLock *lockMap
+
+	// lockedScopesLock protects lockedScopes.
+	lockedScopesLock sync.Mutex
+	// lockedScopes maps resource group names to the time until which writes are
+	// skipped because a management lock has been detected on the scope.
+	lockedScopes map[string]time.Time
+
+	// writeBudget caps the ARM write operations issued per minute when
+	// WriteBudgetPerMinute is configured.
+	writeBudget *writeBudget
+
+	// armErrorRecorder retains the most recent failed ARM requests for
+	// support bundles. Its zero value is ready to use.
+	armErrorRecorder armErrorRecorder
+
+	// outageBreaker keeps instance existence checks from reporting not-found
+	// while ARM returns widespread errors.
+	outageBreaker *armOutageBreaker
+
+	// driftDetectionLock protects driftClusterName.
+	driftDetectionLock sync.Mutex
+	// driftClusterName is the cluster name observed on load balancer calls,
+	// used by the drift detector to render the desired state.
+	driftClusterName string
+
+	// changePollLock protects changePollEtags, the per-kind etag snapshots
+	// of the change poller.
+	changePollLock sync.Mutex
+	// changePollEtags maps resource kind to the resource ID -> etag snapshot
+	// taken by the previous change poll.
+	changePollEtags map[string]map[string]string
+
 	// routeCIDRsLock holds lock for routeCIDRs cache.
 	routeCIDRsLock sync.Mutex
 	// routeCIDRs holds cache for route CIDRs.
@@ -273,11 +642,26 @@ type Cloud struct {
 	eventBroadcaster record.EventBroadcaster
 	eventRecorder    record.EventRecorder
 	routeUpdater     *delayedRouteUpdater
+	tagsUpdater      *delayedTagsUpdater
+	nsgUpdater       *delayedNsgUpdater
+	cacheWarmer      *cacheWarmer
+
+	// resourceNamer and ownershipResolver optionally replace the built-in
+	// naming of service resources and the ownership checks on existing ones,
+	// see SetResourceNamer and SetOwnershipResolver.
+	resourceNamer     ResourceNamer
+	ownershipResolver OwnershipResolver
 
-	vmCache  *azcache.TimedCache
-	lbCache  *azcache.TimedCache
-	nsgCache *azcache.TimedCache
-	rtCache  *azcache.TimedCache
+	// servicePrincipalToken is kept for the credential health check.
+	servicePrincipalToken *adal.ServicePrincipalToken
+
+	vmCache     *azcache.TimedCache
+	lbCache     *azcache.TimedCache
+	lbListCache *azcache.TimedCache
+	nsgCache    *azcache.TimedCache
+	rtCache     *azcache.TimedCache
+
+	skuCapabilityCache *azcache.TimedCache
 
 	*BlobDiskController
 	*ManagedDiskController
@@ -308,7 +692,7 @@ func NewCloud(configReader io.Reader) (cloudprovider.Interface, error) {
 	if err != nil {
 		return nil, err
 	}
-	az.ipv6DualStackEnabled = utilfeature.DefaultFeatureGate.Enabled(IPv6DualStack)
+	az.SetFeatureGates(utilfeature.DefaultFeatureGate)
 
 	return az, nil
 }
@@ -324,8 +708,11 @@ func NewCloudWithoutFeatureGates(configReader io.Reader) (*Cloud, error) {
 	az := &Cloud{
 		nodeZones:          map[string]sets.String{},
 		nodeResourceGroups: map[string]string{},
+		nodeVMNames:        map[string]string{},
 		unmanagedNodes:     sets.NewString(),
 		routeCIDRs:         map[string]string{},
+		nicUpdateLock:      newLockMap(),
+		lockedScopes:       map[string]time.Time{},
 	}
 
 	err = az.InitializeCloudFromConfig(config, false)
@@ -352,6 +739,10 @@ func (az *Cloud) InitializeCloudFromConfig(config *Config, fromSecret bool) erro
 		config.SecurityGroupResourceGroup = config.ResourceGroup
 	}
 
+	if err := validateConfigEnums(config); err != nil {
+		return err
+	}
+
 	if config.VMType == "" {
 		// default to standard vmType if not set.
 		config.VMType = vmTypeStandard
@@ -361,6 +752,18 @@ func (az *Cloud) InitializeCloudFromConfig(config *Config, fromSecret bool) erro
 		return fmt.Errorf("disableAvailabilitySetNodes %v is only supported when vmType is 'vmss'", config.DisableAvailabilitySetNodes)
 	}
 
+	if config.NodeNameResolutionMethod == "" {
+		// default to nodename resolution if not set.
+		config.NodeNameResolutionMethod = nodeNameResolutionMethodNodeName
+	} else {
+		supportedNodeNameResolutionMethods := sets.NewString(
+			nodeNameResolutionMethodNodeName,
+			nodeNameResolutionMethodProviderID)
+		if !supportedNodeNameResolutionMethods.Has(strings.ToLower(config.NodeNameResolutionMethod)) {
+			return fmt.Errorf("nodeNameResolutionMethod %v is not supported, supported values are %v", config.NodeNameResolutionMethod, supportedNodeNameResolutionMethods.List())
+		}
+	}
+
 	if config.CloudConfigType == "" {
 		// The default cloud config type is cloudConfigTypeMerge.
 		config.CloudConfigType = cloudConfigTypeMerge
@@ -374,6 +777,18 @@ func (az *Cloud) InitializeCloudFromConfig(config *Config, fromSecret bool) erro
 		}
 	}
 
+	if config.ResourceGroupLockCooldownInSeconds == 0 {
+		config.ResourceGroupLockCooldownInSeconds = lockCooldownDefaultInSeconds
+	}
+
+	if config.PrimaryIPConfigNamePattern != "" {
+		primaryIPConfigNameRE, err := regexp.Compile(config.PrimaryIPConfigNamePattern)
+		if err != nil {
+			return fmt.Errorf("primaryIPConfigNamePattern %q is invalid: %v", config.PrimaryIPConfigNamePattern, err)
+		}
+		az.primaryIPConfigNameRE = primaryIPConfigNameRE
+	}
+
 	env, err := auth.ParseAzureEnvironment(config.Cloud, config.ResourceManagerEndpoint, config.IdentitySystem)
 	if err != nil {
 		return err
@@ -454,11 +869,88 @@ func (az *Cloud) InitializeCloudFromConfig(config *Config, fromSecret bool) erro
 		if config.DisableOutboundSNAT != nil && *config.DisableOutboundSNAT {
 			return fmt.Errorf("disableOutboundSNAT should only set when loadBalancerSku is standard")
 		}
+		if config.ManagedOutboundIPCount != 0 || config.OutboundPublicIPPrefixID != "" {
+			return fmt.Errorf("outbound rule management should only be set when loadBalancerSku is standard")
+		}
+	}
+
+	if config.ManagedOutboundIPCount < 0 {
+		return fmt.Errorf("managedOutboundIPCount %d should not be negative", config.ManagedOutboundIPCount)
+	}
+	if config.ManagedOutboundIPCount > 0 && config.OutboundPublicIPPrefixID != "" {
+		return fmt.Errorf("managedOutboundIPCount and outboundPublicIPPrefixID are mutually exclusive")
+	}
+	if config.OutboundAllocatedPorts != 0 &&
+		(config.OutboundAllocatedPorts < 0 || config.OutboundAllocatedPorts > 64000 || config.OutboundAllocatedPorts%8 != 0) {
+		return fmt.Errorf("outboundAllocatedPorts %d should be a multiple of 8 between 0 and 64000", config.OutboundAllocatedPorts)
+	}
+	if config.OutboundIdleTimeoutInMinutes != 0 &&
+		(config.OutboundIdleTimeoutInMinutes < 4 || config.OutboundIdleTimeoutInMinutes > 120) {
+		return fmt.Errorf("outboundIdleTimeoutInMinutes %d should be between 4 and 120", config.OutboundIdleTimeoutInMinutes)
+	}
+
+	if config.LoadBalancerHealthProbeInterval != 0 &&
+		(config.LoadBalancerHealthProbeInterval < 5 || config.LoadBalancerHealthProbeInterval > 2147483646) {
+		return fmt.Errorf("loadBalancerHealthProbeInterval %d should be between 5 and 2147483646", config.LoadBalancerHealthProbeInterval)
+	}
+	if config.LoadBalancerHealthProbeNumOfProbe != 0 &&
+		(config.LoadBalancerHealthProbeNumOfProbe < 1 || config.LoadBalancerHealthProbeNumOfProbe > 20) {
+		return fmt.Errorf("loadBalancerHealthProbeNumOfProbe %d should be between 1 and 20", config.LoadBalancerHealthProbeNumOfProbe)
+	}
+	if config.PublicIPIPTags != "" {
+		if _, err := parseIPTags(config.PublicIPIPTags); err != nil {
+			return fmt.Errorf("publicIPIPTags: %v", err)
+		}
+	}
+
+	if config.EnablePerVMSSBackendPools &&
+		(!strings.EqualFold(config.VMType, vmTypeVMSS) || !strings.EqualFold(config.LoadBalancerSku, loadBalancerSkuStandard)) {
+		return fmt.Errorf("enablePerVMSSBackendPools requires vmType vmss and loadBalancerSku standard")
+	}
+
+	if config.LoadBalancerBackendPoolConfigurationType != "" &&
+		!strings.EqualFold(config.LoadBalancerBackendPoolConfigurationType, loadBalancerBackendPoolConfigurationTypeNodeIPConfiguration) &&
+		!strings.EqualFold(config.LoadBalancerBackendPoolConfigurationType, loadBalancerBackendPoolConfigurationTypeNodeIP) &&
+		!strings.EqualFold(config.LoadBalancerBackendPoolConfigurationType, loadBalancerBackendPoolConfigurationTypePodIP) {
+		return fmt.Errorf("loadBalancerBackendPoolConfigurationType %s is not supported, supported values are [%s %s %s]",
+			config.LoadBalancerBackendPoolConfigurationType,
+			loadBalancerBackendPoolConfigurationTypeNodeIPConfiguration,
+			loadBalancerBackendPoolConfigurationTypeNodeIP,
+			loadBalancerBackendPoolConfigurationTypePodIP)
+	}
+
+	if len(config.MultipleStandardLoadBalancerConfigurations) > 0 {
+		if !strings.EqualFold(config.LoadBalancerSku, loadBalancerSkuStandard) {
+			return fmt.Errorf("multipleStandardLoadBalancerConfigurations should only be set when loadBalancerSku is standard")
+		}
+		names := make(map[string]bool, len(config.MultipleStandardLoadBalancerConfigurations))
+		for _, multiSLBConfig := range config.MultipleStandardLoadBalancerConfigurations {
+			if multiSLBConfig.Name == "" {
+				return fmt.Errorf("multipleStandardLoadBalancerConfigurations should not contain an empty name")
+			}
+			if names[strings.ToLower(multiSLBConfig.Name)] {
+				return fmt.Errorf("multipleStandardLoadBalancerConfigurations contains duplicated name %s", multiSLBConfig.Name)
+			}
+			names[strings.ToLower(multiSLBConfig.Name)] = true
+		}
+	}
+
+	for key := range config.DefaultServiceAnnotations {
+		if !strings.HasPrefix(key, azureServiceAnnotationPrefix) {
+			return fmt.Errorf("defaultServiceAnnotations contains key %s without the %s prefix", key, azureServiceAnnotationPrefix)
+		}
 	}
 
 	az.Config = *config
 	az.Environment = *env
 	az.ResourceRequestBackoff = resourceRequestBackoff
+	az.writeBudget = newWriteBudget(config.WriteBudgetPerMinute)
+	outageCooldown := time.Duration(config.ARMOutageCooldownInMinutes) * time.Minute
+	if outageCooldown == 0 {
+		outageCooldown = 5 * time.Minute
+	}
+	az.outageBreaker = newARMOutageBreaker(config.ARMOutageErrorThreshold, outageCooldown)
+	azcache.SetForcedSafeReads(strings.Split(config.ForceCacheSafeReads, ","))
 	az.metadata, err = NewInstanceMetadataService(imdsServer)
 	if err != nil {
 		return err
@@ -509,6 +1001,11 @@ func (az *Cloud) InitializeCloudFromConfig(config *Config, fromSecret bool) erro
 		return err
 	}
 
+	az.lbListCache, err = az.newLBListCache()
+	if err != nil {
+		return err
+	}
+
 	az.nsgCache, err = az.newNSGCache()
 	if err != nil {
 		return err
@@ -519,13 +1016,55 @@ func (az *Cloud) InitializeCloudFromConfig(config *Config, fromSecret bool) erro
 		return err
 	}
 
+	az.skuCapabilityCache, err = az.newSkuCapabilityCache()
+	if err != nil {
+		return err
+	}
+
 	if err := initDiskControllers(az); err != nil {
 		return err
 	}
 
 	// start delayed route updater.
-	az.routeUpdater = newDelayedRouteUpdater(az, routeUpdateInterval)
-	go az.routeUpdater.run()
+	updateInterval := routeUpdateInterval
+	if az.RouteUpdateIntervalInSeconds > 0 {
+		updateInterval = time.Duration(az.RouteUpdateIntervalInSeconds) * time.Second
+	}
+	az.routeUpdater = newDelayedRouteUpdater(az, updateInterval)
+	if !az.DisableRouteManagement {
+		go az.routeUpdater.run()
+	}
+
+	// start delayed tags updater.
+	az.tagsUpdater = newDelayedTagsUpdater(az, tagsUpdateInterval)
+	go az.tagsUpdater.run()
+
+	// start delayed security group updater.
+	az.nsgUpdater = newDelayedNsgUpdater(az, nsgUpdateInterval)
+	go az.nsgUpdater.run()
+
+	// warm the caches before the service controller floods reconciles.
+	if az.EnableCacheWarmup {
+		az.cacheWarmer = newCacheWarmer(az)
+		go az.cacheWarmer.run()
+	}
+
+	// start the load balancer metrics collector.
+	if az.EnableLoadBalancerMetricsCollection {
+		go az.newLBMetricsCollector(lbMetricsCollectionInterval).run()
+	}
+
+	// configure NSG flow logs.
+	if az.EnableNSGFlowLogs {
+		if az.NSGFlowLogStorageAccountID == "" {
+			return fmt.Errorf("nsgFlowLogStorageAccountID must be set when enableNSGFlowLogs is true")
+		}
+		go func() {
+			if err := az.ensureNSGFlowLogs(); err != nil {
+				klog.Errorf("Failed to configure the NSG flow logs: %v", err)
+			}
+		}()
+	}
 
 	return nil
 }
@@ -534,6 +1073,7 @@ func (az *Cloud) configAzureClients(
 	servicePrincipalToken *adal.ServicePrincipalToken,
 	multiTenantServicePrincipalToken *adal.MultiTenantServicePrincipalToken,
 	networkResourceServicePrincipalToken *adal.ServicePrincipalToken) {
+	az.servicePrincipalToken = servicePrincipalToken
 	azClientConfig := az.getAzureClientConfig(servicePrincipalToken)
 
 	// Prepare AzureClientConfig for all azure clients
@@ -556,6 +1096,8 @@ func (az *Cloud) configAzureClients(
 	publicIPClientConfig := azClientConfig.WithRateLimiter(az.Config.PublicIPAddressRateLimit)
 	// TODO(ZeroMagic): add azurefileRateLimit
 	fileClientConfig := azClientConfig.WithRateLimiter(nil)
+	monitorClientConfig := azClientConfig.WithRateLimiter(nil)
+	networkWatcherClientConfig := azClientConfig.WithRateLimiter(nil)
 
 	// If uses network resources in different AAD Tenant, update Authorizer for VM/VMSS client config
 	if multiTenantServicePrincipalToken != nil {
@@ -586,6 +1128,8 @@ func (az *Cloud) configAzureClients(
 	// Initialize all azure clients based on client config
 	az.InterfacesClient = interfaceclient.New(interfaceClientConfig)
 	az.VirtualMachineSizesClient = vmsizeclient.New(vmSizeClientConfig)
+	az.MonitorClient = monitorclient.New(monitorClientConfig)
+	az.NetworkWatcherClient = networkwatcherclient.New(networkWatcherClientConfig)
 	az.SnapshotsClient = snapshotclient.New(snapshotClientConfig)
 	az.StorageAccountClient = storageaccountclient.New(storageAccountClientConfig)
 	az.DisksClient = diskclient.New(diskClientConfig)
@@ -608,6 +1152,7 @@ func (az *Cloud) getAzureClientConfig(servicePrincipalToken *adal.ServicePrincip
 		ResourceManagerEndpoint: az.Environment.ResourceManagerEndpoint,
 		Authorizer:              autorest.NewBearerAuthorizer(servicePrincipalToken),
 		Backoff:                 &retry.Backoff{Steps: 1},
+		UserAgent:               az.getClientUserAgent(),
 	}
 
 	if az.Config.CloudProviderBackoff {
@@ -622,6 +1167,21 @@ func (az *Cloud) getAzureClientConfig(servicePrincipalToken *adal.ServicePrincip
 	return azClientConfig
 }
 
+// getClientUserAgent builds the User-Agent fragment attached to every ARM
+// request: the kubernetes version, the controller binary issuing the calls
+// and the config knobs that shape the call pattern, followed by the
+// operator-provided UserAgentSuffix. Azure-side throttling diagnostics use
+// this to attribute traffic to the specific controller and cluster
+// generating it.
+func (az *Cloud) getClientUserAgent() string {
+	userAgent := fmt.Sprintf("kubernetes-cloudprovider/%s; %s; vmType/%s; lbSku/%s",
+		version.Get().GitVersion, filepath.Base(os.Args[0]), az.Config.VMType, az.Config.LoadBalancerSku)
+	if az.Config.UserAgentSuffix != "" {
+		userAgent = fmt.Sprintf("%s; %s", userAgent, az.Config.UserAgentSuffix)
+	}
+	return userAgent
+}
+
 // parseConfig returns a parsed configuration for an Azure cloudprovider config file
 func parseConfig(configReader io.Reader) (*Config, error) {
 	var config Config
@@ -652,10 +1212,31 @@ func (az *Cloud) Initialize(clientBuilder cloudprovider.ControllerClientBuilder,
 	az.eventBroadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: az.KubeClient.CoreV1().Events("")})
 	az.eventRecorder = az.eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "azure-cloud-provider"})
 	az.InitializeCloudFromSecret()
+
+	if az.DriftDetectionIntervalInMinutes > 0 {
+		interval := time.Duration(az.DriftDetectionIntervalInMinutes) * time.Minute
+		go wait.Until(az.runDriftDetection, interval, stop)
+	}
+
+	if az.ChangePollingIntervalInMinutes > 0 {
+		interval := time.Duration(az.ChangePollingIntervalInMinutes) * time.Minute
+		go wait.Until(az.runChangePolling, interval, stop)
+	}
+
+	if az.SharedRuleGCIntervalInMinutes > 0 {
+		interval := time.Duration(az.SharedRuleGCIntervalInMinutes) * time.Minute
+		go wait.Until(az.runSharedRuleGC, interval, stop)
+	}
+
+	auth.StartProactiveTokenRefresh(stop)
 }
 
 // LoadBalancer returns a balancer interface. Also returns true if the interface is supported, false otherwise.
 func (az *Cloud) LoadBalancer() (cloudprovider.LoadBalancer, bool) {
+	if az.DisableLoadBalancerManagement {
+		klog.V(4).Info("LoadBalancer: service load balancer management is disabled by configuration")
+		return nil, false
+	}
 	return az, true
 }
 
@@ -665,9 +1246,8 @@ func (az *Cloud) Instances() (cloudprovider.Instances, bool) {
 }
 
 // InstancesV2 returns an instancesV2 interface. Also returns true if the interface is supported, false otherwise.
-// TODO: implement ONLY for external cloud provider
 func (az *Cloud) InstancesV2() (cloudprovider.InstancesV2, bool) {
-	return nil, false
+	return az, true
 }
 
 // Zones returns a zones interface. Also returns true if the interface is supported, false otherwise.
@@ -682,6 +1262,10 @@ func (az *Cloud) Clusters() (cloudprovider.Clusters, bool) {
 
 // Routes returns a routes interface along with whether the interface is supported.
 func (az *Cloud) Routes() (cloudprovider.Routes, bool) {
+	if az.DisableRouteManagement {
+		klog.V(4).Info("Routes: route management is disabled by configuration")
+		return nil, false
+	}
 	return az, true
 }
 
@@ -728,7 +1312,8 @@ func (az *Cloud) SetInformers(informerFactory informers.SharedInformerFactory) {
 			prevNode := prev.(*v1.Node)
 			newNode := obj.(*v1.Node)
 			if newNode.Labels[v1.LabelZoneFailureDomain] ==
-				prevNode.Labels[v1.LabelZoneFailureDomain] {
+				prevNode.Labels[v1.LabelZoneFailureDomain] &&
+				newNode.Spec.ProviderID == prevNode.Spec.ProviderID {
 				return
 			}
 			az.updateNodeCaches(prevNode, newNode)
@@ -776,6 +1361,9 @@ func (az *Cloud) updateNodeCaches(prevNode, newNode *v1.Node) {
 			delete(az.nodeResourceGroups, prevNode.ObjectMeta.Name)
 		}
 
+		// Remove from nodeVMNames cache.
+		delete(az.nodeVMNames, prevNode.ObjectMeta.Name)
+
 		// Remove from unmanagedNodes cache.
 		managed, ok := prevNode.ObjectMeta.Labels[managedByAzureLabel]
 		if ok && managed == "false" {
@@ -799,6 +1387,13 @@ func (az *Cloud) updateNodeCaches(prevNode, newNode *v1.Node) {
 			az.nodeResourceGroups[newNode.ObjectMeta.Name] = strings.ToLower(newRG)
 		}
 
+		// Add to nodeVMNames cache. VMSS providerIDs don't carry the VM name,
+		// so only standard VM providerIDs are recorded here; VMSS instances are
+		// resolved from the VMSS virtual machines cache instead.
+		if matches := providerIDRE.FindStringSubmatch(newNode.Spec.ProviderID); len(matches) == 2 {
+			az.nodeVMNames[newNode.ObjectMeta.Name] = matches[1]
+		}
+
 		// Add to unmanagedNodes cache.
 		managed, ok := newNode.ObjectMeta.Labels[managedByAzureLabel]
 		if ok && managed == "false" {
@@ -892,10 +1487,12 @@ func (az *Cloud) GetUnmanagedNodes() (sets.String, error) {
 	return sets.NewString(az.unmanagedNodes.List()...), nil
 }
 
-// ShouldNodeExcludedFromLoadBalancer returns true if node is unmanaged or in external resource group.
+// ShouldNodeExcludedFromLoadBalancer returns true if node is unmanaged or in
+// an external resource group that is not allow-listed in
+// managedExternalResourceGroups.
 func (az *Cloud) ShouldNodeExcludedFromLoadBalancer(node *v1.Node) bool {
 	labels := node.ObjectMeta.Labels
-	if rg, ok := labels[externalResourceGroupLabel]; ok && !strings.EqualFold(rg, az.ResourceGroup) {
+	if rg, ok := labels[externalResourceGroupLabel]; ok && !strings.EqualFold(rg, az.ResourceGroup) && !az.isManagedExternalResourceGroup(rg) {
 		return true
 	}
 
@@ -903,5 +1500,20 @@ func (az *Cloud) ShouldNodeExcludedFromLoadBalancer(node *v1.Node) bool {
 		return true
 	}
 
+	if az.shouldDelayNodePoolJoin(node) {
+		return true
+	}
+
+	return false
+}
+
+// isManagedExternalResourceGroup reports whether the external resource group
+// is allow-listed in managedExternalResourceGroups.
+func (az *Cloud) isManagedExternalResourceGroup(resourceGroup string) bool {
+	for _, rg := range az.ManagedExternalResourceGroups {
+		if strings.EqualFold(rg, resourceGroup) {
+			return true
+		}
+	}
 	return false
 }
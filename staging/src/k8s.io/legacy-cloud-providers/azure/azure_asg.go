@@ -0,0 +1,93 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// getDestinationApplicationSecurityGroupIDs returns the Application Security
+// Group resource IDs the security rules of the service should target instead
+// of the frontend IP. The IDs are sorted and deduplicated so the generated
+// rules stay stable across reconciles.
+func getDestinationApplicationSecurityGroupIDs(service *v1.Service) []string {
+	value, found := service.Annotations[ServiceAnnotationDestinationApplicationSecurityGroups]
+	if !found {
+		return nil
+	}
+
+	var ids []string
+	for _, id := range strings.Split(value, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		if !stringInSliceFold(id, ids) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// buildDestinationApplicationSecurityGroups expands the Application Security
+// Group resource IDs into the references carried on a security rule.
+func buildDestinationApplicationSecurityGroups(ids []string) *[]network.ApplicationSecurityGroup {
+	asgs := make([]network.ApplicationSecurityGroup, 0, len(ids))
+	for _, id := range ids {
+		asgs = append(asgs, network.ApplicationSecurityGroup{
+			ID: to.StringPtr(id),
+		})
+	}
+	return &asgs
+}
+
+// securityRuleDestinationASGsEqual compares the destination Application
+// Security Group references of two security rules regardless of order.
+func securityRuleDestinationASGsEqual(existing, expected *[]network.ApplicationSecurityGroup) bool {
+	existingIDs := []string{}
+	if existing != nil {
+		for _, asg := range *existing {
+			existingIDs = append(existingIDs, to.String(asg.ID))
+		}
+	}
+	expectedIDs := []string{}
+	if expected != nil {
+		for _, asg := range *expected {
+			expectedIDs = append(expectedIDs, to.String(asg.ID))
+		}
+	}
+	if len(existingIDs) != len(expectedIDs) {
+		return false
+	}
+	sort.Strings(existingIDs)
+	sort.Strings(expectedIDs)
+	for i := range existingIDs {
+		if !strings.EqualFold(existingIDs[i], expectedIDs[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,97 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestGetDestinationApplicationSecurityGroupIDs(t *testing.T) {
+	asg1 := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/applicationSecurityGroups/asg1"
+	asg2 := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/applicationSecurityGroups/asg2"
+
+	testCases := []struct {
+		desc        string
+		annotations map[string]string
+		expected    []string
+	}{
+		{
+			desc: "no annotation shall yield no IDs",
+		},
+		{
+			desc:        "an empty annotation shall yield no IDs",
+			annotations: map[string]string{ServiceAnnotationDestinationApplicationSecurityGroups: " , "},
+		},
+		{
+			desc:        "IDs shall be trimmed, deduplicated and sorted",
+			annotations: map[string]string{ServiceAnnotationDestinationApplicationSecurityGroups: " " + asg2 + ", " + asg1 + "," + asg2},
+			expected:    []string{asg1, asg2},
+		},
+	}
+
+	for _, test := range testCases {
+		svc := getTestService("service1", v1.ProtocolTCP, test.annotations, false, 80)
+		assert.Equal(t, test.expected, getDestinationApplicationSecurityGroupIDs(&svc), test.desc)
+	}
+}
+
+func TestReconcileSecurityGroupDestinationASGs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	asgID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/applicationSecurityGroups/asg1"
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, map[string]string{
+		ServiceAnnotationDestinationApplicationSecurityGroups: asgID,
+	}, false, 80)
+
+	sg := getTestSecurityGroup(az)
+	setMockSecurityGroup(az, ctrl, sg)
+
+	sg, err := az.reconcileSecurityGroup(testClusterName, &svc, to.StringPtr("1.2.3.4"), true)
+	assert.NoError(t, err)
+
+	_, rule, found := findSecurityRuleByName(*sg.SecurityRules, "aservice1-TCP-80-Internet")
+	if assert.True(t, found, "expected the security rule to be present") {
+		assert.Nil(t, rule.DestinationAddressPrefix)
+		if assert.NotNil(t, rule.DestinationApplicationSecurityGroups) {
+			assert.Len(t, *rule.DestinationApplicationSecurityGroups, 1)
+			assert.Equal(t, asgID, to.String((*rule.DestinationApplicationSecurityGroups)[0].ID))
+		}
+	}
+
+	// A second reconcile with an unchanged annotation shall keep the rule.
+	setMockSecurityGroup(az, ctrl, sg)
+	sgAfter, err := az.reconcileSecurityGroup(testClusterName, &svc, to.StringPtr("1.2.3.4"), true)
+	assert.NoError(t, err)
+	assert.Equal(t, *sg.SecurityRules, *sgAfter.SecurityRules)
+
+	// Combining destination ASGs with a shared security rule is rejected.
+	svc.Annotations[ServiceAnnotationSharedSecurityRule] = "true"
+	setMockSecurityGroup(az, ctrl, sg)
+	_, err = az.reconcileSecurityGroup(testClusterName, &svc, to.StringPtr("1.2.3.4"), true)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "shared security rule")
+}
@@ -0,0 +1,143 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/legacy-cloud-providers/azure/clients/loadbalancerclient"
+	utilnet "k8s.io/utils/net"
+)
+
+const (
+	// loadBalancerBackendPoolConfigurationTypeNodeIPConfiguration is the
+	// default NIC-based backend pool membership.
+	loadBalancerBackendPoolConfigurationTypeNodeIPConfiguration = "nodeIPConfiguration"
+	// loadBalancerBackendPoolConfigurationTypeNodeIP populates the backend
+	// pools with the node IP addresses in a single pool update instead of
+	// per-NIC updates.
+	loadBalancerBackendPoolConfigurationTypeNodeIP = "nodeIP"
+	// loadBalancerBackendPoolConfigurationTypePodIP leaves the backend pool
+	// membership to an external controller managing pod IPs.
+	loadBalancerBackendPoolConfigurationTypePodIP = "podIP"
+
+	virtualNetworkIDTemplate = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/virtualNetworks/%s"
+)
+
+// isLBBackendPoolTypeNodeIPConfig returns true when the backend pools are
+// populated with NIC IP configuration references (the default).
+func (az *Cloud) isLBBackendPoolTypeNodeIPConfig() bool {
+	return az.LoadBalancerBackendPoolConfigurationType == "" ||
+		strings.EqualFold(az.LoadBalancerBackendPoolConfigurationType, loadBalancerBackendPoolConfigurationTypeNodeIPConfiguration)
+}
+
+// isLBBackendPoolTypePodIP returns true when the backend pool membership is
+// managed externally with pod IPs.
+func (az *Cloud) isLBBackendPoolTypePodIP() bool {
+	return strings.EqualFold(az.LoadBalancerBackendPoolConfigurationType, loadBalancerBackendPoolConfigurationTypePodIP)
+}
+
+// getVirtualNetworkID returns the full resource ID of the cluster virtual
+// network.
+func (az *Cloud) getVirtualNetworkID() string {
+	vnetResourceGroup := az.ResourceGroup
+	if az.VnetResourceGroup != "" {
+		vnetResourceGroup = az.VnetResourceGroup
+	}
+	return fmt.Sprintf(virtualNetworkIDTemplate, az.getNetworkResourceSubscriptionID(), vnetResourceGroup, az.VnetName)
+}
+
+// ensureIPBasedBackendPoolHosts reconciles the backend pool membership for
+// the IP-based configuration types. For nodeIP pools the whole membership is
+// written in one backend pool update, avoiding the per-NIC PUT storm of the
+// default configuration on large clusters. For podIP pools the membership is
+// left to the external controller managing it.
+func (az *Cloud) ensureIPBasedBackendPoolHosts(service *v1.Service, backendPoolID string, nodes []*v1.Node) error {
+	if az.isLBBackendPoolTypePodIP() {
+		klog.V(4).Infof("ensureIPBasedBackendPoolHosts(%s): backend pool %s is pod IP based, leaving its membership alone", getServiceName(service), backendPoolID)
+		return nil
+	}
+
+	matches := backendPoolIDRE.FindStringSubmatch(backendPoolID)
+	if len(matches) != 2 {
+		return fmt.Errorf("ensureIPBasedBackendPoolHosts(%s): backendPoolID %q is malformed", getServiceName(service), backendPoolID)
+	}
+	lbName := matches[1]
+	backendPoolName, err := getLastSegment(backendPoolID, "/")
+	if err != nil {
+		return err
+	}
+	wantIPv6 := strings.HasSuffix(backendPoolName, "-IPv6")
+
+	addresses := make([]loadbalancerclient.LoadBalancerBackendAddress, 0, len(nodes))
+	vnetID := az.getVirtualNetworkID()
+	for _, node := range nodes {
+		if az.useStandardLoadBalancer() && az.excludeMasterNodesFromLB(service) && isMasterNode(node) {
+			klog.V(4).Infof("Excluding master node %q from load balancer backendpool %q", node.Name, backendPoolID)
+			continue
+		}
+		if az.ShouldNodeExcludedFromLoadBalancer(node) {
+			klog.V(4).Infof("Excluding unmanaged/external-resource-group node %q", node.Name)
+			continue
+		}
+
+		nodeIP := nodeInternalIP(node, wantIPv6)
+		if nodeIP == "" {
+			klog.Warningf("ensureIPBasedBackendPoolHosts(%s): node %s has no internal IP matching the backend pool family, skipping", getServiceName(service), node.Name)
+			continue
+		}
+
+		addresses = append(addresses, loadbalancerclient.LoadBalancerBackendAddress{
+			Name: node.Name,
+			Properties: loadbalancerclient.LoadBalancerBackendAddressProperties{
+				IPAddress:      nodeIP,
+				VirtualNetwork: &loadbalancerclient.SubResource{ID: vnetID},
+			},
+		})
+	}
+
+	klog.V(2).Infof("ensureIPBasedBackendPoolHosts(%s): updating backend pool %s with %d node IPs", getServiceName(service), backendPoolID, len(addresses))
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	rerr := az.LoadBalancerClient.CreateOrUpdateBackendAddressPool(ctx, az.getLoadBalancerResourceGroup(), lbName, backendPoolName, addresses)
+	if rerr != nil {
+		return rerr.Error()
+	}
+
+	// Invalidate the cache because the backend pool was updated.
+	az.lbCache.Delete(lbName)
+	return nil
+}
+
+// nodeInternalIP returns the internal IP of the node in the requested
+// address family.
+func nodeInternalIP(node *v1.Node, wantIPv6 bool) string {
+	for _, nodeAddress := range node.Status.Addresses {
+		if nodeAddress.Type != v1.NodeInternalIP {
+			continue
+		}
+		if utilnet.IsIPv6String(nodeAddress.Address) == wantIPv6 {
+			return nodeAddress.Address
+		}
+	}
+	return ""
+}
@@ -0,0 +1,112 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/legacy-cloud-providers/azure/clients/loadbalancerclient"
+	"k8s.io/legacy-cloud-providers/azure/clients/loadbalancerclient/mockloadbalancerclient"
+)
+
+func buildTestNodeWithIP(name, ip string) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: v1.NodeStatus{
+			Addresses: []v1.NodeAddress{
+				{Type: v1.NodeHostName, Address: name},
+				{Type: v1.NodeInternalIP, Address: ip},
+			},
+		},
+	}
+}
+
+func TestEnsureIPBasedBackendPoolHosts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerBackendPoolConfigurationType = loadBalancerBackendPoolConfigurationTypeNodeIP
+	az.VnetName = "vnet"
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	backendPoolID := az.getBackendPoolID(testClusterName, az.ResourceGroup, testClusterName)
+	vnetID := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/virtualNetworks/vnet", az.SubscriptionID, az.ResourceGroup)
+
+	nodes := []*v1.Node{
+		buildTestNodeWithIP("node1", "10.240.0.4"),
+		buildTestNodeWithIP("node2", "10.240.0.5"),
+	}
+	// Master nodes should be kept out of the pool.
+	master := buildTestNodeWithIP("master", "10.240.0.6")
+	master.Labels = map[string]string{nodeLabelRole: "master"}
+	nodes = append(nodes, master)
+
+	mockLBsClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBsClient.EXPECT().CreateOrUpdateBackendAddressPool(gomock.Any(), az.ResourceGroup, testClusterName, testClusterName, []loadbalancerclient.LoadBalancerBackendAddress{
+		{
+			Name: "node1",
+			Properties: loadbalancerclient.LoadBalancerBackendAddressProperties{
+				IPAddress:      "10.240.0.4",
+				VirtualNetwork: &loadbalancerclient.SubResource{ID: vnetID},
+			},
+		},
+		{
+			Name: "node2",
+			Properties: loadbalancerclient.LoadBalancerBackendAddressProperties{
+				IPAddress:      "10.240.0.5",
+				VirtualNetwork: &loadbalancerclient.SubResource{ID: vnetID},
+			},
+		},
+	}).Return(nil).Times(1)
+
+	az.LoadBalancerSku = loadBalancerSkuStandard
+	trueVar := true
+	az.ExcludeMasterFromStandardLB = &trueVar
+	err := az.ensureIPBasedBackendPoolHosts(&svc, backendPoolID, nodes)
+	assert.NoError(t, err)
+}
+
+func TestEnsureIPBasedBackendPoolHostsPodIP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerBackendPoolConfigurationType = loadBalancerBackendPoolConfigurationTypePodIP
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	backendPoolID := az.getBackendPoolID(testClusterName, az.ResourceGroup, testClusterName)
+
+	// No pool update should be issued for pod IP based pools.
+	err := az.ensureIPBasedBackendPoolHosts(&svc, backendPoolID, []*v1.Node{buildTestNodeWithIP("node1", "10.240.0.4")})
+	assert.NoError(t, err)
+}
+
+func TestNodeInternalIP(t *testing.T) {
+	node := buildTestNodeWithIP("node1", "10.240.0.4")
+	node.Status.Addresses = append(node.Status.Addresses, v1.NodeAddress{Type: v1.NodeInternalIP, Address: "fd00::4"})
+
+	assert.Equal(t, "10.240.0.4", nodeInternalIP(node, false))
+	assert.Equal(t, "fd00::4", nodeInternalIP(node, true))
+	assert.Equal(t, "", nodeInternalIP(&v1.Node{}, false))
+}
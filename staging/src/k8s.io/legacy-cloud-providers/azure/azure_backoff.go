@@ -34,6 +34,7 @@ import (
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
 	azcache "k8s.io/legacy-cloud-providers/azure/cache"
+	"k8s.io/legacy-cloud-providers/azure/metrics"
 	"k8s.io/legacy-cloud-providers/azure/retry"
 )
 
@@ -155,6 +156,11 @@ func (az *Cloud) GetIPForMachineWithRetry(name types.NodeName) (string, string,
 
 // CreateOrUpdateSecurityGroup invokes az.SecurityGroupsClient.CreateOrUpdate with exponential backoff retry
 func (az *Cloud) CreateOrUpdateSecurityGroup(service *v1.Service, sg network.SecurityGroup) error {
+	if err := az.checkScopeLockCooldown(az.SecurityGroupResourceGroup); err != nil {
+		return err
+	}
+	az.writeBudget.allow(true)
+
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 
@@ -178,7 +184,11 @@ func (az *Cloud) CreateOrUpdateSecurityGroup(service *v1.Service, sg network.Sec
 		az.nsgCache.Delete(*sg.Name)
 	}
 
-	return rerr.Error()
+	if isScopeLockedError(rerr) {
+		az.markScopeLocked(service, az.SecurityGroupResourceGroup)
+	}
+
+	return az.remediatedError(service, "CreateOrUpdateSecurityGroup", rerr)
 }
 
 func cleanupSubnetInFrontendIPConfigurations(lb *network.LoadBalancer) network.LoadBalancer {
@@ -210,17 +220,34 @@ func cleanupSubnetInFrontendIPConfigurations(lb *network.LoadBalancer) network.L
 
 // CreateOrUpdateLB invokes az.LoadBalancerClient.CreateOrUpdate with exponential backoff retry
 func (az *Cloud) CreateOrUpdateLB(service *v1.Service, lb network.LoadBalancer) error {
+	return az.CreateOrUpdateLBWithGatewayLoadBalancers(service, lb, nil)
+}
+
+// CreateOrUpdateLBWithGatewayLoadBalancers invokes az.LoadBalancerClient with
+// exponential backoff retry, chaining the frontend IP configurations named in
+// gatewayLoadBalancers to the referenced gateway load balancer frontends.
+func (az *Cloud) CreateOrUpdateLBWithGatewayLoadBalancers(service *v1.Service, lb network.LoadBalancer, gatewayLoadBalancers map[string]string) error {
+	rgName := az.getLoadBalancerResourceGroup()
+	if err := az.checkScopeLockCooldown(rgName); err != nil {
+		return err
+	}
+	az.writeBudget.allow(true)
+
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 
 	lb = cleanupSubnetInFrontendIPConfigurations(&lb)
-
-	rgName := az.getLoadBalancerResourceGroup()
-	rerr := az.LoadBalancerClient.CreateOrUpdate(ctx, rgName, to.String(lb.Name), lb, to.String(lb.Etag))
+	var rerr *retry.Error
+	if len(gatewayLoadBalancers) == 0 {
+		rerr = az.LoadBalancerClient.CreateOrUpdate(ctx, rgName, to.String(lb.Name), lb, to.String(lb.Etag))
+	} else {
+		rerr = az.LoadBalancerClient.CreateOrUpdateWithGatewayLoadBalancers(ctx, rgName, to.String(lb.Name), lb, gatewayLoadBalancers, to.String(lb.Etag))
+	}
 	klog.V(10).Infof("LoadBalancerClient.CreateOrUpdate(%s): end", *lb.Name)
 	if rerr == nil {
 		// Invalidate the cache right after updating
 		az.lbCache.Delete(*lb.Name)
+		az.lbListCache.Delete(rgName)
 		return nil
 	}
 
@@ -262,28 +289,56 @@ func (az *Cloud) CreateOrUpdateLB(service *v1.Service, lb network.LoadBalancer)
 		az.lbCache.Delete(*lb.Name)
 	}
 
-	return rerr.Error()
+	if isScopeLockedError(rerr) {
+		az.markScopeLocked(service, rgName)
+	}
+
+	return az.remediatedError(service, "CreateOrUpdateLoadBalancer", rerr)
 }
 
 // ListLB invokes az.LoadBalancerClient.List with exponential backoff retry
 func (az *Cloud) ListLB(service *v1.Service) ([]network.LoadBalancer, error) {
-	ctx, cancel := getContextWithCancel()
-	defer cancel()
+	mc := metrics.NewMetricContext("load_balancers", "list_resource_groups", az.ResourceGroup, az.SubscriptionID, "")
 
-	rgName := az.getLoadBalancerResourceGroup()
-	allLBs, rerr := az.LoadBalancerClient.List(ctx, rgName)
-	if rerr != nil {
-		if rerr.IsNotFound() {
-			return nil, nil
+	allLBs := make([]network.LoadBalancer, 0)
+	for _, rgName := range az.getLoadBalancerResourceGroups() {
+		cached, err := az.lbListCache.Get(rgName, azcache.CacheReadTypeDefault)
+		if err != nil {
+			az.Event(service, v1.EventTypeWarning, "ListLoadBalancers", err.Error())
+			klog.Errorf("LoadBalancerClient.List(%v) failure with err=%v", rgName, err)
+			return nil, mc.Observe(err)
+		}
+		if lbs, ok := cached.([]network.LoadBalancer); ok {
+			allLBs = append(allLBs, lbs...)
 		}
-		az.Event(service, v1.EventTypeWarning, "ListLoadBalancers", rerr.Error().Error())
-		klog.Errorf("LoadBalancerClient.List(%v) failure with err=%v", rgName, rerr)
-		return nil, rerr.Error()
 	}
-	klog.V(2).Infof("LoadBalancerClient.List(%v) success", rgName)
+
+	mc.Observe(nil)
 	return allLBs, nil
 }
 
+// getLoadBalancerResourceGroups returns the deduplicated resource groups that
+// may hold load balancers of the cluster: the load balancer resource group,
+// the network resource group and any configured extras.
+func (az *Cloud) getLoadBalancerResourceGroups() []string {
+	rgNames := []string{az.getLoadBalancerResourceGroup()}
+	visited := map[string]bool{strings.ToLower(rgNames[0]): true}
+
+	candidates := []string{az.VnetResourceGroup}
+	for _, rgName := range strings.Split(az.AdditionalLoadBalancerResourceGroups, ",") {
+		candidates = append(candidates, strings.TrimSpace(rgName))
+	}
+	for _, rgName := range candidates {
+		if rgName == "" || visited[strings.ToLower(rgName)] {
+			continue
+		}
+
+		visited[strings.ToLower(rgName)] = true
+		rgNames = append(rgNames, rgName)
+	}
+	return rgNames
+}
+
 // ListPIP list the PIP resources in the given resource group
 func (az *Cloud) ListPIP(service *v1.Service, pipResourceGroup string) ([]network.PublicIPAddress, error) {
 	ctx, cancel := getContextWithCancel()
@@ -295,6 +350,7 @@ func (az *Cloud) ListPIP(service *v1.Service, pipResourceGroup string) ([]networ
 			return nil, nil
 		}
 		az.Event(service, v1.EventTypeWarning, "ListPublicIPs", rerr.Error().Error())
+		az.noteARMError("ListPublicIPs", rerr)
 		klog.Errorf("PublicIPAddressesClient.List(%v) failure with err=%v", pipResourceGroup, rerr)
 		return nil, rerr.Error()
 	}
@@ -305,6 +361,11 @@ func (az *Cloud) ListPIP(service *v1.Service, pipResourceGroup string) ([]networ
 
 // CreateOrUpdatePIP invokes az.PublicIPAddressesClient.CreateOrUpdate with exponential backoff retry
 func (az *Cloud) CreateOrUpdatePIP(service *v1.Service, pipResourceGroup string, pip network.PublicIPAddress) error {
+	if err := az.checkScopeLockCooldown(pipResourceGroup); err != nil {
+		return err
+	}
+	az.writeBudget.allow(true)
+
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 
@@ -313,7 +374,10 @@ func (az *Cloud) CreateOrUpdatePIP(service *v1.Service, pipResourceGroup string,
 	if rerr != nil {
 		klog.Errorf("PublicIPAddressesClient.CreateOrUpdate(%s, %s) failed: %s", pipResourceGroup, to.String(pip.Name), rerr.Error().Error())
 		az.Event(service, v1.EventTypeWarning, "CreateOrUpdatePublicIPAddress", rerr.Error().Error())
-		return rerr.Error()
+		if isScopeLockedError(rerr) {
+			az.markScopeLocked(service, pipResourceGroup)
+		}
+		return az.remediatedError(service, "CreateOrUpdatePublicIPAddress", rerr)
 	}
 
 	return nil
@@ -321,6 +385,11 @@ func (az *Cloud) CreateOrUpdatePIP(service *v1.Service, pipResourceGroup string,
 
 // CreateOrUpdateInterface invokes az.PublicIPAddressesClient.CreateOrUpdate with exponential backoff retry
 func (az *Cloud) CreateOrUpdateInterface(service *v1.Service, nic network.Interface) error {
+	if err := az.checkScopeLockCooldown(az.ResourceGroup); err != nil {
+		return err
+	}
+	az.writeBudget.allow(true)
+
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 
@@ -329,6 +398,10 @@ func (az *Cloud) CreateOrUpdateInterface(service *v1.Service, nic network.Interf
 	if rerr != nil {
 		klog.Errorf("InterfacesClient.CreateOrUpdate(%s) failed: %s", *nic.Name, rerr.Error().Error())
 		az.Event(service, v1.EventTypeWarning, "CreateOrUpdateInterface", rerr.Error().Error())
+		az.noteARMError("CreateOrUpdateInterface", rerr)
+		if isScopeLockedError(rerr) {
+			az.markScopeLocked(service, az.ResourceGroup)
+		}
 		return rerr.Error()
 	}
 
@@ -337,6 +410,11 @@ func (az *Cloud) CreateOrUpdateInterface(service *v1.Service, nic network.Interf
 
 // DeletePublicIP invokes az.PublicIPAddressesClient.Delete with exponential backoff retry
 func (az *Cloud) DeletePublicIP(service *v1.Service, pipResourceGroup string, pipName string) error {
+	if err := az.checkScopeLockCooldown(pipResourceGroup); err != nil {
+		return err
+	}
+	az.writeBudget.allow(true)
+
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 
@@ -344,6 +422,10 @@ func (az *Cloud) DeletePublicIP(service *v1.Service, pipResourceGroup string, pi
 	if rerr != nil {
 		klog.Errorf("PublicIPAddressesClient.Delete(%s) failed: %s", pipName, rerr.Error().Error())
 		az.Event(service, v1.EventTypeWarning, "DeletePublicIPAddress", rerr.Error().Error())
+		az.noteARMError("DeletePublicIPAddress", rerr)
+		if isScopeLockedError(rerr) {
+			az.markScopeLocked(service, pipResourceGroup)
+		}
 		return rerr.Error()
 	}
 
@@ -352,24 +434,46 @@ func (az *Cloud) DeletePublicIP(service *v1.Service, pipResourceGroup string, pi
 
 // DeleteLB invokes az.LoadBalancerClient.Delete with exponential backoff retry
 func (az *Cloud) DeleteLB(service *v1.Service, lbName string) error {
+	return az.DeleteLBInResourceGroup(service, az.getLoadBalancerResourceGroup(), lbName)
+}
+
+// DeleteLBInResourceGroup deletes the load balancer in the given resource
+// group. Load balancer listings span the network resource group and any
+// additional configured groups, so deletes of listed load balancers must
+// target the group the load balancer came from rather than the default one.
+func (az *Cloud) DeleteLBInResourceGroup(service *v1.Service, rgName, lbName string) error {
+	if err := az.checkScopeLockCooldown(rgName); err != nil {
+		return err
+	}
+	az.writeBudget.allow(true)
+
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 
-	rgName := az.getLoadBalancerResourceGroup()
 	rerr := az.LoadBalancerClient.Delete(ctx, rgName, lbName)
 	if rerr == nil {
 		// Invalidate the cache right after updating
 		az.lbCache.Delete(lbName)
+		az.lbListCache.Delete(rgName)
 		return nil
 	}
 
 	klog.Errorf("LoadBalancerClient.Delete(%s) failed: %s", lbName, rerr.Error().Error())
 	az.Event(service, v1.EventTypeWarning, "DeleteLoadBalancer", rerr.Error().Error())
+	az.noteARMError("DeleteLoadBalancer", rerr)
+	if isScopeLockedError(rerr) {
+		az.markScopeLocked(service, rgName)
+	}
 	return rerr.Error()
 }
 
 // CreateOrUpdateRouteTable invokes az.RouteTablesClient.CreateOrUpdate with exponential backoff retry
 func (az *Cloud) CreateOrUpdateRouteTable(routeTable network.RouteTable) error {
+	if err := az.checkScopeLockCooldown(az.RouteTableResourceGroup); err != nil {
+		return err
+	}
+	az.writeBudget.allow(true)
+
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 
@@ -390,12 +494,21 @@ func (az *Cloud) CreateOrUpdateRouteTable(routeTable network.RouteTable) error {
 		klog.V(3).Infof("Route table cache for %s is cleanup because CreateOrUpdateRouteTable is canceld by another operation", *routeTable.Name)
 		az.rtCache.Delete(*routeTable.Name)
 	}
+	if isScopeLockedError(rerr) {
+		az.markScopeLocked(nil, az.RouteTableResourceGroup)
+	}
+	az.noteARMError("CreateOrUpdateRouteTable", rerr)
 	klog.Errorf("RouteTablesClient.CreateOrUpdate(%s) failed: %v", az.RouteTableName, rerr.Error())
 	return rerr.Error()
 }
 
 // CreateOrUpdateRoute invokes az.RoutesClient.CreateOrUpdate with exponential backoff retry
 func (az *Cloud) CreateOrUpdateRoute(route network.Route) error {
+	if err := az.checkScopeLockCooldown(az.RouteTableResourceGroup); err != nil {
+		return err
+	}
+	az.writeBudget.allow(true)
+
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 
@@ -415,11 +528,20 @@ func (az *Cloud) CreateOrUpdateRoute(route network.Route) error {
 		klog.V(3).Infof("Route cache for %s is cleanup because CreateOrUpdateRouteTable is canceld by another operation", *route.Name)
 		az.rtCache.Delete(az.RouteTableName)
 	}
+	if isScopeLockedError(rerr) {
+		az.markScopeLocked(nil, az.RouteTableResourceGroup)
+	}
+	az.noteARMError("CreateOrUpdateRoute", rerr)
 	return rerr.Error()
 }
 
 // DeleteRouteWithName invokes az.RoutesClient.CreateOrUpdate with exponential backoff retry
 func (az *Cloud) DeleteRouteWithName(routeName string) error {
+	if err := az.checkScopeLockCooldown(az.RouteTableResourceGroup); err != nil {
+		return err
+	}
+	az.writeBudget.allow(true)
+
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 
@@ -430,6 +552,10 @@ func (az *Cloud) DeleteRouteWithName(routeName string) error {
 	}
 
 	klog.Errorf("RoutesClient.Delete(%s, %s) failed: %v", az.RouteTableName, routeName, rerr.Error())
+	az.noteARMError("DeleteRoute", rerr)
+	if isScopeLockedError(rerr) {
+		az.markScopeLocked(nil, az.RouteTableResourceGroup)
+	}
 	return rerr.Error()
 }
 
@@ -319,6 +319,69 @@ func TestListLB(t *testing.T) {
 
 }
 
+func TestListLBMultipleResourceGroups(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.VnetResourceGroup = "vnet-rg"
+	az.AdditionalLoadBalancerResourceGroups = "extra-rg, rg"
+
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().List(gomock.Any(), "rg").Return([]network.LoadBalancer{{Name: to.StringPtr("lb1")}}, nil)
+	mockLBClient.EXPECT().List(gomock.Any(), "vnet-rg").Return([]network.LoadBalancer{{Name: to.StringPtr("lb2")}}, nil)
+	mockLBClient.EXPECT().List(gomock.Any(), "extra-rg").Return(nil, &retry.Error{HTTPStatusCode: http.StatusNotFound})
+
+	lbs, err := az.ListLB(&v1.Service{})
+	assert.NoError(t, err)
+	assert.Equal(t, []network.LoadBalancer{{Name: to.StringPtr("lb1")}, {Name: to.StringPtr("lb2")}}, lbs)
+
+	// The second listing should be served from the cache.
+	lbs, err = az.ListLB(&v1.Service{})
+	assert.NoError(t, err)
+	assert.Len(t, lbs, 2)
+}
+
+func TestGetLoadBalancerResourceGroups(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tests := []struct {
+		desc              string
+		lbResourceGroup   string
+		vnetResourceGroup string
+		additional        string
+		expected          []string
+	}{
+		{
+			desc:              "identical resource groups should be deduplicated",
+			vnetResourceGroup: "rg",
+			expected:          []string{"rg"},
+		},
+		{
+			desc:              "network and extra resource groups should be appended",
+			vnetResourceGroup: "vnet-rg",
+			additional:        "extra-rg, RG",
+			expected:          []string{"rg", "vnet-rg", "extra-rg"},
+		},
+		{
+			desc:              "load balancer resource group should come first",
+			lbResourceGroup:   "lb-rg",
+			vnetResourceGroup: "vnet-rg",
+			expected:          []string{"lb-rg", "vnet-rg"},
+		},
+	}
+
+	for _, test := range tests {
+		az := GetTestCloud(ctrl)
+		az.LoadBalancerResourceGroup = test.lbResourceGroup
+		az.VnetResourceGroup = test.vnetResourceGroup
+		az.AdditionalLoadBalancerResourceGroups = test.additional
+
+		assert.Equal(t, test.expected, az.getLoadBalancerResourceGroups(), test.desc)
+	}
+}
+
 func TestListPIP(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -0,0 +1,66 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"encoding/json"
+	"net/http"
+
+	azcache "k8s.io/legacy-cloud-providers/azure/cache"
+)
+
+// cacheDump is the introspection output for one cache: its read counters and
+// the cached keys with their ages. Payloads are never included.
+type cacheDump struct {
+	Stats azcache.CacheStats     `json:"stats"`
+	Keys  []azcache.CacheKeyInfo `json:"keys"`
+}
+
+// namedCaches returns the provider caches by name. Caches that have not been
+// initialized yet are left out.
+func (az *Cloud) namedCaches() map[string]*azcache.TimedCache {
+	caches := map[string]*azcache.TimedCache{}
+	for _, timedCache := range []*azcache.TimedCache{az.vmCache, az.lbCache, az.lbListCache, az.nsgCache, az.rtCache} {
+		if timedCache != nil && timedCache.Name != "" {
+			caches[timedCache.Name] = timedCache
+		}
+	}
+	return caches
+}
+
+// CacheIntrospectionHandler returns a debug handler that dumps the read
+// counters and keys with ages of the provider caches as JSON, so operators
+// can validate TTL settings and diagnose stale-data problems. Cached payloads
+// are redacted; only keys and ages are exposed.
+func (az *Cloud) CacheIntrospectionHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dump := map[string]cacheDump{}
+		for name, timedCache := range az.namedCaches() {
+			dump[name] = cacheDump{
+				Stats: timedCache.Stats(),
+				Keys:  timedCache.Keys(),
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(dump); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,51 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheIntrospectionHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.lbCache.Set("lb1", "some data")
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	az.CacheIntrospectionHandler().ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	var dump map[string]cacheDump
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &dump))
+	assert.Contains(t, dump, "vm")
+	assert.Contains(t, dump, "lbList")
+	assert.Len(t, dump["lb"].Keys, 1)
+	assert.Equal(t, "lb1", dump["lb"].Keys[0].Key)
+	// Payloads must not leak into the dump.
+	assert.NotContains(t, recorder.Body.String(), "some data")
+}
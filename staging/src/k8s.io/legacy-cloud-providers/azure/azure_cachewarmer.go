@@ -0,0 +1,124 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"time"
+
+	"k8s.io/klog/v2"
+	azcache "k8s.io/legacy-cloud-providers/azure/cache"
+)
+
+const (
+	// cacheWarmupTimeout bounds how long load balancer reconciles wait on the
+	// startup warm-up, so a wedged warm-up cannot block service syncs
+	// indefinitely.
+	cacheWarmupTimeout = 5 * time.Minute
+
+	// cacheWarmupInterval paces the per-resource warm-up calls so they stay
+	// well below the client rate limits instead of spending them right before
+	// the reconcile storm they are meant to absorb.
+	cacheWarmupInterval = 100 * time.Millisecond
+)
+
+// cacheWarmer fills the VM and load balancer caches with paced calls at
+// controller startup, before the service controller floods reconciles.
+// Network interfaces are read through uncached GETs and cannot be warmed.
+type cacheWarmer struct {
+	az   *Cloud
+	done chan struct{}
+}
+
+// newCacheWarmer creates a new cacheWarmer.
+func newCacheWarmer(az *Cloud) *cacheWarmer {
+	return &cacheWarmer{
+		az:   az,
+		done: make(chan struct{}),
+	}
+}
+
+// run warms the caches and then releases the waiters. Failures only log: the
+// normal reconcile path fetches whatever the warm-up could not.
+func (w *cacheWarmer) run() {
+	defer close(w.done)
+
+	startTime := time.Now()
+	w.warmVirtualMachines()
+	w.warmLoadBalancers()
+	klog.V(2).Infof("cacheWarmer: warm-up finished after %v", time.Since(startTime))
+}
+
+// wait blocks until the warm-up finishes or the timeout elapses.
+func (w *cacheWarmer) wait(timeout time.Duration) {
+	select {
+	case <-w.done:
+	case <-time.After(timeout):
+		klog.Warningf("cacheWarmer: warm-up did not finish within %v, proceeding without it", timeout)
+	}
+}
+
+// warmVirtualMachines lists the node VMs once and then reads each of them
+// through the VM cache at the warm-up pace. The reads go through the cache
+// getter so the entries carry the instance view it is contracted to hold.
+func (w *cacheWarmer) warmVirtualMachines() {
+	vms, err := w.az.ListVirtualMachines(w.az.ResourceGroup)
+	if err != nil {
+		klog.Warningf("cacheWarmer: listing virtual machines: %v", err)
+		return
+	}
+
+	for _, vm := range vms {
+		if vm.Name == nil {
+			continue
+		}
+		time.Sleep(cacheWarmupInterval)
+		if _, err := w.az.vmCache.Get(*vm.Name, azcache.CacheReadTypeDefault); err != nil {
+			klog.Warningf("cacheWarmer: warming virtual machine %s: %v", *vm.Name, err)
+		}
+	}
+	klog.V(2).Infof("cacheWarmer: warmed %d virtual machines", len(vms))
+}
+
+// warmLoadBalancers lists the load balancers once and primes the per-name
+// cache from the listing, which carries the same full resources as a GET.
+func (w *cacheWarmer) warmLoadBalancers() {
+	lbs, err := w.az.ListLB(nil)
+	if err != nil {
+		klog.Warningf("cacheWarmer: listing load balancers: %v", err)
+		return
+	}
+
+	for i := range lbs {
+		lb := lbs[i]
+		if lb.Name == nil {
+			continue
+		}
+		w.az.lbCache.Set(*lb.Name, &lb)
+	}
+	klog.V(2).Infof("cacheWarmer: warmed %d load balancers", len(lbs))
+}
+
+// waitForCacheWarmup gates the caller on the startup warm-up when it is
+// enabled. It returns immediately once the warm-up has completed.
+func (az *Cloud) waitForCacheWarmup() {
+	if az.cacheWarmer == nil {
+		return
+	}
+	az.cacheWarmer.wait(cacheWarmupTimeout)
+}
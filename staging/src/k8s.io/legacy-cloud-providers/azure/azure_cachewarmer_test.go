@@ -0,0 +1,91 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-12-01/compute"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	azcache "k8s.io/legacy-cloud-providers/azure/cache"
+	"k8s.io/legacy-cloud-providers/azure/clients/loadbalancerclient/mockloadbalancerclient"
+	"k8s.io/legacy-cloud-providers/azure/clients/vmclient/mockvmclient"
+)
+
+func TestCacheWarmerWarmsCaches(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+
+	expectedVMs := []compute.VirtualMachine{
+		{Name: to.StringPtr("vm1")},
+		{Name: to.StringPtr("vm2")},
+	}
+	expectedLBs := []network.LoadBalancer{
+		{Name: to.StringPtr("lb1")},
+	}
+
+	// Each resource is fetched exactly once: the warm-up primes the caches
+	// and the verification reads below are served from them.
+	mockVMClient := az.VirtualMachinesClient.(*mockvmclient.MockInterface)
+	mockVMClient.EXPECT().List(gomock.Any(), "rg").Return(expectedVMs, nil).Times(1)
+	mockVMClient.EXPECT().Get(gomock.Any(), "rg", "vm1", gomock.Any()).Return(expectedVMs[0], nil).Times(1)
+	mockVMClient.EXPECT().Get(gomock.Any(), "rg", "vm2", gomock.Any()).Return(expectedVMs[1], nil).Times(1)
+	mockLBsClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBsClient.EXPECT().List(gomock.Any(), "rg").Return(expectedLBs, nil).Times(1)
+
+	warmer := newCacheWarmer(az)
+	warmer.run()
+
+	cachedVM, err := az.vmCache.Get("vm1", azcache.CacheReadTypeDefault)
+	assert.NoError(t, err)
+	assert.Equal(t, "vm1", to.String(cachedVM.(*compute.VirtualMachine).Name))
+
+	cachedLB, err := az.lbCache.Get("lb1", azcache.CacheReadTypeDefault)
+	assert.NoError(t, err)
+	assert.Equal(t, "lb1", to.String(cachedLB.(*network.LoadBalancer).Name))
+
+	// The waiters are released once the warm-up has finished.
+	az.cacheWarmer = warmer
+	done := make(chan struct{})
+	go func() {
+		az.waitForCacheWarmup()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("waitForCacheWarmup did not return after the warm-up finished")
+	}
+}
+
+func TestWaitForCacheWarmupDisabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Without a warmer configured the gate is a no-op.
+	az := GetTestCloud(ctrl)
+	az.waitForCacheWarmup()
+}
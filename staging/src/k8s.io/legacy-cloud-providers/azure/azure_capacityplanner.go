@@ -0,0 +1,160 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	azcache "k8s.io/legacy-cloud-providers/azure/cache"
+)
+
+const (
+	// maximumFrontendIPConfigurations is the Azure limit of frontend IP
+	// configurations per load balancer.
+	// https://docs.microsoft.com/en-us/azure/azure-subscription-service-limits#load-balancer
+	maximumFrontendIPConfigurations = 600
+	// maximumSecurityRuleCount is the Azure limit of rules per network
+	// security group.
+	maximumSecurityRuleCount = 1000
+)
+
+// CapacityPlanInput describes a hypothetical set of services for which the
+// projected load balancer and security group usage should be computed.
+type CapacityPlanInput struct {
+	// Services is the number of hypothetical load balancer services.
+	Services int `json:"services"`
+	// PortsPerService is the number of ports each hypothetical service exposes.
+	PortsPerService int `json:"portsPerService"`
+}
+
+// CapacityPlanUsage holds one dimension of the capacity plan.
+type CapacityPlanUsage struct {
+	Current   int `json:"current"`
+	Projected int `json:"projected"`
+	Limit     int `json:"limit"`
+}
+
+// exceeded reports whether the projected usage exceeds the limit.
+func (u CapacityPlanUsage) exceeded() bool {
+	return u.Projected > u.Limit
+}
+
+// CapacityPlan compares the projected frontend, rule, probe and security rule
+// usage of a hypothetical set of services against the current usage and the
+// Azure limits.
+type CapacityPlan struct {
+	Input            CapacityPlanInput `json:"input"`
+	Frontends        CapacityPlanUsage `json:"frontends"`
+	Rules            CapacityPlanUsage `json:"rules"`
+	Probes           CapacityPlanUsage `json:"probes"`
+	SecurityRules    CapacityPlanUsage `json:"securityRules"`
+	FitsWithinLimits bool              `json:"fitsWithinLimits"`
+}
+
+// PlanCapacity computes the projected frontends, rules, probes and security
+// rules of the given hypothetical services on top of the current usage, and
+// compares them to the Azure limits. It is meant for platform teams doing
+// capacity planning before onboarding new workloads.
+func (az *Cloud) PlanCapacity(input CapacityPlanInput) (*CapacityPlan, error) {
+	if input.Services < 0 || input.PortsPerService < 0 {
+		return nil, fmt.Errorf("services and portsPerService must not be negative")
+	}
+
+	lbs, err := az.ListLB(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &CapacityPlan{Input: input}
+	for _, lb := range lbs {
+		if lb.LoadBalancerPropertiesFormat == nil {
+			continue
+		}
+		if lb.FrontendIPConfigurations != nil {
+			plan.Frontends.Current += len(*lb.FrontendIPConfigurations)
+		}
+		if lb.LoadBalancingRules != nil {
+			plan.Rules.Current += len(*lb.LoadBalancingRules)
+		}
+		if lb.Probes != nil {
+			plan.Probes.Current += len(*lb.Probes)
+		}
+	}
+
+	sg, err := az.getSecurityGroup(azcache.CacheReadTypeDefault)
+	if err != nil {
+		return nil, err
+	}
+	if sg.SecurityGroupPropertiesFormat != nil && sg.SecurityRules != nil {
+		plan.SecurityRules.Current = len(*sg.SecurityRules)
+	}
+
+	// Every hypothetical service consumes one frontend IP configuration and
+	// one rule, probe and security rule per port.
+	ports := input.Services * input.PortsPerService
+	plan.Frontends.Projected = plan.Frontends.Current + input.Services
+	plan.Rules.Projected = plan.Rules.Current + ports
+	plan.Probes.Projected = plan.Probes.Current + ports
+	plan.SecurityRules.Projected = plan.SecurityRules.Current + ports
+
+	plan.Frontends.Limit = maximumFrontendIPConfigurations
+	plan.Rules.Limit = az.MaximumLoadBalancerRuleCount
+	plan.Probes.Limit = az.MaximumLoadBalancerRuleCount
+	plan.SecurityRules.Limit = maximumSecurityRuleCount
+
+	plan.FitsWithinLimits = !plan.Frontends.exceeded() && !plan.Rules.exceeded() &&
+		!plan.Probes.exceeded() && !plan.SecurityRules.exceeded()
+	return plan, nil
+}
+
+// CapacityPlannerHandler returns a debug handler that serves capacity plans
+// as JSON. The number of hypothetical services and ports are taken from the
+// services and portsPerService query parameters.
+func (az *Cloud) CapacityPlannerHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		input := CapacityPlanInput{}
+		var err error
+		if v := r.URL.Query().Get("services"); v != "" {
+			if input.Services, err = strconv.Atoi(v); err != nil {
+				http.Error(w, fmt.Sprintf("invalid services parameter: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+		if v := r.URL.Query().Get("portsPerService"); v != "" {
+			if input.PortsPerService, err = strconv.Atoi(v); err != nil {
+				http.Error(w, fmt.Sprintf("invalid portsPerService parameter: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		plan, err := az.PlanCapacity(input)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(plan); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
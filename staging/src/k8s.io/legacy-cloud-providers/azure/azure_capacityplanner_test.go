@@ -0,0 +1,104 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/legacy-cloud-providers/azure/clients/loadbalancerclient/mockloadbalancerclient"
+	"k8s.io/legacy-cloud-providers/azure/clients/securitygroupclient/mocksecuritygroupclient"
+)
+
+func setCapacityPlannerMocks(az *Cloud) {
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().List(gomock.Any(), "rg").Return([]network.LoadBalancer{
+		{
+			Name: to.StringPtr("lb"),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+				FrontendIPConfigurations: &[]network.FrontendIPConfiguration{{Name: to.StringPtr("fip")}},
+				LoadBalancingRules:       &[]network.LoadBalancingRule{{Name: to.StringPtr("rule1")}, {Name: to.StringPtr("rule2")}},
+				Probes:                   &[]network.Probe{{Name: to.StringPtr("probe1")}, {Name: to.StringPtr("probe2")}},
+			},
+		},
+	}, nil)
+
+	mockSGClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+	mockSGClient.EXPECT().Get(gomock.Any(), "rg", "nsg", gomock.Any()).Return(network.SecurityGroup{
+		Name: to.StringPtr("nsg"),
+		SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+			SecurityRules: &[]network.SecurityRule{{Name: to.StringPtr("rule")}},
+		},
+	}, nil)
+}
+
+func TestPlanCapacity(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	setCapacityPlannerMocks(az)
+
+	plan, err := az.PlanCapacity(CapacityPlanInput{Services: 10, PortsPerService: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, CapacityPlanUsage{Current: 1, Projected: 11, Limit: maximumFrontendIPConfigurations}, plan.Frontends)
+	assert.Equal(t, CapacityPlanUsage{Current: 2, Projected: 22, Limit: az.MaximumLoadBalancerRuleCount}, plan.Rules)
+	assert.Equal(t, CapacityPlanUsage{Current: 2, Projected: 22, Limit: az.MaximumLoadBalancerRuleCount}, plan.Probes)
+	assert.Equal(t, CapacityPlanUsage{Current: 1, Projected: 21, Limit: maximumSecurityRuleCount}, plan.SecurityRules)
+	assert.True(t, plan.FitsWithinLimits)
+
+	// Exceeding the rule count must be reported.
+	az = GetTestCloud(ctrl)
+	setCapacityPlannerMocks(az)
+	plan, err = az.PlanCapacity(CapacityPlanInput{Services: 300, PortsPerService: 1})
+	assert.NoError(t, err)
+	assert.False(t, plan.FitsWithinLimits)
+
+	_, err = az.PlanCapacity(CapacityPlanInput{Services: -1})
+	assert.Error(t, err)
+}
+
+func TestCapacityPlannerHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	setCapacityPlannerMocks(az)
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/?services=10&portsPerService=2", nil)
+	az.CapacityPlannerHandler().ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	var plan CapacityPlan
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &plan))
+	assert.Equal(t, 11, plan.Frontends.Projected)
+
+	recorder = httptest.NewRecorder()
+	request = httptest.NewRequest(http.MethodGet, "/?services=bogus", nil)
+	az.CapacityPlannerHandler().ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
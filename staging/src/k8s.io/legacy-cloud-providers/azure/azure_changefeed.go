@@ -0,0 +1,177 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest/to"
+
+	"k8s.io/klog/v2"
+)
+
+// runChangePolling performs one delta query over the load balancers, network
+// security groups and network interfaces of the cluster resource groups and
+// invalidates the provider caches of the resources that changed since the
+// previous poll. Etags move on every out-of-band edit, so comparing them
+// against the snapshot of the previous poll is a cheap substitute for Azure
+// Resource Graph change notifications: it shrinks the window where the
+// provider reconciles against stale cached views without shortening the
+// cache TTLs for the common case where nothing changed.
+func (az *Cloud) runChangePolling() {
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+
+	az.pollLoadBalancerChanges(ctx)
+	az.pollSecurityGroupChanges(ctx)
+	az.pollInterfaceChanges(ctx)
+}
+
+// pollLoadBalancerChanges invalidates the cache entries of load balancers
+// whose etag moved, and the listing cache of the resource group when any
+// load balancer changed, appeared or disappeared.
+func (az *Cloud) pollLoadBalancerChanges(ctx context.Context) {
+	rgName := az.getLoadBalancerResourceGroup()
+	lbs, rerr := az.LoadBalancerClient.List(ctx, rgName)
+	if rerr != nil {
+		klog.Errorf("pollLoadBalancerChanges: failed to list load balancers in %q: %v", rgName, rerr)
+		return
+	}
+
+	current := make(map[string]string, len(lbs))
+	for i := range lbs {
+		current[to.String(lbs[i].ID)] = to.String(lbs[i].Etag)
+	}
+
+	changed := az.detectChangedResources("loadBalancer", current)
+	if len(changed) == 0 {
+		return
+	}
+
+	for _, id := range changed {
+		lbName, err := getLastSegment(id, "/")
+		if err != nil {
+			continue
+		}
+		klog.V(2).Infof("pollLoadBalancerChanges: load balancer %q changed out-of-band, invalidating its cache entry", lbName)
+		if err := az.lbCache.Delete(lbName); err != nil {
+			klog.Errorf("pollLoadBalancerChanges: failed to invalidate load balancer cache for %q: %v", lbName, err)
+		}
+	}
+	if err := az.lbListCache.Delete(rgName); err != nil {
+		klog.Errorf("pollLoadBalancerChanges: failed to invalidate load balancer list cache for %q: %v", rgName, err)
+	}
+}
+
+// pollSecurityGroupChanges invalidates the cache entries of network security
+// groups whose etag moved.
+func (az *Cloud) pollSecurityGroupChanges(ctx context.Context) {
+	nsgs, rerr := az.SecurityGroupsClient.List(ctx, az.SecurityGroupResourceGroup)
+	if rerr != nil {
+		klog.Errorf("pollSecurityGroupChanges: failed to list security groups in %q: %v", az.SecurityGroupResourceGroup, rerr)
+		return
+	}
+
+	current := make(map[string]string, len(nsgs))
+	for i := range nsgs {
+		current[to.String(nsgs[i].ID)] = to.String(nsgs[i].Etag)
+	}
+
+	for _, id := range az.detectChangedResources("securityGroup", current) {
+		nsgName, err := getLastSegment(id, "/")
+		if err != nil {
+			continue
+		}
+		klog.V(2).Infof("pollSecurityGroupChanges: security group %q changed out-of-band, invalidating its cache entry", nsgName)
+		if err := az.nsgCache.Delete(nsgName); err != nil {
+			klog.Errorf("pollSecurityGroupChanges: failed to invalidate security group cache for %q: %v", nsgName, err)
+		}
+	}
+}
+
+// pollInterfaceChanges invalidates the VM cache entry of the machine a
+// changed network interface is attached to. Network interfaces are not
+// cached themselves, but the cached VM carries the network profile that is
+// rendered from them.
+func (az *Cloud) pollInterfaceChanges(ctx context.Context) {
+	nics, rerr := az.InterfacesClient.List(ctx, az.ResourceGroup)
+	if rerr != nil {
+		klog.Errorf("pollInterfaceChanges: failed to list network interfaces in %q: %v", az.ResourceGroup, rerr)
+		return
+	}
+
+	current := make(map[string]string, len(nics))
+	vmIDByNicID := make(map[string]string, len(nics))
+	for i := range nics {
+		nicID := to.String(nics[i].ID)
+		current[nicID] = to.String(nics[i].Etag)
+		if nics[i].InterfacePropertiesFormat != nil && nics[i].VirtualMachine != nil {
+			vmIDByNicID[nicID] = to.String(nics[i].VirtualMachine.ID)
+		}
+	}
+
+	for _, id := range az.detectChangedResources("networkInterface", current) {
+		vmID, found := vmIDByNicID[id]
+		if !found {
+			// Detached or deleted interfaces no longer render into any VM.
+			continue
+		}
+		vmName, err := getLastSegment(vmID, "/")
+		if err != nil {
+			continue
+		}
+		klog.V(2).Infof("pollInterfaceChanges: network interface %q changed out-of-band, invalidating the cache entry of VM %q", id, vmName)
+		if err := az.vmCache.Delete(strings.ToLower(vmName)); err != nil {
+			klog.Errorf("pollInterfaceChanges: failed to invalidate VM cache for %q: %v", vmName, err)
+		}
+	}
+}
+
+// detectChangedResources compares the current etags of one resource kind
+// against the snapshot of the previous poll and replaces the snapshot. It
+// returns the IDs whose etag moved, the IDs that appeared and the IDs that
+// disappeared. The first poll only seeds the snapshot: everything cached
+// before the poller started is already subject to the regular TTLs.
+func (az *Cloud) detectChangedResources(kind string, current map[string]string) []string {
+	az.changePollLock.Lock()
+	defer az.changePollLock.Unlock()
+
+	if az.changePollEtags == nil {
+		az.changePollEtags = map[string]map[string]string{}
+	}
+	previous, seeded := az.changePollEtags[kind]
+	az.changePollEtags[kind] = current
+	if !seeded {
+		return nil
+	}
+
+	var changed []string
+	for id, etag := range current {
+		if previousEtag, found := previous[id]; !found || previousEtag != etag {
+			changed = append(changed, id)
+		}
+	}
+	for id := range previous {
+		if _, found := current[id]; !found {
+			changed = append(changed, id)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,129 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	azcache "k8s.io/legacy-cloud-providers/azure/cache"
+	"k8s.io/legacy-cloud-providers/azure/clients/interfaceclient/mockinterfaceclient"
+	"k8s.io/legacy-cloud-providers/azure/clients/loadbalancerclient/mockloadbalancerclient"
+	"k8s.io/legacy-cloud-providers/azure/clients/securitygroupclient/mocksecuritygroupclient"
+)
+
+func cacheHasKey(cache *azcache.TimedCache, key string) bool {
+	for _, info := range cache.Keys() {
+		if info.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDetectChangedResources(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+
+	// The first poll only seeds the snapshot.
+	changed := az.detectChangedResources("loadBalancer", map[string]string{"id1": "etag1", "id2": "etag1"})
+	assert.Empty(t, changed)
+
+	// Nothing changed.
+	changed = az.detectChangedResources("loadBalancer", map[string]string{"id1": "etag1", "id2": "etag1"})
+	assert.Empty(t, changed)
+
+	// A moved etag, an addition and a removal are all reported.
+	changed = az.detectChangedResources("loadBalancer", map[string]string{"id1": "etag2", "id3": "etag1"})
+	assert.ElementsMatch(t, []string{"id1", "id2", "id3"}, changed)
+
+	// Snapshots of different kinds are independent.
+	changed = az.detectChangedResources("securityGroup", map[string]string{"id1": "etag1"})
+	assert.Empty(t, changed)
+}
+
+func TestRunChangePollingInvalidatesCaches(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+
+	lbID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb1"
+	nsgID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/networkSecurityGroups/nsg"
+	nicID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/nic1"
+	vmID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm1"
+
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockSGClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+	mockNICClient := az.InterfacesClient.(*mockinterfaceclient.MockInterface)
+
+	gomock.InOrder(
+		mockLBClient.EXPECT().List(gomock.Any(), "rg").Return([]network.LoadBalancer{
+			{ID: to.StringPtr(lbID), Name: to.StringPtr("lb1"), Etag: to.StringPtr("etag1")},
+		}, nil),
+		mockLBClient.EXPECT().List(gomock.Any(), "rg").Return([]network.LoadBalancer{
+			{ID: to.StringPtr(lbID), Name: to.StringPtr("lb1"), Etag: to.StringPtr("etag2")},
+		}, nil),
+	)
+	gomock.InOrder(
+		mockSGClient.EXPECT().List(gomock.Any(), "rg").Return([]network.SecurityGroup{
+			{ID: to.StringPtr(nsgID), Name: to.StringPtr("nsg"), Etag: to.StringPtr("etag1")},
+		}, nil),
+		mockSGClient.EXPECT().List(gomock.Any(), "rg").Return([]network.SecurityGroup{
+			{ID: to.StringPtr(nsgID), Name: to.StringPtr("nsg"), Etag: to.StringPtr("etag2")},
+		}, nil),
+	)
+	nicWithVM := network.Interface{
+		ID:   to.StringPtr(nicID),
+		Name: to.StringPtr("nic1"),
+		InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+			VirtualMachine: &network.SubResource{ID: to.StringPtr(vmID)},
+		},
+	}
+	changedNIC := nicWithVM
+	nicWithVM.Etag = to.StringPtr("etag1")
+	changedNIC.Etag = to.StringPtr("etag2")
+	gomock.InOrder(
+		mockNICClient.EXPECT().List(gomock.Any(), "rg").Return([]network.Interface{nicWithVM}, nil),
+		mockNICClient.EXPECT().List(gomock.Any(), "rg").Return([]network.Interface{changedNIC}, nil),
+	)
+
+	az.lbCache.Set("lb1", "value")
+	az.lbListCache.Set("rg", "value")
+	az.nsgCache.Set("nsg", "value")
+	az.vmCache.Set("vm1", "value")
+
+	// The seeding poll must not invalidate anything.
+	az.runChangePolling()
+	assert.True(t, cacheHasKey(az.lbCache, "lb1"))
+	assert.True(t, cacheHasKey(az.lbListCache, "rg"))
+	assert.True(t, cacheHasKey(az.nsgCache, "nsg"))
+	assert.True(t, cacheHasKey(az.vmCache, "vm1"))
+
+	// The second poll sees the moved etags and drops the stale entries.
+	az.runChangePolling()
+	assert.False(t, cacheHasKey(az.lbCache, "lb1"))
+	assert.False(t, cacheHasKey(az.lbListCache, "rg"))
+	assert.False(t, cacheHasKey(az.nsgCache, "nsg"))
+	assert.False(t, cacheHasKey(az.vmCache, "vm1"))
+}
@@ -0,0 +1,99 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Outbound types, deciding how egress traffic of the cluster nodes leaves the
+// virtual network.
+const (
+	// outboundTypeLoadBalancer routes egress through the cluster load
+	// balancer, either via outbound rules or via default SNAT. This is the
+	// default.
+	outboundTypeLoadBalancer = "loadBalancer"
+	// outboundTypeNATGateway routes egress through a NAT gateway attached to
+	// the node subnet, managed outside this provider.
+	outboundTypeNATGateway = "natGateway"
+	// outboundTypeUserDefinedRouting leaves egress to the route table of the
+	// node subnet, e.g. via a firewall appliance.
+	outboundTypeUserDefinedRouting = "userDefinedRouting"
+)
+
+// udrOutboundEnabled returns true when egress of the cluster nodes is handled
+// by user defined routing, e.g. through a firewall appliance behind a route
+// table. The provider then keeps the cluster load balancer free of any
+// outbound configuration: no outbound rules, no outbound public IPs and no
+// SNAT on the load balancing rules.
+func (az *Cloud) udrOutboundEnabled() bool {
+	return strings.EqualFold(az.OutboundType, outboundTypeUserDefinedRouting)
+}
+
+// validateConfigEnums validates the enum-valued cloud config fields and their
+// compatibility with each other. All violations are collected into one
+// combined error, so a misconfiguration surfaces completely on the first
+// start instead of one field per fail-restart cycle.
+func validateConfigEnums(config *Config) error {
+	var violations []string
+
+	if config.LoadBalancerSku != "" &&
+		!strings.EqualFold(config.LoadBalancerSku, loadBalancerSkuBasic) &&
+		!strings.EqualFold(config.LoadBalancerSku, loadBalancerSkuStandard) {
+		violations = append(violations, fmt.Sprintf("loadBalancerSku %q is not supported, supported values are [%s %s]",
+			config.LoadBalancerSku, loadBalancerSkuBasic, loadBalancerSkuStandard))
+	}
+
+	if config.VMType != "" &&
+		!strings.EqualFold(config.VMType, vmTypeStandard) &&
+		!strings.EqualFold(config.VMType, vmTypeVMSS) {
+		violations = append(violations, fmt.Sprintf("vmType %q is not supported, supported values are [%s %s]",
+			config.VMType, vmTypeStandard, vmTypeVMSS))
+	}
+
+	if config.OutboundType != "" &&
+		!strings.EqualFold(config.OutboundType, outboundTypeLoadBalancer) &&
+		!strings.EqualFold(config.OutboundType, outboundTypeNATGateway) &&
+		!strings.EqualFold(config.OutboundType, outboundTypeUserDefinedRouting) {
+		violations = append(violations, fmt.Sprintf("outboundType %q is not supported, supported values are [%s %s %s]",
+			config.OutboundType, outboundTypeLoadBalancer, outboundTypeNATGateway, outboundTypeUserDefinedRouting))
+	}
+
+	// Compatibility checks between the enums and the rest of the config.
+	if config.OutboundType != "" && !strings.EqualFold(config.OutboundType, outboundTypeLoadBalancer) {
+		if !strings.EqualFold(config.LoadBalancerSku, loadBalancerSkuStandard) {
+			violations = append(violations, fmt.Sprintf("outboundType %q requires loadBalancerSku standard", config.OutboundType))
+		}
+		if config.ManagedOutboundIPCount != 0 || config.OutboundPublicIPPrefixID != "" {
+			violations = append(violations, fmt.Sprintf("managed outbound IPs can only be configured when outboundType is %s", outboundTypeLoadBalancer))
+		}
+		if config.DisableOutboundSNAT != nil && *config.DisableOutboundSNAT {
+			violations = append(violations, fmt.Sprintf("disableOutboundSNAT has no effect when outboundType is %q", config.OutboundType))
+		}
+	}
+	if config.IPv6SingleStack && strings.EqualFold(config.LoadBalancerSku, loadBalancerSkuBasic) {
+		violations = append(violations, "ipv6SingleStack requires loadBalancerSku standard, the basic load balancer does not support IPv6 frontends")
+	}
+
+	if len(violations) > 0 {
+		return fmt.Errorf("invalid cloud config: %s", strings.Join(violations, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateConfigEnums(t *testing.T) {
+	boolTrue := true
+	testCases := []struct {
+		desc           string
+		config         Config
+		expectedErrors []string
+	}{
+		{
+			desc:   "an empty config shall be valid",
+			config: Config{},
+		},
+		{
+			desc: "all enum values shall accept any case",
+			config: Config{
+				LoadBalancerSku: "Standard",
+				VMType:          "VMSS",
+				OutboundType:    "natgateway",
+			},
+		},
+		{
+			desc:           "an unknown load balancer sku shall be rejected",
+			config:         Config{LoadBalancerSku: "premium"},
+			expectedErrors: []string{`loadBalancerSku "premium" is not supported`},
+		},
+		{
+			desc:           "an unknown vm type shall be rejected",
+			config:         Config{VMType: "bare-metal"},
+			expectedErrors: []string{`vmType "bare-metal" is not supported`},
+		},
+		{
+			desc:           "an unknown outbound type shall be rejected",
+			config:         Config{OutboundType: "proxy"},
+			expectedErrors: []string{`outboundType "proxy" is not supported`},
+		},
+		{
+			desc:   "non load balancer outbound types shall require the standard sku",
+			config: Config{OutboundType: "userDefinedRouting"},
+			expectedErrors: []string{
+				`outboundType "userDefinedRouting" requires loadBalancerSku standard`,
+			},
+		},
+		{
+			desc: "managed outbound IPs shall conflict with a NAT gateway",
+			config: Config{
+				LoadBalancerSku:        "standard",
+				OutboundType:           "natGateway",
+				ManagedOutboundIPCount: 2,
+			},
+			expectedErrors: []string{"managed outbound IPs can only be configured when outboundType is loadBalancer"},
+		},
+		{
+			desc: "disableOutboundSNAT shall conflict with user defined routing",
+			config: Config{
+				LoadBalancerSku:     "standard",
+				OutboundType:        "userDefinedRouting",
+				DisableOutboundSNAT: &boolTrue,
+			},
+			expectedErrors: []string{"disableOutboundSNAT has no effect"},
+		},
+		{
+			desc: "IPv6 single stack shall conflict with the basic sku",
+			config: Config{
+				LoadBalancerSku: "basic",
+				IPv6SingleStack: true,
+			},
+			expectedErrors: []string{"ipv6SingleStack requires loadBalancerSku standard"},
+		},
+		{
+			desc: "all violations shall be combined into one error",
+			config: Config{
+				LoadBalancerSku: "premium",
+				VMType:          "bare-metal",
+				OutboundType:    "natGateway",
+			},
+			expectedErrors: []string{
+				`loadBalancerSku "premium" is not supported`,
+				`vmType "bare-metal" is not supported`,
+				`outboundType "natGateway" requires loadBalancerSku standard`,
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		err := validateConfigEnums(&test.config)
+		if len(test.expectedErrors) == 0 {
+			assert.NoError(t, err, test.desc)
+			continue
+		}
+		if assert.Error(t, err, test.desc) {
+			for _, expected := range test.expectedErrors {
+				assert.Contains(t, err.Error(), expected, test.desc)
+			}
+		}
+	}
+}
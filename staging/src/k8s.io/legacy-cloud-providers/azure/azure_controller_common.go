@@ -107,7 +107,7 @@ func (c *controllerCommon) getNodeVMSet(nodeName types.NodeName, crt azcache.Azu
 	}
 
 	// 3. If the node is managed by availability set, then return ss.availabilitySet.
-	managedByAS, err := ss.isNodeManagedByAvailabilitySet(mapNodeNameToVMName(nodeName), crt)
+	managedByAS, err := ss.isNodeManagedByAvailabilitySet(ss.getVMNameByNodeName(nodeName), crt)
 	if err != nil {
 		return nil, err
 	}
@@ -123,6 +123,10 @@ func (c *controllerCommon) getNodeVMSet(nodeName types.NodeName, crt azcache.Azu
 // AttachDisk attaches a vhd to vm. The vhd must exist, can be identified by diskName, diskURI.
 // return (lun, error)
 func (c *controllerCommon) AttachDisk(isManagedDisk bool, diskName, diskURI string, nodeName types.NodeName, cachingMode compute.CachingTypes) (int32, error) {
+	if err := c.cloud.checkReadOnly(nil, "AttachDisk"); err != nil {
+		return -1, err
+	}
+
 	diskEncryptionSetID := ""
 	writeAcceleratorEnabled := false
 
@@ -204,6 +208,10 @@ func (c *controllerCommon) AttachDisk(isManagedDisk bool, diskName, diskURI stri
 
 // DetachDisk detaches a disk from host. The vhd can be identified by diskName or diskURI.
 func (c *controllerCommon) DetachDisk(diskName, diskURI string, nodeName types.NodeName) error {
+	if err := c.cloud.checkReadOnly(nil, "DetachDisk"); err != nil {
+		return err
+	}
+
 	_, err := c.cloud.InstanceID(context.TODO(), nodeName)
 	if err != nil {
 		if err == cloudprovider.InstanceNotFound {
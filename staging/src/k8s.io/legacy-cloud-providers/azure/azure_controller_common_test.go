@@ -224,6 +224,9 @@ func TestCommonAttachDiskWithVMSS(t *testing.T) {
 				mockVMsClient.EXPECT().List(gomock.Any(), gomock.Any()).Return([]compute.VirtualMachine{}, nil).AnyTimes()
 			} else {
 				testCloud.DisableAvailabilitySetNodes = true
+
+				mockVMsClient := testCloud.VirtualMachinesClient.(*mockvmclient.MockInterface)
+				mockVMsClient.EXPECT().List(gomock.Any(), gomock.Any()).Return([]compute.VirtualMachine{}, nil).AnyTimes()
 			}
 			ss, err := newScaleSet(testCloud)
 			assert.Nil(t, err)
@@ -0,0 +1,228 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	azcache "k8s.io/legacy-cloud-providers/azure/cache"
+)
+
+// Verdicts of the security group evaluation for a service port.
+const (
+	// SecurityVerdictAllowed means an inbound rule allows the traffic.
+	SecurityVerdictAllowed = "Allowed"
+	// SecurityVerdictDenied means an inbound rule denies the traffic.
+	SecurityVerdictDenied = "Denied"
+	// SecurityVerdictNoMatchingRule means no inbound rule matches the port,
+	// so the NSG default rules decide.
+	SecurityVerdictNoMatchingRule = "NoMatchingRule"
+)
+
+// SecurityRuleMatch identifies the security rule deciding the verdict for a
+// service port.
+type SecurityRuleMatch struct {
+	RuleName string `json:"ruleName"`
+	Priority int32  `json:"priority"`
+	// ManagedByService tells whether the rule is one the provider manages
+	// for the diagnosed service. A deciding rule that is not managed by the
+	// service points at operator-created or leftover rules.
+	ManagedByService bool     `json:"managedByService"`
+	SourcePrefixes   []string `json:"sourcePrefixes,omitempty"`
+}
+
+// ServicePortDiagnosis is the effective security group conclusion for one
+// service port.
+type ServicePortDiagnosis struct {
+	Port        int32              `json:"port"`
+	Protocol    string             `json:"protocol"`
+	Verdict     string             `json:"verdict"`
+	MatchedRule *SecurityRuleMatch `json:"matchedRule,omitempty"`
+}
+
+// RouteDiagnosis describes the managed route directing pod traffic to the
+// node.
+type RouteDiagnosis struct {
+	Found           bool   `json:"found"`
+	RouteName       string `json:"routeName,omitempty"`
+	DestinationCIDR string `json:"destinationCIDR,omitempty"`
+	NextHopIP       string `json:"nextHopIP,omitempty"`
+}
+
+// ServiceConnectivityDiagnosis is the outcome of evaluating the
+// provider-managed security group and route table for a service and node.
+type ServiceConnectivityDiagnosis struct {
+	Service string                 `json:"service"`
+	Node    string                 `json:"node"`
+	Ports   []ServicePortDiagnosis `json:"ports"`
+	Route   RouteDiagnosis         `json:"route"`
+}
+
+// DiagnoseServiceConnectivity computes the effective allow/deny conclusion of
+// the cluster security group for every port of the service and looks up the
+// route of the node, answering "why can't I reach my LoadBalancer service"
+// without digging through the portal. Rules are evaluated in priority order
+// like the Azure fabric does; the deciding rule is reported together with
+// whether the provider manages it for the service.
+func (az *Cloud) DiagnoseServiceConnectivity(clusterName string, service *v1.Service, nodeName types.NodeName) (*ServiceConnectivityDiagnosis, error) {
+	sg, err := az.getSecurityGroup(azcache.CacheReadTypeDefault)
+	if err != nil {
+		return nil, err
+	}
+
+	diagnosis := &ServiceConnectivityDiagnosis{
+		Service: getServiceName(service),
+		Node:    string(nodeName),
+		Ports:   make([]ServicePortDiagnosis, 0, len(service.Spec.Ports)),
+	}
+
+	rules := []network.SecurityRule{}
+	if sg.SecurityGroupPropertiesFormat != nil && sg.SecurityRules != nil {
+		rules = append(rules, *sg.SecurityRules...)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return to.Int32(rules[i].Priority) < to.Int32(rules[j].Priority)
+	})
+
+	for _, port := range service.Spec.Ports {
+		portDiagnosis := ServicePortDiagnosis{
+			Port:     port.Port,
+			Protocol: string(port.Protocol),
+			Verdict:  SecurityVerdictNoMatchingRule,
+		}
+
+		for i := range rules {
+			rule := rules[i]
+			if rule.SecurityRulePropertiesFormat == nil || rule.Direction != network.SecurityRuleDirectionInbound {
+				continue
+			}
+			if !securityRuleProtocolMatches(rule.Protocol, port.Protocol) || !securityRuleDestinationMatches(&rule, port.Port) {
+				continue
+			}
+
+			portDiagnosis.Verdict = SecurityVerdictDenied
+			if rule.Access == network.SecurityRuleAccessAllow {
+				portDiagnosis.Verdict = SecurityVerdictAllowed
+			}
+			portDiagnosis.MatchedRule = &SecurityRuleMatch{
+				RuleName:         to.String(rule.Name),
+				Priority:         to.Int32(rule.Priority),
+				ManagedByService: az.serviceOwnsRule(service, to.String(rule.Name)),
+				SourcePrefixes:   securityRuleSourcePrefixes(&rule),
+			}
+			break
+		}
+
+		diagnosis.Ports = append(diagnosis.Ports, portDiagnosis)
+	}
+
+	routeTable, existsRouteTable, err := az.getRouteTable(azcache.CacheReadTypeDefault)
+	if err != nil {
+		return nil, err
+	}
+	if existsRouteTable && routeTable.RouteTablePropertiesFormat != nil && routeTable.Routes != nil {
+		prefix := az.sharedResourcePrefix(clusterName)
+		for _, route := range *routeTable.Routes {
+			routeName := strings.TrimPrefix(to.String(route.Name), prefix)
+			if mapRouteNameToNodeName(az.ipv6DualStackEnabled, routeName) != nodeName {
+				continue
+			}
+
+			diagnosis.Route = RouteDiagnosis{
+				Found:     true,
+				RouteName: to.String(route.Name),
+			}
+			if route.RoutePropertiesFormat != nil {
+				diagnosis.Route.DestinationCIDR = to.String(route.AddressPrefix)
+				diagnosis.Route.NextHopIP = to.String(route.NextHopIPAddress)
+			}
+			break
+		}
+	}
+
+	return diagnosis, nil
+}
+
+// securityRuleProtocolMatches reports whether the rule protocol covers the
+// service port protocol.
+func securityRuleProtocolMatches(ruleProtocol network.SecurityRuleProtocol, protocol v1.Protocol) bool {
+	if ruleProtocol == network.SecurityRuleProtocolAsterisk {
+		return true
+	}
+	return strings.EqualFold(string(ruleProtocol), string(protocol))
+}
+
+// securityRuleDestinationMatches reports whether the rule destination port
+// ranges cover the port.
+func securityRuleDestinationMatches(rule *network.SecurityRule, port int32) bool {
+	if portRangeMatches(to.String(rule.DestinationPortRange), port) {
+		return true
+	}
+	if rule.DestinationPortRanges != nil {
+		for _, portRange := range *rule.DestinationPortRanges {
+			if portRangeMatches(portRange, port) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// portRangeMatches reports whether the port range ("*", "80" or "80-90")
+// covers the port.
+func portRangeMatches(portRange string, port int32) bool {
+	if portRange == "*" {
+		return true
+	}
+	if portRange == "" {
+		return false
+	}
+
+	bounds := strings.SplitN(portRange, "-", 2)
+	low, err := strconv.ParseInt(bounds[0], 10, 32)
+	if err != nil {
+		return false
+	}
+	high := low
+	if len(bounds) == 2 {
+		if high, err = strconv.ParseInt(bounds[1], 10, 32); err != nil {
+			return false
+		}
+	}
+	return int64(port) >= low && int64(port) <= high
+}
+
+// securityRuleSourcePrefixes collects the source address prefixes of the rule.
+func securityRuleSourcePrefixes(rule *network.SecurityRule) []string {
+	prefixes := []string{}
+	if prefix := to.String(rule.SourceAddressPrefix); prefix != "" {
+		prefixes = append(prefixes, prefix)
+	}
+	if rule.SourceAddressPrefixes != nil {
+		prefixes = append(prefixes, *rule.SourceAddressPrefixes...)
+	}
+	return prefixes
+}
@@ -0,0 +1,193 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestPortRangeMatches(t *testing.T) {
+	testcases := []struct {
+		portRange string
+		port      int32
+		expected  bool
+	}{
+		{portRange: "*", port: 80, expected: true},
+		{portRange: "80", port: 80, expected: true},
+		{portRange: "80", port: 81, expected: false},
+		{portRange: "80-90", port: 85, expected: true},
+		{portRange: "80-90", port: 91, expected: false},
+		{portRange: "", port: 80, expected: false},
+		{portRange: "invalid", port: 80, expected: false},
+	}
+
+	for _, test := range testcases {
+		assert.Equal(t, test.expected, portRangeMatches(test.portRange, test.port), "range %q port %d", test.portRange, test.port)
+	}
+}
+
+func TestDiagnoseServiceConnectivity(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	ruleName := "atest-TCP-80-Internet"
+
+	testcases := []struct {
+		description     string
+		rules           []network.SecurityRule
+		expectedVerdict string
+		expectedRule    string
+	}{
+		{
+			description: "an allow rule for the port yields Allowed",
+			rules: []network.SecurityRule{
+				{
+					Name: to.StringPtr(ruleName),
+					SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+						Protocol:             network.SecurityRuleProtocolTCP,
+						DestinationPortRange: to.StringPtr("80"),
+						SourceAddressPrefix:  to.StringPtr("Internet"),
+						Access:               network.SecurityRuleAccessAllow,
+						Direction:            network.SecurityRuleDirectionInbound,
+						Priority:             to.Int32Ptr(500),
+					},
+				},
+			},
+			expectedVerdict: SecurityVerdictAllowed,
+			expectedRule:    ruleName,
+		},
+		{
+			description: "a deny rule at lower priority wins over an allow rule",
+			rules: []network.SecurityRule{
+				{
+					Name: to.StringPtr(ruleName),
+					SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+						Protocol:             network.SecurityRuleProtocolTCP,
+						DestinationPortRange: to.StringPtr("80"),
+						Access:               network.SecurityRuleAccessAllow,
+						Direction:            network.SecurityRuleDirectionInbound,
+						Priority:             to.Int32Ptr(500),
+					},
+				},
+				{
+					Name: to.StringPtr("deny-all"),
+					SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+						Protocol:             network.SecurityRuleProtocolAsterisk,
+						DestinationPortRange: to.StringPtr("*"),
+						Access:               network.SecurityRuleAccessDeny,
+						Direction:            network.SecurityRuleDirectionInbound,
+						Priority:             to.Int32Ptr(100),
+					},
+				},
+			},
+			expectedVerdict: SecurityVerdictDenied,
+			expectedRule:    "deny-all",
+		},
+		{
+			description: "rules for other ports or directions do not match",
+			rules: []network.SecurityRule{
+				{
+					Name: to.StringPtr("other-port"),
+					SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+						Protocol:             network.SecurityRuleProtocolTCP,
+						DestinationPortRange: to.StringPtr("443"),
+						Access:               network.SecurityRuleAccessAllow,
+						Direction:            network.SecurityRuleDirectionInbound,
+						Priority:             to.Int32Ptr(500),
+					},
+				},
+				{
+					Name: to.StringPtr("outbound"),
+					SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+						Protocol:             network.SecurityRuleProtocolTCP,
+						DestinationPortRange: to.StringPtr("80"),
+						Access:               network.SecurityRuleAccessAllow,
+						Direction:            network.SecurityRuleDirectionOutbound,
+						Priority:             to.Int32Ptr(501),
+					},
+				},
+			},
+			expectedVerdict: SecurityVerdictNoMatchingRule,
+		},
+	}
+
+	for _, test := range testcases {
+		az := GetTestCloud(ctrl)
+		sg := network.SecurityGroup{
+			Name: to.StringPtr(az.SecurityGroupName),
+			SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+				SecurityRules: &test.rules,
+			},
+		}
+		az.nsgCache.Set(az.SecurityGroupName, &sg)
+		rt := network.RouteTable{
+			Name: to.StringPtr(az.RouteTableName),
+			RouteTablePropertiesFormat: &network.RouteTablePropertiesFormat{
+				Routes: &[]network.Route{
+					{
+						Name: to.StringPtr("node1"),
+						RoutePropertiesFormat: &network.RoutePropertiesFormat{
+							AddressPrefix:    to.StringPtr("10.244.0.0/24"),
+							NextHopIPAddress: to.StringPtr("10.240.0.4"),
+						},
+					},
+				},
+			},
+		}
+		az.rtCache.Set(az.RouteTableName, &rt)
+
+		diagnosis, err := az.DiagnoseServiceConnectivity(testClusterName, &svc, types.NodeName("node1"))
+		assert.NoError(t, err, test.description)
+		assert.Len(t, diagnosis.Ports, 1, test.description)
+		assert.Equal(t, test.expectedVerdict, diagnosis.Ports[0].Verdict, test.description)
+		if test.expectedRule != "" {
+			assert.NotNil(t, diagnosis.Ports[0].MatchedRule, test.description)
+			assert.Equal(t, test.expectedRule, diagnosis.Ports[0].MatchedRule.RuleName, test.description)
+		} else {
+			assert.Nil(t, diagnosis.Ports[0].MatchedRule, test.description)
+		}
+
+		assert.True(t, diagnosis.Route.Found, test.description)
+		assert.Equal(t, "10.244.0.0/24", diagnosis.Route.DestinationCIDR, test.description)
+		assert.Equal(t, "10.240.0.4", diagnosis.Route.NextHopIP, test.description)
+	}
+}
+
+func TestDiagnoseServiceConnectivityRouteNotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	az.nsgCache.Set(az.SecurityGroupName, &network.SecurityGroup{Name: to.StringPtr(az.SecurityGroupName)})
+	az.rtCache.Set(az.RouteTableName, &network.RouteTable{Name: to.StringPtr(az.RouteTableName)})
+
+	diagnosis, err := az.DiagnoseServiceConnectivity(testClusterName, &svc, types.NodeName("node1"))
+	assert.NoError(t, err)
+	assert.False(t, diagnosis.Route.Found)
+}
@@ -0,0 +1,174 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// loadBalancerDriftEventReason is the reason of the event emitted when drift
+// is detected on the load balancer of a service.
+const loadBalancerDriftEventReason = "LoadBalancerDrift"
+
+// recordClusterName remembers the cluster name passed to the load balancer
+// calls so the drift detector can render the desired state on its own.
+func (az *Cloud) recordClusterName(clusterName string) {
+	az.driftDetectionLock.Lock()
+	defer az.driftDetectionLock.Unlock()
+	az.driftClusterName = clusterName
+}
+
+func (az *Cloud) getRecordedClusterName() string {
+	az.driftDetectionLock.Lock()
+	defer az.driftDetectionLock.Unlock()
+	return az.driftClusterName
+}
+
+// runDriftDetection compares the load balancer rules and probes of every
+// LoadBalancer service against the rendered desired state and repairs
+// differences introduced out-of-band, e.g. a probe edited in the portal that
+// silently breaks traffic. In audit-only mode drift is only reported through
+// events and logs. Repairing re-runs the full service reconcile, so security
+// group and public IP drift is corrected as well.
+func (az *Cloud) runDriftDetection() {
+	clusterName := az.getRecordedClusterName()
+	if clusterName == "" || az.KubeClient == nil {
+		// Until a load balancer call has been observed the desired state
+		// cannot be rendered.
+		return
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	services, err := az.KubeClient.CoreV1().Services("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		klog.Errorf("runDriftDetection: failed to list services: %v", err)
+		return
+	}
+
+	var nodes []*v1.Node
+	if !az.DriftDetectionAuditOnly {
+		nodeList, err := az.KubeClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			klog.Errorf("runDriftDetection: failed to list nodes: %v", err)
+			return
+		}
+		for i := range nodeList.Items {
+			nodes = append(nodes, &nodeList.Items[i])
+		}
+	}
+
+	for i := range services.Items {
+		service := &services.Items[i]
+		if service.Spec.Type != v1.ServiceTypeLoadBalancer || service.DeletionTimestamp != nil {
+			continue
+		}
+
+		drifts, err := az.detectServiceDrift(clusterName, service)
+		if err != nil {
+			klog.Warningf("runDriftDetection(%s): %v", getServiceName(service), err)
+			continue
+		}
+		if len(drifts) == 0 {
+			continue
+		}
+
+		message := strings.Join(drifts, "; ")
+		klog.V(2).Infof("runDriftDetection(%s): detected drift: %s", getServiceName(service), message)
+		az.Event(service, v1.EventTypeWarning, loadBalancerDriftEventReason, message)
+		if az.DriftDetectionAuditOnly {
+			continue
+		}
+
+		if _, err := az.EnsureLoadBalancer(ctx, clusterName, service, nodes); err != nil {
+			klog.Errorf("runDriftDetection(%s): repair failed: %v", getServiceName(service), err)
+		}
+	}
+}
+
+// detectServiceDrift returns a description of every expected load balancer
+// rule or probe of the service that is missing or was modified out-of-band.
+func (az *Cloud) detectServiceDrift(clusterName string, service *v1.Service) ([]string, error) {
+	lb, _, exists, err := az.getServiceLoadBalancer(service, clusterName, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	if !exists || lb.LoadBalancerPropertiesFormat == nil {
+		return []string{"load balancer is missing"}, nil
+	}
+
+	lbName := to.String(lb.Name)
+	lbResourceGroup := az.getLoadBalancerResourceGroup()
+	lbFrontendIPConfigName := az.getFrontendIPConfigName(service)
+	foundFrontend := false
+	if lb.FrontendIPConfigurations != nil {
+		for _, fip := range *lb.FrontendIPConfigurations {
+			if strings.EqualFold(to.String(fip.Name), lbFrontendIPConfigName) {
+				foundFrontend = true
+				break
+			}
+		}
+	}
+	if !foundFrontend {
+		return []string{fmt.Sprintf("frontend IP configuration %s is missing", lbFrontendIPConfigName)}, nil
+	}
+
+	lbFrontendIPConfigID := az.getFrontendIPConfigID(lbName, lbResourceGroup, lbFrontendIPConfigName)
+	lbBackendPoolID := az.getBackendPoolID(lbName, lbResourceGroup, az.getBackendPoolName(clusterName, service))
+	lbIdleTimeout, err := getIdleTimeout(service)
+	if err != nil {
+		return nil, err
+	}
+
+	expectedProbes, expectedRules, err := az.reconcileLoadBalancerRule(service, true, lbFrontendIPConfigID, lbBackendPoolID, lbName, lbIdleTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	var drifts []string
+	var existingProbes []network.Probe
+	if lb.Probes != nil {
+		existingProbes = *lb.Probes
+	}
+	for _, expectedProbe := range expectedProbes {
+		if !findProbe(existingProbes, expectedProbe) {
+			drifts = append(drifts, fmt.Sprintf("probe %s is missing or modified", to.String(expectedProbe.Name)))
+		}
+	}
+
+	var existingRules []network.LoadBalancingRule
+	if lb.LoadBalancingRules != nil {
+		existingRules = *lb.LoadBalancingRules
+	}
+	for _, expectedRule := range expectedRules {
+		if !findRule(existingRules, expectedRule, true) {
+			drifts = append(drifts, fmt.Sprintf("rule %s is missing or modified", to.String(expectedRule.Name)))
+		}
+	}
+
+	return drifts, nil
+}
@@ -0,0 +1,99 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/legacy-cloud-providers/azure/clients/loadbalancerclient/mockloadbalancerclient"
+)
+
+// getDriftTestLoadBalancer returns a load balancer fixture whose probes and
+// rules exactly match the rendered desired state of the service.
+func getDriftTestLoadBalancer(t *testing.T, az *Cloud, service *v1.Service) network.LoadBalancer {
+	fipID := az.getFrontendIPConfigID(testClusterName, "rg", "aservice1")
+	poolID := az.getBackendPoolID(testClusterName, "rg", testClusterName)
+	probes, rules, err := az.reconcileLoadBalancerRule(service, true, fipID, poolID, testClusterName, nil)
+	assert.NoError(t, err)
+
+	return network.LoadBalancer{
+		Name: to.StringPtr(testClusterName),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+				{
+					Name: to.StringPtr("aservice1"),
+					FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+						PublicIPAddress: &network.PublicIPAddress{ID: to.StringPtr("testCluster-aservice1")},
+					},
+				},
+			},
+			Probes:             &probes,
+			LoadBalancingRules: &rules,
+		},
+	}
+}
+
+func TestDetectServiceDrift(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Without drift nothing is reported.
+	az := GetTestCloud(ctrl)
+	setMockPublicIPs(az, ctrl, 1)
+	service := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	lb := getDriftTestLoadBalancer(t, az, &service)
+	mockLBsClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBsClient.EXPECT().List(gomock.Any(), "rg").Return([]network.LoadBalancer{lb}, nil)
+
+	drifts, err := az.detectServiceDrift(testClusterName, &service)
+	assert.NoError(t, err)
+	assert.Empty(t, drifts)
+
+	// A console-edited probe port and a dropped rule are both reported.
+	az = GetTestCloud(ctrl)
+	setMockPublicIPs(az, ctrl, 1)
+	lb = getDriftTestLoadBalancer(t, az, &service)
+	(*lb.Probes)[0].Port = to.Int32Ptr(4242)
+	lb.LoadBalancingRules = &[]network.LoadBalancingRule{}
+	mockLBsClient = az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBsClient.EXPECT().List(gomock.Any(), "rg").Return([]network.LoadBalancer{lb}, nil)
+
+	drifts, err = az.detectServiceDrift(testClusterName, &service)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"probe aservice1-TCP-80 is missing or modified",
+		"rule aservice1-TCP-80 is missing or modified",
+	}, drifts)
+
+	// A missing load balancer is drift as well.
+	az = GetTestCloud(ctrl)
+	setMockPublicIPs(az, ctrl, 1)
+	mockLBsClient = az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBsClient.EXPECT().List(gomock.Any(), "rg").Return(nil, nil)
+
+	drifts, err = az.detectServiceDrift(testClusterName, &service)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"load balancer is missing"}, drifts)
+}
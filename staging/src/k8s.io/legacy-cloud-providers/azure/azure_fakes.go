@@ -20,6 +20,7 @@ package azure
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/golang/mock/gomock"
 
@@ -29,12 +30,15 @@ import (
 	"k8s.io/legacy-cloud-providers/azure/clients/diskclient/mockdiskclient"
 	"k8s.io/legacy-cloud-providers/azure/clients/interfaceclient/mockinterfaceclient"
 	"k8s.io/legacy-cloud-providers/azure/clients/loadbalancerclient/mockloadbalancerclient"
+	"k8s.io/legacy-cloud-providers/azure/clients/monitorclient/mockmonitorclient"
+	"k8s.io/legacy-cloud-providers/azure/clients/networkwatcherclient/mocknetworkwatcherclient"
 	"k8s.io/legacy-cloud-providers/azure/clients/publicipclient/mockpublicipclient"
 	"k8s.io/legacy-cloud-providers/azure/clients/routeclient/mockrouteclient"
 	"k8s.io/legacy-cloud-providers/azure/clients/routetableclient/mockroutetableclient"
 	"k8s.io/legacy-cloud-providers/azure/clients/securitygroupclient/mocksecuritygroupclient"
 	"k8s.io/legacy-cloud-providers/azure/clients/subnetclient/mocksubnetclient"
 	"k8s.io/legacy-cloud-providers/azure/clients/vmclient/mockvmclient"
+	"k8s.io/legacy-cloud-providers/azure/clients/vmsizeclient/mockvmsizeclient"
 	"k8s.io/legacy-cloud-providers/azure/clients/vmssclient/mockvmssclient"
 	"k8s.io/legacy-cloud-providers/azure/clients/vmssvmclient/mockvmssvmclient"
 )
@@ -68,8 +72,13 @@ func GetTestCloud(ctrl *gomock.Controller) (az *Cloud) {
 		nodeZones:          map[string]sets.String{},
 		nodeInformerSynced: func() bool { return true },
 		nodeResourceGroups: map[string]string{},
+		nodeVMNames:        map[string]string{},
 		unmanagedNodes:     sets.NewString(),
 		routeCIDRs:         map[string]string{},
+		nicUpdateLock:      newLockMap(),
+		lockedScopes:       map[string]time.Time{},
+		writeBudget:        newWriteBudget(0),
+		outageBreaker:      newARMOutageBreaker(0, 0),
 		eventRecorder:      &record.FakeRecorder{},
 	}
 	az.DisksClient = mockdiskclient.NewMockInterface(ctrl)
@@ -83,11 +92,19 @@ func GetTestCloud(ctrl *gomock.Controller) (az *Cloud) {
 	az.VirtualMachineScaleSetsClient = mockvmssclient.NewMockInterface(ctrl)
 	az.VirtualMachineScaleSetVMsClient = mockvmssvmclient.NewMockInterface(ctrl)
 	az.VirtualMachinesClient = mockvmclient.NewMockInterface(ctrl)
+	az.VirtualMachineSizesClient = mockvmsizeclient.NewMockInterface(ctrl)
+	az.MonitorClient = mockmonitorclient.NewMockInterface(ctrl)
+	az.NetworkWatcherClient = mocknetworkwatcherclient.NewMockInterface(ctrl)
 	az.VMSet = newAvailabilitySet(az)
 	az.vmCache, _ = az.newVMCache()
 	az.lbCache, _ = az.newLBCache()
+	az.lbListCache, _ = az.newLBListCache()
 	az.nsgCache, _ = az.newNSGCache()
 	az.rtCache, _ = az.newRouteTableCache()
+	az.skuCapabilityCache, _ = az.newSkuCapabilityCache()
+	az.tagsUpdater = newDelayedTagsUpdater(az, tagsUpdateInterval)
+	az.nsgUpdater = newDelayedNsgUpdater(az, 10*time.Millisecond)
+	go az.nsgUpdater.run()
 
 	common := &controllerCommon{cloud: az, resourceGroup: "rg", location: "westus"}
 	az.controllerCommon = common
@@ -0,0 +1,54 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"k8s.io/component-base/featuregate"
+	"k8s.io/klog/v2"
+)
+
+// FeatureGates exposes the evaluated feature gates of the consuming binary.
+// featuregate.FeatureGate satisfies it, so binaries pass their gate instance
+// directly instead of this package keeping local copies of feature names that
+// drift from upstream.
+type FeatureGates interface {
+	Enabled(key featuregate.Feature) bool
+}
+
+// SetFeatureGates injects the evaluated feature gates of the consuming binary
+// and re-derives the gate-dependent provider settings. It must be called
+// before the cloud provider starts reconciling.
+func (az *Cloud) SetFeatureGates(gates FeatureGates) {
+	if gates == nil {
+		return
+	}
+	az.featureGates = gates
+	az.ipv6DualStackEnabled = gates.Enabled(IPv6DualStack)
+	klog.V(2).Infof("SetFeatureGates: ipv6DualStackEnabled=%v", az.ipv6DualStackEnabled)
+}
+
+// featureEnabled reports whether the named feature gate is enabled. It is the
+// query point for gates the provider reacts to; features default to disabled
+// when the binary did not inject its gates.
+func (az *Cloud) featureEnabled(feature featuregate.Feature) bool {
+	if az.featureGates == nil {
+		return false
+	}
+	return az.featureGates.Enabled(feature)
+}
@@ -0,0 +1,54 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/component-base/featuregate"
+)
+
+// fakeFeatureGates implements FeatureGates from a fixed map.
+type fakeFeatureGates map[featuregate.Feature]bool
+
+func (f fakeFeatureGates) Enabled(key featuregate.Feature) bool {
+	return f[key]
+}
+
+func TestSetFeatureGates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+
+	// Features default to disabled until the binary injects its gates.
+	assert.False(t, az.featureEnabled(IPv6DualStack))
+	assert.False(t, az.ipv6DualStackEnabled)
+
+	az.SetFeatureGates(fakeFeatureGates{IPv6DualStack: true})
+	assert.True(t, az.featureEnabled(IPv6DualStack))
+	assert.True(t, az.ipv6DualStackEnabled)
+	assert.False(t, az.featureEnabled(featuregate.Feature("SomeOtherFeature")))
+
+	// A nil injection keeps the current gates.
+	az.SetFeatureGates(nil)
+	assert.True(t, az.featureEnabled(IPv6DualStack))
+}
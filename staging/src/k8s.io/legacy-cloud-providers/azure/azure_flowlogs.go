@@ -0,0 +1,157 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	"k8s.io/klog/v2"
+	azcache "k8s.io/legacy-cloud-providers/azure/cache"
+)
+
+const (
+	// defaultNetworkWatcherResourceGroup is the resource group Azure creates
+	// the regional network watchers in when they are auto-provisioned.
+	defaultNetworkWatcherResourceGroup = "NetworkWatcherRG"
+
+	// defaultNSGFlowLogRetentionDays is the flow log retention applied when
+	// no retention is configured.
+	defaultNSGFlowLogRetentionDays = 30
+)
+
+// ensureNSGFlowLogs enables flow logging on the cluster NSG with the
+// configured storage account, retention and optional traffic analytics
+// workspace, so that flow data for provider-managed rules is collected
+// without manual setup. The configuration is only written when it differs
+// from what the network watcher reports.
+func (az *Cloud) ensureNSGFlowLogs() error {
+	nsg, err := az.getSecurityGroup(azcache.CacheReadTypeDefault)
+	if err != nil {
+		return err
+	}
+	nsgID := to.String(nsg.ID)
+	if nsgID == "" {
+		return fmt.Errorf("ensureNSGFlowLogs: security group %s has no ID", az.SecurityGroupName)
+	}
+
+	watcherResourceGroup, watcherName := az.networkWatcher()
+	desired := az.desiredFlowLogConfiguration(nsgID)
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	current, rerr := az.NetworkWatcherClient.GetFlowLogStatus(ctx, watcherResourceGroup, watcherName, nsgID)
+	if rerr != nil {
+		return rerr.Error()
+	}
+	if flowLogConfigurationMatches(current, desired) {
+		klog.V(4).Infof("ensureNSGFlowLogs: flow logs of security group %s are already configured", az.SecurityGroupName)
+		return nil
+	}
+
+	klog.V(2).Infof("ensureNSGFlowLogs: configuring flow logs of security group %s to storage account %s", az.SecurityGroupName, az.NSGFlowLogStorageAccountID)
+	setCtx, setCancel := getContextWithCancel()
+	defer setCancel()
+	if rerr := az.NetworkWatcherClient.SetFlowLogConfiguration(setCtx, watcherResourceGroup, watcherName, desired); rerr != nil {
+		return rerr.Error()
+	}
+
+	return nil
+}
+
+// networkWatcher returns the resource group and name of the network watcher
+// covering the cluster region, defaulting to the names Azure uses when
+// auto-provisioning regional watchers.
+func (az *Cloud) networkWatcher() (string, string) {
+	resourceGroup := az.NSGFlowLogNetworkWatcherResourceGroup
+	if resourceGroup == "" {
+		resourceGroup = defaultNetworkWatcherResourceGroup
+	}
+	name := az.NSGFlowLogNetworkWatcherName
+	if name == "" {
+		name = fmt.Sprintf("NetworkWatcher_%s", az.Location)
+	}
+	return resourceGroup, name
+}
+
+// desiredFlowLogConfiguration builds the flow log configuration of the target
+// NSG from the cloud configuration.
+func (az *Cloud) desiredFlowLogConfiguration(nsgID string) network.FlowLogInformation {
+	retentionDays := az.NSGFlowLogRetentionDays
+	if retentionDays == 0 {
+		retentionDays = defaultNSGFlowLogRetentionDays
+	}
+
+	configuration := network.FlowLogInformation{
+		TargetResourceID: to.StringPtr(nsgID),
+		FlowLogProperties: &network.FlowLogProperties{
+			Enabled:   to.BoolPtr(true),
+			StorageID: to.StringPtr(az.NSGFlowLogStorageAccountID),
+			RetentionPolicy: &network.RetentionPolicyParameters{
+				Days:    to.Int32Ptr(int32(retentionDays)),
+				Enabled: to.BoolPtr(true),
+			},
+		},
+	}
+	if az.NSGFlowLogTrafficAnalyticsWorkspaceResourceID != "" {
+		configuration.FlowAnalyticsConfiguration = &network.TrafficAnalyticsProperties{
+			NetworkWatcherFlowAnalyticsConfiguration: &network.TrafficAnalyticsConfigurationProperties{
+				Enabled:             to.BoolPtr(true),
+				WorkspaceRegion:     to.StringPtr(az.Location),
+				WorkspaceResourceID: to.StringPtr(az.NSGFlowLogTrafficAnalyticsWorkspaceResourceID),
+			},
+		}
+	}
+	return configuration
+}
+
+// flowLogConfigurationMatches reports whether the reported flow log status
+// already provides what the desired configuration asks for.
+func flowLogConfigurationMatches(current, desired network.FlowLogInformation) bool {
+	if current.FlowLogProperties == nil || desired.FlowLogProperties == nil {
+		return false
+	}
+	if to.Bool(current.Enabled) != to.Bool(desired.Enabled) ||
+		to.String(current.StorageID) != to.String(desired.StorageID) {
+		return false
+	}
+
+	currentDays, desiredDays := int32(0), int32(0)
+	if current.RetentionPolicy != nil {
+		currentDays = to.Int32(current.RetentionPolicy.Days)
+	}
+	if desired.RetentionPolicy != nil {
+		desiredDays = to.Int32(desired.RetentionPolicy.Days)
+	}
+	if currentDays != desiredDays {
+		return false
+	}
+
+	return trafficAnalyticsEnabled(current) == trafficAnalyticsEnabled(desired)
+}
+
+// trafficAnalyticsEnabled reports whether the flow log configuration has
+// traffic analytics turned on.
+func trafficAnalyticsEnabled(configuration network.FlowLogInformation) bool {
+	return configuration.FlowAnalyticsConfiguration != nil &&
+		configuration.FlowAnalyticsConfiguration.NetworkWatcherFlowAnalyticsConfiguration != nil &&
+		to.Bool(configuration.FlowAnalyticsConfiguration.NetworkWatcherFlowAnalyticsConfiguration.Enabled)
+}
@@ -0,0 +1,112 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/legacy-cloud-providers/azure/clients/networkwatcherclient/mocknetworkwatcherclient"
+	"k8s.io/legacy-cloud-providers/azure/retry"
+)
+
+func TestEnsureNSGFlowLogs(t *testing.T) {
+	nsgID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/networkSecurityGroups/nsg"
+	storageID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/flowlogs"
+
+	enabledStatus := network.FlowLogInformation{
+		TargetResourceID: to.StringPtr(nsgID),
+		FlowLogProperties: &network.FlowLogProperties{
+			Enabled:         to.BoolPtr(true),
+			StorageID:       to.StringPtr(storageID),
+			RetentionPolicy: &network.RetentionPolicyParameters{Days: to.Int32Ptr(30), Enabled: to.BoolPtr(true)},
+		},
+	}
+
+	testCases := []struct {
+		description     string
+		currentStatus   network.FlowLogInformation
+		expectConfigure bool
+	}{
+		{
+			description:     "flow logs should be configured when disabled",
+			currentStatus:   network.FlowLogInformation{FlowLogProperties: &network.FlowLogProperties{Enabled: to.BoolPtr(false)}},
+			expectConfigure: true,
+		},
+		{
+			description:     "flow logs pointing at another storage account should be reconfigured",
+			currentStatus:   network.FlowLogInformation{FlowLogProperties: &network.FlowLogProperties{Enabled: to.BoolPtr(true), StorageID: to.StringPtr("other")}},
+			expectConfigure: true,
+		},
+		{
+			description:     "matching flow log configuration should be left alone",
+			currentStatus:   enabledStatus,
+			expectConfigure: false,
+		},
+	}
+
+	for _, test := range testCases {
+		ctrl := gomock.NewController(t)
+		az := GetTestCloud(ctrl)
+		az.EnableNSGFlowLogs = true
+		az.NSGFlowLogStorageAccountID = storageID
+		az.nsgCache.Set(az.SecurityGroupName, &network.SecurityGroup{
+			Name: to.StringPtr(az.SecurityGroupName),
+			ID:   to.StringPtr(nsgID),
+		})
+
+		mockWatcherClient := az.NetworkWatcherClient.(*mocknetworkwatcherclient.MockInterface)
+		mockWatcherClient.EXPECT().GetFlowLogStatus(gomock.Any(), "NetworkWatcherRG", "NetworkWatcher_westus", nsgID).Return(test.currentStatus, nil).Times(1)
+		if test.expectConfigure {
+			mockWatcherClient.EXPECT().SetFlowLogConfiguration(gomock.Any(), "NetworkWatcherRG", "NetworkWatcher_westus", gomock.Any()).DoAndReturn(
+				func(_ interface{}, _, _ string, parameters network.FlowLogInformation) *retry.Error {
+					assert.Equal(t, nsgID, to.String(parameters.TargetResourceID), test.description)
+					assert.Equal(t, storageID, to.String(parameters.StorageID), test.description)
+					assert.True(t, to.Bool(parameters.Enabled), test.description)
+					assert.Equal(t, int32(30), to.Int32(parameters.RetentionPolicy.Days), test.description)
+					return nil
+				}).Times(1)
+		}
+
+		err := az.ensureNSGFlowLogs()
+		assert.NoError(t, err, test.description)
+		ctrl.Finish()
+	}
+}
+
+func TestDesiredFlowLogConfigurationTrafficAnalytics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.NSGFlowLogStorageAccountID = "storageID"
+	az.NSGFlowLogRetentionDays = 7
+	az.NSGFlowLogTrafficAnalyticsWorkspaceResourceID = "workspaceID"
+
+	configuration := az.desiredFlowLogConfiguration("nsgID")
+	assert.Equal(t, int32(7), to.Int32(configuration.RetentionPolicy.Days))
+	assert.True(t, trafficAnalyticsEnabled(configuration))
+	analytics := configuration.FlowAnalyticsConfiguration.NetworkWatcherFlowAnalyticsConfiguration
+	assert.Equal(t, "workspaceID", to.String(analytics.WorkspaceResourceID))
+	assert.Equal(t, az.Location, to.String(analytics.WorkspaceRegion))
+}
@@ -0,0 +1,116 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/legacy-cloud-providers/azure/clients/securitygroupclient/mocksecuritygroupclient"
+)
+
+var updateGolden = flag.Bool("update-golden", false, "update golden payload files instead of comparing against them")
+
+// assertGoldenPayload marshals payload and compares it against the golden
+// file, or rewrites the golden file when -update-golden is set. The golden
+// files pin the rendered ARM payloads so that accidental ordering or
+// serialization changes show up as diffs.
+func assertGoldenPayload(t *testing.T, name string, payload interface{}) {
+	rendered, err := json.MarshalIndent(payload, "", "  ")
+	assert.NoError(t, err)
+	rendered = append(rendered, '\n')
+
+	goldenPath := filepath.Join("testdata", name)
+	if *updateGolden {
+		assert.NoError(t, ioutil.WriteFile(goldenPath, rendered, 0644))
+		return
+	}
+
+	golden, err := ioutil.ReadFile(goldenPath)
+	assert.NoError(t, err, "missing golden file, run go test -run Golden -args -update-golden")
+	assert.Equal(t, string(golden), string(rendered), "rendered %s payload changed, verify the diff and update the golden file", name)
+}
+
+func TestSecurityRulesPayloadGolden(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Pin the generation timestamp in the rule descriptions so the rendered
+	// payload stays reproducible.
+	securityRuleTimeNow = func() time.Time { return time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC) }
+	defer func() { securityRuleTimeNow = time.Now }()
+
+	az := GetTestCloud(ctrl)
+	service := getTestService("service1", v1.ProtocolTCP, map[string]string{
+		ServiceAnnotationAllowedServiceTag: "AzureCloud",
+	}, false, 80, 443)
+	service.Spec.LoadBalancerSourceRanges = []string{"192.168.0.0/16", "10.0.0.0/8"}
+
+	sg := network.SecurityGroup{
+		Name:                          to.StringPtr("nsg"),
+		SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{},
+	}
+	mockSGsClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+	mockSGsClient.EXPECT().Get(gomock.Any(), "rg", "nsg", gomock.Any()).Return(sg, nil).AnyTimes()
+	mockSGsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "nsg", gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	assert.Nil(t, az.SecurityGroupsClient.CreateOrUpdate(context.TODO(), "rg", "nsg", sg, ""))
+
+	first, err := az.reconcileSecurityGroup("testCluster", &service, to.StringPtr("1.2.3.4"), true)
+	assert.NoError(t, err)
+
+	// A second reconcile over the same inputs must render the same payload,
+	// otherwise every sync period issues a spurious update.
+	az.nsgCache.Delete("nsg")
+	second, err := az.reconcileSecurityGroup("testCluster", &service, to.StringPtr("1.2.3.4"), true)
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	assertGoldenPayload(t, "security_rules.json", first.SecurityRules)
+}
+
+func TestLoadBalancerRulesPayloadGolden(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	service := getTestService("service1", v1.ProtocolTCP, nil, false, 80, 443)
+
+	frontendIPConfigID := az.getFrontendIPConfigID("testCluster", "rg", "aservice1")
+	backendPoolID := az.getBackendPoolID("testCluster", "rg", "testCluster")
+	firstProbes, firstRules, err := az.reconcileLoadBalancerRule(&service, true, frontendIPConfigID, backendPoolID, "testCluster", nil)
+	assert.NoError(t, err)
+
+	secondProbes, secondRules, err := az.reconcileLoadBalancerRule(&service, true, frontendIPConfigID, backendPoolID, "testCluster", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, firstProbes, secondProbes)
+	assert.Equal(t, firstRules, secondRules)
+
+	assertGoldenPayload(t, "load_balancer_probes.json", firstProbes)
+	assertGoldenPayload(t, "load_balancer_rules.json", firstRules)
+}
@@ -0,0 +1,128 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// HealthCheckResult is the outcome of one provider self-diagnostic.
+type HealthCheckResult struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message,omitempty"`
+}
+
+// CheckHealth runs the provider self-diagnostics: credential validity, ARM
+// reachability, the throttling/outage state and cache freshness. It lets the
+// embedding binary alert on provider degradation separately from general
+// controller-manager health.
+func (az *Cloud) CheckHealth(ctx context.Context) []HealthCheckResult {
+	return []HealthCheckResult{
+		az.checkCredentials(ctx),
+		az.checkARMReachability(),
+		az.checkThrottling(),
+		az.checkCacheFreshness(),
+	}
+}
+
+// HealthCheckHandler returns a healthz-style handler that serves the
+// self-diagnostics as JSON and answers 503 when any check fails.
+func (az *Cloud) HealthCheckHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		results := az.CheckHealth(r.Context())
+		status := http.StatusOK
+		for _, result := range results {
+			if !result.Healthy {
+				status = http.StatusServiceUnavailable
+				break
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(results); err != nil {
+			klog.Errorf("HealthCheckHandler: failed to encode results: %v", err)
+		}
+	})
+}
+
+// checkCredentials verifies that a fresh ARM token can be acquired with the
+// configured credentials.
+func (az *Cloud) checkCredentials(ctx context.Context) HealthCheckResult {
+	result := HealthCheckResult{Name: "credentials", Healthy: true}
+	if az.servicePrincipalToken == nil {
+		result.Message = "no service principal token configured, instance metadata is used instead"
+		return result
+	}
+
+	if err := az.servicePrincipalToken.EnsureFreshWithContext(ctx); err != nil {
+		result.Healthy = false
+		result.Message = fmt.Sprintf("token acquisition failed: %v", err)
+	}
+	return result
+}
+
+// checkARMReachability issues a cheap read against ARM to verify the control
+// plane answers for the configured subscription and resource group.
+func (az *Cloud) checkARMReachability() HealthCheckResult {
+	result := HealthCheckResult{Name: "arm", Healthy: true}
+	if _, err := az.ListVirtualMachines(az.ResourceGroup); err != nil {
+		result.Healthy = false
+		result.Message = fmt.Sprintf("listing virtual machines in resource group %q failed: %v", az.ResourceGroup, err)
+	}
+	return result
+}
+
+// checkThrottling reports whether the provider is currently backing off from
+// ARM because of widespread errors.
+func (az *Cloud) checkThrottling() HealthCheckResult {
+	result := HealthCheckResult{Name: "throttling", Healthy: true}
+	if az.outageBreaker.isOpen() {
+		result.Healthy = false
+		result.Message = "ARM outage breaker is open, instance existence checks report unknown"
+	}
+	return result
+}
+
+// checkCacheFreshness summarizes the age of the oldest entry of each named
+// cache relative to its TTL. The check is informational and stays healthy:
+// entries older than the TTL are refreshed on the next read, so age alone is
+// not a failure.
+func (az *Cloud) checkCacheFreshness() HealthCheckResult {
+	result := HealthCheckResult{Name: "caches", Healthy: true}
+	summaries := []string{}
+	for name, timedCache := range az.namedCaches() {
+		oldest := 0.0
+		for _, key := range timedCache.Keys() {
+			if key.AgeSeconds > oldest {
+				oldest = key.AgeSeconds
+			}
+		}
+		summaries = append(summaries, fmt.Sprintf("%s: oldest entry %.0fs, ttl %v", name, oldest, timedCache.TTL))
+	}
+	result.Message = strings.Join(summaries, "; ")
+	return result
+}
@@ -0,0 +1,72 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/legacy-cloud-providers/azure/clients/vmclient/mockvmclient"
+	"k8s.io/legacy-cloud-providers/azure/retry"
+)
+
+func TestHealthCheckHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	mockVMsClient := az.VirtualMachinesClient.(*mockvmclient.MockInterface)
+	mockVMsClient.EXPECT().List(gomock.Any(), "rg").Return(nil, nil)
+
+	recorder := httptest.NewRecorder()
+	az.HealthCheckHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	var results []HealthCheckResult
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &results))
+	assert.Len(t, results, 4)
+	for _, result := range results {
+		assert.True(t, result.Healthy, result.Name)
+	}
+
+	// An ARM error and an open outage breaker must flip the endpoint to 503.
+	mockVMsClient.EXPECT().List(gomock.Any(), "rg").Return(nil, &retry.Error{HTTPStatusCode: http.StatusInternalServerError})
+	az.outageBreaker = newARMOutageBreaker(1, time.Minute)
+	az.outageBreaker.recordError()
+
+	recorder = httptest.NewRecorder()
+	az.HealthCheckHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &results))
+	unhealthy := map[string]bool{}
+	for _, result := range results {
+		if !result.Healthy {
+			unhealthy[result.Name] = true
+		}
+	}
+	assert.True(t, unhealthy["arm"])
+	assert.True(t, unhealthy["throttling"])
+	assert.False(t, unhealthy["credentials"])
+}
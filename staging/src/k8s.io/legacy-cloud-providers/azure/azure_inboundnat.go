@@ -0,0 +1,338 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	v1 "k8s.io/api/core/v1"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// ServiceAnnotationInboundNatRules is the annotation used on the service to
+	// create inbound NAT rules mapping load balancer frontend ports to specific
+	// nodes, e.g. for SSH bastion access or game servers that need a stable
+	// per-node port. The value is a comma separated list of entries of the form
+	// frontendPort:nodeName[:backendPort[:protocol]]; backendPort defaults to
+	// the frontend port and protocol defaults to TCP.
+	ServiceAnnotationInboundNatRules = "service.beta.kubernetes.io/azure-inbound-nat-rules"
+
+	// inboundNatRuleNameSuffix distinguishes annotation-managed inbound NAT
+	// rules from load balancing rules and the read-only rules Azure
+	// materializes from inbound NAT pools.
+	inboundNatRuleNameSuffix = "-nat"
+
+	inboundNatRuleIDTemplate = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/loadBalancers/%s/inboundNatRules/%s"
+)
+
+// inboundNatMapping is one parsed entry of the inbound NAT rules annotation.
+type inboundNatMapping struct {
+	frontendPort int32
+	nodeName     string
+	backendPort  int32
+	protocol     v1.Protocol
+}
+
+// parseInboundNatAnnotation parses the inbound NAT rules annotation of the
+// service. It returns nil if the annotation is not set.
+func parseInboundNatAnnotation(service *v1.Service) ([]inboundNatMapping, error) {
+	value, ok := service.Annotations[ServiceAnnotationInboundNatRules]
+	if !ok || value == "" {
+		return nil, nil
+	}
+
+	var mappings []inboundNatMapping
+	frontendPorts := map[int32]bool{}
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) < 2 || len(parts) > 4 {
+			return nil, fmt.Errorf("invalid entry %q in annotation %s: expected frontendPort:nodeName[:backendPort[:protocol]]", entry, ServiceAnnotationInboundNatRules)
+		}
+
+		frontendPort, err := parseInboundNatPort(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid frontend port in entry %q of annotation %s: %v", entry, ServiceAnnotationInboundNatRules, err)
+		}
+		if frontendPorts[frontendPort] {
+			return nil, fmt.Errorf("duplicate frontend port %d in annotation %s", frontendPort, ServiceAnnotationInboundNatRules)
+		}
+		frontendPorts[frontendPort] = true
+
+		nodeName := parts[1]
+		if nodeName == "" {
+			return nil, fmt.Errorf("empty node name in entry %q of annotation %s", entry, ServiceAnnotationInboundNatRules)
+		}
+
+		mapping := inboundNatMapping{
+			frontendPort: frontendPort,
+			nodeName:     nodeName,
+			backendPort:  frontendPort,
+			protocol:     v1.ProtocolTCP,
+		}
+		if len(parts) >= 3 {
+			if mapping.backendPort, err = parseInboundNatPort(parts[2]); err != nil {
+				return nil, fmt.Errorf("invalid backend port in entry %q of annotation %s: %v", entry, ServiceAnnotationInboundNatRules, err)
+			}
+		}
+		if len(parts) == 4 {
+			switch strings.ToUpper(parts[3]) {
+			case string(v1.ProtocolTCP):
+				mapping.protocol = v1.ProtocolTCP
+			case string(v1.ProtocolUDP):
+				mapping.protocol = v1.ProtocolUDP
+			default:
+				return nil, fmt.Errorf("invalid protocol %q in entry %q of annotation %s", parts[3], entry, ServiceAnnotationInboundNatRules)
+			}
+		}
+
+		mappings = append(mappings, mapping)
+	}
+
+	return mappings, nil
+}
+
+func parseInboundNatPort(s string) (int32, error) {
+	port, err := strconv.ParseInt(s, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	if port < 1 || port > 65535 {
+		return 0, fmt.Errorf("port %d is out of range", port)
+	}
+	return int32(port), nil
+}
+
+func (az *Cloud) getLoadBalancerNatRuleName(service *v1.Service, protocol v1.Protocol, frontendPort int32) string {
+	return fmt.Sprintf("%s-%s-%d%s", az.getRulePrefix(service), protocol, frontendPort, inboundNatRuleNameSuffix)
+}
+
+// returns the full identifier of a loadbalancer inbound NAT rule.
+func (az *Cloud) getLoadBalancerNatRuleID(lbName, rgName, natRuleName string) string {
+	return fmt.Sprintf(
+		inboundNatRuleIDTemplate,
+		az.getNetworkResourceSubscriptionID(),
+		rgName,
+		lbName,
+		natRuleName)
+}
+
+// serviceOwnsNatRule returns true if the given inbound NAT rule was created
+// for the service from its inbound NAT rules annotation.
+func (az *Cloud) serviceOwnsNatRule(service *v1.Service, ruleName string) bool {
+	return az.serviceOwnsRule(service, ruleName) && strings.HasSuffix(ruleName, inboundNatRuleNameSuffix)
+}
+
+// reconcileInboundNatRules returns the inbound NAT rules expected for the
+// service from its inbound NAT rules annotation.
+func (az *Cloud) reconcileInboundNatRules(service *v1.Service, wantLb bool, lbFrontendIPConfigID string, lbIdleTimeout *int32) ([]network.InboundNatRule, error) {
+	var expectedRules []network.InboundNatRule
+	if !wantLb {
+		return expectedRules, nil
+	}
+
+	mappings, err := parseInboundNatAnnotation(service)
+	if err != nil {
+		return expectedRules, err
+	}
+
+	for _, mapping := range mappings {
+		transportProto, _, _, err := getProtocolsFromKubernetesProtocol(mapping.protocol)
+		if err != nil {
+			return expectedRules, err
+		}
+
+		ruleName := az.getLoadBalancerNatRuleName(service, mapping.protocol, mapping.frontendPort)
+		klog.V(2).Infof("reconcileInboundNatRules lb frontend (%s) rule name (%s) node (%s)", lbFrontendIPConfigID, ruleName, mapping.nodeName)
+		expectedRule := network.InboundNatRule{
+			Name: &ruleName,
+			InboundNatRulePropertiesFormat: &network.InboundNatRulePropertiesFormat{
+				Protocol: *transportProto,
+				FrontendIPConfiguration: &network.SubResource{
+					ID: to.StringPtr(lbFrontendIPConfigID),
+				},
+				FrontendPort:     to.Int32Ptr(mapping.frontendPort),
+				BackendPort:      to.Int32Ptr(mapping.backendPort),
+				EnableFloatingIP: to.BoolPtr(false),
+			},
+		}
+		if mapping.protocol == v1.ProtocolTCP {
+			expectedRule.InboundNatRulePropertiesFormat.IdleTimeoutInMinutes = lbIdleTimeout
+		}
+		expectedRules = append(expectedRules, expectedRule)
+	}
+
+	return expectedRules, nil
+}
+
+// ensureInboundNatRuleAssociations adds references to the inbound NAT rules of
+// the service on the primary IP configuration of the mapped nodes, which is
+// how Azure attaches a NAT rule to an instance. Nodes that no longer exist
+// only get a warning event so the service reconcile can still make progress.
+func (az *Cloud) ensureInboundNatRuleAssociations(service *v1.Service, lbName string) error {
+	mappings, err := parseInboundNatAnnotation(service)
+	if err != nil {
+		return err
+	}
+
+	for _, mapping := range mappings {
+		ruleName := az.getLoadBalancerNatRuleName(service, mapping.protocol, mapping.frontendPort)
+		ruleID := az.getLoadBalancerNatRuleID(lbName, az.getLoadBalancerResourceGroup(), ruleName)
+		if err := az.updateNatRuleAssociation(service, mapping.nodeName, ruleID, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateNatRuleAssociation adds the given inbound NAT rule ID on the primary
+// IP configuration of the node's primary network interface.
+func (az *Cloud) updateNatRuleAssociation(service *v1.Service, nodeName, ruleID string, wantAssociation bool) error {
+	nic, err := az.VMSet.GetPrimaryInterface(nodeName)
+	if err != nil {
+		if err == cloudprovider.InstanceNotFound {
+			klog.V(2).Infof("updateNatRuleAssociation(%s): node %s not found, skipping", getServiceName(service), nodeName)
+			az.Event(service, v1.EventTypeWarning, "InboundNatRule",
+				fmt.Sprintf("node %s referenced by annotation %s was not found", nodeName, ServiceAnnotationInboundNatRules))
+			return nil
+		}
+		return err
+	}
+
+	primaryIPConfig, err := getPrimaryIPConfig(nic)
+	if err != nil {
+		return err
+	}
+
+	var natRules []network.InboundNatRule
+	if primaryIPConfig.LoadBalancerInboundNatRules != nil {
+		natRules = *primaryIPConfig.LoadBalancerInboundNatRules
+	}
+
+	found := false
+	for i := len(natRules) - 1; i >= 0; i-- {
+		if strings.EqualFold(to.String(natRules[i].ID), ruleID) {
+			if wantAssociation {
+				return nil
+			}
+			natRules = append(natRules[:i], natRules[i+1:]...)
+			found = true
+		}
+	}
+	if wantAssociation {
+		natRules = append(natRules, network.InboundNatRule{ID: to.StringPtr(ruleID)})
+	} else if !found {
+		return nil
+	}
+
+	primaryIPConfig.LoadBalancerInboundNatRules = &natRules
+	klog.V(2).Infof("updateNatRuleAssociation(%s): updating interface %s for NAT rule %s (want=%t)", getServiceName(service), to.String(nic.Name), ruleID, wantAssociation)
+	return az.CreateOrUpdateInterface(service, nic)
+}
+
+// detachInboundNatRule removes the reference to the given inbound NAT rule
+// from the IP configuration it is attached to. Azure rejects deleting a NAT
+// rule that is still referenced by an IP configuration, so this must run
+// before the rule is dropped from the load balancer. It resolves the network
+// interface from the IP configuration ID because the node the rule pointed to
+// may no longer appear in the service annotation.
+func (az *Cloud) detachInboundNatRule(service *v1.Service, ruleID, ipConfigID string) error {
+	nicName, err := getNicNameFromIPConfigID(ipConfigID)
+	if err != nil {
+		klog.Warningf("detachInboundNatRule(%s): cannot resolve interface for ipConfig %s: %v", getServiceName(service), ipConfigID, err)
+		return nil
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	nic, rerr := az.InterfacesClient.Get(ctx, az.ResourceGroup, nicName, "")
+	if rerr != nil {
+		return rerr.Error()
+	}
+
+	if nic.InterfacePropertiesFormat == nil || nic.IPConfigurations == nil {
+		return nil
+	}
+
+	dirty := false
+	ipConfigs := *nic.IPConfigurations
+	for i := range ipConfigs {
+		if ipConfigs[i].InterfaceIPConfigurationPropertiesFormat == nil || ipConfigs[i].LoadBalancerInboundNatRules == nil {
+			continue
+		}
+		natRules := *ipConfigs[i].LoadBalancerInboundNatRules
+		for j := len(natRules) - 1; j >= 0; j-- {
+			if strings.EqualFold(to.String(natRules[j].ID), ruleID) {
+				natRules = append(natRules[:j], natRules[j+1:]...)
+				dirty = true
+			}
+		}
+		ipConfigs[i].LoadBalancerInboundNatRules = &natRules
+	}
+	if !dirty {
+		return nil
+	}
+
+	nic.IPConfigurations = &ipConfigs
+	klog.V(2).Infof("detachInboundNatRule(%s): detaching NAT rule %s from interface %s", getServiceName(service), ruleID, nicName)
+	return az.CreateOrUpdateInterface(service, nic)
+}
+
+// getNicNameFromIPConfigID extracts the network interface name from an IP
+// configuration ID.
+func getNicNameFromIPConfigID(ipConfigID string) (string, error) {
+	segments := strings.Split(ipConfigID, "/")
+	for i := 0; i < len(segments)-1; i++ {
+		if strings.EqualFold(segments[i], "networkInterfaces") {
+			return segments[i+1], nil
+		}
+	}
+	return "", fmt.Errorf("ID %q does not reference a network interface", ipConfigID)
+}
+
+// findNatRule returns true if the given inbound NAT rule is present in the
+// list, comparing only the fields reconcileLoadBalancer sets.
+func findNatRule(rules []network.InboundNatRule, rule network.InboundNatRule) bool {
+	for _, existingRule := range rules {
+		if strings.EqualFold(to.String(existingRule.Name), to.String(rule.Name)) &&
+			equalInboundNatRulePropertiesFormat(existingRule.InboundNatRulePropertiesFormat, rule.InboundNatRulePropertiesFormat) {
+			return true
+		}
+	}
+	return false
+}
+
+func equalInboundNatRulePropertiesFormat(s *network.InboundNatRulePropertiesFormat, t *network.InboundNatRulePropertiesFormat) bool {
+	if s == nil || t == nil {
+		return false
+	}
+
+	return s.Protocol == t.Protocol &&
+		reflect.DeepEqual(s.FrontendIPConfiguration, t.FrontendIPConfiguration) &&
+		reflect.DeepEqual(s.FrontendPort, t.FrontendPort) &&
+		reflect.DeepEqual(s.BackendPort, t.BackendPort)
+}
@@ -0,0 +1,161 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/legacy-cloud-providers/azure/clients/interfaceclient/mockinterfaceclient"
+	"k8s.io/legacy-cloud-providers/azure/mockvmsets"
+)
+
+func TestParseInboundNatAnnotation(t *testing.T) {
+	tests := []struct {
+		desc        string
+		value       string
+		expected    []inboundNatMapping
+		expectError bool
+	}{
+		{
+			desc:  "full entries",
+			value: "22:node1:2022,30000:node2:30000:UDP",
+			expected: []inboundNatMapping{
+				{frontendPort: 22, nodeName: "node1", backendPort: 2022, protocol: v1.ProtocolTCP},
+				{frontendPort: 30000, nodeName: "node2", backendPort: 30000, protocol: v1.ProtocolUDP},
+			},
+		},
+		{
+			desc:     "defaulted backend port and protocol",
+			value:    "3389:node1",
+			expected: []inboundNatMapping{{frontendPort: 3389, nodeName: "node1", backendPort: 3389, protocol: v1.ProtocolTCP}},
+		},
+		{
+			desc:        "duplicate frontend port",
+			value:       "22:node1,22:node2",
+			expectError: true,
+		},
+		{
+			desc:        "port out of range",
+			value:       "70000:node1",
+			expectError: true,
+		},
+		{
+			desc:        "invalid protocol",
+			value:       "22:node1:22:SCTP",
+			expectError: true,
+		},
+		{
+			desc:        "missing node name",
+			value:       "22",
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		svc := getTestService("service1", v1.ProtocolTCP, map[string]string{ServiceAnnotationInboundNatRules: test.value}, false, 80)
+		mappings, err := parseInboundNatAnnotation(&svc)
+		if test.expectError {
+			assert.Error(t, err, test.desc)
+			continue
+		}
+		assert.NoError(t, err, test.desc)
+		assert.Equal(t, test.expected, mappings, test.desc)
+	}
+
+	// Without the annotation no mappings are returned.
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	mappings, err := parseInboundNatAnnotation(&svc)
+	assert.NoError(t, err)
+	assert.Nil(t, mappings)
+}
+
+func TestReconcileInboundNatRules(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	annotations := map[string]string{ServiceAnnotationInboundNatRules: "22:node1:2022"}
+	svc := getTestService("service1", v1.ProtocolTCP, annotations, false, 80)
+
+	rules, err := az.reconcileInboundNatRules(&svc, true, "frontendID", to.Int32Ptr(4))
+	assert.NoError(t, err)
+	assert.Len(t, rules, 1)
+	assert.Equal(t, "aservice1-TCP-22-nat", *rules[0].Name)
+	assert.Equal(t, int32(22), *rules[0].FrontendPort)
+	assert.Equal(t, int32(2022), *rules[0].BackendPort)
+	assert.Equal(t, "frontendID", *rules[0].FrontendIPConfiguration.ID)
+
+	rules, err = az.reconcileInboundNatRules(&svc, false, "frontendID", to.Int32Ptr(4))
+	assert.NoError(t, err)
+	assert.Empty(t, rules)
+}
+
+func TestUpdateNatRuleAssociation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	ruleID := az.getLoadBalancerNatRuleID("lb", "rg", "aservice1-TCP-22-nat")
+
+	nic := network.Interface{
+		Name: to.StringPtr("nic1"),
+		InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+			IPConfigurations: &[]network.InterfaceIPConfiguration{
+				{
+					Name: to.StringPtr("ipconfig1"),
+					InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+						Primary: to.BoolPtr(true),
+					},
+				},
+			},
+		},
+	}
+
+	mockVMSet := mockvmsets.NewMockVMSet(ctrl)
+	mockVMSet.EXPECT().GetPrimaryInterface("node1").Return(nic, nil)
+	az.VMSet = mockVMSet
+
+	mockNicClient := az.InterfacesClient.(*mockinterfaceclient.MockInterface)
+	mockNicClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "nic1", gomock.Any()).DoAndReturn(
+		func(ctx interface{}, rg, nicName string, updated network.Interface) interface{} {
+			natRules := *(*updated.IPConfigurations)[0].LoadBalancerInboundNatRules
+			assert.Len(t, natRules, 1)
+			assert.Equal(t, ruleID, *natRules[0].ID)
+			return nil
+		})
+
+	err := az.updateNatRuleAssociation(&svc, "node1", ruleID, true)
+	assert.NoError(t, err)
+}
+
+func TestGetNicNameFromIPConfigID(t *testing.T) {
+	name, err := getNicNameFromIPConfigID("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/nic1/ipConfigurations/ipconfig1")
+	assert.NoError(t, err)
+	assert.Equal(t, "nic1", name)
+
+	_, err = getNicNameFromIPConfigID("/subscriptions/sub/resourceGroups/rg")
+	assert.Error(t, err)
+}
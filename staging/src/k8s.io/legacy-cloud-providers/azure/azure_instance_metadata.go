@@ -32,8 +32,13 @@ import (
 const (
 	metadataCacheTTL           = time.Minute
 	metadataCacheKey           = "InstanceMetadata"
-	imdsInstanceAPIVersion     = "2019-03-11"
-	imdsLoadBalancerAPIVersion = "2020-10-01"
+	imdsInstanceAPIVersion = "2019-03-11"
+	// imdsInstanceSecurityAPIVersion is the instance metadata version that
+	// carries the securityProfile block of trusted launch and confidential
+	// VMs. It is tried first; not every environment serves it, so
+	// imdsInstanceAPIVersion stays as the fallback.
+	imdsInstanceSecurityAPIVersion = "2021-12-13"
+	imdsLoadBalancerAPIVersion     = "2020-10-01"
 	imdsServer                 = "http://169.254.169.254"
 	imdsInstanceURI            = "/metadata/instance"
 	imdsLoadBalancerURI        = "/metadata/loadbalancer"
@@ -69,20 +74,29 @@ type Subnet struct {
 	Prefix  string `json:"prefix"`
 }
 
+// SecurityProfileMetadata represents the security profile of a trusted
+// launch or confidential instance. IMDS renders the booleans as strings.
+type SecurityProfileMetadata struct {
+	SecureBootEnabled string `json:"secureBootEnabled,omitempty"`
+	VirtualTpmEnabled string `json:"virtualTpmEnabled,omitempty"`
+	SecurityType      string `json:"securityType,omitempty"`
+}
+
 // ComputeMetadata represents compute information
 type ComputeMetadata struct {
-	Environment    string `json:"azEnvironment,omitempty"`
-	SKU            string `json:"sku,omitempty"`
-	Name           string `json:"name,omitempty"`
-	Zone           string `json:"zone,omitempty"`
-	VMSize         string `json:"vmSize,omitempty"`
-	OSType         string `json:"osType,omitempty"`
-	Location       string `json:"location,omitempty"`
-	FaultDomain    string `json:"platformFaultDomain,omitempty"`
-	UpdateDomain   string `json:"platformUpdateDomain,omitempty"`
-	ResourceGroup  string `json:"resourceGroupName,omitempty"`
-	VMScaleSetName string `json:"vmScaleSetName,omitempty"`
-	SubscriptionID string `json:"subscriptionId,omitempty"`
+	Environment     string                   `json:"azEnvironment,omitempty"`
+	SKU             string                   `json:"sku,omitempty"`
+	Name            string                   `json:"name,omitempty"`
+	Zone            string                   `json:"zone,omitempty"`
+	VMSize          string                   `json:"vmSize,omitempty"`
+	OSType          string                   `json:"osType,omitempty"`
+	Location        string                   `json:"location,omitempty"`
+	FaultDomain     string                   `json:"platformFaultDomain,omitempty"`
+	UpdateDomain    string                   `json:"platformUpdateDomain,omitempty"`
+	ResourceGroup   string                   `json:"resourceGroupName,omitempty"`
+	VMScaleSetName  string                   `json:"vmScaleSetName,omitempty"`
+	SubscriptionID  string                   `json:"subscriptionId,omitempty"`
+	SecurityProfile *SecurityProfileMetadata `json:"securityProfile,omitempty"`
 }
 
 // InstanceMetadata represents instance information.
@@ -119,7 +133,7 @@ func NewInstanceMetadataService(idmsServer string) (*InstanceMetadataService, er
 		imdsServer: idmsServer,
 	}
 
-	imsCache, err := azcache.NewTimedcache(metadataCacheTTL, ims.getMetadata)
+	imsCache, err := azcache.NewNamedTimedCache("imds", metadataCacheTTL, ims.getMetadata)
 	if err != nil {
 		return nil, err
 	}
@@ -173,6 +187,19 @@ func (ims *InstanceMetadataService) getMetadata(key string) (interface{}, error)
 }
 
 func (ims *InstanceMetadataService) getInstanceMetadata(key string) (*InstanceMetadata, error) {
+	// The security metadata version is preferred; environments that do not
+	// serve it yet fall back to the legacy version, which only loses the
+	// securityProfile block.
+	metadata, err := ims.getInstanceMetadataWithAPIVersion(imdsInstanceSecurityAPIVersion)
+	if err != nil {
+		klog.V(4).Infof("getInstanceMetadata: falling back to API version %s: %v", imdsInstanceAPIVersion, err)
+		return ims.getInstanceMetadataWithAPIVersion(imdsInstanceAPIVersion)
+	}
+
+	return metadata, nil
+}
+
+func (ims *InstanceMetadataService) getInstanceMetadataWithAPIVersion(apiVersion string) (*InstanceMetadata, error) {
 	req, err := http.NewRequest("GET", ims.imdsServer+imdsInstanceURI, nil)
 	if err != nil {
 		return nil, err
@@ -182,7 +209,7 @@ func (ims *InstanceMetadataService) getInstanceMetadata(key string) (*InstanceMe
 
 	q := req.URL.Query()
 	q.Add("format", "json")
-	q.Add("api-version", imdsInstanceAPIVersion)
+	q.Add("api-version", apiVersion)
 	req.URL.RawQuery = q.Encode()
 
 	client := &http.Client{}
@@ -30,6 +30,7 @@ import (
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
 	azcache "k8s.io/legacy-cloud-providers/azure/cache"
+	utilnet "k8s.io/utils/net"
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-12-01/compute"
 )
@@ -39,6 +40,7 @@ const (
 	vmPowerStateStopped      = "stopped"
 	vmPowerStateDeallocated  = "deallocated"
 	vmPowerStateDeallocating = "deallocating"
+	vmPowerStateUnknown      = "unknown"
 
 	// nodeNameEnvironmentName is the environment variable name for getting node name.
 	// It is only used for out-of-tree cloud provider.
@@ -50,6 +52,10 @@ var (
 )
 
 func (az *Cloud) addressGetter(nodeName types.NodeName) ([]v1.NodeAddress, error) {
+	if az.IPv6SingleStack {
+		return az.getIPv6NodeAddresses(nodeName)
+	}
+
 	ip, publicIP, err := az.getIPForMachine(nodeName)
 	if err != nil {
 		klog.V(2).Infof("NodeAddresses(%s) abort backoff: %v", nodeName, err)
@@ -69,6 +75,33 @@ func (az *Cloud) addressGetter(nodeName types.NodeName) ([]v1.NodeAddress, error
 	return addresses, nil
 }
 
+// getIPv6NodeAddresses returns the IPv6 addresses of the specified node for
+// IPv6-only clusters, where the NIC may not have an IPv4 primary ipconfig.
+func (az *Cloud) getIPv6NodeAddresses(nodeName types.NodeName) ([]v1.NodeAddress, error) {
+	privateIPs, err := az.getPrivateIPsForMachine(nodeName)
+	if err != nil {
+		klog.V(2).Infof("getIPv6NodeAddresses(%s) abort backoff: %v", nodeName, err)
+		return nil, err
+	}
+
+	addresses := []v1.NodeAddress{
+		{Type: v1.NodeHostName, Address: string(nodeName)},
+	}
+	for _, privateIP := range privateIPs {
+		if utilnet.IsIPv6String(privateIP) {
+			addresses = append(addresses, v1.NodeAddress{
+				Type:    v1.NodeInternalIP,
+				Address: privateIP,
+			})
+		}
+	}
+
+	if len(addresses) == 1 {
+		return nil, fmt.Errorf("no IPv6 addresses found for node %q", nodeName)
+	}
+	return addresses, nil
+}
+
 // NodeAddresses returns the addresses of the specified instance.
 func (az *Cloud) NodeAddresses(ctx context.Context, name types.NodeName) ([]v1.NodeAddress, error) {
 	// Returns nil for unmanaged nodes because azure cloud provider couldn't fetch information for them.
@@ -81,7 +114,7 @@ func (az *Cloud) NodeAddresses(ctx context.Context, name types.NodeName) ([]v1.N
 		return nil, nil
 	}
 
-	if az.UseInstanceMetadata {
+	if az.UseInstanceMetadata || az.PreferIMDSNodeAddresses {
 		metadata, err := az.metadata.GetMetadata(azcache.CacheReadTypeDefault)
 		if err != nil {
 			return nil, err
@@ -117,35 +150,44 @@ func (az *Cloud) getLocalInstanceNodeAddresses(netInterfaces []NetworkInterface,
 		return nil, fmt.Errorf("no interface is found for the instance")
 	}
 
-	// Use ip address got from instance metadata.
-	netInterface := netInterfaces[0]
+	// Use ip address got from instance metadata. Only the primary interface
+	// is reported unless preferIMDSNodeAddresses asks for all of them; the
+	// primary stays first so kubelet keeps picking the same node IP.
+	interfaces := netInterfaces[:1]
+	if az.PreferIMDSNodeAddresses {
+		interfaces = netInterfaces
+	}
 	addresses := []v1.NodeAddress{
 		{Type: v1.NodeHostName, Address: nodeName},
 	}
-	if len(netInterface.IPV4.IPAddress) > 0 && len(netInterface.IPV4.IPAddress[0].PrivateIP) > 0 {
-		address := netInterface.IPV4.IPAddress[0]
-		addresses = append(addresses, v1.NodeAddress{
-			Type:    v1.NodeInternalIP,
-			Address: address.PrivateIP,
-		})
-		if len(address.PublicIP) > 0 {
+	for _, netInterface := range interfaces {
+		// IPv4 addresses are omitted for IPv6-only clusters, where the IPv4
+		// ipconfig (if any) is not routable in the cluster.
+		if !az.IPv6SingleStack && len(netInterface.IPV4.IPAddress) > 0 && len(netInterface.IPV4.IPAddress[0].PrivateIP) > 0 {
+			address := netInterface.IPV4.IPAddress[0]
 			addresses = append(addresses, v1.NodeAddress{
-				Type:    v1.NodeExternalIP,
-				Address: address.PublicIP,
+				Type:    v1.NodeInternalIP,
+				Address: address.PrivateIP,
 			})
+			if len(address.PublicIP) > 0 {
+				addresses = append(addresses, v1.NodeAddress{
+					Type:    v1.NodeExternalIP,
+					Address: address.PublicIP,
+				})
+			}
 		}
-	}
-	if len(netInterface.IPV6.IPAddress) > 0 && len(netInterface.IPV6.IPAddress[0].PrivateIP) > 0 {
-		address := netInterface.IPV6.IPAddress[0]
-		addresses = append(addresses, v1.NodeAddress{
-			Type:    v1.NodeInternalIP,
-			Address: address.PrivateIP,
-		})
-		if len(address.PublicIP) > 0 {
+		if len(netInterface.IPV6.IPAddress) > 0 && len(netInterface.IPV6.IPAddress[0].PrivateIP) > 0 {
+			address := netInterface.IPV6.IPAddress[0]
 			addresses = append(addresses, v1.NodeAddress{
-				Type:    v1.NodeExternalIP,
-				Address: address.PublicIP,
+				Type:    v1.NodeInternalIP,
+				Address: address.PrivateIP,
 			})
+			if len(address.PublicIP) > 0 {
+				addresses = append(addresses, v1.NodeAddress{
+					Type:    v1.NodeExternalIP,
+					Address: address.PublicIP,
+				})
+			}
 		}
 	}
 
@@ -195,16 +237,24 @@ func (az *Cloud) InstanceExistsByProviderID(ctx context.Context, providerID stri
 	name, err := az.VMSet.GetNodeNameByProviderID(providerID)
 	if err != nil {
 		if err == cloudprovider.InstanceNotFound {
+			if az.outageBreaker.isOpen() {
+				return false, fmt.Errorf("InstanceExistsByProviderID(%s): ARM outage breaker is open, reporting existence as unknown", providerID)
+			}
 			return false, nil
 		}
+		az.reportInstanceCheckError("", err)
 		return false, err
 	}
 
 	_, err = az.InstanceID(ctx, name)
 	if err != nil {
 		if err == cloudprovider.InstanceNotFound {
+			if az.outageBreaker.isOpen() {
+				return false, fmt.Errorf("InstanceExistsByProviderID(%s): ARM outage breaker is open, reporting existence as unknown", providerID)
+			}
 			return false, nil
 		}
+		az.reportInstanceCheckError(string(name), err)
 		return false, err
 	}
 
@@ -254,9 +304,30 @@ func (az *Cloud) InstanceShutdownByProviderID(ctx context.Context, providerID st
 	return provisioningSucceeded && (status == vmPowerStateStopped || status == vmPowerStateDeallocated || status == vmPowerStateDeallocating), nil
 }
 
+// powerStateForMissingInstanceView decides the power state to report for a VM
+// whose InstanceView carries no power state. The instance view is nil when the
+// VM is under deleting, but it can also be missing transiently when the ARM API
+// is degraded, so the provisioning state is checked as a second source before
+// the VM is reported as stopped. When the provisioning state does not confirm
+// the deletion, the VMPowerStateFallback config decides between the historical
+// "stopped" assumption and returning an error so that callers retry.
+func (az *Cloud) powerStateForMissingInstanceView(name, provisioningState string) (string, error) {
+	if strings.EqualFold(provisioningState, string(compute.ProvisioningStateDeleting)) {
+		klog.V(3).Infof("InstanceView for node %q is nil and the VM is being deleted, assuming it's stopped", name)
+		return vmPowerStateStopped, nil
+	}
+
+	if strings.EqualFold(az.Config.VMPowerStateFallback, vmPowerStateUnknown) {
+		return "", fmt.Errorf("power state of node %q is unknown: InstanceView is nil and provisioning state is %q", name, provisioningState)
+	}
+
+	klog.V(3).Infof("InstanceView for node %q is nil, assuming it's stopped", name)
+	return vmPowerStateStopped, nil
+}
+
 func (az *Cloud) isCurrentInstance(name types.NodeName, metadataVMName string) (bool, error) {
 	var err error
-	nodeName := mapNodeNameToVMName(name)
+	vmName := az.getVMNameByNodeName(name)
 
 	// VMSS vmName is not same with hostname, use hostname instead.
 	if az.VMType == vmTypeVMSS {
@@ -272,8 +343,9 @@ func (az *Cloud) isCurrentInstance(name types.NodeName, metadataVMName string) (
 		}
 	}
 
-	metadataVMName = strings.ToLower(metadataVMName)
-	return (metadataVMName == nodeName), nil
+	// Compare case-insensitively because Windows computer names may be
+	// uppercased versions of the VM names.
+	return strings.EqualFold(metadataVMName, vmName), nil
 }
 
 // InstanceID returns the cloud provider ID of the specified instance.
@@ -428,3 +500,89 @@ func (az *Cloud) CurrentNodeName(ctx context.Context, hostname string) (types.No
 func mapNodeNameToVMName(nodeName types.NodeName) string {
 	return string(nodeName)
 }
+
+// getVMNameByNodeName maps a k8s NodeName to an Azure VM name, honoring the
+// configured nodeNameResolutionMethod. With the providerid method, the VM name
+// recorded from the node's providerID takes precedence, so that nodes whose
+// computer names diverge from their VM names (e.g. truncated or uppercased
+// Windows computer names) are still resolved to the right VM. It falls back to
+// a simple string cast when the providerID is unknown.
+func (az *Cloud) getVMNameByNodeName(nodeName types.NodeName) string {
+	if strings.EqualFold(az.NodeNameResolutionMethod, nodeNameResolutionMethodProviderID) {
+		az.nodeCachesLock.RLock()
+		vmName, ok := az.nodeVMNames[string(nodeName)]
+		az.nodeCachesLock.RUnlock()
+		if ok {
+			return vmName
+		}
+	}
+
+	return mapNodeNameToVMName(nodeName)
+}
+
+// nodeLabelSecurityType is the node label exposing the security type of
+// trusted launch and confidential VMs.
+const nodeLabelSecurityType = "kubernetes.azure.com/security-type"
+
+// GetNodeSecurityTypeLabels returns the labels describing the security type
+// of the node, e.g. TrustedLaunch or ConfidentialVM. The local instance is
+// served from instance metadata when UseInstanceMetadata is set; other
+// standard VMs are read through the multi-version compute client, since the
+// vendored compute models drop the securityProfile block. VMs without a
+// security profile and scale set instances yield no labels.
+func (az *Cloud) GetNodeSecurityTypeLabels(name types.NodeName) (map[string]string, error) {
+	unmanaged, err := az.IsNodeUnmanaged(string(name))
+	if err != nil {
+		return nil, err
+	}
+	if unmanaged {
+		return nil, nil
+	}
+
+	if az.UseInstanceMetadata {
+		metadata, err := az.metadata.GetMetadata(azcache.CacheReadTypeDefault)
+		if err != nil {
+			return nil, err
+		}
+		if metadata.Compute != nil {
+			isLocalInstance, err := az.isCurrentInstance(name, metadata.Compute.Name)
+			if err != nil {
+				return nil, err
+			}
+			if isLocalInstance {
+				return securityTypeLabels(metadata.Compute.SecurityProfile), nil
+			}
+		}
+	}
+
+	rgName, err := az.GetNodeResourceGroup(string(name))
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	profile, rerr := az.VirtualMachinesClient.GetSecurityProfile(ctx, rgName, az.getVMNameByNodeName(name))
+	if rerr != nil {
+		if rerr.IsNotFound() {
+			// Scale set instances are not addressable as standalone VMs.
+			klog.V(4).Infof("GetNodeSecurityTypeLabels: node %q is not a standalone VM, omitting security type labels", name)
+			return nil, nil
+		}
+		return nil, rerr.Error()
+	}
+
+	if profile == nil || profile.SecurityType == "" {
+		return nil, nil
+	}
+	return map[string]string{nodeLabelSecurityType: profile.SecurityType}, nil
+}
+
+// securityTypeLabels renders the security type labels from the instance
+// metadata security profile.
+func securityTypeLabels(profile *SecurityProfileMetadata) map[string]string {
+	if profile == nil || profile.SecurityType == "" {
+		return nil
+	}
+	return map[string]string{nodeLabelSecurityType: profile.SecurityType}
+}
@@ -0,0 +1,170 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+)
+
+// NodeAddressesBulk resolves the addresses of the given nodes with one VM
+// list and one network interface list per resource group, joined in memory.
+// When the cloud-node controller starts and must annotate hundreds of nodes
+// this replaces the per-node NIC and public IP reads of NodeAddresses with
+// three list calls per resource group. Nodes whose addresses cannot be
+// resolved from the lists - scale set instances that are not in the VM list,
+// or nodes with incomplete network profiles - fall back to the per-node path;
+// nodes that still fail are omitted from the result, and only list failures
+// fail the whole batch.
+func (az *Cloud) NodeAddressesBulk(ctx context.Context, nodes []types.NodeName) (map[types.NodeName][]v1.NodeAddress, error) {
+	nodesByResourceGroup := map[string][]types.NodeName{}
+	result := make(map[types.NodeName][]v1.NodeAddress, len(nodes))
+
+	for _, nodeName := range nodes {
+		unmanaged, err := az.IsNodeUnmanaged(string(nodeName))
+		if err != nil {
+			return nil, err
+		}
+		if unmanaged {
+			klog.V(4).Infof("NodeAddressesBulk: omitting unmanaged node %q", nodeName)
+			continue
+		}
+
+		rgName, err := az.GetNodeResourceGroup(string(nodeName))
+		if err != nil {
+			return nil, err
+		}
+		nodesByResourceGroup[rgName] = append(nodesByResourceGroup[rgName], nodeName)
+	}
+
+	for rgName, rgNodes := range nodesByResourceGroup {
+		vms, err := az.ListVirtualMachines(rgName)
+		if err != nil {
+			return nil, err
+		}
+
+		nics, rerr := az.InterfacesClient.List(ctx, rgName)
+		if rerr != nil {
+			klog.Errorf("InterfacesClient.List(%s) failed: %v", rgName, rerr)
+			return nil, rerr.Error()
+		}
+		nicsByID := make(map[string]network.Interface, len(nics))
+		for i := range nics {
+			nicsByID[strings.ToLower(to.String(nics[i].ID))] = nics[i]
+		}
+
+		pips, rerr := az.PublicIPAddressesClient.List(ctx, rgName)
+		if rerr != nil {
+			klog.Errorf("PublicIPAddressesClient.List(%s) failed: %v", rgName, rerr)
+			return nil, rerr.Error()
+		}
+		pipsByID := make(map[string]network.PublicIPAddress, len(pips))
+		for i := range pips {
+			pipsByID[strings.ToLower(to.String(pips[i].ID))] = pips[i]
+		}
+
+		nicIDsByNodeName := make(map[types.NodeName]string, len(vms))
+		for i := range vms {
+			nicID, err := getPrimaryInterfaceID(vms[i])
+			if err != nil {
+				klog.V(4).Infof("NodeAddressesBulk: no primary interface for vm %q: %v", to.String(vms[i].Name), err)
+				continue
+			}
+			nicIDsByNodeName[types.NodeName(strings.ToLower(to.String(vms[i].Name)))] = nicID
+		}
+
+		for _, nodeName := range rgNodes {
+			nic, found := nicsByID[strings.ToLower(nicIDsByNodeName[types.NodeName(strings.ToLower(mapNodeNameToVMName(nodeName)))])]
+			if found {
+				addresses, err := az.nodeAddressesFromNIC(nodeName, nic, pipsByID)
+				if err == nil {
+					result[nodeName] = addresses
+					continue
+				}
+				klog.Warningf("NodeAddressesBulk: resolving node %q from the lists of resource group %q failed: %v, falling back to NodeAddresses", nodeName, rgName, err)
+			} else {
+				// Scale set instances are not covered by the VM list; resolve
+				// them through the regular per-node path.
+				klog.V(4).Infof("NodeAddressesBulk: node %q not found in the lists of resource group %q, falling back to NodeAddresses", nodeName, rgName)
+			}
+
+			addresses, err := az.addressGetter(nodeName)
+			if err != nil {
+				klog.Warningf("NodeAddressesBulk: failed to get addresses of node %q: %v", nodeName, err)
+				continue
+			}
+			result[nodeName] = addresses
+		}
+	}
+
+	return result, nil
+}
+
+// nodeAddressesFromNIC renders the node addresses from an already listed NIC,
+// resolving public IP references against the listed public IPs.
+func (az *Cloud) nodeAddressesFromNIC(nodeName types.NodeName, nic network.Interface, pipsByID map[string]network.PublicIPAddress) ([]v1.NodeAddress, error) {
+	addresses := []v1.NodeAddress{
+		{Type: v1.NodeHostName, Address: string(nodeName)},
+	}
+
+	if az.IPv6SingleStack {
+		// Match getIPv6NodeAddresses: only the IPv6 private IPs are reported.
+		if nic.IPConfigurations != nil {
+			for _, ipConfig := range *nic.IPConfigurations {
+				privateIP := to.String(ipConfig.PrivateIPAddress)
+				if utilnet.IsIPv6String(privateIP) {
+					addresses = append(addresses, v1.NodeAddress{
+						Type:    v1.NodeInternalIP,
+						Address: privateIP,
+					})
+				}
+			}
+		}
+		return addresses, nil
+	}
+
+	ipConfig, err := getPrimaryIPConfig(nic)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses = append(addresses, v1.NodeAddress{
+		Type:    v1.NodeInternalIP,
+		Address: to.String(ipConfig.PrivateIPAddress),
+	})
+
+	if ipConfig.PublicIPAddress != nil && ipConfig.PublicIPAddress.ID != nil {
+		if pip, found := pipsByID[strings.ToLower(*ipConfig.PublicIPAddress.ID)]; found && pip.IPAddress != nil {
+			addresses = append(addresses, v1.NodeAddress{
+				Type:    v1.NodeExternalIP,
+				Address: *pip.IPAddress,
+			})
+		}
+	}
+
+	return addresses, nil
+}
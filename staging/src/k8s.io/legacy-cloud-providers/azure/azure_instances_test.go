@@ -32,11 +32,13 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	cloudprovider "k8s.io/cloud-provider"
 	azcache "k8s.io/legacy-cloud-providers/azure/cache"
 	"k8s.io/legacy-cloud-providers/azure/clients/interfaceclient/mockinterfaceclient"
 	"k8s.io/legacy-cloud-providers/azure/clients/publicipclient/mockpublicipclient"
+	"k8s.io/legacy-cloud-providers/azure/clients/vmclient"
 	"k8s.io/legacy-cloud-providers/azure/clients/vmclient/mockvmclient"
 	"k8s.io/legacy-cloud-providers/azure/clients/vmssclient/mockvmssclient"
 	"k8s.io/legacy-cloud-providers/azure/clients/vmssvmclient/mockvmssvmclient"
@@ -589,6 +591,91 @@ func TestNodeAddresses(t *testing.T) {
 	}
 }
 
+func TestNodeAddressesPreferIMDS(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cloud := GetTestCloud(ctrl)
+
+	metadataBody := `{"compute":{"name":"vm1"},"network":{"interface":[{"ipv4":{"ipAddress":[{"privateIpAddress":"10.240.0.1","publicIpAddress":"192.168.1.12"}]},"ipv6":{"ipAddress":[]}},{"ipv4":{"ipAddress":[{"privateIpAddress":"10.241.0.1","publicIpAddress":""}]},"ipv6":{"ipAddress":[]}}]}}`
+
+	testcases := []struct {
+		name                    string
+		preferIMDSNodeAddresses bool
+		useInstanceMetadata     bool
+		expectedAddress         []v1.NodeAddress
+	}{
+		{
+			name:                "NodeAddresses should only report the primary interface by default",
+			useInstanceMetadata: true,
+			expectedAddress: []v1.NodeAddress{
+				{
+					Type:    v1.NodeHostName,
+					Address: "vm1",
+				},
+				{
+					Type:    v1.NodeInternalIP,
+					Address: "10.240.0.1",
+				},
+				{
+					Type:    v1.NodeExternalIP,
+					Address: "192.168.1.12",
+				},
+			},
+		},
+		{
+			name:                    "NodeAddresses should report secondary interfaces when preferIMDSNodeAddresses is set",
+			preferIMDSNodeAddresses: true,
+			expectedAddress: []v1.NodeAddress{
+				{
+					Type:    v1.NodeHostName,
+					Address: "vm1",
+				},
+				{
+					Type:    v1.NodeInternalIP,
+					Address: "10.240.0.1",
+				},
+				{
+					Type:    v1.NodeExternalIP,
+					Address: "192.168.1.12",
+				},
+				{
+					Type:    v1.NodeInternalIP,
+					Address: "10.241.0.1",
+				},
+			},
+		},
+	}
+
+	for _, test := range testcases {
+		cloud.VMSet = newAvailabilitySet(cloud)
+		cloud.Config.VMType = vmTypeStandard
+		cloud.Config.UseInstanceMetadata = test.useInstanceMetadata
+		cloud.Config.PreferIMDSNodeAddresses = test.preferIMDSNodeAddresses
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Errorf("Test [%s] unexpected error: %v", test.name, err)
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, metadataBody)
+		}))
+		go func() {
+			http.Serve(listener, mux)
+		}()
+		defer listener.Close()
+
+		cloud.metadata, err = NewInstanceMetadataService("http://" + listener.Addr().String() + "/")
+		if err != nil {
+			t.Errorf("Test [%s] unexpected error: %v", test.name, err)
+		}
+
+		ipAddresses, err := cloud.NodeAddresses(context.Background(), types.NodeName("vm1"))
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, test.expectedAddress, ipAddresses, test.name)
+	}
+}
+
 func TestInstanceExistsByProviderID(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -801,3 +888,281 @@ func TestCurrentNodeName(t *testing.T) {
 	assert.Equal(t, types.NodeName(hostname), nodeName)
 	assert.Nil(t, err)
 }
+
+func TestGetVMNameByNodeName(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testcases := []struct {
+		name             string
+		resolutionMethod string
+		nodeVMNames      map[string]string
+		nodeName         string
+		expectedVMName   string
+	}{
+		{
+			name:             "getVMNameByNodeName should cast the node name directly by default",
+			resolutionMethod: nodeNameResolutionMethodNodeName,
+			nodeVMNames:      map[string]string{"win-node": "winNodeTruncated"},
+			nodeName:         "win-node",
+			expectedVMName:   "win-node",
+		},
+		{
+			name:             "getVMNameByNodeName should prefer the VM name from providerID when configured",
+			resolutionMethod: nodeNameResolutionMethodProviderID,
+			nodeVMNames:      map[string]string{"win-node": "winNodeTruncated"},
+			nodeName:         "win-node",
+			expectedVMName:   "winNodeTruncated",
+		},
+		{
+			name:             "getVMNameByNodeName should fall back to the node name when providerID is unknown",
+			resolutionMethod: nodeNameResolutionMethodProviderID,
+			nodeVMNames:      map[string]string{},
+			nodeName:         "vm-1",
+			expectedVMName:   "vm-1",
+		},
+	}
+
+	for _, test := range testcases {
+		cloud := GetTestCloud(ctrl)
+		cloud.NodeNameResolutionMethod = test.resolutionMethod
+		cloud.nodeVMNames = test.nodeVMNames
+
+		vmName := cloud.getVMNameByNodeName(types.NodeName(test.nodeName))
+		assert.Equal(t, test.expectedVMName, vmName, test.name)
+	}
+}
+
+func TestUpdateNodeCachesVMNames(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cloud := GetTestCloud(ctrl)
+
+	node := v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "win-node",
+		},
+		Spec: v1.NodeSpec{
+			ProviderID: "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/winNodeTruncated",
+		},
+	}
+
+	// VM name should be recorded from the node's providerID.
+	cloud.updateNodeCaches(nil, &node)
+	assert.Equal(t, map[string]string{"win-node": "winNodeTruncated"}, cloud.nodeVMNames)
+
+	// VM name should be removed when the node is deleted.
+	cloud.updateNodeCaches(&node, nil)
+	assert.Equal(t, map[string]string{}, cloud.nodeVMNames)
+
+	// VMSS providerIDs don't carry the VM name and should not be recorded.
+	vmssNode := v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "vmss-node-0",
+		},
+		Spec: v1.NodeSpec{
+			ProviderID: "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/vmss/virtualMachines/0",
+		},
+	}
+	cloud.updateNodeCaches(nil, &vmssNode)
+	assert.Equal(t, map[string]string{}, cloud.nodeVMNames)
+}
+
+func TestGetLocalInstanceNodeAddressesIPv6SingleStack(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cloud := GetTestCloud(ctrl)
+	cloud.IPv6SingleStack = true
+	var err error
+	cloud.metadata, err = NewInstanceMetadataService("http://localhost/")
+	assert.NoError(t, err)
+
+	netInterfaces := []NetworkInterface{
+		{
+			IPV4: NetworkData{
+				IPAddress: []IPAddress{
+					{
+						PrivateIP: "10.240.0.1",
+						PublicIP:  "20.1.2.3",
+					},
+				},
+			},
+			IPV6: NetworkData{
+				IPAddress: []IPAddress{
+					{
+						PrivateIP: "2001:1234:5678:9abc::5",
+					},
+				},
+			},
+		},
+	}
+
+	// Only the IPv6 addresses should be returned for IPv6-only clusters.
+	expectedAddresses := []v1.NodeAddress{
+		{Type: v1.NodeHostName, Address: "vm-0"},
+		{Type: v1.NodeInternalIP, Address: "2001:1234:5678:9abc::5"},
+	}
+	addresses, err := cloud.getLocalInstanceNodeAddresses(netInterfaces, "vm-0")
+	assert.NoError(t, err)
+	assert.Equal(t, expectedAddresses, addresses)
+
+	// An error should be reported when the NIC carries no IPv6 addresses.
+	netInterfaces[0].IPV6 = NetworkData{}
+	_, err = cloud.getLocalInstanceNodeAddresses(netInterfaces, "vm-0")
+	assert.Error(t, err)
+}
+
+func TestNodeAddressesBulk(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cloud := GetTestCloud(ctrl)
+
+	nicID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/nic-0"
+	pipID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/pip-0"
+	vms := []compute.VirtualMachine{{
+		Name: to.StringPtr("vm-0"),
+		VirtualMachineProperties: &compute.VirtualMachineProperties{
+			NetworkProfile: &compute.NetworkProfile{
+				NetworkInterfaces: &[]compute.NetworkInterfaceReference{{
+					ID: to.StringPtr(nicID),
+					NetworkInterfaceReferenceProperties: &compute.NetworkInterfaceReferenceProperties{
+						Primary: to.BoolPtr(true),
+					},
+				}},
+			},
+		},
+	}}
+	nics := []network.Interface{{
+		Name: to.StringPtr("nic-0"),
+		ID:   to.StringPtr(nicID),
+		InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+			IPConfigurations: &[]network.InterfaceIPConfiguration{{
+				InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+					Primary:          to.BoolPtr(true),
+					PrivateIPAddress: to.StringPtr("10.240.0.4"),
+					PublicIPAddress:  &network.PublicIPAddress{ID: to.StringPtr(pipID)},
+				},
+			}},
+		},
+	}}
+	pips := []network.PublicIPAddress{{
+		ID: to.StringPtr(pipID),
+		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+			IPAddress: to.StringPtr("1.2.3.4"),
+		},
+	}}
+
+	// One list call each suffices for any number of nodes in the group.
+	mockVMsClient := cloud.VirtualMachinesClient.(*mockvmclient.MockInterface)
+	mockVMsClient.EXPECT().List(gomock.Any(), "rg").Return(vms, nil)
+	mockInterfaceClient := cloud.InterfacesClient.(*mockinterfaceclient.MockInterface)
+	mockInterfaceClient.EXPECT().List(gomock.Any(), "rg").Return(nics, nil)
+	mockPublicIPAddressesClient := cloud.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPublicIPAddressesClient.EXPECT().List(gomock.Any(), "rg").Return(pips, nil)
+
+	addresses, err := cloud.NodeAddressesBulk(context.Background(), []types.NodeName{"vm-0"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[types.NodeName][]v1.NodeAddress{
+		"vm-0": {
+			{Type: v1.NodeHostName, Address: "vm-0"},
+			{Type: v1.NodeInternalIP, Address: "10.240.0.4"},
+			{Type: v1.NodeExternalIP, Address: "1.2.3.4"},
+		},
+	}, addresses)
+}
+
+func TestPowerStateForMissingInstanceView(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testcases := []struct {
+		description        string
+		provisioningState  string
+		powerStateFallback string
+		expectedPowerState string
+		expectedErr        bool
+	}{
+		{
+			description:        "confirmed deleting VMs are reported stopped regardless of the fallback",
+			provisioningState:  "Deleting",
+			powerStateFallback: vmPowerStateUnknown,
+			expectedPowerState: vmPowerStateStopped,
+		},
+		{
+			description:        "the provisioning state check is case-insensitive",
+			provisioningState:  "deleting",
+			powerStateFallback: vmPowerStateUnknown,
+			expectedPowerState: vmPowerStateStopped,
+		},
+		{
+			description:        "the default fallback keeps the historical stopped assumption",
+			provisioningState:  "Succeeded",
+			expectedPowerState: vmPowerStateStopped,
+		},
+		{
+			description:        "the unknown fallback returns an error for unconfirmed VMs",
+			provisioningState:  "Succeeded",
+			powerStateFallback: vmPowerStateUnknown,
+			expectedErr:        true,
+		},
+	}
+
+	for _, test := range testcases {
+		az := GetTestCloud(ctrl)
+		az.Config.VMPowerStateFallback = test.powerStateFallback
+
+		powerState, err := az.powerStateForMissingInstanceView("vm1", test.provisioningState)
+		if test.expectedErr {
+			assert.Error(t, err, test.description)
+			continue
+		}
+		assert.NoError(t, err, test.description)
+		assert.Equal(t, test.expectedPowerState, powerState, test.description)
+	}
+}
+
+func TestGetNodeSecurityTypeLabels(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testcases := []struct {
+		description    string
+		profile        *vmclient.SecurityProfile
+		getErr         *retry.Error
+		expectedLabels map[string]string
+		expectedErr    bool
+	}{
+		{
+			description:    "trusted launch VMs expose their security type",
+			profile:        &vmclient.SecurityProfile{SecurityType: "TrustedLaunch"},
+			expectedLabels: map[string]string{"kubernetes.azure.com/security-type": "TrustedLaunch"},
+		},
+		{
+			description: "VMs without a security profile yield no labels",
+		},
+		{
+			description: "scale set instances yield no labels",
+			getErr:      &retry.Error{HTTPStatusCode: http.StatusNotFound},
+		},
+		{
+			description: "other errors are reported",
+			getErr:      &retry.Error{HTTPStatusCode: http.StatusInternalServerError, RawError: fmt.Errorf("error")},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range testcases {
+		az := GetTestCloud(ctrl)
+		mockVMClient := az.VirtualMachinesClient.(*mockvmclient.MockInterface)
+		mockVMClient.EXPECT().GetSecurityProfile(gomock.Any(), az.ResourceGroup, "vm1").Return(test.profile, test.getErr).Times(1)
+
+		labels, err := az.GetNodeSecurityTypeLabels(types.NodeName("vm1"))
+		if test.expectedErr {
+			assert.Error(t, err, test.description)
+			continue
+		}
+		assert.NoError(t, err, test.description)
+		assert.Equal(t, test.expectedLabels, labels, test.description)
+	}
+}
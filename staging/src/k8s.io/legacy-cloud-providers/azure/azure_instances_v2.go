@@ -0,0 +1,117 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+)
+
+// InstanceExists returns true if the instance for the given node exists according to the cloud provider.
+// Use the node.name or node.spec.providerID field to find the node in the cloud provider.
+func (az *Cloud) InstanceExists(ctx context.Context, node *v1.Node) (bool, error) {
+	if node == nil {
+		return false, nil
+	}
+
+	providerID, err := az.providerIDForNode(ctx, node)
+	if err != nil {
+		if err == cloudprovider.InstanceNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return az.InstanceExistsByProviderID(ctx, providerID)
+}
+
+// InstanceShutdown returns true if the instance is shutdown according to the cloud provider.
+// Use the node.name or node.spec.providerID field to find the node in the cloud provider.
+func (az *Cloud) InstanceShutdown(ctx context.Context, node *v1.Node) (bool, error) {
+	if node == nil {
+		return false, nil
+	}
+
+	providerID, err := az.providerIDForNode(ctx, node)
+	if err != nil {
+		// Returns false, so the controller manager will continue to check InstanceExists().
+		if err == cloudprovider.InstanceNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return az.InstanceShutdownByProviderID(ctx, providerID)
+}
+
+// InstanceMetadata returns the instance's metadata. The values returned in InstanceMetadata are
+// translated into specific fields in the Node object on registration.
+// Use the node.name or node.spec.providerID field to find the node in the cloud provider.
+func (az *Cloud) InstanceMetadata(ctx context.Context, node *v1.Node) (*cloudprovider.InstanceMetadata, error) {
+	if node == nil {
+		return &cloudprovider.InstanceMetadata{}, nil
+	}
+
+	providerID, err := az.providerIDForNode(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeName := types.NodeName(node.Name)
+	instanceType, err := az.InstanceType(ctx, nodeName)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeAddresses, err := az.NodeAddresses(ctx, nodeName)
+	if err != nil {
+		return nil, err
+	}
+
+	klog.V(4).Infof("InstanceMetadata: node %q has providerID %q and instance type %q", node.Name, providerID, instanceType)
+	return &cloudprovider.InstanceMetadata{
+		ProviderID:    providerID,
+		InstanceType:  instanceType,
+		NodeAddresses: nodeAddresses,
+	}, nil
+}
+
+// providerIDForNode returns the providerID of the node, resolving it through
+// the VMSet when the node object is not initialized yet.
+func (az *Cloud) providerIDForNode(ctx context.Context, node *v1.Node) (string, error) {
+	if node.Spec.ProviderID != "" {
+		return node.Spec.ProviderID, nil
+	}
+
+	providerID, err := cloudprovider.GetInstanceProviderID(ctx, az, types.NodeName(node.Name))
+	if err != nil {
+		if strings.Contains(err.Error(), cloudprovider.InstanceNotFound.Error()) {
+			return "", cloudprovider.InstanceNotFound
+		}
+		klog.Errorf("providerIDForNode: failed to get the provider ID of node %s: %v", node.Name, err)
+		return "", err
+	}
+
+	return providerID, nil
+}
@@ -0,0 +1,218 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-12-01/compute"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/legacy-cloud-providers/azure/clients/interfaceclient/mockinterfaceclient"
+	"k8s.io/legacy-cloud-providers/azure/clients/vmclient/mockvmclient"
+	"k8s.io/legacy-cloud-providers/azure/retry"
+)
+
+func TestInstanceExists(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testcases := []struct {
+		name     string
+		node     *v1.Node
+		vmList   []string
+		expected bool
+	}{
+		{
+			name: "InstanceExists should return true when the node has a providerID and the VM exists",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "vm1"},
+				Spec:       v1.NodeSpec{ProviderID: "azure:///subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm1"},
+			},
+			vmList:   []string{"vm1"},
+			expected: true,
+		},
+		{
+			name: "InstanceExists should resolve the providerID from the node name when it is not set",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "vm1"},
+			},
+			vmList:   []string{"vm1"},
+			expected: true,
+		},
+		{
+			name: "InstanceExists should return false when the VM doesn't exist",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "vm3"},
+			},
+			vmList:   []string{"vm1"},
+			expected: false,
+		},
+		{
+			name:     "InstanceExists should return false for a nil node",
+			expected: false,
+		},
+	}
+
+	for _, test := range testcases {
+		cloud := GetTestCloud(ctrl)
+		vmListWithPowerState := make(map[string]string)
+		for _, vm := range test.vmList {
+			vmListWithPowerState[vm] = ""
+		}
+		expectedVMs := setTestVirtualMachines(cloud, vmListWithPowerState, false)
+		mockVMsClient := cloud.VirtualMachinesClient.(*mockvmclient.MockInterface)
+		for _, vm := range expectedVMs {
+			mockVMsClient.EXPECT().Get(gomock.Any(), cloud.ResourceGroup, *vm.Name, gomock.Any()).Return(vm, nil).AnyTimes()
+		}
+		mockVMsClient.EXPECT().Get(gomock.Any(), cloud.ResourceGroup, "vm3", gomock.Any()).Return(compute.VirtualMachine{}, &retry.Error{HTTPStatusCode: http.StatusNotFound, RawError: cloudprovider.InstanceNotFound}).AnyTimes()
+
+		exist, err := cloud.InstanceExists(context.Background(), test.node)
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, test.expected, exist, test.name)
+	}
+}
+
+func TestInstanceShutdown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testcases := []struct {
+		name     string
+		node     *v1.Node
+		vmList   map[string]string
+		expected bool
+	}{
+		{
+			name: "InstanceShutdown should return false when the VM is running",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "vm1"},
+				Spec:       v1.NodeSpec{ProviderID: "azure:///subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm1"},
+			},
+			vmList:   map[string]string{"vm1": "PowerState/Running"},
+			expected: false,
+		},
+		{
+			name: "InstanceShutdown should return true when the VM is deallocated",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "vm2"},
+				Spec:       v1.NodeSpec{ProviderID: "azure:///subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm2"},
+			},
+			vmList:   map[string]string{"vm2": "PowerState/Deallocated"},
+			expected: true,
+		},
+		{
+			name: "InstanceShutdown should return false when the VM doesn't exist",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "vm3"},
+			},
+			vmList:   map[string]string{"vm1": "PowerState/Running"},
+			expected: false,
+		},
+		{
+			name:     "InstanceShutdown should return false for a nil node",
+			expected: false,
+		},
+	}
+
+	for _, test := range testcases {
+		cloud := GetTestCloud(ctrl)
+		expectedVMs := setTestVirtualMachines(cloud, test.vmList, false)
+		mockVMsClient := cloud.VirtualMachinesClient.(*mockvmclient.MockInterface)
+		for _, vm := range expectedVMs {
+			mockVMsClient.EXPECT().Get(gomock.Any(), cloud.ResourceGroup, *vm.Name, gomock.Any()).Return(vm, nil).AnyTimes()
+		}
+		mockVMsClient.EXPECT().Get(gomock.Any(), cloud.ResourceGroup, "vm3", gomock.Any()).Return(compute.VirtualMachine{}, &retry.Error{HTTPStatusCode: http.StatusNotFound, RawError: cloudprovider.InstanceNotFound}).AnyTimes()
+
+		shutdown, err := cloud.InstanceShutdown(context.Background(), test.node)
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, test.expected, shutdown, test.name)
+	}
+}
+
+func TestInstanceMetadata(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cloud := GetTestCloud(ctrl)
+
+	expectedVM := compute.VirtualMachine{
+		Name: to.StringPtr("vm1"),
+		ID:   to.StringPtr("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm1"),
+		VirtualMachineProperties: &compute.VirtualMachineProperties{
+			ProvisioningState: to.StringPtr(string(compute.ProvisioningStateSucceeded)),
+			HardwareProfile: &compute.HardwareProfile{
+				VMSize: compute.VirtualMachineSizeTypesStandardA0,
+			},
+			NetworkProfile: &compute.NetworkProfile{
+				NetworkInterfaces: &[]compute.NetworkInterfaceReference{
+					{
+						NetworkInterfaceReferenceProperties: &compute.NetworkInterfaceReferenceProperties{
+							Primary: to.BoolPtr(true),
+						},
+						ID: to.StringPtr("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/nic"),
+					},
+				},
+			},
+		},
+	}
+
+	expectedInterface := network.Interface{
+		InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+			IPConfigurations: &[]network.InterfaceIPConfiguration{
+				{
+					InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+						PrivateIPAddress: to.StringPtr("172.1.0.3"),
+					},
+				},
+			},
+		},
+	}
+
+	mockVMsClient := cloud.VirtualMachinesClient.(*mockvmclient.MockInterface)
+	mockVMsClient.EXPECT().Get(gomock.Any(), cloud.ResourceGroup, "vm1", gomock.Any()).Return(expectedVM, nil).AnyTimes()
+
+	mockInterfaceClient := cloud.InterfacesClient.(*mockinterfaceclient.MockInterface)
+	mockInterfaceClient.EXPECT().Get(gomock.Any(), cloud.ResourceGroup, "nic", gomock.Any()).Return(expectedInterface, nil).AnyTimes()
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "vm1"},
+	}
+	metadata, err := cloud.InstanceMetadata(context.Background(), node)
+	assert.NoError(t, err)
+	assert.Equal(t, &cloudprovider.InstanceMetadata{
+		ProviderID:   "azure:///subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm1",
+		InstanceType: "Standard_A0",
+		NodeAddresses: []v1.NodeAddress{
+			{Type: v1.NodeInternalIP, Address: "172.1.0.3"},
+			{Type: v1.NodeHostName, Address: "vm1"},
+		},
+	}, metadata)
+
+	metadata, err = cloud.InstanceMetadata(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &cloudprovider.InstanceMetadata{}, metadata)
+}
@@ -0,0 +1,117 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// getServiceIPTags returns the Azure IP tags to set on the public IP created
+// for the service, parsed from the ServiceAnnotationPIPIPTags annotation or,
+// when the annotation is not set, from the publicIPIPTags cloud config
+// default. The second return reports whether IP tags are managed at all;
+// with neither source set existing IP tags are left untouched.
+func (az *Cloud) getServiceIPTags(service *v1.Service) (*[]network.IPTag, bool, error) {
+	value, found := service.Annotations[ServiceAnnotationPIPIPTags]
+	if !found {
+		if az.PublicIPIPTags == "" {
+			return nil, false, nil
+		}
+		value = az.PublicIPIPTags
+	}
+
+	ipTags, err := parseIPTags(value)
+	if err != nil {
+		return nil, false, fmt.Errorf("annotation %s of service %s: %v", ServiceAnnotationPIPIPTags, getServiceName(service), err)
+	}
+	return ipTags, true, nil
+}
+
+// parseIPTags parses a comma separated list of <type>=<value> pairs, e.g.
+// "RoutingPreference=Internet", into Azure IP tags. An empty list clears the
+// IP tags of the public IP.
+func parseIPTags(value string) (*[]network.IPTag, error) {
+	ipTags := []network.IPTag{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("ip tag %q is not of the form <type>=<value>", pair)
+		}
+		ipTags = append(ipTags, network.IPTag{
+			IPTagType: to.StringPtr(strings.TrimSpace(parts[0])),
+			Tag:       to.StringPtr(strings.TrimSpace(parts[1])),
+		})
+	}
+	return &ipTags, nil
+}
+
+// ipTagsEquivalent compares two IP tag collections ignoring order, treating
+// nil and empty collections as equal.
+func ipTagsEquivalent(a, b *[]network.IPTag) bool {
+	aTags := map[string]string{}
+	if a != nil {
+		for _, tag := range *a {
+			aTags[strings.ToLower(to.String(tag.IPTagType))] = to.String(tag.Tag)
+		}
+	}
+	bTags := map[string]string{}
+	if b != nil {
+		for _, tag := range *b {
+			bTags[strings.ToLower(to.String(tag.IPTagType))] = to.String(tag.Tag)
+		}
+	}
+
+	if len(aTags) != len(bTags) {
+		return false
+	}
+	for tagType, tag := range aTags {
+		if bTags[tagType] != tag {
+			return false
+		}
+	}
+	return true
+}
+
+// ensureServiceIPTags applies the managed IP tags of the service to the
+// public IP and returns whether they were changed.
+func (az *Cloud) ensureServiceIPTags(service *v1.Service, pip *network.PublicIPAddress) (bool, error) {
+	ipTags, managed, err := az.getServiceIPTags(service)
+	if err != nil {
+		return false, err
+	}
+	if !managed || pip.PublicIPAddressPropertiesFormat == nil {
+		return false, nil
+	}
+	if ipTagsEquivalent(pip.PublicIPAddressPropertiesFormat.IPTags, ipTags) {
+		return false, nil
+	}
+
+	pip.PublicIPAddressPropertiesFormat.IPTags = ipTags
+	return true, nil
+}
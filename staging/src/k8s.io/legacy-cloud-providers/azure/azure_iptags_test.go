@@ -0,0 +1,131 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestParseIPTags(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		value          string
+		expectedIPTags []network.IPTag
+		expectedError  bool
+	}{
+		{
+			desc:           "an empty list shall parse to no ip tags",
+			value:          "",
+			expectedIPTags: []network.IPTag{},
+		},
+		{
+			desc:  "pairs shall be parsed with surrounding spaces trimmed",
+			value: "RoutingPreference=Internet, FirstPartyUsage=SQL",
+			expectedIPTags: []network.IPTag{
+				{IPTagType: to.StringPtr("RoutingPreference"), Tag: to.StringPtr("Internet")},
+				{IPTagType: to.StringPtr("FirstPartyUsage"), Tag: to.StringPtr("SQL")},
+			},
+		},
+		{
+			desc:          "a pair without a value shall report an error",
+			value:         "RoutingPreference",
+			expectedError: true,
+		},
+		{
+			desc:          "a pair with an empty type shall report an error",
+			value:         "=Internet",
+			expectedError: true,
+		},
+	}
+
+	for i, test := range testCases {
+		ipTags, err := parseIPTags(test.value)
+		assert.Equal(t, test.expectedError, err != nil, "TestCase[%d]: %s", i, test.desc)
+		if test.expectedError {
+			continue
+		}
+		assert.Equal(t, test.expectedIPTags, *ipTags, "TestCase[%d]: %s", i, test.desc)
+	}
+}
+
+func TestIPTagsEquivalent(t *testing.T) {
+	routingInternet := network.IPTag{IPTagType: to.StringPtr("RoutingPreference"), Tag: to.StringPtr("Internet")}
+	firstPartySQL := network.IPTag{IPTagType: to.StringPtr("FirstPartyUsage"), Tag: to.StringPtr("SQL")}
+
+	assert.True(t, ipTagsEquivalent(nil, &[]network.IPTag{}))
+	assert.True(t, ipTagsEquivalent(
+		&[]network.IPTag{routingInternet, firstPartySQL},
+		&[]network.IPTag{firstPartySQL, routingInternet}))
+	assert.False(t, ipTagsEquivalent(nil, &[]network.IPTag{routingInternet}))
+	assert.False(t, ipTagsEquivalent(
+		&[]network.IPTag{routingInternet},
+		&[]network.IPTag{firstPartySQL}))
+}
+
+func TestEnsureServiceIPTags(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	pip := network.PublicIPAddress{
+		Name:                            to.StringPtr("pip1"),
+		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{},
+	}
+
+	// Without an annotation or config default the ip tags are not managed.
+	changed, err := az.ensureServiceIPTags(&svc, &pip)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Nil(t, pip.IPTags)
+
+	// The config default shall be applied to services without the annotation.
+	az.PublicIPIPTags = "RoutingPreference=Internet"
+	changed, err = az.ensureServiceIPTags(&svc, &pip)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, []network.IPTag{
+		{IPTagType: to.StringPtr("RoutingPreference"), Tag: to.StringPtr("Internet")},
+	}, *pip.IPTags)
+
+	// Applying the same ip tags again is a no-op.
+	changed, err = az.ensureServiceIPTags(&svc, &pip)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// The annotation shall override the config default, an empty annotation
+	// clearing the ip tags.
+	svc.Annotations[ServiceAnnotationPIPIPTags] = ""
+	changed, err = az.ensureServiceIPTags(&svc, &pip)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Empty(t, *pip.IPTags)
+
+	// A malformed annotation shall report an error.
+	svc.Annotations[ServiceAnnotationPIPIPTags] = "RoutingPreference"
+	_, err = az.ensureServiceIPTags(&svc, &pip)
+	assert.Error(t, err)
+}
@@ -0,0 +1,198 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/to"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	"k8s.io/legacy-cloud-providers/azure/clients/monitorclient"
+	"k8s.io/legacy-cloud-providers/azure/metrics"
+)
+
+const (
+	// lbMetricsCollectionInterval is how often the Azure Monitor metrics of
+	// the cluster load balancers are collected.
+	lbMetricsCollectionInterval = 5 * time.Minute
+
+	// lbFrontendIPDimension is the Azure Monitor dimension splitting load
+	// balancer metrics per frontend IP.
+	lbFrontendIPDimension = "FrontendIPAddress"
+)
+
+// lbMonitorMetricNames are the Azure Monitor platform metrics collected for
+// the cluster load balancers: data path availability, health probe status and
+// SNAT port usage.
+var lbMonitorMetricNames = []string{"VipAvailability", "DipAvailability", "SnatConnectionCount", "UsedSnatPorts"}
+
+// lbFrontendMetricValue is one collected datapoint attributed to the service
+// owning the frontend IP.
+type lbFrontendMetricValue struct {
+	service string
+	metric  string
+	value   float64
+}
+
+// lbMetricsCollector periodically queries Azure Monitor for the platform
+// metrics of the cluster load balancers and republishes them as Prometheus
+// metrics labeled by the owning service.
+type lbMetricsCollector struct {
+	az       *Cloud
+	interval time.Duration
+}
+
+// newLBMetricsCollector creates a new lbMetricsCollector.
+func (az *Cloud) newLBMetricsCollector(interval time.Duration) *lbMetricsCollector {
+	return &lbMetricsCollector{
+		az:       az,
+		interval: interval,
+	}
+}
+
+// run starts the collection loop. It never returns.
+func (c *lbMetricsCollector) run() {
+	err := wait.PollImmediateInfinite(c.interval, func() (bool, error) {
+		values, err := c.collect()
+		if err != nil {
+			klog.Warningf("lbMetricsCollector: failed to collect load balancer metrics: %v", err)
+			return false, nil
+		}
+		for _, value := range values {
+			metrics.LoadBalancerFrontendMetricSet(value.metric, value.service, value.value)
+		}
+		return false, nil
+	})
+	if err != nil { // this should never happen, if it does, panic
+		panic(err)
+	}
+}
+
+// collect queries Azure Monitor for the frontend metrics of the load
+// balancers in the load balancer resource group, split by frontend IP, and
+// attributes each time series to the owning service via the service tag of
+// the matching public IP.
+func (c *lbMetricsCollector) collect() ([]lbFrontendMetricValue, error) {
+	az := c.az
+	ipToService, err := az.getFrontendIPServiceOwners()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	lbs, rerr := az.LoadBalancerClient.List(ctx, az.getLoadBalancerResourceGroup())
+	if rerr != nil {
+		return nil, rerr.Error()
+	}
+
+	values := make([]lbFrontendMetricValue, 0)
+	for i := range lbs {
+		lb := lbs[i]
+		metricsCtx, metricsCancel := getContextWithCancel()
+		response, rerr := az.MonitorClient.ListMetrics(metricsCtx, to.String(lb.ID), lbMonitorMetricNames, lbFrontendIPDimension+" eq '*'")
+		metricsCancel()
+		if rerr != nil {
+			klog.Warningf("lbMetricsCollector: failed to list metrics of load balancer %s: %v", to.String(lb.Name), rerr.Error())
+			continue
+		}
+
+		for _, metric := range response.Value {
+			for _, series := range metric.Timeseries {
+				serviceName, found := ipToService[timeSeriesFrontendIP(series.MetadataValues)]
+				if !found {
+					continue
+				}
+				value, found := latestMetricValue(series.Data)
+				if !found {
+					continue
+				}
+				values = append(values, lbFrontendMetricValue{
+					service: serviceName,
+					metric:  metric.Name.Value,
+					value:   value,
+				})
+			}
+		}
+	}
+
+	return values, nil
+}
+
+// getFrontendIPServiceOwners maps the frontend IP addresses of the cluster
+// load balancers to the services owning them, based on the service tag of the
+// provider-managed public IPs.
+func (az *Cloud) getFrontendIPServiceOwners() (map[string]string, error) {
+	resourceGroups := []string{az.ResourceGroup}
+	if az.PublicIPResourceGroup != "" && !strings.EqualFold(az.PublicIPResourceGroup, az.ResourceGroup) {
+		resourceGroups = append(resourceGroups, az.PublicIPResourceGroup)
+	}
+
+	ipToService := make(map[string]string)
+	for _, resourceGroup := range resourceGroups {
+		ctx, cancel := getContextWithCancel()
+		pips, rerr := az.PublicIPAddressesClient.List(ctx, resourceGroup)
+		cancel()
+		if rerr != nil {
+			return nil, rerr.Error()
+		}
+
+		for i := range pips {
+			pip := pips[i]
+			if pip.Tags == nil || pip.Tags[serviceTagKey] == nil || pip.PublicIPAddressPropertiesFormat == nil {
+				continue
+			}
+			if ipAddress := to.String(pip.IPAddress); ipAddress != "" {
+				ipToService[ipAddress] = to.String(pip.Tags[serviceTagKey])
+			}
+		}
+	}
+
+	return ipToService, nil
+}
+
+// timeSeriesFrontendIP extracts the frontend IP dimension value of the time
+// series, or an empty string when the dimension is absent.
+func timeSeriesFrontendIP(metadataValues []monitorclient.MetadataValue) string {
+	for _, metadata := range metadataValues {
+		if strings.EqualFold(metadata.Name.Value, lbFrontendIPDimension) {
+			return metadata.Value
+		}
+	}
+	return ""
+}
+
+// latestMetricValue picks the most recent datapoint carrying a value,
+// preferring the average aggregation over maximum and total.
+func latestMetricValue(data []monitorclient.MetricValue) (float64, bool) {
+	for i := len(data) - 1; i >= 0; i-- {
+		switch {
+		case data[i].Average != nil:
+			return *data[i].Average, true
+		case data[i].Maximum != nil:
+			return *data[i].Maximum, true
+		case data[i].Total != nil:
+			return *data[i].Total, true
+		}
+	}
+	return 0, false
+}
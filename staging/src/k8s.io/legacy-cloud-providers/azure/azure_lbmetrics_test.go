@@ -0,0 +1,113 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/legacy-cloud-providers/azure/clients/loadbalancerclient/mockloadbalancerclient"
+	"k8s.io/legacy-cloud-providers/azure/clients/monitorclient"
+	"k8s.io/legacy-cloud-providers/azure/clients/monitorclient/mockmonitorclient"
+	"k8s.io/legacy-cloud-providers/azure/clients/publicipclient/mockpublicipclient"
+)
+
+func TestLBMetricsCollectorCollect(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	collector := az.newLBMetricsCollector(lbMetricsCollectionInterval)
+
+	lbID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/testCluster"
+	mockLBsClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBsClient.EXPECT().List(gomock.Any(), az.ResourceGroup).Return([]network.LoadBalancer{
+		{
+			ID:   to.StringPtr(lbID),
+			Name: to.StringPtr(testClusterName),
+		},
+	}, nil).Times(1)
+
+	mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPsClient.EXPECT().List(gomock.Any(), az.ResourceGroup).Return([]network.PublicIPAddress{
+		{
+			Name: to.StringPtr("pip1"),
+			Tags: map[string]*string{serviceTagKey: to.StringPtr("default/service1")},
+			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+				IPAddress: to.StringPtr("1.2.3.4"),
+			},
+		},
+		{
+			// Not provider-managed, never attributed to a service.
+			Name: to.StringPtr("pip2"),
+			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+				IPAddress: to.StringPtr("5.6.7.8"),
+			},
+		},
+	}, nil).Times(1)
+
+	stale, fresh, usedPorts := float64(50), float64(100), float64(12)
+	mockMonitorClient := az.MonitorClient.(*mockmonitorclient.MockInterface)
+	mockMonitorClient.EXPECT().ListMetrics(gomock.Any(), lbID, lbMonitorMetricNames, "FrontendIPAddress eq '*'").Return(monitorclient.MetricsResponse{
+		Value: []monitorclient.Metric{
+			{
+				Name: monitorclient.LocalizableString{Value: "VipAvailability"},
+				Timeseries: []monitorclient.TimeSeriesElement{
+					{
+						MetadataValues: []monitorclient.MetadataValue{
+							{Name: monitorclient.LocalizableString{Value: "frontendipaddress"}, Value: "1.2.3.4"},
+						},
+						// The latest datapoint wins.
+						Data: []monitorclient.MetricValue{{Average: &stale}, {Average: &fresh}},
+					},
+					{
+						// Frontend without a provider-managed public IP, skipped.
+						MetadataValues: []monitorclient.MetadataValue{
+							{Name: monitorclient.LocalizableString{Value: "frontendipaddress"}, Value: "5.6.7.8"},
+						},
+						Data: []monitorclient.MetricValue{{Average: &fresh}},
+					},
+				},
+			},
+			{
+				Name: monitorclient.LocalizableString{Value: "UsedSnatPorts"},
+				Timeseries: []monitorclient.TimeSeriesElement{
+					{
+						MetadataValues: []monitorclient.MetadataValue{
+							{Name: monitorclient.LocalizableString{Value: "frontendipaddress"}, Value: "1.2.3.4"},
+						},
+						// Average missing on the newest datapoint, fall back to maximum.
+						Data: []monitorclient.MetricValue{{Maximum: &usedPorts}},
+					},
+				},
+			},
+		},
+	}, nil).Times(1)
+
+	values, err := collector.collect()
+	assert.NoError(t, err)
+	assert.Equal(t, []lbFrontendMetricValue{
+		{service: "default/service1", metric: "VipAvailability", value: 100},
+		{service: "default/service1", metric: "UsedSnatPorts", value: 12},
+	}, values)
+}
@@ -22,21 +22,28 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"net/http"
 	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
 	"github.com/Azure/go-autorest/autorest/to"
 
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/sets"
 	cloudprovider "k8s.io/cloud-provider"
 	servicehelpers "k8s.io/cloud-provider/service/helpers"
 	"k8s.io/klog/v2"
 	azcache "k8s.io/legacy-cloud-providers/azure/cache"
+	"k8s.io/legacy-cloud-providers/azure/metrics"
 	"k8s.io/legacy-cloud-providers/azure/retry"
+	"k8s.io/legacy-cloud-providers/azure/trace"
 	utilnet "k8s.io/utils/net"
 )
 
@@ -48,6 +55,31 @@ const (
 	// to specify what subnet it is exposed on
 	ServiceAnnotationLoadBalancerInternalSubnet = "service.beta.kubernetes.io/azure-load-balancer-internal-subnet"
 
+	// ServiceAnnotationLoadBalancerInternalGlobal is the annotation used on the
+	// service to place its frontend on the global tier of internal load
+	// balancing (a cross-region ILB frontend), so multiple regions can be
+	// fronted by a single internal IP. It requires the internal annotation and
+	// the standard load balancer SKU. Global and regional tier frontends
+	// cannot share a load balancer, so the service lands on a separate load
+	// balancer with the -global-internal suffix.
+	ServiceAnnotationLoadBalancerInternalGlobal = "service.beta.kubernetes.io/azure-load-balancer-internal-global"
+
+	// ServiceAnnotationLoadBalancerFrontendKey is the annotation used on the
+	// service to derive the names of its load balancer resources from a
+	// stable, user-chosen key instead of the service UID. Deleting and
+	// recreating a service with the same key then re-binds the same public IP
+	// and frontend IP configuration instead of allocating a new IP, which
+	// GitOps flows that recreate services rely on. The key must be unique
+	// among the services of the cluster.
+	ServiceAnnotationLoadBalancerFrontendKey = "service.beta.kubernetes.io/azure-load-balancer-frontend-key"
+
+	// ServiceAnnotationLoadBalancerEnableHighAvailabilityPorts is the
+	// annotation used on the service to front it with a single HA-ports rule
+	// (protocol All, port 0) that forwards every port, instead of one rule
+	// per ServicePort. This is the usual setup for NVA-style workloads. It
+	// requires an internal load balancer with the standard SKU.
+	ServiceAnnotationLoadBalancerEnableHighAvailabilityPorts = "service.beta.kubernetes.io/azure-load-balancer-enable-high-availability-ports"
+
 	// ServiceAnnotationLoadBalancerMode is the annotation used on the service to specify the
 	// Azure load balancer selection based on availability sets
 	// There are currently three possible load balancer selection modes :
@@ -81,15 +113,127 @@ const (
 	// ServiceAnnotationPIPName specifies the pip that will be applied to load balancer
 	ServiceAnnotationPIPName = "service.beta.kubernetes.io/azure-pip-name"
 
+	// ServiceAnnotationPIPID specifies the full resource ID of a pre-created
+	// public IP that will be applied to the load balancer frontend. Unlike
+	// loadBalancerIP it binds the frontend directly, without scanning
+	// resource groups for a matching address. The referenced public IP must
+	// already exist.
+	ServiceAnnotationPIPID = "service.beta.kubernetes.io/azure-pip-id"
+
+	// ServiceAnnotationPIPPrefixID specifies the resource ID of the public IP
+	// prefix that the provider-created public IP of the service is allocated
+	// from, keeping all service IPs inside one contiguous range. Only
+	// effective with the standard load balancer SKU and when the public IP
+	// is created by the provider.
+	ServiceAnnotationPIPPrefixID = "service.beta.kubernetes.io/azure-pip-prefix-id"
+
+	// ServiceAnnotationPIPIPTags specifies the Azure IP tags set on the
+	// public IP created for the service, as a comma separated list of
+	// <type>=<value> pairs (e.g. "RoutingPreference=Internet"). It overrides
+	// the publicIPIPTags cloud config default and is reconciled on update.
+	ServiceAnnotationPIPIPTags = "service.beta.kubernetes.io/azure-pip-ip-tags"
+
+	// ServiceAnnotationPIPResourceGroup is the annotation used on the service
+	// to specify the resource group where the provider-created public IP of
+	// the service is placed, overriding the publicIPResourceGroup cloud
+	// config option.
+	ServiceAnnotationPIPResourceGroup = "service.beta.kubernetes.io/azure-pip-resource-group"
+
+	// ServiceAnnotationDisableLoadBalancerOutboundSNAT overrides the cluster
+	// wide disableOutboundSNAT setting on the load balancing rules of this
+	// service, so that backend nodes don't consume SNAT ports via the rule's
+	// frontend IP when a NAT gateway handles outbound traffic. Only effective
+	// with the standard load balancer SKU.
+	ServiceAnnotationDisableLoadBalancerOutboundSNAT = "service.beta.kubernetes.io/azure-disable-load-balancer-outbound-snat"
+
+	// ServiceAnnotationGatewayLoadBalancer specifies the resource ID of a
+	// gateway load balancer frontend IP configuration that traffic of the
+	// service is chained through, typically for inspection by a network
+	// virtual appliance. The referenced frontend must already exist. Only
+	// effective on public services with the standard load balancer SKU.
+	ServiceAnnotationGatewayLoadBalancer = "service.beta.kubernetes.io/azure-load-balancer-gateway-lb"
+
+	// ServiceAnnotationPIPAllowUpgrade consents to an in-place upgrade of the
+	// public IP (Dynamic to Static allocation, Basic to Standard SKU) when the
+	// cluster uses a standard load balancer that cannot attach the IP as is.
+	ServiceAnnotationPIPAllowUpgrade = "service.beta.kubernetes.io/azure-pip-allow-upgrade"
+
 	// ServiceAnnotationAllowedServiceTag is the annotation used on the service
 	// to specify a list of allowed service tags separated by comma
 	// Refer https://docs.microsoft.com/en-us/azure/virtual-network/security-overview#service-tags for all supported service tags.
 	ServiceAnnotationAllowedServiceTag = "service.beta.kubernetes.io/azure-allowed-service-tags"
 
+	// ServiceAnnotationLoadBalancerSourceRangeGroups names groups of the
+	// service's loadBalancerSourceRanges, e.g.
+	// "office=203.0.113.0/24,198.51.100.0/24;partner=192.0.2.0/24". Each group
+	// becomes a single security rule carrying the group name and all of its
+	// CIDRs, instead of one opaque rule per CIDR, which keeps large rule sets
+	// auditable. Ranges not claimed by any group keep the per-CIDR rules.
+	ServiceAnnotationLoadBalancerSourceRangeGroups = "service.beta.kubernetes.io/azure-load-balancer-source-range-groups"
+
+	// ServiceAnnotationDestinationApplicationSecurityGroups is the annotation
+	// used on the service to specify a comma separated list of Application
+	// Security Group resource IDs used as the destination of the generated
+	// security rules instead of the frontend IP. The rule count then stays
+	// constant when frontend IPs change. It cannot be combined with
+	// ServiceAnnotationSharedSecurityRule, whose membership is tracked through
+	// the destination address prefixes.
+	ServiceAnnotationDestinationApplicationSecurityGroups = "service.beta.kubernetes.io/azure-destination-application-security-group-ids"
+
+	// ServiceAnnotationDenySourceRanges is the annotation used on the service
+	// to specify a comma separated list of CIDRs that get explicit deny rules
+	// in addition to the generated allow rules. The deny rules of a reconcile
+	// are assigned priorities ahead of its allow rules, so a denied CIDR inside
+	// an allowed range is blocked. It cannot be combined with
+	// ServiceAnnotationSharedSecurityRule, whose rules are shared across
+	// services.
+	ServiceAnnotationDenySourceRanges = "service.beta.kubernetes.io/azure-deny-source-ranges"
+
+	// ServiceAnnotationSecurityRulePriority is the annotation used on the
+	// service to specify the preferred priority band for its generated security
+	// rules. Allocation scans upwards from the given priority, so a taken
+	// priority falls through to the next free one. Without the annotation the
+	// scan starts at the default minimum priority.
+	ServiceAnnotationSecurityRulePriority = "service.beta.kubernetes.io/azure-security-rule-priority"
+
+	// ServiceAnnotationSecurityRuleSourcePortRange is the annotation used on
+	// the service to narrow the source port range of its generated security
+	// rules, which otherwise allow any source port. The value is a single port
+	// or a low-high port range, e.g. "1024-65535".
+	ServiceAnnotationSecurityRuleSourcePortRange = "service.beta.kubernetes.io/azure-security-rule-source-port-range"
+
+	// ServiceAnnotationSecurityRulePairedOutbound is the annotation used on
+	// the service to generate an outbound allow rule for every inbound allow
+	// rule, permitting the backends to answer in security groups whose
+	// outbound default denies traffic. Stateful security groups don't need
+	// this; it exists for locked-down baselines.
+	ServiceAnnotationSecurityRulePairedOutbound = "service.beta.kubernetes.io/azure-security-rule-paired-outbound"
+
 	// ServiceAnnotationLoadBalancerIdleTimeout is the annotation used on the service
 	// to specify the idle timeout for connections on the load balancer in minutes.
 	ServiceAnnotationLoadBalancerIdleTimeout = "service.beta.kubernetes.io/azure-load-balancer-tcp-idle-timeout"
 
+	// ServiceAnnotationLoadBalancerDistributionMode is the annotation used on
+	// the service to pick the load distribution of its rules when the service
+	// has ClientIP session affinity. The default is SourceIP (two-tuple
+	// stickiness); SourceIPProtocol selects the three-tuple variant. The
+	// annotation is ignored without ClientIP affinity.
+	ServiceAnnotationLoadBalancerDistributionMode = "service.beta.kubernetes.io/azure-load-balancer-distribution-mode"
+
+	// ServiceAnnotationLoadBalancerIdleTimeoutPortFmt is the per-port variant
+	// of ServiceAnnotationLoadBalancerIdleTimeout. It overrides the
+	// service-wide value for the rule of one frontend port, e.g.
+	// service.beta.kubernetes.io/azure-load-balancer-tcp-idle-timeout-8080.
+	ServiceAnnotationLoadBalancerIdleTimeoutPortFmt = "service.beta.kubernetes.io/azure-load-balancer-tcp-idle-timeout-%d"
+
+	// ServiceAnnotationLoadBalancerEnableTCPResetPortFmt is the per-port
+	// variant of the TCP reset behavior. It overrides the SKU default for the
+	// rule of one frontend port, e.g.
+	// service.beta.kubernetes.io/azure-load-balancer-enable-tcp-reset-8080.
+	// TCP reset is only available on the standard load balancer SKU; the
+	// annotation is ignored on the basic SKU.
+	ServiceAnnotationLoadBalancerEnableTCPResetPortFmt = "service.beta.kubernetes.io/azure-load-balancer-enable-tcp-reset-%d"
+
 	// ServiceAnnotationLoadBalancerMixedProtocols is the annotation used on the service
 	// to create both TCP and UDP protocols when creating load balancer rules.
 	ServiceAnnotationLoadBalancerMixedProtocols = "service.beta.kubernetes.io/azure-load-balancer-mixed-protocols"
@@ -99,17 +243,116 @@ const (
 	// TODO(feiskyer): disable-tcp-reset annotations has been depracated since v1.18, it would removed on v1.20.
 	ServiceAnnotationLoadBalancerDisableTCPReset = "service.beta.kubernetes.io/azure-load-balancer-disable-tcp-reset"
 
+	// ServiceAnnotationLoadBalancerEnablePortRanges is the annotation used on the
+	// service to coalesce contiguous service ports of the same protocol into
+	// inbound NAT pools instead of one load balancing rule and probe per port,
+	// so that services exposing large sequential port ranges do not exhaust the
+	// load balancer rule limit.
+	ServiceAnnotationLoadBalancerEnablePortRanges = "service.beta.kubernetes.io/azure-load-balancer-enable-port-ranges"
+
+	// ServiceAnnotationLoadBalancerClass is the load balancer class of the
+	// service, standing in for service.spec.loadBalancerClass which is not
+	// present in this API version. Services carrying a class other than the
+	// one the provider claims (see LoadBalancerClassName) are left entirely
+	// to the alternative controller owning that class: no load balancer,
+	// public IP or security group work and no status updates.
+	ServiceAnnotationLoadBalancerClass = "service.beta.kubernetes.io/azure-load-balancer-class"
+
+	// ServiceAnnotationLoadBalancerHealthProbePort points the load balancer
+	// health probes of a Cluster-policy service at the given node port instead
+	// of the service node port, for example a node-local health agent that
+	// also notices kube-proxy or CNI outages.
+	ServiceAnnotationLoadBalancerHealthProbePort = "service.beta.kubernetes.io/azure-load-balancer-health-probe-port"
+
+	// ServiceAnnotationLoadBalancerHealthProbeRequestPath makes the health
+	// probes of a Cluster-policy service HTTP probes against the given path.
+	// It takes effect together with ServiceAnnotationLoadBalancerHealthProbePort
+	// or ServiceAnnotationLoadBalancerHealthProbeProtocol.
+	ServiceAnnotationLoadBalancerHealthProbeRequestPath = "service.beta.kubernetes.io/azure-load-balancer-health-probe-request-path"
+
+	// ServiceAnnotationLoadBalancerHealthProbeProtocol overrides the protocol
+	// of the health probes created next to the load balancing rules (Tcp,
+	// Http or Https). Http and Https probes request the path given by
+	// ServiceAnnotationLoadBalancerHealthProbeRequestPath, defaulting to
+	// /healthz, so backends that only answer HTTPS on a health endpoint stay
+	// probeable.
+	ServiceAnnotationLoadBalancerHealthProbeProtocol = "service.beta.kubernetes.io/azure-load-balancer-health-probe-protocol"
+
+	// ServiceAnnotationLoadBalancerHealthProbeInterval is the interval in
+	// seconds between two consecutive health probes.
+	ServiceAnnotationLoadBalancerHealthProbeInterval = "service.beta.kubernetes.io/azure-load-balancer-health-probe-interval"
+
+	// ServiceAnnotationLoadBalancerHealthProbeNumOfProbe is the number of
+	// consecutive probe failures after which a backend is taken out of
+	// rotation.
+	ServiceAnnotationLoadBalancerHealthProbeNumOfProbe = "service.beta.kubernetes.io/azure-load-balancer-health-probe-num-of-probe"
+
+	// ServiceAnnotationPLSProxyProtocol declares that the private link service
+	// attached to the internal load balancer frontend of this service carries
+	// PROXY protocol v2. Probe traffic is not wrapped in PROXY headers, so
+	// the health probes of such a service must stay plain TCP; combining the
+	// annotation with HTTP probes is rejected. The network API version used
+	// here cannot toggle enableProxyProtocol on the private link service
+	// itself, hence an event reminds the operator to enable it there.
+	ServiceAnnotationPLSProxyProtocol = "service.beta.kubernetes.io/azure-pls-proxy-protocol"
+
 	// serviceTagKey is the service key applied for public IP tags.
 	serviceTagKey = "service"
 	// clusterNameKey is the cluster name key applied for public IP tags.
 	clusterNameKey = "kubernetes-cluster-name"
+	// dnsLabelServiceTagKey is the public IP tag recording which service owns
+	// the DNS label of the IP, so that label conflicts between services are
+	// detected and an orphaned label is cleared when the annotation is
+	// removed.
+	dnsLabelServiceTagKey = "kubernetes-dns-label-service"
+	// releasedAtTagKey is the public IP tag recording when the provider
+	// released the IP, so that it is deleted only after the configured grace
+	// period and can be recovered in between.
+	releasedAtTagKey = "k8s-azure-released-at"
+	// createdForUIDTagKey is the public IP tag recording the UID of the
+	// service the IP was created for, surviving service re-creations under
+	// the same name for audit purposes.
+	createdForUIDTagKey = "k8s-azure-created-for-uid"
+	// createdAtTagKey is the public IP tag recording when the provider
+	// created the IP.
+	createdAtTagKey = "k8s-azure-created-at"
+	// reconcileCountTagKey is the public IP tag counting how often the
+	// provider has written the resource.
+	reconcileCountTagKey = "k8s-azure-reconcile-count"
+
+	// externallyOwnedLBTagKey marks a load balancer as owned by an operator
+	// outside this cluster. Setting it to "true" on the load balancer resource
+	// makes the provider manage only its own frontends, rules and probes on it
+	// and never delete the resource, so that e.g. an internal load balancer
+	// can be shared by two clusters during a migration.
+	externallyOwnedLBTagKey = "k8s-azure-externally-owned"
 
 	defaultLoadBalancerSourceRanges = "0.0.0.0/0"
+
+	// Default health probe settings, overridable per service through the
+	// health probe annotations.
+	defaultHealthProbeInterval    = 5
+	defaultHealthProbeNumOfProbe  = 2
+	defaultHealthProbeRequestPath = "/healthz"
 )
 
 // GetLoadBalancer returns whether the specified load balancer and its components exist, and
 // if so, what its status is.
 func (az *Cloud) GetLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) (status *v1.LoadBalancerStatus, exists bool, err error) {
+	// Services of another load balancer class never have a load balancer
+	// created by this provider, so report not-found without any lookups.
+	if !az.ownsLoadBalancerService(service) {
+		return nil, false, nil
+	}
+	service = az.applyDefaultServiceAnnotations(service)
+
+	// Fast path: derive the status from the public IP carrying the service's
+	// ownership tags, so that mass status resyncs don't have to list and scan
+	// all load balancers.
+	if status, ok := az.getLoadBalancerStatusFastPath(clusterName, service); ok {
+		return status, true, nil
+	}
+
 	// Since public IP is not a part of the load balancer on Azure,
 	// there is a chance that we could orphan public IP resources while we delete the load blanacer (kubernetes/kubernetes#80571).
 	// We need to make sure the existence of the load balancer depends on the load balancer resource and public IP resource on Azure.
@@ -142,6 +385,46 @@ func (az *Cloud) GetLoadBalancer(ctx context.Context, clusterName string, servic
 	return status, true, nil
 }
 
+// getLoadBalancerStatusFastPath derives the load balancer status of an
+// external service from its provider-owned public IP instead of enumerating
+// all load balancers. It returns false whenever it cannot answer
+// authoritatively, in which case the caller falls back to the full scan.
+func (az *Cloud) getLoadBalancerStatusFastPath(clusterName string, service *v1.Service) (*v1.LoadBalancerStatus, bool) {
+	if requiresInternalLoadBalancer(service) {
+		// Internal services have no public IP to inspect.
+		return nil, false
+	}
+
+	pipName, shouldPIPExisted, err := az.determinePublicIPName(clusterName, service)
+	if err != nil || shouldPIPExisted {
+		// Bring-your-own public IPs don't carry the service ownership tags.
+		return nil, false
+	}
+
+	pipResourceGroup := az.getPublicIPAddressResourceGroup(service)
+	pip, existsPip, err := az.getPublicIPAddress(pipResourceGroup, pipName)
+	if err != nil || !existsPip {
+		return nil, false
+	}
+	if !az.ownsPublicIP(&pip, clusterName, getServiceName(service)) {
+		return nil, false
+	}
+	if pip.PublicIPAddressPropertiesFormat == nil || pip.IPConfiguration == nil || pip.IPAddress == nil {
+		// A detached public IP says nothing about the load balancer frontend.
+		return nil, false
+	}
+
+	// Verify the referenced frontend IP configuration carries the name computed
+	// for the service before trusting the fast path.
+	frontendIPConfigName, err := getLastSegment(to.String(pip.IPConfiguration.ID), "/")
+	if err != nil || !strings.EqualFold(frontendIPConfigName, az.getFrontendIPConfigName(service)) {
+		return nil, false
+	}
+
+	klog.V(4).Infof("getLoadBalancerStatusFastPath(%s): resolved status from pip(%s)", getServiceName(service), pipName)
+	return &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: to.String(pip.IPAddress)}}}, true
+}
+
 func getPublicIPDomainNameLabel(service *v1.Service) (string, bool) {
 	if labelName, found := service.Annotations[ServiceAnnotationDNSLabelName]; found {
 		return labelName, found
@@ -149,15 +432,44 @@ func getPublicIPDomainNameLabel(service *v1.Service) (string, bool) {
 	return "", false
 }
 
+// getPublicIPPrefixID returns the resource ID of the public IP prefix
+// requested through the ServiceAnnotationPIPPrefixID annotation, or an empty
+// string when the annotation is not set.
+func getPublicIPPrefixID(service *v1.Service) string {
+	return strings.TrimSpace(service.Annotations[ServiceAnnotationPIPPrefixID])
+}
+
 // EnsureLoadBalancer creates a new load balancer 'name', or updates the existing one. Returns the status of the balancer
-func (az *Cloud) EnsureLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+func (az *Cloud) EnsureLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (status *v1.LoadBalancerStatus, err error) {
 	// When a client updates the internal load balancer annotation,
 	// the service may be switched from an internal LB to a public one, or vise versa.
 	// Here we'll firstly ensure service do not lie in the opposite LB.
+	if !az.ownsLoadBalancerService(service) {
+		klog.V(2).Infof("EnsureLoadBalancer: skipping service %s with load balancer class %q", getServiceName(service), service.Annotations[ServiceAnnotationLoadBalancerClass])
+		return nil, cloudprovider.ImplementedElsewhere
+	}
+	service = az.applyDefaultServiceAnnotations(service)
+	if err := az.checkReadOnly(service, "EnsureLoadBalancer"); err != nil {
+		return nil, err
+	}
+
+	// Hold the reconcile until the startup cache warm-up has finished, so the
+	// burst of service syncs after a controller restart is served from warm
+	// caches instead of stampeding ARM.
+	az.waitForCacheWarmup()
+
 	serviceName := getServiceName(service)
 	klog.V(5).Infof("ensureloadbalancer(%s): START clusterName=%q", serviceName, clusterName)
+	az.recordClusterName(clusterName)
+
+	ctx, span := trace.StartSpan(ctx, "EnsureLoadBalancer")
+	span.SetAttribute("service", serviceName)
+	span.SetAttribute("cluster", clusterName)
+	defer func() { span.End(err) }()
 
+	_, lbSpan := trace.StartSpan(ctx, "reconcileLoadBalancer")
 	lb, err := az.reconcileLoadBalancer(clusterName, service, nodes, true /* wantLb */)
+	lbSpan.End(err)
 	if err != nil {
 		klog.Errorf("reconcileLoadBalancer(%s) failed: %v", serviceName, err)
 		return nil, err
@@ -174,7 +486,10 @@ func (az *Cloud) EnsureLoadBalancer(ctx context.Context, clusterName string, ser
 		serviceIP = &lbStatus.Ingress[0].IP
 	}
 	klog.V(2).Infof("EnsureLoadBalancer: reconciling security group for service %q with IP %q, wantLb = true", serviceName, logSafe(serviceIP))
-	if _, err := az.reconcileSecurityGroup(clusterName, service, serviceIP, true /* wantLb */); err != nil {
+	_, nsgSpan := trace.StartSpan(ctx, "reconcileSecurityGroup")
+	_, err = az.reconcileSecurityGroup(clusterName, service, serviceIP, true /* wantLb */)
+	nsgSpan.End(err)
+	if err != nil {
 		klog.Errorf("reconcileSecurityGroup(%s) failed: %#v", serviceName, err)
 		return nil, err
 	}
@@ -192,11 +507,20 @@ func (az *Cloud) EnsureLoadBalancer(ctx context.Context, clusterName string, ser
 		return nil, err
 	}
 
+	az.updateServiceReconcileStatus(service, lb)
+
 	return lbStatus, nil
 }
 
 // UpdateLoadBalancer updates hosts under the specified load balancer.
 func (az *Cloud) UpdateLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) error {
+	if !az.ownsLoadBalancerService(service) {
+		return cloudprovider.ImplementedElsewhere
+	}
+	service = az.applyDefaultServiceAnnotations(service)
+	if err := az.checkReadOnly(service, "UpdateLoadBalancer"); err != nil {
+		return err
+	}
 	if !az.shouldUpdateLoadBalancer(clusterName, service) {
 		klog.V(2).Infof("UpdateLoadBalancer: skipping service %s because it is either being deleted or does not exist anymore", service.Name)
 		return nil
@@ -212,6 +536,10 @@ func (az *Cloud) UpdateLoadBalancer(ctx context.Context, clusterName string, ser
 // have multiple underlying components, meaning a Get could say that the LB
 // doesn't exist even if some part of it is still laying around.
 func (az *Cloud) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, service *v1.Service) error {
+	service = az.applyDefaultServiceAnnotations(service)
+	if err := az.checkReadOnly(service, "EnsureLoadBalancerDeleted"); err != nil {
+		return err
+	}
 	isInternal := requiresInternalLoadBalancer(service)
 	serviceName := getServiceName(service)
 	klog.V(5).Infof("Delete service (%s): START clusterName=%q", serviceName, clusterName)
@@ -230,6 +558,10 @@ func (az *Cloud) EnsureLoadBalancerDeleted(ctx context.Context, clusterName stri
 		return err
 	}
 
+	if err := az.cleanupEmptyLoadBalancers(clusterName, service); err != nil && !retry.HasStatusForbiddenOrIgnoredError(err) {
+		return err
+	}
+
 	if _, err := az.reconcilePublicIP(clusterName, service, "", false /* wantLb */); err != nil {
 		return err
 	}
@@ -238,11 +570,146 @@ func (az *Cloud) EnsureLoadBalancerDeleted(ctx context.Context, clusterName stri
 	return nil
 }
 
+// isLoadBalancerExternallyOwned reports whether the load balancer is marked
+// as owned by an operator outside this cluster through the
+// externallyOwnedLBTagKey tag. The provider still reconciles its own
+// frontends, rules and probes on such a load balancer - those are scoped by
+// the service UID prefix and the cluster backend pool name, so multiple
+// clusters do not collide - but it never deletes the resource itself.
+func isLoadBalancerExternallyOwned(lb *network.LoadBalancer) bool {
+	if lb == nil || lb.Tags == nil {
+		return false
+	}
+	return strings.EqualFold(to.String(lb.Tags[externallyOwnedLBTagKey]), "true")
+}
+
+// clusterOwnedBackendPoolName returns the name of the backend pool through
+// which the cluster owns the load balancer, or an empty string when the load
+// balancer carries no such pool. Only load balancers carrying the cluster
+// backend pool are owned by the provider; anything else in the resource
+// group is left alone.
+func (az *Cloud) clusterOwnedBackendPoolName(clusterName string, lb *network.LoadBalancer) string {
+	poolBaseName := clusterName
+	if az.LoadBalancerBackendPoolName != "" {
+		poolBaseName = az.LoadBalancerBackendPoolName
+	}
+	if lb.LoadBalancerPropertiesFormat == nil || lb.BackendAddressPools == nil {
+		return ""
+	}
+	for _, pool := range *lb.BackendAddressPools {
+		poolName := to.String(pool.Name)
+		if strings.EqualFold(poolName, poolBaseName) || strings.EqualFold(poolName, fmt.Sprintf("%s-IPv6", poolBaseName)) {
+			return poolName
+		}
+	}
+	return ""
+}
+
+// cleanupEmptyLoadBalancers deletes provider-owned load balancers that are
+// left without any frontend IP configurations, since they serve no traffic
+// and only count against the load balancer quota. The cluster default load
+// balancer is kept when using standard SKU because it provides outbound
+// connectivity for the nodes. Setting disableEmptyLoadBalancerCleanup in the
+// cloud config opts out of the cleanup.
+func (az *Cloud) cleanupEmptyLoadBalancers(clusterName string, service *v1.Service) error {
+	if az.DisableEmptyLoadBalancerCleanup || az.isBackendPoolPreConfigured(service) {
+		return nil
+	}
+
+	lbs, err := az.ListLB(service)
+	if err != nil {
+		return err
+	}
+
+	for i := range lbs {
+		lb := lbs[i]
+		lbName := to.String(lb.Name)
+		if lb.LoadBalancerPropertiesFormat == nil {
+			continue
+		}
+		if lb.FrontendIPConfigurations != nil && len(*lb.FrontendIPConfigurations) > 0 {
+			continue
+		}
+		if isLoadBalancerExternallyOwned(&lb) {
+			klog.V(4).Infof("cleanupEmptyLoadBalancers(%s): keeping externally owned lb(%s)", getServiceName(service), lbName)
+			continue
+		}
+
+		ownedPoolName := az.clusterOwnedBackendPoolName(clusterName, &lb)
+		if ownedPoolName == "" {
+			continue
+		}
+
+		// The cluster default load balancer provides outbound connectivity
+		// for standard SKU and must be kept even when empty.
+		if az.useStandardLoadBalancer() && strings.EqualFold(lbName, clusterName) {
+			klog.V(4).Infof("cleanupEmptyLoadBalancers(%s): keeping empty default outbound lb(%s)", getServiceName(service), lbName)
+			continue
+		}
+
+		// The listing spans multiple resource groups, so the backend pool ID
+		// and the delete must use the group the load balancer was listed
+		// from rather than the default one.
+		lbRgName := resourceID(to.String(lb.ID)).resourceGroup()
+		if lbRgName == "" {
+			lbRgName = az.getLoadBalancerResourceGroup()
+		}
+
+		// Remove backend pool references from vmSets before deleting the LB.
+		// This is required for virtual machine scale sets.
+		vmSetName := az.mapLoadBalancerNameToVMSet(lbName, clusterName)
+		lbBackendPoolID := az.getBackendPoolID(lbName, lbRgName, ownedPoolName)
+		if err := az.VMSet.EnsureBackendPoolDeleted(service, lbBackendPoolID, vmSetName, lb.BackendAddressPools); err != nil {
+			klog.Errorf("cleanupEmptyLoadBalancers(%s): EnsureBackendPoolDeleted(%s) failed: %v", getServiceName(service), lbBackendPoolID, err)
+			return err
+		}
+
+		klog.V(2).Infof("cleanupEmptyLoadBalancers(%s): deleting empty lb(%s)", getServiceName(service), lbName)
+		if err := az.DeleteLBInResourceGroup(service, lbRgName, lbName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // GetLoadBalancerName returns the LoadBalancer name.
 func (az *Cloud) GetLoadBalancerName(ctx context.Context, clusterName string, service *v1.Service) string {
+	if az.resourceNamer != nil {
+		return az.resourceNamer.ServiceResourceBaseName(service)
+	}
+	if key, ok := service.Annotations[ServiceAnnotationLoadBalancerFrontendKey]; ok {
+		if baseName := stableResourceBaseName(key); baseName != "" {
+			return baseName
+		}
+	}
 	return cloudprovider.DefaultLoadBalancerName(service)
 }
 
+// stableResourceBaseName derives the base name of the service resources from
+// a user-provided frontend key instead of the service UID, so a deleted and
+// recreated service carrying the same key re-binds its public IP and frontend
+// IP configuration. The key is reduced to the character set of the default
+// UID-derived names; an empty result falls back to the default naming.
+func stableResourceBaseName(key string) string {
+	var sanitized strings.Builder
+	for _, r := range strings.ToLower(key) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			sanitized.WriteRune(r)
+		}
+	}
+	if sanitized.Len() == 0 {
+		return ""
+	}
+
+	baseName := "a" + sanitized.String()
+	// Match the length cap of cloudprovider.DefaultLoadBalancerName.
+	if len(baseName) > 32 {
+		baseName = baseName[:32]
+	}
+	return baseName
+}
+
 func (az *Cloud) getLoadBalancerResourceGroup() string {
 	if az.LoadBalancerResourceGroup != "" {
 		return az.LoadBalancerResourceGroup
@@ -260,7 +727,7 @@ func (az *Cloud) getServiceLoadBalancer(service *v1.Service, clusterName string,
 	isInternal := requiresInternalLoadBalancer(service)
 	var defaultLB *network.LoadBalancer
 	primaryVMSetName := az.VMSet.GetPrimaryVMSetName()
-	defaultLBName := az.getAzureLoadBalancerName(clusterName, primaryVMSetName, isInternal)
+	defaultLBName := az.getAzureLoadBalancerName(service, clusterName, primaryVMSetName, isInternal)
 
 	existingLBs, err := az.ListLB(service)
 	if err != nil {
@@ -343,7 +810,7 @@ func (az *Cloud) selectLoadBalancer(clusterName string, service *v1.Service, exi
 	}
 	selectedLBRuleCount := math.MaxInt32
 	for _, currASName := range *vmSetNames {
-		currLBName := az.getAzureLoadBalancerName(clusterName, currASName, isInternal)
+		currLBName := az.getAzureLoadBalancerName(service, clusterName, currASName, isInternal)
 		lb, exists := mapExistingLBs[currLBName]
 		if !exists {
 			// select this LB as this is a new LB and will have minimum rules
@@ -429,8 +896,83 @@ func (az *Cloud) getServiceLoadBalancerStatus(service *v1.Service, lb *network.L
 	return nil, nil
 }
 
+// pipResourceIDRE matches the resource ID of a public IP address, capturing
+// its resource group and name.
+var pipResourceIDRE = regexp.MustCompile(`(?i)/subscriptions/(?:.*)/resourceGroups/(.+)/providers/Microsoft.Network/publicIPAddresses/([^/\s]+)$`)
+
+// getPublicIPResourceID returns the resource group and name of the
+// pre-created public IP referenced through the ServiceAnnotationPIPID
+// annotation, or empty strings when the annotation is not set.
+func getPublicIPResourceID(service *v1.Service) (string, string, error) {
+	pipID := strings.TrimSpace(service.Annotations[ServiceAnnotationPIPID])
+	if pipID == "" {
+		return "", "", nil
+	}
+
+	matches := pipResourceIDRE.FindStringSubmatch(pipID)
+	if len(matches) != 3 {
+		return "", "", fmt.Errorf("annotation %s of service %s holds %q which is not a public IP resource ID", ServiceAnnotationPIPID, getServiceName(service), pipID)
+	}
+	return matches[1], matches[2], nil
+}
+
+// gatewayLBFrontendIDRE matches the resource ID of a load balancer frontend
+// IP configuration, capturing its resource group, load balancer name and
+// frontend name.
+var gatewayLBFrontendIDRE = regexp.MustCompile(`(?i)/subscriptions/(?:.*)/resourceGroups/(.+)/providers/Microsoft.Network/loadBalancers/([^/\s]+)/frontendIPConfigurations/([^/\s]+)$`)
+
+// getGatewayLoadBalancerFrontendID returns the resource ID of the gateway
+// load balancer frontend requested through the
+// ServiceAnnotationGatewayLoadBalancer annotation, or an empty string when
+// the annotation is not set.
+func getGatewayLoadBalancerFrontendID(service *v1.Service) (string, error) {
+	frontendID := strings.TrimSpace(service.Annotations[ServiceAnnotationGatewayLoadBalancer])
+	if frontendID == "" {
+		return "", nil
+	}
+	if !gatewayLBFrontendIDRE.MatchString(frontendID) {
+		return "", fmt.Errorf("annotation %s of service %s holds %q which is not a load balancer frontend IP configuration resource ID", ServiceAnnotationGatewayLoadBalancer, getServiceName(service), frontendID)
+	}
+	return frontendID, nil
+}
+
+// validateGatewayLoadBalancerFrontend checks that the gateway load balancer
+// frontend referenced through the ServiceAnnotationGatewayLoadBalancer
+// annotation exists, so a dangling reference fails the service sync instead
+// of the load balancer update.
+func (az *Cloud) validateGatewayLoadBalancerFrontend(service *v1.Service, frontendID string) error {
+	matches := gatewayLBFrontendIDRE.FindStringSubmatch(frontendID)
+	gatewayRG, gatewayLBName, gatewayFrontendName := matches[1], matches[2], matches[3]
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	gatewayLB, rerr := az.LoadBalancerClient.Get(ctx, gatewayRG, gatewayLBName, "")
+	if rerr != nil {
+		if rerr.HTTPStatusCode == http.StatusNotFound {
+			return fmt.Errorf("gateway load balancer %s referenced by annotation %s of service %s does not exist", gatewayLBName, ServiceAnnotationGatewayLoadBalancer, getServiceName(service))
+		}
+		return rerr.Error()
+	}
+
+	if gatewayLB.LoadBalancerPropertiesFormat != nil && gatewayLB.FrontendIPConfigurations != nil {
+		for _, fip := range *gatewayLB.FrontendIPConfigurations {
+			if strings.EqualFold(to.String(fip.Name), gatewayFrontendName) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("frontend IP configuration %s referenced by annotation %s of service %s does not exist on gateway load balancer %s", gatewayFrontendName, ServiceAnnotationGatewayLoadBalancer, getServiceName(service), gatewayLBName)
+}
+
 func (az *Cloud) determinePublicIPName(clusterName string, service *v1.Service) (string, bool, error) {
 	var shouldPIPExisted bool
+	if _, pipName, err := getPublicIPResourceID(service); err != nil {
+		return "", shouldPIPExisted, err
+	} else if pipName != "" {
+		shouldPIPExisted = true
+		return pipName, shouldPIPExisted, nil
+	}
+
 	if name, found := service.Annotations[ServiceAnnotationPIPName]; found && name != "" {
 		shouldPIPExisted = true
 		return name, shouldPIPExisted, nil
@@ -438,6 +980,17 @@ func (az *Cloud) determinePublicIPName(clusterName string, service *v1.Service)
 
 	loadBalancerIP := service.Spec.LoadBalancerIP
 	if len(loadBalancerIP) == 0 {
+		if az.publicIPAddressPoolEnabled() {
+			pipName, found, err := az.findOrAssignPoolPublicIP(clusterName, service)
+			if err != nil {
+				return "", shouldPIPExisted, err
+			}
+			if found {
+				return pipName, shouldPIPExisted, nil
+			}
+			// The pool is exhausted, fall back to the generated name and
+			// on-demand creation.
+		}
 		return az.getPublicIPName(clusterName, service), shouldPIPExisted, nil
 	}
 
@@ -501,18 +1054,147 @@ func (az *Cloud) findServiceIPAddress(ctx context.Context, clusterName string, s
 	return lbStatus.Ingress[0].IP, nil
 }
 
+// servicesSharePublicIP returns whether the two services reference the same
+// bring-your-own public IP, either through the pip name or resource ID
+// annotations or through an explicit load balancer IP.
+func servicesSharePublicIP(a, b *v1.Service) bool {
+	aName := a.Annotations[ServiceAnnotationPIPName]
+	bName := b.Annotations[ServiceAnnotationPIPName]
+	if aName != "" && strings.EqualFold(aName, bName) {
+		return true
+	}
+
+	aID := a.Annotations[ServiceAnnotationPIPID]
+	bID := b.Annotations[ServiceAnnotationPIPID]
+	if aID != "" && strings.EqualFold(aID, bID) {
+		return true
+	}
+
+	return a.Spec.LoadBalancerIP != "" && a.Spec.LoadBalancerIP == b.Spec.LoadBalancerIP
+}
+
+// sharedPIPPortInUseByOtherService returns whether another service sharing the
+// same bring-your-own public IP still exposes the given port through a shared
+// security rule, in which case the destination of the deleted service must
+// stay in the rule.
+func (az *Cloud) sharedPIPPortInUseByOtherService(service *v1.Service, port v1.ServicePort) bool {
+	if az.KubeClient == nil {
+		return false
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	services, err := az.KubeClient.CoreV1().Services("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		klog.Warningf("sharedPIPPortInUseByOtherService(%s): failed to list services: %v", getServiceName(service), err)
+		return false
+	}
+
+	for i := range services.Items {
+		other := &services.Items[i]
+		if other.UID == service.UID || other.Spec.Type != v1.ServiceTypeLoadBalancer || !useSharedSecurityRule(other) {
+			continue
+		}
+		if !servicesSharePublicIP(service, other) {
+			continue
+		}
+		for _, otherPort := range other.Spec.Ports {
+			if otherPort.Port == port.Port && otherPort.Protocol == port.Protocol {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// publicIPNeedsUpgrade returns whether the existing public IP uses the Basic
+// SKU or Dynamic allocation and hence cannot be attached to a standard load
+// balancer frontend as is.
+func (az *Cloud) publicIPNeedsUpgrade(pip *network.PublicIPAddress) bool {
+	if !az.useStandardLoadBalancer() {
+		return false
+	}
+
+	if pip.Sku == nil || pip.Sku.Name != network.PublicIPAddressSkuNameStandard {
+		return true
+	}
+	return pip.PublicIPAddressPropertiesFormat != nil &&
+		pip.PublicIPAddressPropertiesFormat.PublicIPAllocationMethod == network.Dynamic
+}
+
+// upgradePublicIP converts a Basic/Dynamic public IP to Standard/Static in
+// place so that it can be attached to a standard load balancer frontend. The
+// upgrade only happens when the user consented with the
+// ServiceAnnotationPIPAllowUpgrade annotation; otherwise a warning event
+// explains the required action. Switching the allocation method to Static
+// first pins the currently assigned address, and the updated public IP is
+// written together with the other pending changes of the reconcile.
+func (az *Cloud) upgradePublicIP(service *v1.Service, pip *network.PublicIPAddress) bool {
+	if !az.publicIPNeedsUpgrade(pip) {
+		return false
+	}
+
+	if !strings.EqualFold(service.Annotations[ServiceAnnotationPIPAllowUpgrade], "true") {
+		az.Event(service, v1.EventTypeWarning, "PublicIPUpgradeRequired",
+			fmt.Sprintf("public IP %s uses the Basic SKU or Dynamic allocation and cannot be attached to a standard load balancer; annotate the service with %s=true to let the provider upgrade it in place", to.String(pip.Name), ServiceAnnotationPIPAllowUpgrade))
+		return false
+	}
+
+	if pip.PublicIPAddressPropertiesFormat == nil {
+		pip.PublicIPAddressPropertiesFormat = &network.PublicIPAddressPropertiesFormat{}
+	}
+	pip.PublicIPAddressPropertiesFormat.PublicIPAllocationMethod = network.Static
+	pip.Sku = &network.PublicIPAddressSku{
+		Name: network.PublicIPAddressSkuNameStandard,
+	}
+
+	klog.V(2).Infof("upgradePublicIP for service(%s): pip(%s) - upgrading to Standard SKU with Static allocation, preserving IP %s", getServiceName(service), to.String(pip.Name), to.String(pip.IPAddress))
+	az.Event(service, v1.EventTypeNormal, "PublicIPUpgraded",
+		fmt.Sprintf("public IP %s upgraded to the Standard SKU with Static allocation", to.String(pip.Name)))
+	return true
+}
+
 func (az *Cloud) ensurePublicIPExists(service *v1.Service, pipName string, domainNameLabel, clusterName string, shouldPIPExisted, foundDNSLabelAnnotation bool) (*network.PublicIPAddress, error) {
 	pipResourceGroup := az.getPublicIPAddressResourceGroup(service)
 	pip, existsPip, err := az.getPublicIPAddress(pipResourceGroup, pipName)
 	if err != nil {
 		return nil, err
 	}
+	if !existsPip && !strings.EqualFold(pipResourceGroup, az.ResourceGroup) {
+		// During migration to a dedicated public IP resource group, public
+		// IPs created before the move still live in the cluster resource
+		// group and keep being managed there.
+		legacyPIP, existsLegacyPIP, err := az.getPublicIPAddress(az.ResourceGroup, pipName)
+		if err != nil {
+			return nil, err
+		}
+		if existsLegacyPIP {
+			klog.V(2).Infof("ensurePublicIPExists for service(%s): pip(%s) found in the cluster resource group %s instead of %s, keeping it there", getServiceName(service), pipName, az.ResourceGroup, pipResourceGroup)
+			pip, existsPip = legacyPIP, true
+			pipResourceGroup = az.ResourceGroup
+		}
+	}
 
 	serviceName := getServiceName(service)
 
 	if existsPip {
+		if prefixID := getPublicIPPrefixID(service); prefixID != "" &&
+			(pip.PublicIPAddressPropertiesFormat == nil || pip.PublicIPPrefix == nil ||
+				!strings.EqualFold(to.String(pip.PublicIPPrefix.ID), prefixID)) {
+			// The prefix of an existing public IP cannot be changed in place;
+			// the IP has to be deleted for the next reconcile to reallocate it
+			// from the prefix.
+			az.Event(service, v1.EventTypeWarning, "PublicIPPrefixIgnored",
+				fmt.Sprintf("public IP %s was not allocated from the public IP prefix requested by annotation %s; delete the public IP to reallocate it from the prefix", pipName, ServiceAnnotationPIPPrefixID))
+		}
+		upgraded := az.upgradePublicIP(service, &pip)
+		ipTagsChanged, err := az.ensureServiceIPTags(service, &pip)
+		if err != nil {
+			return nil, err
+		}
 		// return if pip exist and dns label is the same
-		if getDomainNameLabel(&pip) == domainNameLabel {
+		if !upgraded && !ipTagsChanged && getDomainNameLabel(&pip) == domainNameLabel {
 			return &pip, nil
 		}
 		klog.V(2).Infof("ensurePublicIPExists for service(%s): pip(%s) - updating", serviceName, *pip.Name)
@@ -531,24 +1213,53 @@ func (az *Cloud) ensurePublicIPExists(service *v1.Service, pipName string, domai
 			PublicIPAllocationMethod: network.Static,
 		}
 		pip.Tags = map[string]*string{
-			serviceTagKey:  &serviceName,
-			clusterNameKey: &clusterName,
+			serviceTagKey:       &serviceName,
+			clusterNameKey:      &clusterName,
+			createdForUIDTagKey: to.StringPtr(string(service.UID)),
+			createdAtTagKey:     to.StringPtr(time.Now().UTC().Format(time.RFC3339)),
 		}
 		if az.useStandardLoadBalancer() {
 			pip.Sku = &network.PublicIPAddressSku{
 				Name: network.PublicIPAddressSkuNameStandard,
 			}
 		}
+		if prefixID := getPublicIPPrefixID(service); prefixID != "" {
+			if !az.useStandardLoadBalancer() {
+				return nil, fmt.Errorf("annotation %s of service %s requires the standard load balancer SKU", ServiceAnnotationPIPPrefixID, serviceName)
+			}
+			klog.V(2).Infof("ensurePublicIPExists for service(%s): pip(%s) - allocating from public IP prefix %s", serviceName, pipName, prefixID)
+			pip.PublicIPAddressPropertiesFormat.PublicIPPrefix = &network.SubResource{ID: to.StringPtr(prefixID)}
+		}
+		if _, err := az.ensureServiceIPTags(service, &pip); err != nil {
+			return nil, err
+		}
 		klog.V(2).Infof("ensurePublicIPExists for service(%s): pip(%s) - creating", serviceName, *pip.Name)
 	}
 	if foundDNSLabelAnnotation {
 		if len(domainNameLabel) == 0 {
 			pip.PublicIPAddressPropertiesFormat.DNSSettings = nil
+			if pip.Tags != nil {
+				delete(pip.Tags, dnsLabelServiceTagKey)
+			}
 		} else {
+			if owner, ok := pip.Tags[dnsLabelServiceTagKey]; ok && !strings.EqualFold(to.String(owner), serviceName) {
+				message := fmt.Sprintf("DNS label %s of public IP %s is owned by service %s, service %s cannot take it over", domainNameLabel, to.String(pip.Name), to.String(owner), serviceName)
+				az.Event(service, v1.EventTypeWarning, "DNSLabelConflict", message)
+				return nil, fmt.Errorf("%s", message)
+			}
 			pip.PublicIPAddressPropertiesFormat.DNSSettings = &network.PublicIPAddressDNSSettings{
 				DomainNameLabel: &domainNameLabel,
 			}
+			if pip.Tags == nil {
+				pip.Tags = map[string]*string{}
+			}
+			pip.Tags[dnsLabelServiceTagKey] = &serviceName
 		}
+	} else if owner, ok := pip.Tags[dnsLabelServiceTagKey]; ok && strings.EqualFold(to.String(owner), serviceName) {
+		// The annotation was removed: clear the label the service left behind
+		// instead of leaving it orphaned on the IP.
+		pip.PublicIPAddressPropertiesFormat.DNSSettings = nil
+		delete(pip.Tags, dnsLabelServiceTagKey)
 	}
 
 	// use the same family as the clusterIP as we support IPv6 single stack as well
@@ -570,6 +1281,8 @@ func (az *Cloud) ensurePublicIPExists(service *v1.Service, pipName string, domai
 
 	klog.V(2).Infof("ensurePublicIPExists for service(%s): pip(%s) - creating", serviceName, *pip.Name)
 
+	bumpPublicIPReconcileCount(&pip)
+
 	klog.V(10).Infof("CreateOrUpdatePIP(%s, %q): start", pipResourceGroup, *pip.Name)
 	err = az.CreateOrUpdatePIP(service, pipResourceGroup, pip)
 	if err != nil {
@@ -595,16 +1308,19 @@ func getDomainNameLabel(pip *network.PublicIPAddress) string {
 }
 
 func getIdleTimeout(s *v1.Service) (*int32, error) {
-	const (
-		min = 4
-		max = 30
-	)
-
 	val, ok := s.Annotations[ServiceAnnotationLoadBalancerIdleTimeout]
 	if !ok {
 		// Return a nil here as this will set the value to the azure default
 		return nil, nil
 	}
+	return parseIdleTimeout(val)
+}
+
+func parseIdleTimeout(val string) (*int32, error) {
+	const (
+		min = 4
+		max = 30
+	)
 
 	errInvalidTimeout := fmt.Errorf("idle timeout value must be a whole number representing minutes between %d and %d", min, max)
 	to, err := strconv.Atoi(val)
@@ -619,6 +1335,59 @@ func getIdleTimeout(s *v1.Service) (*int32, error) {
 	return &to32, nil
 }
 
+// getLoadBalancerDistributionMode maps the session affinity of the service to
+// the load distribution of its rules. ClientIP affinity defaults to SourceIP
+// (two-tuple) stickiness; the distribution mode annotation can select the
+// three-tuple SourceIPProtocol variant instead. The annotation is ignored
+// without ClientIP affinity, where distribution stays at the default.
+func getLoadBalancerDistributionMode(service *v1.Service) (network.LoadDistribution, error) {
+	if service.Spec.SessionAffinity != v1.ServiceAffinityClientIP {
+		return network.LoadDistributionDefault, nil
+	}
+
+	val, ok := service.Annotations[ServiceAnnotationLoadBalancerDistributionMode]
+	if !ok {
+		return network.LoadDistributionSourceIP, nil
+	}
+	switch {
+	case strings.EqualFold(val, string(network.LoadDistributionSourceIP)):
+		return network.LoadDistributionSourceIP, nil
+	case strings.EqualFold(val, string(network.LoadDistributionSourceIPProtocol)):
+		return network.LoadDistributionSourceIPProtocol, nil
+	default:
+		return "", fmt.Errorf("service %s holds invalid value %q for annotation %s, supported values are %s and %s", getServiceName(service), val, ServiceAnnotationLoadBalancerDistributionMode, network.LoadDistributionSourceIP, network.LoadDistributionSourceIPProtocol)
+	}
+}
+
+// getRuleIdleTimeout returns the idle timeout of the rule for the given
+// frontend port, preferring the per-port annotation over the service-wide
+// value.
+func getRuleIdleTimeout(service *v1.Service, port int32, serviceIdleTimeout *int32) (*int32, error) {
+	annotation := fmt.Sprintf(ServiceAnnotationLoadBalancerIdleTimeoutPortFmt, port)
+	if val, ok := service.Annotations[annotation]; ok {
+		timeout, err := parseIdleTimeout(val)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", annotation, err)
+		}
+		return timeout, nil
+	}
+	return serviceIdleTimeout, nil
+}
+
+// getRuleEnableTCPReset returns the TCP reset behavior of the rule for the
+// given frontend port, preferring the per-port annotation over the SKU
+// default. The default is nil on the basic SKU, which cannot do TCP reset,
+// and then the annotation is ignored.
+func getRuleEnableTCPReset(service *v1.Service, port int32, enableTCPReset *bool) *bool {
+	if enableTCPReset == nil {
+		return nil
+	}
+	if val, ok := service.Annotations[fmt.Sprintf(ServiceAnnotationLoadBalancerEnableTCPResetPortFmt, port)]; ok {
+		return to.BoolPtr(strings.EqualFold(val, "true"))
+	}
+	return enableTCPReset
+}
+
 func (az *Cloud) isFrontendIPChanged(clusterName string, config network.FrontendIPConfiguration, service *v1.Service, lbFrontendIPConfigName string) (bool, error) {
 	if az.serviceOwnsFrontendIP(config, service) && !strings.EqualFold(to.String(config.Name), lbFrontendIPConfigName) {
 		return true, nil
@@ -630,16 +1399,22 @@ func (az *Cloud) isFrontendIPChanged(clusterName string, config network.Frontend
 	isInternal := requiresInternalLoadBalancer(service)
 	if isInternal {
 		// Judge subnet
-		subnetName := subnet(service)
-		if subnetName != nil {
-			subnet, existsSubnet, err := az.getSubnet(az.VnetName, *subnetName)
-			if err != nil {
-				return false, err
+		if subnetName := subnet(service); subnetName != nil {
+			candidates := subnetCandidates(service, az.SubnetName)
+			candidateNames := make([]string, 0, len(candidates))
+			for _, candidate := range candidates {
+				subnet, existsSubnet, err := az.getSubnet(az.VnetName, candidate)
+				if err != nil {
+					return false, err
+				}
+				if existsSubnet {
+					candidateNames = append(candidateNames, to.String(subnet.Name))
+				}
 			}
-			if !existsSubnet {
+			if len(candidateNames) == 0 {
 				return false, fmt.Errorf("failed to get subnet")
 			}
-			if config.Subnet != nil && !strings.EqualFold(to.String(config.Subnet.Name), to.String(subnet.Name)) {
+			if config.Subnet != nil && !subnetNameInCandidates(to.String(config.Subnet.Name), candidateNames) {
 				return true, nil
 			}
 		}
@@ -663,43 +1438,197 @@ func (az *Cloud) isFrontendIPChanged(clusterName string, config network.Frontend
 	if !existsPip {
 		return true, nil
 	}
-	return config.PublicIPAddress != nil && !strings.EqualFold(to.String(pip.ID), to.String(config.PublicIPAddress.ID)), nil
+	return config.PublicIPAddress != nil && !equalResourceIDs(to.String(pip.ID), to.String(config.PublicIPAddress.ID)), nil
 }
 
-// This ensures load balancer exists and the frontend ip config is setup.
-// This also reconciles the Service's Ports  with the LoadBalancer config.
-// This entails adding rules/probes for expected Ports and removing stale rules/ports.
-// nodes only used if wantLb is true
-func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service, nodes []*v1.Node, wantLb bool) (*network.LoadBalancer, error) {
-	isInternal := requiresInternalLoadBalancer(service)
-	isBackendPoolPreConfigured := az.isBackendPoolPreConfigured(service)
-	serviceName := getServiceName(service)
-	klog.V(2).Infof("reconcileLoadBalancer for service(%s) - wantLb(%t): started", serviceName, wantLb)
-	lb, _, _, err := az.getServiceLoadBalancer(service, clusterName, nodes, wantLb)
-	if err != nil {
-		klog.Errorf("reconcileLoadBalancer: failed to get load balancer for service %q, error: %v", serviceName, err)
-		return nil, err
+// ensureFrontendIPStability refuses reconciles that would alter a frontend IP
+// already assigned to the service unless the change was requested by the user
+// through spec.loadBalancerIP or the internal subnet annotation. It reports why
+// the frontend IP configuration was considered changed instead of silently
+// reallocating the IP.
+func (az *Cloud) ensureFrontendIPStability(service *v1.Service, config network.FrontendIPConfiguration) error {
+	assignedIP := ""
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" {
+			assignedIP = ingress.IP
+			break
+		}
+	}
+	if assignedIP == "" {
+		// No IP has been assigned to the service yet, nothing to preserve.
+		return nil
 	}
-	lbName := *lb.Name
-	lbResourceGroup := az.getLoadBalancerResourceGroup()
-	klog.V(2).Infof("reconcileLoadBalancer for service(%s): lb(%s/%s) wantLb(%t) resolved load balancer name", serviceName, lbResourceGroup, lbName, wantLb)
-	lbFrontendIPConfigName := az.getFrontendIPConfigName(service)
-	lbFrontendIPConfigID := az.getFrontendIPConfigID(lbName, lbResourceGroup, lbFrontendIPConfigName)
-	lbBackendPoolName := getBackendPoolName(clusterName, service)
-	lbBackendPoolID := az.getBackendPoolID(lbName, lbResourceGroup, lbBackendPoolName)
 
-	lbIdleTimeout, err := getIdleTimeout(service)
-	if wantLb && err != nil {
-		return nil, err
+	// Explicitly pinning the IP is a user requested change, the reconcile would
+	// converge to exactly that IP.
+	if service.Spec.LoadBalancerIP != "" {
+		return nil
 	}
 
-	dirtyLb := false
-
-	// Ensure LoadBalancer's Backend Pool Configuration
-	if wantLb {
-		newBackendPools := []network.BackendAddressPool{}
-		if lb.BackendAddressPools != nil {
-			newBackendPools = *lb.BackendAddressPools
+	isInternal := requiresInternalLoadBalancer(service)
+	if isInternal && config.FrontendIPConfigurationPropertiesFormat != nil {
+		// Moving the service to another subnet is a user requested change.
+		if subnetName := subnet(service); subnetName != nil && config.Subnet != nil &&
+			!strings.EqualFold(to.String(config.Subnet.Name), *subnetName) {
+			return nil
+		}
+	}
+
+	reason := "the frontend IP configuration no longer matches the service spec"
+	if config.FrontendIPConfigurationPropertiesFormat != nil {
+		if isInternal && config.PrivateIPAllocationMethod == network.Static {
+			reason = fmt.Sprintf("the private IP allocation method would change from Static to Dynamic, releasing IP %s", assignedIP)
+		} else if !isInternal && config.PublicIPAddress != nil {
+			reason = fmt.Sprintf("the referenced public IP %s no longer matches the one resolved for the service (e.g. recreated with another SKU)", to.String(config.PublicIPAddress.ID))
+		}
+	}
+
+	message := fmt.Sprintf("reconcile would change frontend IP %s assigned to service %s: %s. Refusing to reallocate it, set spec.loadBalancerIP explicitly to proceed", assignedIP, getServiceName(service), reason)
+	az.Event(service, v1.EventTypeWarning, "FrontendIPChangeRefused", message)
+	return fmt.Errorf("%s", message)
+}
+
+// ensureLoadBalancerIPNotClaimed verifies that the IP requested through
+// spec.loadBalancerIP is not already claimed by the frontend of another
+// service before a frontend is created for it. Without this check two
+// services requesting the same IP would keep stealing the frontend from each
+// other on every resync. The returned error is permanent: the conflict can
+// only be resolved by the user changing one of the services.
+func (az *Cloud) ensureLoadBalancerIPNotClaimed(service *v1.Service, lb *network.LoadBalancer, wantedFrontendIPConfigID string) error {
+	loadBalancerIP := service.Spec.LoadBalancerIP
+	if loadBalancerIP == "" {
+		return nil
+	}
+	serviceName := getServiceName(service)
+
+	if requiresInternalLoadBalancer(service) {
+		if lb == nil || lb.FrontendIPConfigurations == nil {
+			return nil
+		}
+		for _, config := range *lb.FrontendIPConfigurations {
+			if az.serviceOwnsFrontendIP(config, service) {
+				continue
+			}
+			if config.FrontendIPConfigurationPropertiesFormat == nil {
+				continue
+			}
+			if strings.EqualFold(to.String(config.PrivateIPAddress), loadBalancerIP) {
+				message := fmt.Sprintf("IP %s requested by service %s is already claimed by frontend IP configuration %s of load balancer %s", loadBalancerIP, serviceName, to.String(config.Name), to.String(lb.Name))
+				az.Event(service, v1.EventTypeWarning, "LoadBalancerIPConflict", message)
+				return fmt.Errorf("%s", message)
+			}
+		}
+		return nil
+	}
+
+	pipResourceGroup := az.getPublicIPAddressResourceGroup(service)
+	pips, err := az.ListPIP(service, pipResourceGroup)
+	if err != nil {
+		return err
+	}
+	for _, pip := range pips {
+		if pip.PublicIPAddressPropertiesFormat == nil || to.String(pip.IPAddress) != loadBalancerIP {
+			continue
+		}
+		// A public IP not attached to any IP configuration, or attached to
+		// the frontend of this very service, is free to take.
+		if pip.IPConfiguration == nil || strings.EqualFold(to.String(pip.IPConfiguration.ID), wantedFrontendIPConfigID) {
+			continue
+		}
+		// The service tag records which service the public IP was created
+		// for. A matching tag on a foreign attachment means the service is
+		// being moved (e.g. to another load balancer), not a conflict.
+		owner := ""
+		if pip.Tags != nil {
+			owner = to.String(pip.Tags[serviceTagKey])
+		}
+		if strings.EqualFold(owner, serviceName) {
+			continue
+		}
+		claimedBy := fmt.Sprintf("IP configuration %s", to.String(pip.IPConfiguration.ID))
+		if owner != "" {
+			claimedBy = fmt.Sprintf("service %s", owner)
+		}
+		message := fmt.Sprintf("IP %s requested by service %s is already claimed by %s through public IP %s", loadBalancerIP, serviceName, claimedBy, to.String(pip.Name))
+		az.Event(service, v1.EventTypeWarning, "LoadBalancerIPConflict", message)
+		return fmt.Errorf("%s", message)
+	}
+	return nil
+}
+
+// This ensures load balancer exists and the frontend ip config is setup.
+// This also reconciles the Service's Ports  with the LoadBalancer config.
+// This entails adding rules/probes for expected Ports and removing stale rules/ports.
+// nodes only used if wantLb is true
+func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service, nodes []*v1.Node, wantLb bool) (*network.LoadBalancer, error) {
+	isInternal := requiresInternalLoadBalancer(service)
+	isBackendPoolPreConfigured := az.isBackendPoolPreConfigured(service)
+	serviceName := getServiceName(service)
+	klog.V(2).Infof("reconcileLoadBalancer for service(%s) - wantLb(%t): started", serviceName, wantLb)
+	if err := az.validateGlobalInternalLoadBalancer(service); err != nil {
+		return nil, err
+	}
+	lb, _, _, err := az.getServiceLoadBalancer(service, clusterName, nodes, wantLb)
+	if err != nil {
+		klog.Errorf("reconcileLoadBalancer: failed to get load balancer for service %q, error: %v", serviceName, err)
+		return nil, err
+	}
+	lbName := *lb.Name
+	lbResourceGroup := az.getLoadBalancerResourceGroup()
+	klog.V(2).Infof("reconcileLoadBalancer for service(%s): lb(%s/%s) wantLb(%t) resolved load balancer name", serviceName, lbResourceGroup, lbName, wantLb)
+	lbFrontendIPConfigName := az.getFrontendIPConfigName(service)
+	lbFrontendIPConfigID := az.getFrontendIPConfigID(lbName, lbResourceGroup, lbFrontendIPConfigName)
+	lbBackendPoolName := az.getBackendPoolName(clusterName, service)
+	lbBackendPoolID := az.getBackendPoolID(lbName, lbResourceGroup, lbBackendPoolName)
+
+	lbIdleTimeout, err := getIdleTimeout(service)
+	if wantLb && err != nil {
+		return nil, err
+	}
+
+	if wantLb {
+		if err := az.ensureLoadBalancerIPNotClaimed(service, lb, lbFrontendIPConfigID); err != nil {
+			return nil, err
+		}
+	}
+
+	// The gateway load balancer chain is validated up front and spliced into
+	// the frontend IP configuration when the load balancer is written.
+	var gatewayLoadBalancers map[string]string
+	if wantLb {
+		gatewayFrontendID, err := getGatewayLoadBalancerFrontendID(service)
+		if err != nil {
+			return nil, err
+		}
+		if gatewayFrontendID != "" {
+			if isInternal {
+				return nil, fmt.Errorf("annotation %s of service %s is only supported on public services", ServiceAnnotationGatewayLoadBalancer, serviceName)
+			}
+			if !az.useStandardLoadBalancer() {
+				return nil, fmt.Errorf("annotation %s of service %s requires the standard load balancer SKU", ServiceAnnotationGatewayLoadBalancer, serviceName)
+			}
+			if err := az.validateGatewayLoadBalancerFrontend(service, gatewayFrontendID); err != nil {
+				return nil, err
+			}
+			gatewayLoadBalancers = map[string]string{lbFrontendIPConfigName: gatewayFrontendID}
+		}
+	}
+
+	if wantLb && wantsPLSProxyProtocol(service) && requiresInternalLoadBalancer(service) {
+		// This network API version cannot set enableProxyProtocol on the
+		// private link service, so remind the operator to flip the flag there
+		// and keep it in sync with the annotation.
+		az.Event(service, v1.EventTypeNormal, "PLSProxyProtocol",
+			"service declares PROXY protocol v2; ensure enableProxyProtocol is set on the private link service attached to the internal load balancer frontend")
+	}
+
+	dirtyLb := false
+
+	// Ensure LoadBalancer's Backend Pool Configuration
+	if wantLb {
+		newBackendPools := []network.BackendAddressPool{}
+		if lb.BackendAddressPools != nil {
+			newBackendPools = *lb.BackendAddressPools
 		}
 
 		foundBackendPool := false
@@ -729,6 +1658,15 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 			dirtyLb = true
 			lb.BackendAddressPools = &newBackendPools
 		}
+
+		if az.perVMSSBackendPoolsEnabled() {
+			var dirtyPools bool
+			newBackendPools, dirtyPools = az.reconcilePerVMSSBackendPools(service, nodes, newBackendPools, lbBackendPoolName)
+			if dirtyPools {
+				dirtyLb = true
+				lb.BackendAddressPools = &newBackendPools
+			}
+		}
 	}
 
 	// Ensure LoadBalancer's Frontend IP Configurations
@@ -755,6 +1693,11 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 				return nil, err
 			}
 			if isFipChanged {
+				if az.serviceOwnsFrontendIP(config, service) {
+					if err := az.ensureFrontendIPStability(service, config); err != nil {
+						return nil, err
+					}
+				}
 				klog.V(2).Infof("reconcileLoadBalancer for service (%s)(%t): lb frontendconfig(%s) - dropping", serviceName, wantLb, *config.Name)
 				newConfigs = append(newConfigs[:i], newConfigs[i+1:]...)
 				dirtyConfigs = true
@@ -778,17 +1721,13 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 					return nil, fmt.Errorf("ensure(%s): lb(%s) - internal load balancers does not support IPv6", serviceName, lbName)
 				}
 
-				subnetName := subnet(service)
-				if subnetName == nil {
-					subnetName = &az.SubnetName
-				}
-				subnet, existsSubnet, err := az.getSubnet(az.VnetName, *subnetName)
+				subnet, err := az.selectEligibleSubnet(serviceName, subnetCandidates(service, az.SubnetName))
 				if err != nil {
-					return nil, err
+					return nil, fmt.Errorf("ensure(%s): lb(%s) - %v", serviceName, lbName, err)
 				}
 
-				if !existsSubnet {
-					return nil, fmt.Errorf("ensure(%s): lb(%s) - failed to get subnet: %s/%s", serviceName, lbName, az.VnetName, az.SubnetName)
+				if err := az.ensureSubnetNetworkPolicies(service, &subnet); err != nil {
+					return nil, err
 				}
 
 				configProperties := network.FrontendIPConfigurationPropertiesFormat{
@@ -921,6 +1860,108 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 		lb.LoadBalancingRules = &updatedRules
 	}
 
+	// update inbound NAT pools for services opting into frontend port ranges
+	expectedNatPools, err := az.reconcileInboundNatPools(service, wantLb, lbFrontendIPConfigID, lbIdleTimeout)
+	if err != nil {
+		return nil, err
+	}
+	dirtyNatPools := false
+	var updatedNatPools []network.InboundNatPool
+	if lb.InboundNatPools != nil {
+		updatedNatPools = *lb.InboundNatPools
+	}
+	// remove unwanted pools
+	for i := len(updatedNatPools) - 1; i >= 0; i-- {
+		existingPool := updatedNatPools[i]
+		if az.serviceOwnsRule(service, *existingPool.Name) {
+			keepPool := false
+			klog.V(10).Infof("reconcileLoadBalancer for service (%s)(%t): lb inbound NAT pool(%s) - considering evicting", serviceName, wantLb, *existingPool.Name)
+			if findNatPool(expectedNatPools, existingPool) {
+				klog.V(10).Infof("reconcileLoadBalancer for service (%s)(%t): lb inbound NAT pool(%s) - keeping", serviceName, wantLb, *existingPool.Name)
+				keepPool = true
+			}
+			if !keepPool {
+				klog.V(2).Infof("reconcileLoadBalancer for service (%s)(%t): lb inbound NAT pool(%s) - dropping", serviceName, wantLb, *existingPool.Name)
+				updatedNatPools = append(updatedNatPools[:i], updatedNatPools[i+1:]...)
+				dirtyNatPools = true
+			}
+		}
+	}
+	// add missing, wanted pools
+	for _, expectedPool := range expectedNatPools {
+		if !findNatPool(updatedNatPools, expectedPool) {
+			klog.V(10).Infof("reconcileLoadBalancer for service (%s)(%t): lb inbound NAT pool(%s) adding", serviceName, wantLb, *expectedPool.Name)
+			updatedNatPools = append(updatedNatPools, expectedPool)
+			dirtyNatPools = true
+		}
+	}
+	if dirtyNatPools {
+		dirtyLb = true
+		lb.InboundNatPools = &updatedNatPools
+	}
+
+	// update inbound NAT rules from the service annotation
+	expectedNatRules, err := az.reconcileInboundNatRules(service, wantLb, lbFrontendIPConfigID, lbIdleTimeout)
+	if err != nil {
+		return nil, err
+	}
+	dirtyNatRules := false
+	var updatedNatRules []network.InboundNatRule
+	if lb.InboundNatRules != nil {
+		updatedNatRules = *lb.InboundNatRules
+	}
+	// remove unwanted NAT rules
+	for i := len(updatedNatRules) - 1; i >= 0; i-- {
+		existingNatRule := updatedNatRules[i]
+		if az.serviceOwnsNatRule(service, *existingNatRule.Name) {
+			keepNatRule := false
+			klog.V(10).Infof("reconcileLoadBalancer for service (%s)(%t): lb inbound NAT rule(%s) - considering evicting", serviceName, wantLb, *existingNatRule.Name)
+			if findNatRule(expectedNatRules, existingNatRule) {
+				klog.V(10).Infof("reconcileLoadBalancer for service (%s)(%t): lb inbound NAT rule(%s) - keeping", serviceName, wantLb, *existingNatRule.Name)
+				keepNatRule = true
+			}
+			if !keepNatRule {
+				klog.V(2).Infof("reconcileLoadBalancer for service (%s)(%t): lb inbound NAT rule(%s) - dropping", serviceName, wantLb, *existingNatRule.Name)
+				// Azure rejects deleting a NAT rule that is still attached to
+				// an IP configuration, so detach it first.
+				if props := existingNatRule.InboundNatRulePropertiesFormat; props != nil && props.BackendIPConfiguration != nil {
+					if err := az.detachInboundNatRule(service, to.String(existingNatRule.ID), to.String(props.BackendIPConfiguration.ID)); err != nil {
+						return nil, err
+					}
+				}
+				updatedNatRules = append(updatedNatRules[:i], updatedNatRules[i+1:]...)
+				dirtyNatRules = true
+			}
+		}
+	}
+	// add missing, wanted NAT rules
+	for _, expectedNatRule := range expectedNatRules {
+		if !findNatRule(updatedNatRules, expectedNatRule) {
+			klog.V(10).Infof("reconcileLoadBalancer for service (%s)(%t): lb inbound NAT rule(%s) adding", serviceName, wantLb, *expectedNatRule.Name)
+			updatedNatRules = append(updatedNatRules, expectedNatRule)
+			dirtyNatRules = true
+		}
+	}
+	if dirtyNatRules {
+		dirtyLb = true
+		lb.InboundNatRules = &updatedNatRules
+	}
+
+	// Ensure the cluster outbound rule on the external standard load
+	// balancer. The outbound rule is cluster scoped: it is reconciled here
+	// because service syncs are the only writers of the load balancer, and it
+	// is kept when services are deleted so node egress stays up.
+	if !isInternal && az.useStandardLoadBalancer() {
+		dirtyOutbound, err := az.reconcileOutboundRule(clusterName, service, lb, lbBackendPoolID)
+		if err != nil {
+			klog.Errorf("reconcileOutboundRule(%s) for service %s failed: %v", lbName, serviceName, err)
+			return nil, err
+		}
+		if dirtyOutbound {
+			dirtyLb = true
+		}
+	}
+
 	// We don't care if the LB exists or not
 	// We only care about if there is any change in the LB, which means dirtyLB
 	// If it is not exist, and no change to that, we don't CreateOrUpdate LB
@@ -928,6 +1969,16 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 		if lb.FrontendIPConfigurations == nil || len(*lb.FrontendIPConfigurations) == 0 {
 			if isBackendPoolPreConfigured {
 				klog.V(2).Infof("reconcileLoadBalancer for service(%s): lb(%s) - ignore cleanup of dirty lb because the lb is pre-confiruged", serviceName, lbName)
+			} else if isLoadBalancerExternallyOwned(lb) {
+				// An externally owned load balancer is never deleted; detach
+				// the cluster nodes from its backend pool and leave the
+				// resource for the owning operator to decommission.
+				vmSetName := az.mapLoadBalancerNameToVMSet(lbName, clusterName)
+				if err := az.VMSet.EnsureBackendPoolDeleted(service, lbBackendPoolID, vmSetName, lb.BackendAddressPools); err != nil {
+					klog.Errorf("EnsureBackendPoolDeleted(%s) for service %s failed: %v", lbBackendPoolID, serviceName, err)
+					return nil, err
+				}
+				klog.V(2).Infof("reconcileLoadBalancer for service(%s): lb(%s) is externally owned - skipping deletion", serviceName, lbName)
 			} else {
 				// When FrontendIPConfigurations is empty, we need to delete the Azure load balancer resource itself,
 				// because an Azure load balancer cannot have an empty FrontendIPConfigurations collection
@@ -954,7 +2005,7 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 			}
 		} else {
 			klog.V(2).Infof("reconcileLoadBalancer: reconcileLoadBalancer for service(%s): lb(%s) - updating", serviceName, lbName)
-			err := az.CreateOrUpdateLB(service, *lb)
+			err := az.CreateOrUpdateLBWithGatewayLoadBalancers(service, *lb, gatewayLoadBalancers)
 			if err != nil {
 				klog.V(2).Infof("reconcileLoadBalancer for service(%s) abort backoff: lb(%s) - updating", serviceName, lbName)
 				return nil, err
@@ -975,21 +2026,240 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 		}
 	}
 
+	if wantLb && len(expectedNatRules) > 0 {
+		// Attach the inbound NAT rules to the mapped nodes now that the rules
+		// exist on the load balancer.
+		if err := az.ensureInboundNatRuleAssociations(service, lbName); err != nil {
+			return nil, err
+		}
+	}
+
 	if wantLb && nodes != nil && !isBackendPoolPreConfigured {
 		// Add the machines to the backend pool if they're not already
 		vmSetName := az.mapLoadBalancerNameToVMSet(lbName, clusterName)
 		// Etag would be changed when updating backend pools, so invalidate lbCache after it.
 		defer az.lbCache.Delete(lbName)
-		err := az.VMSet.EnsureHostsInPool(service, nodes, lbBackendPoolID, vmSetName, isInternal)
+		_, hostsSpan := trace.StartSpan(context.Background(), "EnsureHostsInPool")
+		hostsSpan.SetAttribute("service", serviceName)
+		hostsSpan.SetAttribute("backend_pool_id", lbBackendPoolID)
+		err := az.VMSet.EnsureHostsInPool(service, az.filterNodesForLoadBalancer(lbName, nodes), lbBackendPoolID, vmSetName, isInternal)
+		hostsSpan.End(err)
 		if err != nil {
 			return nil, err
 		}
+
+		if az.VerifyBackendPoolMembership {
+			if err := az.verifyBackendPoolMembership(service, az.filterNodesForLoadBalancer(lbName, nodes), lbName, lbBackendPoolID, vmSetName, isInternal); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := az.migrateBackendPoolMemberships(clusterName, service, lb, vmSetName); err != nil {
+			return nil, err
+		}
 	}
 
 	klog.V(2).Infof("reconcileLoadBalancer for service(%s): lb(%s) finished", serviceName, lbName)
 	return lb, nil
 }
 
+// migrateBackendPoolMemberships moves memberships left in the default-named
+// backend pool over to the configured LoadBalancerBackendPoolName pool. It
+// runs after the nodes have been ensured in the new pool, so detaching them
+// from the old pool never drops traffic.
+func (az *Cloud) migrateBackendPoolMemberships(clusterName string, service *v1.Service, lb *network.LoadBalancer, vmSetName string) error {
+	if az.LoadBalancerBackendPoolName == "" || lb.LoadBalancerPropertiesFormat == nil || lb.BackendAddressPools == nil {
+		return nil
+	}
+
+	oldPoolName := getBackendPoolName(clusterName, service)
+	newPoolName := az.getBackendPoolName(clusterName, service)
+	if strings.EqualFold(oldPoolName, newPoolName) {
+		return nil
+	}
+
+	foundOldPool := false
+	keptPools := []network.BackendAddressPool{}
+	for _, pool := range *lb.BackendAddressPools {
+		if strings.EqualFold(to.String(pool.Name), oldPoolName) {
+			foundOldPool = true
+			continue
+		}
+		keptPools = append(keptPools, pool)
+	}
+	if !foundOldPool {
+		return nil
+	}
+
+	lbName := to.String(lb.Name)
+	klog.V(2).Infof("migrateBackendPoolMemberships(%s): moving members of pool %q on lb %q to pool %q", getServiceName(service), oldPoolName, lbName, newPoolName)
+	oldPoolID := az.getBackendPoolID(lbName, az.getLoadBalancerResourceGroup(), oldPoolName)
+	if err := az.VMSet.EnsureBackendPoolDeleted(service, oldPoolID, vmSetName, lb.BackendAddressPools); err != nil {
+		return err
+	}
+
+	lb.BackendAddressPools = &keptPools
+	if err := az.CreateOrUpdateLB(service, *lb); err != nil {
+		return err
+	}
+	az.lbCache.Delete(lbName)
+	return nil
+}
+
+// verifyBackendPoolMembership re-reads the backend pool with a force refresh
+// after EnsureHostsInPool and retries nodes whose primary IP configurations
+// did not make it into the pool, because silent partial joins only surface as
+// intermittent traffic blackholes.
+func (az *Cloud) verifyBackendPoolMembership(service *v1.Service, nodes []*v1.Node, lbName, backendPoolID, vmSetName string, isInternal bool) error {
+	lb, exists, err := az.getAzureLoadBalancer(lbName, azcache.CacheReadTypeForceRefresh)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("load balancer %q not found", lbName)
+	}
+
+	poolIPConfigs := sets.NewString()
+	if lb.LoadBalancerPropertiesFormat != nil && lb.BackendAddressPools != nil {
+		for _, pool := range *lb.BackendAddressPools {
+			if !strings.EqualFold(to.String(pool.ID), backendPoolID) ||
+				pool.BackendAddressPoolPropertiesFormat == nil ||
+				pool.BackendIPConfigurations == nil {
+				continue
+			}
+			for _, ipConfig := range *pool.BackendIPConfigurations {
+				poolIPConfigs.Insert(strings.ToLower(to.String(ipConfig.ID)))
+			}
+		}
+	}
+
+	stragglers := make([]*v1.Node, 0)
+	for _, node := range nodes {
+		if az.useStandardLoadBalancer() && az.excludeMasterNodesFromLB(service) && isMasterNode(node) {
+			continue
+		}
+		if az.ShouldNodeExcludedFromLoadBalancer(node) {
+			continue
+		}
+
+		nic, err := az.VMSet.GetPrimaryInterface(node.Name)
+		if err != nil {
+			klog.Warningf("verifyBackendPoolMembership(%s): failed to get the primary interface of node %s: %v", getServiceName(service), node.Name, err)
+			continue
+		}
+
+		joined := false
+		if nic.InterfacePropertiesFormat != nil && nic.IPConfigurations != nil {
+			for _, ipConfig := range *nic.IPConfigurations {
+				if poolIPConfigs.Has(strings.ToLower(to.String(ipConfig.ID))) {
+					joined = true
+					break
+				}
+			}
+		}
+		if !joined {
+			stragglers = append(stragglers, node)
+		}
+	}
+
+	if len(stragglers) == 0 {
+		klog.V(4).Infof("verifyBackendPoolMembership(%s): all nodes verified in backend pool %s", getServiceName(service), backendPoolID)
+		return nil
+	}
+
+	names := make([]string, 0, len(stragglers))
+	for _, node := range stragglers {
+		names = append(names, node.Name)
+	}
+	klog.Warningf("verifyBackendPoolMembership(%s): nodes %v missing from backend pool %s, retrying", getServiceName(service), names, backendPoolID)
+	az.Event(service, v1.EventTypeWarning, "BackendPoolVerification",
+		fmt.Sprintf("nodes %s were missing from backend pool %s after reconcile, retrying", strings.Join(names, ", "), backendPoolID))
+	return az.VMSet.EnsureHostsInPool(service, stragglers, backendPoolID, vmSetName, isInternal)
+}
+
+// serviceRequestsPortRanges returns true if the service opted into coalescing
+// contiguous ports into inbound NAT pools.
+func serviceRequestsPortRanges(service *v1.Service) bool {
+	v, ok := service.Annotations[ServiceAnnotationLoadBalancerEnablePortRanges]
+	return ok && strings.EqualFold(v, "true")
+}
+
+// servicePortRange is a run of two or more contiguous service ports sharing a
+// protocol.
+type servicePortRange struct {
+	protocol v1.Protocol
+	start    int32
+	end      int32
+}
+
+// coalescePortRanges splits the given service ports into runs of two or more
+// contiguous ports sharing a protocol and the remaining single ports.
+func coalescePortRanges(ports []v1.ServicePort) ([]servicePortRange, []v1.ServicePort) {
+	sorted := make([]v1.ServicePort, len(ports))
+	copy(sorted, ports)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Protocol != sorted[j].Protocol {
+			return sorted[i].Protocol < sorted[j].Protocol
+		}
+		return sorted[i].Port < sorted[j].Port
+	})
+
+	var ranges []servicePortRange
+	var singles []v1.ServicePort
+	for i := 0; i < len(sorted); {
+		j := i + 1
+		for j < len(sorted) && sorted[j].Protocol == sorted[i].Protocol && sorted[j].Port == sorted[j-1].Port+1 {
+			j++
+		}
+		if j-i > 1 {
+			ranges = append(ranges, servicePortRange{protocol: sorted[i].Protocol, start: sorted[i].Port, end: sorted[j-1].Port})
+		} else {
+			singles = append(singles, sorted[i])
+		}
+		i = j
+	}
+	return ranges, singles
+}
+
+// reconcileInboundNatPools returns the inbound NAT pools expected for the
+// service. Services opting into port ranges get one pool per contiguous run
+// of ports instead of per-port load balancing rules and probes.
+func (az *Cloud) reconcileInboundNatPools(service *v1.Service, wantLb bool, lbFrontendIPConfigID string, lbIdleTimeout *int32) ([]network.InboundNatPool, error) {
+	var expectedPools []network.InboundNatPool
+	if !wantLb || !serviceRequestsPortRanges(service) {
+		return expectedPools, nil
+	}
+
+	ranges, _ := coalescePortRanges(service.Spec.Ports)
+	for _, portRange := range ranges {
+		transportProto, _, _, err := getProtocolsFromKubernetesProtocol(portRange.protocol)
+		if err != nil {
+			return expectedPools, err
+		}
+
+		poolName := az.getLoadBalancerNatPoolName(service, portRange.protocol, portRange.start, portRange.end)
+		klog.V(2).Infof("reconcileInboundNatPools lb frontend (%s) pool name (%s)", lbFrontendIPConfigID, poolName)
+		expectedPool := network.InboundNatPool{
+			Name: &poolName,
+			InboundNatPoolPropertiesFormat: &network.InboundNatPoolPropertiesFormat{
+				Protocol: *transportProto,
+				FrontendIPConfiguration: &network.SubResource{
+					ID: to.StringPtr(lbFrontendIPConfigID),
+				},
+				FrontendPortRangeStart: to.Int32Ptr(portRange.start),
+				FrontendPortRangeEnd:   to.Int32Ptr(portRange.end),
+				BackendPort:            to.Int32Ptr(portRange.start),
+			},
+		}
+		if portRange.protocol == v1.ProtocolTCP {
+			expectedPool.InboundNatPoolPropertiesFormat.IdleTimeoutInMinutes = lbIdleTimeout
+		}
+		expectedPools = append(expectedPools, expectedPool)
+	}
+
+	return expectedPools, nil
+}
+
 func (az *Cloud) reconcileLoadBalancerRule(
 	service *v1.Service,
 	wantLb bool,
@@ -1005,6 +2275,50 @@ func (az *Cloud) reconcileLoadBalancerRule(
 		ports = []v1.ServicePort{}
 	}
 
+	// Ports covered by inbound NAT pools don't get per-port rules and probes.
+	if wantLb && serviceRequestsPortRanges(service) {
+		_, ports = coalescePortRanges(ports)
+	}
+
+	// The probe annotations apply to the whole service, so they are parsed
+	// once ahead of the per-port loop.
+	var probeProtocol network.ProbeProtocol
+	probeInterval := int32(defaultHealthProbeInterval)
+	numOfProbe := int32(defaultHealthProbeNumOfProbe)
+	if wantLb {
+		var err error
+		probeProtocol, err = getServiceHealthProbeProtocol(service)
+		if err != nil {
+			return nil, nil, err
+		}
+		probeInterval, err = az.getServiceHealthProbeInterval(service)
+		if err != nil {
+			return nil, nil, err
+		}
+		numOfProbe, err = az.getServiceHealthProbeNumOfProbe(service)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Probe traffic is not wrapped in PROXY protocol headers, so HTTP probes
+	// against a backend that expects the headers would fail; only plain TCP
+	// probes are compatible with a proxy protocol private link service.
+	if wantLb && wantsPLSProxyProtocol(service) {
+		if !requiresInternalLoadBalancer(service) {
+			return nil, nil, fmt.Errorf("service %s requests %s, but private link services only attach to internal load balancers", getServiceName(service), ServiceAnnotationPLSProxyProtocol)
+		}
+		if requestPath := service.Annotations[ServiceAnnotationLoadBalancerHealthProbeRequestPath]; requestPath != "" {
+			return nil, nil, fmt.Errorf("service %s combines %s with the HTTP probe annotation %s: HTTP probes are incompatible with PROXY protocol", getServiceName(service), ServiceAnnotationPLSProxyProtocol, ServiceAnnotationLoadBalancerHealthProbeRequestPath)
+		}
+		if probeProtocol == network.ProbeProtocolHTTP || probeProtocol == network.ProbeProtocolHTTPS {
+			return nil, nil, fmt.Errorf("service %s combines %s with the %s probe protocol: HTTP probes are incompatible with PROXY protocol", getServiceName(service), ServiceAnnotationPLSProxyProtocol, probeProtocol)
+		}
+		if servicehelpers.NeedsHealthCheck(service) {
+			return nil, nil, fmt.Errorf("service %s combines %s with externalTrafficPolicy Local: the HTTP health check probes are incompatible with PROXY protocol", getServiceName(service), ServiceAnnotationPLSProxyProtocol)
+		}
+	}
+
 	var enableTCPReset *bool
 	if az.useStandardLoadBalancer() {
 		enableTCPReset = to.BoolPtr(true)
@@ -1015,8 +2329,37 @@ func (az *Cloud) reconcileLoadBalancerRule(
 		}
 	}
 
+	// SCTP has no native transport protocol in the network API: it is carried
+	// by an HA-ports rule (protocol All, port 0), which only the standard
+	// load balancer SKU supports.
+	for _, port := range ports {
+		if port.Protocol == v1.ProtocolSCTP && !az.useStandardLoadBalancer() {
+			message := fmt.Sprintf("service %s requests SCTP ports, which require the standard load balancer SKU", getServiceName(service))
+			az.Event(service, v1.EventTypeWarning, "UnsupportedProtocol", message)
+			return nil, nil, fmt.Errorf("%s", message)
+		}
+	}
+
+	// A service can also request the HA-ports rule explicitly, regardless of
+	// its port protocols.
+	haPorts := requiresHighAvailabilityPorts(service)
+	if wantLb && haPorts {
+		if !requiresInternalLoadBalancer(service) {
+			return nil, nil, fmt.Errorf("service %s requests %s, which is only supported on internal load balancers", getServiceName(service), ServiceAnnotationLoadBalancerEnableHighAvailabilityPorts)
+		}
+		if !az.useStandardLoadBalancer() {
+			return nil, nil, fmt.Errorf("service %s requests %s, which requires the standard load balancer SKU", getServiceName(service), ServiceAnnotationLoadBalancerEnableHighAvailabilityPorts)
+		}
+	}
+
+	loadDistribution, err := getLoadBalancerDistributionMode(service)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	var expectedProbes []network.Probe
 	var expectedRules []network.LoadBalancingRule
+	haPortsRuleCreated := false
 	for _, port := range ports {
 		protocols := []v1.Protocol{port.Protocol}
 		if v, ok := service.Annotations[ServiceAnnotationLoadBalancerMixedProtocols]; ok && v == "true" {
@@ -1032,6 +2375,13 @@ func (az *Cloud) reconcileLoadBalancerRule(
 			lbRuleName := az.getLoadBalancerRuleName(service, protocol, port.Port)
 			klog.V(2).Infof("reconcileLoadBalancerRule lb name (%s) rule name (%s)", lbName, lbRuleName)
 
+			// A single HA-ports rule forwards every port, so further ports
+			// of the service are already covered by it.
+			if (protocol == v1.ProtocolSCTP || haPorts) && haPortsRuleCreated {
+				klog.V(2).Infof("reconcileLoadBalancerRule lb name (%s) port %d is covered by the existing HA-ports rule", lbName, port.Port)
+				continue
+			}
+
 			transportProto, _, probeProto, err := getProtocolsFromKubernetesProtocol(protocol)
 			if err != nil {
 				return expectedProbes, expectedRules, err
@@ -1046,28 +2396,56 @@ func (az *Cloud) reconcileLoadBalancerRule(
 						RequestPath:       to.StringPtr(podPresencePath),
 						Protocol:          network.ProbeProtocolHTTP,
 						Port:              to.Int32Ptr(podPresencePort),
-						IntervalInSeconds: to.Int32Ptr(5),
-						NumberOfProbes:    to.Int32Ptr(2),
+						IntervalInSeconds: to.Int32Ptr(probeInterval),
+						NumberOfProbes:    to.Int32Ptr(numOfProbe),
 					},
 				})
 			} else if protocol != v1.ProtocolUDP && protocol != v1.ProtocolSCTP {
 				// we only add the expected probe if we're doing TCP
+				probeProperties := &network.ProbePropertiesFormat{
+					Protocol:          *probeProto,
+					Port:              to.Int32Ptr(port.NodePort),
+					IntervalInSeconds: to.Int32Ptr(probeInterval),
+					NumberOfProbes:    to.Int32Ptr(numOfProbe),
+				}
+
+				// Cluster-policy services can point the probes at a custom
+				// node port, such as a node-local health agent, so nodes that
+				// blackhole kube-proxy traffic leave the rotation.
+				probePort, err := getServiceHealthProbePort(service)
+				if err != nil {
+					return expectedProbes, expectedRules, err
+				}
+				if probePort != 0 {
+					probeProperties.Port = to.Int32Ptr(probePort)
+					if requestPath, ok := service.Annotations[ServiceAnnotationLoadBalancerHealthProbeRequestPath]; ok && requestPath != "" {
+						probeProperties.Protocol = network.ProbeProtocolHTTP
+						probeProperties.RequestPath = to.StringPtr(requestPath)
+					}
+				}
+
+				// The probe protocol annotation takes precedence over the
+				// protocol derived from the service: HTTPS-only backends can
+				// answer on a health endpoint instead of a plain TCP connect.
+				if probeProtocol != "" {
+					probeProperties.Protocol = probeProtocol
+				}
+				if probeProperties.Protocol == network.ProbeProtocolHTTP || probeProperties.Protocol == network.ProbeProtocolHTTPS {
+					if requestPath, ok := service.Annotations[ServiceAnnotationLoadBalancerHealthProbeRequestPath]; ok && requestPath != "" {
+						probeProperties.RequestPath = to.StringPtr(requestPath)
+					} else if probeProperties.RequestPath == nil {
+						probeProperties.RequestPath = to.StringPtr(defaultHealthProbeRequestPath)
+					}
+				} else {
+					probeProperties.RequestPath = nil
+				}
+
 				expectedProbes = append(expectedProbes, network.Probe{
-					Name: &lbRuleName,
-					ProbePropertiesFormat: &network.ProbePropertiesFormat{
-						Protocol:          *probeProto,
-						Port:              to.Int32Ptr(port.NodePort),
-						IntervalInSeconds: to.Int32Ptr(5),
-						NumberOfProbes:    to.Int32Ptr(2),
-					},
+					Name:                  &lbRuleName,
+					ProbePropertiesFormat: probeProperties,
 				})
 			}
 
-			loadDistribution := network.LoadDistributionDefault
-			if service.Spec.SessionAffinity == v1.ServiceAffinityClientIP {
-				loadDistribution = network.LoadDistributionSourceIP
-			}
-
 			expectedRule := network.LoadBalancingRule{
 				Name: &lbRuleName,
 				LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
@@ -1081,29 +2459,153 @@ func (az *Cloud) reconcileLoadBalancerRule(
 					LoadDistribution:    loadDistribution,
 					FrontendPort:        to.Int32Ptr(port.Port),
 					BackendPort:         to.Int32Ptr(port.Port),
-					DisableOutboundSnat: to.BoolPtr(az.disableLoadBalancerOutboundSNAT()),
-					EnableTCPReset:      enableTCPReset,
+					DisableOutboundSnat: to.BoolPtr(az.serviceDisableLoadBalancerOutboundSNAT(service)),
+					EnableTCPReset:      getRuleEnableTCPReset(service, port.Port, enableTCPReset),
 					EnableFloatingIP:    to.BoolPtr(true),
 				},
 			}
 
 			if protocol == v1.ProtocolTCP {
-				expectedRule.LoadBalancingRulePropertiesFormat.IdleTimeoutInMinutes = lbIdleTimeout
+				ruleIdleTimeout, err := getRuleIdleTimeout(service, port.Port, lbIdleTimeout)
+				if err != nil {
+					return expectedProbes, expectedRules, err
+				}
+				expectedRule.LoadBalancingRulePropertiesFormat.IdleTimeoutInMinutes = ruleIdleTimeout
 			}
 
-			// we didn't construct the probe objects for UDP or SCTP because they're not allowed on Azure.
-			// However, when externalTrafficPolicy is Local, Kubernetes HTTP health check would be used for probing.
-			if servicehelpers.NeedsHealthCheck(service) || (protocol != v1.ProtocolUDP && protocol != v1.ProtocolSCTP) {
-				expectedRule.Probe = &network.SubResource{
-					ID: to.StringPtr(az.getLoadBalancerProbeID(lbName, az.getLoadBalancerResourceGroup(), lbRuleName)),
-				}
-			}
+			if protocol == v1.ProtocolSCTP || haPorts {
+				// HA ports: the concrete port pair is zeroed out and the rule
+				// forwards every port to the backend pool.
+				expectedRule.LoadBalancingRulePropertiesFormat.Protocol = network.TransportProtocolAll
+				expectedRule.LoadBalancingRulePropertiesFormat.FrontendPort = to.Int32Ptr(0)
+				expectedRule.LoadBalancingRulePropertiesFormat.BackendPort = to.Int32Ptr(0)
+				haPortsRuleCreated = true
+			}
+
+			// we didn't construct the probe objects for UDP or SCTP because they're not allowed on Azure.
+			// However, when externalTrafficPolicy is Local, Kubernetes HTTP health check would be used for probing.
+			if servicehelpers.NeedsHealthCheck(service) || (protocol != v1.ProtocolUDP && protocol != v1.ProtocolSCTP) {
+				expectedRule.Probe = &network.SubResource{
+					ID: to.StringPtr(az.getLoadBalancerProbeID(lbName, az.getLoadBalancerResourceGroup(), lbRuleName)),
+				}
+			}
+
+			expectedRules = append(expectedRules, expectedRule)
+		}
+	}
+
+	return expectedProbes, expectedRules, nil
+}
+
+// getSecurityRulePriorityHint returns the priority the security rules of the
+// service are allocated from: the value of the priority annotation when
+// present, the default minimum priority otherwise.
+func getSecurityRulePriorityHint(service *v1.Service) (int32, error) {
+	val, ok := service.Annotations[ServiceAnnotationSecurityRulePriority]
+	if !ok {
+		return loadBalancerMinimumPriority, nil
+	}
+	priority, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", ServiceAnnotationSecurityRulePriority, err)
+	}
+	if priority < loadBalancerMinimumPriority || priority >= loadBalancerMaximumPriority {
+		return 0, fmt.Errorf("%s: priority must be between %d and %d", ServiceAnnotationSecurityRulePriority, loadBalancerMinimumPriority, loadBalancerMaximumPriority-1)
+	}
+	return int32(priority), nil
+}
+
+// getSecurityRuleSourcePortRange returns the source port range of the
+// security rules generated for the service: the value of the source port
+// range annotation when present, any source port otherwise.
+func getSecurityRuleSourcePortRange(service *v1.Service) (string, error) {
+	val, ok := service.Annotations[ServiceAnnotationSecurityRuleSourcePortRange]
+	if !ok || val == "" || val == "*" {
+		return "*", nil
+	}
+
+	parsePort := func(s string) (int, error) {
+		port, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, err
+		}
+		if port < 1 || port > 65535 {
+			return 0, fmt.Errorf("port %d is out of range", port)
+		}
+		return port, nil
+	}
+
+	parts := strings.SplitN(val, "-", 2)
+	low, err := parsePort(parts[0])
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", ServiceAnnotationSecurityRuleSourcePortRange, err)
+	}
+	if len(parts) == 2 {
+		high, err := parsePort(parts[1])
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", ServiceAnnotationSecurityRuleSourcePortRange, err)
+		}
+		if low >= high {
+			return "", fmt.Errorf("%s: range %q must run from a lower to a higher port", ServiceAnnotationSecurityRuleSourcePortRange, val)
+		}
+	}
+	return val, nil
+}
+
+// requiresPairedOutboundRules determines whether every inbound allow rule of
+// the service gets a paired outbound allow rule.
+func requiresPairedOutboundRules(service *v1.Service) bool {
+	if l, ok := service.Annotations[ServiceAnnotationSecurityRulePairedOutbound]; ok {
+		return l == "true"
+	}
+	return false
+}
+
+// pairedOutboundRule mirrors an inbound allow rule into the outbound allow
+// rule that permits the backends to answer the sources of the inbound rule.
+func pairedOutboundRule(inbound network.SecurityRule) network.SecurityRule {
+	return network.SecurityRule{
+		Name: to.StringPtr(to.String(inbound.Name) + "-out"),
+		SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+			Description:                     inbound.Description,
+			Protocol:                        inbound.Protocol,
+			SourcePortRange:                 inbound.DestinationPortRange,
+			DestinationPortRange:            to.StringPtr("*"),
+			SourceAddressPrefix:             inbound.DestinationAddressPrefix,
+			SourceApplicationSecurityGroups: inbound.DestinationApplicationSecurityGroups,
+			DestinationAddressPrefix:        inbound.SourceAddressPrefix,
+			DestinationAddressPrefixes:      inbound.SourceAddressPrefixes,
+			Access:                          network.SecurityRuleAccessAllow,
+			Direction:                       network.SecurityRuleDirectionOutbound,
+		},
+	}
+}
 
-			expectedRules = append(expectedRules, expectedRule)
+// getDenySourceRanges parses the deny source ranges annotation. Prefixes not
+// of the IP family of the frontend IP are skipped, mirroring how the allow
+// source ranges are filtered.
+func getDenySourceRanges(service *v1.Service, destinationIsIPv6 bool) ([]string, error) {
+	val, ok := service.Annotations[ServiceAnnotationDenySourceRanges]
+	if !ok || val == "" {
+		return nil, nil
+	}
+	specs := strings.Split(val, ",")
+	for i := range specs {
+		specs[i] = strings.TrimSpace(specs[i])
+	}
+	cidrs, err := utilnet.ParseCIDRs(specs)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", ServiceAnnotationDenySourceRanges, err)
+	}
+	var prefixes []string
+	for _, cidr := range cidrs {
+		if utilnet.IsIPv6CIDR(cidr) != destinationIsIPv6 {
+			klog.V(4).Infof("getDenySourceRanges(%s): skipping deny range %s, not of the IP family of the frontend IP", getServiceName(service), cidr.String())
+			continue
 		}
+		prefixes = append(prefixes, cidr.String())
 	}
-
-	return expectedProbes, expectedRules, nil
+	return prefixes, nil
 }
 
 // This reconciles the Network Security Group similar to how the LB is reconciled.
@@ -1121,11 +2623,6 @@ func (az *Cloud) reconcileSecurityGroup(clusterName string, service *v1.Service,
 		ports = []v1.ServicePort{}
 	}
 
-	sg, err := az.getSecurityGroup(azcache.CacheReadTypeDefault)
-	if err != nil {
-		return nil, err
-	}
-
 	destinationIPAddress := ""
 	if wantLb && lbIP == nil {
 		return nil, fmt.Errorf("No load balancer IP for setting up security rules for service %s", service.Name)
@@ -1149,49 +2646,197 @@ func (az *Cloud) reconcileSecurityGroup(clusterName string, service *v1.Service,
 		}
 	}
 
+	// Azure rejects security rules mixing IP families, so the source prefixes
+	// must match the family of the frontend IP the rules point at. For a
+	// dual-stack service each family is reconciled with its own frontend IP
+	// and thus gets its own per-family set of rules.
+	destinationIsIPv6 := utilnet.IsIPv6String(destinationIPAddress)
+	if destinationIPAddress == "*" {
+		destinationIsIPv6 = utilnet.IsIPv6String(service.Spec.ClusterIP)
+	}
+
 	var sourceAddressPrefixes []string
 	if (sourceRanges == nil || servicehelpers.IsAllowAll(sourceRanges)) && len(serviceTags) == 0 {
 		if !requiresInternalLoadBalancer(service) {
-			sourceAddressPrefixes = []string{"Internet"}
+			if destinationIsIPv6 {
+				// The allow-all default of GetLoadBalancerSourceRanges is
+				// expressed as 0.0.0.0/0; for an IPv6 frontend the equivalent
+				// is the whole IPv6 Internet.
+				sourceAddressPrefixes = []string{"::/0"}
+			} else {
+				sourceAddressPrefixes = []string{"Internet"}
+			}
 		}
 	} else {
 		for _, ip := range sourceRanges {
+			if utilnet.IsIPv6CIDR(ip) != destinationIsIPv6 {
+				klog.V(4).Infof("reconcileSecurityGroup(%s): skipping source range %s, not of the IP family of frontend IP %s", serviceName, ip.String(), destinationIPAddress)
+				continue
+			}
 			sourceAddressPrefixes = append(sourceAddressPrefixes, ip.String())
 		}
 		sourceAddressPrefixes = append(sourceAddressPrefixes, serviceTags...)
 	}
+	// sourceRanges is a map, so the prefixes are sorted to keep the generated
+	// rules in a stable order across reconciles and avoid spurious updates.
+	sort.Strings(sourceAddressPrefixes)
+	sourceRangeGroups, sourceAddressPrefixes, err := az.groupSourceAddressPrefixes(service, sourceAddressPrefixes, destinationIsIPv6)
+	if err != nil {
+		return nil, err
+	}
+	priorityHint, err := getSecurityRulePriorityHint(service)
+	if err != nil {
+		return nil, err
+	}
+	denySourceRanges, err := getDenySourceRanges(service, destinationIsIPv6)
+	if err != nil {
+		return nil, err
+	}
+	if len(denySourceRanges) > 0 && useSharedSecurityRule(service) {
+		return nil, fmt.Errorf("service %s cannot combine deny source ranges with a shared security rule", serviceName)
+	}
+	sourcePortRange, err := getSecurityRuleSourcePortRange(service)
+	if err != nil {
+		return nil, err
+	}
+	if sourcePortRange != "*" && useSharedSecurityRule(service) {
+		return nil, fmt.Errorf("service %s cannot combine a source port range with a shared security rule", serviceName)
+	}
+	if requiresPairedOutboundRules(service) && useSharedSecurityRule(service) {
+		return nil, fmt.Errorf("service %s cannot combine paired outbound rules with a shared security rule", serviceName)
+	}
 	expectedSecurityRules := []network.SecurityRule{}
 
-	if wantLb {
-		expectedSecurityRules = make([]network.SecurityRule, len(ports)*len(sourceAddressPrefixes))
+	// Shared rules are not stamped with ownership metadata because they carry
+	// destinations of several services; their membership is reconciled through
+	// the destination address prefixes instead.
+	var ruleDescription *string
+	if !useSharedSecurityRule(service) {
+		ruleDescription = to.StringPtr(buildSecurityRuleDescription(service))
+	}
+
+	// With destination Application Security Groups the rules target the ASGs
+	// instead of the frontend IP, so the rule set stays unchanged when the
+	// frontend IP changes.
+	destinationAddressPrefix := to.StringPtr(destinationIPAddress)
+	var destinationASGs *[]network.ApplicationSecurityGroup
+	if asgIDs := getDestinationApplicationSecurityGroupIDs(service); len(asgIDs) > 0 {
+		if useSharedSecurityRule(service) {
+			return nil, fmt.Errorf("service %s cannot combine destination application security groups with a shared security rule", serviceName)
+		}
+		destinationAddressPrefix = nil
+		destinationASGs = buildDestinationApplicationSecurityGroups(asgIDs)
+	}
 
-		for i, port := range ports {
+	if wantLb {
+		for _, port := range ports {
 			_, securityProto, _, err := getProtocolsFromKubernetesProtocol(port.Protocol)
 			if err != nil {
 				return nil, err
 			}
+			// Deny rules come before the allow rules of the port, so they are
+			// assigned lower priorities and take precedence over them.
+			for _, denyPrefix := range denySourceRanges {
+				securityRuleName := az.getSecurityRuleName(service, port, denyPrefix) + "-deny"
+				expectedSecurityRules = append(expectedSecurityRules, network.SecurityRule{
+					Name: to.StringPtr(securityRuleName),
+					SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+						Description:                          ruleDescription,
+						Protocol:                             *securityProto,
+						SourcePortRange:                      to.StringPtr(sourcePortRange),
+						DestinationPortRange:                 to.StringPtr(strconv.Itoa(int(port.Port))),
+						SourceAddressPrefix:                  to.StringPtr(denyPrefix),
+						DestinationAddressPrefix:             destinationAddressPrefix,
+						DestinationApplicationSecurityGroups: destinationASGs,
+						Access:                               network.SecurityRuleAccessDeny,
+						Direction:                            network.SecurityRuleDirectionInbound,
+					},
+				})
+			}
 			for j := range sourceAddressPrefixes {
-				ix := i*len(sourceAddressPrefixes) + j
 				securityRuleName := az.getSecurityRuleName(service, port, sourceAddressPrefixes[j])
-				expectedSecurityRules[ix] = network.SecurityRule{
+				if useSharedSecurityRule(service) {
+					securityRuleName = az.sharedResourcePrefix(clusterName) + securityRuleName
+				}
+				expectedSecurityRules = append(expectedSecurityRules, network.SecurityRule{
 					Name: to.StringPtr(securityRuleName),
 					SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
-						Protocol:                 *securityProto,
-						SourcePortRange:          to.StringPtr("*"),
-						DestinationPortRange:     to.StringPtr(strconv.Itoa(int(port.Port))),
-						SourceAddressPrefix:      to.StringPtr(sourceAddressPrefixes[j]),
-						DestinationAddressPrefix: to.StringPtr(destinationIPAddress),
-						Access:                   network.SecurityRuleAccessAllow,
-						Direction:                network.SecurityRuleDirectionInbound,
+						Description:                          ruleDescription,
+						Protocol:                             *securityProto,
+						SourcePortRange:                      to.StringPtr(sourcePortRange),
+						DestinationPortRange:                 to.StringPtr(strconv.Itoa(int(port.Port))),
+						SourceAddressPrefix:                  to.StringPtr(sourceAddressPrefixes[j]),
+						DestinationAddressPrefix:             destinationAddressPrefix,
+						DestinationApplicationSecurityGroups: destinationASGs,
+						Access:                               network.SecurityRuleAccessAllow,
+						Direction:                            network.SecurityRuleDirectionInbound,
 					},
+				})
+			}
+			for _, group := range sourceRangeGroups {
+				securityRuleName := az.getSecurityRuleName(service, port, sourceRangeGroupPrefix(group.name))
+				if useSharedSecurityRule(service) {
+					securityRuleName = az.sharedResourcePrefix(clusterName) + securityRuleName
+				}
+				groupPrefixes := append([]string{}, group.prefixes...)
+				expectedSecurityRules = append(expectedSecurityRules, network.SecurityRule{
+					Name: to.StringPtr(securityRuleName),
+					SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+						Description:                          ruleDescription,
+						Protocol:                             *securityProto,
+						SourcePortRange:                      to.StringPtr(sourcePortRange),
+						DestinationPortRange:                 to.StringPtr(strconv.Itoa(int(port.Port))),
+						SourceAddressPrefixes:                &groupPrefixes,
+						DestinationAddressPrefix:             destinationAddressPrefix,
+						DestinationApplicationSecurityGroups: destinationASGs,
+						Access:                               network.SecurityRuleAccessAllow,
+						Direction:                            network.SecurityRuleDirectionInbound,
+					},
+				})
+			}
+		}
+		for _, group := range sourceRangeGroups {
+			metrics.SourceRangeGroupRulesSet(serviceName, group.name, float64(len(ports)))
+		}
+		if requiresPairedOutboundRules(service) {
+			inboundRules := expectedSecurityRules
+			for _, rule := range inboundRules {
+				if rule.Access != network.SecurityRuleAccessAllow {
+					continue
 				}
+				expectedSecurityRules = append(expectedSecurityRules, pairedOutboundRule(rule))
 			}
 		}
 	}
 
 	for _, r := range expectedSecurityRules {
-		klog.V(10).Infof("Expecting security rule for %s: %s:%s -> %s:%s", service.Name, *r.SourceAddressPrefix, *r.SourcePortRange, *r.DestinationAddressPrefix, *r.DestinationPortRange)
+		klog.V(10).Infof("Expecting security rule for %s: %s:%s -> %s:%s", service.Name, logSafeCollection(r.SourceAddressPrefix, r.SourceAddressPrefixes), logSafe(r.SourcePortRange), logSafe(r.DestinationAddressPrefix), logSafe(r.DestinationPortRange))
+	}
+
+	// The rule reconciliation below runs inside the security group updater,
+	// so concurrent reconciles mutate the same security group state in turn
+	// and are written with a single PUT instead of racing read-modify-write
+	// cycles.
+	var updatedSg network.SecurityGroup
+	op := az.nsgUpdater.addUpdateOperation(service, func(sg *network.SecurityGroup) (bool, error) {
+		dirtySg, err := az.reconcileSecurityGroupRules(clusterName, service, sg, wantLb, ports, destinationIPAddress, sourceAddressPrefixes, sourceRangeGroups, expectedSecurityRules, priorityHint)
+		if err != nil {
+			return false, err
+		}
+		updatedSg = *sg
+		return dirtySg, nil
+	})
+	if err := op.wait(); err != nil {
+		return nil, err
 	}
+	return &updatedSg, nil
+}
+
+// reconcileSecurityGroupRules applies the expected rule set of a service to
+// the given security group in place and reports whether it changed anything.
+// It runs under the security group updater, see reconcileSecurityGroup.
+func (az *Cloud) reconcileSecurityGroupRules(clusterName string, service *v1.Service, sg *network.SecurityGroup, wantLb bool, ports []v1.ServicePort, destinationIPAddress string, sourceAddressPrefixes []string, sourceRangeGroups []sourceRangeGroup, expectedSecurityRules []network.SecurityRule, priorityHint int32) (bool, error) {
+	serviceName := getServiceName(service)
 
 	// update security rules
 	dirtySg := false
@@ -1208,7 +2853,11 @@ func (az *Cloud) reconcileSecurityGroup(clusterName string, service *v1.Service,
 	// to this service
 	for i := len(updatedRules) - 1; i >= 0; i-- {
 		existingRule := updatedRules[i]
-		if az.serviceOwnsRule(service, *existingRule.Name) {
+		if az.ownedByOtherCluster(clusterName, *existingRule.Name) {
+			// Never evict rules owned by other clusters sharing the security group.
+			continue
+		}
+		if az.serviceOwnsSecurityRule(service, existingRule) {
 			klog.V(10).Infof("reconcile(%s)(%t): sg rule(%s) - considering evicting", serviceName, wantLb, *existingRule.Name)
 			keepRule := false
 			if findSecurityRule(expectedSecurityRules, existingRule) {
@@ -1225,9 +2874,13 @@ func (az *Cloud) reconcileSecurityGroup(clusterName string, service *v1.Service,
 	// update security rules: if the service uses a shared rule and is being deleted,
 	// then remove it from the shared rule
 	if useSharedSecurityRule(service) && !wantLb {
+		sharedRulePrefixes := append([]string{}, sourceAddressPrefixes...)
+		for _, group := range sourceRangeGroups {
+			sharedRulePrefixes = append(sharedRulePrefixes, sourceRangeGroupPrefix(group.name))
+		}
 		for _, port := range ports {
-			for _, sourceAddressPrefix := range sourceAddressPrefixes {
-				sharedRuleName := az.getSecurityRuleName(service, port, sourceAddressPrefix)
+			for _, sourceAddressPrefix := range sharedRulePrefixes {
+				sharedRuleName := az.sharedResourcePrefix(clusterName) + az.getSecurityRuleName(service, port, sourceAddressPrefix)
 				sharedIndex, sharedRule, sharedRuleFound := findSecurityRuleByName(updatedRules, sharedRuleName)
 				if !sharedRuleFound {
 					klog.V(4).Infof("Didn't find shared rule %s for service %s", sharedRuleName, service.Name)
@@ -1243,6 +2896,12 @@ func (az *Cloud) reconcileSecurityGroup(clusterName string, service *v1.Service,
 					klog.V(4).Infof("Didn't find destination address %v in shared rule %s for service %s", destinationIPAddress, sharedRuleName, service.Name)
 					continue
 				}
+				if az.sharedPIPPortInUseByOtherService(service, port) {
+					// The BYO public IP is shared with another service exposing
+					// the same port, so its destination must stay in the rule.
+					klog.V(2).Infof("reconcile(%s): keeping destination %s in shared rule %s because another service shares the public IP and port", serviceName, destinationIPAddress, sharedRuleName)
+					continue
+				}
 				if len(existingPrefixes) == 1 {
 					updatedRules = append(updatedRules[:sharedIndex], updatedRules[sharedIndex+1:]...)
 				} else {
@@ -1280,10 +2939,11 @@ func (az *Cloud) reconcileSecurityGroup(clusterName string, service *v1.Service,
 		}
 		if !foundRule {
 			klog.V(10).Infof("reconcile(%s)(%t): sg rule(%s) - adding", serviceName, wantLb, *expectedRule.Name)
+			az.detectSharedRuleConflict(clusterName, service, updatedRules, *expectedRule.Name)
 
-			nextAvailablePriority, err := getNextAvailablePriority(updatedRules)
+			nextAvailablePriority, err := getNextAvailablePriorityFrom(updatedRules, priorityHint)
 			if err != nil {
-				return nil, err
+				return false, err
 			}
 
 			expectedRule.Priority = to.Int32Ptr(nextAvailablePriority)
@@ -1296,18 +2956,27 @@ func (az *Cloud) reconcileSecurityGroup(clusterName string, service *v1.Service,
 		klog.V(10).Infof("Updated security rule while processing %s: %s:%s -> %s:%s", service.Name, logSafe(r.SourceAddressPrefix), logSafe(r.SourcePortRange), logSafeCollection(r.DestinationAddressPrefix, r.DestinationAddressPrefixes), logSafe(r.DestinationPortRange))
 	}
 
+	if az.SharedVNetCoordination {
+		var tagsChanged bool
+		sg.Tags, tagsChanged = az.ensureSharedResourceTags(clusterName, sg.Tags)
+		if tagsChanged && !dirtySg {
+			// A tag-only update has no traffic impact and yields to the write
+			// budget; the tags are reconciled again in a later sync period.
+			if az.writeBudget.allow(false) {
+				dirtySg = true
+			} else {
+				klog.V(2).Infof("reconcileSecurityGroup for service(%s): deferring the tag-only update of nsg(%s) because the write budget is used up", serviceName, to.String(sg.Name))
+			}
+		} else if tagsChanged {
+			dirtySg = true
+		}
+	}
+
 	if dirtySg {
 		sg.SecurityRules = &updatedRules
 		klog.V(2).Infof("reconcileSecurityGroup for service(%s): sg(%s) - updating", serviceName, *sg.Name)
-		klog.V(10).Infof("CreateOrUpdateSecurityGroup(%q): start", *sg.Name)
-		err := az.CreateOrUpdateSecurityGroup(service, sg)
-		if err != nil {
-			klog.V(2).Infof("ensure(%s) abort backoff: sg(%s) - updating", serviceName, *sg.Name)
-			return nil, err
-		}
-		klog.V(10).Infof("CreateOrUpdateSecurityGroup(%q): end", *sg.Name)
 	}
-	return &sg, nil
+	return dirtySg, nil
 }
 
 func (az *Cloud) shouldUpdateLoadBalancer(clusterName string, service *v1.Service) bool {
@@ -1477,41 +3146,58 @@ func (az *Cloud) reconcilePublicIP(clusterName string, service *v1.Service, lbNa
 	}
 
 	pipResourceGroup := az.getPublicIPAddressResourceGroup(service)
-
-	pips, err := az.ListPIP(service, pipResourceGroup)
-	if err != nil {
-		return nil, err
+	pipResourceGroups := []string{pipResourceGroup}
+	if !strings.EqualFold(pipResourceGroup, az.ResourceGroup) {
+		// During migration to a dedicated public IP resource group, public
+		// IPs created before the move still live in the cluster resource
+		// group and keep being reconciled there.
+		pipResourceGroups = append(pipResourceGroups, az.ResourceGroup)
 	}
 
 	var found bool
-	var pipsToBeDeleted []*network.PublicIPAddress
-	for i := range pips {
-		pip := pips[i]
-		pipName := *pip.Name
-		if serviceOwnsPublicIP(&pip, clusterName, serviceName) {
-			// We need to process for pips belong to this service
-			if wantLb && !isInternal && pipName == desiredPipName {
-				// This is the only case we should preserve the
-				// Public ip resource with match service tag
+	var deleteFuncs []func() error
+	for _, resourceGroup := range pipResourceGroups {
+		pips, err := az.ListPIP(service, resourceGroup)
+		if err != nil {
+			return nil, err
+		}
+
+		pipDeleteResourceGroup := resourceGroup
+		var pipsToBeDeleted []*network.PublicIPAddress
+		for i := range pips {
+			pip := pips[i]
+			pipName := *pip.Name
+			if az.ownsPublicIP(&pip, clusterName, serviceName) {
+				// We need to process for pips belong to this service
+				if wantLb && !isInternal && pipName == desiredPipName {
+					// This is the only case we should preserve the
+					// Public ip resource with match service tag
+					found = true
+					if err := az.reclaimReleasedPublicIP(service, resourceGroup, &pip); err != nil {
+						return nil, err
+					}
+				} else {
+					pipsToBeDeleted = append(pipsToBeDeleted, &pip)
+				}
+			} else if wantLb && !isInternal && pipName == desiredPipName {
 				found = true
-			} else {
+			} else if az.shouldRecyclePublicIP() && az.publicIPReleaseExpired(&pip) {
+				// Garbage collect released public IPs once their grace period has
+				// expired, including the ones of services deleted in the meanwhile.
 				pipsToBeDeleted = append(pipsToBeDeleted, &pip)
 			}
-		} else if wantLb && !isInternal && pipName == desiredPipName {
-			found = true
+		}
+		for _, pip := range pipsToBeDeleted {
+			pipCopy := *pip
+			deleteFuncs = append(deleteFuncs, func() error {
+				klog.V(2).Infof("reconcilePublicIP for service(%s): pip(%s/%s) - deleting", serviceName, pipDeleteResourceGroup, *pipCopy.Name)
+				return az.safeDeletePublicIP(service, pipDeleteResourceGroup, &pipCopy, lb)
+			})
 		}
 	}
 	if !isInternal && shouldPIPExisted && !found && wantLb {
 		return nil, fmt.Errorf("reconcilePublicIP for service(%s): pip(%s) not found", serviceName, desiredPipName)
 	}
-	var deleteFuncs []func() error
-	for _, pip := range pipsToBeDeleted {
-		pipCopy := *pip
-		deleteFuncs = append(deleteFuncs, func() error {
-			klog.V(2).Infof("reconcilePublicIP for service(%s): pip(%s) - deleting", serviceName, *pip.Name)
-			return az.safeDeletePublicIP(service, pipResourceGroup, &pipCopy, lb)
-		})
-	}
 	errs := utilerrors.AggregateGoroutines(deleteFuncs...)
 	if errs != nil {
 		return nil, utilerrors.Flatten(errs)
@@ -1546,7 +3232,7 @@ func (az *Cloud) safeDeletePublicIP(service *v1.Service, pipResourceGroup string
 			lbFrontendIPConfigs := *lb.LoadBalancerPropertiesFormat.FrontendIPConfigurations
 			for i := len(lbFrontendIPConfigs) - 1; i >= 0; i-- {
 				config := lbFrontendIPConfigs[i]
-				if strings.EqualFold(ipConfigurationID, to.String(config.ID)) {
+				if equalResourceIDs(ipConfigurationID, to.String(config.ID)) {
 					if config.FrontendIPConfigurationPropertiesFormat != nil &&
 						config.FrontendIPConfigurationPropertiesFormat.LoadBalancingRules != nil {
 						referencedLBRules = *config.FrontendIPConfigurationPropertiesFormat.LoadBalancingRules
@@ -1597,6 +3283,21 @@ func (az *Cloud) safeDeletePublicIP(service *v1.Service, pipResourceGroup string
 	}
 
 	pipName := to.String(pip.Name)
+	if az.isPoolPublicIP(pip) {
+		// Pool members are shared cluster infrastructure; release the
+		// assignment instead of deleting the IP.
+		return az.returnPublicIPToPool(service, pipResourceGroup, pip)
+	}
+	if az.shouldRecyclePublicIP() {
+		if _, released := pip.Tags[releasedAtTagKey]; !released {
+			return az.markPublicIPReleased(service, pipResourceGroup, pip)
+		}
+		if !az.publicIPReleaseExpired(pip) {
+			// Keep the released public IP until the grace period expires.
+			return nil
+		}
+	}
+
 	klog.V(10).Infof("DeletePublicIP(%s, %q): start", pipResourceGroup, pipName)
 	err := az.DeletePublicIP(service, pipResourceGroup, pipName)
 	if err != nil {
@@ -1607,6 +3308,62 @@ func (az *Cloud) safeDeletePublicIP(service *v1.Service, pipResourceGroup string
 	return nil
 }
 
+// shouldRecyclePublicIP returns whether provider-created public IPs are soft
+// deleted instead of being removed right away.
+func (az *Cloud) shouldRecyclePublicIP() bool {
+	return az.PublicIPRecycleGracePeriodInSeconds > 0
+}
+
+// markPublicIPReleased tags the public IP as released so that it is garbage
+// collected after the configured grace period.
+func (az *Cloud) markPublicIPReleased(service *v1.Service, pipResourceGroup string, pip *network.PublicIPAddress) error {
+	// The released tag has no traffic impact and yields to the write budget.
+	if !az.writeBudget.allow(false) {
+		klog.V(2).Infof("markPublicIPReleased for service(%s): deferring the tag update of pip(%s) because the write budget is used up", getServiceName(service), to.String(pip.Name))
+		return nil
+	}
+	if pip.Tags == nil {
+		pip.Tags = make(map[string]*string)
+	}
+	pip.Tags[releasedAtTagKey] = to.StringPtr(time.Now().UTC().Format(time.RFC3339))
+	klog.V(2).Infof("markPublicIPReleased for service(%s): pip(%s) released, it would be deleted after %d seconds", getServiceName(service), to.String(pip.Name), az.PublicIPRecycleGracePeriodInSeconds)
+	az.tagsUpdater.addTagsOperation(tagsResourcePublicIP, pipResourceGroup, to.String(pip.Name), pip.Tags)
+	return nil
+}
+
+// reclaimReleasedPublicIP clears the released tag from the public IP when the
+// service claims it again within the grace period.
+func (az *Cloud) reclaimReleasedPublicIP(service *v1.Service, pipResourceGroup string, pip *network.PublicIPAddress) error {
+	if _, released := pip.Tags[releasedAtTagKey]; !released {
+		return nil
+	}
+	// The released tag has no traffic impact and yields to the write budget.
+	if !az.writeBudget.allow(false) {
+		klog.V(2).Infof("reclaimReleasedPublicIP for service(%s): deferring the tag update of pip(%s) because the write budget is used up", getServiceName(service), to.String(pip.Name))
+		return nil
+	}
+	delete(pip.Tags, releasedAtTagKey)
+	klog.V(2).Infof("reclaimReleasedPublicIP for service(%s): pip(%s) recovered within the grace period", getServiceName(service), to.String(pip.Name))
+	az.tagsUpdater.addTagsOperation(tagsResourcePublicIP, pipResourceGroup, to.String(pip.Name), pip.Tags)
+	return nil
+}
+
+// publicIPReleaseExpired returns whether the grace period of the released
+// public IP has expired. Unparsable timestamps are treated as expired.
+func (az *Cloud) publicIPReleaseExpired(pip *network.PublicIPAddress) bool {
+	releasedAt, released := pip.Tags[releasedAtTagKey]
+	if !released {
+		return false
+	}
+
+	releasedTime, err := time.Parse(time.RFC3339, to.String(releasedAt))
+	if err != nil {
+		klog.Warningf("publicIPReleaseExpired: unexpected released timestamp %q on pip(%s), deleting it", to.String(releasedAt), to.String(pip.Name))
+		return true
+	}
+	return time.Since(releasedTime) > time.Duration(az.PublicIPRecycleGracePeriodInSeconds)*time.Second
+}
+
 func findProbe(probes []network.Probe, probe network.Probe) bool {
 	for _, existingProbe := range probes {
 		if strings.EqualFold(to.String(existingProbe.Name), to.String(probe.Name)) && to.Int32(existingProbe.Port) == to.Int32(probe.Port) {
@@ -1616,6 +3373,30 @@ func findProbe(probes []network.Probe, probe network.Probe) bool {
 	return false
 }
 
+func findNatPool(pools []network.InboundNatPool, pool network.InboundNatPool) bool {
+	for _, existingPool := range pools {
+		if strings.EqualFold(to.String(existingPool.Name), to.String(pool.Name)) &&
+			equalInboundNatPoolPropertiesFormat(existingPool.InboundNatPoolPropertiesFormat, pool.InboundNatPoolPropertiesFormat) {
+			return true
+		}
+	}
+	return false
+}
+
+// equalInboundNatPoolPropertiesFormat checks whether the provided InboundNatPoolPropertiesFormat are equal.
+// Note: only fields used in reconcileLoadBalancer are considered.
+func equalInboundNatPoolPropertiesFormat(s *network.InboundNatPoolPropertiesFormat, t *network.InboundNatPoolPropertiesFormat) bool {
+	if s == nil || t == nil {
+		return false
+	}
+
+	return reflect.DeepEqual(s.Protocol, t.Protocol) &&
+		reflect.DeepEqual(s.FrontendIPConfiguration, t.FrontendIPConfiguration) &&
+		reflect.DeepEqual(s.FrontendPortRangeStart, t.FrontendPortRangeStart) &&
+		reflect.DeepEqual(s.FrontendPortRangeEnd, t.FrontendPortRangeEnd) &&
+		reflect.DeepEqual(s.BackendPort, t.BackendPort)
+}
+
 func findRule(rules []network.LoadBalancingRule, rule network.LoadBalancingRule, wantLB bool) bool {
 	for _, existingRule := range rules {
 		if strings.EqualFold(to.String(existingRule.Name), to.String(rule.Name)) &&
@@ -1649,7 +3430,7 @@ func equalLoadBalancingRulePropertiesFormat(s *network.LoadBalancingRuleProperti
 	return properties
 }
 
-// This compares rule's Name, Protocol, SourcePortRange, DestinationPortRange, SourceAddressPrefix, Access, and Direction.
+// This compares rule's Name, Protocol, SourcePortRange, DestinationPortRange, SourceAddressPrefix, SourceAddressPrefixes, Access, and Direction.
 // Note that it compares rule's DestinationAddressPrefix only when it's not consolidated rule as such rule does not have DestinationAddressPrefix defined.
 // We intentionally do not compare DestinationAddressPrefixes in consolidated case because reconcileSecurityRule has to consider the two rules equal,
 // despite different DestinationAddressPrefixes, in order to give it a chance to consolidate the two rules.
@@ -1670,11 +3451,17 @@ func findSecurityRule(rules []network.SecurityRule, rule network.SecurityRule) b
 		if !strings.EqualFold(to.String(existingRule.SourceAddressPrefix), to.String(rule.SourceAddressPrefix)) {
 			continue
 		}
+		if !securityRuleSourcePrefixesEqual(existingRule.SourceAddressPrefixes, rule.SourceAddressPrefixes) {
+			continue
+		}
 		if !allowsConsolidation(existingRule) && !allowsConsolidation(rule) {
 			if !strings.EqualFold(to.String(existingRule.DestinationAddressPrefix), to.String(rule.DestinationAddressPrefix)) {
 				continue
 			}
 		}
+		if !securityRuleDestinationASGsEqual(existingRule.DestinationApplicationSecurityGroups, rule.DestinationApplicationSecurityGroups) {
+			continue
+		}
 		if !strings.EqualFold(string(existingRule.Access), string(rule.Access)) {
 			continue
 		}
@@ -1686,7 +3473,38 @@ func findSecurityRule(rules []network.SecurityRule, rule network.SecurityRule) b
 	return false
 }
 
+// securityRuleSourcePrefixesEqual compares the SourceAddressPrefixes of two
+// security rules as order-insensitive, case-insensitive sets, with nil and the
+// empty list considered equal.
+func securityRuleSourcePrefixesEqual(existing *[]string, expected *[]string) bool {
+	existingPrefixes := append([]string{}, to.StringSlice(existing)...)
+	expectedPrefixes := append([]string{}, to.StringSlice(expected)...)
+	if len(existingPrefixes) != len(expectedPrefixes) {
+		return false
+	}
+	sort.Strings(existingPrefixes)
+	sort.Strings(expectedPrefixes)
+	for i := range existingPrefixes {
+		if !strings.EqualFold(existingPrefixes[i], expectedPrefixes[i]) {
+			return false
+		}
+	}
+	return true
+}
+
 func (az *Cloud) getPublicIPAddressResourceGroup(service *v1.Service) string {
+	// A public IP referenced by resource ID carries its own resource group.
+	if resourceGroup, _, err := getPublicIPResourceID(service); err == nil && resourceGroup != "" {
+		return resourceGroup
+	}
+
+	if resourceGroup, found := service.Annotations[ServiceAnnotationPIPResourceGroup]; found {
+		resourceGroupName := strings.TrimSpace(resourceGroup)
+		if len(resourceGroupName) > 0 {
+			return resourceGroupName
+		}
+	}
+
 	if resourceGroup, found := service.Annotations[ServiceAnnotationLoadBalancerResourceGroup]; found {
 		resourceGroupName := strings.TrimSpace(resourceGroup)
 		if len(resourceGroupName) > 0 {
@@ -1694,6 +3512,10 @@ func (az *Cloud) getPublicIPAddressResourceGroup(service *v1.Service) string {
 		}
 	}
 
+	if az.PublicIPResourceGroup != "" {
+		return az.PublicIPResourceGroup
+	}
+
 	return az.ResourceGroup
 }
 
@@ -1723,6 +3545,41 @@ func requiresInternalLoadBalancer(service *v1.Service) bool {
 	return false
 }
 
+func requiresHighAvailabilityPorts(service *v1.Service) bool {
+	if l, found := service.Annotations[ServiceAnnotationLoadBalancerEnableHighAvailabilityPorts]; found {
+		return l == "true"
+	}
+
+	return false
+}
+
+// requiresGlobalInternalLoadBalancer determines whether the service wants its
+// frontend on the global tier (cross-region) of internal load balancing.
+func requiresGlobalInternalLoadBalancer(service *v1.Service) bool {
+	if l, found := service.Annotations[ServiceAnnotationLoadBalancerInternalGlobal]; found {
+		return l == "true"
+	}
+
+	return false
+}
+
+// validateGlobalInternalLoadBalancer checks the prerequisites of the global
+// internal load balancer annotation of the service.
+func (az *Cloud) validateGlobalInternalLoadBalancer(service *v1.Service) error {
+	if !requiresGlobalInternalLoadBalancer(service) {
+		return nil
+	}
+	if !requiresInternalLoadBalancer(service) {
+		return fmt.Errorf("annotation %s of service %s requires the internal load balancer annotation %s",
+			ServiceAnnotationLoadBalancerInternalGlobal, getServiceName(service), ServiceAnnotationLoadBalancerInternal)
+	}
+	if !az.useStandardLoadBalancer() {
+		return fmt.Errorf("annotation %s of service %s requires loadBalancerSku standard",
+			ServiceAnnotationLoadBalancerInternalGlobal, getServiceName(service))
+	}
+	return nil
+}
+
 func subnet(service *v1.Service) *string {
 	if requiresInternalLoadBalancer(service) {
 		if l, found := service.Annotations[ServiceAnnotationLoadBalancerInternalSubnet]; found && strings.TrimSpace(l) != "" {
@@ -1733,6 +3590,57 @@ func subnet(service *v1.Service) *string {
 	return nil
 }
 
+// subnetNetworkPoliciesDisabled is the subnet policy value that allows private
+// link services to be placed in the subnet.
+const subnetNetworkPoliciesDisabled = "Disabled"
+
+// ensureSubnetNetworkPolicies checks the network policies of the subnet that
+// backs an internal load balancer frontend. Azure rejects private link
+// services in subnets with privateLinkServiceNetworkPolicies enabled with an
+// obscure ARM error, hence the policies are disabled up front when the
+// configuration allows it; otherwise a precise event is emitted so that the
+// operator can disable them out of band.
+func (az *Cloud) ensureSubnetNetworkPolicies(service *v1.Service, subnet *network.Subnet) error {
+	if subnet.SubnetPropertiesFormat == nil {
+		return nil
+	}
+
+	enabledPolicies := make([]string, 0, 2)
+	if policies := subnet.PrivateLinkServiceNetworkPolicies; policies != nil && !strings.EqualFold(*policies, subnetNetworkPoliciesDisabled) {
+		enabledPolicies = append(enabledPolicies, "privateLinkServiceNetworkPolicies")
+	}
+	if policies := subnet.PrivateEndpointNetworkPolicies; policies != nil && !strings.EqualFold(*policies, subnetNetworkPoliciesDisabled) {
+		enabledPolicies = append(enabledPolicies, "privateEndpointNetworkPolicies")
+	}
+	if len(enabledPolicies) == 0 {
+		return nil
+	}
+
+	if !az.AutoDisableSubnetNetworkPolicies {
+		az.Event(service, v1.EventTypeWarning, "SubnetNetworkPolicies",
+			fmt.Sprintf("subnet %s has %s enabled; Azure would reject private link services in it until the policies are disabled or autoDisableSubnetNetworkPolicies is configured",
+				to.String(subnet.Name), strings.Join(enabledPolicies, " and ")))
+		return nil
+	}
+
+	subnet.PrivateLinkServiceNetworkPolicies = to.StringPtr(subnetNetworkPoliciesDisabled)
+	subnet.PrivateEndpointNetworkPolicies = to.StringPtr(subnetNetworkPoliciesDisabled)
+
+	rgName := az.ResourceGroup
+	if len(az.VnetResourceGroup) > 0 {
+		rgName = az.VnetResourceGroup
+	}
+
+	klog.V(2).Infof("ensureSubnetNetworkPolicies for service (%s): disabling %s on subnet %s", getServiceName(service), strings.Join(enabledPolicies, " and "), to.String(subnet.Name))
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	if rerr := az.SubnetsClient.CreateOrUpdate(ctx, rgName, az.VnetName, to.String(subnet.Name), *subnet); rerr != nil {
+		klog.Errorf("SubnetsClient.CreateOrUpdate(%s) failed: %v", to.String(subnet.Name), rerr)
+		return rerr.Error()
+	}
+	return nil
+}
+
 // getServiceLoadBalancerMode parses the mode value.
 // if the value is __auto__ it returns isAuto = TRUE.
 // if anything else it returns the unique VM set names after trimming spaces.
@@ -1765,6 +3673,107 @@ func useSharedSecurityRule(service *v1.Service) bool {
 	return false
 }
 
+// ownsLoadBalancerService reports whether this provider should act on the
+// service based on its load balancer class. Services without a class are
+// always handled; classed services are only handled when the class matches
+// the configured LoadBalancerClassName. EnsureLoadBalancerDeleted
+// deliberately does not consult this: per the cloudprovider contract,
+// teardown must run even after a class change so resources allocated before
+// the change are cleaned up.
+func (az *Cloud) ownsLoadBalancerService(service *v1.Service) bool {
+	class := service.Annotations[ServiceAnnotationLoadBalancerClass]
+	if class == "" {
+		return true
+	}
+
+	return az.LoadBalancerClassName != "" && strings.EqualFold(class, az.LoadBalancerClassName)
+}
+
+// getServiceHealthProbePort returns the node port the health probes should
+// target instead of the service node port, as requested by the
+// ServiceAnnotationLoadBalancerHealthProbePort annotation. Zero means the
+// annotation is not set.
+func getServiceHealthProbePort(service *v1.Service) (int32, error) {
+	value, ok := service.Annotations[ServiceAnnotationLoadBalancerHealthProbePort]
+	if !ok {
+		return 0, nil
+	}
+
+	port, err := strconv.Atoi(value)
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, fmt.Errorf("annotation %s of service %s has invalid port %q", ServiceAnnotationLoadBalancerHealthProbePort, getServiceName(service), value)
+	}
+
+	return int32(port), nil
+}
+
+// getServiceHealthProbeProtocol returns the probe protocol requested by the
+// ServiceAnnotationLoadBalancerHealthProbeProtocol annotation. An empty
+// protocol means the annotation is not set.
+func getServiceHealthProbeProtocol(service *v1.Service) (network.ProbeProtocol, error) {
+	value, ok := service.Annotations[ServiceAnnotationLoadBalancerHealthProbeProtocol]
+	if !ok || value == "" {
+		return "", nil
+	}
+
+	for _, protocol := range []network.ProbeProtocol{network.ProbeProtocolTCP, network.ProbeProtocolHTTP, network.ProbeProtocolHTTPS} {
+		if strings.EqualFold(value, string(protocol)) {
+			return protocol, nil
+		}
+	}
+
+	return "", fmt.Errorf("annotation %s of service %s has invalid protocol %q, supported values are Tcp, Http and Https", ServiceAnnotationLoadBalancerHealthProbeProtocol, getServiceName(service), value)
+}
+
+// getServiceHealthProbeInterval returns the probe interval in seconds
+// requested by the ServiceAnnotationLoadBalancerHealthProbeInterval
+// annotation, falling back to the cluster-wide loadBalancerHealthProbeInterval
+// cloud config default and finally to 5.
+func (az *Cloud) getServiceHealthProbeInterval(service *v1.Service) (int32, error) {
+	value, ok := service.Annotations[ServiceAnnotationLoadBalancerHealthProbeInterval]
+	if !ok || value == "" {
+		if az.LoadBalancerHealthProbeInterval != 0 {
+			return az.LoadBalancerHealthProbeInterval, nil
+		}
+		return defaultHealthProbeInterval, nil
+	}
+
+	interval, err := strconv.Atoi(value)
+	if err != nil || interval < 5 || interval > 2147483646 {
+		return 0, fmt.Errorf("annotation %s of service %s has invalid interval %q, supported values are between 5 and 2147483646", ServiceAnnotationLoadBalancerHealthProbeInterval, getServiceName(service), value)
+	}
+
+	return int32(interval), nil
+}
+
+// getServiceHealthProbeNumOfProbe returns the number of probe failures after
+// which a backend leaves the rotation, as requested by the
+// ServiceAnnotationLoadBalancerHealthProbeNumOfProbe annotation, falling back
+// to the cluster-wide loadBalancerHealthProbeNumOfProbe cloud config default
+// and finally to 2.
+func (az *Cloud) getServiceHealthProbeNumOfProbe(service *v1.Service) (int32, error) {
+	value, ok := service.Annotations[ServiceAnnotationLoadBalancerHealthProbeNumOfProbe]
+	if !ok || value == "" {
+		if az.LoadBalancerHealthProbeNumOfProbe != 0 {
+			return az.LoadBalancerHealthProbeNumOfProbe, nil
+		}
+		return defaultHealthProbeNumOfProbe, nil
+	}
+
+	numOfProbe, err := strconv.Atoi(value)
+	if err != nil || numOfProbe < 1 || numOfProbe > 20 {
+		return 0, fmt.Errorf("annotation %s of service %s has invalid number of probes %q, supported values are between 1 and 20", ServiceAnnotationLoadBalancerHealthProbeNumOfProbe, getServiceName(service), value)
+	}
+
+	return int32(numOfProbe), nil
+}
+
+// wantsPLSProxyProtocol returns whether the service declares that its private
+// link service uses PROXY protocol v2.
+func wantsPLSProxyProtocol(service *v1.Service) bool {
+	return strings.EqualFold(service.Annotations[ServiceAnnotationPLSProxyProtocol], "true")
+}
+
 func getServiceTags(service *v1.Service) []string {
 	if service == nil {
 		return nil
@@ -35,10 +35,13 @@ import (
 
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakeclient "k8s.io/client-go/kubernetes/fake"
+	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/legacy-cloud-providers/azure/clients/loadbalancerclient/mockloadbalancerclient"
 	"k8s.io/legacy-cloud-providers/azure/clients/publicipclient/mockpublicipclient"
 	"k8s.io/legacy-cloud-providers/azure/clients/securitygroupclient/mocksecuritygroupclient"
 	"k8s.io/legacy-cloud-providers/azure/clients/subnetclient/mocksubnetclient"
+	"k8s.io/legacy-cloud-providers/azure/mockvmsets"
 	"k8s.io/legacy-cloud-providers/azure/retry"
 )
 
@@ -526,9 +529,10 @@ func TestGetPublicIPAddressResourceGroup(t *testing.T) {
 	az := GetTestCloud(ctrl)
 
 	for i, c := range []struct {
-		desc        string
-		annotations map[string]string
-		expected    string
+		desc                  string
+		annotations           map[string]string
+		publicIPResourceGroup string
+		expected              string
 	}{
 		{
 			desc:     "no annotation",
@@ -544,10 +548,28 @@ func TestGetPublicIPAddressResourceGroup(t *testing.T) {
 			annotations: map[string]string{ServiceAnnotationLoadBalancerResourceGroup: "rg2"},
 			expected:    "rg2",
 		},
+		{
+			desc:                  "configured public IP resource group",
+			publicIPResourceGroup: "networking-rg",
+			expected:              "networking-rg",
+		},
+		{
+			desc:                  "LB resource group annotation overrides the configured resource group",
+			annotations:           map[string]string{ServiceAnnotationLoadBalancerResourceGroup: "rg2"},
+			publicIPResourceGroup: "networking-rg",
+			expected:              "rg2",
+		},
+		{
+			desc:                  "pip resource group annotation overrides everything",
+			annotations:           map[string]string{ServiceAnnotationPIPResourceGroup: "pip-rg", ServiceAnnotationLoadBalancerResourceGroup: "rg2"},
+			publicIPResourceGroup: "networking-rg",
+			expected:              "pip-rg",
+		},
 	} {
 		t.Run(c.desc, func(t *testing.T) {
 			s := &v1.Service{}
 			s.Annotations = c.annotations
+			az.PublicIPResourceGroup = c.publicIPResourceGroup
 			real := az.getPublicIPAddressResourceGroup(s)
 			assert.Equal(t, c.expected, real, "TestCase[%d]: %s", i, c.desc)
 		})
@@ -986,6 +1008,7 @@ func TestDeterminePublicIPName(t *testing.T) {
 	testCases := []struct {
 		desc           string
 		loadBalancerIP string
+		annotations    map[string]string
 		existingPIPs   []network.PublicIPAddress
 		expectedIP     string
 		expectedError  bool
@@ -996,6 +1019,23 @@ func TestDeterminePublicIPName(t *testing.T) {
 			expectedIP:    "testCluster-atest1",
 			expectedError: false,
 		},
+		{
+			desc: "determinePublicIpName shall return the name from the pip resource ID annotation " +
+				"without scanning the resource group",
+			annotations: map[string]string{
+				ServiceAnnotationPIPID: "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/pipByID",
+			},
+			expectedIP:    "pipByID",
+			expectedError: false,
+		},
+		{
+			desc: "determinePublicIpName shall report error if the pip resource ID annotation is malformed",
+			annotations: map[string]string{
+				ServiceAnnotationPIPID: "not-a-resource-id",
+			},
+			expectedIP:    "",
+			expectedError: true,
+		},
 		{
 			desc:           "determinePublicIpName shall report error if loadBalancerIP is not in the resource group",
 			loadBalancerIP: "1.2.3.4",
@@ -1020,7 +1060,7 @@ func TestDeterminePublicIPName(t *testing.T) {
 	}
 	for i, test := range testCases {
 		az := GetTestCloud(ctrl)
-		service := getTestService("test1", v1.ProtocolTCP, nil, false, 80)
+		service := getTestService("test1", v1.ProtocolTCP, test.annotations, false, 80)
 		service.Spec.LoadBalancerIP = test.loadBalancerIP
 
 		mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
@@ -1039,6 +1079,98 @@ func TestDeterminePublicIPName(t *testing.T) {
 	}
 }
 
+func TestGetLoadBalancerNameFrontendKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+
+	testCases := []struct {
+		desc         string
+		annotations  map[string]string
+		expectedName string
+	}{
+		{
+			desc:         "GetLoadBalancerName shall derive the name from the service UID by default",
+			expectedName: "atest1",
+		},
+		{
+			desc:         "GetLoadBalancerName shall derive a stable name from the frontend key annotation",
+			annotations:  map[string]string{"service.beta.kubernetes.io/azure-load-balancer-frontend-key": "payments-prod"},
+			expectedName: "apaymentsprod",
+		},
+		{
+			desc:         "GetLoadBalancerName shall reduce the frontend key to lower-case alphanumerics",
+			annotations:  map[string]string{"service.beta.kubernetes.io/azure-load-balancer-frontend-key": "Payments_Prod.01"},
+			expectedName: "apaymentsprod01",
+		},
+		{
+			desc:         "GetLoadBalancerName shall cap the derived name at 32 characters",
+			annotations:  map[string]string{"service.beta.kubernetes.io/azure-load-balancer-frontend-key": strings.Repeat("x", 40)},
+			expectedName: "a" + strings.Repeat("x", 31),
+		},
+		{
+			desc:         "GetLoadBalancerName shall fall back to the default name for an empty key",
+			annotations:  map[string]string{"service.beta.kubernetes.io/azure-load-balancer-frontend-key": "!!!"},
+			expectedName: "atest1",
+		},
+	}
+	for i, test := range testCases {
+		service := getTestService("test1", v1.ProtocolTCP, test.annotations, false, 80)
+		name := az.GetLoadBalancerName(context.TODO(), testClusterName, &service)
+		assert.Equal(t, test.expectedName, name, "TestCase[%d]: %s", i, test.desc)
+	}
+}
+
+func TestGetLoadBalancerDistributionMode(t *testing.T) {
+	testCases := []struct {
+		desc                 string
+		sessionAffinity      v1.ServiceAffinity
+		annotations          map[string]string
+		expectedDistribution network.LoadDistribution
+		expectedErr          bool
+	}{
+		{
+			desc:                 "getLoadBalancerDistributionMode shall return Default without session affinity",
+			sessionAffinity:      v1.ServiceAffinityNone,
+			expectedDistribution: network.LoadDistributionDefault,
+		},
+		{
+			desc:                 "getLoadBalancerDistributionMode shall ignore the annotation without session affinity",
+			sessionAffinity:      v1.ServiceAffinityNone,
+			annotations:          map[string]string{"service.beta.kubernetes.io/azure-load-balancer-distribution-mode": "sourceIPProtocol"},
+			expectedDistribution: network.LoadDistributionDefault,
+		},
+		{
+			desc:                 "getLoadBalancerDistributionMode shall return SourceIP for ClientIP affinity",
+			sessionAffinity:      v1.ServiceAffinityClientIP,
+			expectedDistribution: network.LoadDistributionSourceIP,
+		},
+		{
+			desc:                 "getLoadBalancerDistributionMode shall honor the distribution mode annotation",
+			sessionAffinity:      v1.ServiceAffinityClientIP,
+			annotations:          map[string]string{"service.beta.kubernetes.io/azure-load-balancer-distribution-mode": "sourceIPProtocol"},
+			expectedDistribution: network.LoadDistributionSourceIPProtocol,
+		},
+		{
+			desc:            "getLoadBalancerDistributionMode shall report error for an invalid distribution mode",
+			sessionAffinity: v1.ServiceAffinityClientIP,
+			annotations:     map[string]string{"service.beta.kubernetes.io/azure-load-balancer-distribution-mode": "roundRobin"},
+			expectedErr:     true,
+		},
+	}
+	for i, test := range testCases {
+		service := getTestService("test1", v1.ProtocolTCP, test.annotations, false, 80)
+		service.Spec.SessionAffinity = test.sessionAffinity
+		loadDistribution, err := getLoadBalancerDistributionMode(&service)
+		if test.expectedErr {
+			assert.Error(t, err, "TestCase[%d]: %s", i, test.desc)
+			continue
+		}
+		assert.NoError(t, err, "TestCase[%d]: %s", i, test.desc)
+		assert.Equal(t, test.expectedDistribution, loadDistribution, "TestCase[%d]: %s", i, test.desc)
+	}
+}
+
 func TestReconcileLoadBalancerRule(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -1182,6 +1314,155 @@ func TestReconcileLoadBalancerRule(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc:            "reconcileLoadBalancerRule shall return a single HA-ports rule for SCTP ports (slb)",
+			service:         getTestService("test1", v1.ProtocolSCTP, nil, false, 80, 81),
+			loadBalancerSku: "standard",
+			wantLb:          true,
+			expectedRules: []network.LoadBalancingRule{
+				{
+					Name: to.StringPtr("atest1-SCTP-80"),
+					LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
+						Protocol: network.TransportProtocolAll,
+						FrontendIPConfiguration: &network.SubResource{
+							ID: to.StringPtr("frontendIPConfigID"),
+						},
+						BackendAddressPool: &network.SubResource{
+							ID: to.StringPtr("backendPoolID"),
+						},
+						LoadDistribution:    "Default",
+						FrontendPort:        to.Int32Ptr(0),
+						BackendPort:         to.Int32Ptr(0),
+						EnableFloatingIP:    to.BoolPtr(true),
+						DisableOutboundSnat: to.BoolPtr(false),
+						EnableTCPReset:      to.BoolPtr(true),
+					},
+				},
+			},
+		},
+		{
+			desc:        "reconcileLoadBalancerRule shall report error for SCTP ports on the basic SKU",
+			service:     getTestService("test1", v1.ProtocolSCTP, nil, false, 80),
+			wantLb:      true,
+			expectedErr: fmt.Errorf("service default/test1 requests SCTP ports, which require the standard load balancer SKU"),
+		},
+		{
+			desc: "reconcileLoadBalancerRule shall return a single HA-ports rule when the annotation is set (internal slb)",
+			service: getTestService("test1", v1.ProtocolTCP, map[string]string{
+				"service.beta.kubernetes.io/azure-load-balancer-internal":                       "true",
+				"service.beta.kubernetes.io/azure-load-balancer-enable-high-availability-ports": "true",
+			}, false, 80, 443),
+			loadBalancerSku: "standard",
+			wantLb:          true,
+			expectedProbes: []network.Probe{
+				{
+					Name: to.StringPtr("atest1-TCP-80"),
+					ProbePropertiesFormat: &network.ProbePropertiesFormat{
+						Protocol:          network.ProbeProtocol("Tcp"),
+						Port:              to.Int32Ptr(10080),
+						IntervalInSeconds: to.Int32Ptr(5),
+						NumberOfProbes:    to.Int32Ptr(2),
+					},
+				},
+			},
+			expectedRules: []network.LoadBalancingRule{
+				{
+					Name: to.StringPtr("atest1-TCP-80"),
+					LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
+						Protocol: network.TransportProtocolAll,
+						FrontendIPConfiguration: &network.SubResource{
+							ID: to.StringPtr("frontendIPConfigID"),
+						},
+						BackendAddressPool: &network.SubResource{
+							ID: to.StringPtr("backendPoolID"),
+						},
+						LoadDistribution:     "Default",
+						FrontendPort:         to.Int32Ptr(0),
+						BackendPort:          to.Int32Ptr(0),
+						EnableFloatingIP:     to.BoolPtr(true),
+						DisableOutboundSnat:  to.BoolPtr(false),
+						IdleTimeoutInMinutes: to.Int32Ptr(0),
+						EnableTCPReset:       to.BoolPtr(true),
+						Probe: &network.SubResource{
+							ID: to.StringPtr("/subscriptions/subscription/resourceGroups/rg/providers/" +
+								"Microsoft.Network/loadBalancers/lbname/probes/atest1-TCP-80"),
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "reconcileLoadBalancerRule shall honor the per-port idle timeout and tcp reset annotations",
+			service: getTestService("test1", v1.ProtocolTCP, map[string]string{
+				"service.beta.kubernetes.io/azure-load-balancer-tcp-idle-timeout-80": "10",
+				"service.beta.kubernetes.io/azure-load-balancer-enable-tcp-reset-80": "false",
+			}, false, 80),
+			loadBalancerSku: "standard",
+			wantLb:          true,
+			expectedProbes: []network.Probe{
+				{
+					Name: to.StringPtr("atest1-TCP-80"),
+					ProbePropertiesFormat: &network.ProbePropertiesFormat{
+						Protocol:          network.ProbeProtocol("Tcp"),
+						Port:              to.Int32Ptr(10080),
+						IntervalInSeconds: to.Int32Ptr(5),
+						NumberOfProbes:    to.Int32Ptr(2),
+					},
+				},
+			},
+			expectedRules: []network.LoadBalancingRule{
+				{
+					Name: to.StringPtr("atest1-TCP-80"),
+					LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
+						Protocol: network.TransportProtocol("Tcp"),
+						FrontendIPConfiguration: &network.SubResource{
+							ID: to.StringPtr("frontendIPConfigID"),
+						},
+						BackendAddressPool: &network.SubResource{
+							ID: to.StringPtr("backendPoolID"),
+						},
+						LoadDistribution:     "Default",
+						FrontendPort:         to.Int32Ptr(80),
+						BackendPort:          to.Int32Ptr(80),
+						EnableFloatingIP:     to.BoolPtr(true),
+						DisableOutboundSnat:  to.BoolPtr(false),
+						IdleTimeoutInMinutes: to.Int32Ptr(10),
+						Probe: &network.SubResource{
+							ID: to.StringPtr("/subscriptions/subscription/resourceGroups/rg/providers/" +
+								"Microsoft.Network/loadBalancers/lbname/probes/atest1-TCP-80"),
+						},
+						EnableTCPReset: to.BoolPtr(false),
+					},
+				},
+			},
+		},
+		{
+			desc: "reconcileLoadBalancerRule shall report error for an invalid per-port idle timeout",
+			service: getTestService("test1", v1.ProtocolTCP, map[string]string{
+				"service.beta.kubernetes.io/azure-load-balancer-tcp-idle-timeout-80": "100",
+			}, false, 80),
+			loadBalancerSku: "standard",
+			wantLb:          true,
+			expectedErr:     fmt.Errorf("service.beta.kubernetes.io/azure-load-balancer-tcp-idle-timeout-80: idle timeout value must be a whole number representing minutes between 4 and 30"),
+		},
+		{
+			desc: "reconcileLoadBalancerRule shall report error for HA ports on a public load balancer",
+			service: getTestService("test1", v1.ProtocolTCP, map[string]string{
+				"service.beta.kubernetes.io/azure-load-balancer-enable-high-availability-ports": "true",
+			}, false, 80),
+			loadBalancerSku: "standard",
+			wantLb:          true,
+			expectedErr:     fmt.Errorf("service default/test1 requests service.beta.kubernetes.io/azure-load-balancer-enable-high-availability-ports, which is only supported on internal load balancers"),
+		},
+		{
+			desc: "reconcileLoadBalancerRule shall report error for HA ports on the basic SKU",
+			service: getTestService("test1", v1.ProtocolTCP, map[string]string{
+				"service.beta.kubernetes.io/azure-load-balancer-internal":                       "true",
+				"service.beta.kubernetes.io/azure-load-balancer-enable-high-availability-ports": "true",
+			}, false, 80),
+			wantLb:      true,
+			expectedErr: fmt.Errorf("service default/test1 requests service.beta.kubernetes.io/azure-load-balancer-enable-high-availability-ports, which requires the standard load balancer SKU"),
+		},
 	}
 	for i, test := range testCases {
 		az := GetTestCloud(ctrl)
@@ -1636,6 +1917,9 @@ func TestReconcileLoadBalancer(t *testing.T) {
 
 		mockLBsClient := mockloadbalancerclient.NewMockInterface(ctrl)
 		mockLBsClient.EXPECT().List(gomock.Any(), az.getLoadBalancerResourceGroup()).Return([]network.LoadBalancer{test.existingLB}, nil)
+		if !strings.EqualFold(az.getLoadBalancerResourceGroup(), az.VnetResourceGroup) {
+			mockLBsClient.EXPECT().List(gomock.Any(), az.VnetResourceGroup).Return(nil, nil).AnyTimes()
+		}
 		mockLBsClient.EXPECT().Get(gomock.Any(), az.getLoadBalancerResourceGroup(), *test.existingLB.Name, gomock.Any()).Return(test.existingLB, nil).AnyTimes()
 		mockLBsClient.EXPECT().CreateOrUpdate(gomock.Any(), az.getLoadBalancerResourceGroup(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 		az.LoadBalancerClient = mockLBsClient
@@ -1791,6 +2075,11 @@ func TestReconcileSecurityGroup(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
+	// Pin the generation timestamp in the rule descriptions.
+	securityRuleTimeNow = func() time.Time { return time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC) }
+	defer func() { securityRuleTimeNow = time.Now }()
+	testDescription := to.StringPtr("k8s-azure-service uid=test1 service=default/test1 created=2020-01-01T00:00:00Z")
+
 	testCases := []struct {
 		desc          string
 		service       v1.Service
@@ -1857,6 +2146,7 @@ func TestReconcileSecurityGroup(t *testing.T) {
 						{
 							Name: to.StringPtr("atest1-TCP-80-Internet"),
 							SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+								Description:              testDescription,
 								Protocol:                 network.SecurityRuleProtocol("Tcp"),
 								SourcePortRange:          to.StringPtr("*"),
 								DestinationPortRange:     to.StringPtr("80"),
@@ -1885,12 +2175,13 @@ func TestReconcileSecurityGroup(t *testing.T) {
 				SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
 					SecurityRules: &[]network.SecurityRule{
 						{
-							Name: to.StringPtr("atest1-TCP-80-Internet"),
+							Name: to.StringPtr("atest1-TCP-80-.._0"),
 							SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+								Description:              testDescription,
 								Protocol:                 network.SecurityRuleProtocol("Tcp"),
 								SourcePortRange:          to.StringPtr("*"),
 								DestinationPortRange:     to.StringPtr("80"),
-								SourceAddressPrefix:      to.StringPtr("Internet"),
+								SourceAddressPrefix:      to.StringPtr("::/0"),
 								DestinationAddressPrefix: to.StringPtr("fd00::eef0"),
 								Access:                   network.SecurityRuleAccess("Allow"),
 								Priority:                 to.Int32Ptr(500),
@@ -1929,6 +2220,7 @@ func TestReconcileSecurityGroup(t *testing.T) {
 						{
 							Name: to.StringPtr("atest1-TCP-80-tag"),
 							SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+								Description:              testDescription,
 								Protocol:                 network.SecurityRuleProtocol("Tcp"),
 								SourcePortRange:          to.StringPtr("*"),
 								DestinationPortRange:     to.StringPtr("80"),
@@ -1973,546 +2265,1938 @@ func TestReconcileSecurityGroup(t *testing.T) {
 				},
 			},
 		},
-	}
-
-	for i, test := range testCases {
-		az := GetTestCloud(ctrl)
-		mockSGsClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
-		mockSGsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
-		if len(test.existingSgs) == 0 {
-			mockSGsClient.EXPECT().Get(gomock.Any(), "rg", gomock.Any(), gomock.Any()).Return(network.SecurityGroup{}, &retry.Error{HTTPStatusCode: http.StatusNotFound}).AnyTimes()
-		}
-		for name, sg := range test.existingSgs {
-			mockSGsClient.EXPECT().Get(gomock.Any(), "rg", name, gomock.Any()).Return(sg, nil).AnyTimes()
-			err := az.SecurityGroupsClient.CreateOrUpdate(context.TODO(), "rg", name, sg, "")
-			if err != nil {
-				t.Fatalf("TestCase[%d] meets unexpected error: %v", i, err)
-			}
-		}
-		sg, err := az.reconcileSecurityGroup("testCluster", &test.service, test.lbIP, test.wantLb)
-		assert.Equal(t, test.expectedSg, sg, "TestCase[%d]: %s", i, test.desc)
-		assert.Equal(t, test.expectedError, err != nil, "TestCase[%d]: %s", i, test.desc)
-	}
-}
-
-func TestSafeDeletePublicIP(t *testing.T) {
-	ctrl := gomock.NewController(t)
-	defer ctrl.Finish()
-
-	testCases := []struct {
-		desc          string
-		pip           *network.PublicIPAddress
-		lb            *network.LoadBalancer
-		expectedError bool
-	}{
 		{
-			desc: "safeDeletePublicIP shall delete corresponding ip configurations and lb rules",
-			pip: &network.PublicIPAddress{
-				Name: to.StringPtr("pip1"),
-				PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
-					IPConfiguration: &network.IPConfiguration{
-						ID: to.StringPtr("id1"),
-					},
-				},
-			},
-			lb: &network.LoadBalancer{
-				Name: to.StringPtr("lb1"),
-				LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
-					FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+			desc:    "reconcileSecurityGroup shall create deny rules ahead of the allow rules",
+			service: getTestService("test1", v1.ProtocolTCP, map[string]string{ServiceAnnotationDenySourceRanges: "10.0.0.0/8"}, false, 80),
+			existingSgs: map[string]network.SecurityGroup{"nsg": {
+				Name:                          to.StringPtr("nsg"),
+				SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{},
+			}},
+			lbIP:   to.StringPtr("1.1.1.1"),
+			wantLb: true,
+			expectedSg: &network.SecurityGroup{
+				Name: to.StringPtr("nsg"),
+				SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+					SecurityRules: &[]network.SecurityRule{
 						{
-							ID: to.StringPtr("id1"),
-							FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
-								LoadBalancingRules: &[]network.SubResource{{ID: to.StringPtr("rules1")}},
+							Name: to.StringPtr("atest1-TCP-80-10.0.0.0_8-deny"),
+							SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+								Description:              testDescription,
+								Protocol:                 network.SecurityRuleProtocol("Tcp"),
+								SourcePortRange:          to.StringPtr("*"),
+								DestinationPortRange:     to.StringPtr("80"),
+								SourceAddressPrefix:      to.StringPtr("10.0.0.0/8"),
+								DestinationAddressPrefix: to.StringPtr("1.1.1.1"),
+								Access:                   network.SecurityRuleAccess("Deny"),
+								Priority:                 to.Int32Ptr(500),
+								Direction:                network.SecurityRuleDirection("Inbound"),
+							},
+						},
+						{
+							Name: to.StringPtr("atest1-TCP-80-Internet"),
+							SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+								Description:              testDescription,
+								Protocol:                 network.SecurityRuleProtocol("Tcp"),
+								SourcePortRange:          to.StringPtr("*"),
+								DestinationPortRange:     to.StringPtr("80"),
+								SourceAddressPrefix:      to.StringPtr("Internet"),
+								DestinationAddressPrefix: to.StringPtr("1.1.1.1"),
+								Access:                   network.SecurityRuleAccess("Allow"),
+								Priority:                 to.Int32Ptr(501),
+								Direction:                network.SecurityRuleDirection("Inbound"),
 							},
 						},
 					},
-					LoadBalancingRules: &[]network.LoadBalancingRule{{ID: to.StringPtr("rules1")}},
 				},
 			},
 		},
-	}
-
-	for i, test := range testCases {
-		az := GetTestCloud(ctrl)
-		mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
-		mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "pip1", gomock.Any()).Return(nil).AnyTimes()
-		mockPIPsClient.EXPECT().Delete(gomock.Any(), "rg", "pip1").Return(nil).AnyTimes()
-		err := az.PublicIPAddressesClient.CreateOrUpdate(context.TODO(), "rg", "pip1", network.PublicIPAddress{
-			Name: to.StringPtr("pip1"),
-			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
-				IPConfiguration: &network.IPConfiguration{
-					ID: to.StringPtr("id1"),
-				},
-			},
-		})
-		if err != nil {
-			t.Fatalf("TestCase[%d] meets unexpected error: %v", i, err)
-		}
-		service := getTestService("test1", v1.ProtocolTCP, nil, false, 80)
-		mockLBsClient := mockloadbalancerclient.NewMockInterface(ctrl)
-		mockLBsClient.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
-		az.LoadBalancerClient = mockLBsClient
-		rerr := az.safeDeletePublicIP(&service, "rg", test.pip, test.lb)
-		assert.Equal(t, 0, len(*test.lb.FrontendIPConfigurations), "TestCase[%d]: %s", i, test.desc)
-		assert.Equal(t, 0, len(*test.lb.LoadBalancingRules), "TestCase[%d]: %s", i, test.desc)
-		assert.Equal(t, test.expectedError, rerr != nil, "TestCase[%d]: %s", i, test.desc)
-	}
-}
-
-func TestReconcilePublicIP(t *testing.T) {
-	ctrl := gomock.NewController(t)
-	defer ctrl.Finish()
-
-	testCases := []struct {
-		desc          string
-		wantLb        bool
-		annotations   map[string]string
-		existingPIPs  []network.PublicIPAddress
-		expectedID    string
-		expectedPIP   *network.PublicIPAddress
-		expectedError bool
-	}{
-		{
-			desc:   "reconcilePublicIP shall return nil if there's no pip in service",
-			wantLb: false,
-		},
 		{
-			desc:   "reconcilePublicIP shall return nil if no pip is owned by service",
-			wantLb: false,
-			existingPIPs: []network.PublicIPAddress{
-				{
-					Name: to.StringPtr("pip1"),
+			desc:    "reconcileSecurityGroup shall evict deny rules once the annotation is removed",
+			service: getTestService("test1", v1.ProtocolTCP, nil, false, 80),
+			existingSgs: map[string]network.SecurityGroup{"nsg": {
+				Name: to.StringPtr("nsg"),
+				SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+					SecurityRules: &[]network.SecurityRule{
+						{
+							Name: to.StringPtr("atest1-TCP-80-10.0.0.0_8-deny"),
+							SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+								Description:              testDescription,
+								Protocol:                 network.SecurityRuleProtocol("Tcp"),
+								SourcePortRange:          to.StringPtr("*"),
+								DestinationPortRange:     to.StringPtr("80"),
+								SourceAddressPrefix:      to.StringPtr("10.0.0.0/8"),
+								DestinationAddressPrefix: to.StringPtr("1.1.1.1"),
+								Access:                   network.SecurityRuleAccess("Deny"),
+								Priority:                 to.Int32Ptr(500),
+								Direction:                network.SecurityRuleDirection("Inbound"),
+							},
+						},
+						{
+							Name: to.StringPtr("atest1-TCP-80-Internet"),
+							SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+								Description:              testDescription,
+								Protocol:                 network.SecurityRuleProtocol("Tcp"),
+								SourcePortRange:          to.StringPtr("*"),
+								DestinationPortRange:     to.StringPtr("80"),
+								SourceAddressPrefix:      to.StringPtr("Internet"),
+								DestinationAddressPrefix: to.StringPtr("1.1.1.1"),
+								Access:                   network.SecurityRuleAccess("Allow"),
+								Priority:                 to.Int32Ptr(501),
+								Direction:                network.SecurityRuleDirection("Inbound"),
+							},
+						},
+					},
+				},
+			}},
+			lbIP:   to.StringPtr("1.1.1.1"),
+			wantLb: true,
+			expectedSg: &network.SecurityGroup{
+				Name: to.StringPtr("nsg"),
+				SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+					SecurityRules: &[]network.SecurityRule{
+						{
+							Name: to.StringPtr("atest1-TCP-80-Internet"),
+							SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+								Description:              testDescription,
+								Protocol:                 network.SecurityRuleProtocol("Tcp"),
+								SourcePortRange:          to.StringPtr("*"),
+								DestinationPortRange:     to.StringPtr("80"),
+								SourceAddressPrefix:      to.StringPtr("Internet"),
+								DestinationAddressPrefix: to.StringPtr("1.1.1.1"),
+								Access:                   network.SecurityRuleAccess("Allow"),
+								Priority:                 to.Int32Ptr(501),
+								Direction:                network.SecurityRuleDirection("Inbound"),
+							},
+						},
+					},
 				},
 			},
 		},
 		{
-			desc:   "reconcilePublicIP shall delete unwanted pips and create a new one",
+			desc:    "reconcileSecurityGroup shall allocate rule priorities from the annotated band",
+			service: getTestService("test1", v1.ProtocolTCP, map[string]string{ServiceAnnotationSecurityRulePriority: "2000"}, false, 80),
+			existingSgs: map[string]network.SecurityGroup{"nsg": {
+				Name:                          to.StringPtr("nsg"),
+				SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{},
+			}},
+			lbIP:   to.StringPtr("1.1.1.1"),
 			wantLb: true,
-			existingPIPs: []network.PublicIPAddress{
-				{
-					Name: to.StringPtr("pip1"),
-					Tags: map[string]*string{"service": to.StringPtr("default/test1")},
+			expectedSg: &network.SecurityGroup{
+				Name: to.StringPtr("nsg"),
+				SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+					SecurityRules: &[]network.SecurityRule{
+						{
+							Name: to.StringPtr("atest1-TCP-80-Internet"),
+							SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+								Description:              testDescription,
+								Protocol:                 network.SecurityRuleProtocol("Tcp"),
+								SourcePortRange:          to.StringPtr("*"),
+								DestinationPortRange:     to.StringPtr("80"),
+								SourceAddressPrefix:      to.StringPtr("Internet"),
+								DestinationAddressPrefix: to.StringPtr("1.1.1.1"),
+								Access:                   network.SecurityRuleAccess("Allow"),
+								Priority:                 to.Int32Ptr(2000),
+								Direction:                network.SecurityRuleDirection("Inbound"),
+							},
+						},
+					},
 				},
 			},
-			expectedID: "/subscriptions/subscription/resourceGroups/rg/providers/" +
-				"Microsoft.Network/publicIPAddresses/testCluster-atest1",
 		},
 		{
-			desc:        "reconcilePublicIP shall report error if the given PIP name doesn't exist in the resource group",
-			wantLb:      true,
-			annotations: map[string]string{ServiceAnnotationPIPName: "testPIP"},
-			existingPIPs: []network.PublicIPAddress{
-				{
-					Name: to.StringPtr("pip1"),
-					Tags: map[string]*string{"service": to.StringPtr("default/test1")},
-				},
-				{
-					Name: to.StringPtr("pip2"),
-					Tags: map[string]*string{"service": to.StringPtr("default/test1")},
-				},
-			},
+			desc:          "reconcileSecurityGroup shall report error for a priority outside the allowed range",
+			service:       getTestService("test1", v1.ProtocolTCP, map[string]string{ServiceAnnotationSecurityRulePriority: "100"}, false, 80),
+			existingSgs:   map[string]network.SecurityGroup{"nsg": {}},
+			lbIP:          to.StringPtr("1.1.1.1"),
+			wantLb:        true,
 			expectedError: true,
 		},
 		{
-			desc:        "reconcilePublicIP shall delete unwanted PIP when given the name of desired PIP",
-			wantLb:      true,
-			annotations: map[string]string{ServiceAnnotationPIPName: "testPIP"},
-			existingPIPs: []network.PublicIPAddress{
-				{
-					Name: to.StringPtr("pip1"),
-					Tags: map[string]*string{"service": to.StringPtr("default/test1")},
-				},
-				{
-					Name: to.StringPtr("pip2"),
-					Tags: map[string]*string{"service": to.StringPtr("default/test1")},
-				},
-				{
-					Name: to.StringPtr("testPIP"),
-					Tags: map[string]*string{"service": to.StringPtr("default/test1")},
+			desc:          "reconcileSecurityGroup shall report error for an invalid deny source range",
+			service:       getTestService("test1", v1.ProtocolTCP, map[string]string{ServiceAnnotationDenySourceRanges: "not-a-cidr"}, false, 80),
+			existingSgs:   map[string]network.SecurityGroup{"nsg": {}},
+			lbIP:          to.StringPtr("1.1.1.1"),
+			wantLb:        true,
+			expectedError: true,
+		},
+		{
+			desc:    "reconcileSecurityGroup shall restrict the source port range of generated rules",
+			service: getTestService("test1", v1.ProtocolTCP, map[string]string{ServiceAnnotationSecurityRuleSourcePortRange: "1024-65535"}, false, 80),
+			existingSgs: map[string]network.SecurityGroup{"nsg": {
+				Name:                          to.StringPtr("nsg"),
+				SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{},
+			}},
+			lbIP:   to.StringPtr("1.1.1.1"),
+			wantLb: true,
+			expectedSg: &network.SecurityGroup{
+				Name: to.StringPtr("nsg"),
+				SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+					SecurityRules: &[]network.SecurityRule{
+						{
+							Name: to.StringPtr("atest1-TCP-80-Internet"),
+							SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+								Description:              testDescription,
+								Protocol:                 network.SecurityRuleProtocol("Tcp"),
+								SourcePortRange:          to.StringPtr("1024-65535"),
+								DestinationPortRange:     to.StringPtr("80"),
+								SourceAddressPrefix:      to.StringPtr("Internet"),
+								DestinationAddressPrefix: to.StringPtr("1.1.1.1"),
+								Access:                   network.SecurityRuleAccess("Allow"),
+								Priority:                 to.Int32Ptr(500),
+								Direction:                network.SecurityRuleDirection("Inbound"),
+							},
+						},
+					},
 				},
 			},
-			expectedPIP: &network.PublicIPAddress{
-				ID:   to.StringPtr("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/testPIP"),
-				Name: to.StringPtr("testPIP"),
-				Tags: map[string]*string{"service": to.StringPtr("default/test1")},
-			},
 		},
 		{
-			desc:        "reconcilePublicIP shall find the PIP by given name and shall not delete the PIP which is not owned by service",
-			wantLb:      true,
-			annotations: map[string]string{ServiceAnnotationPIPName: "testPIP"},
-			existingPIPs: []network.PublicIPAddress{
-				{
-					Name: to.StringPtr("pip1"),
-				},
-				{
-					Name: to.StringPtr("pip2"),
-					Tags: map[string]*string{"service": to.StringPtr("default/test1")},
-				},
-				{
-					Name: to.StringPtr("testPIP"),
+			desc:    "reconcileSecurityGroup shall pair inbound allow rules with outbound rules",
+			service: getTestService("test1", v1.ProtocolTCP, map[string]string{ServiceAnnotationSecurityRulePairedOutbound: "true"}, false, 80),
+			existingSgs: map[string]network.SecurityGroup{"nsg": {
+				Name:                          to.StringPtr("nsg"),
+				SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{},
+			}},
+			lbIP:   to.StringPtr("1.1.1.1"),
+			wantLb: true,
+			expectedSg: &network.SecurityGroup{
+				Name: to.StringPtr("nsg"),
+				SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+					SecurityRules: &[]network.SecurityRule{
+						{
+							Name: to.StringPtr("atest1-TCP-80-Internet"),
+							SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+								Description:              testDescription,
+								Protocol:                 network.SecurityRuleProtocol("Tcp"),
+								SourcePortRange:          to.StringPtr("*"),
+								DestinationPortRange:     to.StringPtr("80"),
+								SourceAddressPrefix:      to.StringPtr("Internet"),
+								DestinationAddressPrefix: to.StringPtr("1.1.1.1"),
+								Access:                   network.SecurityRuleAccess("Allow"),
+								Priority:                 to.Int32Ptr(500),
+								Direction:                network.SecurityRuleDirection("Inbound"),
+							},
+						},
+						{
+							Name: to.StringPtr("atest1-TCP-80-Internet-out"),
+							SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+								Description:              testDescription,
+								Protocol:                 network.SecurityRuleProtocol("Tcp"),
+								SourcePortRange:          to.StringPtr("80"),
+								DestinationPortRange:     to.StringPtr("*"),
+								SourceAddressPrefix:      to.StringPtr("1.1.1.1"),
+								DestinationAddressPrefix: to.StringPtr("Internet"),
+								Access:                   network.SecurityRuleAccess("Allow"),
+								Priority:                 to.Int32Ptr(501),
+								Direction:                network.SecurityRuleDirection("Outbound"),
+							},
+						},
+					},
 				},
 			},
-			expectedPIP: &network.PublicIPAddress{
-				ID:   to.StringPtr("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/testPIP"),
-				Name: to.StringPtr("testPIP"),
-			},
+		},
+		{
+			desc:          "reconcileSecurityGroup shall report error for an invalid source port range",
+			service:       getTestService("test1", v1.ProtocolTCP, map[string]string{ServiceAnnotationSecurityRuleSourcePortRange: "70000"}, false, 80),
+			existingSgs:   map[string]network.SecurityGroup{"nsg": {}},
+			lbIP:          to.StringPtr("1.1.1.1"),
+			wantLb:        true,
+			expectedError: true,
 		},
 	}
 
 	for i, test := range testCases {
 		az := GetTestCloud(ctrl)
-		mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
-		mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
-		mockPIPsClient.EXPECT().List(gomock.Any(), "rg").Return(test.existingPIPs, nil).AnyTimes()
-		if i == 2 {
-			mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", "testCluster-atest1", gomock.Any()).Return(network.PublicIPAddress{}, &retry.Error{HTTPStatusCode: http.StatusNotFound}).Times(1)
-			mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", "testCluster-atest1", gomock.Any()).Return(network.PublicIPAddress{ID: to.StringPtr("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/testCluster-atest1")}, nil).Times(1)
+		mockSGsClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+		mockSGsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+		if len(test.existingSgs) == 0 {
+			mockSGsClient.EXPECT().Get(gomock.Any(), "rg", gomock.Any(), gomock.Any()).Return(network.SecurityGroup{}, &retry.Error{HTTPStatusCode: http.StatusNotFound}).AnyTimes()
 		}
-		service := getTestService("test1", v1.ProtocolTCP, nil, false, 80)
-		service.Annotations = test.annotations
-		for _, pip := range test.existingPIPs {
-			mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", *pip.Name, gomock.Any()).Return(pip, nil).AnyTimes()
-			mockPIPsClient.EXPECT().Delete(gomock.Any(), "rg", *pip.Name).Return(nil).AnyTimes()
-			err := az.PublicIPAddressesClient.CreateOrUpdate(context.TODO(), "rg", to.String(pip.Name), pip)
+		for name, sg := range test.existingSgs {
+			mockSGsClient.EXPECT().Get(gomock.Any(), "rg", name, gomock.Any()).Return(sg, nil).AnyTimes()
+			err := az.SecurityGroupsClient.CreateOrUpdate(context.TODO(), "rg", name, sg, "")
 			if err != nil {
 				t.Fatalf("TestCase[%d] meets unexpected error: %v", i, err)
 			}
 		}
-		pip, err := az.reconcilePublicIP("testCluster", &service, "", test.wantLb)
-		if test.expectedID != "" {
-			assert.Equal(t, test.expectedID, to.String(pip.ID), "TestCase[%d]: %s", i, test.desc)
-		} else if test.expectedPIP != nil && test.expectedPIP.Name != nil {
-			assert.Equal(t, *test.expectedPIP.Name, *pip.Name, "TestCase[%d]: %s", i, test.desc)
+		sg, err := az.reconcileSecurityGroup("testCluster", &test.service, test.lbIP, test.wantLb)
+		assert.Equal(t, test.expectedSg, sg, "TestCase[%d]: %s", i, test.desc)
+		assert.Equal(t, test.expectedError, err != nil, "TestCase[%d]: %s", i, test.desc)
+	}
+}
+
+func TestGetSecurityRuleSourcePortRange(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		annotation    string
+		expected      string
+		expectedError bool
+	}{
+		{
+			desc:     "getSecurityRuleSourcePortRange shall default to any source port",
+			expected: "*",
+		},
+		{
+			desc:       "getSecurityRuleSourcePortRange shall accept a single port",
+			annotation: "53",
+			expected:   "53",
+		},
+		{
+			desc:       "getSecurityRuleSourcePortRange shall accept a port range",
+			annotation: "1024-65535",
+			expected:   "1024-65535",
+		},
+		{
+			desc:          "getSecurityRuleSourcePortRange shall reject an inverted range",
+			annotation:    "65535-1024",
+			expectedError: true,
+		},
+		{
+			desc:          "getSecurityRuleSourcePortRange shall reject a non-numeric value",
+			annotation:    "ephemeral",
+			expectedError: true,
+		},
+		{
+			desc:          "getSecurityRuleSourcePortRange shall reject an out-of-range port",
+			annotation:    "0-1024",
+			expectedError: true,
+		},
+	}
+
+	for i, test := range testCases {
+		service := getTestService("test1", v1.ProtocolTCP, nil, false, 80)
+		if test.annotation != "" {
+			service.Annotations[ServiceAnnotationSecurityRuleSourcePortRange] = test.annotation
+		}
+		sourcePortRange, err := getSecurityRuleSourcePortRange(&service)
+		assert.Equal(t, test.expectedError, err != nil, "TestCase[%d]: %s", i, test.desc)
+		if !test.expectedError {
+			assert.Equal(t, test.expected, sourcePortRange, "TestCase[%d]: %s", i, test.desc)
+		}
+	}
+}
+
+func TestSafeDeletePublicIP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testCases := []struct {
+		desc          string
+		pip           *network.PublicIPAddress
+		lb            *network.LoadBalancer
+		expectedError bool
+	}{
+		{
+			desc: "safeDeletePublicIP shall delete corresponding ip configurations and lb rules",
+			pip: &network.PublicIPAddress{
+				Name: to.StringPtr("pip1"),
+				PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+					IPConfiguration: &network.IPConfiguration{
+						ID: to.StringPtr("id1"),
+					},
+				},
+			},
+			lb: &network.LoadBalancer{
+				Name: to.StringPtr("lb1"),
+				LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+					FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+						{
+							ID: to.StringPtr("id1"),
+							FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+								LoadBalancingRules: &[]network.SubResource{{ID: to.StringPtr("rules1")}},
+							},
+						},
+					},
+					LoadBalancingRules: &[]network.LoadBalancingRule{{ID: to.StringPtr("rules1")}},
+				},
+			},
+		},
+	}
+
+	for i, test := range testCases {
+		az := GetTestCloud(ctrl)
+		mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+		mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "pip1", gomock.Any()).Return(nil).AnyTimes()
+		mockPIPsClient.EXPECT().Delete(gomock.Any(), "rg", "pip1").Return(nil).AnyTimes()
+		err := az.PublicIPAddressesClient.CreateOrUpdate(context.TODO(), "rg", "pip1", network.PublicIPAddress{
+			Name: to.StringPtr("pip1"),
+			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+				IPConfiguration: &network.IPConfiguration{
+					ID: to.StringPtr("id1"),
+				},
+			},
+		})
+		if err != nil {
+			t.Fatalf("TestCase[%d] meets unexpected error: %v", i, err)
+		}
+		service := getTestService("test1", v1.ProtocolTCP, nil, false, 80)
+		mockLBsClient := mockloadbalancerclient.NewMockInterface(ctrl)
+		mockLBsClient.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+		az.LoadBalancerClient = mockLBsClient
+		rerr := az.safeDeletePublicIP(&service, "rg", test.pip, test.lb)
+		assert.Equal(t, 0, len(*test.lb.FrontendIPConfigurations), "TestCase[%d]: %s", i, test.desc)
+		assert.Equal(t, 0, len(*test.lb.LoadBalancingRules), "TestCase[%d]: %s", i, test.desc)
+		assert.Equal(t, test.expectedError, rerr != nil, "TestCase[%d]: %s", i, test.desc)
+	}
+}
+
+func TestSafeDeletePublicIPRecycle(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.PublicIPRecycleGracePeriodInSeconds = 300
+	service := getTestService("test1", v1.ProtocolTCP, nil, false, 80)
+	mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+
+	// A public IP without the released tag is tagged instead of being deleted.
+	// The tags-only update goes through the delayed tags updater.
+	var updatedTags map[string]*string
+	mockPIPsClient.EXPECT().UpdateTags(gomock.Any(), "rg", "pip1", gomock.Any()).DoAndReturn(
+		func(ctx context.Context, resourceGroupName string, publicIPAddressName string, tags map[string]*string) *retry.Error {
+			updatedTags = tags
+			return nil
+		}).Times(1)
+	releasedPIP := network.PublicIPAddress{Name: to.StringPtr("pip1")}
+	err := az.safeDeletePublicIP(&service, "rg", &releasedPIP, nil)
+	assert.NoError(t, err)
+	az.tagsUpdater.updateTags()
+	assert.Contains(t, updatedTags, releasedAtTagKey)
+	updatedPIP := network.PublicIPAddress{Name: to.StringPtr("pip1"), Tags: updatedTags}
+
+	// A released public IP within the grace period is kept.
+	err = az.safeDeletePublicIP(&service, "rg", &updatedPIP, nil)
+	assert.NoError(t, err)
+
+	// A released public IP is deleted once the grace period has expired.
+	expiredPIP := network.PublicIPAddress{
+		Name: to.StringPtr("pip1"),
+		Tags: map[string]*string{
+			releasedAtTagKey: to.StringPtr(time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)),
+		},
+	}
+	mockPIPsClient.EXPECT().Delete(gomock.Any(), "rg", "pip1").Return(nil).Times(1)
+	err = az.safeDeletePublicIP(&service, "rg", &expiredPIP, nil)
+	assert.NoError(t, err)
+}
+
+func TestPublicIPReleaseExpired(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.PublicIPRecycleGracePeriodInSeconds = 300
+
+	testCases := []struct {
+		desc     string
+		tags     map[string]*string
+		expected bool
+	}{
+		{
+			desc:     "public IP without released tag shall not be expired",
+			expected: false,
+		},
+		{
+			desc: "released public IP within grace period shall not be expired",
+			tags: map[string]*string{
+				releasedAtTagKey: to.StringPtr(time.Now().UTC().Format(time.RFC3339)),
+			},
+			expected: false,
+		},
+		{
+			desc: "released public IP beyond grace period shall be expired",
+			tags: map[string]*string{
+				releasedAtTagKey: to.StringPtr(time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)),
+			},
+			expected: true,
+		},
+		{
+			desc: "released public IP with unparsable timestamp shall be expired",
+			tags: map[string]*string{
+				releasedAtTagKey: to.StringPtr("not-a-timestamp"),
+			},
+			expected: true,
+		},
+	}
+
+	for i, test := range testCases {
+		pip := network.PublicIPAddress{Name: to.StringPtr("pip1"), Tags: test.tags}
+		assert.Equal(t, test.expected, az.publicIPReleaseExpired(&pip), "TestCase[%d]: %s", i, test.desc)
+	}
+}
+
+func TestReconcilePublicIP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testCases := []struct {
+		desc          string
+		wantLb        bool
+		annotations   map[string]string
+		existingPIPs  []network.PublicIPAddress
+		expectedID    string
+		expectedPIP   *network.PublicIPAddress
+		expectedError bool
+	}{
+		{
+			desc:   "reconcilePublicIP shall return nil if there's no pip in service",
+			wantLb: false,
+		},
+		{
+			desc:   "reconcilePublicIP shall return nil if no pip is owned by service",
+			wantLb: false,
+			existingPIPs: []network.PublicIPAddress{
+				{
+					Name: to.StringPtr("pip1"),
+				},
+			},
+		},
+		{
+			desc:   "reconcilePublicIP shall delete unwanted pips and create a new one",
+			wantLb: true,
+			existingPIPs: []network.PublicIPAddress{
+				{
+					Name: to.StringPtr("pip1"),
+					Tags: map[string]*string{"service": to.StringPtr("default/test1")},
+				},
+			},
+			expectedID: "/subscriptions/subscription/resourceGroups/rg/providers/" +
+				"Microsoft.Network/publicIPAddresses/testCluster-atest1",
+		},
+		{
+			desc:        "reconcilePublicIP shall report error if the given PIP name doesn't exist in the resource group",
+			wantLb:      true,
+			annotations: map[string]string{ServiceAnnotationPIPName: "testPIP"},
+			existingPIPs: []network.PublicIPAddress{
+				{
+					Name: to.StringPtr("pip1"),
+					Tags: map[string]*string{"service": to.StringPtr("default/test1")},
+				},
+				{
+					Name: to.StringPtr("pip2"),
+					Tags: map[string]*string{"service": to.StringPtr("default/test1")},
+				},
+			},
+			expectedError: true,
+		},
+		{
+			desc:        "reconcilePublicIP shall delete unwanted PIP when given the name of desired PIP",
+			wantLb:      true,
+			annotations: map[string]string{ServiceAnnotationPIPName: "testPIP"},
+			existingPIPs: []network.PublicIPAddress{
+				{
+					Name: to.StringPtr("pip1"),
+					Tags: map[string]*string{"service": to.StringPtr("default/test1")},
+				},
+				{
+					Name: to.StringPtr("pip2"),
+					Tags: map[string]*string{"service": to.StringPtr("default/test1")},
+				},
+				{
+					Name: to.StringPtr("testPIP"),
+					Tags: map[string]*string{"service": to.StringPtr("default/test1")},
+				},
+			},
+			expectedPIP: &network.PublicIPAddress{
+				ID:   to.StringPtr("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/testPIP"),
+				Name: to.StringPtr("testPIP"),
+				Tags: map[string]*string{"service": to.StringPtr("default/test1")},
+			},
+		},
+		{
+			desc:        "reconcilePublicIP shall find the PIP by given name and shall not delete the PIP which is not owned by service",
+			wantLb:      true,
+			annotations: map[string]string{ServiceAnnotationPIPName: "testPIP"},
+			existingPIPs: []network.PublicIPAddress{
+				{
+					Name: to.StringPtr("pip1"),
+				},
+				{
+					Name: to.StringPtr("pip2"),
+					Tags: map[string]*string{"service": to.StringPtr("default/test1")},
+				},
+				{
+					Name: to.StringPtr("testPIP"),
+				},
+			},
+			expectedPIP: &network.PublicIPAddress{
+				ID:   to.StringPtr("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/testPIP"),
+				Name: to.StringPtr("testPIP"),
+			},
+		},
+	}
+
+	for i, test := range testCases {
+		az := GetTestCloud(ctrl)
+		mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+		mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+		mockPIPsClient.EXPECT().List(gomock.Any(), "rg").Return(test.existingPIPs, nil).AnyTimes()
+		if i == 2 {
+			mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", "testCluster-atest1", gomock.Any()).Return(network.PublicIPAddress{}, &retry.Error{HTTPStatusCode: http.StatusNotFound}).Times(1)
+			mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", "testCluster-atest1", gomock.Any()).Return(network.PublicIPAddress{ID: to.StringPtr("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/testCluster-atest1")}, nil).Times(1)
+		}
+		service := getTestService("test1", v1.ProtocolTCP, nil, false, 80)
+		service.Annotations = test.annotations
+		for _, pip := range test.existingPIPs {
+			mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", *pip.Name, gomock.Any()).Return(pip, nil).AnyTimes()
+			mockPIPsClient.EXPECT().Delete(gomock.Any(), "rg", *pip.Name).Return(nil).AnyTimes()
+			err := az.PublicIPAddressesClient.CreateOrUpdate(context.TODO(), "rg", to.String(pip.Name), pip)
+			if err != nil {
+				t.Fatalf("TestCase[%d] meets unexpected error: %v", i, err)
+			}
+		}
+		pip, err := az.reconcilePublicIP("testCluster", &service, "", test.wantLb)
+		if test.expectedID != "" {
+			assert.Equal(t, test.expectedID, to.String(pip.ID), "TestCase[%d]: %s", i, test.desc)
+		} else if test.expectedPIP != nil && test.expectedPIP.Name != nil {
+			assert.Equal(t, *test.expectedPIP.Name, *pip.Name, "TestCase[%d]: %s", i, test.desc)
+		}
+		assert.Equal(t, test.expectedError, err != nil, "TestCase[%d]: %s", i, test.desc)
+	}
+}
+
+func TestEnsurePublicIPExists(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testCases := []struct {
+		desc                    string
+		existingPIPs            []network.PublicIPAddress
+		inputDNSLabel           string
+		foundDNSLabelAnnotation bool
+		expectedPIP             *network.PublicIPAddress
+		expectedID              string
+		isIPv6                  bool
+		expectedError           bool
+	}{
+		{
+			desc:         "ensurePublicIPExists shall return existed PIP if there is any",
+			existingPIPs: []network.PublicIPAddress{{Name: to.StringPtr("pip1")}},
+			expectedPIP: &network.PublicIPAddress{
+				Name: to.StringPtr("pip1"),
+				ID: to.StringPtr("/subscriptions/subscription/resourceGroups/rg" +
+					"/providers/Microsoft.Network/publicIPAddresses/pip1"),
+			},
+		},
+		{
+			desc: "ensurePublicIPExists shall create a new pip if there is no existed pip",
+			expectedID: "/subscriptions/subscription/resourceGroups/rg/providers/" +
+				"Microsoft.Network/publicIPAddresses/pip1",
+		},
+		{
+			desc:                    "ensurePublicIPExists shall update existed PIP's dns label",
+			inputDNSLabel:           "newdns",
+			foundDNSLabelAnnotation: true,
+			existingPIPs: []network.PublicIPAddress{{
+				Name: to.StringPtr("pip1"),
+				PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+					DNSSettings: &network.PublicIPAddressDNSSettings{
+						DomainNameLabel: to.StringPtr("previousdns"),
+					},
+				},
+			}},
+			expectedPIP: &network.PublicIPAddress{
+				Name: to.StringPtr("pip1"),
+				ID: to.StringPtr("/subscriptions/subscription/resourceGroups/rg" +
+					"/providers/Microsoft.Network/publicIPAddresses/pip1"),
+				PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+					DNSSettings: &network.PublicIPAddressDNSSettings{
+						DomainNameLabel: to.StringPtr("newdns"),
+					},
+					PublicIPAddressVersion: "IPv4",
+				},
+			},
+		},
+		{
+			desc:                    "ensurePublicIPExists shall delete DNS from PIP if DNS label is set empty",
+			foundDNSLabelAnnotation: true,
+			existingPIPs: []network.PublicIPAddress{{
+				Name: to.StringPtr("pip1"),
+				PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+					DNSSettings: &network.PublicIPAddressDNSSettings{
+						DomainNameLabel: to.StringPtr("previousdns"),
+					},
+				},
+			}},
+			expectedPIP: &network.PublicIPAddress{
+				Name: to.StringPtr("pip1"),
+				ID: to.StringPtr("/subscriptions/subscription/resourceGroups/rg" +
+					"/providers/Microsoft.Network/publicIPAddresses/pip1"),
+				PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+					DNSSettings:            nil,
+					PublicIPAddressVersion: "IPv4",
+				},
+			},
+		},
+		{
+			desc:                    "ensurePublicIPExists shall not delete DNS from PIP if DNS label annotation is not set",
+			foundDNSLabelAnnotation: false,
+			existingPIPs: []network.PublicIPAddress{{
+				Name: to.StringPtr("pip1"),
+				PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+					DNSSettings: &network.PublicIPAddressDNSSettings{
+						DomainNameLabel: to.StringPtr("previousdns"),
+					},
+				},
+			}},
+			expectedPIP: &network.PublicIPAddress{
+				Name: to.StringPtr("pip1"),
+				ID: to.StringPtr("/subscriptions/subscription/resourceGroups/rg" +
+					"/providers/Microsoft.Network/publicIPAddresses/pip1"),
+				PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+					DNSSettings: &network.PublicIPAddressDNSSettings{
+						DomainNameLabel: to.StringPtr("previousdns"),
+					},
+					PublicIPAddressVersion: "IPv4",
+				},
+			},
+		},
+		{
+			desc:                    "ensurePublicIPExists shall update existed PIP's dns label for IPv6",
+			inputDNSLabel:           "newdns",
+			foundDNSLabelAnnotation: true,
+			isIPv6:                  true,
+			existingPIPs: []network.PublicIPAddress{{
+				Name: to.StringPtr("pip1"),
+				PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+					DNSSettings: &network.PublicIPAddressDNSSettings{
+						DomainNameLabel: to.StringPtr("previousdns"),
+					},
+				},
+			}},
+			expectedPIP: &network.PublicIPAddress{
+				Name: to.StringPtr("pip1"),
+				ID: to.StringPtr("/subscriptions/subscription/resourceGroups/rg" +
+					"/providers/Microsoft.Network/publicIPAddresses/pip1"),
+				PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+					DNSSettings: &network.PublicIPAddressDNSSettings{
+						DomainNameLabel: to.StringPtr("newdns"),
+					},
+					PublicIPAllocationMethod: "Dynamic",
+					PublicIPAddressVersion:   "IPv6",
+				},
+			},
+		},
+	}
+
+	for i, test := range testCases {
+		az := GetTestCloud(ctrl)
+		service := getTestService("test1", v1.ProtocolTCP, nil, test.isIPv6, 80)
+		mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+		mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+		mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", "pip1", gomock.Any()).DoAndReturn(func(ctx context.Context, resourceGroupName string, publicIPAddressName string, expand string) (network.PublicIPAddress, *retry.Error) {
+			var basicPIP network.PublicIPAddress
+			if len(test.existingPIPs) == 0 {
+				basicPIP = network.PublicIPAddress{
+					Name: to.StringPtr("pip1"),
+				}
+			} else {
+				basicPIP = test.existingPIPs[0]
+			}
+
+			basicPIP.ID = to.StringPtr("/subscriptions/subscription/resourceGroups/rg" +
+				"/providers/Microsoft.Network/publicIPAddresses/pip1")
+
+			if basicPIP.PublicIPAddressPropertiesFormat == nil {
+				return basicPIP, nil
+			}
+
+			if test.foundDNSLabelAnnotation {
+				if test.inputDNSLabel != "" {
+					basicPIP.DNSSettings.DomainNameLabel = &test.inputDNSLabel
+				} else {
+					basicPIP.DNSSettings = nil
+				}
+			}
+
+			if test.isIPv6 {
+				basicPIP.PublicIPAddressPropertiesFormat.PublicIPAddressVersion = "IPv6"
+				basicPIP.PublicIPAllocationMethod = "Dynamic"
+			} else {
+				basicPIP.PublicIPAddressPropertiesFormat.PublicIPAddressVersion = "IPv4"
+			}
+
+			return basicPIP, nil
+		}).AnyTimes()
+
+		for _, pip := range test.existingPIPs {
+			err := az.PublicIPAddressesClient.CreateOrUpdate(context.TODO(), "rg", to.String(pip.Name), pip)
+			if err != nil {
+				t.Fatalf("TestCase[%d] meets unexpected error: %v", i, err)
+			}
+		}
+		pip, err := az.ensurePublicIPExists(&service, "pip1", test.inputDNSLabel, "", false, test.foundDNSLabelAnnotation)
+		if test.expectedID != "" {
+			assert.Equal(t, test.expectedID, to.String(pip.ID), "TestCase[%d]: %s", i, test.desc)
+		} else {
+			assert.Equal(t, test.expectedPIP, pip, "TestCase[%d]: %s", i, test.desc)
+		}
+		assert.Equal(t, test.expectedError, err != nil, "TestCase[%d]: %s", i, test.desc)
+	}
+}
+
+func TestEnsurePublicIPExistsWithPrefix(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = loadBalancerSkuStandard
+	prefixID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/prefix1"
+	service := getTestService("test1", v1.ProtocolTCP, map[string]string{
+		ServiceAnnotationPIPPrefixID: prefixID,
+	}, false, 80)
+
+	var createdPIP network.PublicIPAddress
+	mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", "pip1", gomock.Any()).Return(network.PublicIPAddress{}, &retry.Error{HTTPStatusCode: http.StatusNotFound}).Times(1)
+	mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "pip1", gomock.Any()).DoAndReturn(
+		func(ctx context.Context, resourceGroupName string, publicIPAddressName string, parameters network.PublicIPAddress) *retry.Error {
+			createdPIP = parameters
+			return nil
+		}).Times(1)
+	mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", "pip1", gomock.Any()).DoAndReturn(
+		func(ctx context.Context, resourceGroupName string, publicIPAddressName string, expand string) (network.PublicIPAddress, *retry.Error) {
+			return createdPIP, nil
+		}).Times(1)
+	mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", "pip1", gomock.Any()).Return(network.PublicIPAddress{}, &retry.Error{HTTPStatusCode: http.StatusNotFound}).Times(1)
+
+	// The created public IP shall reference the requested prefix.
+	_, err := az.ensurePublicIPExists(&service, "pip1", "", "", false, false)
+	assert.NoError(t, err)
+	assert.NotNil(t, createdPIP.PublicIPAddressPropertiesFormat.PublicIPPrefix)
+	assert.Equal(t, prefixID, to.String(createdPIP.PublicIPPrefix.ID))
+
+	// The annotation shall require the standard load balancer SKU.
+	az.LoadBalancerSku = loadBalancerSkuBasic
+	_, err = az.ensurePublicIPExists(&service, "pip1", "", "", false, false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "standard load balancer SKU")
+}
+
+func TestEnsurePublicIPExistsDNSLabelOwnership(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	service := getTestService("test1", v1.ProtocolTCP, nil, false, 80)
+	serviceName := getServiceName(&service)
+
+	// A label owned by another service shall be refused.
+	conflictingPIP := network.PublicIPAddress{
+		Name: to.StringPtr("pip1"),
+		Tags: map[string]*string{dnsLabelServiceTagKey: to.StringPtr("default/other")},
+		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+			DNSSettings: &network.PublicIPAddressDNSSettings{DomainNameLabel: to.StringPtr("label1")},
+		},
+	}
+	mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", "pip1", gomock.Any()).Return(conflictingPIP, nil).Times(1)
+	_, err := az.ensurePublicIPExists(&service, "pip1", "label2", "", false, true)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "default/other")
+
+	// Removing the annotation shall clear the label the service owns instead
+	// of leaving it orphaned.
+	ownedPIP := network.PublicIPAddress{
+		Name: to.StringPtr("pip1"),
+		Tags: map[string]*string{dnsLabelServiceTagKey: &serviceName},
+		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+			DNSSettings: &network.PublicIPAddressDNSSettings{DomainNameLabel: to.StringPtr("label1")},
+		},
+	}
+	var updatedPIP network.PublicIPAddress
+	mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", "pip1", gomock.Any()).Return(ownedPIP, nil).Times(2)
+	mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "pip1", gomock.Any()).DoAndReturn(
+		func(ctx context.Context, resourceGroupName string, publicIPAddressName string, parameters network.PublicIPAddress) *retry.Error {
+			updatedPIP = parameters
+			return nil
+		}).Times(1)
+	_, err = az.ensurePublicIPExists(&service, "pip1", "", "", false, false)
+	assert.NoError(t, err)
+	assert.Nil(t, updatedPIP.PublicIPAddressPropertiesFormat.DNSSettings)
+	assert.NotContains(t, updatedPIP.Tags, dnsLabelServiceTagKey)
+}
+
+func TestShouldUpdateLoadBalancer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testCases := []struct {
+		desc                   string
+		lbHasDeletionTimestamp bool
+		existsLb               bool
+		expectedOutput         bool
+	}{
+		{
+			desc:                   "should update a load balancer that does not have a deletion timestamp and exists in Azure",
+			lbHasDeletionTimestamp: false,
+			existsLb:               true,
+			expectedOutput:         true,
+		},
+		{
+			desc:                   "should not update a load balancer that is being deleted / already deleted in K8s",
+			lbHasDeletionTimestamp: true,
+			existsLb:               true,
+			expectedOutput:         false,
+		},
+		{
+			desc:                   "should not update a load balancer that does not exist in Azure",
+			lbHasDeletionTimestamp: false,
+			existsLb:               false,
+			expectedOutput:         false,
+		},
+		{
+			desc:                   "should not update a load balancer that has a deletion timestamp and does not exist in Azure",
+			lbHasDeletionTimestamp: true,
+			existsLb:               false,
+			expectedOutput:         false,
+		},
+	}
+
+	for i, test := range testCases {
+		az := GetTestCloud(ctrl)
+		service := getTestService("test1", v1.ProtocolTCP, nil, false, 80)
+		setMockPublicIPs(az, ctrl, 1)
+		mockLBsClient := mockloadbalancerclient.NewMockInterface(ctrl)
+		az.LoadBalancerClient = mockLBsClient
+		mockLBsClient.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+		if test.lbHasDeletionTimestamp {
+			service.ObjectMeta.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		}
+		if test.existsLb {
+			lb := network.LoadBalancer{
+				Name: to.StringPtr("lb1"),
+				LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+					FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+						{
+							Name: to.StringPtr("atest1"),
+							FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+								PublicIPAddress: &network.PublicIPAddress{ID: to.StringPtr("testCluster-aservice1")},
+							},
+						},
+					},
+				},
+			}
+			err := az.LoadBalancerClient.CreateOrUpdate(context.TODO(), "rg", *lb.Name, lb, "")
+			if err != nil {
+				t.Fatalf("TestCase[%d] meets unexpected error: %v", i, err)
+			}
+			mockLBsClient.EXPECT().List(gomock.Any(), "rg").Return([]network.LoadBalancer{lb}, nil)
+		} else {
+			mockLBsClient.EXPECT().List(gomock.Any(), "rg").Return(nil, nil)
+		}
+		shouldUpdateLoadBalancer := az.shouldUpdateLoadBalancer(testClusterName, &service)
+		assert.Equal(t, test.expectedOutput, shouldUpdateLoadBalancer, "TestCase[%d]: %s", i, test.desc)
+	}
+}
+
+func TestIsBackendPoolPreConfigured(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testCases := []struct {
+		desc                                      string
+		preConfiguredBackendPoolLoadBalancerTypes string
+		isInternalService                         bool
+		expectedOutput                            bool
+	}{
+		{
+			desc: "should return true when preConfiguredBackendPoolLoadBalancerTypes is both for any case",
+			preConfiguredBackendPoolLoadBalancerTypes: "all",
+			isInternalService:                         true,
+			expectedOutput:                            true,
+		},
+		{
+			desc: "should return true when preConfiguredBackendPoolLoadBalancerTypes is both for any case",
+			preConfiguredBackendPoolLoadBalancerTypes: "all",
+			isInternalService:                         false,
+			expectedOutput:                            true,
+		},
+		{
+			desc: "should return true when preConfiguredBackendPoolLoadBalancerTypes is external when creating external lb",
+			preConfiguredBackendPoolLoadBalancerTypes: "external",
+			isInternalService:                         false,
+			expectedOutput:                            true,
+		},
+		{
+			desc: "should return false when preConfiguredBackendPoolLoadBalancerTypes is external when creating internal lb",
+			preConfiguredBackendPoolLoadBalancerTypes: "external",
+			isInternalService:                         true,
+			expectedOutput:                            false,
+		},
+		{
+			desc: "should return false when preConfiguredBackendPoolLoadBalancerTypes is internal when creating external lb",
+			preConfiguredBackendPoolLoadBalancerTypes: "internal",
+			isInternalService:                         false,
+			expectedOutput:                            false,
+		},
+		{
+			desc: "should return true when preConfiguredBackendPoolLoadBalancerTypes is internal when creating internal lb",
+			preConfiguredBackendPoolLoadBalancerTypes: "internal",
+			isInternalService:                         true,
+			expectedOutput:                            true,
+		},
+		{
+			desc: "should return false when preConfiguredBackendPoolLoadBalancerTypes is empty for any case",
+			preConfiguredBackendPoolLoadBalancerTypes: "",
+			isInternalService:                         true,
+			expectedOutput:                            false,
+		},
+		{
+			desc: "should return false when preConfiguredBackendPoolLoadBalancerTypes is empty for any case",
+			preConfiguredBackendPoolLoadBalancerTypes: "",
+			isInternalService:                         false,
+			expectedOutput:                            false,
+		},
+	}
+
+	for i, test := range testCases {
+		az := GetTestCloud(ctrl)
+		az.Config.PreConfiguredBackendPoolLoadBalancerTypes = test.preConfiguredBackendPoolLoadBalancerTypes
+		var service v1.Service
+		if test.isInternalService {
+			service = getInternalTestService("test", 80)
+		} else {
+			service = getTestService("test", v1.ProtocolTCP, nil, false, 80)
+		}
+
+		isPreConfigured := az.isBackendPoolPreConfigured(&service)
+		assert.Equal(t, test.expectedOutput, isPreConfigured, "TestCase[%d]: %s", i, test.desc)
+	}
+}
+
+func TestEnsureFrontendIPStability(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+
+	testCases := []struct {
+		desc           string
+		assignedIP     string
+		loadBalancerIP string
+		annotations    map[string]string
+		config         network.FrontendIPConfiguration
+		expectedError  bool
+	}{
+		{
+			desc: "service without an assigned IP shall not be protected",
+			config: network.FrontendIPConfiguration{
+				Name: to.StringPtr("atest1"),
+			},
+			expectedError: false,
+		},
+		{
+			desc:           "explicitly pinned loadBalancerIP shall allow the change",
+			assignedIP:     "1.2.3.4",
+			loadBalancerIP: "4.3.2.1",
+			config: network.FrontendIPConfiguration{
+				Name: to.StringPtr("atest1"),
+			},
+			expectedError: false,
+		},
+		{
+			desc:        "internal service moved to another subnet shall allow the change",
+			assignedIP:  "10.0.0.4",
+			annotations: map[string]string{ServiceAnnotationLoadBalancerInternal: "true", ServiceAnnotationLoadBalancerInternalSubnet: "subnet2"},
+			config: network.FrontendIPConfiguration{
+				Name: to.StringPtr("atest1"),
+				FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+					Subnet: &network.Subnet{Name: to.StringPtr("subnet1")},
+				},
+			},
+			expectedError: false,
+		},
+		{
+			desc:        "internal service with static allocation and no pinned IP shall be refused",
+			assignedIP:  "10.0.0.4",
+			annotations: map[string]string{ServiceAnnotationLoadBalancerInternal: "true"},
+			config: network.FrontendIPConfiguration{
+				Name: to.StringPtr("atest1"),
+				FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+					PrivateIPAllocationMethod: network.Static,
+					PrivateIPAddress:          to.StringPtr("10.0.0.4"),
+				},
+			},
+			expectedError: true,
+		},
+	}
+
+	for i, test := range testCases {
+		service := getTestService("test1", v1.ProtocolTCP, test.annotations, false, 80)
+		service.Spec.LoadBalancerIP = test.loadBalancerIP
+		if test.assignedIP != "" {
+			service.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: test.assignedIP}}
 		}
-		assert.Equal(t, test.expectedError, err != nil, "TestCase[%d]: %s", i, test.desc)
+		err := az.ensureFrontendIPStability(&service, test.config)
+		assert.Equal(t, test.expectedError, err != nil, "TestCase[%d]: %s, err: %v", i, test.desc, err)
 	}
 }
 
-func TestEnsurePublicIPExists(t *testing.T) {
+func TestGetLoadBalancerStatusFastPath(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	testCases := []struct {
-		desc                    string
-		existingPIPs            []network.PublicIPAddress
-		inputDNSLabel           string
-		foundDNSLabelAnnotation bool
-		expectedPIP             *network.PublicIPAddress
-		expectedID              string
-		isIPv6                  bool
-		expectedError           bool
+	az := GetTestCloud(ctrl)
+	service := getTestService("test1", v1.ProtocolTCP, nil, false, 80)
+	serviceName := getServiceName(&service)
+	pipName := az.getPublicIPName("testCluster", &service)
+	frontendIPConfigID := az.getFrontendIPConfigID("lb", "rg", az.getFrontendIPConfigName(&service))
+
+	ownedPIP := network.PublicIPAddress{
+		Name: to.StringPtr(pipName),
+		Tags: map[string]*string{
+			serviceTagKey:  to.StringPtr(serviceName),
+			clusterNameKey: to.StringPtr("testCluster"),
+		},
+		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+			IPAddress:       to.StringPtr("1.2.3.4"),
+			IPConfiguration: &network.IPConfiguration{ID: to.StringPtr(frontendIPConfigID)},
+		},
+	}
+
+	mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", pipName, gomock.Any()).Return(ownedPIP, nil).Times(1)
+
+	status, ok := az.getLoadBalancerStatusFastPath("testCluster", &service)
+	assert.True(t, ok)
+	assert.Equal(t, "1.2.3.4", status.Ingress[0].IP)
+
+	// The fast path shall not answer for public IPs without ownership tags.
+	unownedPIP := ownedPIP
+	unownedPIP.Tags = nil
+	mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", pipName, gomock.Any()).Return(unownedPIP, nil).Times(1)
+	_, ok = az.getLoadBalancerStatusFastPath("testCluster", &service)
+	assert.False(t, ok)
+
+	// The fast path shall not answer for internal services.
+	internalService := getInternalTestService("test1", 80)
+	_, ok = az.getLoadBalancerStatusFastPath("testCluster", &internalService)
+	assert.False(t, ok)
+}
+
+func TestEnsureSubnetNetworkPolicies(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tests := []struct {
+		desc           string
+		autoDisable    bool
+		subnet         network.Subnet
+		expectedUpdate bool
 	}{
 		{
-			desc:         "ensurePublicIPExists shall return existed PIP if there is any",
-			existingPIPs: []network.PublicIPAddress{{Name: to.StringPtr("pip1")}},
-			expectedPIP: &network.PublicIPAddress{
-				Name: to.StringPtr("pip1"),
-				ID: to.StringPtr("/subscriptions/subscription/resourceGroups/rg" +
-					"/providers/Microsoft.Network/publicIPAddresses/pip1"),
-			},
+			desc:   "disabled policies should not trigger an update",
+			subnet: network.Subnet{Name: to.StringPtr("subnet"), SubnetPropertiesFormat: &network.SubnetPropertiesFormat{PrivateLinkServiceNetworkPolicies: to.StringPtr("Disabled")}},
 		},
 		{
-			desc: "ensurePublicIPExists shall create a new pip if there is no existed pip",
-			expectedID: "/subscriptions/subscription/resourceGroups/rg/providers/" +
-				"Microsoft.Network/publicIPAddresses/pip1",
+			desc:   "enabled policies without autoDisable should only emit an event",
+			subnet: network.Subnet{Name: to.StringPtr("subnet"), SubnetPropertiesFormat: &network.SubnetPropertiesFormat{PrivateLinkServiceNetworkPolicies: to.StringPtr("Enabled")}},
 		},
 		{
-			desc:                    "ensurePublicIPExists shall update existed PIP's dns label",
-			inputDNSLabel:           "newdns",
-			foundDNSLabelAnnotation: true,
-			existingPIPs: []network.PublicIPAddress{{
-				Name: to.StringPtr("pip1"),
-				PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
-					DNSSettings: &network.PublicIPAddressDNSSettings{
-						DomainNameLabel: to.StringPtr("previousdns"),
-					},
-				},
+			desc:        "enabled policies with autoDisable should update the subnet",
+			autoDisable: true,
+			subnet: network.Subnet{Name: to.StringPtr("subnet"), SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
+				PrivateLinkServiceNetworkPolicies: to.StringPtr("Enabled"),
+				PrivateEndpointNetworkPolicies:    to.StringPtr("Enabled"),
 			}},
-			expectedPIP: &network.PublicIPAddress{
-				Name: to.StringPtr("pip1"),
-				ID: to.StringPtr("/subscriptions/subscription/resourceGroups/rg" +
-					"/providers/Microsoft.Network/publicIPAddresses/pip1"),
-				PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
-					DNSSettings: &network.PublicIPAddressDNSSettings{
-						DomainNameLabel: to.StringPtr("newdns"),
-					},
-					PublicIPAddressVersion: "IPv4",
-				},
-			},
+			expectedUpdate: true,
 		},
 		{
-			desc:                    "ensurePublicIPExists shall delete DNS from PIP if DNS label is set empty",
-			foundDNSLabelAnnotation: true,
-			existingPIPs: []network.PublicIPAddress{{
-				Name: to.StringPtr("pip1"),
-				PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
-					DNSSettings: &network.PublicIPAddressDNSSettings{
-						DomainNameLabel: to.StringPtr("previousdns"),
-					},
-				},
-			}},
-			expectedPIP: &network.PublicIPAddress{
-				Name: to.StringPtr("pip1"),
-				ID: to.StringPtr("/subscriptions/subscription/resourceGroups/rg" +
-					"/providers/Microsoft.Network/publicIPAddresses/pip1"),
-				PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
-					DNSSettings:            nil,
-					PublicIPAddressVersion: "IPv4",
-				},
-			},
+			desc:   "unknown policies should be left alone",
+			subnet: network.Subnet{Name: to.StringPtr("subnet"), SubnetPropertiesFormat: &network.SubnetPropertiesFormat{}},
 		},
-		{
-			desc:                    "ensurePublicIPExists shall not delete DNS from PIP if DNS label annotation is not set",
-			foundDNSLabelAnnotation: false,
-			existingPIPs: []network.PublicIPAddress{{
-				Name: to.StringPtr("pip1"),
-				PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
-					DNSSettings: &network.PublicIPAddressDNSSettings{
-						DomainNameLabel: to.StringPtr("previousdns"),
-					},
-				},
-			}},
-			expectedPIP: &network.PublicIPAddress{
-				Name: to.StringPtr("pip1"),
-				ID: to.StringPtr("/subscriptions/subscription/resourceGroups/rg" +
-					"/providers/Microsoft.Network/publicIPAddresses/pip1"),
-				PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
-					DNSSettings: &network.PublicIPAddressDNSSettings{
-						DomainNameLabel: to.StringPtr("previousdns"),
+	}
+
+	for _, test := range tests {
+		az := GetTestCloud(ctrl)
+		az.AutoDisableSubnetNetworkPolicies = test.autoDisable
+		svc := getInternalTestService("service1", 80)
+
+		mockSubnetsClient := az.SubnetsClient.(*mocksubnetclient.MockInterface)
+		if test.expectedUpdate {
+			mockSubnetsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "vnet", "subnet", gomock.Any()).DoAndReturn(
+				func(ctx context.Context, rg, vnet, name string, subnet network.Subnet) *retry.Error {
+					assert.Equal(t, "Disabled", *subnet.PrivateLinkServiceNetworkPolicies, test.desc)
+					assert.Equal(t, "Disabled", *subnet.PrivateEndpointNetworkPolicies, test.desc)
+					return nil
+				})
+		}
+
+		err := az.ensureSubnetNetworkPolicies(&svc, &test.subnet)
+		assert.NoError(t, err, test.desc)
+	}
+}
+
+func TestVerifyBackendPoolMembership(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	backendPoolID := az.getBackendPoolID("lb", az.getLoadBalancerResourceGroup(), getBackendPoolName("testCluster", &svc))
+
+	lb := network.LoadBalancer{
+		Name: to.StringPtr("lb"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			BackendAddressPools: &[]network.BackendAddressPool{
+				{
+					ID: to.StringPtr(backendPoolID),
+					BackendAddressPoolPropertiesFormat: &network.BackendAddressPoolPropertiesFormat{
+						BackendIPConfigurations: &[]network.InterfaceIPConfiguration{
+							{ID: to.StringPtr("nic1-ipConfig")},
+						},
 					},
-					PublicIPAddressVersion: "IPv4",
 				},
 			},
 		},
-		{
-			desc:                    "ensurePublicIPExists shall update existed PIP's dns label for IPv6",
-			inputDNSLabel:           "newdns",
-			foundDNSLabelAnnotation: true,
-			isIPv6:                  true,
-			existingPIPs: []network.PublicIPAddress{{
-				Name: to.StringPtr("pip1"),
-				PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
-					DNSSettings: &network.PublicIPAddressDNSSettings{
-						DomainNameLabel: to.StringPtr("previousdns"),
-					},
-				},
-			}},
-			expectedPIP: &network.PublicIPAddress{
-				Name: to.StringPtr("pip1"),
-				ID: to.StringPtr("/subscriptions/subscription/resourceGroups/rg" +
-					"/providers/Microsoft.Network/publicIPAddresses/pip1"),
-				PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
-					DNSSettings: &network.PublicIPAddressDNSSettings{
-						DomainNameLabel: to.StringPtr("newdns"),
-					},
-					PublicIPAllocationMethod: "Dynamic",
-					PublicIPAddressVersion:   "IPv6",
-				},
+	}
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().Get(gomock.Any(), az.getLoadBalancerResourceGroup(), "lb", gomock.Any()).Return(lb, nil)
+
+	nodes := []*v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node1"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node2"}},
+	}
+
+	mockVMSet := mockvmsets.NewMockVMSet(ctrl)
+	mockVMSet.EXPECT().GetPrimaryInterface("node1").Return(network.Interface{
+		InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+			IPConfigurations: &[]network.InterfaceIPConfiguration{{ID: to.StringPtr("nic1-ipconfig")}},
+		},
+	}, nil)
+	mockVMSet.EXPECT().GetPrimaryInterface("node2").Return(network.Interface{
+		InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+			IPConfigurations: &[]network.InterfaceIPConfiguration{{ID: to.StringPtr("nic2-ipconfig")}},
+		},
+	}, nil)
+	mockVMSet.EXPECT().EnsureHostsInPool(&svc, []*v1.Node{nodes[1]}, backendPoolID, "as", false).Return(nil)
+	az.VMSet = mockVMSet
+
+	err := az.verifyBackendPoolMembership(&svc, nodes, "lb", backendPoolID, "as", false)
+	assert.NoError(t, err)
+}
+
+func TestUpgradePublicIP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	basicDynamicPIP := func() *network.PublicIPAddress {
+		return &network.PublicIPAddress{
+			Name: to.StringPtr("pip"),
+			Sku:  &network.PublicIPAddressSku{Name: network.PublicIPAddressSkuNameBasic},
+			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+				PublicIPAllocationMethod: network.Dynamic,
+				IPAddress:                to.StringPtr("1.2.3.4"),
 			},
-		},
+		}
 	}
 
-	for i, test := range testCases {
-		az := GetTestCloud(ctrl)
-		service := getTestService("test1", v1.ProtocolTCP, nil, test.isIPv6, 80)
-		mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
-		mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
-		mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", "pip1", gomock.Any()).DoAndReturn(func(ctx context.Context, resourceGroupName string, publicIPAddressName string, expand string) (network.PublicIPAddress, *retry.Error) {
-			var basicPIP network.PublicIPAddress
-			if len(test.existingPIPs) == 0 {
-				basicPIP = network.PublicIPAddress{
-					Name: to.StringPtr("pip1"),
-				}
-			} else {
-				basicPIP = test.existingPIPs[0]
-			}
+	// Basic load balancers can attach any public IP.
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	assert.False(t, az.upgradePublicIP(&svc, basicDynamicPIP()))
 
-			basicPIP.ID = to.StringPtr("/subscriptions/subscription/resourceGroups/rg" +
-				"/providers/Microsoft.Network/publicIPAddresses/pip1")
+	// Without the consent annotation only an event is emitted.
+	az.LoadBalancerSku = loadBalancerSkuStandard
+	pip := basicDynamicPIP()
+	assert.False(t, az.upgradePublicIP(&svc, pip))
+	assert.Equal(t, network.PublicIPAddressSkuNameBasic, pip.Sku.Name)
 
-			if basicPIP.PublicIPAddressPropertiesFormat == nil {
-				return basicPIP, nil
-			}
+	// With the annotation the public IP is upgraded in place.
+	svc.Annotations[ServiceAnnotationPIPAllowUpgrade] = "true"
+	assert.True(t, az.upgradePublicIP(&svc, pip))
+	assert.Equal(t, network.PublicIPAddressSkuNameStandard, pip.Sku.Name)
+	assert.Equal(t, network.Static, pip.PublicIPAllocationMethod)
+	assert.Equal(t, "1.2.3.4", *pip.IPAddress)
 
-			if test.foundDNSLabelAnnotation {
-				if test.inputDNSLabel != "" {
-					basicPIP.DNSSettings.DomainNameLabel = &test.inputDNSLabel
-				} else {
-					basicPIP.DNSSettings = nil
-				}
-			}
+	// Standard/Static public IPs need no upgrade.
+	assert.False(t, az.upgradePublicIP(&svc, pip))
+}
 
-			if test.isIPv6 {
-				basicPIP.PublicIPAddressPropertiesFormat.PublicIPAddressVersion = "IPv6"
-				basicPIP.PublicIPAllocationMethod = "Dynamic"
-			} else {
-				basicPIP.PublicIPAddressPropertiesFormat.PublicIPAddressVersion = "IPv4"
-			}
+func TestSharedPIPPortInUseByOtherService(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
 
-			return basicPIP, nil
-		}).AnyTimes()
+	az := GetTestCloud(ctrl)
+	annotations := map[string]string{
+		ServiceAnnotationPIPName:            "shared-pip",
+		ServiceAnnotationSharedSecurityRule: "true",
+	}
+	svc := getTestService("service1", v1.ProtocolTCP, annotations, false, 80)
 
-		for _, pip := range test.existingPIPs {
-			err := az.PublicIPAddressesClient.CreateOrUpdate(context.TODO(), "rg", to.String(pip.Name), pip)
-			if err != nil {
-				t.Fatalf("TestCase[%d] meets unexpected error: %v", i, err)
-			}
-		}
-		pip, err := az.ensurePublicIPExists(&service, "pip1", test.inputDNSLabel, "", false, test.foundDNSLabelAnnotation)
-		if test.expectedID != "" {
-			assert.Equal(t, test.expectedID, to.String(pip.ID), "TestCase[%d]: %s", i, test.desc)
-		} else {
-			assert.Equal(t, test.expectedPIP, pip, "TestCase[%d]: %s", i, test.desc)
-		}
-		assert.Equal(t, test.expectedError, err != nil, "TestCase[%d]: %s", i, test.desc)
+	otherAnnotations := map[string]string{
+		ServiceAnnotationPIPName:            "shared-pip",
+		ServiceAnnotationSharedSecurityRule: "true",
+	}
+	other := getTestService("service2", v1.ProtocolTCP, otherAnnotations, false, 80, 443)
+	unrelated := getTestService("service3", v1.ProtocolTCP, nil, false, 80)
+
+	az.KubeClient = fakeclient.NewSimpleClientset(&svc, &other, &unrelated)
+
+	// Port 80 is still exposed by service2 through the same pip.
+	assert.True(t, az.sharedPIPPortInUseByOtherService(&svc, v1.ServicePort{Port: 80, Protocol: v1.ProtocolTCP}))
+	// Port 8080 is only exposed by the deleted service.
+	assert.False(t, az.sharedPIPPortInUseByOtherService(&svc, v1.ServicePort{Port: 8080, Protocol: v1.ProtocolTCP}))
+
+	// Without a kube client the cleanup proceeds as before.
+	az.KubeClient = nil
+	assert.False(t, az.sharedPIPPortInUseByOtherService(&svc, v1.ServicePort{Port: 80, Protocol: v1.ProtocolTCP}))
+}
+
+func TestCoalescePortRanges(t *testing.T) {
+	ports := []v1.ServicePort{
+		{Protocol: v1.ProtocolTCP, Port: 80},
+		{Protocol: v1.ProtocolUDP, Port: 5002},
+		{Protocol: v1.ProtocolUDP, Port: 5000},
+		{Protocol: v1.ProtocolUDP, Port: 5001},
+		{Protocol: v1.ProtocolTCP, Port: 5000},
 	}
+
+	ranges, singles := coalescePortRanges(ports)
+	assert.Equal(t, []servicePortRange{{protocol: v1.ProtocolUDP, start: 5000, end: 5002}}, ranges)
+	assert.Equal(t, []v1.ServicePort{
+		{Protocol: v1.ProtocolTCP, Port: 80},
+		{Protocol: v1.ProtocolTCP, Port: 5000},
+	}, singles)
+
+	ranges, singles = coalescePortRanges([]v1.ServicePort{{Protocol: v1.ProtocolTCP, Port: 80}})
+	assert.Empty(t, ranges)
+	assert.Len(t, singles, 1)
 }
 
-func TestShouldUpdateLoadBalancer(t *testing.T) {
+func TestReconcileInboundNatPools(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	testCases := []struct {
-		desc                   string
-		lbHasDeletionTimestamp bool
-		existsLb               bool
-		expectedOutput         bool
-	}{
-		{
-			desc:                   "should update a load balancer that does not have a deletion timestamp and exists in Azure",
-			lbHasDeletionTimestamp: false,
-			existsLb:               true,
-			expectedOutput:         true,
-		},
+	az := GetTestCloud(ctrl)
+	annotations := map[string]string{ServiceAnnotationLoadBalancerEnablePortRanges: "true"}
+	svc := getTestService("service1", v1.ProtocolUDP, annotations, false, 5000, 5001, 5002, 8080)
+
+	pools, err := az.reconcileInboundNatPools(&svc, true, "frontendID", to.Int32Ptr(4))
+	assert.NoError(t, err)
+	assert.Len(t, pools, 1)
+	assert.Equal(t, "aservice1-UDP-5000-5002", *pools[0].Name)
+	assert.Equal(t, int32(5000), *pools[0].FrontendPortRangeStart)
+	assert.Equal(t, int32(5002), *pools[0].FrontendPortRangeEnd)
+	assert.Equal(t, "frontendID", *pools[0].FrontendIPConfiguration.ID)
+
+	// The covered ports must not get per-port rules and probes.
+	probes, rules, err := az.reconcileLoadBalancerRule(&svc, true, "frontendID", "backendPoolID", "testCluster", to.Int32Ptr(4))
+	assert.NoError(t, err)
+	assert.Len(t, rules, 1)
+	assert.Equal(t, int32(8080), *rules[0].FrontendPort)
+	assert.Len(t, probes, 0)
+
+	// Without the annotation no pools are created.
+	svcNoRanges := getTestService("service1", v1.ProtocolUDP, nil, false, 5000, 5001)
+	pools, err = az.reconcileInboundNatPools(&svcNoRanges, true, "frontendID", to.Int32Ptr(4))
+	assert.NoError(t, err)
+	assert.Empty(t, pools)
+
+	pools, err = az.reconcileInboundNatPools(&svc, false, "frontendID", to.Int32Ptr(4))
+	assert.NoError(t, err)
+	assert.Empty(t, pools)
+}
+
+func TestCleanupEmptyLoadBalancers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = loadBalancerSkuStandard
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+
+	clusterPools := &[]network.BackendAddressPool{{Name: to.StringPtr(testClusterName)}}
+	lbs := []network.LoadBalancer{
 		{
-			desc:                   "should not update a load balancer that is being deleted / already deleted in K8s",
-			lbHasDeletionTimestamp: true,
-			existsLb:               true,
-			expectedOutput:         false,
+			// Empty and owned by the cluster: deleted.
+			Name: to.StringPtr("as-internal"),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+				BackendAddressPools: clusterPools,
+			},
 		},
 		{
-			desc:                   "should not update a load balancer that does not exist in Azure",
-			lbHasDeletionTimestamp: false,
-			existsLb:               false,
-			expectedOutput:         false,
+			// The default outbound LB is kept even when empty.
+			Name: to.StringPtr(testClusterName),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+				BackendAddressPools: clusterPools,
+			},
 		},
 		{
-			desc:                   "should not update a load balancer that has a deletion timestamp and does not exist in Azure",
-			lbHasDeletionTimestamp: true,
-			existsLb:               false,
-			expectedOutput:         false,
+			// Not owned by the provider: kept.
+			Name:                         to.StringPtr("appliance"),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{},
+		},
+		{
+			// Still has frontends: kept.
+			Name: to.StringPtr("as"),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+				BackendAddressPools:      clusterPools,
+				FrontendIPConfigurations: &[]network.FrontendIPConfiguration{{Name: to.StringPtr("fip")}},
+			},
 		},
 	}
+	mockLBsClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBsClient.EXPECT().List(gomock.Any(), "rg").Return(lbs, nil)
+	mockLBsClient.EXPECT().Delete(gomock.Any(), "rg", "as-internal").Return(nil)
 
-	for i, test := range testCases {
-		az := GetTestCloud(ctrl)
-		service := getTestService("test1", v1.ProtocolTCP, nil, false, 80)
-		setMockPublicIPs(az, ctrl, 1)
-		mockLBsClient := mockloadbalancerclient.NewMockInterface(ctrl)
-		az.LoadBalancerClient = mockLBsClient
-		mockLBsClient.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
-		if test.lbHasDeletionTimestamp {
-			service.ObjectMeta.DeletionTimestamp = &metav1.Time{Time: time.Now()}
-		}
-		if test.existsLb {
-			lb := network.LoadBalancer{
-				Name: to.StringPtr("lb1"),
-				LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
-					FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
-						{
-							Name: to.StringPtr("atest1"),
-							FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
-								PublicIPAddress: &network.PublicIPAddress{ID: to.StringPtr("testCluster-aservice1")},
-							},
-						},
-					},
-				},
-			}
-			err := az.LoadBalancerClient.CreateOrUpdate(context.TODO(), "rg", *lb.Name, lb, "")
-			if err != nil {
-				t.Fatalf("TestCase[%d] meets unexpected error: %v", i, err)
-			}
-			mockLBsClient.EXPECT().List(gomock.Any(), "rg").Return([]network.LoadBalancer{lb}, nil)
-		} else {
-			mockLBsClient.EXPECT().List(gomock.Any(), "rg").Return(nil, nil)
-		}
-		shouldUpdateLoadBalancer := az.shouldUpdateLoadBalancer(testClusterName, &service)
-		assert.Equal(t, test.expectedOutput, shouldUpdateLoadBalancer, "TestCase[%d]: %s", i, test.desc)
-	}
+	assert.NoError(t, az.cleanupEmptyLoadBalancers(testClusterName, &svc))
+
+	// The opt-out flag skips the cleanup entirely.
+	az.DisableEmptyLoadBalancerCleanup = true
+	assert.NoError(t, az.cleanupEmptyLoadBalancers(testClusterName, &svc))
 }
 
-func TestIsBackendPoolPreConfigured(t *testing.T) {
+func TestCleanupEmptyLoadBalancersAcrossResourceGroups(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = loadBalancerSkuStandard
+	az.VnetResourceGroup = "vnet-rg"
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+
+	// An empty cluster-owned load balancer listed from the network resource
+	// group shall have its backend pool ID rendered for and be deleted in
+	// that group, not the default one.
+	clusterPools := &[]network.BackendAddressPool{{Name: to.StringPtr(testClusterName)}}
+	mockLBsClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBsClient.EXPECT().List(gomock.Any(), "rg").Return([]network.LoadBalancer{}, nil)
+	mockLBsClient.EXPECT().List(gomock.Any(), "vnet-rg").Return([]network.LoadBalancer{
+		{
+			Name: to.StringPtr("as-internal"),
+			ID:   to.StringPtr("/subscriptions/subscription/resourceGroups/vnet-rg/providers/Microsoft.Network/loadBalancers/as-internal"),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+				BackendAddressPools: clusterPools,
+			},
+		},
+	}, nil)
+	mockLBsClient.EXPECT().Delete(gomock.Any(), "vnet-rg", "as-internal").Return(nil)
+
+	mockVMSet := mockvmsets.NewMockVMSet(ctrl)
+	mockVMSet.EXPECT().EnsureBackendPoolDeleted(&svc, az.getBackendPoolID("as-internal", "vnet-rg", testClusterName), "as", clusterPools).Return(nil)
+	az.VMSet = mockVMSet
+
+	assert.NoError(t, az.cleanupEmptyLoadBalancers(testClusterName, &svc))
+}
+
+func TestReconcileLoadBalancerRuleWithCustomProbe(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	testCases := []struct {
-		desc                                      string
-		preConfiguredBackendPoolLoadBalancerTypes string
-		isInternalService                         bool
-		expectedOutput                            bool
+		desc              string
+		annotations       map[string]string
+		expectedPort      int32
+		expectedProtocol  network.ProbeProtocol
+		expectedPath      *string
+		expectedInterval  int32
+		expectedNumProbes int32
+		expectedError     bool
 	}{
 		{
-			desc: "should return true when preConfiguredBackendPoolLoadBalancerTypes is both for any case",
-			preConfiguredBackendPoolLoadBalancerTypes: "all",
-			isInternalService:                         true,
-			expectedOutput:                            true,
+			desc:             "no annotation should keep probing the service node port",
+			expectedPort:     10080,
+			expectedProtocol: network.ProbeProtocolTCP,
 		},
 		{
-			desc: "should return true when preConfiguredBackendPoolLoadBalancerTypes is both for any case",
-			preConfiguredBackendPoolLoadBalancerTypes: "all",
-			isInternalService:                         false,
-			expectedOutput:                            true,
+			desc: "probe port annotation should redirect the probe",
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerHealthProbePort: "10256",
+			},
+			expectedPort:     10256,
+			expectedProtocol: network.ProbeProtocolTCP,
 		},
 		{
-			desc: "should return true when preConfiguredBackendPoolLoadBalancerTypes is external when creating external lb",
-			preConfiguredBackendPoolLoadBalancerTypes: "external",
-			isInternalService:                         false,
-			expectedOutput:                            true,
+			desc: "request path annotation should switch the probe to HTTP",
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerHealthProbePort:        "10256",
+				ServiceAnnotationLoadBalancerHealthProbeRequestPath: "/healthz",
+			},
+			expectedPort:     10256,
+			expectedProtocol: network.ProbeProtocolHTTP,
+			expectedPath:     to.StringPtr("/healthz"),
 		},
 		{
-			desc: "should return false when preConfiguredBackendPoolLoadBalancerTypes is external when creating internal lb",
-			preConfiguredBackendPoolLoadBalancerTypes: "external",
-			isInternalService:                         true,
-			expectedOutput:                            false,
+			desc: "probe protocol annotation should switch the probe to HTTPS with the default path",
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerHealthProbeProtocol: "Https",
+			},
+			expectedPort:     10080,
+			expectedProtocol: network.ProbeProtocolHTTPS,
+			expectedPath:     to.StringPtr("/healthz"),
 		},
 		{
-			desc: "should return false when preConfiguredBackendPoolLoadBalancerTypes is internal when creating external lb",
-			preConfiguredBackendPoolLoadBalancerTypes: "internal",
-			isInternalService:                         false,
-			expectedOutput:                            false,
+			desc: "probe protocol annotation should use the request path annotation",
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerHealthProbeProtocol:    "http",
+				ServiceAnnotationLoadBalancerHealthProbeRequestPath: "/ready",
+			},
+			expectedPort:     10080,
+			expectedProtocol: network.ProbeProtocolHTTP,
+			expectedPath:     to.StringPtr("/ready"),
 		},
 		{
-			desc: "should return true when preConfiguredBackendPoolLoadBalancerTypes is internal when creating internal lb",
-			preConfiguredBackendPoolLoadBalancerTypes: "internal",
-			isInternalService:                         true,
-			expectedOutput:                            true,
+			desc: "probe protocol Tcp should drop the request path",
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerHealthProbeProtocol:    "Tcp",
+				ServiceAnnotationLoadBalancerHealthProbePort:        "10256",
+				ServiceAnnotationLoadBalancerHealthProbeRequestPath: "/healthz",
+			},
+			expectedPort:     10256,
+			expectedProtocol: network.ProbeProtocolTCP,
 		},
 		{
-			desc: "should return false when preConfiguredBackendPoolLoadBalancerTypes is empty for any case",
-			preConfiguredBackendPoolLoadBalancerTypes: "",
-			isInternalService:                         true,
-			expectedOutput:                            false,
+			desc: "interval and number of probes annotations should be honored",
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerHealthProbeInterval:   "15",
+				ServiceAnnotationLoadBalancerHealthProbeNumOfProbe: "4",
+			},
+			expectedPort:      10080,
+			expectedProtocol:  network.ProbeProtocolTCP,
+			expectedInterval:  15,
+			expectedNumProbes: 4,
 		},
 		{
-			desc: "should return false when preConfiguredBackendPoolLoadBalancerTypes is empty for any case",
-			preConfiguredBackendPoolLoadBalancerTypes: "",
-			isInternalService:                         false,
-			expectedOutput:                            false,
+			desc: "invalid probe port should report an error",
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerHealthProbePort: "not-a-port",
+			},
+			expectedError: true,
+		},
+		{
+			desc: "invalid probe protocol should report an error",
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerHealthProbeProtocol: "ICMP",
+			},
+			expectedError: true,
+		},
+		{
+			desc: "too small probe interval should report an error",
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerHealthProbeInterval: "3",
+			},
+			expectedError: true,
+		},
+		{
+			desc: "invalid number of probes should report an error",
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerHealthProbeNumOfProbe: "0",
+			},
+			expectedError: true,
 		},
 	}
 
 	for i, test := range testCases {
 		az := GetTestCloud(ctrl)
-		az.Config.PreConfiguredBackendPoolLoadBalancerTypes = test.preConfiguredBackendPoolLoadBalancerTypes
-		var service v1.Service
-		if test.isInternalService {
-			service = getInternalTestService("test", 80)
-		} else {
-			service = getTestService("test", v1.ProtocolTCP, nil, false, 80)
+		service := getTestService("service1", v1.ProtocolTCP, test.annotations, false, 80)
+
+		probes, _, err := az.reconcileLoadBalancerRule(&service, true,
+			az.getFrontendIPConfigID(testClusterName, "rg", "aservice1"),
+			az.getBackendPoolID(testClusterName, "rg", testClusterName), testClusterName, nil)
+		assert.Equal(t, test.expectedError, err != nil, "TestCase[%d]: %s", i, test.desc)
+		if test.expectedError {
+			continue
 		}
 
-		isPreConfigured := az.isBackendPoolPreConfigured(&service)
-		assert.Equal(t, test.expectedOutput, isPreConfigured, "TestCase[%d]: %s", i, test.desc)
+		assert.Len(t, probes, 1, "TestCase[%d]: %s", i, test.desc)
+		assert.Equal(t, test.expectedPort, *probes[0].Port, "TestCase[%d]: %s", i, test.desc)
+		assert.Equal(t, test.expectedProtocol, probes[0].Protocol, "TestCase[%d]: %s", i, test.desc)
+		assert.Equal(t, test.expectedPath, probes[0].RequestPath, "TestCase[%d]: %s", i, test.desc)
+		if test.expectedInterval != 0 {
+			assert.Equal(t, test.expectedInterval, *probes[0].IntervalInSeconds, "TestCase[%d]: %s", i, test.desc)
+		}
+		if test.expectedNumProbes != 0 {
+			assert.Equal(t, test.expectedNumProbes, *probes[0].NumberOfProbes, "TestCase[%d]: %s", i, test.desc)
+		}
+	}
+}
+
+func TestHealthProbeClusterDefaults(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+
+	// Without config defaults the Azure defaults apply.
+	interval, err := az.getServiceHealthProbeInterval(&svc)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(defaultHealthProbeInterval), interval)
+	numOfProbe, err := az.getServiceHealthProbeNumOfProbe(&svc)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(defaultHealthProbeNumOfProbe), numOfProbe)
+
+	// Cloud config defaults shall apply to services without annotations.
+	az.LoadBalancerHealthProbeInterval = 15
+	az.LoadBalancerHealthProbeNumOfProbe = 4
+	interval, err = az.getServiceHealthProbeInterval(&svc)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(15), interval)
+	numOfProbe, err = az.getServiceHealthProbeNumOfProbe(&svc)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(4), numOfProbe)
+
+	// Annotations shall override the cluster-wide defaults.
+	svc.Annotations[ServiceAnnotationLoadBalancerHealthProbeInterval] = "30"
+	svc.Annotations[ServiceAnnotationLoadBalancerHealthProbeNumOfProbe] = "6"
+	interval, err = az.getServiceHealthProbeInterval(&svc)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(30), interval)
+	numOfProbe, err = az.getServiceHealthProbeNumOfProbe(&svc)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(6), numOfProbe)
+
+	// Config defaults outside the Azure limits shall be rejected.
+	config := Config{
+		UseInstanceMetadata:             true,
+		LoadBalancerHealthProbeInterval: 3,
+	}
+	err = az.InitializeCloudFromConfig(&config, false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "loadBalancerHealthProbeInterval")
+
+	config = Config{
+		UseInstanceMetadata:               true,
+		LoadBalancerHealthProbeNumOfProbe: 21,
+	}
+	err = az.InitializeCloudFromConfig(&config, false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "loadBalancerHealthProbeNumOfProbe")
+}
+
+func TestMigrateBackendPoolMemberships(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+
+	// Without the override the migration is a no-op.
+	lb := network.LoadBalancer{
+		Name: to.StringPtr(testClusterName),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			BackendAddressPools: &[]network.BackendAddressPool{
+				{Name: to.StringPtr(testClusterName)},
+			},
+		},
+	}
+	assert.NoError(t, az.migrateBackendPoolMemberships(testClusterName, &svc, &lb, "as"))
+	assert.Len(t, *lb.BackendAddressPools, 1)
+
+	// With the override configured the old default-named pool is drained and
+	// removed once the nodes are in the new pool.
+	az.LoadBalancerBackendPoolName = "custompool"
+	(*lb.BackendAddressPools) = append(*lb.BackendAddressPools, network.BackendAddressPool{Name: to.StringPtr("custompool")})
+
+	oldPoolID := az.getBackendPoolID(testClusterName, "rg", testClusterName)
+	mockVMSet := mockvmsets.NewMockVMSet(ctrl)
+	mockVMSet.EXPECT().EnsureBackendPoolDeleted(&svc, oldPoolID, "as", gomock.Any()).Return(nil)
+	az.VMSet = mockVMSet
+
+	mockLBsClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", testClusterName, gomock.Any(), gomock.Any()).Return(nil)
+
+	assert.NoError(t, az.migrateBackendPoolMemberships(testClusterName, &svc, &lb, "as"))
+	assert.Len(t, *lb.BackendAddressPools, 1)
+	assert.Equal(t, "custompool", *(*lb.BackendAddressPools)[0].Name)
+}
+
+func TestGetBackendPoolNameOverride(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	svcIPv6 := getTestService("service1", v1.ProtocolTCP, nil, true, 80)
+
+	assert.Equal(t, testClusterName, az.getBackendPoolName(testClusterName, &svc))
+	assert.Equal(t, testClusterName+"-IPv6", az.getBackendPoolName(testClusterName, &svcIPv6))
+
+	az.LoadBalancerBackendPoolName = "custompool"
+	assert.Equal(t, "custompool", az.getBackendPoolName(testClusterName, &svc))
+	assert.Equal(t, "custompool-IPv6", az.getBackendPoolName(testClusterName, &svcIPv6))
+}
+
+func TestLoadBalancerClassHandling(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	unclassed := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	classed := getTestService("service2", v1.ProtocolTCP, map[string]string{
+		ServiceAnnotationLoadBalancerClass: "example.com/other",
+	}, false, 80)
+
+	assert.True(t, az.ownsLoadBalancerService(&unclassed))
+	assert.False(t, az.ownsLoadBalancerService(&classed))
+
+	// Services of a foreign class are ignored entirely: no ARM calls are
+	// mocked, so any attempt to reconcile them would fail the test.
+	_, err := az.EnsureLoadBalancer(context.TODO(), testClusterName, &classed, nil)
+	assert.Equal(t, cloudprovider.ImplementedElsewhere, err)
+	assert.Equal(t, cloudprovider.ImplementedElsewhere, az.UpdateLoadBalancer(context.TODO(), testClusterName, &classed, nil))
+
+	_, exists, err := az.GetLoadBalancer(context.TODO(), testClusterName, &classed)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	// Claiming a class makes the provider own services carrying it.
+	az.LoadBalancerClassName = "example.com/other"
+	assert.True(t, az.ownsLoadBalancerService(&classed))
+	assert.True(t, az.ownsLoadBalancerService(&unclassed))
+}
+
+func TestExternallyOwnedLoadBalancer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	setMockPublicIPs(az, ctrl, 1)
+
+	externallyOwned := getTestLoadBalancer(to.StringPtr("sharedLB"), to.StringPtr("rg"), to.StringPtr("testCluster"), to.StringPtr("aservice1"), svc, "Basic")
+	externallyOwned.Tags = map[string]*string{externallyOwnedLBTagKey: to.StringPtr("true")}
+
+	assert.True(t, isLoadBalancerExternallyOwned(&externallyOwned))
+	untagged := getTestLoadBalancer(to.StringPtr("lb1"), to.StringPtr("rg"), to.StringPtr("testCluster"), to.StringPtr("aservice1"), svc, "Basic")
+	assert.False(t, isLoadBalancerExternallyOwned(&untagged))
+	untagged.Tags = map[string]*string{externallyOwnedLBTagKey: to.StringPtr("false")}
+	assert.False(t, isLoadBalancerExternallyOwned(&untagged))
+
+	// Removing the last frontend of an externally owned load balancer must
+	// not delete the resource: no Delete call is mocked, so an attempt to
+	// issue one would fail the test.
+	mockLBsClient := mockloadbalancerclient.NewMockInterface(ctrl)
+	mockLBsClient.EXPECT().List(gomock.Any(), "rg").Return([]network.LoadBalancer{externallyOwned}, nil)
+	az.LoadBalancerClient = mockLBsClient
+
+	lb, err := az.reconcileLoadBalancer(testClusterName, &svc, nil, false)
+	assert.NoError(t, err)
+	assert.NotNil(t, lb)
+	assert.Empty(t, *lb.FrontendIPConfigurations)
+
+	// cleanupEmptyLoadBalancers leaves externally owned load balancers alone
+	// even when they carry the cluster backend pool and have no frontends.
+	emptyShared := network.LoadBalancer{
+		Name: to.StringPtr("sharedLB"),
+		Tags: map[string]*string{externallyOwnedLBTagKey: to.StringPtr("true")},
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			BackendAddressPools: &[]network.BackendAddressPool{{Name: to.StringPtr(testClusterName)}},
+		},
+	}
+	assert.NoError(t, az.lbListCache.Delete("rg"))
+	mockLBsClient.EXPECT().List(gomock.Any(), "rg").Return([]network.LoadBalancer{emptyShared}, nil)
+	assert.NoError(t, az.cleanupEmptyLoadBalancers(testClusterName, &svc))
+}
+
+func TestReconcileSecurityGroupDualStackSourceRanges(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	svc.Spec.LoadBalancerSourceRanges = []string{"10.0.0.0/8", "2001:db8::/32"}
+
+	sg := network.SecurityGroup{
+		Name:                          to.StringPtr("nsg"),
+		SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{},
+	}
+	mockSGsClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+	mockSGsClient.EXPECT().Get(gomock.Any(), "rg", "nsg", gomock.Any()).Return(sg, nil).AnyTimes()
+	mockSGsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "nsg", gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	// Only the IPv4 range is applied to rules pointing at an IPv4 frontend.
+	updatedSg, err := az.reconcileSecurityGroup(testClusterName, &svc, to.StringPtr("1.2.3.4"), true)
+	assert.NoError(t, err)
+	rules := *updatedSg.SecurityRules
+	assert.Len(t, rules, 1)
+	assert.Equal(t, "aservice1-TCP-80-10.0.0.0_8", *rules[0].Name)
+	assert.Equal(t, "10.0.0.0/8", *rules[0].SourceAddressPrefix)
+
+	// Only the IPv6 range is applied to rules pointing at an IPv6 frontend,
+	// and the colons of the prefix are disambiguated in the rule name.
+	az.nsgCache.Delete("nsg")
+	updatedSg, err = az.reconcileSecurityGroup(testClusterName, &svc, to.StringPtr("fd00::eef0"), true)
+	assert.NoError(t, err)
+	rules = *updatedSg.SecurityRules
+	assert.Len(t, rules, 1)
+	assert.Equal(t, "aservice1-TCP-80-2001.db8.._32", *rules[0].Name)
+	assert.Equal(t, "2001:db8::/32", *rules[0].SourceAddressPrefix)
+	assert.Equal(t, "fd00::eef0", *rules[0].DestinationAddressPrefix)
+}
+
+func TestReconcileLoadBalancerRuleProxyProtocol(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+
+	// An external service cannot carry a private link service.
+	external := getTestService("service1", v1.ProtocolTCP, map[string]string{ServiceAnnotationPLSProxyProtocol: "true"}, false, 80)
+	_, _, err := az.reconcileLoadBalancerRule(&external, true, "frontendID", "backendPoolID", testClusterName, nil)
+	assert.Error(t, err)
+
+	// HTTP probes are incompatible with PROXY protocol.
+	httpProbed := getInternalTestService("service1", 80)
+	httpProbed.Annotations[ServiceAnnotationPLSProxyProtocol] = "true"
+	httpProbed.Annotations[ServiceAnnotationLoadBalancerHealthProbePort] = "31234"
+	httpProbed.Annotations[ServiceAnnotationLoadBalancerHealthProbeRequestPath] = "/healthz"
+	_, _, err = az.reconcileLoadBalancerRule(&httpProbed, true, "frontendID", "backendPoolID", testClusterName, nil)
+	assert.Error(t, err)
+
+	// So are the HTTP health check probes of Local-policy services.
+	local := getInternalTestService("service1", 80)
+	local.Annotations[ServiceAnnotationPLSProxyProtocol] = "true"
+	local.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyTypeLocal
+	local.Spec.HealthCheckNodePort = 32000
+	_, _, err = az.reconcileLoadBalancerRule(&local, true, "frontendID", "backendPoolID", testClusterName, nil)
+	assert.Error(t, err)
+
+	// Plain TCP probes complete their handshake before any PROXY header is
+	// expected and remain compatible.
+	plain := getInternalTestService("service1", 80)
+	plain.Annotations[ServiceAnnotationPLSProxyProtocol] = "true"
+	probes, rules, err := az.reconcileLoadBalancerRule(&plain, true, "frontendID", "backendPoolID", testClusterName, nil)
+	assert.NoError(t, err)
+	assert.Len(t, rules, 1)
+	assert.Len(t, probes, 1)
+	assert.Equal(t, network.ProbeProtocolTCP, probes[0].Protocol)
+	assert.Nil(t, probes[0].RequestPath)
+}
+
+func TestValidateGlobalInternalLoadBalancer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = loadBalancerSkuStandard
+
+	// Services without the annotation pass regardless of the SKU.
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	assert.NoError(t, az.validateGlobalInternalLoadBalancer(&svc))
+
+	// The global tier shall require the internal annotation.
+	svc.Annotations[ServiceAnnotationLoadBalancerInternalGlobal] = "true"
+	err := az.validateGlobalInternalLoadBalancer(&svc)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), ServiceAnnotationLoadBalancerInternal)
+
+	// The global tier shall require the standard SKU.
+	svc.Annotations[ServiceAnnotationLoadBalancerInternal] = "true"
+	az.LoadBalancerSku = loadBalancerSkuBasic
+	err = az.validateGlobalInternalLoadBalancer(&svc)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "loadBalancerSku standard")
+
+	// Internal, standard SKU and the annotation together are accepted.
+	az.LoadBalancerSku = loadBalancerSkuStandard
+	assert.NoError(t, az.validateGlobalInternalLoadBalancer(&svc))
+}
+
+func TestValidateGatewayLoadBalancerFrontend(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	gatewayFrontendID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/gateway-lb/frontendIPConfigurations/fe1"
+
+	// A malformed annotation shall be rejected.
+	svc.Annotations[ServiceAnnotationGatewayLoadBalancer] = "not-a-resource-id"
+	_, err := getGatewayLoadBalancerFrontendID(&svc)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not a load balancer frontend IP configuration resource ID")
+
+	svc.Annotations[ServiceAnnotationGatewayLoadBalancer] = gatewayFrontendID
+	frontendID, err := getGatewayLoadBalancerFrontendID(&svc)
+	assert.NoError(t, err)
+	assert.Equal(t, gatewayFrontendID, frontendID)
+
+	mockLBsClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+
+	// An existing gateway frontend shall validate.
+	mockLBsClient.EXPECT().Get(gomock.Any(), "rg", "gateway-lb", gomock.Any()).Return(network.LoadBalancer{
+		Name: to.StringPtr("gateway-lb"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{{Name: to.StringPtr("fe1")}},
+		},
+	}, nil).Times(1)
+	assert.NoError(t, az.validateGatewayLoadBalancerFrontend(&svc, frontendID))
+
+	// A gateway load balancer without the referenced frontend shall be
+	// rejected.
+	mockLBsClient.EXPECT().Get(gomock.Any(), "rg", "gateway-lb", gomock.Any()).Return(network.LoadBalancer{
+		Name: to.StringPtr("gateway-lb"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{{Name: to.StringPtr("fe2")}},
+		},
+	}, nil).Times(1)
+	err = az.validateGatewayLoadBalancerFrontend(&svc, frontendID)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "does not exist on gateway load balancer gateway-lb")
+
+	// A missing gateway load balancer shall be rejected.
+	mockLBsClient.EXPECT().Get(gomock.Any(), "rg", "gateway-lb", gomock.Any()).Return(network.LoadBalancer{}, &retry.Error{HTTPStatusCode: http.StatusNotFound}).Times(1)
+	err = az.validateGatewayLoadBalancerFrontend(&svc, frontendID)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "gateway load balancer gateway-lb referenced by annotation")
+}
+
+func TestEnsureLoadBalancerIPNotClaimed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+
+	// Internal services shall not take a private IP held by a foreign frontend.
+	internalSvc := getInternalTestService("service1", 80)
+	internalSvc.Spec.LoadBalancerIP = "10.0.0.4"
+	lb := network.LoadBalancer{
+		Name: to.StringPtr(testClusterName + "-internal"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+				{
+					Name: to.StringPtr("aservice2"),
+					FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+						PrivateIPAddress: to.StringPtr("10.0.0.4"),
+					},
+				},
+			},
+		},
+	}
+	err := az.ensureLoadBalancerIPNotClaimed(&internalSvc, &lb, "fipID1")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "aservice2")
+
+	// The service's own frontend holding the IP is not a conflict.
+	(*lb.FrontendIPConfigurations)[0].Name = to.StringPtr("aservice1")
+	assert.NoError(t, az.ensureLoadBalancerIPNotClaimed(&internalSvc, &lb, "fipID1"))
+
+	// External services shall not take a public IP attached to the frontend
+	// of another service.
+	externalSvc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	externalSvc.Spec.LoadBalancerIP = "1.2.3.4"
+	conflictingPIP := network.PublicIPAddress{
+		Name: to.StringPtr("pip1"),
+		Tags: map[string]*string{serviceTagKey: to.StringPtr("default/service2")},
+		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+			IPAddress:       to.StringPtr("1.2.3.4"),
+			IPConfiguration: &network.IPConfiguration{ID: to.StringPtr("fipID2")},
+		},
 	}
+	mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPsClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{conflictingPIP}, nil).Times(3)
+	err = az.ensureLoadBalancerIPNotClaimed(&externalSvc, nil, "fipID1")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "default/service2")
+
+	// A public IP attached to the service's own frontend is not a conflict.
+	conflictingPIP.IPConfiguration.ID = to.StringPtr("fipID1")
+	assert.NoError(t, az.ensureLoadBalancerIPNotClaimed(&externalSvc, nil, "fipID1"))
+
+	// A detached public IP holding the IP is free to take.
+	conflictingPIP.PublicIPAddressPropertiesFormat.IPConfiguration = nil
+	assert.NoError(t, az.ensureLoadBalancerIPNotClaimed(&externalSvc, nil, "fipID1"))
 }
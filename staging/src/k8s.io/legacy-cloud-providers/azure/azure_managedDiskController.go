@@ -82,6 +82,10 @@ type ManagedDiskOptions struct {
 
 //CreateManagedDisk : create managed disk
 func (c *ManagedDiskController) CreateManagedDisk(options *ManagedDiskOptions) (string, error) {
+	if err := c.common.cloud.checkReadOnly(nil, "CreateManagedDisk"); err != nil {
+		return "", err
+	}
+
 	var err error
 	klog.V(4).Infof("azureDisk - creating new managed Name:%s StorageAccountType:%s Size:%v", options.DiskName, options.StorageAccountType, options.SizeGB)
 
@@ -213,6 +217,10 @@ func (c *ManagedDiskController) CreateManagedDisk(options *ManagedDiskOptions) (
 
 //DeleteManagedDisk : delete managed disk
 func (c *ManagedDiskController) DeleteManagedDisk(diskURI string) error {
+	if err := c.common.cloud.checkReadOnly(nil, "DeleteManagedDisk"); err != nil {
+		return err
+	}
+
 	diskName := path.Base(diskURI)
 	resourceGroup, err := getResourceGroupFromDiskURI(diskURI)
 	if err != nil {
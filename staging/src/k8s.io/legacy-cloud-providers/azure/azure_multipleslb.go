@@ -0,0 +1,109 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// useMultipleStandardLoadBalancers returns true when the cluster spreads its
+// services over several Standard Load Balancers.
+func (az *Cloud) useMultipleStandardLoadBalancers() bool {
+	return az.useStandardLoadBalancer() && len(az.MultipleStandardLoadBalancerConfigurations) > 0
+}
+
+// getMultipleStandardLBConfigByName returns the multi-SLB configuration with
+// the given load balancer name, or nil when there is none.
+func (az *Cloud) getMultipleStandardLBConfigByName(lbName string) *MultipleStandardLoadBalancerConfiguration {
+	lbName = trimLoadBalancerNameSuffixes(lbName)
+	for i := range az.MultipleStandardLoadBalancerConfigurations {
+		if strings.EqualFold(az.MultipleStandardLoadBalancerConfigurations[i].Name, lbName) {
+			return &az.MultipleStandardLoadBalancerConfigurations[i]
+		}
+	}
+	return nil
+}
+
+// getMultipleStandardLBConfigForService returns the multi-SLB configuration
+// that claims the namespace of the service, or nil when no configuration
+// claims it and the service belongs on the default cluster load balancer.
+func (az *Cloud) getMultipleStandardLBConfigForService(service *v1.Service) *MultipleStandardLoadBalancerConfiguration {
+	if service == nil {
+		return nil
+	}
+	for i := range az.MultipleStandardLoadBalancerConfigurations {
+		for _, namespace := range az.MultipleStandardLoadBalancerConfigurations[i].ServiceNamespaces {
+			if strings.EqualFold(namespace, service.Namespace) {
+				return &az.MultipleStandardLoadBalancerConfigurations[i]
+			}
+		}
+	}
+	return nil
+}
+
+// nodeVMSetNameFromProviderID extracts the scale set name from the provider
+// ID of a VMSS node. It returns an empty string for nodes whose VM set
+// cannot be derived locally, which callers should treat as unconstrained.
+func nodeVMSetNameFromProviderID(node *v1.Node) string {
+	matches := vmssVMProviderIDRE.FindStringSubmatch(node.Spec.ProviderID)
+	if len(matches) != 3 {
+		return ""
+	}
+	return matches[2]
+}
+
+// filterNodesForLoadBalancer returns the nodes that belong to the backend
+// pools of the given load balancer according to the multi-SLB configuration.
+// Nodes whose VM set is not claimed by the configuration are left out, so
+// the backend pool membership is managed per load balancer.
+func (az *Cloud) filterNodesForLoadBalancer(lbName string, nodes []*v1.Node) []*v1.Node {
+	if !az.useMultipleStandardLoadBalancers() {
+		return nodes
+	}
+
+	multiSLBConfig := az.getMultipleStandardLBConfigByName(lbName)
+	if multiSLBConfig == nil || len(multiSLBConfig.VMSetNames) == 0 {
+		return nodes
+	}
+
+	filtered := make([]*v1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		vmSetName := nodeVMSetNameFromProviderID(node)
+		if vmSetName != "" && !stringInSliceFold(vmSetName, multiSLBConfig.VMSetNames) {
+			klog.V(4).Infof("filterNodesForLoadBalancer: excluding node %s (VM set %s) from load balancer %s", node.Name, vmSetName, lbName)
+			continue
+		}
+		filtered = append(filtered, node)
+	}
+	return filtered
+}
+
+// stringInSliceFold reports whether the slice contains the string, ignoring
+// case.
+func stringInSliceFold(s string, list []string) bool {
+	for _, item := range list {
+		if strings.EqualFold(s, item) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetAzureLoadBalancerNameMultiSLB(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = loadBalancerSkuStandard
+	az.MultipleStandardLoadBalancerConfigurations = []MultipleStandardLoadBalancerConfiguration{
+		{
+			Name:              "lb-a",
+			ServiceNamespaces: []string{"team-a"},
+		},
+		{
+			Name:              "lb-b",
+			ServiceNamespaces: []string{"team-b"},
+		},
+	}
+
+	testCases := []struct {
+		desc       string
+		namespace  string
+		isInternal bool
+		expected   string
+	}{
+		{
+			desc:      "services in a claimed namespace shall land on the configured load balancer",
+			namespace: "team-a",
+			expected:  "lb-a",
+		},
+		{
+			desc:       "internal services shall get the internal variant of the configured load balancer",
+			namespace:  "team-b",
+			isInternal: true,
+			expected:   "lb-b-internal",
+		},
+		{
+			desc:      "services in an unclaimed namespace shall land on the default cluster load balancer",
+			namespace: "default",
+			expected:  "testCluster",
+		},
+	}
+
+	for _, test := range testCases {
+		svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+		svc.Namespace = test.namespace
+		lbName := az.getAzureLoadBalancerName(&svc, testClusterName, "as", test.isInternal)
+		assert.Equal(t, test.expected, lbName, test.desc)
+	}
+}
+
+func TestFilterNodesForLoadBalancer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = loadBalancerSkuStandard
+	az.MultipleStandardLoadBalancerConfigurations = []MultipleStandardLoadBalancerConfiguration{
+		{
+			Name:       "lb-a",
+			VMSetNames: []string{"vmss-a"},
+		},
+		{
+			Name: "lb-b",
+		},
+	}
+
+	buildNode := func(name, vmssName string) *v1.Node {
+		node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if vmssName != "" {
+			node.Spec.ProviderID = "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/" + vmssName + "/virtualMachines/0"
+		}
+		return node
+	}
+	nodes := []*v1.Node{
+		buildNode("node-a", "vmss-a"),
+		buildNode("node-b", "vmss-b"),
+		buildNode("node-c", ""),
+	}
+
+	// Only nodes of the claimed VM set stay, plus nodes whose VM set cannot
+	// be derived from the provider ID.
+	filtered := az.filterNodesForLoadBalancer("lb-a", nodes)
+	assert.Len(t, filtered, 2)
+	assert.Equal(t, "node-a", filtered[0].Name)
+	assert.Equal(t, "node-c", filtered[1].Name)
+
+	// The internal load balancer variant maps to the same configuration.
+	assert.Len(t, az.filterNodesForLoadBalancer("lb-a-internal", nodes), 2)
+
+	// Configurations without VMSetNames keep all nodes.
+	assert.Len(t, az.filterNodesForLoadBalancer("lb-b", nodes), 3)
+
+	// Unknown load balancers and the single-SLB mode keep all nodes.
+	assert.Len(t, az.filterNodesForLoadBalancer("testCluster", nodes), 3)
+	az.MultipleStandardLoadBalancerConfigurations = nil
+	assert.Len(t, az.filterNodesForLoadBalancer("lb-a", nodes), 3)
+}
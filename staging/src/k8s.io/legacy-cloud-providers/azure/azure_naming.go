@@ -0,0 +1,93 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// ResourceNamer controls how the Azure resources managed for a service are
+// named. Deployments embedding this package can replace the built-in naming
+// through SetResourceNamer to adopt pre-existing brownfield resources without
+// renaming them. Implementations must be deterministic: the same service must
+// always map to the same names.
+type ResourceNamer interface {
+	// ServiceResourceBaseName returns the base name that frontend IP
+	// configurations, load balancing rules, probes and inbound NAT rules of
+	// the service are derived from.
+	ServiceResourceBaseName(service *v1.Service) string
+
+	// LoadBalancerName returns the name of the load balancer carrying the
+	// service. vmSetName is the availability set or scale set the load
+	// balancer is dedicated to with the basic SKU.
+	LoadBalancerName(service *v1.Service, clusterName, vmSetName string, isInternal bool) string
+
+	// BackendPoolName returns the name of the backend pool of the service on
+	// its load balancer.
+	BackendPoolName(clusterName string, service *v1.Service) string
+
+	// PublicIPName returns the name of the public IP created for the
+	// service when no bring-your-own public IP is referenced.
+	PublicIPName(clusterName string, service *v1.Service) string
+}
+
+// OwnershipResolver decides whether an existing Azure resource is managed for
+// a given service. Deployments embedding this package can replace the
+// built-in checks through SetOwnershipResolver when brownfield resources do
+// not follow the provider's naming and tagging conventions. Resources the
+// resolver does not claim for any service are left untouched by reconciles.
+type OwnershipResolver interface {
+	// OwnsRule returns whether the load balancing rule, probe or inbound NAT
+	// rule with the given name is managed for the service.
+	OwnsRule(service *v1.Service, ruleName string) bool
+
+	// OwnsFrontendIP returns whether the frontend IP configuration is
+	// managed for the service.
+	OwnsFrontendIP(fip network.FrontendIPConfiguration, service *v1.Service) bool
+
+	// OwnsPublicIP returns whether the public IP is managed for the service
+	// of the given cluster.
+	OwnsPublicIP(pip *network.PublicIPAddress, clusterName, serviceName string) bool
+}
+
+// SetResourceNamer replaces the built-in naming of service resources. It must
+// be called before the cloud provider starts reconciling services; changing
+// the namer afterwards orphans the resources created under the old names.
+func (az *Cloud) SetResourceNamer(namer ResourceNamer) {
+	az.resourceNamer = namer
+}
+
+// SetOwnershipResolver replaces the built-in ownership checks on existing
+// Azure resources. It must be called before the cloud provider starts
+// reconciling services.
+func (az *Cloud) SetOwnershipResolver(resolver OwnershipResolver) {
+	az.ownershipResolver = resolver
+}
+
+// ownsPublicIP returns whether the public IP is managed for the service,
+// consulting the ownership resolver when one is set and falling back to the
+// built-in tag based check otherwise.
+func (az *Cloud) ownsPublicIP(pip *network.PublicIPAddress, clusterName, serviceName string) bool {
+	if az.ownershipResolver != nil {
+		return az.ownershipResolver.OwnsPublicIP(pip, clusterName, serviceName)
+	}
+	return serviceOwnsPublicIP(pip, clusterName, serviceName)
+}
@@ -0,0 +1,103 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+type fakeResourceNamer struct{}
+
+func (fakeResourceNamer) ServiceResourceBaseName(service *v1.Service) string {
+	return "custom-" + service.Name
+}
+
+func (fakeResourceNamer) LoadBalancerName(service *v1.Service, clusterName, vmSetName string, isInternal bool) string {
+	return "custom-lb"
+}
+
+func (fakeResourceNamer) BackendPoolName(clusterName string, service *v1.Service) string {
+	return "custom-pool"
+}
+
+func (fakeResourceNamer) PublicIPName(clusterName string, service *v1.Service) string {
+	return "custom-pip"
+}
+
+type fakeOwnershipResolver struct{}
+
+func (fakeOwnershipResolver) OwnsRule(service *v1.Service, ruleName string) bool {
+	return ruleName == "brownfield-rule"
+}
+
+func (fakeOwnershipResolver) OwnsFrontendIP(fip network.FrontendIPConfiguration, service *v1.Service) bool {
+	return to.String(fip.Name) == "brownfield-fip"
+}
+
+func (fakeOwnershipResolver) OwnsPublicIP(pip *network.PublicIPAddress, clusterName, serviceName string) bool {
+	return to.String(pip.Name) == "brownfield-pip"
+}
+
+func TestSetResourceNamer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+
+	// Without a namer the built-in naming applies.
+	assert.Equal(t, "aservice1", az.GetLoadBalancerName(context.TODO(), testClusterName, &svc))
+	assert.Equal(t, testClusterName, az.getBackendPoolName(testClusterName, &svc))
+
+	az.SetResourceNamer(fakeResourceNamer{})
+	assert.Equal(t, "custom-service1", az.GetLoadBalancerName(context.TODO(), testClusterName, &svc))
+	assert.Equal(t, "custom-lb", az.getAzureLoadBalancerName(&svc, testClusterName, "as", false))
+	assert.Equal(t, "custom-pool", az.getBackendPoolName(testClusterName, &svc))
+	assert.Equal(t, "custom-pip", az.getPublicIPName(testClusterName, &svc))
+}
+
+func TestSetOwnershipResolver(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	fip := network.FrontendIPConfiguration{Name: to.StringPtr("brownfield-fip")}
+	pip := network.PublicIPAddress{Name: to.StringPtr("brownfield-pip")}
+
+	// Without a resolver the built-in prefix and tag checks apply.
+	assert.False(t, az.serviceOwnsRule(&svc, "brownfield-rule"))
+	assert.True(t, az.serviceOwnsRule(&svc, "aservice1-TCP-80"))
+	assert.False(t, az.serviceOwnsFrontendIP(fip, &svc))
+	assert.False(t, az.ownsPublicIP(&pip, testClusterName, "default/service1"))
+
+	az.SetOwnershipResolver(fakeOwnershipResolver{})
+	assert.True(t, az.serviceOwnsRule(&svc, "brownfield-rule"))
+	assert.False(t, az.serviceOwnsRule(&svc, "aservice1-TCP-80"))
+	assert.True(t, az.serviceOwnsFrontendIP(fip, &svc))
+	assert.True(t, az.ownsPublicIP(&pip, testClusterName, "default/service1"))
+}
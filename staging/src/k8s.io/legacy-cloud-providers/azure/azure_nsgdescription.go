@@ -0,0 +1,114 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// securityRuleDescriptionMarker starts the description of every security rule
+// the provider generates, so descriptions written by operators are never
+// mistaken for ownership metadata.
+const securityRuleDescriptionMarker = "k8s-azure-service"
+
+// securityRuleTimeNow is the clock used for the generation timestamp in rule
+// descriptions, replaced in tests that pin rendered payloads.
+var securityRuleTimeNow = time.Now
+
+// securityRuleOwnership is the ownership metadata parsed back from the
+// description of a generated security rule.
+type securityRuleOwnership struct {
+	uid       string
+	namespace string
+	name      string
+	createdAt time.Time
+}
+
+// buildSecurityRuleDescription returns the description stamped on security
+// rules generated for the service: its UID, namespace/name and the generation
+// timestamp. The description is authoritative for ownership during cleanup,
+// so renaming schemes cannot orphan or misattribute rules.
+func buildSecurityRuleDescription(service *v1.Service) string {
+	return fmt.Sprintf("%s uid=%s service=%s/%s created=%s",
+		securityRuleDescriptionMarker,
+		service.UID,
+		service.Namespace,
+		service.Name,
+		securityRuleTimeNow().UTC().Format(time.RFC3339))
+}
+
+// parseSecurityRuleDescription parses the ownership metadata out of a security
+// rule description. It returns false for descriptions this provider did not
+// generate.
+func parseSecurityRuleDescription(description string) (*securityRuleOwnership, bool) {
+	fields := strings.Fields(description)
+	if len(fields) == 0 || fields[0] != securityRuleDescriptionMarker {
+		return nil, false
+	}
+
+	ownership := &securityRuleOwnership{}
+	for _, field := range fields[1:] {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch parts[0] {
+		case "uid":
+			ownership.uid = parts[1]
+		case "service":
+			namespacedName := strings.SplitN(parts[1], "/", 2)
+			if len(namespacedName) == 2 {
+				ownership.namespace = namespacedName[0]
+				ownership.name = namespacedName[1]
+			}
+		case "created":
+			if createdAt, err := time.Parse(time.RFC3339, parts[1]); err == nil {
+				ownership.createdAt = createdAt
+			}
+		}
+	}
+	if ownership.uid == "" && ownership.name == "" {
+		return nil, false
+	}
+	return ownership, true
+}
+
+// serviceOwnsSecurityRule reports whether the security rule was generated for
+// the service. The ownership metadata in the rule description is
+// authoritative when present; rules created before descriptions were stamped
+// fall back to the rule name prefix heuristic. A rule whose description names
+// the same namespace/name is owned even when the UID differs, so rules left
+// behind by a deleted and recreated service are still cleaned up.
+func (az *Cloud) serviceOwnsSecurityRule(service *v1.Service, rule network.SecurityRule) bool {
+	if rule.SecurityRulePropertiesFormat != nil && rule.Description != nil {
+		if ownership, ok := parseSecurityRuleDescription(*rule.Description); ok {
+			if ownership.uid == string(service.UID) {
+				return true
+			}
+			return ownership.namespace == service.Namespace && ownership.name == service.Name
+		}
+	}
+	return az.serviceOwnsRule(service, *rule.Name)
+}
@@ -0,0 +1,118 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestBuildAndParseSecurityRuleDescription(t *testing.T) {
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	svc.Namespace = "default"
+
+	description := buildSecurityRuleDescription(&svc)
+	ownership, ok := parseSecurityRuleDescription(description)
+	assert.True(t, ok)
+	assert.Equal(t, string(svc.UID), ownership.uid)
+	assert.Equal(t, "default", ownership.namespace)
+	assert.Equal(t, "service1", ownership.name)
+	assert.False(t, ownership.createdAt.IsZero())
+
+	testCases := []struct {
+		desc        string
+		description string
+	}{
+		{"an empty description shall not parse", ""},
+		{"an operator-written description shall not parse", "allow office traffic"},
+		{"a marker without metadata shall not parse", "k8s-azure-service"},
+	}
+	for _, test := range testCases {
+		_, ok := parseSecurityRuleDescription(test.description)
+		assert.False(t, ok, test.desc)
+	}
+}
+
+func TestServiceOwnsSecurityRule(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	svc.Namespace = "default"
+	other := getTestService("service2", v1.ProtocolTCP, nil, false, 80)
+	other.Namespace = "default"
+
+	ruleWithDescription := func(description string) network.SecurityRule {
+		return network.SecurityRule{
+			Name: to.StringPtr("aservice1-TCP-80-Internet"),
+			SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+				Description: to.StringPtr(description),
+			},
+		}
+	}
+
+	// The description is authoritative when present.
+	assert.True(t, az.serviceOwnsSecurityRule(&svc, ruleWithDescription(buildSecurityRuleDescription(&svc))))
+	assert.False(t, az.serviceOwnsSecurityRule(&svc, ruleWithDescription(buildSecurityRuleDescription(&other))))
+
+	// A rule left behind by a deleted and recreated service matches on
+	// namespace/name even though the UID differs.
+	recreated := svc.DeepCopy()
+	recreated.UID = "other-uid"
+	assert.True(t, az.serviceOwnsSecurityRule(recreated, ruleWithDescription(buildSecurityRuleDescription(&svc))))
+
+	// Rules without provider metadata fall back to the name prefix heuristic.
+	legacyRule := network.SecurityRule{
+		Name:                         to.StringPtr("aservice1-TCP-80-Internet"),
+		SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{},
+	}
+	assert.True(t, az.serviceOwnsSecurityRule(&svc, legacyRule))
+	assert.False(t, az.serviceOwnsSecurityRule(&other, legacyRule))
+}
+
+func TestReconcileSecurityGroupRuleDescription(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	svc.Namespace = "default"
+
+	sg := getTestSecurityGroup(az)
+	setMockSecurityGroup(az, ctrl, sg)
+
+	sg, err := az.reconcileSecurityGroup(testClusterName, &svc, to.StringPtr("1.2.3.4"), true)
+	assert.NoError(t, err)
+
+	_, rule, found := findSecurityRuleByName(*sg.SecurityRules, "aservice1-TCP-80-Internet")
+	if assert.True(t, found, "expected the security rule to be present") {
+		ownership, ok := parseSecurityRuleDescription(to.String(rule.Description))
+		assert.True(t, ok, "expected the rule description to carry ownership metadata")
+		assert.Equal(t, string(svc.UID), ownership.uid)
+		assert.Equal(t, "default", ownership.namespace)
+		assert.Equal(t, "service1", ownership.name)
+	}
+}
@@ -0,0 +1,150 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"k8s.io/legacy-cloud-providers/azure/metrics"
+)
+
+// runSharedRuleGC removes the destinations of shared security rules
+// (ServiceAnnotationSharedSecurityRule) whose owning service no longer
+// exists. A shared rule normally loses a destination when its service is
+// deleted through the provider, but deletions the provider never observed,
+// e.g. a service removed while the controller manager was down, leave the
+// destination behind and keep its port reachable. Shared rules left without
+// any destination are deleted as a whole.
+func (az *Cloud) runSharedRuleGC() {
+	if az.KubeClient == nil {
+		return
+	}
+	clusterName := az.getRecordedClusterName()
+	if az.SharedVNetCoordination && clusterName == "" {
+		// Until a load balancer call has been observed the shared rules of
+		// this cluster cannot be told apart from those of other clusters.
+		return
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	services, err := az.KubeClient.CoreV1().Services("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		klog.Errorf("runSharedRuleGC: failed to list services: %v", err)
+		return
+	}
+
+	// The ingress IPs recorded on the LoadBalancer services are the
+	// destinations still owned by a service.
+	liveDestinations := sets.NewString()
+	for i := range services.Items {
+		service := &services.Items[i]
+		if service.Spec.Type != v1.ServiceTypeLoadBalancer {
+			continue
+		}
+		if len(service.Status.LoadBalancer.Ingress) == 0 && service.DeletionTimestamp == nil {
+			// The service may already hold a destination through an in-flight
+			// reconcile before its ingress IP is recorded in the status.
+			// Collecting in that window would strip a destination that is
+			// about to be used, so the sweep waits for the churn to settle.
+			klog.V(4).Infof("runSharedRuleGC: service %s has no ingress IP yet, skipping this cycle", getServiceName(service))
+			return
+		}
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			if ingress.IP != "" {
+				liveDestinations.Insert(ingress.IP)
+			}
+		}
+	}
+
+	op := az.nsgUpdater.addUpdateOperation(nil, func(sg *network.SecurityGroup) (bool, error) {
+		return az.gcSharedRules(clusterName, sg, liveDestinations)
+	})
+	if err := op.wait(); err != nil {
+		klog.Errorf("runSharedRuleGC: failed to update security group: %v", err)
+	}
+}
+
+// gcSharedRules drops every destination of this cluster's shared security
+// rules that is not an ingress IP of an existing LoadBalancer service, and
+// removes shared rules left without destinations. It reports whether it
+// changed the security group.
+func (az *Cloud) gcSharedRules(clusterName string, sg *network.SecurityGroup, liveDestinations sets.String) (bool, error) {
+	if sg.SecurityGroupPropertiesFormat == nil || sg.SecurityRules == nil {
+		return false, nil
+	}
+
+	prefix := az.sharedResourcePrefix(clusterName)
+	updatedRules := *sg.SecurityRules
+	dirtySg := false
+	removedDestinations := 0
+	removedRules := 0
+	for i := len(updatedRules) - 1; i >= 0; i-- {
+		rule := updatedRules[i]
+		ruleName := to.String(rule.Name)
+		if !strings.HasPrefix(strings.TrimPrefix(ruleName, prefix), "shared") {
+			continue
+		}
+		if az.ownedByOtherCluster(clusterName, ruleName) {
+			continue
+		}
+		if rule.SecurityRulePropertiesFormat == nil || rule.DestinationAddressPrefixes == nil {
+			continue
+		}
+
+		keptDestinations := []string{}
+		for _, destination := range *rule.DestinationAddressPrefixes {
+			if liveDestinations.Has(destination) {
+				keptDestinations = append(keptDestinations, destination)
+			}
+		}
+		removed := len(*rule.DestinationAddressPrefixes) - len(keptDestinations)
+		if removed == 0 {
+			continue
+		}
+
+		removedDestinations += removed
+		dirtySg = true
+		if len(keptDestinations) == 0 {
+			klog.V(2).Infof("runSharedRuleGC: removing shared rule %s, all of its destinations are stale", ruleName)
+			updatedRules = append(updatedRules[:i], updatedRules[i+1:]...)
+			removedRules++
+			continue
+		}
+		klog.V(2).Infof("runSharedRuleGC: removing %d stale destination(s) from shared rule %s", removed, ruleName)
+		rule.DestinationAddressPrefixes = &keptDestinations
+		updatedRules[i] = rule
+	}
+
+	if !dirtySg {
+		return false, nil
+	}
+
+	sg.SecurityRules = &updatedRules
+	metrics.SharedRuleGCRemoved("destination", float64(removedDestinations))
+	metrics.SharedRuleGCRemoved("rule", float64(removedRules))
+	return true, nil
+}
@@ -0,0 +1,147 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	fakeclient "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/legacy-cloud-providers/azure/clients/securitygroupclient/mocksecuritygroupclient"
+)
+
+func TestRunSharedRuleGC(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+
+	svc := getTestService("test1", v1.ProtocolTCP, map[string]string{ServiceAnnotationSharedSecurityRule: "true"}, false, 80)
+	svc.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: "1.2.3.4"}}
+	az.KubeClient = fakeclient.NewSimpleClientset(&svc)
+
+	sg := network.SecurityGroup{
+		Name: to.StringPtr("nsg"),
+		SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+			SecurityRules: &[]network.SecurityRule{
+				{
+					Name: to.StringPtr("shared-TCP-80-Internet"),
+					SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+						DestinationAddressPrefixes: to.StringSlicePtr([]string{"1.2.3.4", "2.3.4.5"}),
+					},
+				},
+				{
+					Name: to.StringPtr("shared-TCP-443-Internet"),
+					SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+						DestinationAddressPrefixes: to.StringSlicePtr([]string{"9.9.9.9"}),
+					},
+				},
+				{
+					Name: to.StringPtr("aother-TCP-80-Internet"),
+					SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+						DestinationAddressPrefix: to.StringPtr("9.9.9.9"),
+					},
+				},
+			},
+		},
+	}
+
+	var updatedSg network.SecurityGroup
+	mockSGsClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+	mockSGsClient.EXPECT().Get(gomock.Any(), "rg", "nsg", gomock.Any()).Return(sg, nil).Times(1)
+	mockSGsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "nsg", gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, resourceGroupName, securityGroupName string, parameters network.SecurityGroup, etag string) error {
+			updatedSg = parameters
+			return nil
+		}).Times(1)
+
+	az.runSharedRuleGC()
+
+	rules := *updatedSg.SecurityRules
+	assert.Len(t, rules, 2)
+	// The stale destination is dropped, the owned one stays.
+	assert.Equal(t, "shared-TCP-80-Internet", to.String(rules[0].Name))
+	assert.Equal(t, []string{"1.2.3.4"}, *rules[0].DestinationAddressPrefixes)
+	// The shared rule without any live destination is removed; rules not
+	// marked as shared are left alone.
+	assert.Equal(t, "aother-TCP-80-Internet", to.String(rules[1].Name))
+	assert.Equal(t, "9.9.9.9", to.String(rules[1].DestinationAddressPrefix))
+}
+
+func TestRunSharedRuleGCWaitsForPendingServices(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+
+	// A LoadBalancer service without a recorded ingress IP may already hold a
+	// shared rule destination through an in-flight reconcile, so no security
+	// group calls shall be made.
+	svc := getTestService("test1", v1.ProtocolTCP, map[string]string{ServiceAnnotationSharedSecurityRule: "true"}, false, 80)
+	az.KubeClient = fakeclient.NewSimpleClientset(&svc)
+
+	az.runSharedRuleGC()
+}
+
+func TestGCSharedRulesSkipsOtherClusters(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.SharedVNetCoordination = true
+
+	ourPrefix := az.sharedResourcePrefix(testClusterName)
+	otherPrefix := az.sharedResourcePrefix("othercluster")
+	sg := network.SecurityGroup{
+		Name: to.StringPtr("nsg"),
+		SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+			SecurityRules: &[]network.SecurityRule{
+				{
+					Name: to.StringPtr(ourPrefix + "shared-TCP-80-Internet"),
+					SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+						DestinationAddressPrefixes: to.StringSlicePtr([]string{"9.9.9.9"}),
+					},
+				},
+				{
+					Name: to.StringPtr(otherPrefix + "shared-TCP-80-Internet"),
+					SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+						DestinationAddressPrefixes: to.StringSlicePtr([]string{"9.9.9.9"}),
+					},
+				},
+			},
+		},
+	}
+
+	dirty, err := az.gcSharedRules(testClusterName, &sg, sets.NewString())
+	assert.NoError(t, err)
+	assert.True(t, dirty)
+
+	// Only this cluster's shared rule is collected; the one carrying another
+	// cluster's coordination prefix is not touched.
+	rules := *sg.SecurityRules
+	assert.Len(t, rules, 1)
+	assert.Equal(t, otherPrefix+"shared-TCP-80-Internet", to.String(rules[0].Name))
+}
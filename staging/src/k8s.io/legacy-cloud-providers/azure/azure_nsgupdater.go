@@ -0,0 +1,160 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	azcache "k8s.io/legacy-cloud-providers/azure/cache"
+)
+
+const (
+	// nsgUpdateInterval defines the security group batching interval. Every
+	// service sync waits on it, so it is kept short; it only needs to be wide
+	// enough for concurrent reconciles to coalesce into a single PUT.
+	nsgUpdateInterval = 2 * time.Second
+)
+
+// nsgUpdateFunc mutates the given security group in place and reports whether
+// it changed anything. It runs against the security group state that already
+// carries the mutations queued before it, so concurrent reconciles cannot
+// overwrite each other's rule additions and removals.
+type nsgUpdateFunc func(sg *network.SecurityGroup) (bool, error)
+
+// delayedNsgOperation defines a delayed security group mutation which is used
+// in delayedNsgUpdater.
+type delayedNsgOperation struct {
+	service *v1.Service
+	update  nsgUpdateFunc
+	result  chan error
+}
+
+// wait waits for the operation completion and returns the result.
+func (op *delayedNsgOperation) wait() error {
+	return <-op.result
+}
+
+// delayedNsgUpdater serializes security group mutations and batches all the
+// mutations within "interval" period into a single PUT. Without it, the
+// read-modify-write cycles of concurrently deleted services race and the last
+// writer wins, leaving the allow rules of other services orphaned.
+type delayedNsgUpdater struct {
+	az       *Cloud
+	interval time.Duration
+
+	lock         sync.Mutex
+	nsgsToUpdate []*delayedNsgOperation
+}
+
+// newDelayedNsgUpdater creates a new delayedNsgUpdater.
+func newDelayedNsgUpdater(az *Cloud, interval time.Duration) *delayedNsgUpdater {
+	return &delayedNsgUpdater{
+		az:           az,
+		interval:     interval,
+		nsgsToUpdate: make([]*delayedNsgOperation, 0),
+	}
+}
+
+// run starts the updater reconciling loop.
+func (d *delayedNsgUpdater) run() {
+	err := wait.PollImmediateInfinite(d.interval, func() (bool, error) {
+		d.updateNsg()
+		return false, nil
+	})
+	if err != nil { // this should never happen, if it does, panic
+		panic(err)
+	}
+}
+
+// updateNsg applies the queued mutations to the security group sequentially
+// and writes the result with one PUT.
+func (d *delayedNsgUpdater) updateNsg() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	// No need to do any updating.
+	if len(d.nsgsToUpdate) == 0 {
+		return
+	}
+
+	ops := d.nsgsToUpdate
+	d.nsgsToUpdate = make([]*delayedNsgOperation, 0)
+
+	sg, err := d.az.getSecurityGroup(azcache.CacheReadTypeDefault)
+	if err != nil {
+		klog.Errorf("updateNsg: getSecurityGroup() failed with error: %v", err)
+		for _, op := range ops {
+			op.result <- err
+		}
+		return
+	}
+
+	// Mutations failing on their own only fail their operation; the rest of
+	// the batch is still written.
+	dirty := false
+	applied := make([]*delayedNsgOperation, 0, len(ops))
+	for _, op := range ops {
+		opDirty, opErr := op.update(&sg)
+		if opErr != nil {
+			op.result <- opErr
+			continue
+		}
+		dirty = dirty || opDirty
+		applied = append(applied, op)
+	}
+
+	err = nil
+	if dirty {
+		klog.V(2).Infof("updateNsg: updating security group %s with %d batched operations", *sg.Name, len(applied))
+		err = d.az.CreateOrUpdateSecurityGroup(nil, sg)
+		if err != nil {
+			klog.Errorf("updateNsg: CreateOrUpdateSecurityGroup(%s) failed with error: %v", *sg.Name, err)
+			// The shared PUT carries no single owner; each waiting service
+			// gets the failure on its own event stream.
+			for _, op := range applied {
+				d.az.Event(op.service, v1.EventTypeWarning, "CreateOrUpdateSecurityGroup", err.Error())
+			}
+		}
+	}
+
+	// Notify all the goroutines.
+	for _, op := range applied {
+		op.result <- err
+	}
+}
+
+// addUpdateOperation adds the security group mutation to the updater queue.
+func (d *delayedNsgUpdater) addUpdateOperation(service *v1.Service, update nsgUpdateFunc) *delayedNsgOperation {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	op := &delayedNsgOperation{
+		service: service,
+		update:  update,
+		result:  make(chan error, 1),
+	}
+	d.nsgsToUpdate = append(d.nsgsToUpdate, op)
+	return op
+}
@@ -0,0 +1,119 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/legacy-cloud-providers/azure/clients/securitygroupclient/mocksecuritygroupclient"
+)
+
+func TestUpdateNsgBatchesOperations(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	updater := newDelayedNsgUpdater(az, time.Hour)
+
+	sg := network.SecurityGroup{
+		Name: to.StringPtr("nsg"),
+		SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+			SecurityRules: &[]network.SecurityRule{
+				{Name: to.StringPtr("rule1")},
+				{Name: to.StringPtr("rule2")},
+			},
+		},
+	}
+
+	var updatedSg network.SecurityGroup
+	mockSGsClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+	mockSGsClient.EXPECT().Get(gomock.Any(), "rg", "nsg", gomock.Any()).Return(sg, nil).Times(1)
+	mockSGsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "nsg", gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, resourceGroupName, securityGroupName string, parameters network.SecurityGroup, etag string) error {
+			updatedSg = parameters
+			return nil
+		}).Times(1)
+
+	// Two queued mutations against the same security group land in a single
+	// PUT carrying both of them.
+	removeRule := func(name string) nsgUpdateFunc {
+		return func(sg *network.SecurityGroup) (bool, error) {
+			rules := *sg.SecurityRules
+			for i := range rules {
+				if to.String(rules[i].Name) == name {
+					rules = append(rules[:i], rules[i+1:]...)
+					sg.SecurityRules = &rules
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+	}
+	op1 := updater.addUpdateOperation(nil, removeRule("rule1"))
+	op2 := updater.addUpdateOperation(nil, removeRule("rule2"))
+
+	updater.updateNsg()
+	assert.NoError(t, op1.wait())
+	assert.NoError(t, op2.wait())
+	assert.Empty(t, *updatedSg.SecurityRules)
+
+	// The queue is drained afterwards.
+	updater.updateNsg()
+}
+
+func TestUpdateNsgReportsOperationErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	updater := newDelayedNsgUpdater(az, time.Hour)
+
+	sg := network.SecurityGroup{
+		Name: to.StringPtr("nsg"),
+		SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+			SecurityRules: &[]network.SecurityRule{},
+		},
+	}
+
+	mockSGsClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+	mockSGsClient.EXPECT().Get(gomock.Any(), "rg", "nsg", gomock.Any()).Return(sg, nil).Times(1)
+	mockSGsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "nsg", gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+	// A failing mutation only fails its own operation; the rest of the batch
+	// is still written.
+	failingOp := updater.addUpdateOperation(nil, func(sg *network.SecurityGroup) (bool, error) {
+		return false, fmt.Errorf("conflicting rule")
+	})
+	dirtyOp := updater.addUpdateOperation(nil, func(sg *network.SecurityGroup) (bool, error) {
+		sg.SecurityRules = &[]network.SecurityRule{{Name: to.StringPtr("rule1")}}
+		return true, nil
+	})
+
+	updater.updateNsg()
+	assert.EqualError(t, failingOp.wait(), "conflicting rule")
+	assert.NoError(t, dirtyOp.wait())
+}
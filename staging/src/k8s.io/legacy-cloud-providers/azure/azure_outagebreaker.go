@@ -0,0 +1,111 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/legacy-cloud-providers/azure/metrics"
+)
+
+// armOutageSuspectedEventReason is the reason of the warning event emitted
+// when the ARM outage breaker opens.
+const armOutageSuspectedEventReason = "ARMOutageSuspected"
+
+// armOutageBreaker guards instance existence checks against widespread ARM
+// errors. During an ARM outage lookups can falsely report instances as
+// missing, which would make the node lifecycle controller delete healthy
+// nodes. Once the number of ARM errors within a one-minute window crosses the
+// configured threshold the breaker opens for a cooldown, during which
+// existence checks report an error (so the controller retries) instead of a
+// definite not-found answer.
+type armOutageBreaker struct {
+	lock sync.Mutex
+	// threshold is the number of ARM errors within the window that opens the
+	// breaker. Zero disables the breaker.
+	threshold   int
+	cooldown    time.Duration
+	windowStart time.Time
+	errors      int
+	openUntil   time.Time
+}
+
+// newARMOutageBreaker builds an outage breaker with the given error threshold
+// and cooldown.
+func newARMOutageBreaker(threshold int, cooldown time.Duration) *armOutageBreaker {
+	return &armOutageBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// recordError counts one ARM error and reports whether this error opened the
+// breaker.
+func (b *armOutageBreaker) recordError() bool {
+	if b == nil || b.threshold <= 0 {
+		return false
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := time.Now()
+	if now.Sub(b.windowStart) >= time.Minute {
+		b.windowStart = now
+		b.errors = 0
+	}
+
+	b.errors++
+	if b.errors >= b.threshold && !now.Before(b.openUntil) {
+		b.openUntil = now.Add(b.cooldown)
+		metrics.ARMOutageBreakerOpened()
+		return true
+	}
+
+	return false
+}
+
+// isOpen reports whether the breaker is within its cooldown.
+func (b *armOutageBreaker) isOpen() bool {
+	if b == nil || b.threshold <= 0 {
+		return false
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return time.Now().Before(b.openUntil)
+}
+
+// reportInstanceCheckError feeds one ARM error from an instance existence
+// check into the outage breaker. When the error opens the breaker, a warning
+// event is emitted on the node (when its name is known) so operators can tell
+// node lifecycle stalls apart from genuine deletions.
+func (az *Cloud) reportInstanceCheckError(nodeName string, err error) {
+	if !az.outageBreaker.recordError() {
+		return
+	}
+
+	message := fmt.Sprintf("ARM error rate crossed the outage threshold, treating instance existence checks as unknown for %v: %v", az.outageBreaker.cooldown, err)
+	klog.Warning(message)
+	if nodeName != "" {
+		az.Event(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: nodeName}}, v1.EventTypeWarning, armOutageSuspectedEventReason, message)
+	}
+}
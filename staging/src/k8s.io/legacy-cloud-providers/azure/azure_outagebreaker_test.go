@@ -0,0 +1,73 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-12-01/compute"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/legacy-cloud-providers/azure/clients/vmclient/mockvmclient"
+	"k8s.io/legacy-cloud-providers/azure/retry"
+)
+
+func TestARMOutageBreaker(t *testing.T) {
+	disabled := newARMOutageBreaker(0, time.Minute)
+	assert.False(t, disabled.recordError(), "disabled breaker should never open")
+	assert.False(t, disabled.isOpen(), "disabled breaker should never report open")
+
+	breaker := newARMOutageBreaker(2, time.Minute)
+	assert.False(t, breaker.isOpen(), "breaker should start closed")
+	assert.False(t, breaker.recordError(), "first error should not open the breaker")
+	assert.True(t, breaker.recordError(), "second error should open the breaker")
+	assert.True(t, breaker.isOpen(), "breaker should be open within the cooldown")
+	assert.False(t, breaker.recordError(), "errors while open should not re-open the breaker")
+
+	breaker.openUntil = time.Now().Add(-time.Second)
+	assert.False(t, breaker.isOpen(), "breaker should close once the cooldown elapsed")
+}
+
+func TestInstanceExistsDuringARMOutage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	providerID := "azure:///subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm1"
+	notFoundErr := &retry.Error{HTTPStatusCode: http.StatusNotFound, RawError: cloudprovider.InstanceNotFound}
+	mockVMsClient := az.VirtualMachinesClient.(*mockvmclient.MockInterface)
+	mockVMsClient.EXPECT().Get(gomock.Any(), "rg", "vm1", gomock.Any()).Return(compute.VirtualMachine{}, notFoundErr).AnyTimes()
+
+	// With the breaker closed a missing VM is a definite not-found answer.
+	exists, err := az.InstanceExistsByProviderID(context.Background(), providerID)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	// With the breaker open the same lookup must report an error so the node
+	// lifecycle controller retries instead of deleting the node.
+	az.outageBreaker = newARMOutageBreaker(1, time.Minute)
+	assert.True(t, az.outageBreaker.recordError())
+	exists, err = az.InstanceExistsByProviderID(context.Background(), providerID)
+	assert.Error(t, err)
+	assert.False(t, exists)
+}
@@ -0,0 +1,291 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// outboundManagementEnabled returns true when the provider manages an
+// outbound rule on the external cluster load balancer, either through a
+// number of managed outbound public IPs or through a public IP prefix. It is
+// never enabled with user defined routing, which keeps the load balancer
+// free of outbound configuration.
+func (az *Cloud) outboundManagementEnabled() bool {
+	if az.udrOutboundEnabled() {
+		return false
+	}
+	return az.ManagedOutboundIPCount > 0 || az.OutboundPublicIPPrefixID != ""
+}
+
+// getOutboundRuleName returns the name of the provider-managed outbound rule
+// on the cluster load balancer.
+func (az *Cloud) getOutboundRuleName(clusterName string) string {
+	return fmt.Sprintf("%s-outbound", clusterName)
+}
+
+// getOutboundFrontendConfigName returns the name of the i-th outbound
+// frontend IP configuration, or of the prefix-backed one when i is negative.
+func (az *Cloud) getOutboundFrontendConfigName(clusterName string, i int) string {
+	if i < 0 {
+		return fmt.Sprintf("%s-outbound-prefix", clusterName)
+	}
+	return fmt.Sprintf("%s-outbound-%d", clusterName, i)
+}
+
+// isManagedOutboundFrontendName reports whether the frontend IP configuration
+// name belongs to the provider-managed outbound configurations of the cluster.
+func isManagedOutboundFrontendName(clusterName, configName string) bool {
+	return strings.HasPrefix(strings.ToLower(configName), strings.ToLower(fmt.Sprintf("%s-outbound", clusterName)))
+}
+
+// ensureOutboundPublicIP ensures the i-th managed outbound public IP of the
+// cluster exists. Outbound public IPs are cluster scoped, live in the cluster
+// resource group and only carry the cluster tag, so the public IP cleanup of
+// deleted services never considers them.
+func (az *Cloud) ensureOutboundPublicIP(service *v1.Service, clusterName, pipName string) (*network.PublicIPAddress, error) {
+	pip, existsPip, err := az.getPublicIPAddress(az.ResourceGroup, pipName)
+	if err != nil {
+		return nil, err
+	}
+	if existsPip {
+		return &pip, nil
+	}
+
+	pip = network.PublicIPAddress{
+		Name:     to.StringPtr(pipName),
+		Location: to.StringPtr(az.Location),
+		Sku: &network.PublicIPAddressSku{
+			Name: network.PublicIPAddressSkuNameStandard,
+		},
+		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+			PublicIPAllocationMethod: network.Static,
+			PublicIPAddressVersion:   network.IPv4,
+		},
+		Tags: map[string]*string{
+			clusterNameKey: &clusterName,
+		},
+	}
+
+	klog.V(2).Infof("ensureOutboundPublicIP: pip(%s) - creating", pipName)
+	if err := az.CreateOrUpdatePIP(service, az.ResourceGroup, pip); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	pip, rerr := az.PublicIPAddressesClient.Get(ctx, az.ResourceGroup, pipName, "")
+	if rerr != nil {
+		return nil, rerr.Error()
+	}
+	return &pip, nil
+}
+
+// reconcileOutboundRule ensures the outbound rule of the cluster load
+// balancer matches the cloud config: its frontend IP configurations (managed
+// outbound public IPs or the configured public IP prefix), the SNAT ports
+// allocated per VM and the idle timeout. When outbound management is turned
+// off again, the provider-owned rule and frontends are removed. It returns
+// true when the load balancer was changed and needs to be updated.
+func (az *Cloud) reconcileOutboundRule(clusterName string, service *v1.Service, lb *network.LoadBalancer, lbBackendPoolID string) (bool, error) {
+	lbName := to.String(lb.Name)
+	lbResourceGroup := az.getLoadBalancerResourceGroup()
+	ruleName := az.getOutboundRuleName(clusterName)
+	dirty := false
+
+	newConfigs := []network.FrontendIPConfiguration{}
+	if lb.FrontendIPConfigurations != nil {
+		newConfigs = *lb.FrontendIPConfigurations
+	}
+
+	// Build the wanted outbound frontend IP configurations.
+	expectedConfigNames := []string{}
+	if az.outboundManagementEnabled() {
+		if az.OutboundPublicIPPrefixID != "" {
+			configName := az.getOutboundFrontendConfigName(clusterName, -1)
+			expectedConfigNames = append(expectedConfigNames, configName)
+			if !hasFrontendIPConfigName(newConfigs, configName) {
+				klog.V(2).Infof("reconcileOutboundRule: lb(%s) - adding frontend config %s for public IP prefix", lbName, configName)
+				newConfigs = append(newConfigs, network.FrontendIPConfiguration{
+					Name: to.StringPtr(configName),
+					FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+						PublicIPPrefix: &network.SubResource{ID: to.StringPtr(az.OutboundPublicIPPrefixID)},
+					},
+				})
+				dirty = true
+			}
+		} else {
+			for i := 0; i < az.ManagedOutboundIPCount; i++ {
+				configName := az.getOutboundFrontendConfigName(clusterName, i)
+				expectedConfigNames = append(expectedConfigNames, configName)
+				if hasFrontendIPConfigName(newConfigs, configName) {
+					continue
+				}
+				pip, err := az.ensureOutboundPublicIP(service, clusterName, fmt.Sprintf("%s-outbound-pip-%d", clusterName, i))
+				if err != nil {
+					return false, err
+				}
+				klog.V(2).Infof("reconcileOutboundRule: lb(%s) - adding frontend config %s", lbName, configName)
+				newConfigs = append(newConfigs, network.FrontendIPConfiguration{
+					Name: to.StringPtr(configName),
+					FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+						PublicIPAddress: &network.PublicIPAddress{ID: pip.ID},
+					},
+				})
+				dirty = true
+			}
+		}
+	}
+
+	// Drop managed outbound frontends that are no longer wanted, e.g. after
+	// lowering managedOutboundIPCount or switching to a public IP prefix.
+	for i := len(newConfigs) - 1; i >= 0; i-- {
+		configName := to.String(newConfigs[i].Name)
+		if isManagedOutboundFrontendName(clusterName, configName) && !stringInSliceFold(configName, expectedConfigNames) {
+			klog.V(2).Infof("reconcileOutboundRule: lb(%s) - dropping frontend config %s", lbName, configName)
+			newConfigs = append(newConfigs[:i], newConfigs[i+1:]...)
+			dirty = true
+		}
+	}
+	if dirty {
+		lb.FrontendIPConfigurations = &newConfigs
+	}
+
+	newOutboundRules := []network.OutboundRule{}
+	if lb.OutboundRules != nil {
+		newOutboundRules = *lb.OutboundRules
+	}
+
+	if !az.outboundManagementEnabled() {
+		for i := len(newOutboundRules) - 1; i >= 0; i-- {
+			if strings.EqualFold(to.String(newOutboundRules[i].Name), ruleName) {
+				klog.V(2).Infof("reconcileOutboundRule: lb(%s) - dropping outbound rule %s", lbName, ruleName)
+				newOutboundRules = append(newOutboundRules[:i], newOutboundRules[i+1:]...)
+				lb.OutboundRules = &newOutboundRules
+				dirty = true
+			}
+		}
+		return dirty, nil
+	}
+
+	frontendRefs := make([]network.SubResource, 0, len(expectedConfigNames))
+	for _, configName := range expectedConfigNames {
+		frontendRefs = append(frontendRefs, network.SubResource{
+			ID: to.StringPtr(az.getFrontendIPConfigID(lbName, lbResourceGroup, configName)),
+		})
+	}
+	expectedRule := network.OutboundRule{
+		Name: to.StringPtr(ruleName),
+		OutboundRulePropertiesFormat: &network.OutboundRulePropertiesFormat{
+			Protocol:                 network.LoadBalancerOutboundRuleProtocolAll,
+			AllocatedOutboundPorts:   to.Int32Ptr(int32(az.OutboundAllocatedPorts)),
+			FrontendIPConfigurations: &frontendRefs,
+			BackendAddressPool:       &network.SubResource{ID: to.StringPtr(lbBackendPoolID)},
+		},
+	}
+	if az.OutboundIdleTimeoutInMinutes != 0 {
+		expectedRule.IdleTimeoutInMinutes = to.Int32Ptr(int32(az.OutboundIdleTimeoutInMinutes))
+	}
+
+	foundRule := false
+	for i := range newOutboundRules {
+		if !strings.EqualFold(to.String(newOutboundRules[i].Name), ruleName) {
+			continue
+		}
+		foundRule = true
+		if !outboundRuleMatches(&newOutboundRules[i], &expectedRule) {
+			klog.V(2).Infof("reconcileOutboundRule: lb(%s) - updating outbound rule %s", lbName, ruleName)
+			newOutboundRules[i] = expectedRule
+			lb.OutboundRules = &newOutboundRules
+			dirty = true
+		}
+		break
+	}
+	if !foundRule {
+		klog.V(2).Infof("reconcileOutboundRule: lb(%s) - adding outbound rule %s", lbName, ruleName)
+		newOutboundRules = append(newOutboundRules, expectedRule)
+		lb.OutboundRules = &newOutboundRules
+		dirty = true
+	}
+
+	return dirty, nil
+}
+
+// hasFrontendIPConfigName reports whether the frontend IP configuration with
+// the given name exists in the collection.
+func hasFrontendIPConfigName(configs []network.FrontendIPConfiguration, configName string) bool {
+	for _, config := range configs {
+		if strings.EqualFold(to.String(config.Name), configName) {
+			return true
+		}
+	}
+	return false
+}
+
+// outboundRuleMatches compares the fields of an existing outbound rule the
+// provider manages against the expected rule.
+func outboundRuleMatches(existing, expected *network.OutboundRule) bool {
+	if existing.OutboundRulePropertiesFormat == nil {
+		return false
+	}
+	if existing.Protocol != expected.Protocol {
+		return false
+	}
+	if to.Int32(existing.AllocatedOutboundPorts) != to.Int32(expected.AllocatedOutboundPorts) {
+		return false
+	}
+	if to.Int32(existing.IdleTimeoutInMinutes) != to.Int32(expected.IdleTimeoutInMinutes) {
+		return false
+	}
+	if !strings.EqualFold(subResourceID(existing.BackendAddressPool), subResourceID(expected.BackendAddressPool)) {
+		return false
+	}
+
+	existingRefs := []string{}
+	if existing.FrontendIPConfigurations != nil {
+		for _, ref := range *existing.FrontendIPConfigurations {
+			existingRefs = append(existingRefs, to.String(ref.ID))
+		}
+	}
+	if len(existingRefs) != len(*expected.FrontendIPConfigurations) {
+		return false
+	}
+	for _, ref := range *expected.FrontendIPConfigurations {
+		if !stringInSliceFold(to.String(ref.ID), existingRefs) {
+			return false
+		}
+	}
+	return true
+}
+
+// subResourceID returns the ID of the sub resource reference, or an empty
+// string for a nil reference.
+func subResourceID(ref *network.SubResource) string {
+	if ref == nil {
+		return ""
+	}
+	return to.String(ref.ID)
+}
@@ -0,0 +1,216 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/legacy-cloud-providers/azure/clients/publicipclient/mockpublicipclient"
+	"k8s.io/legacy-cloud-providers/azure/retry"
+)
+
+func TestReconcileOutboundRule(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = loadBalancerSkuStandard
+	az.ManagedOutboundIPCount = 2
+	az.OutboundAllocatedPorts = 1024
+	az.OutboundIdleTimeoutInMinutes = 15
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+
+	mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	for _, pipName := range []string{"testCluster-outbound-pip-0", "testCluster-outbound-pip-1"} {
+		localPIPName := pipName
+		mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", localPIPName, gomock.Any()).Return(network.PublicIPAddress{}, &retry.Error{HTTPStatusCode: http.StatusNotFound}).Times(1)
+		mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", localPIPName, gomock.Any()).Return(nil).Times(1)
+		mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", localPIPName, gomock.Any()).Return(network.PublicIPAddress{
+			Name: to.StringPtr(localPIPName),
+			ID:   to.StringPtr("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/" + localPIPName),
+		}, nil).Times(1)
+	}
+
+	lb := network.LoadBalancer{
+		Name:                         to.StringPtr(testClusterName),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{},
+	}
+	backendPoolID := az.getBackendPoolID(testClusterName, "rg", testClusterName)
+
+	dirty, err := az.reconcileOutboundRule(testClusterName, &svc, &lb, backendPoolID)
+	assert.NoError(t, err)
+	assert.True(t, dirty)
+	assert.Len(t, *lb.FrontendIPConfigurations, 2)
+	assert.Len(t, *lb.OutboundRules, 1)
+	rule := (*lb.OutboundRules)[0]
+	assert.Equal(t, az.getOutboundRuleName(testClusterName), *rule.Name)
+	assert.Equal(t, int32(1024), *rule.AllocatedOutboundPorts)
+	assert.Equal(t, int32(15), *rule.IdleTimeoutInMinutes)
+	assert.Equal(t, network.LoadBalancerOutboundRuleProtocolAll, rule.Protocol)
+	assert.Equal(t, backendPoolID, *rule.BackendAddressPool.ID)
+	assert.Len(t, *rule.FrontendIPConfigurations, 2)
+
+	// A second reconciliation of the same load balancer is a no-op.
+	dirty, err = az.reconcileOutboundRule(testClusterName, &svc, &lb, backendPoolID)
+	assert.NoError(t, err)
+	assert.False(t, dirty)
+
+	// Lowering the count drops the stale frontend and shrinks the rule.
+	az.ManagedOutboundIPCount = 1
+	dirty, err = az.reconcileOutboundRule(testClusterName, &svc, &lb, backendPoolID)
+	assert.NoError(t, err)
+	assert.True(t, dirty)
+	assert.Len(t, *lb.FrontendIPConfigurations, 1)
+	assert.Len(t, *(*lb.OutboundRules)[0].FrontendIPConfigurations, 1)
+
+	// Turning outbound management off removes the rule and its frontends.
+	az.ManagedOutboundIPCount = 0
+	dirty, err = az.reconcileOutboundRule(testClusterName, &svc, &lb, backendPoolID)
+	assert.NoError(t, err)
+	assert.True(t, dirty)
+	assert.Len(t, *lb.FrontendIPConfigurations, 0)
+	assert.Len(t, *lb.OutboundRules, 0)
+}
+
+func TestReconcileOutboundRuleWithPrefix(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = loadBalancerSkuStandard
+	az.OutboundPublicIPPrefixID = "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/prefix1"
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+
+	lb := network.LoadBalancer{
+		Name:                         to.StringPtr(testClusterName),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{},
+	}
+	backendPoolID := az.getBackendPoolID(testClusterName, "rg", testClusterName)
+
+	dirty, err := az.reconcileOutboundRule(testClusterName, &svc, &lb, backendPoolID)
+	assert.NoError(t, err)
+	assert.True(t, dirty)
+	assert.Len(t, *lb.FrontendIPConfigurations, 1)
+	config := (*lb.FrontendIPConfigurations)[0]
+	assert.Equal(t, "testCluster-outbound-prefix", *config.Name)
+	assert.Equal(t, az.OutboundPublicIPPrefixID, *config.PublicIPPrefix.ID)
+	assert.Len(t, *lb.OutboundRules, 1)
+}
+
+func TestReconcileOutboundRuleUserDefinedRouting(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = loadBalancerSkuStandard
+	az.OutboundType = outboundTypeUserDefinedRouting
+	// Even a leftover managed outbound IP count must not create anything
+	// when egress is handled by user defined routing.
+	az.ManagedOutboundIPCount = 2
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	backendPoolID := az.getBackendPoolID(testClusterName, "rg", testClusterName)
+
+	// A fresh load balancer stays free of outbound configuration. No public
+	// IP calls are mocked, so any attempt to create one fails the test.
+	lb := network.LoadBalancer{
+		Name:                         to.StringPtr(testClusterName),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{},
+	}
+	dirty, err := az.reconcileOutboundRule(testClusterName, &svc, &lb, backendPoolID)
+	assert.NoError(t, err)
+	assert.False(t, dirty)
+	assert.Nil(t, lb.FrontendIPConfigurations)
+	assert.Nil(t, lb.OutboundRules)
+
+	// Outbound configuration left over from loadBalancer mode is removed.
+	lb = network.LoadBalancer{
+		Name: to.StringPtr(testClusterName),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+				{Name: to.StringPtr("testCluster-outbound-0")},
+			},
+			OutboundRules: &[]network.OutboundRule{
+				{Name: to.StringPtr(az.getOutboundRuleName(testClusterName))},
+			},
+		},
+	}
+	dirty, err = az.reconcileOutboundRule(testClusterName, &svc, &lb, backendPoolID)
+	assert.NoError(t, err)
+	assert.True(t, dirty)
+	assert.Len(t, *lb.FrontendIPConfigurations, 0)
+	assert.Len(t, *lb.OutboundRules, 0)
+}
+
+func TestOutboundConfigValidation(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		config        Config
+		expectedError string
+	}{
+		{
+			desc:          "outbound rule management shall require the standard sku",
+			config:        Config{ManagedOutboundIPCount: 1},
+			expectedError: "loadBalancerSku is standard",
+		},
+		{
+			desc: "managed outbound IPs and a prefix shall be mutually exclusive",
+			config: Config{
+				LoadBalancerSku:          loadBalancerSkuStandard,
+				ManagedOutboundIPCount:   1,
+				OutboundPublicIPPrefixID: "prefix",
+			},
+			expectedError: "mutually exclusive",
+		},
+		{
+			desc: "allocated outbound ports shall be a multiple of 8",
+			config: Config{
+				LoadBalancerSku:        loadBalancerSkuStandard,
+				ManagedOutboundIPCount: 1,
+				OutboundAllocatedPorts: 1001,
+			},
+			expectedError: "multiple of 8",
+		},
+		{
+			desc: "outbound idle timeout shall be between 4 and 120 minutes",
+			config: Config{
+				LoadBalancerSku:              loadBalancerSkuStandard,
+				ManagedOutboundIPCount:       1,
+				OutboundIdleTimeoutInMinutes: 3,
+			},
+			expectedError: "between 4 and 120",
+		},
+	}
+
+	for _, test := range testCases {
+		ctrl := gomock.NewController(t)
+		az := GetTestCloud(ctrl)
+		test.config.UseInstanceMetadata = true
+		err := az.InitializeCloudFromConfig(&test.config, false)
+		assert.Error(t, err, test.desc)
+		assert.Contains(t, err.Error(), test.expectedError, test.desc)
+		ctrl.Finish()
+	}
+}
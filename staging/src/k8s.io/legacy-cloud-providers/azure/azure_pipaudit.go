@@ -0,0 +1,107 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// PublicIPAuditEntry describes one cluster-owned public IP for audits of
+// public exposure. The audit fields are read from the tags the provider
+// writes on creation and reconcile.
+type PublicIPAuditEntry struct {
+	Name                 string `json:"name"`
+	ResourceGroup        string `json:"resourceGroup"`
+	IPAddress            string `json:"ipAddress,omitempty"`
+	Service              string `json:"service"`
+	CreatedForServiceUID string `json:"createdForServiceUID,omitempty"`
+	CreatedAt            string `json:"createdAt,omitempty"`
+	ReconcileCount       int    `json:"reconcileCount"`
+	ReleasedAt           string `json:"releasedAt,omitempty"`
+}
+
+// bumpPublicIPReconcileCount increments the reconcile count tag of the public
+// IP before it is written.
+func bumpPublicIPReconcileCount(pip *network.PublicIPAddress) {
+	if pip.Tags == nil {
+		pip.Tags = make(map[string]*string)
+	}
+	count, _ := strconv.Atoi(to.String(pip.Tags[reconcileCountTagKey]))
+	pip.Tags[reconcileCountTagKey] = to.StringPtr(strconv.Itoa(count + 1))
+}
+
+// ListOwnedPublicIPs enumerates the public IPs owned by the cluster together
+// with their owning services and audit tags, so public exposure can be
+// reviewed across namespaces without correlating portal views by hand. The
+// cluster resource group is always covered; the dedicated public IP resource
+// group is included when configured.
+func (az *Cloud) ListOwnedPublicIPs(clusterName string) ([]PublicIPAuditEntry, error) {
+	resourceGroups := []string{az.ResourceGroup}
+	if az.PublicIPResourceGroup != "" && !strings.EqualFold(az.PublicIPResourceGroup, az.ResourceGroup) {
+		resourceGroups = append(resourceGroups, az.PublicIPResourceGroup)
+	}
+
+	entries := []PublicIPAuditEntry{}
+	for _, resourceGroup := range resourceGroups {
+		ctx, cancel := getContextWithCancel()
+		pips, rerr := az.PublicIPAddressesClient.List(ctx, resourceGroup)
+		cancel()
+		if rerr != nil {
+			return nil, rerr.Error()
+		}
+
+		for i := range pips {
+			pip := pips[i]
+			if !publicIPOwnedByCluster(&pip, clusterName) {
+				continue
+			}
+
+			entry := PublicIPAuditEntry{
+				Name:                 to.String(pip.Name),
+				ResourceGroup:        resourceGroup,
+				Service:              to.String(pip.Tags[serviceTagKey]),
+				CreatedForServiceUID: to.String(pip.Tags[createdForUIDTagKey]),
+				CreatedAt:            to.String(pip.Tags[createdAtTagKey]),
+				ReleasedAt:           to.String(pip.Tags[releasedAtTagKey]),
+			}
+			entry.ReconcileCount, _ = strconv.Atoi(to.String(pip.Tags[reconcileCountTagKey]))
+			if pip.PublicIPAddressPropertiesFormat != nil {
+				entry.IPAddress = to.String(pip.IPAddress)
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, nil
+}
+
+// publicIPOwnedByCluster reports whether the public IP carries the ownership
+// tags of the cluster. Public IPs tagged before cluster name tagging was
+// introduced carry only the service tag and count as owned.
+func publicIPOwnedByCluster(pip *network.PublicIPAddress, clusterName string) bool {
+	if pip.Tags == nil || pip.Tags[serviceTagKey] == nil {
+		return false
+	}
+	clusterTag := pip.Tags[clusterNameKey]
+	return clusterTag == nil || strings.EqualFold(to.String(clusterTag), clusterName)
+}
@@ -0,0 +1,107 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/legacy-cloud-providers/azure/clients/publicipclient/mockpublicipclient"
+)
+
+func TestBumpPublicIPReconcileCount(t *testing.T) {
+	pip := network.PublicIPAddress{Name: to.StringPtr("pip1")}
+	bumpPublicIPReconcileCount(&pip)
+	assert.Equal(t, "1", to.String(pip.Tags[reconcileCountTagKey]))
+
+	bumpPublicIPReconcileCount(&pip)
+	assert.Equal(t, "2", to.String(pip.Tags[reconcileCountTagKey]))
+
+	// Unparsable counts restart from one instead of failing the reconcile.
+	pip.Tags[reconcileCountTagKey] = to.StringPtr("not-a-number")
+	bumpPublicIPReconcileCount(&pip)
+	assert.Equal(t, "1", to.String(pip.Tags[reconcileCountTagKey]))
+}
+
+func TestListOwnedPublicIPs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.PublicIPResourceGroup = "networking-rg"
+	pipsInClusterRG := []network.PublicIPAddress{
+		{
+			Name: to.StringPtr("pip1"),
+			Tags: map[string]*string{
+				serviceTagKey:        to.StringPtr("default/service1"),
+				clusterNameKey:       to.StringPtr(testClusterName),
+				createdForUIDTagKey:  to.StringPtr("uid-1"),
+				createdAtTagKey:      to.StringPtr("2020-01-01T00:00:00Z"),
+				reconcileCountTagKey: to.StringPtr("3"),
+			},
+			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+				IPAddress: to.StringPtr("1.2.3.4"),
+			},
+		},
+		{
+			// Owned by another cluster, not reported.
+			Name: to.StringPtr("pip2"),
+			Tags: map[string]*string{
+				serviceTagKey:  to.StringPtr("default/service2"),
+				clusterNameKey: to.StringPtr("otherCluster"),
+			},
+		},
+		{
+			// No service tag, not provider-created.
+			Name: to.StringPtr("pip3"),
+		},
+	}
+	pipsInNetworkingRG := []network.PublicIPAddress{
+		{
+			// Legacy tagging without a cluster name counts as owned.
+			Name: to.StringPtr("pip4"),
+			Tags: map[string]*string{
+				serviceTagKey: to.StringPtr("default/service4"),
+			},
+		},
+	}
+
+	mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPsClient.EXPECT().List(gomock.Any(), az.ResourceGroup).Return(pipsInClusterRG, nil).Times(1)
+	mockPIPsClient.EXPECT().List(gomock.Any(), "networking-rg").Return(pipsInNetworkingRG, nil).Times(1)
+
+	entries, err := az.ListOwnedPublicIPs(testClusterName)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, PublicIPAuditEntry{
+		Name:                 "pip1",
+		ResourceGroup:        az.ResourceGroup,
+		IPAddress:            "1.2.3.4",
+		Service:              "default/service1",
+		CreatedForServiceUID: "uid-1",
+		CreatedAt:            "2020-01-01T00:00:00Z",
+		ReconcileCount:       3,
+	}, entries[0])
+	assert.Equal(t, "pip4", entries[1].Name)
+	assert.Equal(t, "networking-rg", entries[1].ResourceGroup)
+}
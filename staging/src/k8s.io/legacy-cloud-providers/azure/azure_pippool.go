@@ -0,0 +1,126 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+)
+
+const (
+	// pipPoolTagKey is the public IP tag marking membership in the cluster's
+	// pool of pre-created public IPs, holding the pool name.
+	pipPoolTagKey = "k8s-azure-pip-pool"
+)
+
+// publicIPAddressPoolEnabled returns whether new LoadBalancer services are
+// assigned public IPs from a pool of pre-created IPs before falling back to
+// on-demand creation.
+func (az *Cloud) publicIPAddressPoolEnabled() bool {
+	return az.PublicIPAddressPoolName != ""
+}
+
+// isPoolPublicIP returns whether the public IP is a member of the cluster's
+// configured public IP pool.
+func (az *Cloud) isPoolPublicIP(pip *network.PublicIPAddress) bool {
+	if !az.publicIPAddressPoolEnabled() || pip == nil || pip.Tags == nil {
+		return false
+	}
+	return strings.EqualFold(to.String(pip.Tags[pipPoolTagKey]), az.PublicIPAddressPoolName)
+}
+
+// findOrAssignPoolPublicIP returns the name of the pool public IP assigned to
+// the service, claiming a free pool member when the service has none yet. It
+// returns false when the pool is exhausted, in which case the caller falls
+// back to creating a public IP on demand.
+func (az *Cloud) findOrAssignPoolPublicIP(clusterName string, service *v1.Service) (string, bool, error) {
+	serviceName := getServiceName(service)
+	pipResourceGroup := az.getPublicIPAddressResourceGroup(service)
+
+	pips, err := az.ListPIP(service, pipResourceGroup)
+	if err != nil {
+		return "", false, err
+	}
+
+	wantIPv6 := utilnet.IsIPv6String(service.Spec.ClusterIP)
+	var free *network.PublicIPAddress
+	for i := range pips {
+		pip := &pips[i]
+		if !az.isPoolPublicIP(pip) {
+			continue
+		}
+		if strings.EqualFold(to.String(pip.Tags[serviceTagKey]), serviceName) {
+			return to.String(pip.Name), true, nil
+		}
+		if to.String(pip.Tags[serviceTagKey]) != "" {
+			continue
+		}
+		if pip.PublicIPAddressPropertiesFormat != nil {
+			if pip.IPConfiguration != nil {
+				continue
+			}
+			if wantIPv6 != (pip.PublicIPAddressVersion == network.IPv6) {
+				continue
+			}
+		}
+		if free == nil {
+			free = pip
+		}
+	}
+
+	if free == nil {
+		message := "the public IP pool " + az.PublicIPAddressPoolName + " has no free public IP left, falling back to on-demand creation"
+		klog.V(2).Infof("findOrAssignPoolPublicIP for service (%s): %s", serviceName, message)
+		az.Event(service, v1.EventTypeWarning, "PublicIPPoolExhausted", message)
+		return "", false, nil
+	}
+
+	if free.Tags == nil {
+		free.Tags = map[string]*string{}
+	}
+	free.Tags[serviceTagKey] = &serviceName
+	free.Tags[clusterNameKey] = &clusterName
+	if err := az.CreateOrUpdatePIP(service, pipResourceGroup, *free); err != nil {
+		return "", false, err
+	}
+	klog.V(2).Infof("findOrAssignPoolPublicIP for service (%s): assigned pool public IP %s", serviceName, to.String(free.Name))
+	return to.String(free.Name), true, nil
+}
+
+// returnPublicIPToPool clears the service assignment from the pool public IP
+// instead of deleting it, so that the IP becomes available to other services
+// again.
+func (az *Cloud) returnPublicIPToPool(service *v1.Service, pipResourceGroup string, pip *network.PublicIPAddress) error {
+	delete(pip.Tags, serviceTagKey)
+	delete(pip.Tags, clusterNameKey)
+	delete(pip.Tags, dnsLabelServiceTagKey)
+	delete(pip.Tags, releasedAtTagKey)
+	if pip.PublicIPAddressPropertiesFormat != nil {
+		pip.PublicIPAddressPropertiesFormat.DNSSettings = nil
+	}
+
+	klog.V(2).Infof("returnPublicIPToPool: returning public IP %s to pool %s", to.String(pip.Name), az.PublicIPAddressPoolName)
+	return az.CreateOrUpdatePIP(service, pipResourceGroup, *pip)
+}
@@ -0,0 +1,127 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/legacy-cloud-providers/azure/clients/publicipclient/mockpublicipclient"
+	"k8s.io/legacy-cloud-providers/azure/retry"
+)
+
+func TestFindOrAssignPoolPublicIP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.PublicIPAddressPoolName = "pool1"
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+
+	assignedPIP := network.PublicIPAddress{
+		Name: to.StringPtr("pool-pip-1"),
+		Tags: map[string]*string{
+			pipPoolTagKey: to.StringPtr("pool1"),
+			serviceTagKey: to.StringPtr("default/other"),
+		},
+	}
+	freePIP := network.PublicIPAddress{
+		Name: to.StringPtr("pool-pip-2"),
+		Tags: map[string]*string{pipPoolTagKey: to.StringPtr("pool1")},
+	}
+	foreignPIP := network.PublicIPAddress{
+		Name: to.StringPtr("unrelated-pip"),
+	}
+
+	var updatedPIP network.PublicIPAddress
+	mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPsClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{assignedPIP, foreignPIP, freePIP}, nil).Times(1)
+	mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "pool-pip-2", gomock.Any()).DoAndReturn(
+		func(ctx context.Context, resourceGroupName string, publicIPAddressName string, parameters network.PublicIPAddress) *retry.Error {
+			updatedPIP = parameters
+			return nil
+		}).Times(1)
+
+	// A free pool member shall be claimed for the service.
+	pipName, found, err := az.findOrAssignPoolPublicIP(testClusterName, &svc)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "pool-pip-2", pipName)
+	assert.Equal(t, "default/service1", to.String(updatedPIP.Tags[serviceTagKey]))
+	assert.Equal(t, testClusterName, to.String(updatedPIP.Tags[clusterNameKey]))
+
+	// A pool member already assigned to the service shall be reused without
+	// an update.
+	mockPIPsClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{updatedPIP}, nil).Times(1)
+	pipName, found, err = az.findOrAssignPoolPublicIP(testClusterName, &svc)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "pool-pip-2", pipName)
+
+	// An exhausted pool shall report no match so that the caller falls back
+	// to on-demand creation.
+	mockPIPsClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{assignedPIP, foreignPIP}, nil).Times(1)
+	_, found, err = az.findOrAssignPoolPublicIP(testClusterName, &svc)
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestReturnPublicIPToPool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.PublicIPAddressPoolName = "pool1"
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+
+	pip := network.PublicIPAddress{
+		Name: to.StringPtr("pool-pip-1"),
+		Tags: map[string]*string{
+			pipPoolTagKey:         to.StringPtr("pool1"),
+			serviceTagKey:         to.StringPtr("default/service1"),
+			clusterNameKey:        to.StringPtr(testClusterName),
+			dnsLabelServiceTagKey: to.StringPtr("default/service1"),
+		},
+		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+			DNSSettings: &network.PublicIPAddressDNSSettings{DomainNameLabel: to.StringPtr("label1")},
+		},
+	}
+	assert.True(t, az.isPoolPublicIP(&pip))
+
+	var updatedPIP network.PublicIPAddress
+	mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "pool-pip-1", gomock.Any()).DoAndReturn(
+		func(ctx context.Context, resourceGroupName string, publicIPAddressName string, parameters network.PublicIPAddress) *retry.Error {
+			updatedPIP = parameters
+			return nil
+		}).Times(1)
+
+	assert.NoError(t, az.returnPublicIPToPool(&svc, "rg", &pip))
+	assert.NotContains(t, updatedPIP.Tags, serviceTagKey)
+	assert.NotContains(t, updatedPIP.Tags, clusterNameKey)
+	assert.NotContains(t, updatedPIP.Tags, dnsLabelServiceTagKey)
+	assert.Contains(t, updatedPIP.Tags, pipPoolTagKey)
+	assert.Nil(t, updatedPIP.PublicIPAddressPropertiesFormat.DNSSettings)
+}
@@ -0,0 +1,70 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// nodeAnnotationPoolJoinReady lets an external probe controller override the
+// backend pool readiness window: "true" admits the node immediately, any
+// other value holds it out of the pools.
+const nodeAnnotationPoolJoinReady = "kubernetes.azure.com/load-balancer-pool-join-ready"
+
+// shouldDelayNodePoolJoin reports whether a newly registered node is still
+// inside its readiness window and should be held out of the load balancer
+// backend pools, so that traffic doesn't reach it before kube-proxy and the
+// CNI are fully programmed. The exclusion is temporary: the service
+// controller resyncs the nodes periodically, so held-out nodes join the
+// pools once the window has passed.
+func (az *Cloud) shouldDelayNodePoolJoin(node *v1.Node) bool {
+	if az.BackendPoolReadinessWindowInSeconds <= 0 {
+		return false
+	}
+
+	if v, ok := node.Annotations[nodeAnnotationPoolJoinReady]; ok {
+		return !strings.EqualFold(v, "true")
+	}
+
+	for i := range node.Status.Conditions {
+		condition := &node.Status.Conditions[i]
+		if condition.Type != v1.NodeReady {
+			continue
+		}
+		if condition.Status != v1.ConditionTrue {
+			klog.V(4).Infof("shouldDelayNodePoolJoin: holding node %s out of the backend pools because it is not ready", node.Name)
+			return true
+		}
+
+		window := time.Duration(az.BackendPoolReadinessWindowInSeconds) * time.Second
+		if readyFor := time.Since(condition.LastTransitionTime.Time); readyFor < window {
+			klog.V(2).Infof("shouldDelayNodePoolJoin: holding node %s out of the backend pools, ready for %s of the %s readiness window", node.Name, readyFor.Round(time.Second), window)
+			return true
+		}
+		return false
+	}
+
+	// The node has not reported a Ready condition yet.
+	klog.V(4).Infof("shouldDelayNodePoolJoin: holding node %s out of the backend pools because it has no Ready condition", node.Name)
+	return true
+}
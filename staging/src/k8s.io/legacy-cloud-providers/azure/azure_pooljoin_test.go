@@ -0,0 +1,110 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestShouldDelayNodePoolJoin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	buildNode := func(readyStatus v1.ConditionStatus, readySince time.Duration, annotations map[string]string) *v1.Node {
+		return &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "node1",
+				Annotations: annotations,
+			},
+			Status: v1.NodeStatus{
+				Conditions: []v1.NodeCondition{
+					{
+						Type:               v1.NodeReady,
+						Status:             readyStatus,
+						LastTransitionTime: metav1.NewTime(time.Now().Add(-readySince)),
+					},
+				},
+			},
+		}
+	}
+
+	testCases := []struct {
+		desc            string
+		windowInSeconds int
+		node            *v1.Node
+		expected        bool
+	}{
+		{
+			desc:            "nodes shall not be delayed when the readiness window is disabled",
+			windowInSeconds: 0,
+			node:            buildNode(v1.ConditionTrue, time.Second, nil),
+			expected:        false,
+		},
+		{
+			desc:            "nodes inside the readiness window shall be delayed",
+			windowInSeconds: 300,
+			node:            buildNode(v1.ConditionTrue, time.Minute, nil),
+			expected:        true,
+		},
+		{
+			desc:            "nodes past the readiness window shall join",
+			windowInSeconds: 300,
+			node:            buildNode(v1.ConditionTrue, 10*time.Minute, nil),
+			expected:        false,
+		},
+		{
+			desc:            "not ready nodes shall be delayed",
+			windowInSeconds: 300,
+			node:            buildNode(v1.ConditionFalse, 10*time.Minute, nil),
+			expected:        true,
+		},
+		{
+			desc:            "nodes without a Ready condition shall be delayed",
+			windowInSeconds: 300,
+			node:            &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}},
+			expected:        true,
+		},
+		{
+			desc:            "the readiness annotation shall admit nodes inside the window",
+			windowInSeconds: 300,
+			node:            buildNode(v1.ConditionTrue, time.Minute, map[string]string{nodeAnnotationPoolJoinReady: "true"}),
+			expected:        false,
+		},
+		{
+			desc:            "the readiness annotation shall hold out nodes past the window",
+			windowInSeconds: 300,
+			node:            buildNode(v1.ConditionTrue, 10*time.Minute, map[string]string{nodeAnnotationPoolJoinReady: "false"}),
+			expected:        true,
+		},
+	}
+
+	for _, test := range testCases {
+		az := GetTestCloud(ctrl)
+		az.BackendPoolReadinessWindowInSeconds = test.windowInSeconds
+		assert.Equal(t, test.expected, az.shouldDelayNodePoolJoin(test.node), test.desc)
+		assert.Equal(t, test.expected, az.ShouldNodeExcludedFromLoadBalancer(test.node), test.desc)
+	}
+}
@@ -0,0 +1,55 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"errors"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2"
+)
+
+// errProviderReadOnly is returned by every write path while the readOnly
+// cloud config switch is set, so callers and operators can tell a frozen
+// provider apart from a genuine cloud failure.
+var errProviderReadOnly = errors.New("provider in read-only mode")
+
+// readOnlyEventReason is the reason of the event recorded when a write is
+// rejected in read-only mode.
+const readOnlyEventReason = "ProviderReadOnly"
+
+// checkReadOnly rejects the given write operation when the provider runs in
+// read-only mode. Read paths (instances, zones, load balancer status) are not
+// guarded, so nodes keep their addresses and zone labels while cloud-side
+// changes are frozen. An event is recorded against obj when one is available
+// so operators can see which changes were held back.
+func (az *Cloud) checkReadOnly(obj runtime.Object, operation string) error {
+	if !az.ReadOnly {
+		return nil
+	}
+
+	klog.Warningf("%s: rejected because the provider is in read-only mode", operation)
+	if obj != nil {
+		az.Event(obj, v1.EventTypeWarning, readOnlyEventReason,
+			fmt.Sprintf("%s rejected: provider is in read-only mode", operation))
+	}
+	return errProviderReadOnly
+}
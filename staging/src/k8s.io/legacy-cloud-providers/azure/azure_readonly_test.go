@@ -0,0 +1,90 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/legacy-cloud-providers/azure/clients/loadbalancerclient/mockloadbalancerclient"
+	"k8s.io/legacy-cloud-providers/azure/clients/publicipclient/mockpublicipclient"
+	"k8s.io/legacy-cloud-providers/azure/retry"
+)
+
+func TestReadOnlyModeRejectsWrites(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.ReadOnly = true
+	recorder := record.NewFakeRecorder(10)
+	az.eventRecorder = recorder
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+
+	// No ARM calls are mocked: a write path reaching the clients would fail
+	// the test, so the rejections below prove nothing is sent cloud-side.
+	_, err := az.EnsureLoadBalancer(context.TODO(), testClusterName, &svc, nil)
+	assert.Equal(t, errProviderReadOnly, err)
+	event := <-recorder.Events
+	assert.Contains(t, event, readOnlyEventReason)
+	assert.Contains(t, event, "read-only mode")
+
+	assert.Equal(t, errProviderReadOnly, az.UpdateLoadBalancer(context.TODO(), testClusterName, &svc, nil))
+	<-recorder.Events
+	assert.Equal(t, errProviderReadOnly, az.EnsureLoadBalancerDeleted(context.TODO(), testClusterName, &svc))
+	<-recorder.Events
+
+	route := &cloudprovider.Route{TargetNode: "node", DestinationCIDR: "10.244.0.0/24"}
+	assert.Equal(t, errProviderReadOnly, az.CreateRoute(context.TODO(), testClusterName, "hint", route))
+	assert.Equal(t, errProviderReadOnly, az.DeleteRoute(context.TODO(), testClusterName, route))
+
+	_, err = az.AttachDisk(true, "disk", "uri", "node", "None")
+	assert.Equal(t, errProviderReadOnly, err)
+	assert.Equal(t, errProviderReadOnly, az.DetachDisk("disk", "uri", "node"))
+	_, err = az.CreateManagedDisk(&ManagedDiskOptions{DiskName: "disk", SizeGB: 10})
+	assert.Equal(t, errProviderReadOnly, err)
+	assert.Equal(t, errProviderReadOnly, az.DeleteManagedDisk("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Compute/disks/disk"))
+}
+
+func TestReadOnlyModeKeepsReadsWorking(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.ReadOnly = true
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+
+	mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", "testCluster-aservice1", gomock.Any()).Return(network.PublicIPAddress{}, &retry.Error{HTTPStatusCode: http.StatusNotFound}).AnyTimes()
+	mockLBsClient := mockloadbalancerclient.NewMockInterface(ctrl)
+	mockLBsClient.EXPECT().List(gomock.Any(), "rg").Return([]network.LoadBalancer{}, nil)
+	az.LoadBalancerClient = mockLBsClient
+
+	_, exists, err := az.GetLoadBalancer(context.TODO(), testClusterName, &svc)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
@@ -0,0 +1,73 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// LoadBalancerReconciler reconciles the Azure load balancer backing a
+// LoadBalancer typed service. It is exported so that the out-of-tree
+// cloud-provider-azure can embed and extend the in-tree reconciler, and so
+// that unit tests can swap in partial fakes instead of the whole Cloud struct.
+type LoadBalancerReconciler interface {
+	// ReconcileLoadBalancer ensures the load balancer for the service matches
+	// the desired state. It returns the reconciled load balancer when wantLb is
+	// true and cleans the service's rules from it otherwise.
+	ReconcileLoadBalancer(clusterName string, service *v1.Service, nodes []*v1.Node, wantLb bool) (*network.LoadBalancer, error)
+}
+
+// SecurityGroupReconciler reconciles the network security group rules for a
+// LoadBalancer typed service.
+type SecurityGroupReconciler interface {
+	// ReconcileSecurityGroup ensures the security group rules for the service
+	// match the desired state. The service's rules are removed when wantLb is
+	// false.
+	ReconcileSecurityGroup(clusterName string, service *v1.Service, lbIP *string, wantLb bool) (*network.SecurityGroup, error)
+}
+
+// PublicIPManager reconciles the public IPs owned by a LoadBalancer typed
+// service.
+type PublicIPManager interface {
+	// ReconcilePublicIP ensures the public IP for the service matches the
+	// desired state. Provider-owned public IPs of the service are deleted when
+	// wantLb is false.
+	ReconcilePublicIP(clusterName string, service *v1.Service, lbName string, wantLb bool) (*network.PublicIPAddress, error)
+}
+
+var _ LoadBalancerReconciler = (*Cloud)(nil)
+var _ SecurityGroupReconciler = (*Cloud)(nil)
+var _ PublicIPManager = (*Cloud)(nil)
+
+// ReconcileLoadBalancer implements LoadBalancerReconciler for Cloud.
+func (az *Cloud) ReconcileLoadBalancer(clusterName string, service *v1.Service, nodes []*v1.Node, wantLb bool) (*network.LoadBalancer, error) {
+	return az.reconcileLoadBalancer(clusterName, service, nodes, wantLb)
+}
+
+// ReconcileSecurityGroup implements SecurityGroupReconciler for Cloud.
+func (az *Cloud) ReconcileSecurityGroup(clusterName string, service *v1.Service, lbIP *string, wantLb bool) (*network.SecurityGroup, error) {
+	return az.reconcileSecurityGroup(clusterName, service, lbIP, wantLb)
+}
+
+// ReconcilePublicIP implements PublicIPManager for Cloud.
+func (az *Cloud) ReconcilePublicIP(clusterName string, service *v1.Service, lbName string, wantLb bool) (*network.PublicIPAddress, error) {
+	return az.reconcilePublicIP(clusterName, service, lbName, wantLb)
+}
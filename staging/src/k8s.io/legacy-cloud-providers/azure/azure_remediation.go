@@ -0,0 +1,54 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/legacy-cloud-providers/azure/retry"
+)
+
+// armErrorRemediationHints maps well-known ARM error codes to actionable
+// remediation hints, so users get something better than the raw ARM JSON in
+// service events when a reconciliation fails for a well-understood reason.
+var armErrorRemediationHints = map[string]string{
+	"PublicIPCountLimitReached":                 "the subscription reached its public IP address quota; delete unused public IP addresses or request a quota increase",
+	"SubnetIsFull":                              "the subnet has no free IP addresses left; move the service to a larger subnet or free addresses by removing unused resources",
+	"SecurityRuleConflict":                      "a conflicting rule exists in the network security group; remove or renumber the conflicting security rule",
+	"LoadBalancerInUseByVirtualMachineScaleSet": "the load balancer is still referenced by a virtual machine scale set; remove the scale set reference before changing or deleting the load balancer",
+}
+
+// remediatedError attaches a remediation hint to the error when its ARM
+// error code is a well-known one, emits the hint as a warning event on the
+// service, and returns the plain error for the caller to propagate.
+func (az *Cloud) remediatedError(service *v1.Service, operation string, rerr *retry.Error) error {
+	if rerr == nil {
+		return nil
+	}
+	az.noteARMError(operation, rerr)
+
+	code := rerr.ServiceErrorCode()
+	if hint, ok := armErrorRemediationHints[code]; ok {
+		rerr.RemediationHint = hint
+		az.Event(service, v1.EventTypeWarning, operation, fmt.Sprintf("%s: %s", code, hint))
+	}
+
+	return rerr.Error()
+}
@@ -0,0 +1,67 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/legacy-cloud-providers/azure/retry"
+)
+
+func TestRemediatedError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	recorder := record.NewFakeRecorder(10)
+	az.eventRecorder = recorder
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+
+	assert.NoError(t, az.remediatedError(&svc, "CreateOrUpdateLoadBalancer", nil))
+
+	// Errors without a well-known code are passed through untouched.
+	rerr := &retry.Error{
+		HTTPStatusCode: http.StatusInternalServerError,
+		RawError:       fmt.Errorf(`{"error":{"code":"InternalServerError","message":"something broke"}}`),
+	}
+	err := az.remediatedError(&svc, "CreateOrUpdateLoadBalancer", rerr)
+	assert.Error(t, err)
+	assert.Empty(t, rerr.RemediationHint)
+	assert.Len(t, recorder.Events, 0)
+
+	// Well-known codes get a remediation hint in the error and an event.
+	rerr = &retry.Error{
+		HTTPStatusCode: http.StatusBadRequest,
+		RawError:       fmt.Errorf(`{"error":{"code":"PublicIPCountLimitReached","message":"Cannot create more than 10 public IP addresses"}}`),
+	}
+	err = az.remediatedError(&svc, "CreateOrUpdatePublicIPAddress", rerr)
+	assert.Error(t, err)
+	assert.Equal(t, armErrorRemediationHints["PublicIPCountLimitReached"], rerr.RemediationHint)
+	assert.Contains(t, err.Error(), "RemediationHint: the subscription reached its public IP address quota")
+	event := <-recorder.Events
+	assert.Contains(t, event, "PublicIPCountLimitReached")
+	assert.Contains(t, event, "quota increase")
+}
@@ -0,0 +1,53 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"strings"
+)
+
+// resourceID is the canonical representation of an ARM resource identifier.
+// ARM treats resource IDs case-insensitively and different Azure APIs return
+// the same resource with different casings (e.g. the resourceGroups segment),
+// hence ARM IDs must never be compared as plain strings.
+type resourceID string
+
+// resourceGroup returns the resource group segment of the resource ID, or an
+// empty string when the ID is not in the ARM resource ID format.
+func (r resourceID) resourceGroup() string {
+	matches := azureResourceGroupNameRE.FindStringSubmatch(string(r))
+	if len(matches) != 2 {
+		return ""
+	}
+
+	return matches[1]
+}
+
+// equalsTo reports whether the two resource IDs refer to the same ARM resource,
+// comparing case-insensitively.
+func (r resourceID) equalsTo(other resourceID) bool {
+	return strings.EqualFold(string(r), string(other))
+}
+
+// equalResourceIDs reports whether two ARM resource IDs refer to the same
+// resource. It is a convenience wrapper around resourceID for call sites that
+// hold plain strings.
+func equalResourceIDs(a, b string) bool {
+	return resourceID(a).equalsTo(resourceID(b))
+}
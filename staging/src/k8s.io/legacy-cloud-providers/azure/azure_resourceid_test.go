@@ -0,0 +1,80 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResourceIDResourceGroup(t *testing.T) {
+	testcases := []struct {
+		name       string
+		resourceID resourceID
+		expected   string
+	}{
+		{
+			name:       "resourceGroup should return the resource group segment",
+			resourceID: "/subscriptions/sub/resourceGroups/MixedCaseRG/providers/Microsoft.Network/loadBalancers/lb",
+			expected:   "MixedCaseRG",
+		},
+		{
+			name:       "resourceGroup should return an empty string for non ARM IDs",
+			resourceID: "invalid-resource-id",
+			expected:   "",
+		},
+	}
+
+	for _, test := range testcases {
+		assert.Equal(t, test.expected, test.resourceID.resourceGroup(), test.name)
+	}
+}
+
+func TestEqualResourceIDs(t *testing.T) {
+	testcases := []struct {
+		name     string
+		left     string
+		right    string
+		expected bool
+	}{
+		{
+			name:     "equalResourceIDs should match identical IDs",
+			left:     "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb/backendAddressPools/pool",
+			right:    "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb/backendAddressPools/pool",
+			expected: true,
+		},
+		{
+			name:     "equalResourceIDs should match IDs with different casings",
+			left:     "/subscriptions/sub/resourceGroups/RG/providers/Microsoft.Network/loadBalancers/lb/backendAddressPools/pool",
+			right:    "/subscriptions/sub/resourcegroups/rg/providers/microsoft.network/loadbalancers/lb/backendaddresspools/pool",
+			expected: true,
+		},
+		{
+			name:     "equalResourceIDs should not match different resources",
+			left:     "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb/backendAddressPools/pool",
+			right:    "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb/backendAddressPools/pool2",
+			expected: false,
+		},
+	}
+
+	for _, test := range testcases {
+		assert.Equal(t, test.expected, equalResourceIDs(test.left, test.right), test.name)
+	}
+}
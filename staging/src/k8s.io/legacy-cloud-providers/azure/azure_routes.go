@@ -20,6 +20,7 @@ package azure
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -33,6 +34,7 @@ import (
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
 	azcache "k8s.io/legacy-cloud-providers/azure/cache"
+	"k8s.io/legacy-cloud-providers/azure/metrics"
 	utilnet "k8s.io/utils/net"
 )
 
@@ -110,6 +112,12 @@ func (d *delayedRouteUpdater) updateRoutes() {
 		return
 	}
 
+	batchStart := time.Now()
+	batchSize := len(d.routesToUpdate)
+	defer func() {
+		metrics.ObserveRouteBatch(batchSize, time.Since(batchStart).Seconds())
+	}()
+
 	var err error
 	defer func() {
 		// Notify all the goroutines.
@@ -206,7 +214,7 @@ func (d *delayedRouteUpdater) addRouteOperation(operation routeOperation, route
 func (az *Cloud) ListRoutes(ctx context.Context, clusterName string) ([]*cloudprovider.Route, error) {
 	klog.V(10).Infof("ListRoutes: START clusterName=%q", clusterName)
 	routeTable, existsRouteTable, err := az.getRouteTable(azcache.CacheReadTypeDefault)
-	routes, err := processRoutes(az.ipv6DualStackEnabled, routeTable, existsRouteTable, err)
+	routes, err := processRoutes(az.ipv6DualStackEnabled, az.sharedResourcePrefix(clusterName), routeTable, existsRouteTable, err)
 	if err != nil {
 		return nil, err
 	}
@@ -232,7 +240,7 @@ func (az *Cloud) ListRoutes(ctx context.Context, clusterName string) ([]*cloudpr
 }
 
 // Injectable for testing
-func processRoutes(ipv6DualStackEnabled bool, routeTable network.RouteTable, exists bool, err error) ([]*cloudprovider.Route, error) {
+func processRoutes(ipv6DualStackEnabled bool, namePrefix string, routeTable network.RouteTable, exists bool, err error) ([]*cloudprovider.Route, error) {
 	if err != nil {
 		return nil, err
 	}
@@ -242,17 +250,23 @@ func processRoutes(ipv6DualStackEnabled bool, routeTable network.RouteTable, exi
 
 	var kubeRoutes []*cloudprovider.Route
 	if routeTable.RouteTablePropertiesFormat != nil && routeTable.Routes != nil {
-		kubeRoutes = make([]*cloudprovider.Route, len(*routeTable.Routes))
-		for i, route := range *routeTable.Routes {
-			instance := mapRouteNameToNodeName(ipv6DualStackEnabled, *route.Name)
+		kubeRoutes = make([]*cloudprovider.Route, 0, len(*routeTable.Routes))
+		for _, route := range *routeTable.Routes {
+			routeName := *route.Name
+			if isOtherClustersSharedResource(namePrefix, routeName) {
+				// Skip routes owned by other clusters sharing the route table.
+				klog.V(10).Infof("ListRoutes: skipping route %q owned by another cluster", routeName)
+				continue
+			}
+			instance := mapRouteNameToNodeName(ipv6DualStackEnabled, strings.TrimPrefix(routeName, namePrefix))
 			cidr := *route.AddressPrefix
 			klog.V(10).Infof("ListRoutes: * instance=%q, cidr=%q", instance, cidr)
 
-			kubeRoutes[i] = &cloudprovider.Route{
-				Name:            *route.Name,
+			kubeRoutes = append(kubeRoutes, &cloudprovider.Route{
+				Name:            routeName,
 				TargetNode:      instance,
 				DestinationCIDR: cidr,
-			}
+			})
 		}
 	}
 
@@ -282,6 +296,10 @@ func (az *Cloud) createRouteTable() error {
 // route.Name will be ignored, although the cloud-provider may use nameHint
 // to create a more user-meaningful name.
 func (az *Cloud) CreateRoute(ctx context.Context, clusterName string, nameHint string, kubeRoute *cloudprovider.Route) error {
+	if err := az.checkReadOnly(nil, "CreateRoute"); err != nil {
+		return err
+	}
+
 	// Returns  for unmanaged nodes because azure cloud provider couldn't fetch information for them.
 	var targetIP string
 	nodeName := string(kubeRoute.TargetNode)
@@ -302,6 +320,9 @@ func (az *Cloud) CreateRoute(ctx context.Context, clusterName string, nameHint s
 	}
 
 	CIDRv6 := utilnet.IsIPv6CIDRString(string(kubeRoute.DestinationCIDR))
+	if az.IPv6SingleStack && !CIDRv6 {
+		return fmt.Errorf("CreateRoute: IPv4 destination CIDR %q is not supported in IPv6 single stack clusters", kubeRoute.DestinationCIDR)
+	}
 	// if single stack IPv4 then get the IP for the primary ip config
 	// single stack IPv6 is supported on dual stack host. So the IPv6 IP is secondary IP for both single stack IPv6 and dual stack
 	// Get all private IPs for the machine and find the first one that matches the IPv6 family
@@ -326,7 +347,7 @@ func (az *Cloud) CreateRoute(ctx context.Context, clusterName string, nameHint s
 			return err
 		}
 	}
-	routeName := mapNodeNameToRouteName(az.ipv6DualStackEnabled, kubeRoute.TargetNode, string(kubeRoute.DestinationCIDR))
+	routeName := az.sharedResourcePrefix(clusterName) + mapNodeNameToRouteName(az.ipv6DualStackEnabled, kubeRoute.TargetNode, string(kubeRoute.DestinationCIDR))
 	route := network.Route{
 		Name: to.StringPtr(routeName),
 		RoutePropertiesFormat: &network.RoutePropertiesFormat{
@@ -357,6 +378,10 @@ func (az *Cloud) CreateRoute(ctx context.Context, clusterName string, nameHint s
 // DeleteRoute deletes the specified managed route
 // Route should be as returned by ListRoutes
 func (az *Cloud) DeleteRoute(ctx context.Context, clusterName string, kubeRoute *cloudprovider.Route) error {
+	if err := az.checkReadOnly(nil, "DeleteRoute"); err != nil {
+		return err
+	}
+
 	// Returns  for unmanaged nodes because azure cloud provider couldn't fetch information for them.
 	nodeName := string(kubeRoute.TargetNode)
 	unmanaged, err := az.IsNodeUnmanaged(nodeName)
@@ -371,9 +396,23 @@ func (az *Cloud) DeleteRoute(ctx context.Context, clusterName string, kubeRoute
 		return nil
 	}
 
+	// A deallocated VM keeps its route when retainRoutesOnDeallocation is
+	// set: the VM restarts with the same pod CIDR, so deleting the route only
+	// forces a reprogramming cycle on the next start.
+	if az.RetainRoutesOnDeallocation {
+		retain, err := az.shouldRetainRouteForNode(nodeName)
+		if err != nil {
+			return err
+		}
+		if retain {
+			klog.V(2).Infof("DeleteRoute: retaining route of deallocated node %q (cidr %q)", nodeName, kubeRoute.DestinationCIDR)
+			return nil
+		}
+	}
+
 	klog.V(2).Infof("DeleteRoute: deleting route. clusterName=%q instance=%q cidr=%q", clusterName, kubeRoute.TargetNode, kubeRoute.DestinationCIDR)
 
-	routeName := mapNodeNameToRouteName(az.ipv6DualStackEnabled, kubeRoute.TargetNode, string(kubeRoute.DestinationCIDR))
+	routeName := az.sharedResourcePrefix(clusterName) + mapNodeNameToRouteName(az.ipv6DualStackEnabled, kubeRoute.TargetNode, string(kubeRoute.DestinationCIDR))
 	route := network.Route{
 		Name:                  to.StringPtr(routeName),
 		RoutePropertiesFormat: &network.RoutePropertiesFormat{},
@@ -391,10 +430,49 @@ func (az *Cloud) DeleteRoute(ctx context.Context, clusterName string, kubeRoute
 		return err
 	}
 
+	// Remove outdated ipv4 routes as well. Routes created before the
+	// IPv6DualStack feature gate was enabled only carry the node name, so
+	// deleting by the per-family name would leave them behind.
+	if az.ipv6DualStackEnabled {
+		routeNameWithoutIPV6Suffix := strings.Split(routeName, routeNameSeparator)[0]
+		routeWithoutIPV6Suffix := network.Route{
+			Name:                  to.StringPtr(routeNameWithoutIPV6Suffix),
+			RoutePropertiesFormat: &network.RoutePropertiesFormat{},
+		}
+		op, err := az.routeUpdater.addRouteOperation(routeOperationDelete, routeWithoutIPV6Suffix)
+		if err != nil {
+			klog.Errorf("DeleteRoute failed for node %q with error: %v", kubeRoute.TargetNode, err)
+			return err
+		}
+
+		// Wait for operation complete.
+		err = op.wait()
+		if err != nil {
+			klog.Errorf("DeleteRoute failed for node %q with error: %v", kubeRoute.TargetNode, err)
+			return err
+		}
+	}
+
 	klog.V(2).Infof("DeleteRoute: route deleted. clusterName=%q instance=%q cidr=%q", clusterName, kubeRoute.TargetNode, kubeRoute.DestinationCIDR)
 	return nil
 }
 
+// shouldRetainRouteForNode returns whether the node's VM is deallocated or
+// deallocating, in which case its route outlives the deletion request. A VM
+// that no longer exists never retains its route.
+func (az *Cloud) shouldRetainRouteForNode(nodeName string) (bool, error) {
+	powerStatus, err := az.VMSet.GetPowerStatusByNodeName(nodeName)
+	if err != nil {
+		if errors.Is(err, cloudprovider.InstanceNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	status := strings.ToLower(powerStatus)
+	return status == vmPowerStateDeallocated || status == vmPowerStateDeallocating, nil
+}
+
 // This must be kept in sync with mapRouteNameToNodeName.
 // These two functions enable stashing the instance name in the route
 // and then retrieving it later when listing. This is needed because
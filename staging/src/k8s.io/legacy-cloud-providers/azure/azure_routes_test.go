@@ -109,6 +109,104 @@ func TestDeleteRoute(t *testing.T) {
 	if found {
 		t.Errorf("unexpected CIDR item (%q) for %s", cidr, nodeName)
 	}
+
+	// test delete route for dual stack nodes: both the per-family route and
+	// the outdated single stack route should be removed.
+	cloud.ipv6DualStackEnabled = true
+	routeNameV4 := mapNodeNameToRouteName(true, route.TargetNode, route.DestinationCIDR)
+	legacyRouteName := string(route.TargetNode)
+	routeTablesDualStack := network.RouteTable{
+		Name:     &cloud.RouteTableName,
+		Location: &cloud.Location,
+		RouteTablePropertiesFormat: &network.RouteTablePropertiesFormat{
+			Routes: &[]network.Route{
+				{
+					Name: &routeNameV4,
+				},
+				{
+					Name: &legacyRouteName,
+				},
+			},
+		},
+	}
+	routeTablesLegacyOnly := network.RouteTable{
+		Name:     &cloud.RouteTableName,
+		Location: &cloud.Location,
+		RouteTablePropertiesFormat: &network.RouteTablePropertiesFormat{
+			Routes: &[]network.Route{
+				{
+					Name: &legacyRouteName,
+				},
+			},
+		},
+	}
+	routeTableClient.EXPECT().Get(gomock.Any(), cloud.RouteTableResourceGroup, cloud.RouteTableName, "").Return(routeTablesDualStack, nil)
+	routeTableClient.EXPECT().CreateOrUpdate(gomock.Any(), cloud.RouteTableResourceGroup, cloud.RouteTableName, routeTablesLegacyOnly, "").Return(nil)
+	routeTableClient.EXPECT().Get(gomock.Any(), cloud.RouteTableResourceGroup, cloud.RouteTableName, "").Return(routeTablesLegacyOnly, nil)
+	routeTableClient.EXPECT().CreateOrUpdate(gomock.Any(), cloud.RouteTableResourceGroup, cloud.RouteTableName, routeTablesAfterDeletion, "").Return(nil)
+	err = cloud.DeleteRoute(context.TODO(), "cluster", &route)
+	if err != nil {
+		t.Errorf("unexpected error deleting route: %v", err)
+		t.FailNow()
+	}
+}
+
+func TestDeleteRouteRetainsDeallocatedNodes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	routeTableClient := mockroutetableclient.NewMockInterface(ctrl)
+	mockVMSet := mockvmsets.NewMockVMSet(ctrl)
+
+	cloud := &Cloud{
+		RouteTablesClient: routeTableClient,
+		VMSet:             mockVMSet,
+		Config: Config{
+			RouteTableResourceGroup:    "foo",
+			RouteTableName:             "bar",
+			Location:                   "location",
+			RetainRoutesOnDeallocation: true,
+		},
+		unmanagedNodes:     sets.NewString(),
+		nodeInformerSynced: func() bool { return true },
+	}
+	cache, _ := cloud.newRouteTableCache()
+	cloud.rtCache = cache
+	cloud.routeUpdater = newDelayedRouteUpdater(cloud, 100*time.Millisecond)
+	go cloud.routeUpdater.run()
+	route := cloudprovider.Route{
+		TargetNode:      "node",
+		DestinationCIDR: "1.2.3.4/24",
+	}
+
+	// The route of a deallocated node is kept, so no route table update is
+	// expected.
+	mockVMSet.EXPECT().GetPowerStatusByNodeName("node").Return(vmPowerStateDeallocated, nil).Times(1)
+	assert.NoError(t, cloud.DeleteRoute(context.TODO(), "cluster", &route))
+
+	// The route of a running node is deleted as before.
+	routeName := mapNodeNameToRouteName(false, route.TargetNode, route.DestinationCIDR)
+	routeTables := network.RouteTable{
+		Name:     &cloud.RouteTableName,
+		Location: &cloud.Location,
+		RouteTablePropertiesFormat: &network.RouteTablePropertiesFormat{
+			Routes: &[]network.Route{
+				{
+					Name: &routeName,
+				},
+			},
+		},
+	}
+	routeTablesAfterDeletion := network.RouteTable{
+		Name:     &cloud.RouteTableName,
+		Location: &cloud.Location,
+		RouteTablePropertiesFormat: &network.RouteTablePropertiesFormat{
+			Routes: &[]network.Route{},
+		},
+	}
+	mockVMSet.EXPECT().GetPowerStatusByNodeName("node").Return("running", nil).Times(1)
+	routeTableClient.EXPECT().Get(gomock.Any(), cloud.RouteTableResourceGroup, cloud.RouteTableName, "").Return(routeTables, nil)
+	routeTableClient.EXPECT().CreateOrUpdate(gomock.Any(), cloud.RouteTableResourceGroup, cloud.RouteTableName, routeTablesAfterDeletion, "").Return(nil)
+	assert.NoError(t, cloud.DeleteRoute(context.TODO(), "cluster", &route))
 }
 
 func TestCreateRoute(t *testing.T) {
@@ -428,7 +526,7 @@ func TestProcessRoutes(t *testing.T) {
 		},
 	}
 	for _, test := range tests {
-		routes, err := processRoutes(false, test.rt, test.exists, test.err)
+		routes, err := processRoutes(false, "", test.rt, test.exists, test.err)
 		if test.expectErr {
 			if err == nil {
 				t.Errorf("%s: unexpected non-error", test.name)
@@ -0,0 +1,87 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/legacy-cloud-providers/azure/retry"
+)
+
+const (
+	// scopeLockedErrorCode is the error code ARM returns when a ReadOnly or
+	// CanNotDelete management lock rejects a write against the scope.
+	scopeLockedErrorCode = "ScopeLocked"
+
+	// readOnlyDisabledSubscriptionErrorCode is the error code ARM returns when
+	// the whole subscription is read only.
+	readOnlyDisabledSubscriptionErrorCode = "ReadOnlyDisabledSubscription"
+)
+
+// isScopeLockedError checks whether the given error was caused by a management
+// lock on the target scope.
+func isScopeLockedError(rerr *retry.Error) bool {
+	if rerr == nil || rerr.HTTPStatusCode != http.StatusForbidden || rerr.RawError == nil {
+		return false
+	}
+
+	errMessage := rerr.RawError.Error()
+	return strings.Contains(errMessage, scopeLockedErrorCode) ||
+		strings.Contains(errMessage, readOnlyDisabledSubscriptionErrorCode)
+}
+
+// markScopeLocked records a management lock detected on the resource group so
+// that writes against it are skipped during the configured cooldown. Read paths
+// are not affected, hence nodes won't be removed because of the lock.
+func (az *Cloud) markScopeLocked(service *v1.Service, resourceGroup string) {
+	cooldown := time.Duration(az.ResourceGroupLockCooldownInSeconds) * time.Second
+	az.lockedScopesLock.Lock()
+	az.lockedScopes[strings.ToLower(resourceGroup)] = time.Now().Add(cooldown)
+	az.lockedScopesLock.Unlock()
+
+	message := fmt.Sprintf("Resource group %q is locked by a management lock, writes against it are skipped for %s", resourceGroup, cooldown)
+	klog.Warning(message)
+	if service != nil {
+		az.Event(service, v1.EventTypeWarning, "ScopeLocked", message)
+	}
+}
+
+// checkScopeLockCooldown returns an error when writes against the resource
+// group are still within the cooldown triggered by a detected management lock.
+// Expired records are removed so that writes resume automatically.
+func (az *Cloud) checkScopeLockCooldown(resourceGroup string) error {
+	az.lockedScopesLock.Lock()
+	defer az.lockedScopesLock.Unlock()
+
+	expiry, ok := az.lockedScopes[strings.ToLower(resourceGroup)]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(expiry) {
+		delete(az.lockedScopes, strings.ToLower(resourceGroup))
+		return nil
+	}
+
+	return fmt.Errorf("resource group %q is locked by a management lock, writes against it are skipped until %s", resourceGroup, expiry.Format(time.RFC3339))
+}
@@ -0,0 +1,103 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/legacy-cloud-providers/azure/clients/publicipclient/mockpublicipclient"
+	"k8s.io/legacy-cloud-providers/azure/retry"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsScopeLockedError(t *testing.T) {
+	tests := []struct {
+		rerr     *retry.Error
+		expected bool
+	}{
+		{
+			rerr:     nil,
+			expected: false,
+		},
+		{
+			rerr:     &retry.Error{HTTPStatusCode: http.StatusInternalServerError},
+			expected: false,
+		},
+		{
+			rerr: &retry.Error{
+				HTTPStatusCode: http.StatusForbidden,
+				RawError:       fmt.Errorf("AuthorizationFailed"),
+			},
+			expected: false,
+		},
+		{
+			rerr: &retry.Error{
+				HTTPStatusCode: http.StatusForbidden,
+				RawError:       fmt.Errorf("Code=\"ScopeLocked\" Message=\"The scope is locked\""),
+			},
+			expected: true,
+		},
+		{
+			rerr: &retry.Error{
+				HTTPStatusCode: http.StatusForbidden,
+				RawError:       fmt.Errorf("Code=\"ReadOnlyDisabledSubscription\" Message=\"The subscription is disabled\""),
+			},
+			expected: true,
+		},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, isScopeLockedError(test.rerr))
+	}
+}
+
+func TestScopeLockCooldown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.ResourceGroupLockCooldownInSeconds = 300
+	mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPClient.EXPECT().CreateOrUpdate(gomock.Any(), az.ResourceGroup, "pip", gomock.Any()).Return(&retry.Error{
+		HTTPStatusCode: http.StatusForbidden,
+		RawError:       fmt.Errorf("Code=\"ScopeLocked\" Message=\"The scope is locked\""),
+	}).Times(1)
+
+	// The first write hits the lock and starts the cooldown.
+	err := az.CreateOrUpdatePIP(&v1.Service{}, az.ResourceGroup, network.PublicIPAddress{Name: to.StringPtr("pip")})
+	assert.Error(t, err)
+
+	// Subsequent writes against the same resource group are skipped without
+	// calling the client.
+	err = az.CreateOrUpdatePIP(&v1.Service{}, az.ResourceGroup, network.PublicIPAddress{Name: to.StringPtr("pip")})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "management lock")
+
+	// Writes against other resource groups are not affected.
+	mockPIPClient.EXPECT().CreateOrUpdate(gomock.Any(), "other-rg", "pip", gomock.Any()).Return(nil).Times(1)
+	err = az.CreateOrUpdatePIP(&v1.Service{}, "other-rg", network.PublicIPAddress{Name: to.StringPtr("pip")})
+	assert.NoError(t, err)
+}
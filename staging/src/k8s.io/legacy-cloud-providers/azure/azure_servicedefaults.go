@@ -0,0 +1,61 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// azureServiceAnnotationPrefix is the prefix all azure service annotations
+// share. DefaultServiceAnnotations may only default annotations under this
+// prefix, so the cloud config cannot silently override annotations consumed
+// by other controllers.
+const azureServiceAnnotationPrefix = "service.beta.kubernetes.io/azure-"
+
+// applyDefaultServiceAnnotations merges the DefaultServiceAnnotations of the
+// cloud config under the annotations of the service. Annotations set
+// explicitly on the service always win. The service object is shared with
+// the informer cache, so a defaulted service is returned as a copy and the
+// original is never mutated.
+func (az *Cloud) applyDefaultServiceAnnotations(service *v1.Service) *v1.Service {
+	if len(az.DefaultServiceAnnotations) == 0 || service == nil {
+		return service
+	}
+
+	missing := map[string]string{}
+	for key, value := range az.DefaultServiceAnnotations {
+		if _, ok := service.Annotations[key]; !ok {
+			missing[key] = value
+		}
+	}
+	if len(missing) == 0 {
+		return service
+	}
+
+	defaulted := service.DeepCopy()
+	if defaulted.Annotations == nil {
+		defaulted.Annotations = map[string]string{}
+	}
+	for key, value := range missing {
+		defaulted.Annotations[key] = value
+	}
+	klog.V(4).Infof("applyDefaultServiceAnnotations(%s): defaulted %d annotations from the cloud config", getServiceName(service), len(missing))
+	return defaulted
+}
@@ -0,0 +1,79 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestApplyDefaultServiceAnnotations(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+
+	// Without configured defaults the service is returned untouched.
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	assert.Same(t, &svc, az.applyDefaultServiceAnnotations(&svc))
+
+	az.DefaultServiceAnnotations = map[string]string{
+		ServiceAnnotationLoadBalancerInternal:    "true",
+		ServiceAnnotationLoadBalancerIdleTimeout: "15",
+	}
+
+	// Missing annotations are defaulted on a copy, the original service is
+	// not mutated.
+	defaulted := az.applyDefaultServiceAnnotations(&svc)
+	assert.False(t, defaulted == &svc)
+	assert.Equal(t, "true", defaulted.Annotations[ServiceAnnotationLoadBalancerInternal])
+	assert.Equal(t, "15", defaulted.Annotations[ServiceAnnotationLoadBalancerIdleTimeout])
+	assert.NotContains(t, svc.Annotations, ServiceAnnotationLoadBalancerInternal)
+
+	// Annotations set explicitly on the service win over the defaults.
+	svc.Annotations[ServiceAnnotationLoadBalancerInternal] = "false"
+	defaulted = az.applyDefaultServiceAnnotations(&svc)
+	assert.Equal(t, "false", defaulted.Annotations[ServiceAnnotationLoadBalancerInternal])
+	assert.Equal(t, "15", defaulted.Annotations[ServiceAnnotationLoadBalancerIdleTimeout])
+
+	// A service already carrying all defaulted annotations is returned as is.
+	svc.Annotations[ServiceAnnotationLoadBalancerIdleTimeout] = "4"
+	assert.Same(t, &svc, az.applyDefaultServiceAnnotations(&svc))
+}
+
+func TestDefaultServiceAnnotationsConfigValidation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	config := Config{
+		UseInstanceMetadata: true,
+		DefaultServiceAnnotations: map[string]string{
+			"example.com/not-azure": "true",
+		},
+	}
+
+	err := az.InitializeCloudFromConfig(&config, false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "defaultServiceAnnotations")
+}
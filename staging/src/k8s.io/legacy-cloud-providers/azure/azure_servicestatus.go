@@ -0,0 +1,113 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// ServiceAnnotationLoadBalancerReconcileStatus is the annotation the
+	// provider writes back to a service once a reconcile has established its
+	// load balancer backing. Its value is a JSON document carrying the time
+	// the backing was recorded, the owning load balancer name and the
+	// frontend IP configuration ID, so that the Azure backing of the service
+	// is visible with kubectl.
+	ServiceAnnotationLoadBalancerReconcileStatus = "service.beta.kubernetes.io/azure-load-balancer-reconcile-status"
+
+	// loadBalancerReadyEventReason is the event emitted together with the
+	// reconcile status annotation. The service API of this release does not
+	// carry conditions, hence the event plays the LoadBalancerReady role.
+	loadBalancerReadyEventReason = "LoadBalancerReady"
+)
+
+// serviceReconcileStatus is the payload of the reconcile status annotation.
+type serviceReconcileStatus struct {
+	LastReconcileTime  string `json:"lastReconcileTime"`
+	LoadBalancerName   string `json:"loadBalancerName"`
+	FrontendIPConfigID string `json:"frontendIPConfigID"`
+}
+
+// updateServiceReconcileStatus records a successful reconcile on the service
+// with the reconcile status annotation and a LoadBalancerReady event. The
+// service is only patched when the recorded backing actually changed: the
+// service controller treats any annotation change as a reason to resync, so
+// patching on every reconcile would re-queue the service in a permanent
+// loop. The annotation update is best effort: a failure is logged but never
+// fails the reconcile that already succeeded against Azure.
+func (az *Cloud) updateServiceReconcileStatus(service *v1.Service, lb *network.LoadBalancer) {
+	if lb == nil || lb.Name == nil {
+		return
+	}
+
+	status := serviceReconcileStatus{
+		LoadBalancerName:   *lb.Name,
+		FrontendIPConfigID: az.getFrontendIPConfigID(*lb.Name, az.getLoadBalancerResourceGroup(), az.getFrontendIPConfigName(service)),
+	}
+
+	if recorded, ok := service.Annotations[ServiceAnnotationLoadBalancerReconcileStatus]; ok {
+		var existing serviceReconcileStatus
+		if err := json.Unmarshal([]byte(recorded), &existing); err == nil &&
+			existing.LoadBalancerName == status.LoadBalancerName &&
+			existing.FrontendIPConfigID == status.FrontendIPConfigID {
+			return
+		}
+	}
+	status.LastReconcileTime = time.Now().UTC().Format(time.RFC3339)
+
+	az.Event(service, v1.EventTypeNormal, loadBalancerReadyEventReason,
+		fmt.Sprintf("ensured load balancer %s with frontend IP configuration %s", status.LoadBalancerName, status.FrontendIPConfigID))
+
+	if az.KubeClient == nil {
+		return
+	}
+
+	payload, err := json.Marshal(status)
+	if err != nil {
+		klog.Warningf("updateServiceReconcileStatus(%s): failed to marshal the reconcile status: %v", getServiceName(service), err)
+		return
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				ServiceAnnotationLoadBalancerReconcileStatus: string(payload),
+			},
+		},
+	})
+	if err != nil {
+		klog.Warningf("updateServiceReconcileStatus(%s): failed to marshal the annotation patch: %v", getServiceName(service), err)
+		return
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	if _, err := az.KubeClient.CoreV1().Services(service.Namespace).Patch(ctx, service.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		klog.Warningf("updateServiceReconcileStatus(%s): failed to patch the reconcile status annotation: %v", getServiceName(service), err)
+	}
+}
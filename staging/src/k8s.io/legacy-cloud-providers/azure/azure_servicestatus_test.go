@@ -0,0 +1,103 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakeclient "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestUpdateServiceReconcileStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	az.KubeClient = fakeclient.NewSimpleClientset(&svc)
+
+	lb := network.LoadBalancer{Name: to.StringPtr("lb")}
+	az.updateServiceReconcileStatus(&svc, &lb)
+
+	updated, err := az.KubeClient.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+
+	var status serviceReconcileStatus
+	assert.NoError(t, json.Unmarshal([]byte(updated.Annotations[ServiceAnnotationLoadBalancerReconcileStatus]), &status))
+	assert.Equal(t, "lb", status.LoadBalancerName)
+	assert.NotEmpty(t, status.LastReconcileTime)
+	assert.Contains(t, status.FrontendIPConfigID, az.getFrontendIPConfigName(&svc))
+
+	// A nil load balancer or a missing kube client must not panic.
+	az.updateServiceReconcileStatus(&svc, nil)
+	az.KubeClient = nil
+	az.updateServiceReconcileStatus(&svc, &lb)
+}
+
+func TestUpdateServiceReconcileStatusSkipsUnchangedBacking(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	az.KubeClient = fakeclient.NewSimpleClientset(&svc)
+
+	lb := network.LoadBalancer{Name: to.StringPtr("lb")}
+	az.updateServiceReconcileStatus(&svc, &lb)
+
+	updated, err := az.KubeClient.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	recorded := updated.Annotations[ServiceAnnotationLoadBalancerReconcileStatus]
+
+	// A reconcile that leaves the backing unchanged shall not patch the
+	// service again: the service controller resyncs on any annotation
+	// change, so a fresh timestamp per reconcile would loop forever.
+	var patched bool
+	az.KubeClient.(*fakeclient.Clientset).PrependReactor("patch", "services",
+		func(action clienttesting.Action) (bool, runtime.Object, error) {
+			patched = true
+			return false, nil, nil
+		})
+	az.updateServiceReconcileStatus(updated, &lb)
+	assert.False(t, patched)
+
+	// A moved backing is recorded again.
+	otherLb := network.LoadBalancer{Name: to.StringPtr("other-lb")}
+	az.updateServiceReconcileStatus(updated, &otherLb)
+	assert.True(t, patched)
+
+	updated, err = az.KubeClient.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.NotEqual(t, recorded, updated.Annotations[ServiceAnnotationLoadBalancerReconcileStatus])
+
+	var status serviceReconcileStatus
+	assert.NoError(t, json.Unmarshal([]byte(updated.Annotations[ServiceAnnotationLoadBalancerReconcileStatus]), &status))
+	assert.Equal(t, "other-lb", status.LoadBalancerName)
+}
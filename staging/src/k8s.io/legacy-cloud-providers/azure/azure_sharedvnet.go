@@ -0,0 +1,117 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// sharedVNetResourcePrefixFmt formats the name prefix added to rules and
+	// routes this cluster creates on resources shared with other clusters.
+	sharedVNetResourcePrefixFmt = "k8s-%s-"
+
+	// sharedVNetTagKeyFmt formats the tag key under which a cluster records its
+	// identity on shared resources, so that operators can map name prefixes
+	// back to the owning cluster.
+	sharedVNetTagKeyFmt = "k8s-cluster-%s"
+
+	// sharedVNetManagedNamePrefix marks rules and routes that carry a
+	// coordination prefix. Names without it are treated as this cluster's
+	// legacy resources for backward compatibility.
+	sharedVNetManagedNamePrefix = "k8s-"
+
+	// sharedVNetConflictEventReason is the event reason emitted when a rule
+	// managed by this cluster conflicts with one owned by another cluster.
+	sharedVNetConflictEventReason = "SharedVNetConflict"
+)
+
+// sharedResourcePrefix returns the name prefix used on security rules and
+// routes this cluster creates on shared VNet resources. It is empty when
+// shared VNet coordination is disabled, keeping names unchanged.
+func (az *Cloud) sharedResourcePrefix(clusterName string) string {
+	if !az.SharedVNetCoordination {
+		return ""
+	}
+	return fmt.Sprintf(sharedVNetResourcePrefixFmt, MakeCRC32(clusterName))
+}
+
+// sharedResourceTagKey returns the tag key namespacing this cluster's
+// coordination metadata on shared resources.
+func sharedResourceTagKey(clusterName string) string {
+	return fmt.Sprintf(sharedVNetTagKeyFmt, MakeCRC32(clusterName))
+}
+
+// ensureSharedResourceTags records this cluster's tag namespace in the given
+// resource tags and reports whether they were changed.
+func (az *Cloud) ensureSharedResourceTags(clusterName string, tags map[string]*string) (map[string]*string, bool) {
+	key := sharedResourceTagKey(clusterName)
+	if existing, ok := tags[key]; ok && strings.EqualFold(to.String(existing), clusterName) {
+		return tags, false
+	}
+	if tags == nil {
+		tags = make(map[string]*string)
+	}
+	tags[key] = to.StringPtr(clusterName)
+	return tags, true
+}
+
+// isOtherClustersSharedResource reports whether the rule or route name carries
+// a coordination prefix of a cluster different from the one owning the given
+// prefix. Names without any coordination prefix are not considered foreign so
+// that resources created before coordination was enabled keep being managed.
+func isOtherClustersSharedResource(prefix, name string) bool {
+	if prefix == "" || !strings.HasPrefix(name, sharedVNetManagedNamePrefix) {
+		return false
+	}
+	return !strings.HasPrefix(name, prefix)
+}
+
+// ownedByOtherCluster reports whether the named rule or route on a shared
+// resource was created by another cluster and hence must not be mutated.
+func (az *Cloud) ownedByOtherCluster(clusterName, name string) bool {
+	return isOtherClustersSharedResource(az.sharedResourcePrefix(clusterName), name)
+}
+
+// detectSharedRuleConflict emits a warning event when the expected rule has an
+// unprefixed twin in the security group, which indicates another cluster not
+// running shared VNet coordination manages a rule with the same semantics.
+func (az *Cloud) detectSharedRuleConflict(clusterName string, service *v1.Service, rules []network.SecurityRule, expectedRuleName string) {
+	prefix := az.sharedResourcePrefix(clusterName)
+	if prefix == "" || !strings.HasPrefix(expectedRuleName, prefix) {
+		return
+	}
+
+	legacyName := strings.TrimPrefix(expectedRuleName, prefix)
+	for _, rule := range rules {
+		if strings.EqualFold(to.String(rule.Name), legacyName) {
+			message := fmt.Sprintf("Security rule %q conflicts with rule %q owned by a cluster without shared VNet coordination", expectedRuleName, legacyName)
+			klog.Warning(message)
+			az.Event(service, v1.EventTypeWarning, sharedVNetConflictEventReason, message)
+			return
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSharedResourcePrefix(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	assert.Equal(t, "", az.sharedResourcePrefix("kubernetes"))
+
+	az.SharedVNetCoordination = true
+	prefix := az.sharedResourcePrefix("kubernetes")
+	assert.Equal(t, fmt.Sprintf("k8s-%s-", MakeCRC32("kubernetes")), prefix)
+}
+
+func TestOwnedByOtherCluster(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.SharedVNetCoordination = true
+	ownPrefix := az.sharedResourcePrefix("kubernetes")
+	otherPrefix := fmt.Sprintf("k8s-%s-", MakeCRC32("other-cluster"))
+
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{
+			name:     ownPrefix + "shared-TCP-80-Internet",
+			expected: false,
+		},
+		{
+			name:     otherPrefix + "shared-TCP-80-Internet",
+			expected: true,
+		},
+		{
+			// Legacy names without a coordination prefix keep being managed.
+			name:     "shared-TCP-80-Internet",
+			expected: false,
+		},
+		{
+			name:     "node-1",
+			expected: false,
+		},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, az.ownedByOtherCluster("kubernetes", test.name), test.name)
+	}
+
+	// Everything is considered owned when coordination is disabled.
+	az.SharedVNetCoordination = false
+	assert.False(t, az.ownedByOtherCluster("kubernetes", otherPrefix+"shared-TCP-80-Internet"))
+}
+
+func TestEnsureSharedResourceTags(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.SharedVNetCoordination = true
+
+	tags, changed := az.ensureSharedResourceTags("kubernetes", nil)
+	assert.True(t, changed)
+	assert.Equal(t, "kubernetes", to.String(tags[sharedResourceTagKey("kubernetes")]))
+
+	// The second call is a no-op.
+	tags, changed = az.ensureSharedResourceTags("kubernetes", tags)
+	assert.False(t, changed)
+
+	// Other clusters' tag namespaces are kept.
+	tags, changed = az.ensureSharedResourceTags("other-cluster", tags)
+	assert.True(t, changed)
+	assert.Len(t, tags, 2)
+}
@@ -0,0 +1,183 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-12-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	"k8s.io/apimachinery/pkg/types"
+	azcache "k8s.io/legacy-cloud-providers/azure/cache"
+)
+
+const (
+	// nodeLabelGPUCount is the node label exposing the number of GPUs of the
+	// VM size.
+	nodeLabelGPUCount = "kubernetes.azure.com/gpu-count"
+	// nodeLabelGPUFamily is the node label exposing the SKU family of VM
+	// sizes with GPUs, e.g. standardNCSv3Family.
+	nodeLabelGPUFamily = "kubernetes.azure.com/gpu-family"
+	// nodeLabelEphemeralOSDisk is the node label exposing ephemeral OS disk
+	// support of the VM size.
+	nodeLabelEphemeralOSDisk = "kubernetes.azure.com/ephemeral-os-disk"
+
+	// skuCapabilityGPUs is the resource SKU capability holding the GPU count.
+	skuCapabilityGPUs = "GPUs"
+	// skuCapabilityEphemeralOSDisk is the resource SKU capability telling
+	// whether the size supports ephemeral OS disks.
+	skuCapabilityEphemeralOSDisk = "EphemeralOSDiskSupported"
+
+	// skuCapabilityCacheTTL is the lifetime of the resolved capability map.
+	// SKU capabilities only change when Azure rolls out new sizes, so a long
+	// TTL keeps the subscription-wide SKU listing rare.
+	skuCapabilityCacheTTL = 24 * time.Hour
+)
+
+// vmSizeCapabilities holds the scheduling-relevant capabilities of a VM size.
+type vmSizeCapabilities struct {
+	gpuCount        string
+	gpuFamily       string
+	ephemeralOSDisk bool
+}
+
+// newSkuCapabilityCache builds a timed cache over the capability maps of the
+// subscription's VM sizes, keyed by location.
+func (az *Cloud) newSkuCapabilityCache() (*azcache.TimedCache, error) {
+	getter := func(key string) (interface{}, error) {
+		ctx, cancel := getContextWithCancel()
+		defer cancel()
+
+		skus, rerr := az.VirtualMachineSizesClient.ListSkus(ctx)
+		if rerr != nil {
+			return nil, rerr.Error()
+		}
+
+		capabilities := map[string]vmSizeCapabilities{}
+		for i := range skus {
+			sku := skus[i]
+			if !strings.EqualFold(to.String(sku.ResourceType), "virtualMachines") || !skuHasLocation(&sku, key) {
+				continue
+			}
+
+			vmCapabilities := vmSizeCapabilities{}
+			if sku.Capabilities != nil {
+				for _, capability := range *sku.Capabilities {
+					switch to.String(capability.Name) {
+					case skuCapabilityGPUs:
+						vmCapabilities.gpuCount = to.String(capability.Value)
+						vmCapabilities.gpuFamily = to.String(sku.Family)
+					case skuCapabilityEphemeralOSDisk:
+						vmCapabilities.ephemeralOSDisk = strings.EqualFold(to.String(capability.Value), "True")
+					}
+				}
+			}
+			capabilities[strings.ToLower(to.String(sku.Name))] = vmCapabilities
+		}
+
+		return capabilities, nil
+	}
+
+	return azcache.NewNamedTimedCache("skuCapabilities", skuCapabilityCacheTTL, getter)
+}
+
+// skuHasLocation reports whether the resource SKU is offered in the location.
+func skuHasLocation(sku *compute.ResourceSku, location string) bool {
+	if sku.Locations == nil {
+		return false
+	}
+	for _, skuLocation := range *sku.Locations {
+		if strings.EqualFold(skuLocation, location) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetNodeCapabilityLabels returns the labels describing the GPU and ephemeral
+// OS disk capabilities of the node's VM size, resolved from the subscription's
+// resource SKUs. The VM size of the local instance is served from instance
+// metadata when UseInstanceMetadata is set. Sizes without GPUs or ephemeral
+// OS disk support yield no labels, so schedulers and device-plugin automation
+// can rely on label presence alone.
+func (az *Cloud) GetNodeCapabilityLabels(name types.NodeName) (map[string]string, error) {
+	unmanaged, err := az.IsNodeUnmanaged(string(name))
+	if err != nil {
+		return nil, err
+	}
+	if unmanaged {
+		return nil, nil
+	}
+
+	vmSize := ""
+	if az.UseInstanceMetadata {
+		metadata, err := az.metadata.GetMetadata(azcache.CacheReadTypeDefault)
+		if err != nil {
+			return nil, err
+		}
+		if metadata.Compute != nil {
+			isLocalInstance, err := az.isCurrentInstance(name, metadata.Compute.Name)
+			if err != nil {
+				return nil, err
+			}
+			if isLocalInstance {
+				vmSize = metadata.Compute.VMSize
+			}
+		}
+	}
+	if vmSize == "" {
+		vmSize, err = az.VMSet.GetInstanceTypeByNodeName(string(name))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cached, err := az.skuCapabilityCache.Get(az.Location, azcache.CacheReadTypeDefault)
+	if err != nil {
+		return nil, err
+	}
+	capabilities, ok := cached.(map[string]vmSizeCapabilities)
+	if !ok {
+		return nil, fmt.Errorf("failed to resolve SKU capabilities for location %q", az.Location)
+	}
+
+	vmCapabilities, found := capabilities[strings.ToLower(vmSize)]
+	if !found {
+		return nil, nil
+	}
+
+	labels := map[string]string{}
+	if vmCapabilities.gpuCount != "" && vmCapabilities.gpuCount != "0" {
+		labels[nodeLabelGPUCount] = vmCapabilities.gpuCount
+		if vmCapabilities.gpuFamily != "" {
+			labels[nodeLabelGPUFamily] = vmCapabilities.gpuFamily
+		}
+	}
+	if vmCapabilities.ephemeralOSDisk {
+		labels[nodeLabelEphemeralOSDisk] = "true"
+	}
+
+	if len(labels) == 0 {
+		return nil, nil
+	}
+	return labels, nil
+}
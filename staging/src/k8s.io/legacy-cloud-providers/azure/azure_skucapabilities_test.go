@@ -0,0 +1,156 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-12-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/legacy-cloud-providers/azure/clients/vmclient/mockvmclient"
+	"k8s.io/legacy-cloud-providers/azure/clients/vmsizeclient/mockvmsizeclient"
+)
+
+func getTestResourceSkus() []compute.ResourceSku {
+	return []compute.ResourceSku{
+		{
+			Name:         to.StringPtr("Standard_NC6"),
+			ResourceType: to.StringPtr("virtualMachines"),
+			Family:       to.StringPtr("standardNCFamily"),
+			Locations:    &[]string{"westus"},
+			Capabilities: &[]compute.ResourceSkuCapabilities{
+				{Name: to.StringPtr("GPUs"), Value: to.StringPtr("1")},
+				{Name: to.StringPtr("EphemeralOSDiskSupported"), Value: to.StringPtr("False")},
+			},
+		},
+		{
+			Name:         to.StringPtr("Standard_DS2_v2"),
+			ResourceType: to.StringPtr("virtualMachines"),
+			Family:       to.StringPtr("standardDSv2Family"),
+			Locations:    &[]string{"westus"},
+			Capabilities: &[]compute.ResourceSkuCapabilities{
+				{Name: to.StringPtr("EphemeralOSDiskSupported"), Value: to.StringPtr("True")},
+			},
+		},
+		{
+			Name:         to.StringPtr("Standard_A0"),
+			ResourceType: to.StringPtr("virtualMachines"),
+			Family:       to.StringPtr("standardA0_A7Family"),
+			Locations:    &[]string{"westus"},
+			Capabilities: &[]compute.ResourceSkuCapabilities{
+				{Name: to.StringPtr("GPUs"), Value: to.StringPtr("0")},
+			},
+		},
+		{
+			Name:         to.StringPtr("Standard_NC24"),
+			ResourceType: to.StringPtr("virtualMachines"),
+			Family:       to.StringPtr("standardNCFamily"),
+			Locations:    &[]string{"eastus"},
+			Capabilities: &[]compute.ResourceSkuCapabilities{
+				{Name: to.StringPtr("GPUs"), Value: to.StringPtr("4")},
+			},
+		},
+		{
+			Name:         to.StringPtr("Premium_LRS"),
+			ResourceType: to.StringPtr("disks"),
+			Locations:    &[]string{"westus"},
+		},
+	}
+}
+
+func TestGetNodeCapabilityLabels(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testcases := []struct {
+		description    string
+		vmSize         string
+		expectedLabels map[string]string
+	}{
+		{
+			description: "GPU sizes expose the GPU count and family",
+			vmSize:      "Standard_NC6",
+			expectedLabels: map[string]string{
+				"kubernetes.azure.com/gpu-count":  "1",
+				"kubernetes.azure.com/gpu-family": "standardNCFamily",
+			},
+		},
+		{
+			description: "sizes supporting ephemeral OS disks are labeled",
+			vmSize:      "Standard_DS2_v2",
+			expectedLabels: map[string]string{
+				"kubernetes.azure.com/ephemeral-os-disk": "true",
+			},
+		},
+		{
+			description: "sizes without GPUs or ephemeral OS disk support yield no labels",
+			vmSize:      "Standard_A0",
+		},
+		{
+			description: "sizes not offered in the location yield no labels",
+			vmSize:      "Standard_NC24",
+		},
+	}
+
+	for _, test := range testcases {
+		az := GetTestCloud(ctrl)
+		mockVMSizesClient := az.VirtualMachineSizesClient.(*mockvmsizeclient.MockInterface)
+		mockVMSizesClient.EXPECT().ListSkus(gomock.Any()).Return(getTestResourceSkus(), nil).Times(1)
+
+		vm := compute.VirtualMachine{
+			Name: to.StringPtr("vm1"),
+			VirtualMachineProperties: &compute.VirtualMachineProperties{
+				ProvisioningState: to.StringPtr(string(compute.ProvisioningStateSucceeded)),
+				HardwareProfile: &compute.HardwareProfile{
+					VMSize: compute.VirtualMachineSizeTypes(test.vmSize),
+				},
+			},
+		}
+		mockVMClient := az.VirtualMachinesClient.(*mockvmclient.MockInterface)
+		mockVMClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, "vm1", gomock.Any()).Return(vm, nil).Times(1)
+
+		labels, err := az.GetNodeCapabilityLabels(types.NodeName("vm1"))
+		assert.NoError(t, err, test.description)
+		assert.Equal(t, test.expectedLabels, labels, test.description)
+	}
+}
+
+func TestSkuCapabilityCacheIsSharedAcrossNodes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	mockVMSizesClient := az.VirtualMachineSizesClient.(*mockvmsizeclient.MockInterface)
+	mockVMSizesClient.EXPECT().ListSkus(gomock.Any()).Return(getTestResourceSkus(), nil).Times(1)
+
+	expectedVMs := setTestVirtualMachines(az, map[string]string{"vm1": "PowerState/Running", "vm2": "PowerState/Running"}, false)
+	mockVMClient := az.VirtualMachinesClient.(*mockvmclient.MockInterface)
+	mockVMClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, gomock.Any(), gomock.Any()).Return(expectedVMs[0], nil).AnyTimes()
+
+	// The SKU listing is only issued once even though two nodes are resolved.
+	for _, nodeName := range []string{"vm1", "vm2"} {
+		labels, err := az.GetNodeCapabilityLabels(types.NodeName(nodeName))
+		assert.NoError(t, err)
+		assert.Nil(t, labels)
+	}
+}
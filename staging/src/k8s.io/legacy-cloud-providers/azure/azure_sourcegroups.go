@@ -0,0 +1,159 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	utilnet "k8s.io/utils/net"
+
+	"k8s.io/klog/v2"
+)
+
+// sourceRangeGroupNameRE restricts group names to characters that are valid in
+// security rule names, so that the group name can be embedded verbatim.
+var sourceRangeGroupNameRE = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// sourceRangeGroup is a named subset of the service's loadBalancerSourceRanges
+// declared via ServiceAnnotationLoadBalancerSourceRangeGroups. All prefixes of
+// a group are emitted as a single security rule carrying the group name, so
+// that large source range sets stay auditable in the portal.
+type sourceRangeGroup struct {
+	name     string
+	prefixes []string
+}
+
+// sourceRangeGroupPrefix returns the rule name segment standing in for the
+// source prefix of a grouped security rule. The "grp-" marker keeps group
+// names from colliding with sanitized CIDR segments of ungrouped rules.
+func sourceRangeGroupPrefix(name string) string {
+	return "grp-" + name
+}
+
+// parseSourceRangeGroups parses ServiceAnnotationLoadBalancerSourceRangeGroups
+// into named groups with canonicalized CIDRs. It returns nil when the service
+// does not carry the annotation.
+func parseSourceRangeGroups(service *v1.Service) ([]sourceRangeGroup, error) {
+	annotation, found := service.Annotations[ServiceAnnotationLoadBalancerSourceRangeGroups]
+	if !found || strings.TrimSpace(annotation) == "" {
+		return nil, nil
+	}
+
+	seenNames := map[string]bool{}
+	var groups []sourceRangeGroup
+	for _, entry := range strings.Split(annotation, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid source range group %q: expected format <name>=<cidr>[,<cidr>...]", entry)
+		}
+		name := strings.TrimSpace(parts[0])
+		if !sourceRangeGroupNameRE.MatchString(name) {
+			return nil, fmt.Errorf("invalid source range group name %q", name)
+		}
+		if seenNames[strings.ToLower(name)] {
+			return nil, fmt.Errorf("duplicate source range group name %q", name)
+		}
+		seenNames[strings.ToLower(name)] = true
+
+		var prefixes []string
+		for _, cidr := range strings.Split(parts[1], ",") {
+			cidr = strings.TrimSpace(cidr)
+			if cidr == "" {
+				continue
+			}
+			_, ipnet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q in source range group %q", cidr, name)
+			}
+			prefixes = append(prefixes, ipnet.String())
+		}
+		if len(prefixes) == 0 {
+			return nil, fmt.Errorf("source range group %q has no CIDRs", name)
+		}
+		sort.Strings(prefixes)
+		groups = append(groups, sourceRangeGroup{name: name, prefixes: prefixes})
+	}
+
+	sort.Slice(groups, func(i, j int) bool { return groups[i].name < groups[j].name })
+	return groups, nil
+}
+
+// groupSourceAddressPrefixes splits the source address prefixes of the service
+// into the named groups of ServiceAnnotationLoadBalancerSourceRangeGroups and
+// the ungrouped remainder. Every grouped CIDR must be one of the service's
+// source ranges: the groups only rename and bundle ranges, they cannot widen
+// them. Group prefixes of the other IP family are skipped like ungrouped ones,
+// mirroring the per-family reconcile of dual-stack services.
+func (az *Cloud) groupSourceAddressPrefixes(service *v1.Service, sourceAddressPrefixes []string, destinationIsIPv6 bool) ([]sourceRangeGroup, []string, error) {
+	groups, err := parseSourceRangeGroups(service)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(groups) == 0 {
+		return nil, sourceAddressPrefixes, nil
+	}
+
+	available := map[string]bool{}
+	for _, prefix := range sourceAddressPrefixes {
+		available[prefix] = true
+	}
+
+	grouped := map[string]bool{}
+	var filteredGroups []sourceRangeGroup
+	for _, group := range groups {
+		var prefixes []string
+		for _, prefix := range group.prefixes {
+			_, ipnet, err := net.ParseCIDR(prefix)
+			if err != nil {
+				// Validated by parseSourceRangeGroups already.
+				return nil, nil, err
+			}
+			if utilnet.IsIPv6CIDR(ipnet) != destinationIsIPv6 {
+				klog.V(4).Infof("groupSourceAddressPrefixes(%s): skipping prefix %s of group %s, not of the IP family of the frontend IP", getServiceName(service), prefix, group.name)
+				continue
+			}
+			if !available[prefix] {
+				return nil, nil, fmt.Errorf("source range group %q: %s is not one of the load balancer source ranges of the service", group.name, prefix)
+			}
+			grouped[prefix] = true
+			prefixes = append(prefixes, prefix)
+		}
+		if len(prefixes) == 0 {
+			continue
+		}
+		filteredGroups = append(filteredGroups, sourceRangeGroup{name: group.name, prefixes: prefixes})
+	}
+
+	var ungrouped []string
+	for _, prefix := range sourceAddressPrefixes {
+		if !grouped[prefix] {
+			ungrouped = append(ungrouped, prefix)
+		}
+	}
+	return filteredGroups, ungrouped, nil
+}
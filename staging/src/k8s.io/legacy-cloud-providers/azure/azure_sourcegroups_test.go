@@ -0,0 +1,185 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestParseSourceRangeGroups(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		annotation  string
+		expected    []sourceRangeGroup
+		expectedErr bool
+	}{
+		{
+			desc:     "services without the annotation shall have no groups",
+			expected: nil,
+		},
+		{
+			desc:       "groups shall be parsed with canonical CIDRs and sorted",
+			annotation: "partner=192.0.2.0/24;office=203.0.113.5/24, 198.51.100.0/24",
+			expected: []sourceRangeGroup{
+				{name: "office", prefixes: []string{"198.51.100.0/24", "203.0.113.0/24"}},
+				{name: "partner", prefixes: []string{"192.0.2.0/24"}},
+			},
+		},
+		{
+			desc:        "entries without an equals sign shall be rejected",
+			annotation:  "office",
+			expectedErr: true,
+		},
+		{
+			desc:        "invalid group names shall be rejected",
+			annotation:  "bad/name=192.0.2.0/24",
+			expectedErr: true,
+		},
+		{
+			desc:        "duplicate group names shall be rejected",
+			annotation:  "office=192.0.2.0/24;Office=198.51.100.0/24",
+			expectedErr: true,
+		},
+		{
+			desc:        "invalid CIDRs shall be rejected",
+			annotation:  "office=192.0.2.0",
+			expectedErr: true,
+		},
+		{
+			desc:        "groups without CIDRs shall be rejected",
+			annotation:  "office=",
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+		if test.annotation != "" {
+			svc.Annotations[ServiceAnnotationLoadBalancerSourceRangeGroups] = test.annotation
+		}
+		groups, err := parseSourceRangeGroups(&svc)
+		if test.expectedErr {
+			assert.Error(t, err, test.desc)
+			continue
+		}
+		assert.NoError(t, err, test.desc)
+		assert.Equal(t, test.expected, groups, test.desc)
+	}
+}
+
+func TestGroupSourceAddressPrefixes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	prefixes := []string{"192.0.2.0/24", "198.51.100.0/24", "203.0.113.0/24"}
+
+	testCases := []struct {
+		desc              string
+		annotation        string
+		destinationIsIPv6 bool
+		expectedGroups    []sourceRangeGroup
+		expectedUngrouped []string
+		expectedErr       string
+	}{
+		{
+			desc:              "prefixes shall stay ungrouped without the annotation",
+			expectedUngrouped: prefixes,
+		},
+		{
+			desc:       "grouped prefixes shall leave the ungrouped remainder",
+			annotation: "office=203.0.113.0/24,198.51.100.0/24",
+			expectedGroups: []sourceRangeGroup{
+				{name: "office", prefixes: []string{"198.51.100.0/24", "203.0.113.0/24"}},
+			},
+			expectedUngrouped: []string{"192.0.2.0/24"},
+		},
+		{
+			desc:        "groups shall not widen the load balancer source ranges",
+			annotation:  "office=10.0.0.0/8",
+			expectedErr: "not one of the load balancer source ranges",
+		},
+		{
+			desc:              "group prefixes of the other IP family shall be skipped",
+			annotation:        "office=2001:db8::/32",
+			destinationIsIPv6: false,
+			expectedUngrouped: prefixes,
+		},
+	}
+
+	for _, test := range testCases {
+		svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+		if test.annotation != "" {
+			svc.Annotations[ServiceAnnotationLoadBalancerSourceRangeGroups] = test.annotation
+		}
+		groups, ungrouped, err := az.groupSourceAddressPrefixes(&svc, prefixes, test.destinationIsIPv6)
+		if test.expectedErr != "" {
+			if assert.Error(t, err, test.desc) {
+				assert.Contains(t, err.Error(), test.expectedErr, test.desc)
+			}
+			continue
+		}
+		assert.NoError(t, err, test.desc)
+		assert.Equal(t, test.expectedGroups, groups, test.desc)
+		assert.Equal(t, test.expectedUngrouped, ungrouped, test.desc)
+	}
+}
+
+func TestReconcileSecurityGroupSourceRangeGroups(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("servicea", v1.ProtocolTCP, map[string]string{
+		ServiceAnnotationLoadBalancerSourceRangeGroups: "office=203.0.113.0/24,198.51.100.0/24",
+	}, false, 80)
+	svc.Spec.LoadBalancerSourceRanges = []string{"203.0.113.0/24", "198.51.100.0/24", "192.0.2.0/24"}
+
+	sg := getTestSecurityGroup(az)
+	setMockSecurityGroup(az, ctrl, sg)
+
+	sg, err := az.reconcileSecurityGroup(testClusterName, &svc, to.StringPtr("1.2.3.4"), true)
+	assert.NoError(t, err)
+
+	// The grouped ranges end up in one rule named after the group, the
+	// remaining range keeps its per-CIDR rule.
+	_, groupRule, found := findSecurityRuleByName(*sg.SecurityRules, "aservicea-TCP-80-grp-office")
+	if assert.True(t, found, "expected the grouped security rule to be present") {
+		assert.Nil(t, groupRule.SourceAddressPrefix)
+		assert.Equal(t, []string{"198.51.100.0/24", "203.0.113.0/24"}, *groupRule.SourceAddressPrefixes)
+		assert.Equal(t, "1.2.3.4", *groupRule.DestinationAddressPrefix)
+	}
+
+	_, cidrRule, found := findSecurityRuleByName(*sg.SecurityRules, "aservicea-TCP-80-192.0.2.0_24")
+	if assert.True(t, found, "expected the ungrouped security rule to be present") {
+		assert.Equal(t, "192.0.2.0/24", *cidrRule.SourceAddressPrefix)
+	}
+
+	// A group referencing a range outside the service's source ranges fails
+	// the reconcile instead of widening the rule set.
+	svc.Annotations[ServiceAnnotationLoadBalancerSourceRangeGroups] = "office=10.0.0.0/8"
+	_, err = az.reconcileSecurityGroup(testClusterName, &svc, to.StringPtr("1.2.3.4"), true)
+	assert.Error(t, err)
+}
@@ -27,6 +27,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-12-01/compute"
 	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
@@ -62,6 +63,11 @@ const (
 	// InternalLoadBalancerNameSuffix is load balancer posfix
 	InternalLoadBalancerNameSuffix = "-internal"
 
+	// GlobalInternalLoadBalancerNameSuffix is the suffix of cross-region
+	// (global tier) internal load balancers. Global and regional tier
+	// frontends cannot share a load balancer, so they get a separate name.
+	GlobalInternalLoadBalancerNameSuffix = "-global-internal"
+
 	// nodeLabelRole specifies the role of a node
 	nodeLabelRole  = "kubernetes.io/role"
 	nicFailedState = "Failed"
@@ -132,11 +138,23 @@ func (az *Cloud) getNetworkResourceSubscriptionID() string {
 	return az.SubscriptionID
 }
 
+// trimLoadBalancerNameSuffixes strips the internal load balancer name
+// suffixes, so public, internal and global internal load balancers of the
+// same prefix map to the same name.
+func trimLoadBalancerNameSuffixes(lbName string) string {
+	lbName = strings.TrimSuffix(lbName, GlobalInternalLoadBalancerNameSuffix)
+	return strings.TrimSuffix(lbName, InternalLoadBalancerNameSuffix)
+}
+
 func (az *Cloud) mapLoadBalancerNameToVMSet(lbName string, clusterName string) (vmSetName string) {
-	vmSetName = strings.TrimSuffix(lbName, InternalLoadBalancerNameSuffix)
+	vmSetName = trimLoadBalancerNameSuffixes(lbName)
 	if strings.EqualFold(clusterName, vmSetName) {
 		vmSetName = az.VMSet.GetPrimaryVMSetName()
 	}
+	// Multi-SLB load balancers span node pools like the cluster default one.
+	if az.useMultipleStandardLoadBalancers() && az.getMultipleStandardLBConfigByName(lbName) != nil {
+		vmSetName = az.VMSet.GetPrimaryVMSetName()
+	}
 
 	return vmSetName
 }
@@ -145,7 +163,10 @@ func (az *Cloud) mapLoadBalancerNameToVMSet(lbName string, clusterName string) (
 // Thus Azure do not allow mixed type (public and internal) load balancer.
 // So we'd have a separate name for internal load balancer.
 // This would be the name for Azure LoadBalancer resource.
-func (az *Cloud) getAzureLoadBalancerName(clusterName string, vmSetName string, isInternal bool) string {
+func (az *Cloud) getAzureLoadBalancerName(service *v1.Service, clusterName string, vmSetName string, isInternal bool) string {
+	if az.resourceNamer != nil {
+		return az.resourceNamer.LoadBalancerName(service, clusterName, vmSetName, isInternal)
+	}
 	if az.LoadBalancerName != "" {
 		clusterName = az.LoadBalancerName
 	}
@@ -153,7 +174,15 @@ func (az *Cloud) getAzureLoadBalancerName(clusterName string, vmSetName string,
 	if strings.EqualFold(vmSetName, az.VMSet.GetPrimaryVMSetName()) || az.useStandardLoadBalancer() {
 		lbNamePrefix = clusterName
 	}
+	if az.useMultipleStandardLoadBalancers() {
+		if multiSLBConfig := az.getMultipleStandardLBConfigForService(service); multiSLBConfig != nil {
+			lbNamePrefix = multiSLBConfig.Name
+		}
+	}
 	if isInternal {
+		if requiresGlobalInternalLoadBalancer(service) {
+			return fmt.Sprintf("%s%s", lbNamePrefix, GlobalInternalLoadBalancerNameSuffix)
+		}
 		return fmt.Sprintf("%s%s", lbNamePrefix, InternalLoadBalancerNameSuffix)
 	}
 	return lbNamePrefix
@@ -198,8 +227,16 @@ func getProtocolsFromKubernetesProtocol(protocol v1.Protocol) (*network.Transpor
 		transportProto = network.TransportProtocolUDP
 		securityProto = network.SecurityRuleProtocolUDP
 		return &transportProto, &securityProto, nil, nil
+	case v1.ProtocolSCTP:
+		// The network API has no native SCTP transport protocol, so SCTP is
+		// carried by an HA-ports rule (protocol All), which forwards every
+		// protocol and port. The matching security rule opens all protocols
+		// for the same reason.
+		transportProto = network.TransportProtocolAll
+		securityProto = network.SecurityRuleProtocolAsterisk
+		return &transportProto, &securityProto, nil, nil
 	default:
-		return &transportProto, &securityProto, &probeProto, fmt.Errorf("only TCP and UDP are supported for Azure LoadBalancers")
+		return &transportProto, &securityProto, &probeProto, fmt.Errorf("only TCP, UDP and SCTP are supported for Azure LoadBalancers")
 	}
 
 }
@@ -237,6 +274,44 @@ func getPrimaryIPConfig(nic network.Interface) (*network.InterfaceIPConfiguratio
 	return nil, fmt.Errorf("failed to determine the primary ipconfig. nicname=%q", *nic.Name)
 }
 
+// getProviderPrimaryIPConfig returns the "provider primary" ipconfig of the
+// NIC. By default this is the ipconfig carrying the Primary flag, but the
+// selection can be overridden by primaryIPConfigSubnetName or
+// primaryIPConfigNamePattern for environments where another agent (e.g. a
+// CNI-managed secondary pool) marks a different ipconfig as primary. The
+// subnet match takes precedence over the name pattern, and the Primary flag
+// is used as fallback when neither matches.
+func (az *Cloud) getProviderPrimaryIPConfig(nic network.Interface) (*network.InterfaceIPConfiguration, error) {
+	if az.PrimaryIPConfigSubnetName != "" || az.primaryIPConfigNameRE != nil {
+		if nic.IPConfigurations == nil {
+			return nil, fmt.Errorf("nic.IPConfigurations for nic (nicname=%q) is nil", *nic.Name)
+		}
+
+		if az.PrimaryIPConfigSubnetName != "" {
+			for _, ref := range *nic.IPConfigurations {
+				if ref.InterfaceIPConfigurationPropertiesFormat == nil || ref.Subnet == nil || ref.Subnet.ID == nil {
+					continue
+				}
+
+				subnetName, err := getLastSegment(*ref.Subnet.ID, "/")
+				if err == nil && strings.EqualFold(subnetName, az.PrimaryIPConfigSubnetName) {
+					return &ref, nil
+				}
+			}
+		}
+
+		if az.primaryIPConfigNameRE != nil {
+			for _, ref := range *nic.IPConfigurations {
+				if ref.Name != nil && az.primaryIPConfigNameRE.MatchString(*ref.Name) {
+					return &ref, nil
+				}
+			}
+		}
+	}
+
+	return getPrimaryIPConfig(nic)
+}
+
 // returns first ip configuration on a nic by family
 func getIPConfigByIPFamily(nic network.Interface, IPv6 bool) (*network.InterfaceIPConfiguration, error) {
 	if nic.IPConfigurations == nil {
@@ -280,6 +355,19 @@ func getBackendPoolName(clusterName string, service *v1.Service) string {
 	return clusterName
 }
 
+// getBackendPoolName returns the backend pool name for the service, applying
+// the LoadBalancerBackendPoolName override to the base name when configured.
+func (az *Cloud) getBackendPoolName(clusterName string, service *v1.Service) string {
+	if az.resourceNamer != nil {
+		return az.resourceNamer.BackendPoolName(clusterName, service)
+	}
+	if az.LoadBalancerBackendPoolName != "" {
+		return getBackendPoolName(az.LoadBalancerBackendPoolName, service)
+	}
+
+	return getBackendPoolName(clusterName, service)
+}
+
 func (az *Cloud) getLoadBalancerRuleName(service *v1.Service, protocol v1.Protocol, port int32) string {
 	prefix := az.getRulePrefix(service)
 	ruleName := fmt.Sprintf("%s-%s-%d", prefix, protocol, port)
@@ -297,12 +385,18 @@ func (az *Cloud) getLoadBalancerRuleName(service *v1.Service, protocol v1.Protoc
 	return fmt.Sprintf("%s-%s-%s-%d", prefix, subnetSegment, protocol, port)
 }
 
+func (az *Cloud) getLoadBalancerNatPoolName(service *v1.Service, protocol v1.Protocol, startPort int32, endPort int32) string {
+	return fmt.Sprintf("%s-%s-%d-%d", az.getRulePrefix(service), protocol, startPort, endPort)
+}
+
 func (az *Cloud) getSecurityRuleName(service *v1.Service, port v1.ServicePort, sourceAddrPrefix string) string {
+	safePrefix := strings.Replace(sourceAddrPrefix, "/", "_", -1)
+	// Colons are not allowed in security rule names, so IPv6 prefixes are
+	// disambiguated with dots instead.
+	safePrefix = strings.Replace(safePrefix, ":", ".", -1)
 	if useSharedSecurityRule(service) {
-		safePrefix := strings.Replace(sourceAddrPrefix, "/", "_", -1)
 		return fmt.Sprintf("shared-%s-%d-%s", port.Protocol, port.Port, safePrefix)
 	}
-	safePrefix := strings.Replace(sourceAddrPrefix, "/", "_", -1)
 	rulePrefix := az.getRulePrefix(service)
 	return fmt.Sprintf("%s-%s-%d-%s", rulePrefix, port.Protocol, port.Port, safePrefix)
 }
@@ -319,15 +413,24 @@ func (az *Cloud) getRulePrefix(service *v1.Service) string {
 }
 
 func (az *Cloud) getPublicIPName(clusterName string, service *v1.Service) string {
+	if az.resourceNamer != nil {
+		return az.resourceNamer.PublicIPName(clusterName, service)
+	}
 	return fmt.Sprintf("%s-%s", clusterName, az.GetLoadBalancerName(context.TODO(), clusterName, service))
 }
 
 func (az *Cloud) serviceOwnsRule(service *v1.Service, rule string) bool {
+	if az.ownershipResolver != nil {
+		return az.ownershipResolver.OwnsRule(service, rule)
+	}
 	prefix := az.getRulePrefix(service)
 	return strings.HasPrefix(strings.ToUpper(rule), strings.ToUpper(prefix))
 }
 
 func (az *Cloud) serviceOwnsFrontendIP(fip network.FrontendIPConfiguration, service *v1.Service) bool {
+	if az.ownershipResolver != nil {
+		return az.ownershipResolver.OwnsFrontendIP(fip, service)
+	}
 	baseName := az.GetLoadBalancerName(context.TODO(), "", service)
 	return strings.HasPrefix(*fip.Name, baseName)
 }
@@ -349,7 +452,13 @@ func (az *Cloud) getFrontendIPConfigName(service *v1.Service) string {
 
 // This returns the next available rule priority level for a given set of security rules.
 func getNextAvailablePriority(rules []network.SecurityRule) (int32, error) {
-	var smallest int32 = loadBalancerMinimumPriority
+	return getNextAvailablePriorityFrom(rules, loadBalancerMinimumPriority)
+}
+
+// getNextAvailablePriorityFrom returns the next rule priority not taken by any
+// of the given security rules, scanning upwards from start.
+func getNextAvailablePriorityFrom(rules []network.SecurityRule, start int32) (int32, error) {
+	smallest := start
 	var spread int32 = 1
 
 outer:
@@ -440,8 +549,11 @@ func (as *availabilitySet) GetPowerStatusByNodeName(name string) (powerState str
 	}
 
 	// vm.InstanceView or vm.InstanceView.Statuses are nil when the VM is under deleting.
-	klog.V(3).Infof("InstanceView for node %q is nil, assuming it's stopped", name)
-	return vmPowerStateStopped, nil
+	var provisioningState string
+	if vm.VirtualMachineProperties != nil {
+		provisioningState = to.String(vm.ProvisioningState)
+	}
+	return as.powerStateForMissingInstanceView(name, provisioningState)
 }
 
 // GetProvisioningStateByNodeName returns the provisioningState for the specified node.
@@ -523,9 +635,9 @@ func (as *availabilitySet) GetIPByNodeName(name string) (string, string, error)
 		return "", "", err
 	}
 
-	ipConfig, err := getPrimaryIPConfig(nic)
+	ipConfig, err := as.getProviderPrimaryIPConfig(nic)
 	if err != nil {
-		klog.Errorf("as.GetIPByNodeName(%s) failed: getPrimaryIPConfig(%v), err=%v", name, nic, err)
+		klog.Errorf("as.GetIPByNodeName(%s) failed: getProviderPrimaryIPConfig(%v), err=%v", name, nic, err)
 		return "", "", err
 	}
 
@@ -712,7 +824,7 @@ func (as *availabilitySet) getPrimaryInterfaceWithVMSet(nodeName, vmSetName stri
 	//   don't check vmSet for it.
 	if vmSetName != "" && !as.useStandardLoadBalancer() {
 		expectedAvailabilitySetName := as.getAvailabilitySetID(nodeResourceGroup, vmSetName)
-		if machine.AvailabilitySet == nil || !strings.EqualFold(*machine.AvailabilitySet.ID, expectedAvailabilitySetName) {
+		if machine.AvailabilitySet == nil || !equalResourceIDs(*machine.AvailabilitySet.ID, expectedAvailabilitySetName) {
 			klog.V(3).Infof(
 				"GetPrimaryInterface: nic (%s) is not in the availabilitySet(%s)", nicName, vmSetName)
 			return network.Interface{}, errNotInVMSet
@@ -737,35 +849,43 @@ func (as *availabilitySet) getPrimaryInterfaceWithVMSet(nodeName, vmSetName stri
 // EnsureHostInPool ensures the given VM's Primary NIC's Primary IP Configuration is
 // participating in the specified LoadBalancer Backend Pool.
 func (as *availabilitySet) EnsureHostInPool(service *v1.Service, nodeName types.NodeName, backendPoolID string, vmSetName string, isInternal bool) (string, string, string, *compute.VirtualMachineScaleSetVM, error) {
-	vmName := mapNodeNameToVMName(nodeName)
+	nodeResourceGroup, vmasName, instanceID, vm, _, err := as.ensureHostInPool(service, nodeName, backendPoolID, vmSetName, isInternal)
+	return nodeResourceGroup, vmasName, instanceID, vm, err
+}
+
+// ensureHostInPool implements EnsureHostInPool and additionally reports a
+// typed result describing whether the node joined the pool or why it was
+// skipped.
+func (as *availabilitySet) ensureHostInPool(service *v1.Service, nodeName types.NodeName, backendPoolID string, vmSetName string, isInternal bool) (string, string, string, *compute.VirtualMachineScaleSetVM, hostInPoolResult, error) {
+	vmName := as.getVMNameByNodeName(nodeName)
 	serviceName := getServiceName(service)
 	nic, err := as.getPrimaryInterfaceWithVMSet(vmName, vmSetName)
 	if err != nil {
 		if err == errNotInVMSet {
 			klog.V(3).Infof("EnsureHostInPool skips node %s because it is not in the vmSet %s", nodeName, vmSetName)
-			return "", "", "", nil, nil
+			return "", "", "", nil, hostSkippedNotInVMSet, nil
 		}
 
 		klog.Errorf("error: az.EnsureHostInPool(%s), az.VMSet.GetPrimaryInterface.Get(%s, %s), err=%v", nodeName, vmName, vmSetName, err)
-		return "", "", "", nil, err
+		return "", "", "", nil, "", err
 	}
 
 	if nic.ProvisioningState != nil && *nic.ProvisioningState == nicFailedState {
 		klog.Warningf("EnsureHostInPool skips node %s because its primary nic %s is in Failed state", nodeName, *nic.Name)
-		return "", "", "", nil, nil
+		return "", "", "", nil, hostSkippedFailedNIC, nil
 	}
 
 	var primaryIPConfig *network.InterfaceIPConfiguration
 	ipv6 := utilnet.IsIPv6String(service.Spec.ClusterIP)
 	if !as.Cloud.ipv6DualStackEnabled && !ipv6 {
-		primaryIPConfig, err = getPrimaryIPConfig(nic)
+		primaryIPConfig, err = as.getProviderPrimaryIPConfig(nic)
 		if err != nil {
-			return "", "", "", nil, err
+			return "", "", "", nil, "", err
 		}
 	} else {
 		primaryIPConfig, err = getIPConfigByIPFamily(nic, ipv6)
 		if err != nil {
-			return "", "", "", nil, err
+			return "", "", "", nil, "", err
 		}
 	}
 
@@ -775,7 +895,7 @@ func (as *availabilitySet) EnsureHostInPool(service *v1.Service, nodeName types.
 		newBackendPools = *primaryIPConfig.LoadBalancerBackendAddressPools
 	}
 	for _, existingPool := range newBackendPools {
-		if strings.EqualFold(backendPoolID, *existingPool.ID) {
+		if equalResourceIDs(backendPoolID, *existingPool.ID) {
 			foundPool = true
 			break
 		}
@@ -794,11 +914,11 @@ func (as *availabilitySet) EnsureHostInPool(service *v1.Service, nodeName types.
 			}
 			isSameLB, oldLBName, err := isBackendPoolOnSameLB(backendPoolID, newBackendPoolsIDs)
 			if err != nil {
-				return "", "", "", nil, err
+				return "", "", "", nil, "", err
 			}
 			if !isSameLB {
 				klog.V(4).Infof("Node %q has already been added to LB %q, omit adding it to a new one", nodeName, oldLBName)
-				return "", "", "", nil, nil
+				return "", "", "", nil, hostSkippedOtherLB, nil
 			}
 		}
 
@@ -811,21 +931,95 @@ func (as *availabilitySet) EnsureHostInPool(service *v1.Service, nodeName types.
 
 		nicName := *nic.Name
 		klog.V(3).Infof("nicupdate(%s): nic(%s) - updating", serviceName, nicName)
-		err := as.CreateOrUpdateInterface(service, nic)
+		if as.TargetedNICUpdates {
+			err = as.updateNICBackendPoolsTargeted(service, nic, *primaryIPConfig.Name, backendPoolID)
+		} else {
+			err = as.CreateOrUpdateInterface(service, nic)
+		}
 		if err != nil {
-			return "", "", "", nil, err
+			return "", "", "", nil, "", err
+		}
+	}
+	return "", "", "", nil, hostJoined, nil
+}
+
+// updateNICBackendPoolsTargeted re-reads the NIC right before the update and
+// applies only the backend pool change onto the named ipconfig of the fresh
+// copy. ARM only supports full-NIC PUTs, so this is the closest we can get to
+// a targeted patch: the payload always carries the latest CNI-allocated
+// secondary ipconfigs instead of a stale snapshot. Updates are serialized per
+// NIC so that concurrent services don't overwrite each other's changes.
+func (as *availabilitySet) updateNICBackendPoolsTargeted(service *v1.Service, nic network.Interface, ipConfigName, backendPoolID string) error {
+	nicName := *nic.Name
+	as.nicUpdateLock.LockEntry(nicName)
+	defer as.nicUpdateLock.UnlockEntry(nicName)
+
+	nicResourceGroup, err := extractResourceGroupByNicID(*nic.ID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	freshNic, rerr := as.InterfacesClient.Get(ctx, nicResourceGroup, nicName, "")
+	if rerr != nil {
+		return rerr.Error()
+	}
+
+	if freshNic.IPConfigurations == nil {
+		return fmt.Errorf("nic.IPConfigurations for nic (nicname=%q) is nil", nicName)
+	}
+
+	ipConfigs := *freshNic.IPConfigurations
+	found := false
+	for i := range ipConfigs {
+		if ipConfigs[i].Name == nil || !strings.EqualFold(*ipConfigs[i].Name, ipConfigName) {
+			continue
 		}
+
+		newBackendPools := []network.BackendAddressPool{}
+		if ipConfigs[i].LoadBalancerBackendAddressPools != nil {
+			newBackendPools = *ipConfigs[i].LoadBalancerBackendAddressPools
+		}
+		foundPool := false
+		for _, existingPool := range newBackendPools {
+			if equalResourceIDs(backendPoolID, *existingPool.ID) {
+				foundPool = true
+				break
+			}
+		}
+		if !foundPool {
+			newBackendPools = append(newBackendPools,
+				network.BackendAddressPool{
+					ID: to.StringPtr(backendPoolID),
+				})
+			ipConfigs[i].LoadBalancerBackendAddressPools = &newBackendPools
+		}
+		found = true
+		break
 	}
-	return "", "", "", nil, nil
+	if !found {
+		return fmt.Errorf("failed to find ipconfig %q on nic %q", ipConfigName, nicName)
+	}
+
+	freshNic.IPConfigurations = &ipConfigs
+	return as.CreateOrUpdateInterface(service, freshNic)
 }
 
 // EnsureHostsInPool ensures the given Node's primary IP configurations are
 // participating in the specified LoadBalancer Backend Pool.
 func (as *availabilitySet) EnsureHostsInPool(service *v1.Service, nodes []*v1.Node, backendPoolID string, vmSetName string, isInternal bool) error {
+	if !as.isLBBackendPoolTypeNodeIPConfig() {
+		return as.ensureIPBasedBackendPoolHosts(service, backendPoolID, nodes)
+	}
+
 	hostUpdates := make([]func() error, 0, len(nodes))
+	var resultsLock sync.Mutex
+	results := make(map[hostInPoolResult]int)
 	for _, node := range nodes {
+		localNode := node
 		localNodeName := node.Name
-		if as.useStandardLoadBalancer() && as.excludeMasterNodesFromStandardLB() && isMasterNode(node) {
+		if as.useStandardLoadBalancer() && as.excludeMasterNodesFromLB(service) && isMasterNode(node) {
 			klog.V(4).Infof("Excluding master node %q from load balancer backendpool %q", localNodeName, backendPoolID)
 			continue
 		}
@@ -836,10 +1030,14 @@ func (as *availabilitySet) EnsureHostsInPool(service *v1.Service, nodes []*v1.No
 		}
 
 		f := func() error {
-			_, _, _, _, err := as.EnsureHostInPool(service, types.NodeName(localNodeName), backendPoolID, vmSetName, isInternal)
+			_, _, _, _, result, err := as.ensureHostInPool(service, types.NodeName(localNodeName), backendPoolID, vmSetName, isInternal)
 			if err != nil {
 				return fmt.Errorf("ensure(%s): backendPoolID(%s) - failed to ensure host in pool: %q", getServiceName(service), backendPoolID, err)
 			}
+			recordHostInPoolOutcome(as.Cloud, localNode, result)
+			resultsLock.Lock()
+			results[result]++
+			resultsLock.Unlock()
 			return nil
 		}
 		hostUpdates = append(hostUpdates, f)
@@ -850,6 +1048,7 @@ func (as *availabilitySet) EnsureHostsInPool(service *v1.Service, nodes []*v1.No
 		return utilerrors.Flatten(errs)
 	}
 
+	reportHostsInPoolResults(as.Cloud, service, backendPoolID, results)
 	return nil
 }
 
@@ -19,8 +19,10 @@ limitations under the License.
 package azure
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"regexp"
 	"strconv"
 	"testing"
 
@@ -213,6 +215,7 @@ func TestGetAzureLoadBalancerName(t *testing.T) {
 		description   string
 		vmSet         string
 		isInternal    bool
+		isGlobal      bool
 		useStandardLB bool
 		clusterName   string
 		lbName        string
@@ -281,6 +284,15 @@ func TestGetAzureLoadBalancerName(t *testing.T) {
 			clusterName:   "azure",
 			expected:      "azure-internal",
 		},
+		{
+			description:   "global internal LB should get the global internal suffix",
+			vmSet:         "primary",
+			useStandardLB: true,
+			isInternal:    true,
+			isGlobal:      true,
+			clusterName:   "azure",
+			expected:      "azure-global-internal",
+		},
 	}
 
 	for _, c := range cases {
@@ -290,7 +302,11 @@ func TestGetAzureLoadBalancerName(t *testing.T) {
 			az.Config.LoadBalancerSku = loadBalancerSkuBasic
 		}
 		az.Config.LoadBalancerName = c.lbName
-		loadbalancerName := az.getAzureLoadBalancerName(c.clusterName, c.vmSet, c.isInternal)
+		svc := &v1.Service{}
+		if c.isGlobal {
+			svc.Annotations = map[string]string{ServiceAnnotationLoadBalancerInternalGlobal: "true"}
+		}
+		loadbalancerName := az.getAzureLoadBalancerName(svc, c.clusterName, c.vmSet, c.isInternal)
 		assert.Equal(t, c.expected, loadbalancerName, c.description)
 	}
 }
@@ -554,10 +570,17 @@ func TestGetProtocolsFromKubernetesProtocol(t *testing.T) {
 			expectedSecurityGroupProto: network.SecurityRuleProtocolUDP,
 			nilProbeProto:              true,
 		},
+		{
+			Name:                       "getProtocolsFromKubernetesProtocol should get SCTP protocol",
+			protocol:                   v1.ProtocolSCTP,
+			expectedTransportProto:     network.TransportProtocolAll,
+			expectedSecurityGroupProto: network.SecurityRuleProtocolAsterisk,
+			nilProbeProto:              true,
+		},
 		{
 			Name:           "getProtocolsFromKubernetesProtocol should report error",
-			protocol:       v1.ProtocolSCTP,
-			expectedErrMsg: fmt.Errorf("only TCP and UDP are supported for Azure LoadBalancers"),
+			protocol:       v1.Protocol("ICMP"),
+			expectedErrMsg: fmt.Errorf("only TCP, UDP and SCTP are supported for Azure LoadBalancers"),
 		},
 	}
 
@@ -920,12 +943,13 @@ func TestGetStandardVMPowerStatusByNodeName(t *testing.T) {
 	cloud := GetTestCloud(ctrl)
 
 	testcases := []struct {
-		name           string
-		nodeName       string
-		vm             compute.VirtualMachine
-		expectedStatus string
-		getErr         *retry.Error
-		expectedErrMsg error
+		name               string
+		nodeName           string
+		vm                 compute.VirtualMachine
+		powerStateFallback string
+		expectedStatus     string
+		getErr             *retry.Error
+		expectedErrMsg     error
 	}{
 		{
 			name:     "GetPowerStatusByNodeName should report error if node don't exist",
@@ -974,11 +998,24 @@ func TestGetStandardVMPowerStatusByNodeName(t *testing.T) {
 			},
 			expectedStatus: vmPowerStateStopped,
 		},
+		{
+			name:     "GetPowerStatusByNodeName should report error if vm.InstanceView is nil and VMPowerStateFallback is unknown",
+			nodeName: "vm5",
+			vm: compute.VirtualMachine{
+				Name: to.StringPtr("vm5"),
+				VirtualMachineProperties: &compute.VirtualMachineProperties{
+					ProvisioningState: to.StringPtr("Succeeded"),
+				},
+			},
+			powerStateFallback: vmPowerStateUnknown,
+			expectedErrMsg:     fmt.Errorf("power state of node \"vm5\" is unknown: InstanceView is nil and provisioning state is \"Succeeded\""),
+		},
 	}
 	for _, test := range testcases {
 		mockVMClient := cloud.VirtualMachinesClient.(*mockvmclient.MockInterface)
 		mockVMClient.EXPECT().Get(gomock.Any(), cloud.ResourceGroup, test.nodeName, gomock.Any()).Return(test.vm, test.getErr).AnyTimes()
 
+		cloud.Config.VMPowerStateFallback = test.powerStateFallback
 		powerState, err := cloud.VMSet.GetPowerStatusByNodeName(test.nodeName)
 		assert.Equal(t, test.expectedErrMsg, err, test.name)
 		assert.Equal(t, test.expectedStatus, powerState, test.name)
@@ -1572,3 +1609,138 @@ func TestStandardEnsureHostsInPool(t *testing.T) {
 		}
 	}
 }
+
+func TestGetProviderPrimaryIPConfig(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	nic := network.Interface{
+		Name: to.StringPtr("nic"),
+		InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+			IPConfigurations: &[]network.InterfaceIPConfiguration{
+				{
+					Name: to.StringPtr("cni-pool-1"),
+					InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+						Primary: to.BoolPtr(true),
+						Subnet: &network.Subnet{
+							ID: to.StringPtr("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/virtualNetworks/vnet/subnets/cni-subnet"),
+						},
+					},
+				},
+				{
+					Name: to.StringPtr("k8s-primary"),
+					InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+						Primary: to.BoolPtr(false),
+						Subnet: &network.Subnet{
+							ID: to.StringPtr("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/virtualNetworks/vnet/subnets/node-subnet"),
+						},
+					},
+				},
+			},
+		},
+	}
+
+	testcases := []struct {
+		name                 string
+		primarySubnetName    string
+		primaryNamePattern   string
+		expectedIPConfigName string
+	}{
+		{
+			name:                 "getProviderPrimaryIPConfig should use the Primary flag by default",
+			expectedIPConfigName: "cni-pool-1",
+		},
+		{
+			name:                 "getProviderPrimaryIPConfig should select the ipconfig by subnet match",
+			primarySubnetName:    "node-subnet",
+			expectedIPConfigName: "k8s-primary",
+		},
+		{
+			name:                 "getProviderPrimaryIPConfig should select the ipconfig by name pattern",
+			primaryNamePattern:   "^k8s-.*",
+			expectedIPConfigName: "k8s-primary",
+		},
+		{
+			name:                 "getProviderPrimaryIPConfig should fall back to the Primary flag when nothing matches",
+			primarySubnetName:    "other-subnet",
+			expectedIPConfigName: "cni-pool-1",
+		},
+	}
+
+	for _, test := range testcases {
+		cloud := GetTestCloud(ctrl)
+		cloud.PrimaryIPConfigSubnetName = test.primarySubnetName
+		if test.primaryNamePattern != "" {
+			cloud.primaryIPConfigNameRE = regexp.MustCompile(test.primaryNamePattern)
+		}
+
+		ipConfig, err := cloud.getProviderPrimaryIPConfig(nic)
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, test.expectedIPConfigName, *ipConfig.Name, test.name)
+	}
+}
+
+func TestUpdateNICBackendPoolsTargeted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cloud := GetTestCloud(ctrl)
+	cloud.TargetedNICUpdates = true
+	as := &availabilitySet{Cloud: cloud}
+
+	backendPoolID := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb/backendAddressPools/pool"
+	staleNic := network.Interface{
+		Name: to.StringPtr("nic-1"),
+		ID:   to.StringPtr("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/nic-1"),
+		InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+			IPConfigurations: &[]network.InterfaceIPConfiguration{
+				{
+					Name: to.StringPtr("ipconfig1"),
+					InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+						Primary: to.BoolPtr(true),
+					},
+				},
+			},
+		},
+	}
+	// The fresh NIC carries a CNI-allocated secondary ipconfig which is not in
+	// the stale copy and must be preserved by the update.
+	freshNic := network.Interface{
+		Name: to.StringPtr("nic-1"),
+		ID:   staleNic.ID,
+		InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+			IPConfigurations: &[]network.InterfaceIPConfiguration{
+				{
+					Name: to.StringPtr("ipconfig1"),
+					InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+						Primary: to.BoolPtr(true),
+					},
+				},
+				{
+					Name: to.StringPtr("cni-secondary-1"),
+					InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+						Primary: to.BoolPtr(false),
+					},
+				},
+			},
+		},
+	}
+
+	mockInterfaceClient := cloud.InterfacesClient.(*mockinterfaceclient.MockInterface)
+	mockInterfaceClient.EXPECT().Get(gomock.Any(), "rg", "nic-1", gomock.Any()).Return(freshNic, nil)
+
+	var updatedNic network.Interface
+	mockInterfaceClient.EXPECT().CreateOrUpdate(gomock.Any(), cloud.ResourceGroup, "nic-1", gomock.Any()).
+		DoAndReturn(func(ctx context.Context, resourceGroupName, nicName string, nic network.Interface) *retry.Error {
+			updatedNic = nic
+			return nil
+		})
+
+	err := as.updateNICBackendPoolsTargeted(&v1.Service{}, staleNic, "ipconfig1", backendPoolID)
+	assert.NoError(t, err)
+
+	ipConfigs := *updatedNic.IPConfigurations
+	assert.Equal(t, 2, len(ipConfigs))
+	assert.Equal(t, "cni-secondary-1", *ipConfigs[1].Name)
+	assert.Equal(t, backendPoolID, *(*ipConfigs[0].LoadBalancerBackendAddressPools)[0].ID)
+}
@@ -0,0 +1,158 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// azureReservedIPsPerSubnet is the number of IP addresses Azure reserves in
+// every subnet: the network address, the default gateway, two DNS mapping
+// addresses and the broadcast address.
+const azureReservedIPsPerSubnet = 5
+
+// subnetCandidates returns the subnet names the service frontend may be
+// placed in. The internal subnet annotation accepts a comma-separated list of
+// candidate subnets; the configured default subnet is used when the
+// annotation is absent.
+func subnetCandidates(service *v1.Service, defaultSubnetName string) []string {
+	names := []string{defaultSubnetName}
+	if subnetName := subnet(service); subnetName != nil {
+		names = strings.Split(*subnetName, ",")
+	}
+
+	candidates := make([]string, 0, len(names))
+	for _, name := range names {
+		if trimmed := strings.TrimSpace(name); trimmed != "" {
+			candidates = append(candidates, trimmed)
+		}
+	}
+	return candidates
+}
+
+// subnetNameInCandidates reports whether the subnet name is one of the
+// candidate names, ignoring case as Azure resource names are
+// case-insensitive.
+func subnetNameInCandidates(subnetName string, candidates []string) bool {
+	for _, candidate := range candidates {
+		if strings.EqualFold(subnetName, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSubnetForPlacement checks that the subnet can host internal load
+// balancer frontends and private link services: it must not be delegated to
+// another service and it must still have a free IP address for the frontend.
+func validateSubnetForPlacement(subnet *network.Subnet) error {
+	if subnet.SubnetPropertiesFormat == nil {
+		return nil
+	}
+
+	if subnet.Delegations != nil && len(*subnet.Delegations) > 0 {
+		services := make([]string, 0, len(*subnet.Delegations))
+		for _, delegation := range *subnet.Delegations {
+			if delegation.ServiceDelegationPropertiesFormat != nil && delegation.ServiceName != nil {
+				services = append(services, *delegation.ServiceName)
+			}
+		}
+		return fmt.Errorf("subnet %s is delegated to %s and cannot host load balancer frontends or private link services", to.String(subnet.Name), strings.Join(services, ", "))
+	}
+
+	if free, known := subnetAvailableIPs(subnet); known && free < 1 {
+		return fmt.Errorf("subnet %s has no available IP addresses", to.String(subnet.Name))
+	}
+
+	return nil
+}
+
+// subnetAvailableIPs returns the number of free IP addresses in the subnet,
+// accounting for the addresses Azure reserves. The second return value is
+// false when the subnet carries no address prefix to compute the capacity
+// from.
+func subnetAvailableIPs(subnet *network.Subnet) (int, bool) {
+	prefixes := []string{}
+	if subnet.AddressPrefix != nil {
+		prefixes = append(prefixes, *subnet.AddressPrefix)
+	}
+	if subnet.AddressPrefixes != nil {
+		prefixes = append(prefixes, *subnet.AddressPrefixes...)
+	}
+	if len(prefixes) == 0 {
+		return 0, false
+	}
+
+	capacity := 0
+	for _, prefix := range prefixes {
+		_, cidr, err := net.ParseCIDR(prefix)
+		if err != nil {
+			continue
+		}
+		ones, bits := cidr.Mask.Size()
+		hostBits := bits - ones
+		if hostBits > 30 {
+			// Large enough that the subnet can never run out of addresses
+			// before the ARM API rejects the deployment for other reasons.
+			hostBits = 30
+		}
+		capacity += 1<<uint(hostBits) - azureReservedIPsPerSubnet
+	}
+
+	used := 0
+	if subnet.IPConfigurations != nil {
+		used = len(*subnet.IPConfigurations)
+	}
+	return capacity - used, true
+}
+
+// selectEligibleSubnet resolves the first candidate subnet that exists and
+// passes placement validation, so that misconfigured subnets are surfaced as
+// early errors instead of opaque ARM deployment failures. The reasons for
+// rejecting each candidate are carried in the returned error when none is
+// eligible.
+func (az *Cloud) selectEligibleSubnet(serviceName string, candidates []string) (network.Subnet, error) {
+	reasons := make([]string, 0, len(candidates))
+	for _, subnetName := range candidates {
+		subnet, existsSubnet, err := az.getSubnet(az.VnetName, subnetName)
+		if err != nil {
+			return network.Subnet{}, err
+		}
+		if !existsSubnet {
+			reasons = append(reasons, fmt.Sprintf("subnet %s/%s does not exist", az.VnetName, subnetName))
+			continue
+		}
+		if err := validateSubnetForPlacement(&subnet); err != nil {
+			klog.V(2).Infof("selectEligibleSubnet(%s): skipping subnet %s: %v", serviceName, subnetName, err)
+			reasons = append(reasons, err.Error())
+			continue
+		}
+		return subnet, nil
+	}
+
+	return network.Subnet{}, fmt.Errorf("no eligible subnet for service %s: %s", serviceName, strings.Join(reasons, "; "))
+}
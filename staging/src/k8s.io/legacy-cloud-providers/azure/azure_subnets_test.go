@@ -0,0 +1,163 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/legacy-cloud-providers/azure/clients/subnetclient/mocksubnetclient"
+	"k8s.io/legacy-cloud-providers/azure/retry"
+)
+
+func TestSubnetCandidates(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		annotation string
+		expected   []string
+	}{
+		{
+			desc:     "subnetCandidates shall fall back to the default subnet without the annotation",
+			expected: []string{"subnet"},
+		},
+		{
+			desc:       "subnetCandidates shall return the annotated subnet",
+			annotation: "subnet1",
+			expected:   []string{"subnet1"},
+		},
+		{
+			desc:       "subnetCandidates shall split a comma-separated annotation and trim whitespace",
+			annotation: "subnet1, subnet2,,subnet3",
+			expected:   []string{"subnet1", "subnet2", "subnet3"},
+		},
+	}
+
+	for _, test := range testCases {
+		svc := getInternalTestService("service1", 80)
+		if test.annotation != "" {
+			svc.Annotations[ServiceAnnotationLoadBalancerInternalSubnet] = test.annotation
+		}
+		assert.Equal(t, test.expected, subnetCandidates(&svc, "subnet"), test.desc)
+	}
+}
+
+func TestValidateSubnetForPlacement(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		subnet         network.Subnet
+		expectedErrMsg string
+	}{
+		{
+			desc:   "validateSubnetForPlacement shall accept a subnet without properties",
+			subnet: network.Subnet{Name: to.StringPtr("subnet")},
+		},
+		{
+			desc: "validateSubnetForPlacement shall accept a healthy subnet",
+			subnet: network.Subnet{
+				Name: to.StringPtr("subnet"),
+				SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
+					AddressPrefix: to.StringPtr("10.0.0.0/24"),
+				},
+			},
+		},
+		{
+			desc: "validateSubnetForPlacement shall reject a delegated subnet",
+			subnet: network.Subnet{
+				Name: to.StringPtr("subnet"),
+				SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
+					Delegations: &[]network.Delegation{
+						{
+							ServiceDelegationPropertiesFormat: &network.ServiceDelegationPropertiesFormat{
+								ServiceName: to.StringPtr("Microsoft.Web/serverFarms"),
+							},
+						},
+					},
+				},
+			},
+			expectedErrMsg: "subnet subnet is delegated to Microsoft.Web/serverFarms and cannot host load balancer frontends or private link services",
+		},
+		{
+			desc: "validateSubnetForPlacement shall reject a subnet without free IP addresses",
+			subnet: network.Subnet{
+				Name: to.StringPtr("subnet"),
+				SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
+					AddressPrefix: to.StringPtr("10.0.0.0/29"),
+					IPConfigurations: &[]network.IPConfiguration{
+						{ID: to.StringPtr("ipconfig1")},
+						{ID: to.StringPtr("ipconfig2")},
+						{ID: to.StringPtr("ipconfig3")},
+					},
+				},
+			},
+			expectedErrMsg: "subnet subnet has no available IP addresses",
+		},
+	}
+
+	for _, test := range testCases {
+		err := validateSubnetForPlacement(&test.subnet)
+		if test.expectedErrMsg != "" {
+			assert.EqualError(t, err, test.expectedErrMsg, test.desc)
+		} else {
+			assert.NoError(t, err, test.desc)
+		}
+	}
+}
+
+func TestSelectEligibleSubnet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+
+	delegatedSubnet := network.Subnet{
+		Name: to.StringPtr("delegated"),
+		SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
+			Delegations: &[]network.Delegation{
+				{
+					ServiceDelegationPropertiesFormat: &network.ServiceDelegationPropertiesFormat{
+						ServiceName: to.StringPtr("Microsoft.Web/serverFarms"),
+					},
+				},
+			},
+		},
+	}
+	eligibleSubnet := network.Subnet{
+		Name: to.StringPtr("eligible"),
+		SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
+			AddressPrefix: to.StringPtr("10.0.0.0/24"),
+		},
+	}
+
+	mockSubnetsClient := az.SubnetsClient.(*mocksubnetclient.MockInterface)
+	mockSubnetsClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, az.VnetName, "missing", gomock.Any()).Return(network.Subnet{}, &retry.Error{HTTPStatusCode: 404}).AnyTimes()
+	mockSubnetsClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, az.VnetName, "delegated", gomock.Any()).Return(delegatedSubnet, nil).AnyTimes()
+	mockSubnetsClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, az.VnetName, "eligible", gomock.Any()).Return(eligibleSubnet, nil).AnyTimes()
+
+	subnet, err := az.selectEligibleSubnet("default/service1", []string{"missing", "delegated", "eligible"})
+	assert.NoError(t, err)
+	assert.Equal(t, "eligible", to.String(subnet.Name))
+
+	_, err = az.selectEligibleSubnet("default/service1", []string{"missing", "delegated"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "does not exist")
+	assert.Contains(t, err.Error(), "is delegated to Microsoft.Web/serverFarms")
+}
@@ -0,0 +1,234 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	azcache "k8s.io/legacy-cloud-providers/azure/cache"
+	"k8s.io/legacy-cloud-providers/azure/retry"
+)
+
+// supportBundleARMErrorLimit bounds how many recent ARM errors are retained
+// for support bundles.
+const supportBundleARMErrorLimit = 50
+
+// redactedConfigValue replaces secrets in the config section of a support
+// bundle.
+const redactedConfigValue = "<redacted>"
+
+// SupportBundle is the JSON document produced by CollectSupportBundle.
+type SupportBundle struct {
+	CollectedAt     time.Time            `json:"collectedAt"`
+	Config          Config               `json:"config"`
+	Caches          map[string]cacheDump `json:"caches"`
+	RecentARMErrors []armErrorRecord     `json:"recentARMErrors"`
+	Services        []serviceSummary     `json:"services"`
+	Throttling      throttlingState      `json:"throttling"`
+}
+
+// armErrorRecord is one failed ARM request retained for support bundles.
+type armErrorRecord struct {
+	Time             time.Time `json:"time"`
+	Operation        string    `json:"operation"`
+	HTTPStatusCode   int       `json:"httpStatusCode"`
+	ServiceErrorCode string    `json:"serviceErrorCode,omitempty"`
+	CorrelationID    string    `json:"correlationID,omitempty"`
+	Error            string    `json:"error"`
+}
+
+// armErrorRecorder retains the most recent failed ARM requests in a bounded
+// list. Its zero value is ready to use.
+type armErrorRecorder struct {
+	lock    sync.Mutex
+	records []armErrorRecord
+}
+
+// note retains one failed ARM request, evicting the oldest record once the
+// retention limit is reached.
+func (r *armErrorRecorder) note(operation string, rerr *retry.Error) {
+	if rerr == nil {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.records = append(r.records, armErrorRecord{
+		Time:             time.Now().UTC(),
+		Operation:        operation,
+		HTTPStatusCode:   rerr.HTTPStatusCode,
+		ServiceErrorCode: rerr.ServiceErrorCode(),
+		CorrelationID:    rerr.CorrelationID,
+		Error:            rerr.Error().Error(),
+	})
+	if len(r.records) > supportBundleARMErrorLimit {
+		r.records = r.records[len(r.records)-supportBundleARMErrorLimit:]
+	}
+}
+
+// snapshot returns a copy of the retained records, oldest first.
+func (r *armErrorRecorder) snapshot() []armErrorRecord {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]armErrorRecord{}, r.records...)
+}
+
+// noteARMError retains a failed ARM request for support bundles.
+func (az *Cloud) noteARMError(operation string, rerr *retry.Error) {
+	az.armErrorRecorder.note(operation, rerr)
+}
+
+// serviceSummary compares the desired load balancer footprint of one
+// LoadBalancer service with the load balancing rules the cached Azure state
+// actually holds for it.
+type serviceSummary struct {
+	Namespace        string   `json:"namespace"`
+	Name             string   `json:"name"`
+	UID              string   `json:"uid"`
+	LoadBalancerName string   `json:"loadBalancerName"`
+	DesiredPortCount int      `json:"desiredPortCount"`
+	ActualRuleCount  int      `json:"actualRuleCount"`
+	IngressIPs       []string `json:"ingressIPs,omitempty"`
+}
+
+// throttlingState is the throttling section of a support bundle: whether rate
+// limiting is configured and how much of the current write budget window is
+// consumed.
+type throttlingState struct {
+	CloudProviderRateLimit  bool `json:"cloudProviderRateLimit"`
+	ARMWriteBudgetPerMinute int  `json:"armWriteBudgetPerMinute"`
+	ARMWritesUsedInWindow   int  `json:"armWritesUsedInWindow"`
+}
+
+// redactedConfig returns a copy of the provider config with its secrets
+// replaced, so the bundle is safe to attach to a support ticket.
+func (az *Cloud) redactedConfig() Config {
+	config := az.Config
+	if config.AADClientSecret != "" {
+		config.AADClientSecret = redactedConfigValue
+	}
+	if config.AADClientCertPassword != "" {
+		config.AADClientCertPassword = redactedConfigValue
+	}
+	return config
+}
+
+// serviceSummaries builds the desired-versus-actual summaries of the
+// LoadBalancer services. The load balancers are read through the cache with
+// stale entries accepted, so collecting a bundle doesn't force ARM refreshes.
+// Without a kube client, as in standalone tooling, the section is left empty.
+func (az *Cloud) serviceSummaries(ctx context.Context) ([]serviceSummary, error) {
+	if az.KubeClient == nil {
+		return nil, nil
+	}
+	services, err := az.KubeClient.CoreV1().Services("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []network.LoadBalancingRule
+	for _, rgName := range az.getLoadBalancerResourceGroups() {
+		cached, err := az.lbListCache.Get(rgName, azcache.CacheReadTypeUnsafe)
+		if err != nil {
+			continue
+		}
+		lbs, ok := cached.([]network.LoadBalancer)
+		if !ok {
+			continue
+		}
+		for _, lb := range lbs {
+			if lb.LoadBalancerPropertiesFormat != nil && lb.LoadBalancingRules != nil {
+				rules = append(rules, *lb.LoadBalancingRules...)
+			}
+		}
+	}
+
+	var summaries []serviceSummary
+	for i := range services.Items {
+		service := services.Items[i]
+		if service.Spec.Type != v1.ServiceTypeLoadBalancer {
+			continue
+		}
+		summary := serviceSummary{
+			Namespace:        service.Namespace,
+			Name:             service.Name,
+			UID:              string(service.UID),
+			LoadBalancerName: az.GetLoadBalancerName(ctx, "", &service),
+			DesiredPortCount: len(service.Spec.Ports),
+		}
+		for _, rule := range rules {
+			if rule.Name != nil && az.serviceOwnsRule(&service, *rule.Name) {
+				summary.ActualRuleCount++
+			}
+		}
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			if ingress.IP != "" {
+				summary.IngressIPs = append(summary.IngressIPs, ingress.IP)
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// throttlingState snapshots the throttling section of a support bundle.
+func (az *Cloud) throttlingState() throttlingState {
+	limit, used := az.writeBudget.stats()
+	return throttlingState{
+		CloudProviderRateLimit:  az.Config.CloudProviderRateLimit,
+		ARMWriteBudgetPerMinute: limit,
+		ARMWritesUsedInWindow:   used,
+	}
+}
+
+// CollectSupportBundle gathers the redacted provider configuration, the cache
+// statistics, the most recent ARM errors with their correlation IDs, the
+// desired-versus-actual summaries of the LoadBalancer services and the
+// current throttling state into one JSON document, so a single artifact
+// carries the state a support ticket for load balancer issues usually needs.
+func (az *Cloud) CollectSupportBundle(ctx context.Context) ([]byte, error) {
+	bundle := SupportBundle{
+		CollectedAt:     time.Now().UTC(),
+		Config:          az.redactedConfig(),
+		Caches:          map[string]cacheDump{},
+		RecentARMErrors: az.armErrorRecorder.snapshot(),
+		Throttling:      az.throttlingState(),
+	}
+	for name, timedCache := range az.namedCaches() {
+		bundle.Caches[name] = cacheDump{
+			Stats: timedCache.Stats(),
+			Keys:  timedCache.Keys(),
+		}
+	}
+
+	summaries, err := az.serviceSummaries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bundle.Services = summaries
+
+	return json.MarshalIndent(bundle, "", "  ")
+}
@@ -0,0 +1,121 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	fakeclient "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/legacy-cloud-providers/azure/retry"
+)
+
+func TestCollectSupportBundle(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.Config.AADClientSecret = "super-secret"
+
+	svc := getTestService("test1", v1.ProtocolTCP, nil, false, 80)
+	svc.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: "1.2.3.4"}}
+	az.KubeClient = fakeclient.NewSimpleClientset(&svc)
+
+	az.lbListCache.Set("rg", []network.LoadBalancer{
+		{
+			Name: to.StringPtr("testCluster"),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+				LoadBalancingRules: &[]network.LoadBalancingRule{
+					{Name: to.StringPtr("atest1-TCP-80")},
+					{Name: to.StringPtr("aother-TCP-80")},
+				},
+			},
+		},
+	})
+
+	az.noteARMError("CreateOrUpdateLoadBalancer", &retry.Error{
+		HTTPStatusCode: http.StatusTooManyRequests,
+		CorrelationID:  "bbbf8f42-9b27-4e3a-8e9d-0c8d69bba959",
+		RawError:       fmt.Errorf(`{"error":{"code":"TooManyRequests"}}`),
+	})
+
+	data, err := az.CollectSupportBundle(context.Background())
+	assert.NoError(t, err)
+
+	var bundle SupportBundle
+	assert.NoError(t, json.Unmarshal(data, &bundle))
+
+	assert.Equal(t, redactedConfigValue, bundle.Config.AADClientSecret)
+	assert.Equal(t, "rg", bundle.Config.ResourceGroup)
+
+	assert.NotEmpty(t, bundle.Caches)
+
+	assert.Len(t, bundle.RecentARMErrors, 1)
+	assert.Equal(t, "CreateOrUpdateLoadBalancer", bundle.RecentARMErrors[0].Operation)
+	assert.Equal(t, "bbbf8f42-9b27-4e3a-8e9d-0c8d69bba959", bundle.RecentARMErrors[0].CorrelationID)
+	assert.Equal(t, "TooManyRequests", bundle.RecentARMErrors[0].ServiceErrorCode)
+
+	assert.Len(t, bundle.Services, 1)
+	assert.Equal(t, "test1", bundle.Services[0].Name)
+	assert.Equal(t, "atest1", bundle.Services[0].LoadBalancerName)
+	assert.Equal(t, 1, bundle.Services[0].DesiredPortCount)
+	assert.Equal(t, 1, bundle.Services[0].ActualRuleCount)
+	assert.Equal(t, []string{"1.2.3.4"}, bundle.Services[0].IngressIPs)
+}
+
+func TestCollectSupportBundleWithoutKubeClient(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+
+	data, err := az.CollectSupportBundle(context.Background())
+	assert.NoError(t, err)
+
+	var bundle SupportBundle
+	assert.NoError(t, json.Unmarshal(data, &bundle))
+	assert.Empty(t, bundle.Services)
+}
+
+func TestARMErrorRecorderBoundsRecords(t *testing.T) {
+	recorder := &armErrorRecorder{}
+	recorder.note("ignored", nil)
+	assert.Empty(t, recorder.snapshot())
+
+	for i := 0; i < supportBundleARMErrorLimit+10; i++ {
+		recorder.note(fmt.Sprintf("operation-%d", i), &retry.Error{
+			HTTPStatusCode: http.StatusInternalServerError,
+			RawError:       fmt.Errorf("transient error"),
+		})
+	}
+
+	records := recorder.snapshot()
+	assert.Len(t, records, supportBundleARMErrorLimit)
+	assert.Equal(t, "operation-10", records[0].Operation)
+	assert.Equal(t, fmt.Sprintf("operation-%d", supportBundleARMErrorLimit+9), records[len(records)-1].Operation)
+}
@@ -0,0 +1,169 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// tagsUpdateInterval defines the tags reconciling interval. Tag changes
+	// carry no traffic impact, so they are batched far less aggressively
+	// than route updates.
+	tagsUpdateInterval = 2 * time.Minute
+)
+
+// tagsResourceKind identifies the resource type of a delayed tags operation.
+type tagsResourceKind string
+
+const (
+	tagsResourceLoadBalancer tagsResourceKind = "loadBalancer"
+	tagsResourcePublicIP     tagsResourceKind = "publicIP"
+)
+
+// delayedTagsOperation defines a delayed tags-only update which is used in
+// delayedTagsUpdater. The tags map is the full desired tags collection of the
+// resource; operations on the same resource coalesce with the last one
+// winning, matching ARM PATCH semantics.
+type delayedTagsOperation struct {
+	kind          tagsResourceKind
+	resourceGroup string
+	name          string
+	tags          map[string]*string
+	result        chan error
+}
+
+// wait waits for the operation completion and returns the result.
+func (op *delayedTagsOperation) wait() error {
+	return <-op.result
+}
+
+// delayedTagsUpdater batches tags-only updates within "interval" period and
+// applies them as PATCH requests instead of full resource PUTs, so tag policy
+// rollouts across many services do not cause an ARM write storm.
+type delayedTagsUpdater struct {
+	az       *Cloud
+	interval time.Duration
+
+	lock         sync.Mutex
+	tagsToUpdate []*delayedTagsOperation
+}
+
+// newDelayedTagsUpdater creates a new delayedTagsUpdater.
+func newDelayedTagsUpdater(az *Cloud, interval time.Duration) *delayedTagsUpdater {
+	return &delayedTagsUpdater{
+		az:           az,
+		interval:     interval,
+		tagsToUpdate: make([]*delayedTagsOperation, 0),
+	}
+}
+
+// run starts the updater reconciling loop.
+func (d *delayedTagsUpdater) run() {
+	err := wait.PollImmediateInfinite(d.interval, func() (bool, error) {
+		d.updateTags()
+		return false, nil
+	})
+	if err != nil { // this should never happen, if it does, panic
+		panic(err)
+	}
+}
+
+// updateTags applies the queued tags operations, one PATCH per resource.
+func (d *delayedTagsUpdater) updateTags() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	// No need to do any updating.
+	if len(d.tagsToUpdate) == 0 {
+		return
+	}
+
+	// Coalesce the operations per resource so that each resource is patched
+	// at most once per interval, with the most recent tags winning.
+	operationsByResource := map[string][]*delayedTagsOperation{}
+	for _, op := range d.tagsToUpdate {
+		key := fmt.Sprintf("%s/%s/%s", op.kind, op.resourceGroup, op.name)
+		operationsByResource[key] = append(operationsByResource[key], op)
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	for _, operations := range operationsByResource {
+		op := operations[len(operations)-1]
+		err := d.applyTagsOperation(ctx, op)
+		if err != nil {
+			klog.Errorf("updateTags: failed to update tags of %s(%s/%s): %v", op.kind, op.resourceGroup, op.name, err)
+		}
+
+		// Notify all the goroutines waiting on this resource.
+		for _, operation := range operations {
+			operation.result <- err
+		}
+	}
+
+	// Clear all the jobs.
+	d.tagsToUpdate = make([]*delayedTagsOperation, 0)
+}
+
+// applyTagsOperation issues the tags PATCH for one resource and invalidates
+// the affected caches.
+func (d *delayedTagsUpdater) applyTagsOperation(ctx context.Context, op *delayedTagsOperation) error {
+	switch op.kind {
+	case tagsResourceLoadBalancer:
+		rerr := d.az.LoadBalancerClient.UpdateTags(ctx, op.resourceGroup, op.name, op.tags)
+		if rerr != nil {
+			return rerr.Error()
+		}
+		d.az.lbCache.Delete(op.name)
+		return nil
+	case tagsResourcePublicIP:
+		rerr := d.az.PublicIPAddressesClient.UpdateTags(ctx, op.resourceGroup, op.name, op.tags)
+		if rerr != nil {
+			return rerr.Error()
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown tags resource kind %q", op.kind)
+	}
+}
+
+// addTagsOperation enqueues the tags update of a resource and returns a
+// delayedTagsOperation. Callers that do not need the outcome may simply drop
+// the returned operation; its result channel is buffered.
+func (d *delayedTagsUpdater) addTagsOperation(kind tagsResourceKind, resourceGroup, name string, tags map[string]*string) *delayedTagsOperation {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	op := &delayedTagsOperation{
+		kind:          kind,
+		resourceGroup: resourceGroup,
+		name:          name,
+		tags:          tags,
+		result:        make(chan error, 1),
+	}
+	d.tagsToUpdate = append(d.tagsToUpdate, op)
+	return op
+}
@@ -0,0 +1,75 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/legacy-cloud-providers/azure/clients/loadbalancerclient/mockloadbalancerclient"
+	"k8s.io/legacy-cloud-providers/azure/clients/publicipclient/mockpublicipclient"
+	"k8s.io/legacy-cloud-providers/azure/retry"
+)
+
+func TestUpdateTagsCoalescesPerResource(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockLBsClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+
+	// Three queued operations against two resources yield one PATCH each,
+	// with the most recent tags of pip1 winning.
+	firstTags := map[string]*string{"policy": to.StringPtr("old")}
+	lastTags := map[string]*string{"policy": to.StringPtr("new")}
+	lbTags := map[string]*string{"policy": to.StringPtr("new")}
+	mockPIPsClient.EXPECT().UpdateTags(gomock.Any(), "rg", "pip1", lastTags).Return(nil).Times(1)
+	mockLBsClient.EXPECT().UpdateTags(gomock.Any(), "rg", "lb1", lbTags).Return(nil).Times(1)
+
+	firstOp := az.tagsUpdater.addTagsOperation(tagsResourcePublicIP, "rg", "pip1", firstTags)
+	lastOp := az.tagsUpdater.addTagsOperation(tagsResourcePublicIP, "rg", "pip1", lastTags)
+	lbOp := az.tagsUpdater.addTagsOperation(tagsResourceLoadBalancer, "rg", "lb1", lbTags)
+
+	az.tagsUpdater.updateTags()
+	assert.NoError(t, firstOp.wait())
+	assert.NoError(t, lastOp.wait())
+	assert.NoError(t, lbOp.wait())
+
+	// The queue is drained afterwards.
+	az.tagsUpdater.updateTags()
+}
+
+func TestUpdateTagsReportsErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPsClient.EXPECT().UpdateTags(gomock.Any(), "rg", "pip1", gomock.Any()).Return(
+		&retry.Error{RawError: fmt.Errorf("error")}).Times(1)
+
+	op := az.tagsUpdater.addTagsOperation(tagsResourcePublicIP, "rg", "pip1", map[string]*string{"k": to.StringPtr("v")})
+	az.tagsUpdater.updateTags()
+	assert.Error(t, op.wait())
+}
@@ -0,0 +1,230 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest/to"
+
+	"k8s.io/klog/v2"
+	azcache "k8s.io/legacy-cloud-providers/azure/cache"
+)
+
+// DestroyClusterResources deletes the provider-owned resources of a
+// decommissioned cluster: its load balancers, the public IPs created for its
+// services, the security rules stamped into the security group and the routes
+// of its nodes. Ownership is determined through resource tags, naming and the
+// description metadata on security rules, so pre-existing resources of other
+// tenants are left untouched. It is exported for cluster-deletion tooling and
+// must not run while the cluster still reconciles services.
+func (az *Cloud) DestroyClusterResources(ctx context.Context, clusterName string) error {
+	klog.V(2).Infof("DestroyClusterResources(%s): started", clusterName)
+
+	steps := []struct {
+		name string
+		fn   func(string) error
+	}{
+		{"load balancers", az.destroyClusterLoadBalancers},
+		{"public IPs", az.destroyClusterPublicIPs},
+		{"security rules", az.destroyClusterSecurityRules},
+		{"routes", az.destroyClusterRoutes},
+	}
+	for _, step := range steps {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := step.fn(clusterName); err != nil {
+			return fmt.Errorf("DestroyClusterResources(%s): deleting %s: %v", clusterName, step.name, err)
+		}
+	}
+
+	klog.V(2).Infof("DestroyClusterResources(%s): finished", clusterName)
+	return nil
+}
+
+// destroyClusterLoadBalancers deletes the load balancers named after the
+// cluster, including the internal and global internal variants. Load
+// balancers dedicated to single vm sets with the basic SKU keep their vm set
+// name and are not covered. Load balancers marked as externally owned are
+// never deleted, and a name match alone is not trusted when the load
+// balancer carries backend pools of which none is the cluster's.
+func (az *Cloud) destroyClusterLoadBalancers(clusterName string) error {
+	lbNamePrefix := clusterName
+	if az.LoadBalancerName != "" {
+		lbNamePrefix = az.LoadBalancerName
+	}
+
+	lbs, err := az.ListLB(nil)
+	if err != nil {
+		return err
+	}
+	for i := range lbs {
+		lb := lbs[i]
+		lbName := to.String(lb.Name)
+		if !strings.EqualFold(trimLoadBalancerNameSuffixes(lbName), lbNamePrefix) {
+			continue
+		}
+		if isLoadBalancerExternallyOwned(&lb) {
+			klog.V(2).Infof("DestroyClusterResources(%s): keeping externally owned load balancer %s", clusterName, lbName)
+			continue
+		}
+		if lb.LoadBalancerPropertiesFormat != nil && lb.BackendAddressPools != nil && len(*lb.BackendAddressPools) > 0 &&
+			az.clusterOwnedBackendPoolName(clusterName, &lb) == "" {
+			klog.V(2).Infof("DestroyClusterResources(%s): keeping load balancer %s without the cluster backend pool", clusterName, lbName)
+			continue
+		}
+
+		// The listing spans multiple resource groups, so the delete must
+		// target the group the load balancer was listed from.
+		rgName := resourceID(to.String(lb.ID)).resourceGroup()
+		if rgName == "" {
+			rgName = az.getLoadBalancerResourceGroup()
+		}
+		klog.V(2).Infof("DestroyClusterResources(%s): deleting load balancer %s", clusterName, lbName)
+		if err := az.DeleteLBInResourceGroup(nil, rgName, lbName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// destroyClusterPublicIPs deletes the public IPs tagged for services of the
+// cluster. Public IPs tagged with another cluster name, untagged
+// bring-your-own IPs and members of the configured public IP pool are kept;
+// pool members are returned to the pool instead.
+func (az *Cloud) destroyClusterPublicIPs(clusterName string) error {
+	resourceGroups := []string{az.ResourceGroup}
+	if az.PublicIPResourceGroup != "" && !strings.EqualFold(az.PublicIPResourceGroup, az.ResourceGroup) {
+		resourceGroups = append(resourceGroups, az.PublicIPResourceGroup)
+	}
+
+	for _, resourceGroup := range resourceGroups {
+		pips, err := az.ListPIP(nil, resourceGroup)
+		if err != nil {
+			return err
+		}
+		for i := range pips {
+			pip := pips[i]
+			if pip.Tags == nil || pip.Tags[serviceTagKey] == nil {
+				continue
+			}
+			// Backward compatible for clusters upgraded from old releases
+			// that only set the service tag.
+			if clusterTag := pip.Tags[clusterNameKey]; clusterTag != nil && *clusterTag != clusterName {
+				continue
+			}
+			if az.isPoolPublicIP(&pip) {
+				if err := az.returnPublicIPToPool(nil, resourceGroup, &pip); err != nil {
+					return err
+				}
+				continue
+			}
+			klog.V(2).Infof("DestroyClusterResources(%s): deleting public IP %s", clusterName, to.String(pip.Name))
+			if err := az.DeletePublicIP(nil, resourceGroup, to.String(pip.Name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// destroyClusterSecurityRules removes the security rules the provider
+// generated from the security group, recognized by the ownership metadata in
+// their description. The rule descriptions do not identify the cluster, so on
+// a security group shared between clusters the rules carrying another
+// cluster's coordination prefix are skipped, mirroring destroyClusterRoutes.
+// The security group itself is kept: it is addressed by cloud config and may
+// predate the cluster.
+func (az *Cloud) destroyClusterSecurityRules(clusterName string) error {
+	if az.SecurityGroupName == "" {
+		return nil
+	}
+
+	sg, err := az.getSecurityGroup(azcache.CacheReadTypeDefault)
+	if err != nil {
+		return err
+	}
+	if sg.SecurityGroupPropertiesFormat == nil || sg.SecurityRules == nil {
+		return nil
+	}
+
+	updatedRules := *sg.SecurityRules
+	dirtySg := false
+	for i := len(updatedRules) - 1; i >= 0; i-- {
+		rule := updatedRules[i]
+		if rule.SecurityRulePropertiesFormat == nil || rule.Description == nil {
+			continue
+		}
+		if _, ok := parseSecurityRuleDescription(*rule.Description); !ok {
+			continue
+		}
+		if az.ownedByOtherCluster(clusterName, to.String(rule.Name)) {
+			continue
+		}
+		klog.V(2).Infof("DestroyClusterResources(%s): removing security rule %s", clusterName, to.String(rule.Name))
+		updatedRules = append(updatedRules[:i], updatedRules[i+1:]...)
+		dirtySg = true
+	}
+	if !dirtySg {
+		return nil
+	}
+
+	sg.SecurityRules = &updatedRules
+	return az.CreateOrUpdateSecurityGroup(nil, sg)
+}
+
+// destroyClusterRoutes clears the routes of the cluster from the route table.
+// Without shared vnet coordination the table is dedicated to the cluster and
+// all routes are removed; with coordination enabled only the routes carrying
+// the cluster's prefix are, leaving the routes of the other tenants in place.
+func (az *Cloud) destroyClusterRoutes(clusterName string) error {
+	if az.RouteTableName == "" {
+		return nil
+	}
+
+	routeTable, existsRouteTable, err := az.getRouteTable(azcache.CacheReadTypeDefault)
+	if err != nil || !existsRouteTable {
+		return err
+	}
+	if routeTable.RouteTablePropertiesFormat == nil || routeTable.Routes == nil {
+		return nil
+	}
+
+	prefix := az.sharedResourcePrefix(clusterName)
+	updatedRoutes := *routeTable.Routes
+	dirtyTable := false
+	for i := len(updatedRoutes) - 1; i >= 0; i-- {
+		routeName := to.String(updatedRoutes[i].Name)
+		if prefix != "" && !strings.HasPrefix(routeName, prefix) {
+			continue
+		}
+		klog.V(2).Infof("DestroyClusterResources(%s): removing route %s", clusterName, routeName)
+		updatedRoutes = append(updatedRoutes[:i], updatedRoutes[i+1:]...)
+		dirtyTable = true
+	}
+	if !dirtyTable {
+		return nil
+	}
+
+	routeTable.Routes = &updatedRoutes
+	return az.CreateOrUpdateRouteTable(routeTable)
+}
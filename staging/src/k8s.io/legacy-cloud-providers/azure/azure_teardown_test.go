@@ -0,0 +1,280 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/legacy-cloud-providers/azure/clients/loadbalancerclient/mockloadbalancerclient"
+	"k8s.io/legacy-cloud-providers/azure/clients/publicipclient/mockpublicipclient"
+	"k8s.io/legacy-cloud-providers/azure/clients/routetableclient/mockroutetableclient"
+	"k8s.io/legacy-cloud-providers/azure/clients/securitygroupclient/mocksecuritygroupclient"
+	"k8s.io/legacy-cloud-providers/azure/retry"
+)
+
+func TestDestroyClusterResources(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.PublicIPAddressPoolName = "pool1"
+
+	// The cluster load balancers shall be deleted, load balancers of other
+	// vm sets or clusters shall not.
+	mockLBsClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBsClient.EXPECT().List(gomock.Any(), "rg").Return([]network.LoadBalancer{
+		{Name: to.StringPtr("testCluster")},
+		{Name: to.StringPtr("testCluster-internal")},
+		{Name: to.StringPtr("vmas1")},
+	}, nil).Times(1)
+	mockLBsClient.EXPECT().Delete(gomock.Any(), "rg", "testCluster").Return(nil).Times(1)
+	mockLBsClient.EXPECT().Delete(gomock.Any(), "rg", "testCluster-internal").Return(nil).Times(1)
+
+	// The service public IP of the cluster shall be deleted, the pool member
+	// shall be returned to the pool, and bring-your-own or foreign-cluster
+	// public IPs shall be kept.
+	var returnedPIP network.PublicIPAddress
+	mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPsClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{
+		{
+			Name: to.StringPtr("testCluster-aservice1"),
+			Tags: map[string]*string{
+				serviceTagKey:  to.StringPtr("default/service1"),
+				clusterNameKey: to.StringPtr(testClusterName),
+			},
+		},
+		{
+			Name: to.StringPtr("otherCluster-aservice1"),
+			Tags: map[string]*string{
+				serviceTagKey:  to.StringPtr("default/service1"),
+				clusterNameKey: to.StringPtr("otherCluster"),
+			},
+		},
+		{Name: to.StringPtr("byo-pip")},
+		{
+			Name: to.StringPtr("pool-pip-1"),
+			Tags: map[string]*string{
+				pipPoolTagKey:  to.StringPtr("pool1"),
+				serviceTagKey:  to.StringPtr("default/service2"),
+				clusterNameKey: to.StringPtr(testClusterName),
+			},
+		},
+	}, nil).Times(1)
+	mockPIPsClient.EXPECT().Delete(gomock.Any(), "rg", "testCluster-aservice1").Return(nil).Times(1)
+	mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "pool-pip-1", gomock.Any()).DoAndReturn(
+		func(ctx context.Context, resourceGroupName string, publicIPAddressName string, parameters network.PublicIPAddress) *retry.Error {
+			returnedPIP = parameters
+			return nil
+		}).Times(1)
+
+	// The generated security rules shall be removed from the security group,
+	// rules written by operators shall be kept.
+	var updatedSg network.SecurityGroup
+	mockSGsClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+	mockSGsClient.EXPECT().Get(gomock.Any(), "rg", "nsg", gomock.Any()).Return(network.SecurityGroup{
+		Name: to.StringPtr("nsg"),
+		SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+			SecurityRules: &[]network.SecurityRule{
+				{
+					Name: to.StringPtr("atest1-TCP-80-Internet"),
+					SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+						Description: to.StringPtr("k8s-azure-service uid=uid1 service=default/service1 created=2020-01-01T00:00:00Z"),
+					},
+				},
+				{
+					Name: to.StringPtr("deny-all"),
+					SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+						Description: to.StringPtr("added by the operator"),
+					},
+				},
+			},
+		},
+	}, nil).Times(1)
+	mockSGsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "nsg", gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, resourceGroupName string, networkSecurityGroupName string, parameters network.SecurityGroup, etag string) *retry.Error {
+			updatedSg = parameters
+			return nil
+		}).Times(1)
+
+	// The routes of the nodes shall be cleared from the route table.
+	var updatedRouteTable network.RouteTable
+	mockRTsClient := az.RouteTablesClient.(*mockroutetableclient.MockInterface)
+	mockRTsClient.EXPECT().Get(gomock.Any(), "rg", "rt", "").Return(network.RouteTable{
+		Name: to.StringPtr("rt"),
+		RouteTablePropertiesFormat: &network.RouteTablePropertiesFormat{
+			Routes: &[]network.Route{
+				{Name: to.StringPtr("node-1")},
+				{Name: to.StringPtr("node-2")},
+			},
+		},
+	}, nil).Times(1)
+	mockRTsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "rt", gomock.Any(), "").DoAndReturn(
+		func(ctx context.Context, resourceGroupName string, routeTableName string, parameters network.RouteTable, etag string) *retry.Error {
+			updatedRouteTable = parameters
+			return nil
+		}).Times(1)
+
+	err := az.DestroyClusterResources(context.Background(), testClusterName)
+	assert.NoError(t, err)
+
+	assert.NotContains(t, returnedPIP.Tags, serviceTagKey)
+	assert.NotContains(t, returnedPIP.Tags, clusterNameKey)
+	assert.Contains(t, returnedPIP.Tags, pipPoolTagKey)
+
+	assert.Len(t, *updatedSg.SecurityRules, 1)
+	assert.Equal(t, "deny-all", to.String((*updatedSg.SecurityRules)[0].Name))
+
+	assert.Len(t, *updatedRouteTable.Routes, 0)
+}
+
+func TestDestroyClusterRoutesSharedVNet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.SharedVNetCoordination = true
+
+	// With shared vnet coordination only the routes carrying the cluster
+	// prefix shall be removed from the shared route table.
+	var updatedRouteTable network.RouteTable
+	mockRTsClient := az.RouteTablesClient.(*mockroutetableclient.MockInterface)
+	mockRTsClient.EXPECT().Get(gomock.Any(), "rg", "rt", "").Return(network.RouteTable{
+		Name: to.StringPtr("rt"),
+		RouteTablePropertiesFormat: &network.RouteTablePropertiesFormat{
+			Routes: &[]network.Route{
+				{Name: to.StringPtr(az.sharedResourcePrefix(testClusterName) + "node-1")},
+				{Name: to.StringPtr("otherCluster_node-1")},
+			},
+		},
+	}, nil).Times(1)
+	mockRTsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "rt", gomock.Any(), "").DoAndReturn(
+		func(ctx context.Context, resourceGroupName string, routeTableName string, parameters network.RouteTable, etag string) *retry.Error {
+			updatedRouteTable = parameters
+			return nil
+		}).Times(1)
+
+	err := az.destroyClusterRoutes(testClusterName)
+	assert.NoError(t, err)
+	assert.Len(t, *updatedRouteTable.Routes, 1)
+	assert.Equal(t, "otherCluster_node-1", to.String((*updatedRouteTable.Routes)[0].Name))
+}
+
+func TestDestroyClusterLoadBalancersOwnership(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.VnetResourceGroup = "vnet-rg"
+
+	// An externally owned load balancer and a name-matching load balancer
+	// whose backend pools all belong to someone else shall be kept; the
+	// cluster load balancer listed from another resource group shall be
+	// deleted in the group it was listed from.
+	az.lbListCache.Set("rg", []network.LoadBalancer{
+		{
+			Name: to.StringPtr("testCluster"),
+			Tags: map[string]*string{externallyOwnedLBTagKey: to.StringPtr("true")},
+		},
+		{
+			Name: to.StringPtr("testCluster-internal"),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+				BackendAddressPools: &[]network.BackendAddressPool{{Name: to.StringPtr("otherCluster")}},
+			},
+		},
+	})
+	az.lbListCache.Set("vnet-rg", []network.LoadBalancer{
+		{
+			Name: to.StringPtr("testCluster"),
+			ID:   to.StringPtr("/subscriptions/sub/resourceGroups/vnet-rg/providers/Microsoft.Network/loadBalancers/testCluster"),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+				BackendAddressPools: &[]network.BackendAddressPool{{Name: to.StringPtr(testClusterName)}},
+			},
+		},
+	})
+
+	mockLBsClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBsClient.EXPECT().Delete(gomock.Any(), "vnet-rg", "testCluster").Return(nil).Times(1)
+
+	err := az.destroyClusterLoadBalancers(testClusterName)
+	assert.NoError(t, err)
+}
+
+func TestDestroyClusterSecurityRulesSharedVNet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.SharedVNetCoordination = true
+
+	// The rule descriptions do not identify the cluster, so on a shared
+	// security group the rules carrying another cluster's coordination
+	// prefix shall be kept.
+	description := "k8s-azure-service uid=uid1 service=default/service1 created=2020-01-01T00:00:00Z"
+	var updatedSg network.SecurityGroup
+	mockSGsClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+	mockSGsClient.EXPECT().Get(gomock.Any(), "rg", "nsg", gomock.Any()).Return(network.SecurityGroup{
+		Name: to.StringPtr("nsg"),
+		SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+			SecurityRules: &[]network.SecurityRule{
+				{
+					Name: to.StringPtr(az.sharedResourcePrefix(testClusterName) + "atest1-TCP-80-Internet"),
+					SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+						Description: to.StringPtr(description),
+					},
+				},
+				{
+					Name: to.StringPtr(az.sharedResourcePrefix("otherCluster") + "atest1-TCP-80-Internet"),
+					SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+						Description: to.StringPtr(description),
+					},
+				},
+			},
+		},
+	}, nil).Times(1)
+	mockSGsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "nsg", gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, resourceGroupName string, networkSecurityGroupName string, parameters network.SecurityGroup, etag string) *retry.Error {
+			updatedSg = parameters
+			return nil
+		}).Times(1)
+
+	err := az.destroyClusterSecurityRules(testClusterName)
+	assert.NoError(t, err)
+	assert.Len(t, *updatedSg.SecurityRules, 1)
+	assert.Equal(t, az.sharedResourcePrefix("otherCluster")+"atest1-TCP-80-Internet", to.String((*updatedSg.SecurityRules)[0].Name))
+}
+
+func TestDestroyClusterResourcesCanceled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// A canceled context shall stop the teardown before any resource is
+	// touched.
+	err := az.DestroyClusterResources(ctx, testClusterName)
+	assert.Equal(t, context.Canceled, err)
+}
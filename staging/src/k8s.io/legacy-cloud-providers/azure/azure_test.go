@@ -186,6 +186,9 @@ func setMockPublicIPs(az *Cloud, ctrl *gomock.Controller, serviceCount int) {
 		mockPIPsClient.EXPECT().Delete(gomock.Any(), az.ResourceGroup, fmt.Sprintf("testCluster-aservice%c", a)).Return(nil).AnyTimes()
 		a++
 	}
+	// Public IPs of services with a dedicated resource group are also looked
+	// up in the cluster resource group during migration.
+	mockPIPsClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, gomock.Any(), gomock.Any()).Return(network.PublicIPAddress{}, &retry.Error{HTTPStatusCode: http.StatusNotFound, RawError: cloudprovider.InstanceNotFound}).AnyTimes()
 }
 
 func setMockSecurityGroup(az *Cloud, ctrl *gomock.Controller, sgs ...*network.SecurityGroup) {
@@ -1867,6 +1870,31 @@ func TestSecurityRulePriorityPicksNextAvailablePriority(t *testing.T) {
 	}
 }
 
+func TestSecurityRulePriorityScansUpwardsFromStart(t *testing.T) {
+	rules := []network.SecurityRule{}
+
+	var start int32 = loadBalancerMinimumPriority + 1500
+	var expectedPriority int32 = start + 10
+
+	var i int32
+	for i = start; i < expectedPriority; i++ {
+		rules = append(rules, network.SecurityRule{
+			SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+				Priority: to.Int32Ptr(i),
+			},
+		})
+	}
+
+	priority, err := getNextAvailablePriorityFrom(rules, start)
+	if err != nil {
+		t.Errorf("Unexpectected error: %q", err)
+	}
+
+	if priority != expectedPriority {
+		t.Errorf("Expected priority %d. Got priority %d.", expectedPriority, priority)
+	}
+}
+
 func TestSecurityRulePriorityFailsIfExhausted(t *testing.T) {
 	rules := []network.SecurityRule{}
 
@@ -3221,6 +3249,63 @@ func TestGetNodeResourceGroup(t *testing.T) {
 	}
 }
 
+func TestShouldNodeExcludedFromLoadBalancer(t *testing.T) {
+	tests := []struct {
+		name                          string
+		labels                        map[string]string
+		managedExternalResourceGroups []string
+		expected                      bool
+	}{
+		{
+			name:     "node without labels should not be excluded",
+			expected: false,
+		},
+		{
+			name:     "node in external resource group should be excluded",
+			labels:   map[string]string{externalResourceGroupLabel: "byo-rg"},
+			expected: true,
+		},
+		{
+			name:                          "node in allow-listed external resource group should not be excluded",
+			labels:                        map[string]string{externalResourceGroupLabel: "byo-rg"},
+			managedExternalResourceGroups: []string{"BYO-RG"},
+			expected:                      false,
+		},
+		{
+			name:                          "node in external resource group not allow-listed should be excluded",
+			labels:                        map[string]string{externalResourceGroupLabel: "other-rg"},
+			managedExternalResourceGroups: []string{"byo-rg"},
+			expected:                      true,
+		},
+		{
+			name:     "node in the cluster resource group should not be excluded",
+			labels:   map[string]string{externalResourceGroupLabel: "rg"},
+			expected: false,
+		},
+		{
+			name:                          "unmanaged node should be excluded even if its resource group is allow-listed",
+			labels:                        map[string]string{externalResourceGroupLabel: "byo-rg", managedByAzureLabel: "false"},
+			managedExternalResourceGroups: []string{"byo-rg"},
+			expected:                      true,
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	for _, test := range tests {
+		az.ManagedExternalResourceGroups = test.managedExternalResourceGroups
+		node := v1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "node",
+				Labels: test.labels,
+			},
+		}
+
+		assert.Equal(t, test.expected, az.ShouldNodeExcludedFromLoadBalancer(&node), test.name)
+	}
+}
+
 func TestSetInformers(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -3483,3 +3568,42 @@ func TestFindSecurityRule(t *testing.T) {
 		assert.Equal(t, testCases[i].expected, found, testCases[i].desc)
 	}
 }
+
+func TestDisableManagementToggles(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	_, supported := az.LoadBalancer()
+	assert.True(t, supported)
+	_, supported = az.Routes()
+	assert.True(t, supported)
+
+	az.DisableLoadBalancerManagement = true
+	az.DisableRouteManagement = true
+	_, supported = az.LoadBalancer()
+	assert.False(t, supported, "load balancer management should be reported unsupported when disabled")
+	_, supported = az.Routes()
+	assert.False(t, supported, "route management should be reported unsupported when disabled")
+
+	// Instances and zones stay available for node metadata.
+	_, supported = az.Instances()
+	assert.True(t, supported)
+	_, supported = az.Zones()
+	assert.True(t, supported)
+}
+
+func TestGetClientUserAgent(t *testing.T) {
+	az := &Cloud{}
+	az.Config.VMType = vmTypeVMSS
+	az.Config.LoadBalancerSku = loadBalancerSkuStandard
+
+	userAgent := az.getClientUserAgent()
+	assert.True(t, strings.HasPrefix(userAgent, "kubernetes-cloudprovider/"))
+	assert.Contains(t, userAgent, "vmType/vmss")
+	assert.Contains(t, userAgent, "lbSku/standard")
+
+	az.Config.UserAgentSuffix = "cluster/test-cluster"
+	userAgent = az.getClientUserAgent()
+	assert.True(t, strings.HasSuffix(userAgent, "; cluster/test-cluster"))
+}
@@ -19,15 +19,104 @@ limitations under the License.
 package azure
 
 import (
+	"encoding/json"
+	"fmt"
+
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-12-01/compute"
 	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
 
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
 	azcache "k8s.io/legacy-cloud-providers/azure/cache"
+	"k8s.io/legacy-cloud-providers/azure/metrics"
+)
+
+// hostInPoolResult describes why ensureHostInPool joined or skipped a node.
+type hostInPoolResult string
+
+const (
+	// hostJoined means the node's primary IP configuration participates in the
+	// backend pool.
+	hostJoined hostInPoolResult = "Joined"
+	// hostSkippedNotInVMSet means the node was skipped because it is not part
+	// of the load balancer's vmSet.
+	hostSkippedNotInVMSet hostInPoolResult = "SkippedNotInVMSet"
+	// hostSkippedFailedNIC means the node was skipped because its primary
+	// network interface is in Failed state or couldn't be obtained.
+	hostSkippedFailedNIC hostInPoolResult = "SkippedFailedNIC"
+	// hostSkippedOtherLB means the node was skipped because its network
+	// interface has already been added to another load balancer.
+	hostSkippedOtherLB hostInPoolResult = "SkippedOtherLB"
 )
 
+// nodeAnnotationBackendPoolSkipReason records on the node why its NIC was
+// skipped for the backend pool, so that node-level automation can remediate
+// without digging through controller logs. It is removed when the node joins.
+const nodeAnnotationBackendPoolSkipReason = "kubernetes.azure.com/load-balancer-backend-pool-skip-reason"
+
+// reportHostsInPoolResults records metrics for the typed ensureHostInPool
+// results and emits a summary event on the service, so that operators can see
+// which nodes back the service and why others were skipped.
+func reportHostsInPoolResults(az *Cloud, service *v1.Service, backendPoolID string, counts map[hostInPoolResult]int) {
+	for result, count := range counts {
+		metrics.BackendPoolHostResultsCount(string(result), count)
+	}
+
+	message := fmt.Sprintf("backendPoolID %s: %s: %d, %s: %d, %s: %d, %s: %d", backendPoolID,
+		hostJoined, counts[hostJoined],
+		hostSkippedNotInVMSet, counts[hostSkippedNotInVMSet],
+		hostSkippedFailedNIC, counts[hostSkippedFailedNIC],
+		hostSkippedOtherLB, counts[hostSkippedOtherLB])
+	klog.V(4).Infof("reportHostsInPoolResults for service (%s): %s", getServiceName(service), message)
+	az.Event(service, v1.EventTypeNormal, "EnsureBackendPoolHosts", message)
+}
+
+// recordHostInPoolOutcome mirrors the ensureHostInPool result onto the node:
+// skipped nodes get the skip reason annotation and a warning event, joined
+// nodes get the annotation removed. The node object is only patched when the
+// annotation actually changes to avoid API churn on steady-state reconciles.
+func recordHostInPoolOutcome(az *Cloud, node *v1.Node, result hostInPoolResult) {
+	if az.KubeClient == nil || node == nil {
+		return
+	}
+
+	skipReason := ""
+	if result != hostJoined {
+		skipReason = string(result)
+	}
+	if node.Annotations[nodeAnnotationBackendPoolSkipReason] == skipReason {
+		return
+	}
+
+	annotations := map[string]interface{}{}
+	if skipReason == "" {
+		annotations[nodeAnnotationBackendPoolSkipReason] = nil
+	} else {
+		annotations[nodeAnnotationBackendPoolSkipReason] = skipReason
+		az.Event(node, v1.EventTypeWarning, "BackendPoolSkipped",
+			fmt.Sprintf("node not added to the load balancer backend pool: %s", result))
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+	})
+	if err != nil {
+		klog.Warningf("recordHostInPoolOutcome(%s): failed to marshal the annotation patch: %v", node.Name, err)
+		return
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	if _, err := az.KubeClient.CoreV1().Nodes().Patch(ctx, node.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		klog.Warningf("recordHostInPoolOutcome(%s): failed to patch the skip reason annotation: %v", node.Name, err)
+	}
+}
+
 // VMSet defines functions all vmsets (including scale set and availability
 // set) should be implemented.
 // Don't forget to run the following command to generate the mock client:
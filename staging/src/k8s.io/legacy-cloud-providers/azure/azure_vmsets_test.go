@@ -0,0 +1,90 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakeclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRecordHostInPoolOutcome(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testCases := []struct {
+		description        string
+		existingAnnotation string
+		result             hostInPoolResult
+		expectedAnnotation string
+	}{
+		{
+			description:        "a skipped node should get the skip reason annotation",
+			result:             hostSkippedFailedNIC,
+			expectedAnnotation: string(hostSkippedFailedNIC),
+		},
+		{
+			description:        "a stale skip reason should be replaced",
+			existingAnnotation: string(hostSkippedOtherLB),
+			result:             hostSkippedNotInVMSet,
+			expectedAnnotation: string(hostSkippedNotInVMSet),
+		},
+		{
+			description:        "the annotation should be removed when the node joins",
+			existingAnnotation: string(hostSkippedFailedNIC),
+			result:             hostJoined,
+		},
+		{
+			description: "a joined node without the annotation should stay untouched",
+			result:      hostJoined,
+		},
+	}
+
+	for _, test := range testCases {
+		az := GetTestCloud(ctrl)
+		node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+		if test.existingAnnotation != "" {
+			node.Annotations = map[string]string{nodeAnnotationBackendPoolSkipReason: test.existingAnnotation}
+		}
+		az.KubeClient = fakeclient.NewSimpleClientset(node)
+
+		recordHostInPoolOutcome(az, node, test.result)
+
+		updated, err := az.KubeClient.CoreV1().Nodes().Get(context.TODO(), node.Name, metav1.GetOptions{})
+		assert.NoError(t, err, test.description)
+		if test.expectedAnnotation == "" {
+			assert.NotContains(t, updated.Annotations, nodeAnnotationBackendPoolSkipReason, test.description)
+		} else {
+			assert.Equal(t, test.expectedAnnotation, updated.Annotations[nodeAnnotationBackendPoolSkipReason], test.description)
+		}
+	}
+
+	// A missing kube client or node must not panic.
+	az := GetTestCloud(ctrl)
+	az.KubeClient = nil
+	recordHostInPoolOutcome(az, &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}, hostSkippedFailedNIC)
+	az.KubeClient = fakeclient.NewSimpleClientset()
+	recordHostInPoolOutcome(az, nil, hostSkippedFailedNIC)
+}
@@ -55,6 +55,10 @@ var (
 	vmssVMProviderIDRE     = regexp.MustCompile(`azure:///subscriptions/(?:.*)/resourceGroups/(.+)/providers/Microsoft.Compute/virtualMachineScaleSets/(.+)/virtualMachines/(?:\d+)`)
 )
 
+// vmssInstanceUpdateBatchSize is the maximum number of instance IDs sent in
+// one batch update call.
+const vmssInstanceUpdateBatchSize = 100
+
 // vmssMetaInfo contains the metadata for a VMSS.
 type vmssMetaInfo struct {
 	vmssName      string
@@ -79,6 +83,7 @@ type scaleSet struct {
 	vmssCache                 *azcache.TimedCache
 	vmssVMCache               *sync.Map // [resourcegroup/vmssname]*azcache.TimedCache
 	availabilitySetNodesCache *azcache.TimedCache
+	flexScaleSetNodesCache    *azcache.TimedCache
 }
 
 // newScaleSet creates a new scaleSet.
@@ -100,6 +105,11 @@ func newScaleSet(az *Cloud) (VMSet, error) {
 		}
 	}
 
+	ss.flexScaleSetNodesCache, err = ss.newFlexScaleSetNodesCache()
+	if err != nil {
+		return nil, err
+	}
+
 	ss.vmssCache, err = ss.newVMSSCache()
 	if err != nil {
 		return nil, err
@@ -237,8 +247,11 @@ func (ss *scaleSet) GetPowerStatusByNodeName(name string) (powerState string, er
 	}
 
 	// vm.InstanceView or vm.InstanceView.Statuses are nil when the VM is under deleting.
-	klog.V(3).Infof("InstanceView for node %q is nil, assuming it's stopped", name)
-	return vmPowerStateStopped, nil
+	var provisioningState string
+	if vm.VirtualMachineScaleSetVMProperties != nil {
+		provisioningState = to.String(vm.ProvisioningState)
+	}
+	return ss.powerStateForMissingInstanceView(name, provisioningState)
 }
 
 // GetProvisioningStateByNodeName returns the provisioningState for the specified node.
@@ -338,6 +351,17 @@ func (ss *scaleSet) GetInstanceIDByNodeName(name string) (string, error) {
 		return ss.availabilitySet.GetInstanceIDByNodeName(name)
 	}
 
+	managedByFlex, err := ss.isNodeManagedByFlexScaleSet(name, azcache.CacheReadTypeUnsafe)
+	if err != nil {
+		klog.Errorf("Failed to check isNodeManagedByFlexScaleSet: %v", err)
+		return "", err
+	}
+	if managedByFlex {
+		// Flex instances are standalone VMs, so the instance ID comes from
+		// the VM API instead of the VMSS instance API.
+		return ss.availabilitySet.GetInstanceIDByNodeName(name)
+	}
+
 	_, _, vm, err := ss.getVmssVM(name, azcache.CacheReadTypeUnsafe)
 	if err != nil {
 		return "", err
@@ -480,9 +504,9 @@ func (ss *scaleSet) GetIPByNodeName(nodeName string) (string, string, error) {
 		return "", "", err
 	}
 
-	ipConfig, err := getPrimaryIPConfig(nic)
+	ipConfig, err := ss.getProviderPrimaryIPConfig(nic)
 	if err != nil {
-		klog.Errorf("error: ss.GetIPByNodeName(%s), getPrimaryIPConfig(%v), err=%v", nodeName, nic, err)
+		klog.Errorf("error: ss.GetIPByNodeName(%s), getProviderPrimaryIPConfig(%v), err=%v", nodeName, nic, err)
 		return "", "", err
 	}
 
@@ -831,6 +855,17 @@ func (ss *scaleSet) GetPrimaryInterface(nodeName string) (network.Interface, err
 		return ss.availabilitySet.GetPrimaryInterface(nodeName)
 	}
 
+	managedByFlex, err := ss.isNodeManagedByFlexScaleSet(nodeName, azcache.CacheReadTypeDefault)
+	if err != nil {
+		klog.Errorf("Failed to check isNodeManagedByFlexScaleSet: %v", err)
+		return network.Interface{}, err
+	}
+	if managedByFlex {
+		// Flex instances attach regular network interfaces, which are read
+		// through the VM APIs like for availability set nodes.
+		return ss.availabilitySet.GetPrimaryInterface(nodeName)
+	}
+
 	ssName, instanceID, vm, err := ss.getVmssVM(nodeName, azcache.CacheReadTypeDefault)
 	if err != nil {
 		// VM is availability set, but not cached yet in availabilitySetNodesCache.
@@ -952,11 +987,30 @@ func (ss *scaleSet) getConfigForScaleSetByIPFamily(config *compute.VirtualMachin
 // EnsureHostInPool ensures the given VM's Primary NIC's Primary IP Configuration is
 // participating in the specified LoadBalancer Backend Pool, which returns (resourceGroup, vmssName, instanceID, vmssVM, error).
 func (ss *scaleSet) EnsureHostInPool(service *v1.Service, nodeName types.NodeName, backendPoolID string, vmSetName string, isInternal bool) (string, string, string, *compute.VirtualMachineScaleSetVM, error) {
+	managedByFlex, err := ss.isNodeManagedByFlexScaleSet(mapNodeNameToVMName(nodeName), azcache.CacheReadTypeDefault)
+	if err != nil {
+		klog.Errorf("Failed to check isNodeManagedByFlexScaleSet: %v", err)
+		return "", "", "", nil, err
+	}
+	if managedByFlex {
+		// Flex instances join the pool through their VM network interfaces
+		// like availability set nodes do.
+		return ss.availabilitySet.EnsureHostInPool(service, nodeName, backendPoolID, vmSetName, isInternal)
+	}
+
+	nodeResourceGroup, ssName, instanceID, vm, _, err := ss.ensureHostInPool(service, nodeName, backendPoolID, vmSetName, isInternal)
+	return nodeResourceGroup, ssName, instanceID, vm, err
+}
+
+// ensureHostInPool implements EnsureHostInPool and additionally reports a
+// typed result describing whether the node joined the pool or why it was
+// skipped.
+func (ss *scaleSet) ensureHostInPool(service *v1.Service, nodeName types.NodeName, backendPoolID string, vmSetName string, isInternal bool) (string, string, string, *compute.VirtualMachineScaleSetVM, hostInPoolResult, error) {
 	klog.V(3).Infof("ensuring node %q of scaleset %q in LB backendpool %q", nodeName, vmSetName, backendPoolID)
-	vmName := mapNodeNameToVMName(nodeName)
+	vmName := ss.getVMNameByNodeName(nodeName)
 	ssName, instanceID, vm, err := ss.getVmssVM(vmName, azcache.CacheReadTypeDefault)
 	if err != nil {
-		return "", "", "", nil, err
+		return "", "", "", nil, "", err
 	}
 
 	// Check scale set name:
@@ -965,19 +1019,19 @@ func (ss *scaleSet) EnsureHostInPool(service *v1.Service, nodeName types.NodeNam
 	//   don't check vmSet for it.
 	if vmSetName != "" && !ss.useStandardLoadBalancer() && !strings.EqualFold(vmSetName, ssName) {
 		klog.V(3).Infof("EnsureHostInPool skips node %s because it is not in the scaleSet %s", vmName, vmSetName)
-		return "", "", "", nil, nil
+		return "", "", "", nil, hostSkippedNotInVMSet, nil
 	}
 
 	// Find primary network interface configuration.
 	if vm.NetworkProfileConfiguration.NetworkInterfaceConfigurations == nil {
 		klog.V(4).Infof("EnsureHostInPool: cannot obtain the primary network interface configuration, of vm %s, probably because the vm's being deleted", vmName)
-		return "", "", "", nil, nil
+		return "", "", "", nil, hostSkippedFailedNIC, nil
 	}
 
 	networkInterfaceConfigurations := *vm.NetworkProfileConfiguration.NetworkInterfaceConfigurations
 	primaryNetworkInterfaceConfiguration, err := ss.getPrimaryNetworkInterfaceConfiguration(networkInterfaceConfigurations, vmName)
 	if err != nil {
-		return "", "", "", nil, err
+		return "", "", "", nil, "", err
 	}
 
 	var primaryIPConfiguration *compute.VirtualMachineScaleSetIPConfiguration
@@ -987,7 +1041,7 @@ func (ss *scaleSet) EnsureHostInPool(service *v1.Service, nodeName types.NodeNam
 		// Find primary IP configuration.
 		primaryIPConfiguration, err = getPrimaryIPConfigFromVMSSNetworkConfig(primaryNetworkInterfaceConfiguration)
 		if err != nil {
-			return "", "", "", nil, err
+			return "", "", "", nil, "", err
 		}
 	} else {
 		// For IPv6 or dualstack service, we need to pick the right IP configuration based on the cluster ip family
@@ -995,7 +1049,7 @@ func (ss *scaleSet) EnsureHostInPool(service *v1.Service, nodeName types.NodeNam
 		// privateIPAddressVersion matches the clusterIP family
 		primaryIPConfiguration, err = ss.getConfigForScaleSetByIPFamily(primaryNetworkInterfaceConfiguration, vmName, ipv6)
 		if err != nil {
-			return "", "", "", nil, err
+			return "", "", "", nil, "", err
 		}
 	}
 
@@ -1006,7 +1060,7 @@ func (ss *scaleSet) EnsureHostInPool(service *v1.Service, nodeName types.NodeNam
 		newBackendPools = *primaryIPConfiguration.LoadBalancerBackendAddressPools
 	}
 	for _, existingPool := range newBackendPools {
-		if strings.EqualFold(backendPoolID, *existingPool.ID) {
+		if equalResourceIDs(backendPoolID, *existingPool.ID) {
 			foundPool = true
 			break
 		}
@@ -1014,7 +1068,7 @@ func (ss *scaleSet) EnsureHostInPool(service *v1.Service, nodeName types.NodeNam
 
 	// The backendPoolID has already been found from existing LoadBalancerBackendAddressPools.
 	if foundPool {
-		return "", "", "", nil, nil
+		return "", "", "", nil, hostJoined, nil
 	}
 
 	if ss.useStandardLoadBalancer() && len(newBackendPools) > 0 {
@@ -1030,11 +1084,11 @@ func (ss *scaleSet) EnsureHostInPool(service *v1.Service, nodeName types.NodeNam
 		}
 		isSameLB, oldLBName, err := isBackendPoolOnSameLB(backendPoolID, newBackendPoolsIDs)
 		if err != nil {
-			return "", "", "", nil, err
+			return "", "", "", nil, "", err
 		}
 		if !isSameLB {
 			klog.V(4).Infof("Node %q has already been added to LB %q, omit adding it to a new one", nodeName, oldLBName)
-			return "", "", "", nil, nil
+			return "", "", "", nil, hostSkippedOtherLB, nil
 		}
 	}
 
@@ -1058,10 +1112,10 @@ func (ss *scaleSet) EnsureHostInPool(service *v1.Service, nodeName types.NodeNam
 	// Get the node resource group.
 	nodeResourceGroup, err := ss.GetNodeResourceGroup(vmName)
 	if err != nil {
-		return "", "", "", nil, err
+		return "", "", "", nil, "", err
 	}
 
-	return nodeResourceGroup, ssName, instanceID, newVM, nil
+	return nodeResourceGroup, ssName, instanceID, newVM, hostJoined, nil
 }
 
 func getVmssAndResourceGroupNameByVMProviderID(providerID string) (string, string, error) {
@@ -1079,7 +1133,7 @@ func (ss *scaleSet) ensureVMSSInPool(service *v1.Service, nodes []*v1.Node, back
 	// the standard load balancer supports multiple vmss in its backend while the basic sku doesn't
 	if ss.useStandardLoadBalancer() {
 		for _, node := range nodes {
-			if ss.excludeMasterNodesFromStandardLB() && isMasterNode(node) {
+			if ss.excludeMasterNodesFromLB(service) && isMasterNode(node) {
 				continue
 			}
 
@@ -1147,14 +1201,26 @@ func (ss *scaleSet) ensureVMSSInPool(service *v1.Service, nodes []*v1.Node, back
 			loadBalancerBackendAddressPools = *primaryIPConfig.LoadBalancerBackendAddressPools
 		}
 
-		var found bool
-		for _, loadBalancerBackendAddressPool := range loadBalancerBackendAddressPools {
-			if strings.EqualFold(*loadBalancerBackendAddressPool.ID, backendPoolID) {
-				found = true
-				break
+		wantedPoolIDs := []string{backendPoolID}
+		if ss.perVMSSBackendPoolsEnabled() {
+			// The scale set model also joins its dedicated backend pool, so
+			// per-pool membership updates stay scoped to this scale set.
+			wantedPoolIDs = append(wantedPoolIDs, getPerVMSSBackendPoolID(backendPoolID, vmssName))
+		}
+		missingPoolIDs := []string{}
+		for _, wantedPoolID := range wantedPoolIDs {
+			var found bool
+			for _, loadBalancerBackendAddressPool := range loadBalancerBackendAddressPools {
+				if equalResourceIDs(*loadBalancerBackendAddressPool.ID, wantedPoolID) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				missingPoolIDs = append(missingPoolIDs, wantedPoolID)
 			}
 		}
-		if found {
+		if len(missingPoolIDs) == 0 {
 			continue
 		}
 
@@ -1179,11 +1245,13 @@ func (ss *scaleSet) ensureVMSSInPool(service *v1.Service, nodes []*v1.Node, back
 			}
 		}
 
-		// Compose a new vmss with added backendPoolID.
-		loadBalancerBackendAddressPools = append(loadBalancerBackendAddressPools,
-			compute.SubResource{
-				ID: to.StringPtr(backendPoolID),
-			})
+		// Compose a new vmss with the missing backend pool IDs added.
+		for _, missingPoolID := range missingPoolIDs {
+			loadBalancerBackendAddressPools = append(loadBalancerBackendAddressPools,
+				compute.SubResource{
+					ID: to.StringPtr(missingPoolID),
+				})
+		}
 		primaryIPConfig.LoadBalancerBackendAddressPools = &loadBalancerBackendAddressPools
 		newVMSS := compute.VirtualMachineScaleSet{
 			Location: vmss.Location,
@@ -1209,13 +1277,20 @@ func (ss *scaleSet) ensureVMSSInPool(service *v1.Service, nodes []*v1.Node, back
 // EnsureHostsInPool ensures the given Node's primary IP configurations are
 // participating in the specified LoadBalancer Backend Pool.
 func (ss *scaleSet) EnsureHostsInPool(service *v1.Service, nodes []*v1.Node, backendPoolID string, vmSetName string, isInternal bool) error {
+	if !ss.isLBBackendPoolTypeNodeIPConfig() {
+		return ss.ensureIPBasedBackendPoolHosts(service, backendPoolID, nodes)
+	}
+
 	hostUpdates := make([]func() error, 0, len(nodes))
 	nodeUpdates := make(map[vmssMetaInfo]map[string]compute.VirtualMachineScaleSetVM)
 	errors := make([]error, 0)
+	var resultsLock sync.Mutex
+	results := make(map[hostInPoolResult]int)
 	for _, node := range nodes {
+		localNode := node
 		localNodeName := node.Name
 
-		if ss.useStandardLoadBalancer() && ss.excludeMasterNodesFromStandardLB() && isMasterNode(node) {
+		if ss.useStandardLoadBalancer() && ss.excludeMasterNodesFromLB(service) && isMasterNode(node) {
 			klog.V(4).Infof("Excluding master node %q from load balancer backendpool %q", localNodeName, backendPoolID)
 			continue
 		}
@@ -1233,26 +1308,56 @@ func (ss *scaleSet) EnsureHostsInPool(service *v1.Service, nodes []*v1.Node, bac
 			continue
 		}
 
-		if managedByAS {
+		managedByFlex := false
+		if !managedByAS {
+			// Check whether the node is a VMSS Flex instance, which also
+			// joins the pool through its VM network interfaces.
+			managedByFlex, err = ss.isNodeManagedByFlexScaleSet(localNodeName, azcache.CacheReadTypeDefault)
+			if err != nil {
+				klog.Errorf("Failed to check isNodeManagedByFlexScaleSet(%s): %v", localNodeName, err)
+				errors = append(errors, err)
+				continue
+			}
+		}
+
+		if managedByAS || managedByFlex {
 			// VMAS nodes should also be added to the SLB backends.
 			if ss.useStandardLoadBalancer() {
 				hostUpdates = append(hostUpdates, func() error {
-					_, _, _, _, err := ss.availabilitySet.EnsureHostInPool(service, types.NodeName(localNodeName), backendPoolID, vmSetName, isInternal)
+					// ss.availabilitySet is a VMSet interface, so the typed
+					// result is only available for the real availabilitySet.
+					result := hostJoined
+					var err error
+					if as, ok := ss.availabilitySet.(*availabilitySet); ok {
+						_, _, _, _, result, err = as.ensureHostInPool(service, types.NodeName(localNodeName), backendPoolID, vmSetName, isInternal)
+					} else {
+						_, _, _, _, err = ss.availabilitySet.EnsureHostInPool(service, types.NodeName(localNodeName), backendPoolID, vmSetName, isInternal)
+					}
+					if err == nil {
+						recordHostInPoolOutcome(ss.Cloud, localNode, result)
+						resultsLock.Lock()
+						results[result]++
+						resultsLock.Unlock()
+					}
 					return err
 				})
 				continue
 			}
 
-			klog.V(3).Infof("EnsureHostsInPool skips node %s because VMAS nodes couldn't be added to basic LB with VMSS backends", localNodeName)
+			klog.V(3).Infof("EnsureHostsInPool skips node %s because VMAS and VMSS Flex nodes couldn't be added to basic LB with VMSS backends", localNodeName)
 			continue
 		}
 
-		nodeResourceGroup, nodeVMSS, nodeInstanceID, nodeVMSSVM, err := ss.EnsureHostInPool(service, types.NodeName(localNodeName), backendPoolID, vmSetName, isInternal)
+		nodeResourceGroup, nodeVMSS, nodeInstanceID, nodeVMSSVM, result, err := ss.ensureHostInPool(service, types.NodeName(localNodeName), backendPoolID, vmSetName, isInternal)
 		if err != nil {
 			klog.Errorf("EnsureHostInPool(%s): backendPoolID(%s) - failed to ensure host in pool: %q", getServiceName(service), backendPoolID, err)
 			errors = append(errors, err)
 			continue
 		}
+		recordHostInPoolOutcome(ss.Cloud, localNode, result)
+		resultsLock.Lock()
+		results[result]++
+		resultsLock.Unlock()
 
 		// No need to update if nodeVMSSVM is nil.
 		if nodeVMSSVM == nil {
@@ -1272,12 +1377,30 @@ func (ss *scaleSet) EnsureHostsInPool(service *v1.Service, nodes []*v1.Node, bac
 		defer ss.deleteCacheForNode(localNodeName)
 	}
 
+	// The batched instance update applies the latest scale set model to the
+	// instances, so the backend pool has to be added to the scale set model
+	// before they are upgraded.
+	if ss.EnableVmssBatchInstanceUpdate && len(nodeUpdates) > 0 {
+		if err := ss.ensureVMSSInPool(service, nodes, backendPoolID, vmSetName); err != nil {
+			return err
+		}
+	}
+
 	// Update VMs with best effort that have already been added to nodeUpdates.
 	for meta, update := range nodeUpdates {
 		// create new instance of meta and update for passing to anonymous function
 		meta := meta
 		update := update
 		hostUpdates = append(hostUpdates, func() error {
+			if ss.EnableVmssBatchInstanceUpdate {
+				instanceIDs := make([]string, 0, len(update))
+				for instanceID := range update {
+					instanceIDs = append(instanceIDs, instanceID)
+				}
+				sort.Strings(instanceIDs)
+				return ss.batchUpdateVMSSInstances(meta, instanceIDs, backendPoolID)
+			}
+
 			ctx, cancel := getContextWithCancel()
 			defer cancel()
 			klog.V(2).Infof("EnsureHostInPool begins to UpdateVMs for VMSS(%s, %s) with new backendPoolID %s", meta.resourceGroup, meta.vmssName, backendPoolID)
@@ -1302,9 +1425,38 @@ func (ss *scaleSet) EnsureHostsInPool(service *v1.Service, nodes []*v1.Node, bac
 
 	// Ensure the backendPoolID is also added on VMSS itself.
 	// Refer to issue kubernetes/kubernetes#80365 for detailed information
-	err := ss.ensureVMSSInPool(service, nodes, backendPoolID, vmSetName)
-	if err != nil {
-		return err
+	if !ss.EnableVmssBatchInstanceUpdate || len(nodeUpdates) == 0 {
+		if err := ss.ensureVMSSInPool(service, nodes, backendPoolID, vmSetName); err != nil {
+			return err
+		}
+	}
+
+	reportHostsInPoolResults(ss.Cloud, service, backendPoolID, results)
+	return nil
+}
+
+// batchUpdateVMSSInstances upgrades the given instances to the latest scale
+// set model in batches, so that joining a large number of nodes to a backend
+// pool takes a handful of ARM calls per scale set instead of one call per
+// instance.
+func (ss *scaleSet) batchUpdateVMSSInstances(meta vmssMetaInfo, instanceIDs []string, backendPoolID string) error {
+	for start := 0; start < len(instanceIDs); start += vmssInstanceUpdateBatchSize {
+		end := start + vmssInstanceUpdateBatchSize
+		if end > len(instanceIDs) {
+			end = len(instanceIDs)
+		}
+		batch := instanceIDs[start:end]
+
+		klog.V(2).Infof("batchUpdateVMSSInstances begins to update instances %v of VMSS(%s, %s) with new backendPoolID %s", batch, meta.resourceGroup, meta.vmssName, backendPoolID)
+		ctx, cancel := getContextWithCancel()
+		rerr := ss.VirtualMachineScaleSetsClient.UpdateInstances(ctx, meta.resourceGroup, meta.vmssName, compute.VirtualMachineScaleSetVMInstanceRequiredIDs{
+			InstanceIds: &batch,
+		})
+		cancel()
+		if rerr != nil {
+			klog.Errorf("batchUpdateVMSSInstances UpdateInstances for VMSS(%s, %s) failed with error %v", meta.resourceGroup, meta.vmssName, rerr.Error())
+			return rerr.Error()
+		}
 	}
 
 	return nil
@@ -1344,7 +1496,7 @@ func (ss *scaleSet) ensureBackendPoolDeletedFromNode(service *v1.Service, nodeNa
 	foundPool := false
 	for i := len(existingBackendPools) - 1; i >= 0; i-- {
 		curPool := existingBackendPools[i]
-		if strings.EqualFold(backendPoolID, *curPool.ID) {
+		if equalResourceIDs(backendPoolID, *curPool.ID) {
 			klog.V(10).Infof("ensureBackendPoolDeletedFromNode gets unwanted backend pool %q for node %s", backendPoolID, nodeName)
 			foundPool = true
 			newBackendPools = append(existingBackendPools[:i], existingBackendPools[i+1:]...)
@@ -1477,7 +1629,7 @@ func (ss *scaleSet) ensureBackendPoolDeletedFromVMSS(service *v1.Service, backen
 		var newBackendPools []compute.SubResource
 		for i := len(loadBalancerBackendAddressPools) - 1; i >= 0; i-- {
 			curPool := loadBalancerBackendAddressPools[i]
-			if strings.EqualFold(backendPoolID, *curPool.ID) {
+			if equalResourceIDs(backendPoolID, *curPool.ID) {
 				klog.V(10).Infof("ensureBackendPoolDeletedFromVMSS gets unwanted backend pool %q for VMSS %s", backendPoolID, vmssName)
 				found = true
 				newBackendPools = append(loadBalancerBackendAddressPools[:i], loadBalancerBackendAddressPools[i+1:]...)
@@ -1533,7 +1685,7 @@ func (ss *scaleSet) EnsureBackendPoolDeleted(service *v1.Service, backendPoolID,
 
 	ipConfigurationIDs := []string{}
 	for _, backendPool := range *backendAddressPools {
-		if strings.EqualFold(*backendPool.ID, backendPoolID) && backendPool.BackendIPConfigurations != nil {
+		if equalResourceIDs(*backendPool.ID, backendPoolID) && backendPool.BackendIPConfigurations != nil {
 			for _, ipConf := range *backendPool.BackendIPConfigurations {
 				if ipConf.ID == nil {
 					continue
@@ -38,6 +38,7 @@ var (
 
 	vmssKey                 = "k8svmssKey"
 	availabilitySetNodesKey = "k8sAvailabilitySetNodesKey"
+	flexScaleSetNodesKey    = "k8sFlexScaleSetNodesKey"
 
 	availabilitySetNodesCacheTTLDefaultInSeconds = 900
 	vmssCacheTTLDefaultInSeconds                 = 600
@@ -94,7 +95,7 @@ func (ss *scaleSet) newVMSSCache() (*azcache.TimedCache, error) {
 	if ss.Config.VmssCacheTTLInSeconds == 0 {
 		ss.Config.VmssCacheTTLInSeconds = vmssCacheTTLDefaultInSeconds
 	}
-	return azcache.NewTimedcache(time.Duration(ss.Config.VmssCacheTTLInSeconds)*time.Second, getter)
+	return azcache.NewNamedTimedCache("vmss", time.Duration(ss.Config.VmssCacheTTLInSeconds)*time.Second, getter)
 }
 
 func extractVmssVMName(name string) (string, string, error) {
@@ -245,7 +246,7 @@ func (ss *scaleSet) newVMSSVirtualMachinesCache(resourceGroupName, vmssName, cac
 		return localCache, nil
 	}
 
-	return azcache.NewTimedcache(vmssVirtualMachinesCacheTTL, getter)
+	return azcache.NewNamedTimedCache("vmssVirtualMachines", vmssVirtualMachinesCacheTTL, getter)
 }
 
 func (ss *scaleSet) deleteCacheForNode(nodeName string) error {
@@ -303,7 +304,75 @@ func (ss *scaleSet) newAvailabilitySetNodesCache() (*azcache.TimedCache, error)
 	if ss.Config.AvailabilitySetNodesCacheTTLInSeconds == 0 {
 		ss.Config.AvailabilitySetNodesCacheTTLInSeconds = availabilitySetNodesCacheTTLDefaultInSeconds
 	}
-	return azcache.NewTimedcache(time.Duration(ss.Config.AvailabilitySetNodesCacheTTLInSeconds)*time.Second, getter)
+	return azcache.NewNamedTimedCache("availabilitySetNodes", time.Duration(ss.Config.AvailabilitySetNodesCacheTTLInSeconds)*time.Second, getter)
+}
+
+// newFlexScaleSetNodesCache builds a cache mapping the names of virtual
+// machines that belong to a VMSS in Flexible orchestration mode to the name
+// of their scale set. Flex instances are returned by the VM list API like
+// standalone VMs, distinguishable only by their virtualMachineScaleSet
+// reference.
+func (ss *scaleSet) newFlexScaleSetNodesCache() (*azcache.TimedCache, error) {
+	getter := func(key string) (interface{}, error) {
+		localCache := map[string]string{}
+		resourceGroups, err := ss.GetResourceGroups()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, resourceGroup := range resourceGroups.List() {
+			vmList, err := ss.Cloud.ListVirtualMachines(resourceGroup)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, vm := range vmList {
+				if vm.Name == nil || vm.VirtualMachineProperties == nil || vm.VirtualMachineScaleSet == nil {
+					continue
+				}
+				vmssName, err := getLastSegment(to.String(vm.VirtualMachineScaleSet.ID), "/")
+				if err != nil {
+					klog.Errorf("newFlexScaleSetNodesCache: failed to parse the scale set ID %q of vm %q: %v", to.String(vm.VirtualMachineScaleSet.ID), *vm.Name, err)
+					continue
+				}
+				localCache[*vm.Name] = vmssName
+			}
+		}
+
+		return localCache, nil
+	}
+
+	if ss.Config.AvailabilitySetNodesCacheTTLInSeconds == 0 {
+		ss.Config.AvailabilitySetNodesCacheTTLInSeconds = availabilitySetNodesCacheTTLDefaultInSeconds
+	}
+	return azcache.NewNamedTimedCache("flexScaleSetNodes", time.Duration(ss.Config.AvailabilitySetNodesCacheTTLInSeconds)*time.Second, getter)
+}
+
+// getFlexScaleSetNameByNodeName returns the name of the Flexible orchestration
+// mode scale set the node belongs to, or an empty string for nodes that are
+// not Flex instances.
+func (ss *scaleSet) getFlexScaleSetNameByNodeName(nodeName string, crt azcache.AzureCacheReadType) (string, error) {
+	cached, err := ss.flexScaleSetNodesCache.Get(flexScaleSetNodesKey, crt)
+	if err != nil {
+		return "", err
+	}
+
+	flexScaleSetNodes := cached.(map[string]string)
+	return flexScaleSetNodes[nodeName], nil
+}
+
+// isNodeManagedByFlexScaleSet checks whether the node belongs to a VMSS in
+// Flexible orchestration mode. Such instances are modeled as standalone
+// virtual machines, so they are managed through the VM APIs even though they
+// are scale set members. Unlike isNodeManagedByAvailabilitySet this does not
+// honor DisableAvailabilitySetNodes: the flag asserts the absence of
+// availability set nodes, not of Flex instances.
+func (ss *scaleSet) isNodeManagedByFlexScaleSet(nodeName string, crt azcache.AzureCacheReadType) (bool, error) {
+	vmssName, err := ss.getFlexScaleSetNameByNodeName(nodeName, crt)
+	if err != nil {
+		return false, err
+	}
+	return vmssName != "", nil
 }
 
 func (ss *scaleSet) isNodeManagedByAvailabilitySet(nodeName string, crt azcache.AzureCacheReadType) (bool, error) {
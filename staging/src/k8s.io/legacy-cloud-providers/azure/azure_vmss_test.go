@@ -417,6 +417,75 @@ func TestGetInstanceIDByNodeName(t *testing.T) {
 	}
 }
 
+func buildTestFlexVirtualMachine(name, vmssName string) compute.VirtualMachine {
+	return compute.VirtualMachine{
+		Name: to.StringPtr(name),
+		ID:   to.StringPtr("/subscriptions/script/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/" + name),
+		VirtualMachineProperties: &compute.VirtualMachineProperties{
+			VirtualMachineScaleSet: &compute.SubResource{
+				ID: to.StringPtr("/subscriptions/script/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/" + vmssName),
+			},
+		},
+	}
+}
+
+func TestIsNodeManagedByFlexScaleSet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ss, err := newTestScaleSet(ctrl)
+	assert.NoError(t, err)
+
+	standaloneVM := compute.VirtualMachine{
+		Name:                     to.StringPtr("standalone-vm"),
+		ID:                       to.StringPtr("/subscriptions/script/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/standalone-vm"),
+		VirtualMachineProperties: &compute.VirtualMachineProperties{},
+	}
+	flexVM := buildTestFlexVirtualMachine("flexvm000000", "vmssflex")
+
+	mockVMsClient := ss.cloud.VirtualMachinesClient.(*mockvmclient.MockInterface)
+	mockVMsClient.EXPECT().List(gomock.Any(), gomock.Any()).Return([]compute.VirtualMachine{standaloneVM, flexVM}, nil).AnyTimes()
+
+	vmssName, err := ss.getFlexScaleSetNameByNodeName("flexvm000000", azcache.CacheReadTypeDefault)
+	assert.NoError(t, err)
+	assert.Equal(t, "vmssflex", vmssName)
+
+	managedByFlex, err := ss.isNodeManagedByFlexScaleSet("flexvm000000", azcache.CacheReadTypeDefault)
+	assert.NoError(t, err)
+	assert.True(t, managedByFlex)
+
+	managedByFlex, err = ss.isNodeManagedByFlexScaleSet("standalone-vm", azcache.CacheReadTypeDefault)
+	assert.NoError(t, err)
+	assert.False(t, managedByFlex)
+}
+
+func TestGetInstanceIDByNodeNameFlexNode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ss, err := newTestScaleSet(ctrl)
+	assert.NoError(t, err)
+	// Flex detection must work even when the availability set nodes cache
+	// is disabled.
+	ss.DisableAvailabilitySetNodes = true
+
+	flexVM := buildTestFlexVirtualMachine("flexvm000000", "vmssflex")
+
+	mockVMSSClient := mockvmssclient.NewMockInterface(ctrl)
+	ss.cloud.VirtualMachineScaleSetsClient = mockVMSSClient
+	mockVMSSClient.EXPECT().List(gomock.Any(), gomock.Any()).Return([]compute.VirtualMachineScaleSet{}, nil).AnyTimes()
+
+	mockVMsClient := ss.cloud.VirtualMachinesClient.(*mockvmclient.MockInterface)
+	mockVMsClient.EXPECT().List(gomock.Any(), gomock.Any()).Return([]compute.VirtualMachine{flexVM}, nil).AnyTimes()
+	mockVMsClient.EXPECT().Get(gomock.Any(), "rg", "flexvm000000", gomock.Any()).Return(flexVM, nil).AnyTimes()
+
+	// The instance ID of a Flex instance is resolved through the VM API, not
+	// the VMSS instance API.
+	instanceID, err := ss.GetInstanceIDByNodeName("flexvm000000")
+	assert.NoError(t, err)
+	assert.Equal(t, "/subscriptions/script/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/flexvm000000", instanceID)
+}
+
 func TestGetZoneByNodeName(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -782,6 +851,7 @@ func TestGetPowerStatusByNodeName(t *testing.T) {
 		description        string
 		vmList             []string
 		nilStatus          bool
+		powerStateFallback string
 		expectedPowerState string
 		expectedErr        error
 	}{
@@ -796,6 +866,13 @@ func TestGetPowerStatusByNodeName(t *testing.T) {
 			nilStatus:          true,
 			expectedPowerState: vmPowerStateStopped,
 		},
+		{
+			description:        "GetPowerStatusByNodeName should return an error when the vm.InstanceView.Statuses is nil and VMPowerStateFallback is unknown",
+			vmList:             []string{"vmss-vm-000001"},
+			nilStatus:          true,
+			powerStateFallback: vmPowerStateUnknown,
+			expectedErr:        fmt.Errorf("power state of node \"vmss-vm-000001\" is unknown: InstanceView is nil and provisioning state is \"\""),
+		},
 	}
 
 	for _, test := range testCases {
@@ -816,6 +893,7 @@ func TestGetPowerStatusByNodeName(t *testing.T) {
 		mockVMsClient := ss.cloud.VirtualMachinesClient.(*mockvmclient.MockInterface)
 		mockVMsClient.EXPECT().List(gomock.Any(), gomock.Any()).Return([]compute.VirtualMachine{}, nil).AnyTimes()
 
+		ss.Config.VMPowerStateFallback = test.powerStateFallback
 		powerState, err := ss.GetPowerStatusByNodeName("vmss-vm-000001")
 		assert.Equal(t, test.expectedErr, err, test.description+", but an error occurs")
 		assert.Equal(t, test.expectedPowerState, powerState, test.description)
@@ -1840,6 +1918,9 @@ func TestEnsureHostInPool(t *testing.T) {
 		mockVMSSVMClient := ss.cloud.VirtualMachineScaleSetVMsClient.(*mockvmssvmclient.MockInterface)
 		mockVMSSVMClient.EXPECT().List(gomock.Any(), ss.ResourceGroup, testVMSSName, gomock.Any()).Return(expectedVMSSVMs, nil).AnyTimes()
 
+		mockVMsClient := ss.cloud.VirtualMachinesClient.(*mockvmclient.MockInterface)
+		mockVMsClient.EXPECT().List(gomock.Any(), gomock.Any()).Return([]compute.VirtualMachine{}, nil).AnyTimes()
+
 		nodeResourceGroup, ssName, instanceID, vm, err := ss.EnsureHostInPool(test.service, test.nodeName, test.backendPoolID, test.vmSetName, false)
 		assert.Equal(t, test.expectedErr, err, test.description+", but an error occurs")
 		assert.Equal(t, test.expectedNodeResourceGroup, nodeResourceGroup, test.description)
@@ -2113,6 +2194,56 @@ func TestEnsureHostsInPool(t *testing.T) {
 	}
 }
 
+func TestEnsureHostsInPoolBatchInstanceUpdate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ss, err := newTestScaleSet(ctrl)
+	assert.NoError(t, err)
+
+	ss.LoadBalancerSku = loadBalancerSkuStandard
+	ss.EnableVmssBatchInstanceUpdate = true
+
+	nodes := []*v1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "vmss-vm-000000",
+			},
+			Spec: v1.NodeSpec{
+				ProviderID: "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/vmss/virtualMachines/0",
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "vmss-vm-000001",
+			},
+			Spec: v1.NodeSpec{
+				ProviderID: "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/vmss/virtualMachines/1",
+			},
+		},
+	}
+
+	expectedVMSS := buildTestVMSSWithLB(testVMSSName, "vmss-vm-", []string{testLBBackendpoolID0}, false)
+	mockVMSSClient := ss.cloud.VirtualMachineScaleSetsClient.(*mockvmssclient.MockInterface)
+	mockVMSSClient.EXPECT().List(gomock.Any(), ss.ResourceGroup).Return([]compute.VirtualMachineScaleSet{expectedVMSS}, nil).AnyTimes()
+	mockVMSSClient.EXPECT().Get(gomock.Any(), ss.ResourceGroup, testVMSSName).Return(expectedVMSS, nil).MaxTimes(1)
+	mockVMSSClient.EXPECT().CreateOrUpdate(gomock.Any(), ss.ResourceGroup, testVMSSName, gomock.Any()).Return(nil).Times(1)
+	mockVMSSClient.EXPECT().UpdateInstances(gomock.Any(), ss.ResourceGroup, testVMSSName, compute.VirtualMachineScaleSetVMInstanceRequiredIDs{
+		InstanceIds: &[]string{"0", "1"},
+	}).Return(nil).Times(1)
+
+	expectedVMSSVMs, _, _ := buildTestVirtualMachineEnv(ss.cloud, testVMSSName, "", 0, []string{"vmss-vm-000000", "vmss-vm-000001"}, "", false)
+	mockVMSSVMClient := ss.cloud.VirtualMachineScaleSetVMsClient.(*mockvmssvmclient.MockInterface)
+	mockVMSSVMClient.EXPECT().List(gomock.Any(), ss.ResourceGroup, testVMSSName, gomock.Any()).Return(expectedVMSSVMs, nil).AnyTimes()
+
+	mockVMClient := ss.cloud.VirtualMachinesClient.(*mockvmclient.MockInterface)
+	mockVMClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+
+	// The per-VM UpdateVMs path must not be used when batching is enabled.
+	err = ss.EnsureHostsInPool(&v1.Service{}, nodes, testLBBackendpoolID1, testVMSSName, false)
+	assert.NoError(t, err)
+}
+
 func TestEnsureBackendPoolDeletedFromNode(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
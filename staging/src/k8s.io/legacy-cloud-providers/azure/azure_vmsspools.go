@@ -0,0 +1,108 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// perVMSSBackendPoolsEnabled returns true when every scale set gets a
+// dedicated backend pool next to the cluster backend pool. The feature is
+// restricted to vmType vmss with the standard load balancer SKU at config
+// load time.
+func (az *Cloud) perVMSSBackendPoolsEnabled() bool {
+	return az.EnablePerVMSSBackendPools
+}
+
+// getPerVMSSBackendPoolName returns the name of the dedicated backend pool of
+// the scale set, derived from the cluster backend pool name.
+func getPerVMSSBackendPoolName(lbBackendPoolName, vmssName string) string {
+	return fmt.Sprintf("%s-%s", lbBackendPoolName, vmssName)
+}
+
+// getPerVMSSBackendPoolID returns the resource ID of the dedicated backend
+// pool of the scale set, derived from the cluster backend pool ID.
+func getPerVMSSBackendPoolID(lbBackendPoolID, vmssName string) string {
+	return fmt.Sprintf("%s-%s", lbBackendPoolID, vmssName)
+}
+
+// vmssNamesFromNodes returns the sorted names of the scale sets in the
+// cluster resource group that the nodes belong to. Nodes not backed by a
+// scale set (e.g. VMAS masters) are skipped.
+func (az *Cloud) vmssNamesFromNodes(nodes []*v1.Node) []string {
+	var vmssNames []string
+	for _, node := range nodes {
+		resourceGroupName, vmssName, err := getVmssAndResourceGroupNameByVMProviderID(node.Spec.ProviderID)
+		if err != nil {
+			klog.V(4).Infof("vmssNamesFromNodes: node %s is not a VMSS instance, skipping", node.Name)
+			continue
+		}
+		if !strings.EqualFold(resourceGroupName, az.ResourceGroup) {
+			continue
+		}
+		if !stringInSliceFold(vmssName, vmssNames) {
+			vmssNames = append(vmssNames, vmssName)
+		}
+	}
+	sort.Strings(vmssNames)
+	return vmssNames
+}
+
+// reconcilePerVMSSBackendPools ensures the load balancer carries one
+// dedicated backend pool per scale set of the nodes. Pools of scale sets that
+// are gone are left in place: the pool name alone cannot distinguish them
+// from operator-managed pools, and an empty pool is harmless. It returns the
+// updated pool collection and whether it was changed.
+func (az *Cloud) reconcilePerVMSSBackendPools(service *v1.Service, nodes []*v1.Node, backendPools []network.BackendAddressPool, lbBackendPoolName string) ([]network.BackendAddressPool, bool) {
+	serviceName := getServiceName(service)
+	dirty := false
+
+	expectedPoolNames := []string{}
+	for _, vmssName := range az.vmssNamesFromNodes(nodes) {
+		expectedPoolNames = append(expectedPoolNames, getPerVMSSBackendPoolName(lbBackendPoolName, vmssName))
+	}
+
+	for _, poolName := range expectedPoolNames {
+		found := false
+		for _, pool := range backendPools {
+			if strings.EqualFold(to.String(pool.Name), poolName) {
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		klog.V(2).Infof("reconcilePerVMSSBackendPools for service (%s): adding backend pool %s", serviceName, poolName)
+		backendPools = append(backendPools, network.BackendAddressPool{
+			Name: to.StringPtr(poolName),
+		})
+		dirty = true
+	}
+
+	return backendPools, dirty
+}
@@ -0,0 +1,99 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func vmssTestNode(name, resourceGroup, vmssName string) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: v1.NodeSpec{
+			ProviderID: fmt.Sprintf("azure:///subscriptions/subscription/resourceGroups/%s/providers/Microsoft.Compute/virtualMachineScaleSets/%s/virtualMachines/0", resourceGroup, vmssName),
+		},
+	}
+}
+
+func TestVMSSNamesFromNodes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	nodes := []*v1.Node{
+		vmssTestNode("node-b-0", "rg", "vmss-b"),
+		vmssTestNode("node-a-0", "rg", "vmss-a"),
+		vmssTestNode("node-a-1", "rg", "vmss-a"),
+		// Scale sets of other resource groups and VMAS nodes are skipped.
+		vmssTestNode("node-other", "other-rg", "vmss-other"),
+		{ObjectMeta: metav1.ObjectMeta{Name: "vmas-node"}},
+	}
+
+	assert.Equal(t, []string{"vmss-a", "vmss-b"}, az.vmssNamesFromNodes(nodes))
+}
+
+func TestReconcilePerVMSSBackendPools(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	nodes := []*v1.Node{
+		vmssTestNode("node-a-0", "rg", "vmss-a"),
+		vmssTestNode("node-b-0", "rg", "vmss-b"),
+	}
+	backendPools := []network.BackendAddressPool{
+		{Name: to.StringPtr(testClusterName)},
+	}
+
+	backendPools, dirty := az.reconcilePerVMSSBackendPools(&svc, nodes, backendPools, testClusterName)
+	assert.True(t, dirty)
+	assert.Len(t, backendPools, 3)
+	assert.Equal(t, "testCluster-vmss-a", to.String(backendPools[1].Name))
+	assert.Equal(t, "testCluster-vmss-b", to.String(backendPools[2].Name))
+
+	// A second reconciliation of the same pools is a no-op.
+	backendPools, dirty = az.reconcilePerVMSSBackendPools(&svc, nodes, backendPools, testClusterName)
+	assert.False(t, dirty)
+	assert.Len(t, backendPools, 3)
+}
+
+func TestPerVMSSBackendPoolsConfigValidation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	config := Config{
+		UseInstanceMetadata:       true,
+		LoadBalancerSku:           loadBalancerSkuStandard,
+		EnablePerVMSSBackendPools: true,
+	}
+	err := az.InitializeCloudFromConfig(&config, false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "vmType vmss")
+}
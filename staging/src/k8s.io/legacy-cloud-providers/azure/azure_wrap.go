@@ -29,6 +29,7 @@ import (
 	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
 	"github.com/Azure/go-autorest/autorest/to"
 
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
@@ -61,23 +62,81 @@ func checkResourceExistsFromError(err *retry.Error) (bool, *retry.Error) {
 	return false, err
 }
 
-/// getVirtualMachine calls 'VirtualMachinesClient.Get' with a timed cache
-/// The service side has throttling control that delays responses if there're multiple requests onto certain vm
-/// resource request in short period.
+// / getVirtualMachine calls 'VirtualMachinesClient.Get' with a timed cache
+// / The service side has throttling control that delays responses if there're multiple requests onto certain vm
+// / resource request in short period.
 func (az *Cloud) getVirtualMachine(nodeName types.NodeName, crt azcache.AzureCacheReadType) (vm compute.VirtualMachine, err error) {
-	vmName := string(nodeName)
+	vmName := az.getVMNameByNodeName(nodeName)
 	cachedVM, err := az.vmCache.Get(vmName, crt)
 	if err != nil {
 		return vm, err
 	}
 
 	if cachedVM == nil {
-		return vm, cloudprovider.InstanceNotFound
+		// The node name didn't resolve to a VM; try the fallbacks before
+		// reporting InstanceNotFound, which would trigger node deletion.
+		return az.getVirtualMachineByFallback(nodeName, vmName, crt)
 	}
 
 	return *(cachedVM.(*compute.VirtualMachine)), nil
 }
 
+// kubernetesNodeNameTag is the VM tag carrying the Kubernetes node name for
+// VMs whose names diverge from their node names.
+const kubernetesNodeNameTag = "kubernetes-node-name"
+
+// getVirtualMachineByFallback resolves nodes whose names don't match any VM
+// name, e.g. when the hostname was customized. The resolution order is the VM
+// name recorded from the node's providerID, then an ARM search for a VM
+// tagged with the node name. Resolved names are remembered so subsequent
+// lookups go through the cache directly.
+func (az *Cloud) getVirtualMachineByFallback(nodeName types.NodeName, triedVMName string, crt azcache.AzureCacheReadType) (compute.VirtualMachine, error) {
+	var vm compute.VirtualMachine
+
+	// The VM name recorded from the node's providerID is authoritative even
+	// when the node name resolution method is left at hostname.
+	az.nodeCachesLock.RLock()
+	recordedVMName, ok := az.nodeVMNames[string(nodeName)]
+	az.nodeCachesLock.RUnlock()
+	if ok && !strings.EqualFold(recordedVMName, triedVMName) {
+		cachedVM, err := az.vmCache.Get(recordedVMName, crt)
+		if err != nil {
+			return vm, err
+		}
+		if cachedVM != nil {
+			klog.V(2).Infof("getVirtualMachine(%s): resolved VM %q from the node's providerID", nodeName, recordedVMName)
+			return *(cachedVM.(*compute.VirtualMachine)), nil
+		}
+	}
+
+	// Last resort: search ARM for a VM tagged with the node name. This is
+	// only done with the providerid resolution method, where the operator has
+	// opted into diverging VM and node names; nodename installations keep the
+	// cheap single lookup.
+	if !strings.EqualFold(az.NodeNameResolutionMethod, nodeNameResolutionMethodProviderID) {
+		return vm, cloudprovider.InstanceNotFound
+	}
+	vms, err := az.ListVirtualMachines(az.ResourceGroup)
+	if err != nil {
+		return vm, err
+	}
+	for _, candidate := range vms {
+		tag, ok := candidate.Tags[kubernetesNodeNameTag]
+		if !ok || !strings.EqualFold(to.String(tag), string(nodeName)) {
+			continue
+		}
+
+		vmName := to.String(candidate.Name)
+		klog.V(2).Infof("getVirtualMachine(%s): resolved VM %q by tag %s", nodeName, vmName, kubernetesNodeNameTag)
+		az.nodeCachesLock.Lock()
+		az.nodeVMNames[string(nodeName)] = vmName
+		az.nodeCachesLock.Unlock()
+		return candidate, nil
+	}
+
+	return vm, cloudprovider.InstanceNotFound
+}
+
 func (az *Cloud) getRouteTable(crt azcache.AzureCacheReadType) (routeTable network.RouteTable, exists bool, err error) {
 	cachedRt, err := az.rtCache.Get(az.RouteTableName, crt)
 	if err != nil {
@@ -207,7 +266,7 @@ func (az *Cloud) newVMCache() (*azcache.TimedCache, error) {
 	if az.VMCacheTTLInSeconds == 0 {
 		az.VMCacheTTLInSeconds = vmCacheTTLDefaultInSeconds
 	}
-	return azcache.NewTimedcache(time.Duration(az.VMCacheTTLInSeconds)*time.Second, getter)
+	return azcache.NewNamedTimedCache("vm", time.Duration(az.VMCacheTTLInSeconds)*time.Second, getter)
 }
 
 func (az *Cloud) newLBCache() (*azcache.TimedCache, error) {
@@ -232,7 +291,34 @@ func (az *Cloud) newLBCache() (*azcache.TimedCache, error) {
 	if az.LoadBalancerCacheTTLInSeconds == 0 {
 		az.LoadBalancerCacheTTLInSeconds = loadBalancerCacheTTLDefaultInSeconds
 	}
-	return azcache.NewTimedcache(time.Duration(az.LoadBalancerCacheTTLInSeconds)*time.Second, getter)
+	return azcache.NewNamedTimedCache("lb", time.Duration(az.LoadBalancerCacheTTLInSeconds)*time.Second, getter)
+}
+
+// newLBListCache builds a timed cache over the load balancer listings of the
+// resource groups that may hold load balancers, keyed by resource group name.
+// The client follows the server-side result pages internally.
+func (az *Cloud) newLBListCache() (*azcache.TimedCache, error) {
+	getter := func(key string) (interface{}, error) {
+		ctx, cancel := getContextWithCancel()
+		defer cancel()
+
+		allLBs, rerr := az.LoadBalancerClient.List(ctx, key)
+		if rerr != nil {
+			if rerr.IsNotFound() {
+				klog.V(2).Infof("Resource group %q not found while listing load balancers", key)
+				return []network.LoadBalancer{}, nil
+			}
+			return nil, rerr.Error()
+		}
+
+		klog.V(2).Infof("LoadBalancerClient.List(%v) success with %d load balancers", key, len(allLBs))
+		return allLBs, nil
+	}
+
+	if az.LoadBalancerCacheTTLInSeconds == 0 {
+		az.LoadBalancerCacheTTLInSeconds = loadBalancerCacheTTLDefaultInSeconds
+	}
+	return azcache.NewNamedTimedCache("lbList", time.Duration(az.LoadBalancerCacheTTLInSeconds)*time.Second, getter)
 }
 
 func (az *Cloud) newNSGCache() (*azcache.TimedCache, error) {
@@ -256,7 +342,7 @@ func (az *Cloud) newNSGCache() (*azcache.TimedCache, error) {
 	if az.NsgCacheTTLInSeconds == 0 {
 		az.NsgCacheTTLInSeconds = nsgCacheTTLDefaultInSeconds
 	}
-	return azcache.NewTimedcache(time.Duration(az.NsgCacheTTLInSeconds)*time.Second, getter)
+	return azcache.NewNamedTimedCache("nsg", time.Duration(az.NsgCacheTTLInSeconds)*time.Second, getter)
 }
 
 func (az *Cloud) newRouteTableCache() (*azcache.TimedCache, error) {
@@ -280,7 +366,7 @@ func (az *Cloud) newRouteTableCache() (*azcache.TimedCache, error) {
 	if az.RouteTableCacheTTLInSeconds == 0 {
 		az.RouteTableCacheTTLInSeconds = routeTableCacheTTLDefaultInSeconds
 	}
-	return azcache.NewTimedcache(time.Duration(az.RouteTableCacheTTLInSeconds)*time.Second, getter)
+	return azcache.NewNamedTimedCache("routeTable", time.Duration(az.RouteTableCacheTTLInSeconds)*time.Second, getter)
 }
 
 func (az *Cloud) useStandardLoadBalancer() bool {
@@ -291,14 +377,61 @@ func (az *Cloud) excludeMasterNodesFromStandardLB() bool {
 	return az.ExcludeMasterFromStandardLB != nil && *az.ExcludeMasterFromStandardLB
 }
 
+// excludeMasterNodesFromLB decides whether master nodes should stay out of the
+// backend pool the service is being reconciled onto, honoring the per-pool
+// kind knobs. The external pool of the standard load balancer doubles as the
+// outbound pool, so masters are kept in it when either the external or the
+// outbound knob admits them.
+func (az *Cloud) excludeMasterNodesFromLB(service *v1.Service) bool {
+	if requiresInternalLoadBalancer(service) {
+		return az.excludeMasterKnob(az.ExcludeMasterFromInternalLB)
+	}
+	return az.excludeMasterKnob(az.ExcludeMasterFromExternalLB) && az.excludeMasterKnob(az.ExcludeMasterFromOutboundPool)
+}
+
+// excludeMasterKnob resolves one of the per-pool kind exclusion knobs, falling
+// back to the cluster-wide ExcludeMasterFromStandardLB when the knob is unset.
+func (az *Cloud) excludeMasterKnob(knob *bool) bool {
+	if knob != nil {
+		return *knob
+	}
+	return az.excludeMasterNodesFromStandardLB()
+}
+
 func (az *Cloud) disableLoadBalancerOutboundSNAT() bool {
-	if !az.useStandardLoadBalancer() || az.DisableOutboundSNAT == nil {
+	if !az.useStandardLoadBalancer() {
+		return false
+	}
+	// With user defined routing egress bypasses the load balancer entirely,
+	// so its rules must never program SNAT.
+	if az.udrOutboundEnabled() {
+		return true
+	}
+	if az.DisableOutboundSNAT == nil {
 		return false
 	}
 
 	return *az.DisableOutboundSNAT
 }
 
+// serviceDisableLoadBalancerOutboundSNAT returns whether outbound SNAT should
+// be disabled on the load balancing rules of the service. The service
+// annotation overrides the cluster wide disableOutboundSNAT setting and is
+// only effective with the standard load balancer SKU. With user defined
+// routing the annotation cannot re-enable SNAT.
+func (az *Cloud) serviceDisableLoadBalancerOutboundSNAT(service *v1.Service) bool {
+	if az.useStandardLoadBalancer() {
+		if az.udrOutboundEnabled() {
+			return true
+		}
+		if v, ok := service.Annotations[ServiceAnnotationDisableLoadBalancerOutboundSNAT]; ok {
+			return strings.EqualFold(v, "true")
+		}
+	}
+
+	return az.disableLoadBalancerOutboundSNAT()
+}
+
 // IsNodeUnmanaged returns true if the node is not managed by Azure cloud provider.
 // Those nodes includes on-prem or VMs from other clouds. They will not be added to load balancer
 // backends. Azure routes and managed disks are also not supported for them.
@@ -338,7 +471,7 @@ func isBackendPoolOnSameLB(newBackendPoolID string, existingBackendPools []strin
 	}
 
 	newLBName := matches[1]
-	newLBNameTrimmed := strings.TrimSuffix(newLBName, InternalLoadBalancerNameSuffix)
+	newLBNameTrimmed := trimLoadBalancerNameSuffixes(newLBName)
 	for _, backendPool := range existingBackendPools {
 		matches := backendPoolIDRE.FindStringSubmatch(backendPool)
 		if len(matches) != 2 {
@@ -346,7 +479,7 @@ func isBackendPoolOnSameLB(newBackendPoolID string, existingBackendPools []strin
 		}
 
 		lbName := matches[1]
-		if !strings.EqualFold(strings.TrimSuffix(lbName, InternalLoadBalancerNameSuffix), newLBNameTrimmed) {
+		if !strings.EqualFold(trimLoadBalancerNameSuffixes(lbName), newLBNameTrimmed) {
 			return false, lbName, nil
 		}
 	}
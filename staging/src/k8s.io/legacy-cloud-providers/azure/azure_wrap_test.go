@@ -23,9 +23,15 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-12-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
+	cloudprovider "k8s.io/cloud-provider"
+	azcache "k8s.io/legacy-cloud-providers/azure/cache"
+	"k8s.io/legacy-cloud-providers/azure/clients/vmclient/mockvmclient"
 	"k8s.io/legacy-cloud-providers/azure/retry"
 )
 
@@ -289,3 +295,147 @@ func TestIsBackendPoolOnSameLB(t *testing.T) {
 		assert.Equal(t, test.expectedLBName, lbName)
 	}
 }
+
+func TestServiceDisableLoadBalancerOutboundSNAT(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = loadBalancerSkuStandard
+	az.DisableOutboundSNAT = to.BoolPtr(false)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+
+	// Without the annotation the cluster wide setting applies.
+	assert.False(t, az.serviceDisableLoadBalancerOutboundSNAT(&svc))
+
+	// The annotation overrides the cluster wide setting in both directions.
+	svc.Annotations[ServiceAnnotationDisableLoadBalancerOutboundSNAT] = "true"
+	assert.True(t, az.serviceDisableLoadBalancerOutboundSNAT(&svc))
+	az.DisableOutboundSNAT = to.BoolPtr(true)
+	svc.Annotations[ServiceAnnotationDisableLoadBalancerOutboundSNAT] = "false"
+	assert.False(t, az.serviceDisableLoadBalancerOutboundSNAT(&svc))
+
+	// The annotation is ignored with the basic load balancer SKU.
+	az.LoadBalancerSku = loadBalancerSkuBasic
+	az.DisableOutboundSNAT = nil
+	svc.Annotations[ServiceAnnotationDisableLoadBalancerOutboundSNAT] = "true"
+	assert.False(t, az.serviceDisableLoadBalancerOutboundSNAT(&svc))
+
+	// With user defined routing SNAT is always disabled, the annotation
+	// cannot re-enable it.
+	az.LoadBalancerSku = loadBalancerSkuStandard
+	az.OutboundType = outboundTypeUserDefinedRouting
+	svc.Annotations[ServiceAnnotationDisableLoadBalancerOutboundSNAT] = "false"
+	assert.True(t, az.serviceDisableLoadBalancerOutboundSNAT(&svc))
+	delete(svc.Annotations, ServiceAnnotationDisableLoadBalancerOutboundSNAT)
+	assert.True(t, az.serviceDisableLoadBalancerOutboundSNAT(&svc))
+}
+
+func TestExcludeMasterNodesFromLB(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	externalSvc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	internalSvc := getTestService("service2", v1.ProtocolTCP, map[string]string{
+		ServiceAnnotationLoadBalancerInternal: "true",
+	}, false, 80)
+
+	testCases := []struct {
+		description                   string
+		excludeMasterFromStandardLB   *bool
+		excludeMasterFromExternalLB   *bool
+		excludeMasterFromInternalLB   *bool
+		excludeMasterFromOutboundPool *bool
+		expectedExternal              bool
+		expectedInternal              bool
+	}{
+		{
+			description:                 "unset knobs should inherit the cluster wide setting",
+			excludeMasterFromStandardLB: to.BoolPtr(true),
+			expectedExternal:            true,
+			expectedInternal:            true,
+		},
+		{
+			description:                 "the internal knob should admit masters to internal pools only",
+			excludeMasterFromStandardLB: to.BoolPtr(true),
+			excludeMasterFromInternalLB: to.BoolPtr(false),
+			expectedExternal:            true,
+			expectedInternal:            false,
+		},
+		{
+			description:                   "the external pool doubles as the outbound pool, so either knob keeps masters in",
+			excludeMasterFromStandardLB:   to.BoolPtr(true),
+			excludeMasterFromOutboundPool: to.BoolPtr(false),
+			expectedExternal:              false,
+			expectedInternal:              true,
+		},
+		{
+			description:                   "per-pool knobs should be able to exclude when the cluster wide setting is off",
+			excludeMasterFromStandardLB:   to.BoolPtr(false),
+			excludeMasterFromExternalLB:   to.BoolPtr(true),
+			excludeMasterFromOutboundPool: to.BoolPtr(true),
+			expectedExternal:              true,
+			expectedInternal:              false,
+		},
+	}
+
+	for _, test := range testCases {
+		az := GetTestCloud(ctrl)
+		az.ExcludeMasterFromStandardLB = test.excludeMasterFromStandardLB
+		az.ExcludeMasterFromExternalLB = test.excludeMasterFromExternalLB
+		az.ExcludeMasterFromInternalLB = test.excludeMasterFromInternalLB
+		az.ExcludeMasterFromOutboundPool = test.excludeMasterFromOutboundPool
+
+		assert.Equal(t, test.expectedExternal, az.excludeMasterNodesFromLB(&externalSvc), test.description)
+		assert.Equal(t, test.expectedInternal, az.excludeMasterNodesFromLB(&internalSvc), test.description)
+	}
+}
+
+func TestGetVirtualMachineFallback(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	notFoundErr := &retry.Error{HTTPStatusCode: http.StatusNotFound}
+
+	// The VM name recorded from the node's providerID resolves the VM when
+	// the node name doesn't match any VM name.
+	az := GetTestCloud(ctrl)
+	az.nodeVMNames["node1"] = "vm1"
+	expectedVM := compute.VirtualMachine{Name: to.StringPtr("vm1")}
+	mockVMsClient := az.VirtualMachinesClient.(*mockvmclient.MockInterface)
+	mockVMsClient.EXPECT().Get(gomock.Any(), "rg", "node1", gomock.Any()).Return(compute.VirtualMachine{}, notFoundErr)
+	mockVMsClient.EXPECT().Get(gomock.Any(), "rg", "vm1", gomock.Any()).Return(expectedVM, nil)
+
+	// NodeNameResolutionMethod is left at hostname, so the first lookup uses
+	// the node name and the fallback must kick in.
+	vm, err := az.getVirtualMachine("node1", azcache.CacheReadTypeDefault)
+	assert.NoError(t, err)
+	assert.Equal(t, "vm1", *vm.Name)
+
+	// A VM tagged with the node name is found by the ARM search and the
+	// resolved name is remembered.
+	az = GetTestCloud(ctrl)
+	az.NodeNameResolutionMethod = nodeNameResolutionMethodProviderID
+	taggedVM := compute.VirtualMachine{
+		Name: to.StringPtr("vm2"),
+		Tags: map[string]*string{kubernetesNodeNameTag: to.StringPtr("node2")},
+	}
+	mockVMsClient = az.VirtualMachinesClient.(*mockvmclient.MockInterface)
+	mockVMsClient.EXPECT().Get(gomock.Any(), "rg", "node2", gomock.Any()).Return(compute.VirtualMachine{}, notFoundErr)
+	mockVMsClient.EXPECT().List(gomock.Any(), "rg").Return([]compute.VirtualMachine{taggedVM}, nil)
+
+	vm, err = az.getVirtualMachine("node2", azcache.CacheReadTypeDefault)
+	assert.NoError(t, err)
+	assert.Equal(t, "vm2", *vm.Name)
+	assert.Equal(t, "vm2", az.nodeVMNames["node2"])
+
+	// Without any match the lookup still reports InstanceNotFound.
+	az = GetTestCloud(ctrl)
+	az.NodeNameResolutionMethod = nodeNameResolutionMethodProviderID
+	mockVMsClient = az.VirtualMachinesClient.(*mockvmclient.MockInterface)
+	mockVMsClient.EXPECT().Get(gomock.Any(), "rg", "node3", gomock.Any()).Return(compute.VirtualMachine{}, notFoundErr)
+	mockVMsClient.EXPECT().List(gomock.Any(), "rg").Return(nil, nil)
+
+	_, err = az.getVirtualMachine("node3", azcache.CacheReadTypeDefault)
+	assert.Equal(t, cloudprovider.InstanceNotFound, err)
+}
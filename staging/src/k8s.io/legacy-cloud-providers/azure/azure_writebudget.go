@@ -0,0 +1,85 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"sync"
+	"time"
+)
+
+// writeBudget caps the number of ARM write operations the provider issues per
+// minute, so that reconciles don't exhaust subscription-level ARM limits that
+// are shared with other tooling. Urgent writes (service creation and deletion
+// paths) are always allowed and only consume the budget; non-urgent writes
+// (tag updates, drift with no traffic impact) are deferred once the budget of
+// the current window is used up.
+type writeBudget struct {
+	lock sync.Mutex
+	// limit is the number of writes allowed per minute. Zero disables the
+	// budget entirely.
+	limit       int
+	windowStart time.Time
+	used        int
+}
+
+// newWriteBudget builds a write budget with the given per-minute limit.
+func newWriteBudget(limit int) *writeBudget {
+	return &writeBudget{limit: limit}
+}
+
+// allow reports whether a write operation may proceed. Urgent writes always
+// proceed and are counted against the budget; non-urgent writes are refused
+// once the budget of the current one-minute window is exhausted.
+func (b *writeBudget) allow(urgent bool) bool {
+	if b == nil || b.limit <= 0 {
+		return true
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := time.Now()
+	if now.Sub(b.windowStart) >= time.Minute {
+		b.windowStart = now
+		b.used = 0
+	}
+
+	if !urgent && b.used >= b.limit {
+		return false
+	}
+
+	b.used++
+	return true
+}
+
+// stats returns the configured per-minute limit and the writes consumed in
+// the current window.
+func (b *writeBudget) stats() (limit int, used int) {
+	if b == nil {
+		return 0, 0
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if time.Since(b.windowStart) >= time.Minute {
+		return b.limit, 0
+	}
+	return b.limit, b.used
+}
@@ -0,0 +1,50 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteBudgetAllow(t *testing.T) {
+	// A zero limit disables the budget entirely.
+	disabled := newWriteBudget(0)
+	for i := 0; i < 10; i++ {
+		assert.True(t, disabled.allow(false))
+	}
+
+	// A nil budget behaves as disabled.
+	var nilBudget *writeBudget
+	assert.True(t, nilBudget.allow(false))
+
+	// Non-urgent writes are refused once the budget is used up while urgent
+	// writes still proceed.
+	budget := newWriteBudget(2)
+	assert.True(t, budget.allow(false))
+	assert.True(t, budget.allow(false))
+	assert.False(t, budget.allow(false))
+	assert.True(t, budget.allow(true))
+
+	// A new window replenishes the budget.
+	budget.windowStart = time.Now().Add(-2 * time.Minute)
+	assert.True(t, budget.allow(false))
+}
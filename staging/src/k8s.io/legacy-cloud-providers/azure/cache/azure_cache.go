@@ -20,10 +20,14 @@ package cache
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/legacy-cloud-providers/azure/metrics"
 )
 
 // AzureCacheReadType defines the read type for cache data
@@ -43,9 +47,78 @@ const (
 	CacheReadTypeForceRefresh
 )
 
+const (
+	// CacheOperationHit is reported when a read is served from the cache.
+	CacheOperationHit = "hit"
+	// CacheOperationMiss is reported when the key was not cached yet.
+	CacheOperationMiss = "miss"
+	// CacheOperationExpired is reported when the cached entry was expired.
+	CacheOperationExpired = "expired"
+	// CacheOperationForcedRefresh is reported when the caller bypassed the
+	// cache with CacheReadTypeForceRefresh.
+	CacheOperationForcedRefresh = "forced_refresh"
+)
+
+// ReadTypeName returns the metric label for a cache read type.
+func ReadTypeName(crt AzureCacheReadType) string {
+	switch crt {
+	case CacheReadTypeUnsafe:
+		return "unsafe"
+	case CacheReadTypeForceRefresh:
+		return "force_refresh"
+	default:
+		return "default"
+	}
+}
+
+// forcedSafeReads holds the names of the caches whose unsafe reads are
+// upgraded to default reads, as configured by forceCacheSafeReads. It is
+// package-level because caches are constructed in several places while the
+// configuration is parsed once.
+var forcedSafeReads = struct {
+	sync.RWMutex
+	all   bool
+	names map[string]bool
+}{names: map[string]bool{}}
+
+// SetForcedSafeReads configures the named caches whose CacheReadTypeUnsafe
+// reads are upgraded to CacheReadTypeDefault reads, so expired entries are
+// refetched instead of served stale. The name "*" forces safe reads on every
+// named cache; empty names are ignored.
+func SetForcedSafeReads(names []string) {
+	forcedSafeReads.Lock()
+	defer forcedSafeReads.Unlock()
+	forcedSafeReads.all = false
+	forcedSafeReads.names = map[string]bool{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "":
+		case "*":
+			forcedSafeReads.all = true
+		default:
+			forcedSafeReads.names[name] = true
+		}
+	}
+}
+
 // GetFunc defines a getter function for timedCache.
 type GetFunc func(key string) (interface{}, error)
 
+// CacheStats is a snapshot of the read counters of a TimedCache.
+type CacheStats struct {
+	Hits            uint64 `json:"hits"`
+	Misses          uint64 `json:"misses"`
+	Expirations     uint64 `json:"expirations"`
+	ForcedRefreshes uint64 `json:"forcedRefreshes"`
+}
+
+// CacheKeyInfo describes one cache entry without exposing its payload.
+type CacheKeyInfo struct {
+	Key        string  `json:"key"`
+	AgeSeconds float64 `json:"ageSeconds"`
+}
+
 // AzureCacheEntry is the internal structure stores inside TTLStore.
 type AzureCacheEntry struct {
 	Key  string
@@ -68,6 +141,15 @@ type TimedCache struct {
 	Lock   sync.Mutex
 	Getter GetFunc
 	TTL    time.Duration
+
+	// Name identifies the cache in metrics and debug output. Reads of caches
+	// without a name are counted locally but not reported to metrics.
+	Name string
+
+	hits            uint64
+	misses          uint64
+	expirations     uint64
+	forcedRefreshes uint64
 }
 
 // NewTimedcache creates a new TimedCache.
@@ -86,6 +168,18 @@ func NewTimedcache(ttl time.Duration, getter GetFunc) (*TimedCache, error) {
 	}, nil
 }
 
+// NewNamedTimedCache creates a new TimedCache whose reads are reported to the
+// cache metrics under the given name.
+func NewNamedTimedCache(name string, ttl time.Duration, getter GetFunc) (*TimedCache, error) {
+	timedCache, err := NewTimedcache(ttl, getter)
+	if err != nil {
+		return nil, err
+	}
+
+	timedCache.Name = name
+	return timedCache, nil
+}
+
 // getInternal returns AzureCacheEntry by key. If the key is not cached yet,
 // it returns a AzureCacheEntry with nil data.
 func (t *TimedCache) getInternal(key string) (*AzureCacheEntry, error) {
@@ -115,6 +209,13 @@ func (t *TimedCache) getInternal(key string) (*AzureCacheEntry, error) {
 
 // Get returns the requested item by key.
 func (t *TimedCache) Get(key string, crt AzureCacheReadType) (interface{}, error) {
+	if crt == CacheReadTypeUnsafe && t.safeReadsForced() {
+		crt = CacheReadTypeDefault
+	}
+	if t.Name != "" {
+		metrics.ObserveCacheReadType(t.Name, ReadTypeName(crt))
+	}
+
 	entry, err := t.getInternal(key)
 	if err != nil {
 		return nil, err
@@ -127,13 +228,26 @@ func (t *TimedCache) Get(key string, crt AzureCacheReadType) (interface{}, error
 	if entry.Data != nil && crt != CacheReadTypeForceRefresh {
 		// allow unsafe read, so return data even if expired
 		if crt == CacheReadTypeUnsafe {
+			t.observeServedEntry(crt, entry)
+			t.observeOperation(CacheOperationHit, &t.hits)
 			return entry.Data, nil
 		}
 		// if cached data is not expired, return cached data
 		if crt == CacheReadTypeDefault && time.Since(entry.CreatedOn) < t.TTL {
+			t.observeServedEntry(crt, entry)
+			t.observeOperation(CacheOperationHit, &t.hits)
 			return entry.Data, nil
 		}
 	}
+
+	switch {
+	case crt == CacheReadTypeForceRefresh:
+		t.observeOperation(CacheOperationForcedRefresh, &t.forcedRefreshes)
+	case entry.Data == nil:
+		t.observeOperation(CacheOperationMiss, &t.misses)
+	default:
+		t.observeOperation(CacheOperationExpired, &t.expirations)
+	}
 	// Data is not cached yet, cache data is expired or requested force refresh
 	// cache it by getter. entry is locked before getting to ensure concurrent
 	// gets don't result in multiple ARM calls.
@@ -150,6 +264,62 @@ func (t *TimedCache) Get(key string, crt AzureCacheReadType) (interface{}, error
 	return entry.Data, nil
 }
 
+// observeOperation counts one cache read locally and reports it to the cache
+// metrics if the cache has a name.
+func (t *TimedCache) observeOperation(operation string, counter *uint64) {
+	atomic.AddUint64(counter, 1)
+	if t.Name != "" {
+		metrics.ObserveCacheOperation(t.Name, operation)
+	}
+}
+
+// observeServedEntry reports the age of an entry that is served without a
+// refetch, so how stale the data actually read through each read type was
+// becomes visible in metrics.
+func (t *TimedCache) observeServedEntry(crt AzureCacheReadType, entry *AzureCacheEntry) {
+	if t.Name != "" {
+		metrics.ObserveCacheServedEntryAge(t.Name, ReadTypeName(crt), time.Since(entry.CreatedOn).Seconds())
+	}
+}
+
+// safeReadsForced returns whether unsafe reads of this cache are configured
+// to be upgraded to default reads.
+func (t *TimedCache) safeReadsForced() bool {
+	if t.Name == "" {
+		return false
+	}
+	forcedSafeReads.RLock()
+	defer forcedSafeReads.RUnlock()
+	return forcedSafeReads.all || forcedSafeReads.names[t.Name]
+}
+
+// Stats returns a snapshot of the read counters of the cache.
+func (t *TimedCache) Stats() CacheStats {
+	return CacheStats{
+		Hits:            atomic.LoadUint64(&t.hits),
+		Misses:          atomic.LoadUint64(&t.misses),
+		Expirations:     atomic.LoadUint64(&t.expirations),
+		ForcedRefreshes: atomic.LoadUint64(&t.forcedRefreshes),
+	}
+}
+
+// Keys returns the keys in the cache together with their ages, sorted by key.
+// Payloads are deliberately not included so the result is safe to expose on
+// debug endpoints.
+func (t *TimedCache) Keys() []CacheKeyInfo {
+	var infos []CacheKeyInfo
+	for _, obj := range t.Store.List() {
+		entry := obj.(*AzureCacheEntry)
+		infos = append(infos, CacheKeyInfo{
+			Key:        entry.Key,
+			AgeSeconds: time.Since(entry.CreatedOn).Seconds(),
+		})
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+	return infos
+}
+
 // Delete removes an item from the cache.
 func (t *TimedCache) Delete(key string) error {
 	return t.Store.Delete(&AzureCacheEntry{
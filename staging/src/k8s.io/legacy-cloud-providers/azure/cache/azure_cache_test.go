@@ -224,3 +224,96 @@ func TestCacheForceRefresh(t *testing.T) {
 	assert.Equal(t, 2, dataSource.called)
 	assert.Equal(t, val, v, "should refetch unexpired data as forced refresh")
 }
+
+func TestCacheStats(t *testing.T) {
+	key := "key1"
+	val := &fakeDataObj{}
+	data := map[string]*fakeDataObj{
+		key: val,
+	}
+	dataSource, cache := newFakeCache(t)
+	dataSource.set(data)
+
+	_, err := cache.Get(key, CacheReadTypeDefault)
+	assert.NoError(t, err)
+	_, err = cache.Get(key, CacheReadTypeDefault)
+	assert.NoError(t, err)
+	_, err = cache.Get(key, CacheReadTypeForceRefresh)
+	assert.NoError(t, err)
+
+	stats := cache.Stats()
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 1, ForcedRefreshes: 1}, stats)
+
+	// Expired entries are counted separately.
+	entry, err := cache.getInternal(key)
+	assert.NoError(t, err)
+	entry.CreatedOn = time.Now().Add(-(fakeCacheTTL + time.Second))
+	_, err = cache.Get(key, CacheReadTypeDefault)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), cache.Stats().Expirations)
+}
+
+func TestCacheKeys(t *testing.T) {
+	dataSource, cache := newFakeCache(t)
+	dataSource.set(map[string]*fakeDataObj{"b": {}, "a": {}})
+
+	_, err := cache.Get("b", CacheReadTypeDefault)
+	assert.NoError(t, err)
+	_, err = cache.Get("a", CacheReadTypeDefault)
+	assert.NoError(t, err)
+
+	keys := cache.Keys()
+	assert.Len(t, keys, 2)
+	assert.Equal(t, "a", keys[0].Key)
+	assert.Equal(t, "b", keys[1].Key)
+}
+
+func TestCacheForcedSafeReads(t *testing.T) {
+	defer SetForcedSafeReads(nil)
+
+	key := "key1"
+	val := &fakeDataObj{}
+	data := map[string]*fakeDataObj{
+		key: val,
+	}
+	dataSource, cache := newFakeCache(t)
+	cache.Name = "fake"
+	dataSource.set(data)
+
+	v, err := cache.Get(key, CacheReadTypeDefault)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, dataSource.called)
+	assert.Equal(t, val, v)
+
+	// Without the override the expired entry is served stale.
+	time.Sleep(fakeCacheTTL)
+	v, err = cache.Get(key, CacheReadTypeUnsafe)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, dataSource.called)
+	assert.Equal(t, val, v)
+
+	// With safe reads forced on the cache the unsafe read refetches.
+	SetForcedSafeReads([]string{"fake"})
+	v, err = cache.Get(key, CacheReadTypeUnsafe)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, dataSource.called)
+	assert.Equal(t, val, v)
+
+	// Other caches are unaffected by the name list, but "*" covers them.
+	SetForcedSafeReads([]string{"other"})
+	time.Sleep(fakeCacheTTL)
+	_, err = cache.Get(key, CacheReadTypeUnsafe)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, dataSource.called)
+
+	SetForcedSafeReads([]string{"*"})
+	_, err = cache.Get(key, CacheReadTypeUnsafe)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, dataSource.called)
+}
+
+func TestReadTypeName(t *testing.T) {
+	assert.Equal(t, "default", ReadTypeName(CacheReadTypeDefault))
+	assert.Equal(t, "unsafe", ReadTypeName(CacheReadTypeUnsafe))
+	assert.Equal(t, "force_refresh", ReadTypeName(CacheReadTypeForceRefresh))
+}
@@ -43,6 +43,9 @@ type Interface interface {
 	// GetVirtualMachineScaleSetNetworkInterface gets a network.Interface of VMSS VM.
 	GetVirtualMachineScaleSetNetworkInterface(ctx context.Context, resourceGroupName string, virtualMachineScaleSetName string, virtualmachineIndex string, networkInterfaceName string, expand string) (result network.Interface, rerr *retry.Error)
 
+	// List lists all network.Interface in the resource group.
+	List(ctx context.Context, resourceGroupName string) (result []network.Interface, rerr *retry.Error)
+
 	// CreateOrUpdate creates or updates a network.Interface.
 	CreateOrUpdate(ctx context.Context, resourceGroupName string, networkInterfaceName string, parameters network.Interface) *retry.Error
 
@@ -20,6 +20,7 @@ package loadbalancerclient
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
@@ -44,6 +45,14 @@ type Client struct {
 	armClient      armclient.Interface
 	subscriptionID string
 
+	// backendPoolARMClient uses the newer API version required for IP-based
+	// backend address pools.
+	backendPoolARMClient armclient.Interface
+
+	// gatewayARMClient uses the newer API version required for gateway load
+	// balancer chaining on frontend IP configurations.
+	gatewayARMClient armclient.Interface
+
 	// Rate limiting configures.
 	rateLimiterReader flowcontrol.RateLimiter
 	rateLimiterWriter flowcontrol.RateLimiter
@@ -68,10 +77,12 @@ func New(config *azclients.ClientConfig) *Client {
 		config.RateLimitConfig.CloudProviderRateLimitBucketWrite)
 
 	client := &Client{
-		armClient:         armClient,
-		rateLimiterReader: rateLimiterReader,
-		rateLimiterWriter: rateLimiterWriter,
-		subscriptionID:    config.SubscriptionID,
+		armClient:            armClient,
+		backendPoolARMClient: armclient.New(authorizer, baseURI, config.UserAgent, BackendPoolAPIVersion, config.Location, config.Backoff),
+		gatewayARMClient:     armclient.New(authorizer, baseURI, config.UserAgent, GatewayLoadBalancerAPIVersion, config.Location, config.Backoff),
+		rateLimiterReader:    rateLimiterReader,
+		rateLimiterWriter:    rateLimiterWriter,
+		subscriptionID:       config.SubscriptionID,
 	}
 
 	return client
@@ -278,6 +289,256 @@ func (c *Client) createOrUpdateResponder(resp *http.Response) (*network.LoadBala
 	return result, retry.GetError(resp, err)
 }
 
+// CreateOrUpdateWithGatewayLoadBalancers creates or updates a LoadBalancer
+// and chains the frontend IP configurations named in gatewayLoadBalancers to
+// the referenced gateway load balancer frontends.
+func (c *Client) CreateOrUpdateWithGatewayLoadBalancers(ctx context.Context, resourceGroupName string, loadBalancerName string, parameters network.LoadBalancer, gatewayLoadBalancers map[string]string, etag string) *retry.Error {
+	mc := metrics.NewMetricContext("load_balancers", "create_or_update_gateway_lb", resourceGroupName, c.subscriptionID, "")
+
+	// Report errors if the client is rate limited.
+	if !c.rateLimiterWriter.TryAccept() {
+		mc.RateLimitedCount()
+		return retry.GetRateLimitError(true, "LBCreateOrUpdateGatewayLB")
+	}
+
+	// Report errors if the client is throttled.
+	if c.RetryAfterWriter.After(time.Now()) {
+		mc.ThrottledCount()
+		rerr := retry.GetThrottlingError("LBCreateOrUpdateGatewayLB", "client throttled", c.RetryAfterWriter)
+		return rerr
+	}
+
+	rerr := c.createOrUpdateLBWithGatewayLoadBalancers(ctx, resourceGroupName, loadBalancerName, parameters, gatewayLoadBalancers, etag)
+	mc.Observe(rerr.Error())
+	if rerr != nil {
+		if rerr.IsThrottled() {
+			// Update RetryAfterReader so that no more requests would be sent until RetryAfter expires.
+			c.RetryAfterWriter = rerr.RetryAfter
+		}
+
+		return rerr
+	}
+
+	return nil
+}
+
+// createOrUpdateLBWithGatewayLoadBalancers puts the LoadBalancer with the
+// gateway load balancer references injected into the payload. The references
+// are spliced in at the JSON level because the vendored network SDK cannot
+// express them.
+func (c *Client) createOrUpdateLBWithGatewayLoadBalancers(ctx context.Context, resourceGroupName string, loadBalancerName string, parameters network.LoadBalancer, gatewayLoadBalancers map[string]string, etag string) *retry.Error {
+	resourceID := armclient.GetResourceID(
+		c.subscriptionID,
+		resourceGroupName,
+		"Microsoft.Network/loadBalancers",
+		loadBalancerName,
+	)
+	payload, err := injectGatewayLoadBalancers(parameters, gatewayLoadBalancers)
+	if err != nil {
+		return retry.NewError(false, err)
+	}
+	decorators := []autorest.PrepareDecorator{
+		autorest.WithPathParameters("{resourceID}", map[string]interface{}{"resourceID": resourceID}),
+		autorest.WithJSON(payload),
+	}
+	if etag != "" {
+		decorators = append(decorators, autorest.WithHeader("If-Match", autorest.String(etag)))
+	}
+
+	response, rerr := c.gatewayARMClient.PutResourceWithDecorators(ctx, resourceID, payload, decorators)
+	defer c.gatewayARMClient.CloseResponse(ctx, response)
+	if rerr != nil {
+		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "loadbalancer.gatewaylb.put.request", resourceID, rerr.Error())
+		return rerr
+	}
+
+	if response != nil && response.StatusCode != http.StatusNoContent {
+		_, rerr = c.createOrUpdateResponder(response)
+		if rerr != nil {
+			klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "loadbalancer.gatewaylb.put.respond", resourceID, rerr.Error())
+			return rerr
+		}
+	}
+
+	return nil
+}
+
+// injectGatewayLoadBalancers rewrites the serialized LoadBalancer so that the
+// frontend IP configurations named in gatewayLoadBalancers reference their
+// gateway load balancer frontends.
+func injectGatewayLoadBalancers(parameters network.LoadBalancer, gatewayLoadBalancers map[string]string) (map[string]interface{}, error) {
+	body, err := json.Marshal(parameters)
+	if err != nil {
+		return nil, err
+	}
+	payload := map[string]interface{}{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+
+	properties, ok := payload["properties"].(map[string]interface{})
+	if !ok {
+		return payload, nil
+	}
+	frontends, ok := properties["frontendIPConfigurations"].([]interface{})
+	if !ok {
+		return payload, nil
+	}
+	for _, frontend := range frontends {
+		config, ok := frontend.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := config["name"].(string)
+		gatewayID, wanted := gatewayLoadBalancers[name]
+		if !wanted {
+			continue
+		}
+		configProperties, ok := config["properties"].(map[string]interface{})
+		if !ok {
+			configProperties = map[string]interface{}{}
+			config["properties"] = configProperties
+		}
+		configProperties["gatewayLoadBalancer"] = map[string]interface{}{"id": gatewayID}
+	}
+	return payload, nil
+}
+
+// UpdateTags updates the tags of a LoadBalancer without touching its other
+// properties.
+func (c *Client) UpdateTags(ctx context.Context, resourceGroupName string, loadBalancerName string, tags map[string]*string) *retry.Error {
+	mc := metrics.NewMetricContext("load_balancers", "update_tags", resourceGroupName, c.subscriptionID, "")
+
+	// Report errors if the client is rate limited.
+	if !c.rateLimiterWriter.TryAccept() {
+		mc.RateLimitedCount()
+		return retry.GetRateLimitError(true, "LBUpdateTags")
+	}
+
+	// Report errors if the client is throttled.
+	if c.RetryAfterWriter.After(time.Now()) {
+		mc.ThrottledCount()
+		rerr := retry.GetThrottlingError("LBUpdateTags", "client throttled", c.RetryAfterWriter)
+		return rerr
+	}
+
+	rerr := c.updateLBTags(ctx, resourceGroupName, loadBalancerName, tags)
+	mc.Observe(rerr.Error())
+	if rerr != nil {
+		if rerr.IsThrottled() {
+			// Update RetryAfterReader so that no more requests would be sent until RetryAfter expires.
+			c.RetryAfterWriter = rerr.RetryAfter
+		}
+
+		return rerr
+	}
+
+	return nil
+}
+
+// CreateOrUpdateBackendAddressPool creates or updates the backend address
+// pool with IP-based members, replacing the existing membership.
+func (c *Client) CreateOrUpdateBackendAddressPool(ctx context.Context, resourceGroupName string, loadBalancerName string, backendPoolName string, addresses []LoadBalancerBackendAddress) *retry.Error {
+	mc := metrics.NewMetricContext("load_balancers", "create_or_update_backend_pool", resourceGroupName, c.subscriptionID, "")
+
+	// Report errors if the client is rate limited.
+	if !c.rateLimiterWriter.TryAccept() {
+		mc.RateLimitedCount()
+		return retry.GetRateLimitError(true, "LBCreateOrUpdateBackendPool")
+	}
+
+	// Report errors if the client is throttled.
+	if c.RetryAfterWriter.After(time.Now()) {
+		mc.ThrottledCount()
+		rerr := retry.GetThrottlingError("LBCreateOrUpdateBackendPool", "client throttled", c.RetryAfterWriter)
+		return rerr
+	}
+
+	rerr := c.createOrUpdateBackendAddressPool(ctx, resourceGroupName, loadBalancerName, backendPoolName, addresses)
+	mc.Observe(rerr.Error())
+	if rerr != nil {
+		if rerr.IsThrottled() {
+			// Update RetryAfterReader so that no more requests would be sent until RetryAfter expires.
+			c.RetryAfterWriter = rerr.RetryAfter
+		}
+
+		return rerr
+	}
+
+	return nil
+}
+
+// createOrUpdateBackendAddressPool puts the backend address pool with
+// IP-based members.
+func (c *Client) createOrUpdateBackendAddressPool(ctx context.Context, resourceGroupName string, loadBalancerName string, backendPoolName string, addresses []LoadBalancerBackendAddress) *retry.Error {
+	resourceID := armclient.GetChildResourceID(
+		c.subscriptionID,
+		resourceGroupName,
+		"Microsoft.Network/loadBalancers",
+		loadBalancerName,
+		"backendAddressPools",
+		backendPoolName,
+	)
+	parameters := struct {
+		Name       string `json:"name"`
+		Properties struct {
+			LoadBalancerBackendAddresses []LoadBalancerBackendAddress `json:"loadBalancerBackendAddresses"`
+		} `json:"properties"`
+	}{
+		Name: backendPoolName,
+	}
+	parameters.Properties.LoadBalancerBackendAddresses = addresses
+
+	response, rerr := c.backendPoolARMClient.PutResource(ctx, resourceID, parameters)
+	defer c.backendPoolARMClient.CloseResponse(ctx, response)
+	if rerr != nil {
+		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "loadbalancer.backendpool.put.request", resourceID, rerr.Error())
+		return rerr
+	}
+
+	if response != nil && response.StatusCode != http.StatusNoContent {
+		_, rerr = c.createOrUpdateResponder(response)
+		if rerr != nil {
+			klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "loadbalancer.backendpool.put.respond", resourceID, rerr.Error())
+			return rerr
+		}
+	}
+
+	return nil
+}
+
+// updateLBTags patches the tags of a LoadBalancer.
+func (c *Client) updateLBTags(ctx context.Context, resourceGroupName string, loadBalancerName string, tags map[string]*string) *retry.Error {
+	resourceID := armclient.GetResourceID(
+		c.subscriptionID,
+		resourceGroupName,
+		"Microsoft.Network/loadBalancers",
+		loadBalancerName,
+	)
+	parameters := struct {
+		Tags map[string]*string `json:"tags"`
+	}{
+		Tags: tags,
+	}
+
+	response, rerr := c.armClient.PatchResource(ctx, resourceID, parameters)
+	defer c.armClient.CloseResponse(ctx, response)
+	if rerr != nil {
+		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "loadbalancer.patch.request", resourceID, rerr.Error())
+		return rerr
+	}
+
+	if response != nil && response.StatusCode != http.StatusNoContent {
+		_, rerr = c.createOrUpdateResponder(response)
+		if rerr != nil {
+			klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "loadbalancer.patch.respond", resourceID, rerr.Error())
+			return rerr
+		}
+	}
+
+	return nil
+}
+
 // Delete deletes a LoadBalancer by name.
 func (c *Client) Delete(ctx context.Context, resourceGroupName string, loadBalancerName string) *retry.Error {
 	mc := metrics.NewMetricContext("load_balancers", "delete", resourceGroupName, c.subscriptionID, "")
@@ -236,6 +236,54 @@ func TestCreateOrUpdate(t *testing.T) {
 	assert.Nil(t, rerr)
 }
 
+func TestCreateOrUpdateWithGatewayLoadBalancers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lb := getTestLoadBalancer("lb1")
+	lb.LoadBalancerPropertiesFormat = &network.LoadBalancerPropertiesFormat{
+		FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+			{
+				Name: to.StringPtr("fip1"),
+				FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+					PrivateIPAddress: to.StringPtr("10.0.0.4"),
+				},
+			},
+			{
+				Name: to.StringPtr("fip2"),
+				FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+					PrivateIPAddress: to.StringPtr("10.0.0.5"),
+				},
+			},
+		},
+	}
+	gatewayFrontendID := "/subscriptions/subscriptionID/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/gateway-lb/frontendIPConfigurations/fe1"
+
+	var payload map[string]interface{}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	response := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(""))),
+	}
+	armClient.EXPECT().PutResourceWithDecorators(gomock.Any(), to.String(lb.ID), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, resourceID string, parameters interface{}, decorators []autorest.PrepareDecorator) (*http.Response, *retry.Error) {
+			payload, _ = parameters.(map[string]interface{})
+			return response, nil
+		}).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	lbClient := getTestLoadBalancerClient(armClient)
+	lbClient.gatewayARMClient = armClient
+	rerr := lbClient.CreateOrUpdateWithGatewayLoadBalancers(context.TODO(), "rg", "lb1", lb, map[string]string{"fip1": gatewayFrontendID}, "")
+	assert.Nil(t, rerr)
+
+	frontends := payload["properties"].(map[string]interface{})["frontendIPConfigurations"].([]interface{})
+	fip1Properties := frontends[0].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"id": gatewayFrontendID}, fip1Properties["gatewayLoadBalancer"])
+	fip2Properties := frontends[1].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.NotContains(t, fip2Properties, "gatewayLoadBalancer")
+}
+
 func TestDelete(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
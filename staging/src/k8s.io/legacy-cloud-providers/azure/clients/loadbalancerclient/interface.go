@@ -28,8 +28,37 @@ import (
 const (
 	// APIVersion is the API version for network.
 	APIVersion = "2019-06-01"
+
+	// BackendPoolAPIVersion is the API version for IP-based backend address
+	// pools, which predate the vendored network SDK.
+	BackendPoolAPIVersion = "2020-05-01"
+
+	// GatewayLoadBalancerAPIVersion is the API version for gateway load
+	// balancer chaining on frontend IP configurations, which the vendored
+	// network SDK cannot express.
+	GatewayLoadBalancerAPIVersion = "2021-02-01"
 )
 
+// LoadBalancerBackendAddress is an IP-based backend address pool member. It
+// is modeled locally because the vendored network SDK predates IP-based
+// backend pools.
+type LoadBalancerBackendAddress struct {
+	Name       string                               `json:"name"`
+	Properties LoadBalancerBackendAddressProperties `json:"properties"`
+}
+
+// LoadBalancerBackendAddressProperties are the properties of an IP-based
+// backend address pool member.
+type LoadBalancerBackendAddressProperties struct {
+	IPAddress      string       `json:"ipAddress,omitempty"`
+	VirtualNetwork *SubResource `json:"virtualNetwork,omitempty"`
+}
+
+// SubResource is a reference to another Azure resource.
+type SubResource struct {
+	ID string `json:"id"`
+}
+
 // Interface is the client interface for LoadBalancer.
 // Don't forget to run the following command to generate the mock client:
 // mockgen -source=$GOPATH/src/k8s.io/kubernetes/staging/src/k8s.io/legacy-cloud-providers/azure/clients/loadbalancerclient/interface.go -package=mockloadbalancerclient Interface > $GOPATH/src/k8s.io/kubernetes/staging/src/k8s.io/legacy-cloud-providers/azure/clients/loadbalancerclient/mockloadbalancerclient/interface.go
@@ -43,6 +72,19 @@ type Interface interface {
 	// CreateOrUpdate creates or updates a LoadBalancer.
 	CreateOrUpdate(ctx context.Context, resourceGroupName string, loadBalancerName string, parameters network.LoadBalancer, etag string) *retry.Error
 
+	// CreateOrUpdateWithGatewayLoadBalancers creates or updates a LoadBalancer
+	// and chains the frontend IP configurations named in gatewayLoadBalancers
+	// to the referenced gateway load balancer frontends.
+	CreateOrUpdateWithGatewayLoadBalancers(ctx context.Context, resourceGroupName string, loadBalancerName string, parameters network.LoadBalancer, gatewayLoadBalancers map[string]string, etag string) *retry.Error
+
+	// UpdateTags updates the tags of a LoadBalancer without touching its
+	// other properties.
+	UpdateTags(ctx context.Context, resourceGroupName string, loadBalancerName string, tags map[string]*string) *retry.Error
+
+	// CreateOrUpdateBackendAddressPool creates or updates the backend address
+	// pool with IP-based members, replacing the existing membership.
+	CreateOrUpdateBackendAddressPool(ctx context.Context, resourceGroupName string, loadBalancerName string, backendPoolName string, addresses []LoadBalancerBackendAddress) *retry.Error
+
 	// Delete deletes a LoadBalancer by name.
 	Delete(ctx context.Context, resourceGroupName string, loadBalancerName string) *retry.Error
 }
@@ -24,6 +24,7 @@ import (
 
 	network "github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
 	gomock "github.com/golang/mock/gomock"
+	loadbalancerclient "k8s.io/legacy-cloud-providers/azure/clients/loadbalancerclient"
 	retry "k8s.io/legacy-cloud-providers/azure/retry"
 )
 
@@ -94,6 +95,48 @@ func (mr *MockInterfaceMockRecorder) CreateOrUpdate(ctx, resourceGroupName, load
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOrUpdate", reflect.TypeOf((*MockInterface)(nil).CreateOrUpdate), ctx, resourceGroupName, loadBalancerName, parameters, etag)
 }
 
+// CreateOrUpdateWithGatewayLoadBalancers mocks base method
+func (m *MockInterface) CreateOrUpdateWithGatewayLoadBalancers(ctx context.Context, resourceGroupName, loadBalancerName string, parameters network.LoadBalancer, gatewayLoadBalancers map[string]string, etag string) *retry.Error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateOrUpdateWithGatewayLoadBalancers", ctx, resourceGroupName, loadBalancerName, parameters, gatewayLoadBalancers, etag)
+	ret0, _ := ret[0].(*retry.Error)
+	return ret0
+}
+
+// CreateOrUpdateWithGatewayLoadBalancers indicates an expected call of CreateOrUpdateWithGatewayLoadBalancers
+func (mr *MockInterfaceMockRecorder) CreateOrUpdateWithGatewayLoadBalancers(ctx, resourceGroupName, loadBalancerName, parameters, gatewayLoadBalancers, etag interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOrUpdateWithGatewayLoadBalancers", reflect.TypeOf((*MockInterface)(nil).CreateOrUpdateWithGatewayLoadBalancers), ctx, resourceGroupName, loadBalancerName, parameters, gatewayLoadBalancers, etag)
+}
+
+// UpdateTags mocks base method
+func (m *MockInterface) UpdateTags(ctx context.Context, resourceGroupName, loadBalancerName string, tags map[string]*string) *retry.Error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateTags", ctx, resourceGroupName, loadBalancerName, tags)
+	ret0, _ := ret[0].(*retry.Error)
+	return ret0
+}
+
+// UpdateTags indicates an expected call of UpdateTags
+func (mr *MockInterfaceMockRecorder) UpdateTags(ctx, resourceGroupName, loadBalancerName, tags interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateTags", reflect.TypeOf((*MockInterface)(nil).UpdateTags), ctx, resourceGroupName, loadBalancerName, tags)
+}
+
+// CreateOrUpdateBackendAddressPool mocks base method
+func (m *MockInterface) CreateOrUpdateBackendAddressPool(ctx context.Context, resourceGroupName, loadBalancerName, backendPoolName string, addresses []loadbalancerclient.LoadBalancerBackendAddress) *retry.Error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateOrUpdateBackendAddressPool", ctx, resourceGroupName, loadBalancerName, backendPoolName, addresses)
+	ret0, _ := ret[0].(*retry.Error)
+	return ret0
+}
+
+// CreateOrUpdateBackendAddressPool indicates an expected call of CreateOrUpdateBackendAddressPool
+func (mr *MockInterfaceMockRecorder) CreateOrUpdateBackendAddressPool(ctx, resourceGroupName, loadBalancerName, backendPoolName, addresses interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOrUpdateBackendAddressPool", reflect.TypeOf((*MockInterface)(nil).CreateOrUpdateBackendAddressPool), ctx, resourceGroupName, loadBalancerName, backendPoolName, addresses)
+}
+
 // Delete mocks base method
 func (m *MockInterface) Delete(ctx context.Context, resourceGroupName, loadBalancerName string) *retry.Error {
 	m.ctrl.T.Helper()
@@ -0,0 +1,137 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package monitorclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/klog/v2"
+	azclients "k8s.io/legacy-cloud-providers/azure/clients"
+	"k8s.io/legacy-cloud-providers/azure/clients/armclient"
+	"k8s.io/legacy-cloud-providers/azure/metrics"
+	"k8s.io/legacy-cloud-providers/azure/retry"
+)
+
+var _ Interface = &Client{}
+
+// Client implements the Azure Monitor metrics client Interface.
+type Client struct {
+	armClient      armclient.Interface
+	subscriptionID string
+
+	// Rate limiting configures.
+	rateLimiterReader flowcontrol.RateLimiter
+	rateLimiterWriter flowcontrol.RateLimiter
+
+	// ARM throttling configures.
+	RetryAfterReader time.Time
+	RetryAfterWriter time.Time
+}
+
+// New creates a new Azure Monitor metrics client with ratelimiting.
+func New(config *azclients.ClientConfig) *Client {
+	baseURI := config.ResourceManagerEndpoint
+	authorizer := config.Authorizer
+	armClient := armclient.New(authorizer, baseURI, config.UserAgent, APIVersion, config.Location, config.Backoff)
+	rateLimiterReader, rateLimiterWriter := azclients.NewRateLimiter(config.RateLimitConfig)
+
+	client := &Client{
+		armClient:         armClient,
+		rateLimiterReader: rateLimiterReader,
+		rateLimiterWriter: rateLimiterWriter,
+		subscriptionID:    config.SubscriptionID,
+	}
+
+	return client
+}
+
+// ListMetrics gets the platform metric values of the resource with the given
+// names, optionally split or filtered by the given dimension filter.
+func (c *Client) ListMetrics(ctx context.Context, resourceURI string, metricNames []string, filter string) (MetricsResponse, *retry.Error) {
+	mc := metrics.NewMetricContext("monitor", "list_metrics", "", c.subscriptionID, "")
+
+	// Report errors if the client is rate limited.
+	if !c.rateLimiterReader.TryAccept() {
+		mc.RateLimitedCount()
+		return MetricsResponse{}, retry.GetRateLimitError(false, "MonitorListMetrics")
+	}
+
+	// Report errors if the client is throttled.
+	if c.RetryAfterReader.After(time.Now()) {
+		mc.ThrottledCount()
+		rerr := retry.GetThrottlingError("MonitorListMetrics", "client throttled", c.RetryAfterReader)
+		return MetricsResponse{}, rerr
+	}
+
+	result, rerr := c.listMetrics(ctx, resourceURI, metricNames, filter)
+	mc.Observe(rerr.Error())
+	if rerr != nil {
+		if rerr.IsThrottled() {
+			// Update RetryAfterReader so that no more requests would be sent until RetryAfter expires.
+			c.RetryAfterReader = rerr.RetryAfter
+		}
+
+		return result, rerr
+	}
+
+	return result, nil
+}
+
+// listMetrics gets the metrics of the resource from the metrics endpoint of
+// the Azure Monitor resource provider.
+func (c *Client) listMetrics(ctx context.Context, resourceURI string, metricNames []string, filter string) (MetricsResponse, *retry.Error) {
+	resourceID := fmt.Sprintf("%s/providers/microsoft.insights/metrics", resourceURI)
+	queryParameters := map[string]interface{}{
+		"metricnames": autorest.Encode("query", strings.Join(metricNames, ",")),
+		"aggregation": autorest.Encode("query", "Average,Maximum,Total"),
+	}
+	if filter != "" {
+		queryParameters["$filter"] = autorest.Encode("query", filter)
+	}
+	decorators := []autorest.PrepareDecorator{
+		autorest.WithQueryParameters(queryParameters),
+	}
+
+	result := MetricsResponse{}
+	response, rerr := c.armClient.GetResourceWithDecorators(ctx, resourceID, decorators)
+	defer c.armClient.CloseResponse(ctx, response)
+	if rerr != nil {
+		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "monitor.listmetrics.request", resourceID, rerr.Error())
+		return result, rerr
+	}
+
+	err := autorest.Respond(
+		response,
+		azure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&result))
+	if err != nil {
+		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "monitor.listmetrics.respond", resourceID, err)
+		return result, retry.GetError(response, err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,79 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package monitorclient
+
+import (
+	"context"
+
+	"k8s.io/legacy-cloud-providers/azure/retry"
+)
+
+const (
+	// APIVersion is the API version for Azure Monitor metrics.
+	APIVersion = "2018-01-01"
+)
+
+// LocalizableString is a string value with its localized form.
+type LocalizableString struct {
+	Value          string `json:"value"`
+	LocalizedValue string `json:"localizedValue,omitempty"`
+}
+
+// MetricValue is one timestamped datapoint of a metric.
+type MetricValue struct {
+	TimeStamp string   `json:"timeStamp"`
+	Average   *float64 `json:"average,omitempty"`
+	Minimum   *float64 `json:"minimum,omitempty"`
+	Maximum   *float64 `json:"maximum,omitempty"`
+	Total     *float64 `json:"total,omitempty"`
+}
+
+// MetadataValue is one dimension name and value pair of a time series.
+type MetadataValue struct {
+	Name  LocalizableString `json:"name"`
+	Value string            `json:"value"`
+}
+
+// TimeSeriesElement is one time series of a metric, qualified by its
+// dimension values.
+type TimeSeriesElement struct {
+	MetadataValues []MetadataValue `json:"metadatavalues,omitempty"`
+	Data           []MetricValue   `json:"data,omitempty"`
+}
+
+// Metric is one platform metric of the queried resource.
+type Metric struct {
+	Name       LocalizableString   `json:"name"`
+	Unit       string              `json:"unit,omitempty"`
+	Timeseries []TimeSeriesElement `json:"timeseries,omitempty"`
+}
+
+// MetricsResponse is the response of a metrics list call.
+type MetricsResponse struct {
+	Value []Metric `json:"value"`
+}
+
+// Interface is the client interface for Azure Monitor metrics.
+// Don't forget to run the following command to generate the mock client:
+// mockgen -source=$GOPATH/src/k8s.io/kubernetes/staging/src/k8s.io/legacy-cloud-providers/azure/clients/monitorclient/interface.go -package=mockmonitorclient Interface > $GOPATH/src/k8s.io/kubernetes/staging/src/k8s.io/legacy-cloud-providers/azure/clients/monitorclient/mockmonitorclient/interface.go
+type Interface interface {
+	// ListMetrics gets the platform metric values of the resource with the
+	// given names, optionally split or filtered by the given dimension filter.
+	ListMetrics(ctx context.Context, resourceURI string, metricNames []string, filter string) (MetricsResponse, *retry.Error)
+}
@@ -0,0 +1,65 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mockmonitorclient
+
+import (
+	context "context"
+	gomock "github.com/golang/mock/gomock"
+	monitorclient "k8s.io/legacy-cloud-providers/azure/clients/monitorclient"
+	retry "k8s.io/legacy-cloud-providers/azure/retry"
+	reflect "reflect"
+)
+
+// MockInterface is a mock of Interface interface
+type MockInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockInterfaceMockRecorder
+}
+
+// MockInterfaceMockRecorder is the mock recorder for MockInterface
+type MockInterfaceMockRecorder struct {
+	mock *MockInterface
+}
+
+// NewMockInterface creates a new mock instance
+func NewMockInterface(ctrl *gomock.Controller) *MockInterface {
+	mock := &MockInterface{ctrl: ctrl}
+	mock.recorder = &MockInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockInterface) EXPECT() *MockInterfaceMockRecorder {
+	return m.recorder
+}
+
+// ListMetrics mocks base method
+func (m *MockInterface) ListMetrics(ctx context.Context, resourceURI string, metricNames []string, filter string) (monitorclient.MetricsResponse, *retry.Error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListMetrics", ctx, resourceURI, metricNames, filter)
+	ret0, _ := ret[0].(monitorclient.MetricsResponse)
+	ret1, _ := ret[1].(*retry.Error)
+	return ret0, ret1
+}
+
+// ListMetrics indicates an expected call of ListMetrics
+func (mr *MockInterfaceMockRecorder) ListMetrics(ctx, resourceURI, metricNames, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListMetrics", reflect.TypeOf((*MockInterface)(nil).ListMetrics), ctx, resourceURI, metricNames, filter)
+}
@@ -0,0 +1,140 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package networkwatcherclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	azclients "k8s.io/legacy-cloud-providers/azure/clients"
+	"k8s.io/legacy-cloud-providers/azure/clients/armclient"
+	"k8s.io/legacy-cloud-providers/azure/clients/armclient/mockarmclient"
+	"k8s.io/legacy-cloud-providers/azure/retry"
+)
+
+const testWatcherResourceID = "/subscriptions/subscriptionID/resourceGroups/rg/providers/Microsoft.Network/networkWatchers/nw"
+
+func TestNew(t *testing.T) {
+	config := &azclients.ClientConfig{
+		SubscriptionID:          "sub",
+		ResourceManagerEndpoint: "endpoint",
+		Location:                "eastus",
+		RateLimitConfig: &azclients.RateLimitConfig{
+			CloudProviderRateLimit:            true,
+			CloudProviderRateLimitQPS:         0.5,
+			CloudProviderRateLimitBucket:      1,
+			CloudProviderRateLimitQPSWrite:    0.5,
+			CloudProviderRateLimitBucketWrite: 1,
+		},
+		Backoff: &retry.Backoff{Steps: 1},
+	}
+
+	watcherClient := New(config)
+	assert.Equal(t, "sub", watcherClient.subscriptionID)
+	assert.NotEmpty(t, watcherClient.rateLimiterReader)
+	assert.NotEmpty(t, watcherClient.rateLimiterWriter)
+}
+
+func TestGetFlowLogStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	flowLogInfo := network.FlowLogInformation{
+		TargetResourceID: to.StringPtr("nsgID"),
+		FlowLogProperties: &network.FlowLogProperties{
+			Enabled: to.BoolPtr(true),
+		},
+	}
+	responseBody, err := json.Marshal(flowLogInfo)
+	assert.Nil(t, err)
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().PostResource(gomock.Any(), testWatcherResourceID, "queryFlowLogStatus", gomock.Any()).Return(
+		&http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewReader(responseBody)),
+		}, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	watcherClient := getTestNetworkWatcherClient(armClient)
+	result, rerr := watcherClient.GetFlowLogStatus(context.TODO(), "rg", "nw", "nsgID")
+	assert.Nil(t, rerr)
+	assert.Equal(t, "nsgID", to.String(result.TargetResourceID))
+	assert.True(t, to.Bool(result.Enabled))
+}
+
+func TestSetFlowLogConfiguration(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	flowLogInfo := network.FlowLogInformation{
+		TargetResourceID: to.StringPtr("nsgID"),
+		FlowLogProperties: &network.FlowLogProperties{
+			Enabled:   to.BoolPtr(true),
+			StorageID: to.StringPtr("storageID"),
+		},
+	}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().PostResource(gomock.Any(), testWatcherResourceID, "configureFlowLog", flowLogInfo).Return(
+		&http.Response{
+			StatusCode: http.StatusAccepted,
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(""))),
+		}, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	watcherClient := getTestNetworkWatcherClient(armClient)
+	rerr := watcherClient.SetFlowLogConfiguration(context.TODO(), "rg", "nw", flowLogInfo)
+	assert.Nil(t, rerr)
+}
+
+func TestSetFlowLogConfigurationInternalError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().PostResource(gomock.Any(), testWatcherResourceID, "configureFlowLog", gomock.Any()).Return(
+		&http.Response{
+			StatusCode: http.StatusInternalServerError,
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte("{}"))),
+		}, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	watcherClient := getTestNetworkWatcherClient(armClient)
+	rerr := watcherClient.SetFlowLogConfiguration(context.TODO(), "rg", "nw", network.FlowLogInformation{})
+	assert.NotNil(t, rerr)
+	assert.Equal(t, http.StatusInternalServerError, rerr.HTTPStatusCode)
+}
+
+func getTestNetworkWatcherClient(armClient armclient.Interface) *Client {
+	rateLimiterReader, rateLimiterWriter := azclients.NewRateLimiter(&azclients.RateLimitConfig{})
+	return &Client{
+		armClient:         armClient,
+		subscriptionID:    "subscriptionID",
+		rateLimiterReader: rateLimiterReader,
+		rateLimiterWriter: rateLimiterWriter,
+	}
+}
@@ -0,0 +1,42 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package networkwatcherclient
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"k8s.io/legacy-cloud-providers/azure/retry"
+)
+
+const (
+	// APIVersion is the API version for network.
+	APIVersion = "2019-06-01"
+)
+
+// Interface is the client interface for NetworkWatchers.
+// Don't forget to run the following command to generate the mock client:
+// mockgen -source=$GOPATH/src/k8s.io/kubernetes/staging/src/k8s.io/legacy-cloud-providers/azure/clients/networkwatcherclient/interface.go -package=mocknetworkwatcherclient Interface > $GOPATH/src/k8s.io/kubernetes/staging/src/k8s.io/legacy-cloud-providers/azure/clients/networkwatcherclient/mocknetworkwatcherclient/interface.go
+type Interface interface {
+	// GetFlowLogStatus gets the flow log configuration of the target resource.
+	GetFlowLogStatus(ctx context.Context, resourceGroupName string, networkWatcherName string, targetResourceID string) (network.FlowLogInformation, *retry.Error)
+
+	// SetFlowLogConfiguration configures flow logging on the target resource.
+	SetFlowLogConfiguration(ctx context.Context, resourceGroupName string, networkWatcherName string, parameters network.FlowLogInformation) *retry.Error
+}
@@ -0,0 +1,79 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mocknetworkwatcherclient
+
+import (
+	context "context"
+	network "github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	gomock "github.com/golang/mock/gomock"
+	retry "k8s.io/legacy-cloud-providers/azure/retry"
+	reflect "reflect"
+)
+
+// MockInterface is a mock of Interface interface
+type MockInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockInterfaceMockRecorder
+}
+
+// MockInterfaceMockRecorder is the mock recorder for MockInterface
+type MockInterfaceMockRecorder struct {
+	mock *MockInterface
+}
+
+// NewMockInterface creates a new mock instance
+func NewMockInterface(ctrl *gomock.Controller) *MockInterface {
+	mock := &MockInterface{ctrl: ctrl}
+	mock.recorder = &MockInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockInterface) EXPECT() *MockInterfaceMockRecorder {
+	return m.recorder
+}
+
+// GetFlowLogStatus mocks base method
+func (m *MockInterface) GetFlowLogStatus(ctx context.Context, resourceGroupName, networkWatcherName, targetResourceID string) (network.FlowLogInformation, *retry.Error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFlowLogStatus", ctx, resourceGroupName, networkWatcherName, targetResourceID)
+	ret0, _ := ret[0].(network.FlowLogInformation)
+	ret1, _ := ret[1].(*retry.Error)
+	return ret0, ret1
+}
+
+// GetFlowLogStatus indicates an expected call of GetFlowLogStatus
+func (mr *MockInterfaceMockRecorder) GetFlowLogStatus(ctx, resourceGroupName, networkWatcherName, targetResourceID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFlowLogStatus", reflect.TypeOf((*MockInterface)(nil).GetFlowLogStatus), ctx, resourceGroupName, networkWatcherName, targetResourceID)
+}
+
+// SetFlowLogConfiguration mocks base method
+func (m *MockInterface) SetFlowLogConfiguration(ctx context.Context, resourceGroupName, networkWatcherName string, parameters network.FlowLogInformation) *retry.Error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetFlowLogConfiguration", ctx, resourceGroupName, networkWatcherName, parameters)
+	ret0, _ := ret[0].(*retry.Error)
+	return ret0
+}
+
+// SetFlowLogConfiguration indicates an expected call of SetFlowLogConfiguration
+func (mr *MockInterfaceMockRecorder) SetFlowLogConfiguration(ctx, resourceGroupName, networkWatcherName, parameters interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetFlowLogConfiguration", reflect.TypeOf((*MockInterface)(nil).SetFlowLogConfiguration), ctx, resourceGroupName, networkWatcherName, parameters)
+}
@@ -344,6 +344,70 @@ func (c *Client) createOrUpdateResponder(resp *http.Response) (*network.PublicIP
 	return result, retry.GetError(resp, err)
 }
 
+// UpdateTags updates the tags of a PublicIPAddress without touching its other
+// properties.
+func (c *Client) UpdateTags(ctx context.Context, resourceGroupName string, publicIPAddressName string, tags map[string]*string) *retry.Error {
+	mc := metrics.NewMetricContext("public_ip_addresses", "update_tags", resourceGroupName, c.subscriptionID, "")
+
+	// Report errors if the client is rate limited.
+	if !c.rateLimiterWriter.TryAccept() {
+		mc.RateLimitedCount()
+		return retry.GetRateLimitError(true, "PublicIPUpdateTags")
+	}
+
+	// Report errors if the client is throttled.
+	if c.RetryAfterWriter.After(time.Now()) {
+		mc.ThrottledCount()
+		rerr := retry.GetThrottlingError("PublicIPUpdateTags", "client throttled", c.RetryAfterWriter)
+		return rerr
+	}
+
+	rerr := c.updatePublicIPTags(ctx, resourceGroupName, publicIPAddressName, tags)
+	mc.Observe(rerr.Error())
+	if rerr != nil {
+		if rerr.IsThrottled() {
+			// Update RetryAfterReader so that no more requests would be sent until RetryAfter expires.
+			c.RetryAfterWriter = rerr.RetryAfter
+		}
+
+		return rerr
+	}
+
+	return nil
+}
+
+// updatePublicIPTags patches the tags of a PublicIPAddress.
+func (c *Client) updatePublicIPTags(ctx context.Context, resourceGroupName string, publicIPAddressName string, tags map[string]*string) *retry.Error {
+	resourceID := armclient.GetResourceID(
+		c.subscriptionID,
+		resourceGroupName,
+		"Microsoft.Network/publicIPAddresses",
+		publicIPAddressName,
+	)
+	parameters := struct {
+		Tags map[string]*string `json:"tags"`
+	}{
+		Tags: tags,
+	}
+
+	response, rerr := c.armClient.PatchResource(ctx, resourceID, parameters)
+	defer c.armClient.CloseResponse(ctx, response)
+	if rerr != nil {
+		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "publicip.patch.request", resourceID, rerr.Error())
+		return rerr
+	}
+
+	if response != nil && response.StatusCode != http.StatusNoContent {
+		_, rerr = c.createOrUpdateResponder(response)
+		if rerr != nil {
+			klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "publicip.patch.respond", resourceID, rerr.Error())
+			return rerr
+		}
+	}
+
+	return nil
+}
+
 // Delete deletes a PublicIPAddress by name.
 func (c *Client) Delete(ctx context.Context, resourceGroupName string, publicIPAddressName string) *retry.Error {
 	mc := metrics.NewMetricContext("public_ip_addresses", "delete", resourceGroupName, c.subscriptionID, "")
@@ -49,6 +49,10 @@ type Interface interface {
 	// CreateOrUpdate creates or updates a PublicIPAddress.
 	CreateOrUpdate(ctx context.Context, resourceGroupName string, publicIPAddressName string, parameters network.PublicIPAddress) *retry.Error
 
+	// UpdateTags updates the tags of a PublicIPAddress without touching its
+	// other properties.
+	UpdateTags(ctx context.Context, resourceGroupName string, publicIPAddressName string, tags map[string]*string) *retry.Error
+
 	// Delete deletes a PublicIPAddress by name.
 	Delete(ctx context.Context, resourceGroupName string, publicIPAddressName string) *retry.Error
 }
@@ -109,6 +109,20 @@ func (mr *MockInterfaceMockRecorder) CreateOrUpdate(ctx, resourceGroupName, publ
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOrUpdate", reflect.TypeOf((*MockInterface)(nil).CreateOrUpdate), ctx, resourceGroupName, publicIPAddressName, parameters)
 }
 
+// UpdateTags mocks base method
+func (m *MockInterface) UpdateTags(ctx context.Context, resourceGroupName, publicIPAddressName string, tags map[string]*string) *retry.Error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateTags", ctx, resourceGroupName, publicIPAddressName, tags)
+	ret0, _ := ret[0].(*retry.Error)
+	return ret0
+}
+
+// UpdateTags indicates an expected call of UpdateTags
+func (mr *MockInterfaceMockRecorder) UpdateTags(ctx, resourceGroupName, publicIPAddressName, tags interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateTags", reflect.TypeOf((*MockInterface)(nil).UpdateTags), ctx, resourceGroupName, publicIPAddressName, tags)
+}
+
 // Delete mocks base method
 func (m *MockInterface) Delete(ctx context.Context, resourceGroupName, publicIPAddressName string) *retry.Error {
 	m.ctrl.T.Helper()
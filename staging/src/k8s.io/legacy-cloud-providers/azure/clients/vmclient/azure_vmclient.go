@@ -138,6 +138,75 @@ func (c *Client) getVM(ctx context.Context, resourceGroupName string, VMName str
 	return result, nil
 }
 
+// GetSecurityProfile gets the securityProfile of a VirtualMachine.
+func (c *Client) GetSecurityProfile(ctx context.Context, resourceGroupName string, VMName string) (*SecurityProfile, *retry.Error) {
+	mc := metrics.NewMetricContext("vm", "get_security_profile", resourceGroupName, c.subscriptionID, "")
+
+	// Report errors if the client is rate limited.
+	if !c.rateLimiterReader.TryAccept() {
+		mc.RateLimitedCount()
+		return nil, retry.GetRateLimitError(false, "VMGetSecurityProfile")
+	}
+
+	// Report errors if the client is throttled.
+	if c.RetryAfterReader.After(time.Now()) {
+		mc.ThrottledCount()
+		rerr := retry.GetThrottlingError("VMGetSecurityProfile", "client throttled", c.RetryAfterReader)
+		return nil, rerr
+	}
+
+	result, rerr := c.getVMSecurityProfile(ctx, resourceGroupName, VMName)
+	mc.Observe(rerr.Error())
+	if rerr != nil {
+		if rerr.IsThrottled() {
+			// Update RetryAfterReader so that no more requests would be sent until RetryAfter expires.
+			c.RetryAfterReader = rerr.RetryAfter
+		}
+
+		return result, rerr
+	}
+
+	return result, nil
+}
+
+// getVMSecurityProfile gets the securityProfile block of a VirtualMachine
+// with a compute API version that understands trusted launch and confidential
+// VMs.
+func (c *Client) getVMSecurityProfile(ctx context.Context, resourceGroupName string, VMName string) (*SecurityProfile, *retry.Error) {
+	resourceID := armclient.GetResourceID(
+		c.subscriptionID,
+		resourceGroupName,
+		"Microsoft.Compute/virtualMachines",
+		VMName,
+	)
+
+	decorators := []autorest.PrepareDecorator{
+		autorest.WithQueryParameters(map[string]interface{}{"api-version": SecurityProfileAPIVersion}),
+	}
+	response, rerr := c.armClient.GetResourceWithDecorators(ctx, resourceID, decorators)
+	defer c.armClient.CloseResponse(ctx, response)
+	if rerr != nil {
+		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "vm.get.request", resourceID, rerr.Error())
+		return nil, rerr
+	}
+
+	result := struct {
+		Properties struct {
+			SecurityProfile *SecurityProfile `json:"securityProfile,omitempty"`
+		} `json:"properties"`
+	}{}
+	err := autorest.Respond(
+		response,
+		azure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&result))
+	if err != nil {
+		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "vm.get.respond", resourceID, err)
+		return nil, retry.GetError(response, err)
+	}
+
+	return result.Properties.SecurityProfile, nil
+}
+
 // List gets a list of VirtualMachine in the resourceGroupName.
 func (c *Client) List(ctx context.Context, resourceGroupName string) ([]compute.VirtualMachine, *retry.Error) {
 	mc := metrics.NewMetricContext("vm", "list", resourceGroupName, c.subscriptionID, "")
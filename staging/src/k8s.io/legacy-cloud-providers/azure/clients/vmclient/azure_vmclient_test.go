@@ -755,3 +755,47 @@ func getTestVMClientWithRetryAfterReader(armClient armclient.Interface) *Client
 func getFutureTime() time.Time {
 	return time.Unix(3000000000, 0)
 }
+
+func TestGetSecurityProfile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	resourceID := "/subscriptions/subscriptionID/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm1"
+	responseBody := `{"properties":{"securityProfile":{"securityType":"TrustedLaunch","uefiSettings":{"secureBootEnabled":true,"vTpmEnabled":true}}}}`
+	response := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(responseBody))),
+	}
+
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().GetResourceWithDecorators(gomock.Any(), resourceID, gomock.Any()).Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	vmClient := getTestVMClient(armClient)
+	profile, rerr := vmClient.GetSecurityProfile(context.TODO(), "rg", "vm1")
+	assert.Nil(t, rerr)
+	assert.NotNil(t, profile)
+	assert.Equal(t, "TrustedLaunch", profile.SecurityType)
+	assert.NotNil(t, profile.UefiSettings)
+	assert.Equal(t, true, *profile.UefiSettings.SecureBootEnabled)
+}
+
+func TestGetSecurityProfileNotSet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	resourceID := "/subscriptions/subscriptionID/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm1"
+	response := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"properties":{}}`))),
+	}
+
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().GetResourceWithDecorators(gomock.Any(), resourceID, gomock.Any()).Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	vmClient := getTestVMClient(armClient)
+	profile, rerr := vmClient.GetSecurityProfile(context.TODO(), "rg", "vm1")
+	assert.Nil(t, rerr)
+	assert.Nil(t, profile)
+}
@@ -28,8 +28,29 @@ import (
 const (
 	// APIVersion is the API version for VirtualMachine.
 	APIVersion = "2019-07-01"
+
+	// SecurityProfileAPIVersion is the API version used to read the
+	// securityProfile of a VirtualMachine. The vendored compute models
+	// predate trusted launch and confidential VMs and drop the block when
+	// parsing, so it is fetched with a newer version on the wire.
+	SecurityProfileAPIVersion = "2020-12-01"
 )
 
+// UefiSettings represents the UEFI settings of a trusted launch or
+// confidential VirtualMachine.
+type UefiSettings struct {
+	SecureBootEnabled *bool `json:"secureBootEnabled,omitempty"`
+	VTpmEnabled       *bool `json:"vTpmEnabled,omitempty"`
+}
+
+// SecurityProfile mirrors the securityProfile block of compute API versions
+// newer than the vendored models.
+type SecurityProfile struct {
+	UefiSettings     *UefiSettings `json:"uefiSettings,omitempty"`
+	EncryptionAtHost *bool         `json:"encryptionAtHost,omitempty"`
+	SecurityType     string        `json:"securityType,omitempty"`
+}
+
 // Interface is the client interface for VirtualMachines.
 // Don't forget to run the following command to generate the mock client:
 // mockgen -source=$GOPATH/src/k8s.io/kubernetes/staging/src/k8s.io/legacy-cloud-providers/azure/clients/vmclient/interface.go -package=mockvmclient Interface > $GOPATH/src/k8s.io/kubernetes/staging/src/k8s.io/legacy-cloud-providers/azure/clients/vmclient/mockvmclient/interface.go
@@ -37,6 +58,10 @@ type Interface interface {
 	// Get gets a VirtualMachine.
 	Get(ctx context.Context, resourceGroupName string, VMName string, expand compute.InstanceViewTypes) (compute.VirtualMachine, *retry.Error)
 
+	// GetSecurityProfile gets the securityProfile of a VirtualMachine. It is
+	// nil for VMs without one.
+	GetSecurityProfile(ctx context.Context, resourceGroupName string, VMName string) (*SecurityProfile, *retry.Error)
+
 	// List gets a list of VirtualMachines in the resourceGroupName.
 	List(ctx context.Context, resourceGroupName string) ([]compute.VirtualMachine, *retry.Error)
 
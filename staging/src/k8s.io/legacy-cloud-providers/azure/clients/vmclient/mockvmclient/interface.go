@@ -24,6 +24,7 @@ import (
 
 	compute "github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-12-01/compute"
 	gomock "github.com/golang/mock/gomock"
+	vmclient "k8s.io/legacy-cloud-providers/azure/clients/vmclient"
 	retry "k8s.io/legacy-cloud-providers/azure/retry"
 )
 
@@ -65,6 +66,21 @@ func (mr *MockInterfaceMockRecorder) Get(ctx, resourceGroupName, VMName, expand
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockInterface)(nil).Get), ctx, resourceGroupName, VMName, expand)
 }
 
+// GetSecurityProfile mocks base method
+func (m *MockInterface) GetSecurityProfile(ctx context.Context, resourceGroupName, VMName string) (*vmclient.SecurityProfile, *retry.Error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSecurityProfile", ctx, resourceGroupName, VMName)
+	ret0, _ := ret[0].(*vmclient.SecurityProfile)
+	ret1, _ := ret[1].(*retry.Error)
+	return ret0, ret1
+}
+
+// GetSecurityProfile indicates an expected call of GetSecurityProfile
+func (mr *MockInterfaceMockRecorder) GetSecurityProfile(ctx, resourceGroupName, VMName interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSecurityProfile", reflect.TypeOf((*MockInterface)(nil).GetSecurityProfile), ctx, resourceGroupName, VMName)
+}
+
 // List mocks base method
 func (m *MockInterface) List(ctx context.Context, resourceGroupName string) ([]compute.VirtualMachine, *retry.Error) {
 	m.ctrl.T.Helper()
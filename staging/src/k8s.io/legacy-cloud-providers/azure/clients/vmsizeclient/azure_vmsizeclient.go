@@ -27,6 +27,7 @@ import (
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-12-01/compute"
 	"github.com/Azure/go-autorest/autorest"
 	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/to"
 
 	"k8s.io/client-go/util/flowcontrol"
 	"k8s.io/klog/v2"
@@ -134,3 +135,162 @@ func (c *Client) listVirtualMachineSizes(ctx context.Context, location string) (
 	result.Response = autorest.Response{Response: response}
 	return result, nil
 }
+
+// ListSkus gets the compute resource SKUs of the subscription together with
+// their capabilities.
+func (c *Client) ListSkus(ctx context.Context) ([]compute.ResourceSku, *retry.Error) {
+	mc := metrics.NewMetricContext("vmsizes", "list_skus", "", c.subscriptionID, "")
+
+	// Report errors if the client is rate limited.
+	if !c.rateLimiterReader.TryAccept() {
+		mc.RateLimitedCount()
+		return nil, retry.GetRateLimitError(false, "VMSkusList")
+	}
+
+	// Report errors if the client is throttled.
+	if c.RetryAfterReader.After(time.Now()) {
+		mc.ThrottledCount()
+		rerr := retry.GetThrottlingError("VMSkusList", "client throttled", c.RetryAfterReader)
+		return nil, rerr
+	}
+
+	result, rerr := c.listResourceSkus(ctx)
+	mc.Observe(rerr.Error())
+	if rerr != nil {
+		if rerr.IsThrottled() {
+			// Update RetryAfterReader so that no more requests would be sent until RetryAfter expires.
+			c.RetryAfterReader = rerr.RetryAfter
+		}
+
+		return result, rerr
+	}
+
+	return result, nil
+}
+
+// listResourceSkus gets a list of compute.ResourceSku of the subscription.
+// The resource SKUs API has its own version, so it is set per request.
+func (c *Client) listResourceSkus(ctx context.Context) ([]compute.ResourceSku, *retry.Error) {
+	resourceID := fmt.Sprintf("/subscriptions/%s/providers/Microsoft.Compute/skus",
+		autorest.Encode("path", c.subscriptionID))
+	result := make([]compute.ResourceSku, 0)
+	page := &ResourceSkusResultPage{}
+	page.fn = c.listSkusNextResults
+
+	decorators := []autorest.PrepareDecorator{
+		autorest.WithQueryParameters(map[string]interface{}{"api-version": SkusAPIVersion}),
+	}
+	resp, rerr := c.armClient.GetResourceWithDecorators(ctx, resourceID, decorators)
+	defer c.armClient.CloseResponse(ctx, resp)
+	if rerr != nil {
+		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "vmskus.list.request", resourceID, rerr.Error())
+		return result, rerr
+	}
+
+	var err error
+	page.rsr, err = c.listSkusResponder(resp)
+	if err != nil {
+		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "vmskus.list.respond", resourceID, err)
+		return result, retry.GetError(resp, err)
+	}
+
+	for page.NotDone() {
+		result = append(result, *page.Response().Value...)
+		if err = page.NextWithContext(ctx); err != nil {
+			klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "vmskus.list.next", resourceID, err)
+			return result, retry.GetError(page.Response().Response.Response, err)
+		}
+	}
+
+	return result, nil
+}
+
+func (c *Client) listSkusResponder(resp *http.Response) (result compute.ResourceSkusResult, err error) {
+	err = autorest.Respond(
+		resp,
+		autorest.ByIgnoring(),
+		azure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&result))
+	result.Response = autorest.Response{Response: resp}
+	return
+}
+
+// resourceSkusResultPreparer prepares a request to retrieve the next set of results.
+// It returns nil if no more results exist.
+func (c *Client) resourceSkusResultPreparer(ctx context.Context, rsr compute.ResourceSkusResult) (*http.Request, error) {
+	if rsr.NextLink == nil || len(to.String(rsr.NextLink)) < 1 {
+		return nil, nil
+	}
+
+	decorators := []autorest.PrepareDecorator{
+		autorest.WithBaseURL(to.String(rsr.NextLink)),
+	}
+	return c.armClient.PrepareGetRequest(ctx, decorators...)
+}
+
+// listSkusNextResults retrieves the next set of results, if any.
+func (c *Client) listSkusNextResults(ctx context.Context, lastResults compute.ResourceSkusResult) (result compute.ResourceSkusResult, err error) {
+	req, err := c.resourceSkusResultPreparer(ctx, lastResults)
+	if err != nil {
+		return result, autorest.NewErrorWithError(err, "vmsizeclient", "listSkusNextResults", nil, "Failure preparing next results request")
+	}
+	if req == nil {
+		return
+	}
+
+	resp, rerr := c.armClient.Send(ctx, req)
+	defer c.armClient.CloseResponse(ctx, resp)
+	if rerr != nil {
+		result.Response = autorest.Response{Response: resp}
+		return result, autorest.NewErrorWithError(rerr.Error(), "vmsizeclient", "listSkusNextResults", resp, "Failure sending next results request")
+	}
+
+	result, err = c.listSkusResponder(resp)
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "vmsizeclient", "listSkusNextResults", resp, "Failure responding to next results request")
+	}
+
+	return
+}
+
+// ResourceSkusResultPage contains a page of ResourceSku values.
+type ResourceSkusResultPage struct {
+	fn  func(context.Context, compute.ResourceSkusResult) (compute.ResourceSkusResult, error)
+	rsr compute.ResourceSkusResult
+}
+
+// NextWithContext advances to the next page of values.  If there was an error making
+// the request the page does not advance and the error is returned.
+func (page *ResourceSkusResultPage) NextWithContext(ctx context.Context) (err error) {
+	next, err := page.fn(ctx, page.rsr)
+	if err != nil {
+		return err
+	}
+	page.rsr = next
+	return nil
+}
+
+// Next advances to the next page of values.  If there was an error making
+// the request the page does not advance and the error is returned.
+// Deprecated: Use NextWithContext() instead.
+func (page *ResourceSkusResultPage) Next() error {
+	return page.NextWithContext(context.Background())
+}
+
+// NotDone returns true if the page enumeration should be started or is not yet complete.
+func (page ResourceSkusResultPage) NotDone() bool {
+	return !page.rsr.IsEmpty()
+}
+
+// Response returns the raw server response from the last page request.
+func (page ResourceSkusResultPage) Response() compute.ResourceSkusResult {
+	return page.rsr
+}
+
+// Values returns the slice of values for the current page or nil if there are no values.
+func (page ResourceSkusResultPage) Values() []compute.ResourceSku {
+	if page.rsr.IsEmpty() {
+		return nil
+	}
+	return *page.rsr.Value
+}
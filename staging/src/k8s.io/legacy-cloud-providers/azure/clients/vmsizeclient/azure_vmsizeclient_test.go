@@ -188,6 +188,48 @@ func TestListRetryAfterReader(t *testing.T) {
 	assert.Equal(t, vmsizeListErr, rerr)
 }
 
+func TestListSkus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	resourceID := "/subscriptions/subscriptionID/providers/Microsoft.Compute/skus"
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	skuList := []compute.ResourceSku{getTestResourceSku("Standard_NC6"), getTestResourceSku("Standard_D2s_v3")}
+	responseBody, err := json.Marshal(compute.ResourceSkusResult{Value: &skuList})
+	assert.Nil(t, err)
+	armClient.EXPECT().GetResourceWithDecorators(gomock.Any(), resourceID, gomock.Any()).Return(
+		&http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewReader(responseBody)),
+		}, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	vmsizeClient := getTestVMSizeClient(armClient)
+	result, rerr := vmsizeClient.ListSkus(context.TODO())
+	assert.Nil(t, rerr)
+	assert.Equal(t, 2, len(result))
+}
+
+func TestListSkusNotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	resourceID := "/subscriptions/subscriptionID/providers/Microsoft.Compute/skus"
+	response := &http.Response{
+		StatusCode: http.StatusNotFound,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte("{}"))),
+	}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().GetResourceWithDecorators(gomock.Any(), resourceID, gomock.Any()).Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	vmsizeClient := getTestVMSizeClient(armClient)
+	result, rerr := vmsizeClient.ListSkus(context.TODO())
+	assert.Equal(t, []compute.ResourceSku{}, result)
+	assert.NotNil(t, rerr)
+	assert.Equal(t, http.StatusNotFound, rerr.HTTPStatusCode)
+}
+
 func getTestVMSizeClient(armClient armclient.Interface) *Client {
 	rateLimiterReader, rateLimiterWriter := azclients.NewRateLimiter(&azclients.RateLimitConfig{})
 	return &Client{
@@ -204,6 +246,13 @@ func getTestVMSize(name string) compute.VirtualMachineSize {
 	}
 }
 
+func getTestResourceSku(name string) compute.ResourceSku {
+	return compute.ResourceSku{
+		Name:         to.StringPtr(name),
+		ResourceType: to.StringPtr("virtualMachines"),
+	}
+}
+
 func getTestVMSizeClientWithNeverRateLimiter(armClient armclient.Interface) *Client {
 	rateLimiterReader := flowcontrol.NewFakeNeverRateLimiter()
 	rateLimiterWriter := flowcontrol.NewFakeNeverRateLimiter()
@@ -28,6 +28,9 @@ import (
 const (
 	// APIVersion is the API version for compute.
 	APIVersion = "2019-07-01"
+
+	// SkusAPIVersion is the API version for compute resource SKUs.
+	SkusAPIVersion = "2019-04-01"
 )
 
 // Interface is the client interface for VirtualMachineSizes.
@@ -36,4 +39,8 @@ const (
 type Interface interface {
 	// List gets compute.VirtualMachineSizeListResult.
 	List(ctx context.Context, location string) (result compute.VirtualMachineSizeListResult, rerr *retry.Error)
+
+	// ListSkus gets the compute resource SKUs of the subscription together
+	// with their capabilities.
+	ListSkus(ctx context.Context) (result []compute.ResourceSku, rerr *retry.Error)
 }
@@ -63,3 +63,18 @@ func (mr *MockInterfaceMockRecorder) List(ctx, location interface{}) *gomock.Cal
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockInterface)(nil).List), ctx, location)
 }
+
+// ListSkus mocks base method
+func (m *MockInterface) ListSkus(ctx context.Context) ([]compute.ResourceSku, *retry.Error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListSkus", ctx)
+	ret0, _ := ret[0].([]compute.ResourceSku)
+	ret1, _ := ret[1].(*retry.Error)
+	return ret0, ret1
+}
+
+// ListSkus indicates an expected call of ListSkus
+func (mr *MockInterfaceMockRecorder) ListSkus(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListSkus", reflect.TypeOf((*MockInterface)(nil).ListSkus), ctx)
+}
@@ -635,6 +635,29 @@ func TestWaitForAsyncOperationResult(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestUpdateInstances(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	r := getTestVMSS("vmss1")
+	vmInstanceIDs := compute.VirtualMachineScaleSetVMInstanceRequiredIDs{
+		InstanceIds: &[]string{"0", "1", "2"},
+	}
+	response := &http.Response{
+		StatusCode: http.StatusOK,
+		Request:    &http.Request{Method: "POST"},
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte("{}"))),
+	}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().PostResource(gomock.Any(), to.String(r.ID), "manualupgrade", vmInstanceIDs).Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+	armClient.EXPECT().WaitForAsyncOperationCompletion(gomock.Any(), gomock.Any(), "vmssclient.UpdateInstances").Return(nil).Times(1)
+
+	client := getTestVMSSClient(armClient)
+	rerr := client.UpdateInstances(context.TODO(), "rg", "vmss1", vmInstanceIDs)
+	assert.Nil(t, rerr)
+}
+
 func TestDeleteInstances(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -52,6 +52,9 @@ type Interface interface {
 	// WaitForAsyncOperationResult waits for the response of the request
 	WaitForAsyncOperationResult(ctx context.Context, future *azure.Future) (*http.Response, error)
 
+	// UpdateInstances upgrades the instances of a VirtualMachineScaleSet to the latest scale set model.
+	UpdateInstances(ctx context.Context, resourceGroupName string, vmScaleSetName string, vmInstanceIDs compute.VirtualMachineScaleSetVMInstanceRequiredIDs) *retry.Error
+
 	// DeleteInstances deletes the instances for a VirtualMachineScaleSet.
 	DeleteInstances(ctx context.Context, resourceGroupName string, vmScaleSetName string, vmInstanceIDs compute.VirtualMachineScaleSetVMInstanceRequiredIDs) *retry.Error
 
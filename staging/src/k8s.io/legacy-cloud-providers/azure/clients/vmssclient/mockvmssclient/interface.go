@@ -126,6 +126,20 @@ func (mr *MockInterfaceMockRecorder) WaitForAsyncOperationResult(ctx, future int
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WaitForAsyncOperationResult", reflect.TypeOf((*MockInterface)(nil).WaitForAsyncOperationResult), ctx, future)
 }
 
+// UpdateInstances mocks base method
+func (m *MockInterface) UpdateInstances(ctx context.Context, resourceGroupName, vmScaleSetName string, vmInstanceIDs compute.VirtualMachineScaleSetVMInstanceRequiredIDs) *retry.Error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateInstances", ctx, resourceGroupName, vmScaleSetName, vmInstanceIDs)
+	ret0, _ := ret[0].(*retry.Error)
+	return ret0
+}
+
+// UpdateInstances indicates an expected call of UpdateInstances
+func (mr *MockInterfaceMockRecorder) UpdateInstances(ctx, resourceGroupName, vmScaleSetName, vmInstanceIDs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateInstances", reflect.TypeOf((*MockInterface)(nil).UpdateInstances), ctx, resourceGroupName, vmScaleSetName, vmInstanceIDs)
+}
+
 // DeleteInstances mocks base method
 func (m *MockInterface) DeleteInstances(ctx context.Context, resourceGroupName, vmScaleSetName string, vmInstanceIDs compute.VirtualMachineScaleSetVMInstanceRequiredIDs) *retry.Error {
 	m.ctrl.T.Helper()
@@ -19,11 +19,13 @@ limitations under the License.
 package metrics
 
 import (
+	"context"
 	"strings"
 	"time"
 
 	"k8s.io/component-base/metrics"
 	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/legacy-cloud-providers/azure/trace"
 )
 
 type apiCallMetrics struct {
@@ -42,19 +44,49 @@ var (
 	}
 
 	apiMetrics = registerAPIMetrics(metricLabels...)
+
+	backendPoolHostResults = registerBackendPoolHostResults()
+
+	cacheOperations = registerCacheOperations()
+
+	cacheReadTypes = registerCacheReadTypes()
+
+	cacheServedEntryAge = registerCacheServedEntryAge()
+
+	armOutageBreakerTrips = registerARMOutageBreakerTrips()
+
+	lbFrontendMetrics = registerLoadBalancerFrontendMetrics()
+
+	sourceRangeGroupRules = registerSourceRangeGroupRules()
+
+	sharedRuleGCRemovals = registerSharedRuleGCRemovals()
+
+	routeBatchSize = registerRouteBatchSize()
+
+	routeBatchLatency = registerRouteBatchLatency()
 )
 
 // MetricContext indicates the context for Azure client metrics.
 type MetricContext struct {
 	start      time.Time
 	attributes []string
+	span       *trace.Span
 }
 
 // NewMetricContext creates a new MetricContext.
 func NewMetricContext(prefix, request, resourceGroup, subscriptionID, source string) *MetricContext {
+	_, span := trace.StartSpan(context.Background(), "arm_request")
+	span.SetAttribute("request", prefix+"_"+request)
+	span.SetAttribute("resource_group", strings.ToLower(resourceGroup))
+	span.SetAttribute("subscription_id", subscriptionID)
+	if source != "" {
+		span.SetAttribute("source", source)
+	}
+
 	return &MetricContext{
 		start:      time.Now(),
 		attributes: []string{prefix + "_" + request, strings.ToLower(resourceGroup), subscriptionID, source},
+		span:       span,
 	}
 }
 
@@ -75,6 +107,7 @@ func (mc *MetricContext) Observe(err error) error {
 	if err != nil {
 		apiMetrics.errors.WithLabelValues(mc.attributes...).Inc()
 	}
+	mc.span.End(err)
 
 	return err
 }
@@ -124,3 +157,203 @@ func registerAPIMetrics(attributes ...string) *apiCallMetrics {
 
 	return metrics
 }
+
+// BackendPoolHostResultsCount records how many nodes ended up with the given
+// result while being ensured in a load balancer backend pool.
+func BackendPoolHostResultsCount(result string, count int) {
+	backendPoolHostResults.WithLabelValues(result).Add(float64(count))
+}
+
+// LoadBalancerFrontendMetricSet records the latest Azure Monitor value of the
+// platform metric for the load balancer frontend serving the service.
+func LoadBalancerFrontendMetricSet(metric, service string, value float64) {
+	lbFrontendMetrics.WithLabelValues(metric, service).Set(value)
+}
+
+// SourceRangeGroupRulesSet records how many security rules the named source
+// range group of the service expanded to.
+func SourceRangeGroupRulesSet(service, group string, count float64) {
+	sourceRangeGroupRules.WithLabelValues(service, group).Set(count)
+}
+
+// ObserveCacheOperation records one read of the named cache. The operation is
+// one of hit, miss, expired or forced_refresh.
+func ObserveCacheOperation(cache, operation string) {
+	cacheOperations.WithLabelValues(cache, operation).Inc()
+}
+
+// registerCacheOperations registers the cache operation metrics.
+func registerCacheOperations() *metrics.CounterVec {
+	counter := metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name:           "cloudprovider_azure_cache_operations_total",
+			Help:           "Number of cache reads by cache name and operation",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"cache", "operation"},
+	)
+	legacyregistry.MustRegister(counter)
+	return counter
+}
+
+// ObserveCacheReadType counts one read of the named cache by the read type
+// the caller used, one of default, unsafe or force_refresh.
+func ObserveCacheReadType(cache, readType string) {
+	cacheReadTypes.WithLabelValues(cache, readType).Inc()
+}
+
+// registerCacheReadTypes registers the cache read type metrics.
+func registerCacheReadTypes() *metrics.CounterVec {
+	counter := metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name:           "cloudprovider_azure_cache_read_types_total",
+			Help:           "Number of cache reads by cache name and read type",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"cache", "read_type"},
+	)
+	legacyregistry.MustRegister(counter)
+	return counter
+}
+
+// ObserveCacheServedEntryAge records how old a cache entry served without a
+// refetch was, so the staleness actually read through each read type becomes
+// visible; unsafe reads of long-expired entries show up as large ages.
+func ObserveCacheServedEntryAge(cache, readType string, ageSeconds float64) {
+	cacheServedEntryAge.WithLabelValues(cache, readType).Observe(ageSeconds)
+}
+
+// registerCacheServedEntryAge registers the cache staleness metrics.
+func registerCacheServedEntryAge() *metrics.HistogramVec {
+	histogram := metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Name:           "cloudprovider_azure_cache_served_entry_age_seconds",
+			Help:           "Age of cache entries at the time they were served without a refetch",
+			Buckets:        []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800},
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"cache", "read_type"},
+	)
+	legacyregistry.MustRegister(histogram)
+	return histogram
+}
+
+// ARMOutageBreakerOpened records one opening of the ARM outage breaker.
+func ARMOutageBreakerOpened() {
+	armOutageBreakerTrips.Inc()
+}
+
+// registerARMOutageBreakerTrips registers the ARM outage breaker metrics.
+func registerARMOutageBreakerTrips() *metrics.Counter {
+	counter := metrics.NewCounter(
+		&metrics.CounterOpts{
+			Name:           "cloudprovider_azure_arm_outage_breaker_trips",
+			Help:           "Number of times the ARM outage breaker opened because of a high error rate",
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+	legacyregistry.MustRegister(counter)
+	return counter
+}
+
+// registerLoadBalancerFrontendMetrics registers the load balancer frontend
+// platform metric gauge.
+func registerLoadBalancerFrontendMetrics() *metrics.GaugeVec {
+	gauge := metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Name:           "cloudprovider_azure_load_balancer_frontend_metric",
+			Help:           "Latest Azure Monitor platform metric value of the load balancer frontend serving the service",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"metric", "service"},
+	)
+	legacyregistry.MustRegister(gauge)
+	return gauge
+}
+
+// registerSourceRangeGroupRules registers the per-group security rule count
+// gauge.
+func registerSourceRangeGroupRules() *metrics.GaugeVec {
+	gauge := metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Name:           "cloudprovider_azure_source_range_group_rules",
+			Help:           "Number of security rules generated for the named source range group of the service",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"service", "group"},
+	)
+	legacyregistry.MustRegister(gauge)
+	return gauge
+}
+
+// SharedRuleGCRemoved counts the entries removed by the shared security rule
+// garbage collector. The kind is destination for a single stale destination
+// address and rule for a shared rule deleted because it had none left.
+func SharedRuleGCRemoved(kind string, count float64) {
+	sharedRuleGCRemovals.WithLabelValues(kind).Add(count)
+}
+
+// registerSharedRuleGCRemovals registers the shared rule garbage collection
+// metrics.
+func registerSharedRuleGCRemovals() *metrics.CounterVec {
+	counter := metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name:           "cloudprovider_azure_shared_rule_gc_removals_total",
+			Help:           "Number of stale destinations and emptied rules removed by the shared security rule garbage collector",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"kind"},
+	)
+	legacyregistry.MustRegister(counter)
+	return counter
+}
+
+// ObserveRouteBatch records one flush of the delayed route updater: how many
+// coalesced route operations it carried and how long the route table update
+// took.
+func ObserveRouteBatch(size int, latencySeconds float64) {
+	routeBatchSize.Observe(float64(size))
+	routeBatchLatency.Observe(latencySeconds)
+}
+
+// registerRouteBatchSize registers the route batch size metrics.
+func registerRouteBatchSize() *metrics.Histogram {
+	histogram := metrics.NewHistogram(
+		&metrics.HistogramOpts{
+			Name:           "cloudprovider_azure_route_batch_size",
+			Help:           "Number of route operations coalesced into one route table update",
+			Buckets:        []float64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000},
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+	legacyregistry.MustRegister(histogram)
+	return histogram
+}
+
+// registerRouteBatchLatency registers the route batch latency metrics.
+func registerRouteBatchLatency() *metrics.Histogram {
+	histogram := metrics.NewHistogram(
+		&metrics.HistogramOpts{
+			Name:           "cloudprovider_azure_route_batch_duration_seconds",
+			Help:           "Latency of batched route table updates",
+			Buckets:        []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+	legacyregistry.MustRegister(histogram)
+	return histogram
+}
+
+// registerBackendPoolHostResults registers the backend pool host result metrics.
+func registerBackendPoolHostResults() *metrics.CounterVec {
+	counter := metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name:           "cloudprovider_azure_backend_pool_host_results",
+			Help:           "Number of nodes processed for load balancer backend pools by result",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"result"},
+	)
+	legacyregistry.MustRegister(counter)
+	return counter
+}
@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -33,6 +34,10 @@ import (
 const (
 	// RetryAfterHeaderKey is the retry-after header key in ARM responses.
 	RetryAfterHeaderKey = "Retry-After"
+
+	// CorrelationIDHeaderKey is the header carrying the ARM correlation
+	// request id, which support uses to look up the request on the ARM side.
+	CorrelationIDHeaderKey = "X-Ms-Correlation-Request-Id"
 )
 
 var (
@@ -60,6 +65,13 @@ type Error struct {
 	RetryAfter time.Time
 	// RetryAfter indicates the raw error from API.
 	RawError error
+	// CorrelationID is the ARM correlation request id of the failed response,
+	// when the response carried one.
+	CorrelationID string
+	// RemediationHint carries an actionable remediation hint for well-known
+	// service error codes. It is attached by the consumers of the clients and
+	// is empty for errors without a known remediation.
+	RemediationHint string
 }
 
 // Error returns the error.
@@ -76,10 +88,32 @@ func (err *Error) Error() error {
 		retryAfterSeconds = int(err.RetryAfter.Sub(curTime) / time.Second)
 	}
 
+	if err.RemediationHint != "" {
+		return fmt.Errorf("Retriable: %v, RetryAfter: %ds, HTTPStatusCode: %d, RawError: %v, RemediationHint: %s",
+			err.Retriable, retryAfterSeconds, err.HTTPStatusCode, err.RawError, err.RemediationHint)
+	}
+
 	return fmt.Errorf("Retriable: %v, RetryAfter: %ds, HTTPStatusCode: %d, RawError: %v",
 		err.Retriable, retryAfterSeconds, err.HTTPStatusCode, err.RawError)
 }
 
+// serviceErrorCodeRE extracts the service error code from the raw ARM error body.
+var serviceErrorCodeRE = regexp.MustCompile(`"code"\s*:\s*"([^"]+)"`)
+
+// ServiceErrorCode returns the service error code carried in the raw ARM
+// error body, or an empty string when the raw error doesn't carry one.
+func (err *Error) ServiceErrorCode() string {
+	if err == nil || err.RawError == nil {
+		return ""
+	}
+
+	matches := serviceErrorCodeRE.FindStringSubmatch(err.RawError.Error())
+	if len(matches) != 2 {
+		return ""
+	}
+	return matches[1]
+}
+
 // IsThrottled returns true the if the request is being throttled.
 func (err *Error) IsThrottled() bool {
 	if err == nil {
@@ -153,7 +187,17 @@ func GetError(resp *http.Response, err error) *Error {
 		RetryAfter:     retryAfter,
 		Retriable:      shouldRetryHTTPRequest(resp, err),
 		HTTPStatusCode: getHTTPStatusCode(resp),
+		CorrelationID:  getCorrelationID(resp),
+	}
+}
+
+// getCorrelationID gets the ARM correlation request id from the response
+// headers, or an empty string when there is none.
+func getCorrelationID(resp *http.Response) string {
+	if resp == nil {
+		return ""
 	}
+	return resp.Header.Get(CorrelationIDHeaderKey)
 }
 
 // isSuccessHTTPResponse determines if the response from an HTTP request suggests success
@@ -36,6 +36,24 @@ func TestNewError(t *testing.T) {
 	assert.Equal(t, rawErr, newerr.RawError)
 }
 
+func TestServiceErrorCode(t *testing.T) {
+	var nilErr *Error
+	assert.Equal(t, "", nilErr.ServiceErrorCode())
+	assert.Equal(t, "", NewError(false, nil).ServiceErrorCode())
+	assert.Equal(t, "", NewError(false, fmt.Errorf("HTTP status code (404)")).ServiceErrorCode())
+
+	rawErr := fmt.Errorf(`{"error":{"code":"PublicIPCountLimitReached","message":"Cannot create more than 10 public IP addresses"}}`)
+	assert.Equal(t, "PublicIPCountLimitReached", NewError(false, rawErr).ServiceErrorCode())
+}
+
+func TestErrorWithRemediationHint(t *testing.T) {
+	err := NewError(false, fmt.Errorf("HTTP status code (400)"))
+	assert.NotContains(t, err.Error().Error(), "RemediationHint")
+
+	err.RemediationHint = "request a quota increase"
+	assert.Contains(t, err.Error().Error(), "RemediationHint: request a quota increase")
+}
+
 func TestGetRetriableError(t *testing.T) {
 	rawErr := fmt.Errorf("HTTP status code (404)")
 	newerr := GetRetriableError(rawErr)
@@ -138,6 +156,18 @@ func TestGetError(t *testing.T) {
 	}
 }
 
+func TestGetErrorCorrelationID(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusBadRequest,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte("some error"))),
+	}
+	resp.Header.Add(CorrelationIDHeaderKey, "bbbf8f42-9b27-4e3a-8e9d-0c8d69bba959")
+
+	rerr := GetError(resp, nil)
+	assert.Equal(t, "bbbf8f42-9b27-4e3a-8e9d-0c8d69bba959", rerr.CorrelationID)
+}
+
 func TestGetErrorNil(t *testing.T) {
 	rerr := GetError(nil, nil)
 	assert.Nil(t, rerr)
@@ -0,0 +1,152 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// SpanData is the immutable form of a finished span handed to the exporter.
+// Attributes carry correlation identifiers such as the service name, cluster
+// name and ARM request kind.
+type SpanData struct {
+	TraceID    string
+	SpanID     string
+	ParentID   string
+	Name       string
+	StartTime  time.Time
+	Duration   time.Duration
+	Attributes map[string]string
+	Error      error
+}
+
+// Exporter receives finished spans. The binary embedding the provider
+// typically bridges this to its tracing backend, for example an OpenTelemetry
+// SDK, by converting SpanData into the backend's span type.
+type Exporter interface {
+	ExportSpan(span SpanData)
+}
+
+var (
+	exporterLock sync.RWMutex
+	exporter     Exporter
+)
+
+// SetExporter configures the exporter finished spans are handed to. While no
+// exporter is set, which is the default, spans are not recorded at all.
+func SetExporter(e Exporter) {
+	exporterLock.Lock()
+	defer exporterLock.Unlock()
+	exporter = e
+}
+
+func getExporter() Exporter {
+	exporterLock.RLock()
+	defer exporterLock.RUnlock()
+	return exporter
+}
+
+type contextKey struct{}
+
+// Span is one traced operation. A nil span is valid and all its methods are
+// no-ops, so callers never have to guard for tracing being disabled.
+type Span struct {
+	lock sync.Mutex
+	data SpanData
+}
+
+// StartSpan starts a span as a child of the span carried by ctx, if any, and
+// returns a context carrying the new span for further nesting. When no
+// exporter is configured the returned span is nil.
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	if getExporter() == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		data: SpanData{
+			Name:       name,
+			SpanID:     newID(8),
+			StartTime:  time.Now(),
+			Attributes: map[string]string{},
+		},
+	}
+	if parent, ok := ctx.Value(contextKey{}).(*Span); ok && parent != nil {
+		span.data.TraceID = parent.data.TraceID
+		span.data.ParentID = parent.data.SpanID
+	} else {
+		span.data.TraceID = newID(16)
+	}
+
+	return context.WithValue(ctx, contextKey{}, span), span
+}
+
+// SetAttribute records a correlation attribute on the span.
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.data.Attributes[key] = value
+}
+
+// End finishes the span with the outcome of the operation and hands it to the
+// exporter.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	s.data.Duration = time.Since(s.data.StartTime)
+	s.data.Error = err
+	data := s.data
+	s.lock.Unlock()
+
+	if e := getExporter(); e != nil {
+		e.ExportSpan(data)
+	}
+}
+
+// newID returns n random bytes in hex, used for trace and span identifiers.
+func newID(n int) string {
+	id := make([]byte, n)
+	if _, err := rand.Read(id); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(id)
+}
+
+// LogExporter writes finished spans to the provider log. It is mainly useful
+// for debugging; production setups should bridge to a tracing backend.
+type LogExporter struct{}
+
+// ExportSpan implements Exporter.
+func (LogExporter) ExportSpan(span SpanData) {
+	klog.V(4).Infof("trace: %s trace=%s span=%s parent=%s duration=%v attributes=%v error=%v",
+		span.Name, span.TraceID, span.SpanID, span.ParentID, span.Duration, span.Attributes, span.Error)
+}
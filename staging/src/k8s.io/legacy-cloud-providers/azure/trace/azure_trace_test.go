@@ -0,0 +1,68 @@
+// +build !providerless
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trace
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingExporter struct {
+	spans []SpanData
+}
+
+func (e *recordingExporter) ExportSpan(span SpanData) {
+	e.spans = append(e.spans, span)
+}
+
+func TestStartSpanWithoutExporter(t *testing.T) {
+	SetExporter(nil)
+
+	ctx, span := StartSpan(context.Background(), "noop")
+	assert.Nil(t, span, "span should be nil while no exporter is set")
+	// All methods of a nil span must be safe.
+	span.SetAttribute("key", "value")
+	span.End(nil)
+	assert.Equal(t, context.Background(), ctx)
+}
+
+func TestSpanParenting(t *testing.T) {
+	exporter := &recordingExporter{}
+	SetExporter(exporter)
+	defer SetExporter(nil)
+
+	ctx, parent := StartSpan(context.Background(), "parent")
+	parent.SetAttribute("service", "default/service1")
+	_, child := StartSpan(ctx, "child")
+	child.End(nil)
+	parent.End(fmt.Errorf("some error"))
+
+	assert.Len(t, exporter.spans, 2)
+	childData, parentData := exporter.spans[0], exporter.spans[1]
+	assert.Equal(t, "child", childData.Name)
+	assert.Equal(t, "parent", parentData.Name)
+	assert.Equal(t, parentData.TraceID, childData.TraceID, "child should share the parent's trace")
+	assert.Equal(t, parentData.SpanID, childData.ParentID)
+	assert.Empty(t, parentData.ParentID)
+	assert.Equal(t, "default/service1", parentData.Attributes["service"])
+	assert.Error(t, parentData.Error)
+}